@@ -1,7 +1,20 @@
+pub(crate) mod account_key;
+pub(crate) mod ari;
 pub(crate) mod client;
+pub(crate) mod dns01;
 pub(crate) mod flow;
 pub mod http01_protocol;
+pub(crate) mod http_trace;
+pub(crate) mod ocsp;
 pub mod responder_client;
+pub(crate) mod sct;
+pub(crate) mod sink;
+pub(crate) mod solver;
+pub(crate) mod timing;
 pub(crate) mod types;
 
-pub use flow::issue_certificate;
+pub use flow::{
+    IssuedCertificate, fetch_acme_directory, generate_csr, import_account, issue_certificate,
+    obtain_certificate, test_eab, wait_for_ca,
+};
+pub use timing::{RunBudget, phases_in_progress, run_step, within_budget};
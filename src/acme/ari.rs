@@ -0,0 +1,246 @@
+//! ACME Renewal Information (ARI, RFC 9773) support.
+//!
+//! ARI lets the CA tell clients when to renew a certificate instead of
+//! relying on a fixed `renew_before` threshold. The daemon opts in via
+//! `[acme] use_ari = true` and falls back to the threshold whenever the
+//! CA does not advertise a `renewalInfo` endpoint or the lookup fails.
+
+use anyhow::{Context, Result};
+use base64::Engine;
+use tracing::debug;
+use x509_parser::extensions::ParsedExtension;
+
+use crate::acme::client::AcmeClient;
+use crate::config::Settings;
+
+/// Builds the ARI certificate identifier for a PEM certificate.
+///
+/// The identifier is `base64url(authorityKeyIdentifier) "."
+/// base64url(serialNumber)`, with the serial taken as its DER content
+/// octets so a leading zero byte is preserved.
+///
+/// # Errors
+/// Returns an error if the certificate cannot be parsed or carries no
+/// authority key identifier.
+pub(crate) fn cert_id(cert_pem: &[u8]) -> Result<String> {
+    let (_, pem) = x509_parser::pem::parse_x509_pem(cert_pem)
+        .map_err(|e| anyhow::anyhow!("Failed to parse PEM certificate: {e}"))?;
+    let (_, cert) = x509_parser::parse_x509_certificate(&pem.contents)
+        .map_err(|e| anyhow::anyhow!("Failed to parse X509 certificate: {e}"))?;
+
+    let key_id = cert
+        .extensions()
+        .iter()
+        .find_map(|ext| match ext.parsed_extension() {
+            ParsedExtension::AuthorityKeyIdentifier(aki) => aki.key_identifier.as_ref(),
+            _ => None,
+        })
+        .ok_or_else(|| anyhow::anyhow!("Certificate has no authority key identifier"))?;
+
+    let engine = base64::engine::general_purpose::URL_SAFE_NO_PAD;
+    Ok(format!(
+        "{}.{}",
+        engine.encode(key_id.0),
+        engine.encode(cert.tbs_certificate.raw_serial())
+    ))
+}
+
+/// Reports whether the CA-suggested renewal window for `cert_pem` has
+/// opened at `now`, asking the ACME directory at `directory_url`.
+///
+/// Returns `Ok(None)` when the CA does not support ARI so the caller can
+/// keep using its `renew_before` threshold.
+///
+/// # Errors
+/// Returns an error if the certificate identifier cannot be built, the
+/// renewal-info request fails, or the returned window is malformed.
+pub(crate) async fn renewal_window_open(
+    settings: &Settings,
+    directory_url: &str,
+    cert_pem: &[u8],
+    insecure_mode: bool,
+    now: time::OffsetDateTime,
+) -> Result<Option<bool>> {
+    let cert_id = cert_id(cert_pem)?;
+    let mut client = AcmeClient::new(
+        directory_url.to_string(),
+        &settings.acme,
+        &settings.trust,
+        insecure_mode,
+    )
+    .await?;
+    let Some(info) = client.fetch_renewal_info(&cert_id).await? else {
+        return Ok(None);
+    };
+
+    let start = parse_timestamp(&info.suggested_window.start)?;
+    let end = parse_timestamp(&info.suggested_window.end)?;
+    if end < start {
+        anyhow::bail!("ARI suggested window ends before it starts");
+    }
+    if let Some(url) = info.explanation_url.as_deref() {
+        debug!("CA attached an ARI explanation: {url}");
+    }
+    Ok(Some(now >= start))
+}
+
+fn parse_timestamp(value: &str) -> Result<time::OffsetDateTime> {
+    let parsed = humantime::parse_rfc3339(value)
+        .with_context(|| format!("Invalid ARI timestamp: {value}"))?;
+    Ok(time::OffsetDateTime::from(parsed))
+}
+
+#[cfg(test)]
+mod tests {
+    use wiremock::matchers::{method, path, path_regex};
+    use wiremock::{Mock, MockServer, ResponseTemplate};
+
+    use super::*;
+
+    const TEST_SERIAL: [u8; 3] = [0x01, 0x02, 0x03];
+
+    fn issue_leaf_with_aki() -> String {
+        let ca_key = rcgen::KeyPair::generate().unwrap();
+        let mut ca_params = rcgen::CertificateParams::new(Vec::<String>::new()).unwrap();
+        ca_params.is_ca = rcgen::IsCa::Ca(rcgen::BasicConstraints::Unconstrained);
+        let ca_issuer = rcgen::Issuer::new(ca_params, ca_key);
+
+        let mut params =
+            rcgen::CertificateParams::new(vec!["leaf.example.internal".to_string()]).unwrap();
+        params.use_authority_key_identifier_extension = true;
+        params.serial_number = Some(rcgen::SerialNumber::from_slice(&TEST_SERIAL));
+        let leaf_key = rcgen::KeyPair::generate().unwrap();
+        params.signed_by(&leaf_key, &ca_issuer).unwrap().pem()
+    }
+
+    fn settings_for(server: &MockServer) -> Settings {
+        let mut settings = Settings::new(None).expect("settings must load");
+        settings.server = format!("{}/directory", server.uri());
+        settings.acme.directory_fetch_attempts = 1;
+        settings
+    }
+
+    async fn mount_directory(server: &MockServer, with_ari: bool) {
+        let mut body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+        });
+        if with_ari {
+            body["renewalInfo"] = serde_json::json!(format!("{}/renewal-info", server.uri()));
+        }
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&body))
+            .mount(server)
+            .await;
+    }
+
+    async fn mount_window(server: &MockServer, start: &str, end: &str) {
+        Mock::given(method("GET"))
+            .and(path_regex(
+                r"^/renewal-info/[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+$",
+            ))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "suggestedWindow": { "start": start, "end": end }
+            })))
+            .mount(server)
+            .await;
+    }
+
+    #[test]
+    fn test_cert_id_encodes_aki_and_serial() {
+        let pem = issue_leaf_with_aki();
+        let id = cert_id(pem.as_bytes()).unwrap();
+        let (aki, serial) = id.split_once('.').expect("identifier has two parts");
+        let engine = base64::engine::general_purpose::URL_SAFE_NO_PAD;
+
+        assert!(!engine.decode(aki).unwrap().is_empty());
+        assert_eq!(engine.decode(serial).unwrap(), TEST_SERIAL);
+    }
+
+    #[test]
+    fn test_cert_id_rejects_cert_without_aki() {
+        let key = rcgen::KeyPair::generate().unwrap();
+        let params = rcgen::CertificateParams::new(vec!["self.example".to_string()]).unwrap();
+        let pem = params.self_signed(&key).unwrap().pem();
+
+        let err = cert_id(pem.as_bytes()).unwrap_err();
+        assert!(err.to_string().contains("authority key identifier"));
+    }
+
+    #[tokio::test]
+    async fn test_renewal_window_open_when_window_started() {
+        let server = MockServer::start().await;
+        mount_directory(&server, true).await;
+        mount_window(&server, "2020-01-01T00:00:00Z", "2020-01-02T00:00:00Z").await;
+
+        let open = renewal_window_open(
+            &settings_for(&server),
+            &format!("{}/directory", server.uri()),
+            issue_leaf_with_aki().as_bytes(),
+            false,
+            time::OffsetDateTime::now_utc(),
+        )
+        .await
+        .unwrap();
+
+        assert_eq!(open, Some(true));
+    }
+
+    #[tokio::test]
+    async fn test_renewal_window_closed_before_start() {
+        let server = MockServer::start().await;
+        mount_directory(&server, true).await;
+        mount_window(&server, "2999-01-01T00:00:00Z", "2999-01-02T00:00:00Z").await;
+
+        let open = renewal_window_open(
+            &settings_for(&server),
+            &format!("{}/directory", server.uri()),
+            issue_leaf_with_aki().as_bytes(),
+            false,
+            time::OffsetDateTime::now_utc(),
+        )
+        .await
+        .unwrap();
+
+        assert_eq!(open, Some(false));
+    }
+
+    #[tokio::test]
+    async fn test_renewal_window_none_without_ari_support() {
+        let server = MockServer::start().await;
+        mount_directory(&server, false).await;
+
+        let open = renewal_window_open(
+            &settings_for(&server),
+            &format!("{}/directory", server.uri()),
+            issue_leaf_with_aki().as_bytes(),
+            false,
+            time::OffsetDateTime::now_utc(),
+        )
+        .await
+        .unwrap();
+
+        assert_eq!(open, None);
+    }
+
+    #[tokio::test]
+    async fn test_renewal_window_rejects_inverted_window() {
+        let server = MockServer::start().await;
+        mount_directory(&server, true).await;
+        mount_window(&server, "2020-01-02T00:00:00Z", "2020-01-01T00:00:00Z").await;
+
+        let err = renewal_window_open(
+            &settings_for(&server),
+            &format!("{}/directory", server.uri()),
+            issue_leaf_with_aki().as_bytes(),
+            false,
+            time::OffsetDateTime::now_utc(),
+        )
+        .await
+        .unwrap_err();
+
+        assert!(err.to_string().contains("ends before it starts"));
+    }
+}
@@ -1,26 +1,39 @@
 use anyhow::{Context, Result};
 use base64::Engine;
-use reqwest::{Client, Url};
+use reqwest::{Client, RequestBuilder, Url};
 use ring::digest::{Context as DigestContext, SHA256};
 use ring::hmac;
-use ring::rand::SystemRandom;
+use ring::rsa::PublicKeyComponents;
 use ring::signature::{ECDSA_P256_SHA256_FIXED_SIGNING, EcdsaKeyPair, KeyPair};
 use serde::{Deserialize, Serialize};
 use tracing::{debug, info, warn};
 
-use crate::acme::types::{Authorization, Order};
-use crate::config::{AcmeSettings, TrustSettings};
+use crate::acme::account_key::{self, AccountKeyPair};
+use crate::acme::http_trace;
+use crate::acme::types::{Authorization, Order, RenewalInfo};
+use crate::config::{AcmeSettings, HttpTrace, TrustSettings, UrlRewrite};
+use crate::dns;
 use crate::eab::EabCredentials;
-use crate::tls::build_http_client;
+use crate::tls::build_http_client_with;
 
 const ALG_ES256: &str = "ES256";
 const ALG_HS256: &str = "HS256";
+const ALG_RS256: &str = "RS256";
 const CRV_P256: &str = "P-256";
 const KTY_EC: &str = "EC";
+const KTY_RSA: &str = "RSA";
 const CONTENT_TYPE_JOSE_JSON: &str = "application/jose+json";
 const HEADER_REPLAY_NONCE: &str = "replay-nonce";
+const HEADER_TRACEPARENT: &str = "traceparent";
 const SCHEME_HTTP: &str = "http";
 const SCHEME_HTTPS: &str = "https";
+/// RFC 8555 §6.5 problem type for a rejected anti-replay nonce.
+const PROBLEM_BAD_NONCE: &str = "urn:ietf:params:acme:error:badNonce";
+/// RFC 8555 §6.7 problem type for a request refused by a rate limit.
+const PROBLEM_RATE_LIMITED: &str = "urn:ietf:params:acme:error:rateLimited";
+/// How many times a request rejected with `badNonce` is re-signed with a
+/// fresh nonce before the error is surfaced.
+const BAD_NONCE_RETRIES: u32 = 3;
 
 /// Length of an uncompressed P-256 public key: 1-byte prefix + two
 /// 32-byte coordinates.
@@ -37,38 +50,90 @@ struct Directory {
     account: String,
     #[serde(rename = "newOrder")]
     order: String,
+    /// ARI endpoint (RFC 9773); absent when the CA does not support it.
+    #[serde(rename = "renewalInfo", default)]
+    renewal_info: Option<String>,
+    #[serde(default)]
+    meta: DirectoryMeta,
+}
+
+/// Directory `meta` object (RFC 8555 §7.1.1).
+#[derive(Debug, Deserialize, Clone, Default)]
+struct DirectoryMeta {
+    /// `None` when the CA does not advertise the field.
+    #[serde(rename = "externalAccountRequired", default)]
+    external_account_required: Option<bool>,
+    #[serde(rename = "termsOfService", default)]
+    terms_of_service: Option<String>,
 }
 
 pub(crate) struct AcmeClient {
     client: Client,
     directory_url: String,
     directory: Option<Directory>,
-    key_pair: EcdsaKeyPair,
+    key_pair: AccountKeyPair,
     key_id: Option<String>,
     nonce: Option<String>,
     directory_fetch_attempts: u64,
     directory_fetch_base_delay_secs: u64,
     directory_fetch_max_delay_secs: u64,
+    allow_insecure_http: bool,
+    url_rewrites: Vec<UrlRewrite>,
+    traceparent: Option<String>,
+    trace_http: HttpTrace,
+    require_tos: Option<String>,
 }
 
 impl AcmeClient {
     /// Creates a new `AcmeClient` instance.
     ///
+    /// A configured account key is loaded on the blocking pool, since
+    /// creating it may wait on another process's lock on the key file.
+    ///
     /// # Errors
     /// Returns error if account key generation fails or HTTP client build fails.
-    pub(crate) fn new(
+    pub(crate) async fn new(
+        directory_url: String,
+        settings: &AcmeSettings,
+        trust: &TrustSettings,
+        insecure_mode: bool,
+    ) -> Result<Self> {
+        let pkcs8 = if let Some(path) = settings.account_key_path.clone() {
+            tokio::task::spawn_blocking(move || account_key::load_or_create(&path))
+                .await
+                .context("Account key load failed")??
+        } else {
+            EcdsaKeyPair::generate_pkcs8(
+                &ECDSA_P256_SHA256_FIXED_SIGNING,
+                &ring::rand::SystemRandom::new(),
+            )
+            .map_err(|_| anyhow::anyhow!("Failed to generate account key"))?
+            .as_ref()
+            .to_vec()
+        };
+        Self::with_account_key(directory_url, settings, trust, insecure_mode, &pkcs8)
+    }
+
+    /// Creates an `AcmeClient` that signs with the given PKCS#8 account
+    /// key (ECDSA P-256 or RSA) instead of the configured or a generated
+    /// one.
+    ///
+    /// # Errors
+    /// Returns error if the key is neither a P-256 nor an RSA key or HTTP
+    /// client build fails.
+    pub(crate) fn with_account_key(
         directory_url: String,
         settings: &AcmeSettings,
         trust: &TrustSettings,
         insecure_mode: bool,
+        pkcs8: &[u8],
     ) -> Result<Self> {
-        let rng = ring::rand::SystemRandom::new();
-        let pkcs8 = EcdsaKeyPair::generate_pkcs8(&ECDSA_P256_SHA256_FIXED_SIGNING, &rng)
-            .map_err(|_| anyhow::anyhow!("Failed to generate account key"))?;
-        let key_pair =
-            EcdsaKeyPair::from_pkcs8(&ECDSA_P256_SHA256_FIXED_SIGNING, pkcs8.as_ref(), &rng)
-                .map_err(|_| anyhow::anyhow!("Failed to parse generated key pair"))?;
-        let client = build_http_client(trust, insecure_mode)?;
+        let key_pair = AccountKeyPair::from_pkcs8(pkcs8)?;
+        let mut builder = Client::builder();
+        if let Some(resolver) = dns::shared_resolver(settings.dns_resolver.as_deref())? {
+            builder = builder.dns_resolver(resolver);
+        }
+        let client = build_http_client_with(builder, trust, insecure_mode)?;
 
         Ok(Self {
             client,
@@ -80,9 +145,44 @@ impl AcmeClient {
             directory_fetch_attempts: settings.directory_fetch_attempts,
             directory_fetch_base_delay_secs: settings.directory_fetch_base_delay_secs,
             directory_fetch_max_delay_secs: settings.directory_fetch_max_delay_secs,
+            allow_insecure_http: settings.allow_insecure_http,
+            url_rewrites: settings.url_rewrites.clone(),
+            traceparent: None,
+            trace_http: settings.trace_http,
+            require_tos: settings.require_tos.clone(),
         })
     }
 
+    /// Sends `traceparent` (W3C trace context) with every request to the
+    /// CA so the issuance trace can be correlated on the CA side.
+    pub(crate) fn set_traceparent(&mut self, traceparent: String) {
+        self.traceparent = Some(traceparent);
+    }
+
+    /// Returns the URL of the account registered or looked up by this
+    /// client, if any.
+    pub(crate) fn account_url(&self) -> Option<&str> {
+        self.key_id.as_deref()
+    }
+
+    fn with_trace_context(&self, request: RequestBuilder) -> RequestBuilder {
+        match &self.traceparent {
+            Some(traceparent) => request.header(HEADER_TRACEPARENT, traceparent),
+            None => request,
+        }
+    }
+
+    /// Sends `request` with the trace context, dumping the exchange when
+    /// `--trace-http` is set.
+    async fn send(&self, request: RequestBuilder) -> reqwest::Result<reqwest::Response> {
+        http_trace::send(
+            &self.client,
+            self.with_trace_context(request),
+            self.trace_http,
+        )
+        .await
+    }
+
     fn b64(data: &[u8]) -> String {
         base64::engine::general_purpose::URL_SAFE_NO_PAD.encode(data)
     }
@@ -95,20 +195,28 @@ impl AcmeClient {
         if self.directory.is_some() {
             return Ok(());
         }
-        let directory_url = Self::enforce_https(&self.directory_url)?;
+        let directory_url = self.enforce_https(&self.directory_url)?;
         info!("Fetching ACME directory from {}", directory_url);
         let mut last_err = None;
         let mut delay_secs = self.directory_fetch_base_delay_secs;
         for attempt in 1..=self.directory_fetch_attempts {
-            let resp = self.client.get(directory_url.clone()).send().await;
+            let resp = self.send(self.client.get(directory_url.clone())).await;
             match resp {
+                Ok(resp) if !resp.status().is_success() => {
+                    last_err = Some(anyhow::anyhow!(
+                        "directory request returned HTTP {}",
+                        resp.status()
+                    ));
+                }
                 Ok(resp) => match resp.json::<Directory>().await {
                     Ok(dir) => {
                         self.directory = Some(dir);
                         return Ok(());
                     }
                     Err(err) => {
-                        last_err = Some(err.into());
+                        last_err = Some(anyhow::Error::new(err).context(
+                            "response is not an ACME directory with newNonce, newAccount and newOrder",
+                        ));
                     }
                 },
                 Err(err) => {
@@ -131,6 +239,45 @@ impl AcmeClient {
         Err(last_err.unwrap_or_else(|| anyhow::anyhow!("Directory fetch failed")))
     }
 
+    /// Fetches the ACME directory once, without retries, and returns it as
+    /// the CA sent it after checking that it lists the endpoints an
+    /// issuance needs.
+    ///
+    /// # Errors
+    /// Returns error if the request fails or the response is not an ACME
+    /// directory.
+    pub(crate) async fn directory_json(&mut self) -> Result<serde_json::Value> {
+        let directory_url = self.enforce_https(&self.directory_url)?;
+        let resp = self.send(self.client.get(directory_url)).await?;
+        if !resp.status().is_success() {
+            anyhow::bail!("directory request returned HTTP {}", resp.status());
+        }
+        let value: serde_json::Value = resp.json().await.context("response is not JSON")?;
+        let directory = serde_json::from_value::<Directory>(value.clone())
+            .context("response is not an ACME directory with newNonce, newAccount and newOrder")?;
+        self.directory = Some(directory);
+        Ok(value)
+    }
+
+    /// Confirms the ACME directory at `directory_url` is reachable through
+    /// the configured trust and lists the endpoints an issuance needs.
+    ///
+    /// # Errors
+    /// Returns `cannot reach ACME server at <url>: <reason>` when the
+    /// directory cannot be fetched or is not an ACME directory.
+    pub(crate) async fn check_directory(
+        directory_url: &str,
+        settings: &AcmeSettings,
+        trust: &TrustSettings,
+        insecure_mode: bool,
+    ) -> Result<()> {
+        let mut client = Self::new(directory_url.to_string(), settings, trust, insecure_mode)?;
+        client
+            .fetch_directory()
+            .await
+            .with_context(|| format!("cannot reach ACME server at {directory_url}"))
+    }
+
     /// Fetches a nonce for JWS requests.
     ///
     /// # Errors
@@ -146,8 +293,8 @@ impl AcmeClient {
             .as_ref()
             .ok_or_else(|| anyhow::anyhow!("Directory not loaded"))?;
 
-        let nonce_url = Self::enforce_https(&dir.nonce)?;
-        let resp = self.client.head(nonce_url).send().await?;
+        let nonce_url = self.transport_url(&self.enforce_https(&dir.nonce)?)?;
+        let resp = self.send(self.client.head(nonce_url)).await?;
         let nonce = resp
             .headers()
             .get(HEADER_REPLAY_NONCE)
@@ -157,27 +304,51 @@ impl AcmeClient {
         Ok(nonce)
     }
 
+    /// Returns the directory's `meta.externalAccountRequired`, or `None`
+    /// when the CA does not advertise it.
+    ///
+    /// # Errors
+    /// Returns error if the directory cannot be fetched.
+    pub(crate) async fn external_account_required(&mut self) -> Result<Option<bool>> {
+        self.fetch_directory().await?;
+        Ok(self
+            .directory
+            .as_ref()
+            .ok_or_else(|| anyhow::anyhow!("Directory not loaded"))?
+            .meta
+            .external_account_required)
+    }
+
     /// Registers a new account with the ACME server.
     ///
+    /// With `acme.require_tos` set, the Terms of Service are agreed to
+    /// only when the directory still advertises that URL.
+    ///
     /// # Errors
-    /// Returns error if ACME API fails or EAB data is invalid.
+    /// Returns error if ACME API fails, EAB data is invalid, or the
+    /// directory's Terms of Service differ from `acme.require_tos`.
     pub(crate) async fn register_account(
         &mut self,
         contact: &[String],
         eab_creds: Option<&EabCredentials>,
     ) -> Result<()> {
         self.fetch_directory().await?;
-        let url = self
+        let directory = self
             .directory
             .as_ref()
-            .ok_or_else(|| anyhow::anyhow!("Directory not loaded"))?
-            .account
-            .clone();
+            .ok_or_else(|| anyhow::anyhow!("Directory not loaded"))?;
+        if let Some(required) = &self.require_tos {
+            check_terms_of_service(directory.meta.terms_of_service.as_deref(), required)?;
+            info!("Agreeing to Terms of Service {}", required);
+        }
+        let url = directory.account.clone();
 
         let mut payload = serde_json::json!({
-            "termsOfServiceAgreed": true,
-            "contact": contact
+            "termsOfServiceAgreed": true
         });
+        if !contact.is_empty() {
+            payload["contact"] = serde_json::json!(contact);
+        }
 
         if let Some(creds) = eab_creds {
             let binding = self.external_account_binding(&url, creds)?;
@@ -186,7 +357,22 @@ impl AcmeClient {
 
         info!("Registering account...");
         let resp = self.signed_post(&url, Some(&payload)).await?;
-        let resp = check_response(resp, "Account registration").await?;
+        let resp = match check_response(resp, "Account registration").await {
+            Ok(resp) => resp,
+            Err(err) if is_account_exists(&err) => {
+                info!("Account already exists for this key; looking it up");
+                let kid = self
+                    .find_existing_account()
+                    .await
+                    .with_context(|| format!("Recovering existing account after: {err:#}"))?;
+                info!("Using existing account: {}", kid);
+                return Ok(());
+            }
+            Err(err) => return Err(err),
+        };
+        // RFC 8555 §7.3.1: 200 (rather than 201) means the key already
+        // had an account and the CA returned it instead of creating one.
+        let existing = resp.status() == reqwest::StatusCode::OK;
 
         let kid = resp
             .headers()
@@ -195,12 +381,62 @@ impl AcmeClient {
             .to_str()?
             .to_string();
 
-        info!("Account registered: {}", kid);
+        if existing {
+            info!("Using existing account: {}", kid);
+        } else {
+            info!("Account registered: {}", kid);
+        }
         self.key_id = Some(kid);
 
         Ok(())
     }
 
+    /// Looks up the account that already belongs to this client's key
+    /// (`onlyReturnExisting`, RFC 8555 §7.3.1) without creating one, and
+    /// returns its URL.
+    ///
+    /// # Errors
+    /// Returns error if ACME API fails or no account uses the key.
+    pub(crate) async fn find_existing_account(&mut self) -> Result<String> {
+        self.fetch_directory().await?;
+        let url = self
+            .directory
+            .as_ref()
+            .ok_or_else(|| anyhow::anyhow!("Directory not loaded"))?
+            .account
+            .clone();
+
+        let payload = serde_json::json!({ "onlyReturnExisting": true });
+        let resp = self.signed_post(&url, Some(&payload)).await?;
+        let resp = check_response(resp, "Account lookup").await?;
+
+        let kid = resp
+            .headers()
+            .get("Location")
+            .ok_or_else(|| anyhow::anyhow!("Missing Location header in account lookup"))?
+            .to_str()?
+            .to_string();
+        self.key_id = Some(kid.clone());
+        Ok(kid)
+    }
+
+    /// Deactivates the account this client registered or looked up
+    /// (RFC 8555 §7.3.6). The CA refuses all later requests for it.
+    ///
+    /// # Errors
+    /// Returns error if no account is known or the ACME API fails.
+    pub(crate) async fn deactivate_account(&mut self) -> Result<()> {
+        let url = self
+            .key_id
+            .clone()
+            .ok_or_else(|| anyhow::anyhow!("No account to deactivate"))?;
+        let payload = serde_json::json!({ "status": "deactivated" });
+        let resp = self.signed_post(&url, Some(&payload)).await?;
+        check_response(resp, "Account deactivation").await?;
+        info!("Account deactivated: {}", url);
+        Ok(())
+    }
+
     /// Creates a new order for the given domains.
     ///
     /// # Errors
@@ -263,13 +499,7 @@ impl AcmeClient {
     pub(crate) fn compute_key_authorization(&self, token: &str) -> Result<String> {
         let jwk = self.jwk()?;
 
-        let mut map = std::collections::BTreeMap::new();
-        map.insert("crv", jwk.crv);
-        map.insert("kty", jwk.kty);
-        map.insert("x", jwk.x);
-        map.insert("y", jwk.y);
-
-        let json = serde_json::to_string(&map)?;
+        let json = serde_json::to_string(&jwk.thumbprint_members())?;
         debug!("Thumbprint Canonical JSON: {}", json);
 
         let mut context = DigestContext::new(&SHA256);
@@ -320,6 +550,38 @@ impl AcmeClient {
         Ok(cert_pem)
     }
 
+    /// Fetches the CA-suggested renewal window for a certificate.
+    ///
+    /// Returns `Ok(None)` when the directory does not advertise a
+    /// `renewalInfo` endpoint, so callers can fall back to their own
+    /// threshold logic.
+    ///
+    /// # Errors
+    /// Returns error if the directory fetch or renewal-info request fails.
+    pub(crate) async fn fetch_renewal_info(
+        &mut self,
+        cert_id: &str,
+    ) -> Result<Option<RenewalInfo>> {
+        self.fetch_directory().await?;
+        let Some(base) = self
+            .directory
+            .as_ref()
+            .ok_or_else(|| anyhow::anyhow!("Directory not loaded"))?
+            .renewal_info
+            .clone()
+        else {
+            return Ok(None);
+        };
+
+        let url = self.enforce_https(&format!("{}/{cert_id}", base.trim_end_matches('/')))?;
+        let url = self.transport_url(&url)?;
+        debug!("Fetching renewal info from {}", url);
+        let resp = self.send(self.client.get(url)).await?;
+        let resp = check_response(resp, "Fetch renewal info").await?;
+        let info: RenewalInfo = resp.json().await?;
+        Ok(Some(info))
+    }
+
     /// Polls the order status.
     ///
     /// # Errors
@@ -332,7 +594,18 @@ impl AcmeClient {
     }
 
     fn jwk(&self) -> Result<Jwk> {
-        let pk = self.key_pair.public_key();
+        let key_pair = match &self.key_pair {
+            AccountKeyPair::Ecdsa(key_pair) => key_pair,
+            AccountKeyPair::Rsa(key_pair) => {
+                let public = PublicKeyComponents::<Vec<u8>>::from(key_pair.public());
+                return Ok(Jwk::Rsa {
+                    kty: KTY_RSA.to_string(),
+                    n: Self::b64(&public.n),
+                    e: Self::b64(&public.e),
+                });
+            }
+        };
+        let pk = key_pair.public_key();
         let pk_bytes = pk.as_ref();
 
         if pk_bytes.len() != EC_P256_UNCOMPRESSED_LEN || pk_bytes[0] != EC_UNCOMPRESSED_PREFIX {
@@ -342,7 +615,7 @@ impl AcmeClient {
         let x = &pk_bytes[1..=EC_P256_COORD_LEN];
         let y = &pk_bytes[1 + EC_P256_COORD_LEN..EC_P256_UNCOMPRESSED_LEN];
 
-        Ok(Jwk {
+        Ok(Jwk::Ec {
             kty: KTY_EC.to_string(),
             crv: CRV_P256.to_string(),
             x: Self::b64(x),
@@ -350,6 +623,13 @@ impl AcmeClient {
         })
     }
 
+    fn jws_alg(&self) -> &'static str {
+        match self.key_pair {
+            AccountKeyPair::Ecdsa(_) => ALG_ES256,
+            AccountKeyPair::Rsa(_) => ALG_RS256,
+        }
+    }
+
     fn external_account_binding(
         &self,
         url: &str,
@@ -390,7 +670,7 @@ impl AcmeClient {
 
         let header = if let Some(kid) = &self.key_id {
             JwsHeader {
-                alg: ALG_ES256.to_string(),
+                alg: self.jws_alg().to_string(),
                 nonce,
                 url: url_value.clone(),
                 jwk: None,
@@ -398,7 +678,7 @@ impl AcmeClient {
             }
         } else {
             JwsHeader {
-                alg: ALG_ES256.to_string(),
+                alg: self.jws_alg().to_string(),
                 nonce,
                 url: url_value,
                 jwk: Some(self.jwk()?),
@@ -422,13 +702,9 @@ impl AcmeClient {
 
         let signing_input = format!("{protected_b64}.{payload_b64}");
 
-        let rng = SystemRandom::new();
-        let signature = self
-            .key_pair
-            .sign(&rng, signing_input.as_bytes())
-            .map_err(|_| anyhow::anyhow!("Failed to sign request"))?;
+        let signature = self.key_pair.sign(signing_input.as_bytes())?;
 
-        let signature_b64 = Self::b64(signature.as_ref());
+        let signature_b64 = Self::b64(&signature);
 
         let jws_body = serde_json::json!({
             "protected": protected_b64,
@@ -439,34 +715,90 @@ impl AcmeClient {
         Ok(jws_body)
     }
 
+    /// Signs and sends a JWS request. A `badNonce` rejection is retried
+    /// transparently with the fresh nonce the CA returned, up to
+    /// [`BAD_NONCE_RETRIES`] times; every other response is returned as is.
     async fn signed_post<T: Serialize + ?Sized>(
         &mut self,
         url: &str,
         payload: Option<&T>,
     ) -> Result<reqwest::Response> {
-        let url = Self::enforce_https(url)?;
-        let body = self.sign_request(&url, payload).await?;
+        let url = self.enforce_https(url)?;
+        // The JWS keeps the URL the CA returned; only the request goes
+        // to the rewritten one.
+        let transport_url = self.transport_url(&url)?;
         let label = if payload.is_some() {
             "POST"
         } else {
             "POST-as-GET"
         };
-        debug!("{label} {url} body: {body}");
-        let resp = self
-            .client
-            .post(url)
-            .header("Content-Type", CONTENT_TYPE_JOSE_JSON)
-            .json(&body)
-            .send()
-            .await?;
-        Ok(resp)
+        let mut retries = 0;
+        loop {
+            let body = self.sign_request(&url, payload).await?;
+            debug!("{label} {url} body: {body}");
+            let resp = self
+                .send(
+                    self.client
+                        .post(transport_url.clone())
+                        .header("Content-Type", CONTENT_TYPE_JOSE_JSON)
+                        .json(&body),
+                )
+                .await?;
+            if resp.status() != reqwest::StatusCode::BAD_REQUEST {
+                return Ok(resp);
+            }
+            let status = resp.status();
+            let headers = resp.headers().clone();
+            let problem = resp.bytes().await?;
+            if !is_bad_nonce(&problem) {
+                let mut rebuilt = http::Response::new(problem);
+                *rebuilt.status_mut() = status;
+                *rebuilt.headers_mut() = headers;
+                return Ok(reqwest::Response::from(rebuilt));
+            }
+            if retries == BAD_NONCE_RETRIES {
+                anyhow::bail!(
+                    "{label} {url} was rejected with badNonce {} times in a row; the CA may be \
+                     overloaded or a load balancer may be spreading requests across CA \
+                     instances that do not share nonces",
+                    retries + 1
+                );
+            }
+            retries += 1;
+            // The CA sends a fresh nonce with the rejection; use it
+            // rather than spending another newNonce round trip.
+            self.nonce = headers
+                .get(HEADER_REPLAY_NONCE)
+                .and_then(|value| value.to_str().ok())
+                .map(ToString::to_string);
+            warn!(
+                "CA rejected the nonce for {label} {url}; retrying ({retries}/{BAD_NONCE_RETRIES})."
+            );
+        }
+    }
+
+    /// Returns the URL to send a request for `url` to: `url` rewritten by
+    /// the first matching `--url-rewrite` rule, or `url` itself.
+    fn transport_url(&self, url: &Url) -> Result<Url> {
+        let Some(rewritten) = self
+            .url_rewrites
+            .iter()
+            .find_map(|rule| rule.apply(url.as_str()))
+        else {
+            return Ok(url.clone());
+        };
+        debug!("Rewriting ACME URL {url} to {rewritten}");
+        self.enforce_https(&rewritten)
     }
 
-    fn enforce_https(url: &str) -> Result<Url> {
+    fn enforce_https(&self, url: &str) -> Result<Url> {
         let parsed = Url::parse(url).context("Invalid ACME URL")?;
         if parsed.scheme() == SCHEME_HTTPS {
             return Ok(parsed);
         }
+        if parsed.scheme() == SCHEME_HTTP && self.allow_insecure_http {
+            return Ok(parsed);
+        }
         if parsed.scheme() == SCHEME_HTTP && cfg!(test) {
             warn!("Allowing non-HTTPS ACME URL in tests: {}", parsed);
             return Ok(parsed);
@@ -487,10 +819,100 @@ async fn check_response(resp: reqwest::Response, context: &str) -> Result<reqwes
         return Ok(resp);
     }
     let status = resp.status();
+    let retry_after = retry_after(resp.headers());
     let text = resp.text().await?;
+    if status == reqwest::StatusCode::TOO_MANY_REQUESTS
+        || problem_type(text.as_bytes()).as_deref() == Some(PROBLEM_RATE_LIMITED)
+    {
+        return Err(RateLimited {
+            context: context.to_string(),
+            status,
+            body: text,
+            retry_after,
+        }
+        .into());
+    }
     Err(anyhow::anyhow!("{context} failed: {status} - {text}"))
 }
 
+/// A request the CA refused with `429 Too Many Requests` or a
+/// `rateLimited` problem. Displays like any other failed response.
+#[derive(Debug, thiserror::Error)]
+#[error("{context} failed: {status} - {body}")]
+pub(crate) struct RateLimited {
+    context: String,
+    status: reqwest::StatusCode,
+    body: String,
+    /// The response's `Retry-After`, when it was given in seconds.
+    pub(crate) retry_after: Option<std::time::Duration>,
+}
+
+/// Returns the [`RateLimited`] refusal behind `err`, if that is what
+/// failed.
+pub(crate) fn rate_limited(err: &anyhow::Error) -> Option<&RateLimited> {
+    err.chain()
+        .find_map(|cause| cause.downcast_ref::<RateLimited>())
+}
+
+/// Reads a delta-seconds `Retry-After`. The HTTP-date form is ignored,
+/// leaving the caller's default pause.
+fn retry_after(headers: &reqwest::header::HeaderMap) -> Option<std::time::Duration> {
+    headers
+        .get(reqwest::header::RETRY_AFTER)?
+        .to_str()
+        .ok()?
+        .trim()
+        .parse::<u64>()
+        .ok()
+        .map(std::time::Duration::from_secs)
+}
+
+fn problem_type(body: &[u8]) -> Option<String> {
+    serde_json::from_slice::<serde_json::Value>(body)
+        .ok()?
+        .get("type")?
+        .as_str()
+        .map(str::to_string)
+}
+
+/// Checks the directory's advertised Terms of Service against the URL
+/// the operator agreed to, so a silently updated ToS is never agreed to
+/// on their behalf.
+fn check_terms_of_service(advertised: Option<&str>, required: &str) -> Result<()> {
+    let required = required.trim();
+    match advertised.map(str::trim) {
+        Some(current) if current == required => Ok(()),
+        Some(current) => anyhow::bail!(
+            "CA Terms of Service changed: the directory advertises {current} but \
+             acme.require_tos is {required}; review the new terms and set acme.require_tos \
+             (or --require-tos) to {current} to agree to them"
+        ),
+        None => anyhow::bail!(
+            "acme.require_tos is {required} but the CA directory advertises no Terms of \
+             Service (meta.termsOfService); not registering"
+        ),
+    }
+}
+
+/// Returns whether an account-registration error is the CA refusing to
+/// create a second account for a key that already has one. RFC 8555 has
+/// the CA return the existing account instead, but some CAs answer with
+/// `409 Conflict` or an "already exists" problem.
+fn is_account_exists(err: &anyhow::Error) -> bool {
+    if err.downcast_ref::<RateLimited>().is_some() {
+        return false;
+    }
+    let message = format!("{err:#}").to_ascii_lowercase();
+    message.contains("409 conflict")
+        || message.contains("already exists")
+        || message.contains("alreadyexists")
+}
+
+/// Returns whether an error body is an ACME `badNonce` problem document.
+fn is_bad_nonce(body: &[u8]) -> bool {
+    problem_type(body).as_deref() == Some(PROBLEM_BAD_NONCE)
+}
+
 fn decode_eab_key(encoded: &str) -> Result<Vec<u8>> {
     base64::engine::general_purpose::URL_SAFE_NO_PAD
         .decode(encoded)
@@ -499,11 +921,35 @@ fn decode_eab_key(encoded: &str) -> Result<Vec<u8>> {
 }
 
 #[derive(Debug, Serialize, Clone)]
-struct Jwk {
-    kty: String,
-    crv: String,
-    x: String,
-    y: String,
+#[serde(untagged)]
+enum Jwk {
+    Ec {
+        kty: String,
+        crv: String,
+        x: String,
+        y: String,
+    },
+    Rsa {
+        kty: String,
+        n: String,
+        e: String,
+    },
+}
+
+impl Jwk {
+    /// Required members in lexicographic order, as RFC 7638 hashes them.
+    fn thumbprint_members(&self) -> std::collections::BTreeMap<&'static str, &str> {
+        match self {
+            Self::Ec { kty, crv, x, y } => [("crv", crv), ("kty", kty), ("x", x), ("y", y)]
+                .into_iter()
+                .map(|(name, value)| (name, value.as_str()))
+                .collect(),
+            Self::Rsa { kty, n, e } => [("e", e), ("kty", kty), ("n", n)]
+                .into_iter()
+                .map(|(name, value)| (name, value.as_str()))
+                .collect(),
+        }
+    }
 }
 
 #[derive(Debug, Serialize)]
@@ -536,10 +982,27 @@ mod tests {
             directory_fetch_max_delay_secs: 0,
             poll_attempts: 15,
             poll_interval_secs: 2,
+            order_poll_interval_secs: None,
+            order_timeout_secs: None,
+            use_ari: false,
+            dns_resolver: None,
+            challenge: crate::config::ChallengeKind::Http01,
+            provisioner: None,
+            allow_insecure_http: false,
+            url_rewrites: Vec::new(),
+            purge_account_on_success: false,
+            trace_http: crate::config::HttpTrace::Off,
+            phase_timing: false,
+            check_sct: false,
+            require_eab: false,
+            require_tos: None,
+            account_key_path: None,
+            solver_command: None,
             http_responder_url: "http://localhost:8080".to_string(),
             http_responder_hmac: "dev-hmac".to_string(),
             http_responder_timeout_secs: 5,
             http_responder_token_ttl_secs: 300,
+            max_parallel_challenges: 1,
         }
     }
 
@@ -547,25 +1010,90 @@ mod tests {
         TrustSettings::default()
     }
 
-    #[test]
-    fn test_client_initialization() {
+    #[tokio::test]
+    async fn test_client_initialization() {
         let client = AcmeClient::new(
             "http://example.com".to_string(),
             &test_settings(),
             &test_trust(),
             false,
-        );
+        )
+        .await;
         assert!(client.is_ok());
     }
 
-    #[test]
-    fn test_compute_key_authorization() {
+    #[tokio::test]
+    async fn test_client_waits_for_account_key_lock_off_the_runtime_thread() {
+        let dir = tempfile::tempdir().unwrap();
+        let key_path = dir.path().join("account.key");
+        let lock = std::fs::File::create(account_key::lock_path(&key_path)).unwrap();
+        account_key::lock_exclusive(&lock).unwrap();
+        let release = std::thread::spawn(move || {
+            std::thread::sleep(std::time::Duration::from_secs(2));
+            drop(lock);
+        });
+        let mut settings = test_settings();
+        settings.account_key_path = Some(key_path.clone());
+        let client = tokio::spawn(async move {
+            AcmeClient::new(
+                "http://example.com".to_string(),
+                &settings,
+                &test_trust(),
+                false,
+            )
+            .await
+            .map(drop)
+        });
+
+        // The test runtime has one thread, so this sleep only ends early
+        // if the client waits for the lock somewhere else.
+        let started = std::time::Instant::now();
+        tokio::time::sleep(std::time::Duration::from_millis(50)).await;
+        assert!(started.elapsed() < std::time::Duration::from_secs(1));
+        assert!(!client.is_finished());
+
+        client.await.unwrap().unwrap();
+        release.join().unwrap();
+        assert!(key_path.exists());
+    }
+
+    #[tokio::test]
+    async fn test_client_initialization_with_dns_resolver() {
+        let mut settings = test_settings();
+        settings.dns_resolver = Some("127.0.0.1:5353".to_string());
+        let client = AcmeClient::new(
+            "http://example.com".to_string(),
+            &settings,
+            &test_trust(),
+            false,
+        )
+        .await;
+        assert!(client.is_ok());
+    }
+
+    #[tokio::test]
+    async fn test_client_rejects_invalid_dns_resolver() {
+        let mut settings = test_settings();
+        settings.dns_resolver = Some("resolver.example".to_string());
+        let result = AcmeClient::new(
+            "http://example.com".to_string(),
+            &settings,
+            &test_trust(),
+            false,
+        )
+        .await;
+        assert!(result.is_err());
+    }
+
+    #[tokio::test]
+    async fn test_compute_key_authorization() {
         let client = AcmeClient::new(
             "http://example.com".to_string(),
             &test_settings(),
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         let token = "test_token_123_xyz";
         let ka = client.compute_key_authorization(token).unwrap();
@@ -583,14 +1111,15 @@ mod tests {
         assert!(!thumbprint.contains('/'));
     }
 
-    #[test]
-    fn test_external_account_binding_structure() {
+    #[tokio::test]
+    async fn test_external_account_binding_structure() {
         let client = AcmeClient::new(
             "http://example.com".to_string(),
             &test_settings(),
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         let key = base64::engine::general_purpose::URL_SAFE_NO_PAD.encode(b"test-secret");
         let creds = EabCredentials {
@@ -667,6 +1196,7 @@ mod tests {
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         client
             .create_order(&["example.internal".to_string(), "192.0.2.10".to_string()])
@@ -710,6 +1240,76 @@ mod tests {
         assert!(found_ip);
     }
 
+    #[tokio::test]
+    async fn test_fetch_renewal_info_returns_window() {
+        let server = MockServer::start().await;
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+            "renewalInfo": format!("{}/renewal-info", server.uri()),
+        });
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .mount(&server)
+            .await;
+        Mock::given(method("GET"))
+            .and(path("/renewal-info/aki.serial"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "suggestedWindow": {
+                    "start": "2026-01-02T04:00:00Z",
+                    "end": "2026-01-03T04:00:00Z"
+                }
+            })))
+            .mount(&server)
+            .await;
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        let info = client
+            .fetch_renewal_info("aki.serial")
+            .await
+            .unwrap()
+            .expect("renewal info should be returned");
+
+        assert_eq!(info.suggested_window.start, "2026-01-02T04:00:00Z");
+        assert_eq!(info.suggested_window.end, "2026-01-03T04:00:00Z");
+    }
+
+    #[tokio::test]
+    async fn test_fetch_renewal_info_without_directory_entry_returns_none() {
+        let server = MockServer::start().await;
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+        });
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .mount(&server)
+            .await;
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        let info = client.fetch_renewal_info("aki.serial").await.unwrap();
+
+        assert!(info.is_none());
+    }
+
     struct DirectoryResponder {
         calls: Arc<AtomicUsize>,
         directory_body: serde_json::Value,
@@ -751,6 +1351,7 @@ mod tests {
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         client.fetch_directory().await.unwrap();
 
@@ -784,12 +1385,44 @@ mod tests {
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         let nonce = client.get_nonce().await.unwrap();
 
         assert_eq!(nonce, "nonce-123");
     }
 
+    #[tokio::test]
+    async fn test_traceparent_header_sent_when_set() {
+        const TRACEPARENT: &str = "00-11111111111111111111111111111111-2222222222222222-01";
+        let server = MockServer::start().await;
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+        });
+
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .and(header(HEADER_TRACEPARENT, TRACEPARENT))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .expect(1)
+            .mount(&server)
+            .await;
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        client.set_traceparent(TRACEPARENT.to_string());
+
+        client.fetch_directory().await.unwrap();
+    }
+
     #[tokio::test]
     async fn test_post_as_get_sends_empty_payload() {
         let server = MockServer::start().await;
@@ -833,6 +1466,7 @@ mod tests {
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         let order = client
             .poll_order(&format!("{}/order/1", server.uri()))
@@ -843,9 +1477,456 @@ mod tests {
     }
 
     #[tokio::test]
-    async fn test_fetch_directory_fails_after_retries() {
+    async fn test_url_rewrite_redirects_requests_but_signs_returned_url() {
+        const INTERNAL: &str = "http://stepca.internal:9000";
         let server = MockServer::start().await;
-        let calls = Arc::new(AtomicUsize::new(0));
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{INTERNAL}/nonce"),
+            "newAccount": format!("{INTERNAL}/account"),
+            "newOrder": format!("{INTERNAL}/order"),
+        });
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .mount(&server)
+            .await;
+        Mock::given(method("HEAD"))
+            .and(path("/nonce"))
+            .respond_with(ResponseTemplate::new(200).insert_header("replay-nonce", "nonce-abc"))
+            .mount(&server)
+            .await;
+        Mock::given(method("POST"))
+            .and(path("/order/1"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "status": "pending",
+                "finalize": format!("{INTERNAL}/finalize"),
+                "authorizations": [],
+                "certificate": null
+            })))
+            .expect(1)
+            .mount(&server)
+            .await;
+
+        let settings = AcmeSettings {
+            url_rewrites: vec![UrlRewrite {
+                from: format!("{INTERNAL}/"),
+                to: format!("{}/", server.uri()),
+            }],
+            ..test_settings()
+        };
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &settings,
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        client
+            .poll_order(&format!("{INTERNAL}/order/1"))
+            .await
+            .unwrap();
+
+        let requests = server.received_requests().await.unwrap();
+        let post = requests
+            .iter()
+            .find(|request| request.url.path() == "/order/1")
+            .expect("Expected order request at the rewritten URL");
+        let body: serde_json::Value = serde_json::from_slice(&post.body).unwrap();
+        let protected = base64::engine::general_purpose::URL_SAFE_NO_PAD
+            .decode(body["protected"].as_str().unwrap())
+            .unwrap();
+        let protected: serde_json::Value = serde_json::from_slice(&protected).unwrap();
+        assert_eq!(protected["url"], format!("{INTERNAL}/order/1"));
+    }
+
+    #[tokio::test]
+    async fn test_external_account_required_reads_directory_meta() {
+        for (meta, expected) in [
+            (
+                Some(serde_json::json!({ "externalAccountRequired": true })),
+                Some(true),
+            ),
+            (
+                Some(serde_json::json!({ "externalAccountRequired": false })),
+                Some(false),
+            ),
+            (Some(serde_json::json!({})), None),
+            (None, None),
+        ] {
+            let server = MockServer::start().await;
+            let mut directory_body = serde_json::json!({
+                "newNonce": format!("{}/nonce", server.uri()),
+                "newAccount": format!("{}/account", server.uri()),
+                "newOrder": format!("{}/order", server.uri()),
+            });
+            if let Some(meta) = meta {
+                directory_body["meta"] = meta;
+            }
+            Mock::given(method("GET"))
+                .and(path("/directory"))
+                .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+                .mount(&server)
+                .await;
+
+            let mut client = AcmeClient::new(
+                format!("{}/directory", server.uri()),
+                &test_settings(),
+                &test_trust(),
+                false,
+            )
+            .await
+            .unwrap();
+
+            assert_eq!(client.external_account_required().await.unwrap(), expected);
+        }
+    }
+
+    #[tokio::test]
+    async fn test_deactivate_account_posts_deactivated_status() {
+        let server = MockServer::start().await;
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "newNonce": format!("{}/nonce", server.uri()),
+                "newAccount": format!("{}/account", server.uri()),
+                "newOrder": format!("{}/order", server.uri()),
+            })))
+            .mount(&server)
+            .await;
+        Mock::given(method("HEAD"))
+            .and(path("/nonce"))
+            .respond_with(ResponseTemplate::new(200).insert_header("replay-nonce", "nonce-abc"))
+            .mount(&server)
+            .await;
+        Mock::given(method("POST"))
+            .and(path("/account"))
+            .respond_with(
+                ResponseTemplate::new(200)
+                    .insert_header("Location", format!("{}/account/7", server.uri())),
+            )
+            .mount(&server)
+            .await;
+        Mock::given(method("POST"))
+            .and(path("/account/7"))
+            .respond_with(ResponseTemplate::new(200))
+            .mount(&server)
+            .await;
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        assert!(client.deactivate_account().await.is_err());
+        client.find_existing_account().await.unwrap();
+        client.deactivate_account().await.unwrap();
+
+        let requests = server.received_requests().await.unwrap();
+        let request = requests
+            .iter()
+            .find(|request| request.url.path() == "/account/7")
+            .expect("Expected deactivation request");
+        let body: serde_json::Value = serde_json::from_slice(&request.body).unwrap();
+        let payload_json = base64::engine::general_purpose::URL_SAFE_NO_PAD
+            .decode(body["payload"].as_str().unwrap())
+            .unwrap();
+        let payload: serde_json::Value = serde_json::from_slice(&payload_json).unwrap();
+        assert_eq!(payload, serde_json::json!({ "status": "deactivated" }));
+    }
+
+    #[tokio::test]
+    async fn test_find_existing_account_sends_only_return_existing() {
+        let server = MockServer::start().await;
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+        });
+
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .mount(&server)
+            .await;
+
+        Mock::given(method("HEAD"))
+            .and(path("/nonce"))
+            .respond_with(ResponseTemplate::new(200).insert_header("replay-nonce", "nonce-abc"))
+            .mount(&server)
+            .await;
+
+        Mock::given(method("POST"))
+            .and(path("/account"))
+            .respond_with(
+                ResponseTemplate::new(200)
+                    .set_body_json(serde_json::json!({ "status": "valid" }))
+                    .insert_header("Location", format!("{}/account/7", server.uri())),
+            )
+            .mount(&server)
+            .await;
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        let account_url = client.find_existing_account().await.unwrap();
+
+        assert_eq!(account_url, format!("{}/account/7", server.uri()));
+        let requests = server.received_requests().await.unwrap();
+        let account_request = requests
+            .iter()
+            .find(|request| request.url.path() == "/account")
+            .expect("Expected account request");
+        let body: serde_json::Value = serde_json::from_slice(&account_request.body).unwrap();
+        let payload_json = base64::engine::general_purpose::URL_SAFE_NO_PAD
+            .decode(body["payload"].as_str().unwrap())
+            .unwrap();
+        let payload: serde_json::Value = serde_json::from_slice(&payload_json).unwrap();
+        assert_eq!(payload, serde_json::json!({ "onlyReturnExisting": true }));
+    }
+
+    async fn account_test_server() -> MockServer {
+        let server = MockServer::start().await;
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+        });
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .mount(&server)
+            .await;
+        Mock::given(method("HEAD"))
+            .and(path("/nonce"))
+            .respond_with(ResponseTemplate::new(200).insert_header("replay-nonce", "nonce-abc"))
+            .mount(&server)
+            .await;
+        server
+    }
+
+    #[tokio::test]
+    async fn test_directory_json_returns_directory_as_sent() {
+        let server = MockServer::start().await;
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+            "meta": {
+                "externalAccountRequired": true,
+                "termsOfService": "https://ca.example/tos",
+            },
+        });
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .mount(&server)
+            .await;
+        Mock::given(method("GET"))
+            .and(path("/not-acme"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "status": "ok"
+            })))
+            .mount(&server)
+            .await;
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        assert_eq!(client.directory_json().await.unwrap(), directory_body);
+        assert_eq!(
+            client.external_account_required().await.unwrap(),
+            Some(true)
+        );
+
+        let mut client = AcmeClient::new(
+            format!("{}/not-acme", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        let err = client.directory_json().await.unwrap_err();
+        assert!(err.to_string().contains("not an ACME directory"), "{err:#}");
+    }
+
+    #[tokio::test]
+    async fn test_trace_http_bodies_leaves_responses_readable() {
+        let server = account_test_server().await;
+        let settings = AcmeSettings {
+            trace_http: HttpTrace::Bodies,
+            ..test_settings()
+        };
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &settings,
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+
+        client.fetch_directory().await.unwrap();
+        assert!(!client.get_nonce().await.unwrap().is_empty());
+    }
+
+    #[tokio::test]
+    async fn test_register_account_accepts_existing_account() {
+        let server = account_test_server().await;
+        Mock::given(method("POST"))
+            .and(path("/account"))
+            .respond_with(
+                ResponseTemplate::new(200)
+                    .set_body_json(serde_json::json!({ "status": "valid" }))
+                    .insert_header("Location", format!("{}/account/7", server.uri())),
+            )
+            .expect(1)
+            .mount(&server)
+            .await;
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        client.register_account(&[], None).await.unwrap();
+
+        let expected = format!("{}/account/7", server.uri());
+        assert_eq!(client.account_url(), Some(expected.as_str()));
+    }
+
+    #[tokio::test]
+    async fn test_register_account_requires_expected_terms_of_service() {
+        let server = MockServer::start().await;
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+            "meta": { "termsOfService": "https://ca.internal/tos/v3" },
+        });
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .mount(&server)
+            .await;
+        Mock::given(method("POST"))
+            .and(path("/account"))
+            .respond_with(ResponseTemplate::new(201))
+            .expect(0)
+            .mount(&server)
+            .await;
+        let settings = AcmeSettings {
+            require_tos: Some("https://ca.internal/tos/v2".to_string()),
+            ..test_settings()
+        };
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &settings,
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        let err = client.register_account(&[], None).await.unwrap_err();
+
+        assert!(
+            err.to_string()
+                .contains("the directory advertises https://ca.internal/tos/v3"),
+            "{err:#}"
+        );
+        assert!(client.account_url().is_none());
+    }
+
+    #[test]
+    fn test_check_terms_of_service_matches_exact_url() {
+        let tos = "https://ca.internal/tos/v2";
+        assert!(check_terms_of_service(Some(tos), tos).is_ok());
+        assert!(check_terms_of_service(Some(tos), " https://ca.internal/tos/v2 ").is_ok());
+        assert!(check_terms_of_service(Some("https://ca.internal/tos/v3"), tos).is_err());
+        let err = check_terms_of_service(None, tos).unwrap_err();
+        assert!(err.to_string().contains("advertises no Terms of Service"));
+    }
+
+    #[tokio::test]
+    async fn test_register_account_recovers_when_account_already_exists() {
+        let server = account_test_server().await;
+        Mock::given(method("POST"))
+            .and(path("/account"))
+            .respond_with(ResponseTemplate::new(409).set_body_json(serde_json::json!({
+                "type": "urn:ietf:params:acme:error:malformed",
+                "detail": "account already exists for this key",
+            })))
+            .up_to_n_times(1)
+            .mount(&server)
+            .await;
+        Mock::given(method("POST"))
+            .and(path("/account"))
+            .respond_with(
+                ResponseTemplate::new(200)
+                    .set_body_json(serde_json::json!({ "status": "valid" }))
+                    .insert_header("Location", format!("{}/account/7", server.uri())),
+            )
+            .mount(&server)
+            .await;
+
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+        client.register_account(&[], None).await.unwrap();
+
+        let expected = format!("{}/account/7", server.uri());
+        assert_eq!(client.account_url(), Some(expected.as_str()));
+        let requests = server.received_requests().await.unwrap();
+        let lookup = requests
+            .iter()
+            .filter(|request| request.url.path() == "/account")
+            .nth(1)
+            .expect("Expected account lookup request");
+        let body: serde_json::Value = serde_json::from_slice(&lookup.body).unwrap();
+        let payload_json = base64::engine::general_purpose::URL_SAFE_NO_PAD
+            .decode(body["payload"].as_str().unwrap())
+            .unwrap();
+        let payload: serde_json::Value = serde_json::from_slice(&payload_json).unwrap();
+        assert_eq!(payload, serde_json::json!({ "onlyReturnExisting": true }));
+    }
+
+    #[test]
+    fn test_is_account_exists_ignores_other_failures() {
+        assert!(is_account_exists(&anyhow::anyhow!(
+            "Account registration failed: 409 Conflict - {{}}"
+        )));
+        assert!(!is_account_exists(&anyhow::anyhow!(
+            "Account registration failed: 400 Bad Request - unauthorized"
+        )));
+    }
+
+    #[tokio::test]
+    async fn test_fetch_directory_fails_after_retries() {
+        let server = MockServer::start().await;
+        let calls = Arc::new(AtomicUsize::new(0));
 
         Mock::given(method("GET"))
             .and(path("/directory"))
@@ -862,6 +1943,7 @@ mod tests {
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         let err = client.fetch_directory().await.unwrap_err();
 
@@ -869,6 +1951,72 @@ mod tests {
         assert!(!err.to_string().is_empty());
     }
 
+    #[tokio::test]
+    async fn test_check_directory_accepts_acme_directory() {
+        let server = MockServer::start().await;
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "newNonce": format!("{}/nonce", server.uri()),
+                "newAccount": format!("{}/account", server.uri()),
+                "newOrder": format!("{}/order", server.uri()),
+            })))
+            .mount(&server)
+            .await;
+
+        AcmeClient::check_directory(
+            &format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+    }
+
+    #[tokio::test]
+    async fn test_check_directory_reports_missing_endpoints() {
+        let server = MockServer::start().await;
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "newNonce": format!("{}/nonce", server.uri()),
+                "newAccount": format!("{}/account", server.uri()),
+            })))
+            .mount(&server)
+            .await;
+        let url = format!("{}/directory", server.uri());
+
+        let err = AcmeClient::check_directory(&url, &test_settings(), &test_trust(), false)
+            .await
+            .unwrap_err();
+
+        let message = format!("{err:#}");
+        assert!(message.starts_with(&format!("cannot reach ACME server at {url}: ")));
+        assert!(message.contains("newOrder"), "unexpected error: {message}");
+    }
+
+    #[tokio::test]
+    async fn test_check_directory_reports_http_status() {
+        let server = MockServer::start().await;
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(404))
+            .mount(&server)
+            .await;
+
+        let err = AcmeClient::check_directory(
+            &format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap_err();
+
+        assert!(format!("{err:#}").contains("HTTP 404"));
+    }
+
     #[tokio::test]
     async fn test_get_nonce_missing_header() {
         let server = MockServer::start().await;
@@ -896,6 +2044,7 @@ mod tests {
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         let err = client.get_nonce().await.unwrap_err();
 
@@ -935,6 +2084,7 @@ mod tests {
             &test_trust(),
             false,
         )
+        .await
         .unwrap();
         let err = client
             .poll_order(&format!("{}/order/2", server.uri()))
@@ -944,6 +2094,126 @@ mod tests {
         assert!(err.to_string().contains("Poll order failed"));
     }
 
+    struct BadNonceResponder {
+        calls: Arc<AtomicUsize>,
+        rejections: usize,
+        order_body: serde_json::Value,
+    }
+
+    impl Respond for BadNonceResponder {
+        fn respond(&self, _request: &Request) -> ResponseTemplate {
+            let attempt = self.calls.fetch_add(1, Ordering::SeqCst);
+            if attempt < self.rejections {
+                ResponseTemplate::new(400)
+                    .insert_header("replay-nonce", format!("fresh-{attempt}"))
+                    .insert_header("content-type", "application/problem+json")
+                    .set_body_json(serde_json::json!({
+                        "type": PROBLEM_BAD_NONCE,
+                        "detail": "nonce has already been used",
+                    }))
+            } else {
+                ResponseTemplate::new(200).set_body_json(&self.order_body)
+            }
+        }
+    }
+
+    async fn mount_bad_nonce_server(rejections: usize) -> (MockServer, Arc<AtomicUsize>) {
+        let server = MockServer::start().await;
+        let calls = Arc::new(AtomicUsize::new(0));
+        let directory_body = serde_json::json!({
+            "newNonce": format!("{}/nonce", server.uri()),
+            "newAccount": format!("{}/account", server.uri()),
+            "newOrder": format!("{}/order", server.uri()),
+        });
+        Mock::given(method("GET"))
+            .and(path("/directory"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(&directory_body))
+            .mount(&server)
+            .await;
+        Mock::given(method("HEAD"))
+            .and(path("/nonce"))
+            .respond_with(ResponseTemplate::new(200).insert_header("replay-nonce", "nonce-1"))
+            .mount(&server)
+            .await;
+        Mock::given(method("POST"))
+            .and(path("/order/3"))
+            .respond_with(BadNonceResponder {
+                calls: Arc::clone(&calls),
+                rejections,
+                order_body: serde_json::json!({
+                    "status": "pending",
+                    "finalize": format!("{}/finalize", server.uri()),
+                    "authorizations": [],
+                    "certificate": null
+                }),
+            })
+            .mount(&server)
+            .await;
+        (server, calls)
+    }
+
+    #[tokio::test]
+    async fn test_signed_post_retries_bad_nonce_then_succeeds() {
+        let (server, calls) = mount_bad_nonce_server(1).await;
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+
+        let order = client
+            .poll_order(&format!("{}/order/3", server.uri()))
+            .await
+            .unwrap();
+
+        assert_eq!(order.status, crate::acme::types::OrderStatus::Pending);
+        assert_eq!(calls.load(Ordering::SeqCst), 2);
+        let requests = server.received_requests().await.unwrap();
+        let nonce_fetches = requests
+            .iter()
+            .filter(|request| request.method.as_str() == "HEAD")
+            .count();
+        assert_eq!(
+            nonce_fetches, 1,
+            "retry must reuse the nonce from the rejection"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_signed_post_surfaces_persistent_bad_nonce() {
+        let (server, calls) = mount_bad_nonce_server(usize::MAX).await;
+        let mut client = AcmeClient::new(
+            format!("{}/directory", server.uri()),
+            &test_settings(),
+            &test_trust(),
+            false,
+        )
+        .await
+        .unwrap();
+
+        let err = client
+            .poll_order(&format!("{}/order/3", server.uri()))
+            .await
+            .unwrap_err();
+
+        assert!(err.to_string().contains("badNonce 4 times"));
+        assert_eq!(calls.load(Ordering::SeqCst), 4);
+    }
+
+    #[test]
+    fn test_is_bad_nonce_matches_problem_type_only() {
+        assert!(is_bad_nonce(
+            br#"{"type":"urn:ietf:params:acme:error:badNonce"}"#
+        ));
+        assert!(!is_bad_nonce(
+            br#"{"type":"urn:ietf:params:acme:error:malformed"}"#
+        ));
+        assert!(!is_bad_nonce(b"bad request"));
+    }
+
     #[tokio::test]
     async fn test_check_response_returns_response_on_success() {
         let server = MockServer::start().await;
@@ -985,6 +2255,42 @@ mod tests {
         assert!(msg.contains("test fail failed"));
         assert!(msg.contains("403"));
         assert!(msg.contains("forbidden"));
+        assert!(rate_limited(&err).is_none());
+    }
+
+    #[tokio::test]
+    async fn test_check_response_flags_rate_limit_with_retry_after() {
+        let server = MockServer::start().await;
+
+        Mock::given(method("POST"))
+            .and(path("/order"))
+            .respond_with(
+                ResponseTemplate::new(429)
+                    .insert_header("Retry-After", "90")
+                    .set_body_json(serde_json::json!({
+                        "type": PROBLEM_RATE_LIMITED,
+                        "detail": "too many new orders"
+                    })),
+            )
+            .mount(&server)
+            .await;
+
+        let resp = reqwest::Client::new()
+            .post(format!("{}/order", server.uri()))
+            .send()
+            .await
+            .unwrap();
+        let err = check_response(resp, "Order creation")
+            .await
+            .unwrap_err()
+            .context("issuance failed");
+
+        let limited = rate_limited(&err).expect("rate limit is recognised");
+        assert_eq!(
+            limited.retry_after,
+            Some(std::time::Duration::from_secs(90))
+        );
+        assert!(format!("{err:#}").contains("Order creation failed: 429"));
     }
 
     mod trust {
@@ -1097,10 +2403,27 @@ mod tests {
                 directory_fetch_max_delay_secs: 0,
                 poll_attempts: 1,
                 poll_interval_secs: 1,
+                order_poll_interval_secs: None,
+                order_timeout_secs: None,
+                use_ari: false,
+                dns_resolver: None,
+                challenge: crate::config::ChallengeKind::Http01,
+                provisioner: None,
+                allow_insecure_http: false,
+                url_rewrites: Vec::new(),
+                purge_account_on_success: false,
+                trace_http: crate::config::HttpTrace::Off,
+                phase_timing: false,
+                check_sct: false,
+                require_eab: false,
+                require_tos: None,
+                account_key_path: None,
+                solver_command: None,
                 http_responder_url: "http://localhost:8080".to_string(),
                 http_responder_hmac: "dev-hmac".to_string(),
                 http_responder_timeout_secs: 5,
                 http_responder_token_ttl_secs: 300,
+                max_parallel_challenges: 1,
             }
         }
 
@@ -1129,7 +2452,8 @@ mod tests {
                 &trust_test_settings(),
                 &trust,
                 true,
-            )?;
+            )
+            .await?;
             client.fetch_directory().await?;
             server.handle.abort();
             Ok(())
@@ -1144,7 +2468,8 @@ mod tests {
                 &trust_test_settings(),
                 &trust,
                 false,
-            )?;
+            )
+            .await?;
             assert!(client.fetch_directory().await.is_err());
             server.handle.abort();
             Ok(())
@@ -1158,6 +2483,9 @@ mod tests {
             let trust = TrustSettings {
                 ca_bundle_path: Some(bundle_path),
                 trusted_ca_sha256: vec![sha256_hex(&server.cert_der)],
+                include_root: false,
+                ca_dir: None,
+                ..TrustSettings::default()
             };
 
             let mut client = AcmeClient::new(
@@ -1165,7 +2493,8 @@ mod tests {
                 &trust_test_settings(),
                 &trust,
                 false,
-            )?;
+            )
+            .await?;
             client.fetch_directory().await?;
             server.handle.abort();
             Ok(())
@@ -1179,6 +2508,9 @@ mod tests {
             let trust = TrustSettings {
                 ca_bundle_path: Some(bundle_path),
                 trusted_ca_sha256: vec!["00".repeat(32)],
+                include_root: false,
+                ca_dir: None,
+                ..TrustSettings::default()
             };
 
             let mut client = AcmeClient::new(
@@ -1186,10 +2518,56 @@ mod tests {
                 &trust_test_settings(),
                 &trust,
                 false,
-            )?;
+            )
+            .await?;
             assert!(client.fetch_directory().await.is_err());
             server.handle.abort();
             Ok(())
         }
+
+        #[tokio::test]
+        async fn server_spki_pin_applies_with_and_without_chain_verification() -> Result<()> {
+            use x509_parser::prelude::FromDer;
+
+            let server = start_tls_server().await?;
+            let dir = tempfile::tempdir().context("tempdir")?;
+            let bundle_path = write_ca_bundle(&server.cert_pem, &dir)?;
+            let (_, cert) = x509_parser::certificate::X509Certificate::from_der(&server.cert_der)
+                .context("parse server cert")?;
+            let spki_pin = sha256_hex(cert.public_key().raw);
+            let pinned = |pins: Vec<String>, bundle: bool| TrustSettings {
+                ca_bundle_path: bundle.then(|| bundle_path.clone()),
+                trusted_ca_sha256: if bundle {
+                    vec![sha256_hex(&server.cert_der)]
+                } else {
+                    Vec::new()
+                },
+                server_spki_sha256: pins,
+                ..TrustSettings::default()
+            };
+            let fetch = |trust: TrustSettings, insecure: bool| {
+                let url = format!("{}/directory", server.url());
+                async move {
+                    let mut client =
+                        AcmeClient::new(url, &trust_test_settings(), &trust, insecure).await?;
+                    client.fetch_directory().await.map(drop)
+                }
+            };
+
+            fetch(pinned(vec!["00".repeat(32), spki_pin.clone()], true), false).await?;
+            assert!(
+                fetch(pinned(vec!["00".repeat(32)], true), false)
+                    .await
+                    .is_err()
+            );
+            fetch(pinned(vec![spki_pin], false), true).await?;
+            assert!(
+                fetch(pinned(vec!["00".repeat(32)], false), true)
+                    .await
+                    .is_err()
+            );
+            server.handle.abort();
+            Ok(())
+        }
     }
 }
@@ -0,0 +1,524 @@
+//! Built-in DNS-01 responder backed by a local authoritative DNS server.
+//!
+//! Fully internal domains often have no DNS provider API through which
+//! `_acme-challenge` TXT records could be published. Instead the agent
+//! runs a small UDP server that answers only those TXT queries from an
+//! in-memory table; operators delegate the `_acme-challenge` names (or
+//! point step-ca's `--resolver`) at `dns01.listen_addr`. Records are
+//! published right before a challenge is triggered and removed once the
+//! authorization settles, mirroring the `Present`/`CleanUp` pair of
+//! lego's `challenge.Provider`.
+//!
+//! When the challenge names are delegated through other nameservers,
+//! [`wait_for_propagation`] polls each of them for the record before
+//! the CA is asked to validate, so validation does not race the zone
+//! transfer.
+
+use std::collections::BTreeMap;
+use std::net::SocketAddr;
+use std::sync::{Arc, Mutex as StdMutex};
+use std::time::{Duration, Instant};
+
+use anyhow::{Context, Result};
+use base64::Engine;
+use ring::digest::{SHA256, digest};
+use tokio::net::UdpSocket;
+use tokio::sync::OnceCell;
+use tokio::task::JoinHandle;
+use tracing::{debug, info, warn};
+
+use crate::dns::{
+    DNS_CLASS_IN, DNS_FLAG_RECURSION_DESIRED, DNS_FLAG_RESPONSE, DNS_HEADER_LEN, DNS_LABEL_MAX_LEN,
+    DNS_MAX_UDP_PAYLOAD, DNS_POINTER_MASK, DNS_RCODE_NXDOMAIN, DnsResolver, RecordType, read_u16,
+};
+
+const ACME_CHALLENGE_LABEL: &str = "_acme-challenge";
+const DNS_FLAG_AUTHORITATIVE: u16 = 0x0400;
+const DNS_OPCODE_MASK: u16 = 0x7800;
+const DNS_RCODE_FORMERR: u16 = 1;
+const DNS_RCODE_NOTIMP: u16 = 4;
+const DNS_RCODE_REFUSED: u16 = 5;
+const DNS_QTYPE_ANY: u16 = 255;
+const DNS_COMPRESSED_QUESTION_NAME: [u8; 2] = [0xc0, 0x0c];
+const DNS01_RECORD_TTL_SECS: u32 = 10;
+const PROPAGATION_POLL_INTERVAL: Duration = Duration::from_secs(2);
+
+static SHARED_SERVER: OnceCell<LocalDnsServer> = OnceCell::const_new();
+
+type RecordTable = Arc<StdMutex<BTreeMap<String, Vec<String>>>>;
+
+/// Local authoritative DNS server that serves `_acme-challenge` TXT
+/// records.
+pub(crate) struct LocalDnsServer {
+    requested_addr: SocketAddr,
+    local_addr: SocketAddr,
+    records: RecordTable,
+    task: JoinHandle<()>,
+}
+
+impl LocalDnsServer {
+    /// Binds a UDP socket on `listen_addr` and starts answering queries.
+    ///
+    /// # Errors
+    /// Returns an error if the socket cannot be bound.
+    pub(crate) async fn bind(listen_addr: SocketAddr) -> Result<Self> {
+        let socket = UdpSocket::bind(listen_addr)
+            .await
+            .with_context(|| format!("Failed to bind DNS-01 server on {listen_addr}"))?;
+        let local_addr = socket
+            .local_addr()
+            .context("Failed to read DNS-01 server address")?;
+        let records = RecordTable::default();
+        let task = tokio::spawn(serve(socket, Arc::clone(&records)));
+        info!("DNS-01 server listening on {local_addr}");
+        Ok(Self {
+            requested_addr: listen_addr,
+            local_addr,
+            records,
+            task,
+        })
+    }
+
+    pub(crate) fn local_addr(&self) -> SocketAddr {
+        self.local_addr
+    }
+
+    /// Publishes the TXT record that proves control of `identifier`.
+    pub(crate) fn present(&self, identifier: &str, key_authorization: &str) {
+        let name = challenge_record_name(identifier);
+        let value = challenge_record_value(key_authorization);
+        let mut records = self.records.lock().expect("DNS-01 record mutex poisoned");
+        let values = records.entry(name).or_default();
+        if !values.contains(&value) {
+            values.push(value);
+        }
+    }
+
+    /// Removes the TXT record published by [`Self::present`].
+    pub(crate) fn cleanup(&self, identifier: &str, key_authorization: &str) {
+        let name = challenge_record_name(identifier);
+        let value = challenge_record_value(key_authorization);
+        let mut records = self.records.lock().expect("DNS-01 record mutex poisoned");
+        if let Some(values) = records.get_mut(&name) {
+            values.retain(|existing| *existing != value);
+            if values.is_empty() {
+                records.remove(&name);
+            }
+        }
+    }
+}
+
+impl Drop for LocalDnsServer {
+    fn drop(&mut self) {
+        self.task.abort();
+    }
+}
+
+/// Returns the process-wide DNS-01 server, starting it on first use.
+///
+/// Profiles issue concurrently, so they share one listener and one
+/// record table instead of competing for the port.
+///
+/// # Errors
+/// Returns an error if `listen_addr` is invalid, the socket cannot be
+/// bound, or the server is already running on a different address.
+pub(crate) async fn shared_server(listen_addr: &str) -> Result<&'static LocalDnsServer> {
+    let addr: SocketAddr = listen_addr
+        .parse()
+        .with_context(|| format!("Invalid dns01.listen_addr: {listen_addr}"))?;
+    let server = SHARED_SERVER
+        .get_or_try_init(|| LocalDnsServer::bind(addr))
+        .await?;
+    if server.requested_addr != addr {
+        anyhow::bail!(
+            "DNS-01 server already listens on {}; restart the agent to move it to {addr}",
+            server.requested_addr
+        );
+    }
+    Ok(server)
+}
+
+/// Returns the `_acme-challenge` record name for an ACME identifier.
+pub(crate) fn challenge_record_name(identifier: &str) -> String {
+    let domain = identifier.strip_prefix("*.").unwrap_or(identifier);
+    format!("{ACME_CHALLENGE_LABEL}.{}", normalize_name(domain))
+}
+
+/// Returns the TXT value for a key authorization (RFC 8555 §8.4).
+pub(crate) fn challenge_record_value(key_authorization: &str) -> String {
+    base64::engine::general_purpose::URL_SAFE_NO_PAD
+        .encode(digest(&SHA256, key_authorization.as_bytes()).as_ref())
+}
+
+/// Waits until every nameserver in `nameservers` serves `value` as a TXT
+/// record for `record_name`.
+///
+/// Servers are polled every two seconds; unreachable servers count as
+/// not yet propagated.
+///
+/// # Errors
+/// Returns an error naming the nameservers still lacking the record
+/// once `timeout` elapses, or if a nameserver address is invalid.
+pub(crate) async fn wait_for_propagation(
+    record_name: &str,
+    value: &str,
+    nameservers: &[String],
+    timeout: Duration,
+) -> Result<()> {
+    let mut pending = nameservers
+        .iter()
+        .map(|addr| DnsResolver::from_addr(addr).map(|resolver| (addr.as_str(), resolver)))
+        .collect::<Result<Vec<_>>>()?;
+    let deadline = Instant::now() + timeout;
+    loop {
+        let mut missing = Vec::new();
+        for (addr, resolver) in pending {
+            match resolver.query(record_name, RecordType::Txt).await {
+                Ok(answers) if answers.iter().any(|rdata| txt_value(rdata) == value) => {
+                    debug!("DNS-01 record {record_name} visible on {addr}");
+                }
+                Ok(_) => missing.push((addr, resolver)),
+                Err(err) => {
+                    debug!("DNS-01 propagation check against {addr} failed: {err:#}");
+                    missing.push((addr, resolver));
+                }
+            }
+        }
+        if missing.is_empty() {
+            info!("DNS-01 record {record_name} propagated to all nameservers");
+            return Ok(());
+        }
+        let remaining = deadline.saturating_duration_since(Instant::now());
+        if remaining.is_zero() {
+            let names = missing
+                .iter()
+                .map(|(addr, _)| *addr)
+                .collect::<Vec<_>>()
+                .join(", ");
+            anyhow::bail!(
+                "DNS-01 record {record_name} did not propagate within {}s; still missing on: {names}",
+                timeout.as_secs()
+            );
+        }
+        tokio::time::sleep(remaining.min(PROPAGATION_POLL_INTERVAL)).await;
+        pending = missing;
+    }
+}
+
+/// Joins the character-strings of one TXT RDATA into its value.
+fn txt_value(rdata: &[u8]) -> String {
+    let mut value = Vec::with_capacity(rdata.len());
+    let mut rest = rdata;
+    while let Some((&len, tail)) = rest.split_first() {
+        let len = usize::from(len).min(tail.len());
+        value.extend_from_slice(tail.get(..len).unwrap_or_default());
+        rest = tail.get(len..).unwrap_or_default();
+    }
+    String::from_utf8_lossy(&value).into_owned()
+}
+
+fn normalize_name(name: &str) -> String {
+    name.trim_end_matches('.').to_ascii_lowercase()
+}
+
+fn lookup(records: &RecordTable, name: &str) -> Option<Vec<String>> {
+    records
+        .lock()
+        .expect("DNS-01 record mutex poisoned")
+        .get(name)
+        .cloned()
+}
+
+async fn serve(socket: UdpSocket, records: RecordTable) {
+    let mut buf = vec![0u8; DNS_MAX_UDP_PAYLOAD];
+    loop {
+        let (len, peer) = match socket.recv_from(&mut buf).await {
+            Ok(received) => received,
+            Err(err) => {
+                warn!("DNS-01 server failed to receive a query: {err}");
+                continue;
+            }
+        };
+        let Some(query) = buf.get(..len) else {
+            continue;
+        };
+        match build_response(query, &records) {
+            Ok(Some(response)) => {
+                if let Err(err) = socket.send_to(&response, peer).await {
+                    debug!("DNS-01 server failed to answer {peer}: {err}");
+                }
+            }
+            Ok(None) => {}
+            Err(err) => debug!("DNS-01 server dropped a malformed query from {peer}: {err}"),
+        }
+    }
+}
+
+/// Builds the answer to one query, or `None` for packets that must not
+/// be answered (responses).
+fn build_response(query: &[u8], records: &RecordTable) -> Result<Option<Vec<u8>>> {
+    let id = read_u16(query, 0)?;
+    let flags = read_u16(query, 2)?;
+    if flags & DNS_FLAG_RESPONSE != 0 {
+        return Ok(None);
+    }
+    let response_flags =
+        DNS_FLAG_RESPONSE | DNS_FLAG_AUTHORITATIVE | (flags & DNS_FLAG_RECURSION_DESIRED);
+    if flags & DNS_OPCODE_MASK != 0 {
+        return Ok(Some(header_only(id, response_flags | DNS_RCODE_NOTIMP)));
+    }
+    if read_u16(query, 4)? != 1 {
+        return Ok(Some(header_only(id, response_flags | DNS_RCODE_FORMERR)));
+    }
+    let (name, question_end) = read_question_name(query)?;
+    let qtype = read_u16(query, question_end)?;
+    let qclass = read_u16(query, question_end + 2)?;
+    let question = query
+        .get(DNS_HEADER_LEN..question_end + 4)
+        .ok_or_else(|| anyhow::anyhow!("DNS question is truncated"))?;
+
+    let is_challenge_name = name
+        .strip_prefix(ACME_CHALLENGE_LABEL)
+        .is_some_and(|rest| rest.starts_with('.'));
+    let (rcode, answers) = if !is_challenge_name {
+        (DNS_RCODE_REFUSED, Vec::new())
+    } else if let Some(values) = lookup(records, &name) {
+        let wants_txt = qtype == RecordType::Txt.code() || qtype == DNS_QTYPE_ANY;
+        if wants_txt && qclass == DNS_CLASS_IN {
+            (0, values)
+        } else {
+            (0, Vec::new())
+        }
+    } else {
+        (DNS_RCODE_NXDOMAIN, Vec::new())
+    };
+
+    let answer_count = u16::try_from(answers.len()).context("Too many DNS-01 records")?;
+    let mut response = Vec::with_capacity(DNS_HEADER_LEN + question.len() + answers.len() * 64);
+    response.extend_from_slice(&id.to_be_bytes());
+    response.extend_from_slice(&(response_flags | rcode).to_be_bytes());
+    response.extend_from_slice(&1u16.to_be_bytes());
+    response.extend_from_slice(&answer_count.to_be_bytes());
+    response.extend_from_slice(&[0, 0, 0, 0]);
+    response.extend_from_slice(question);
+    for value in answers {
+        let text_len = u8::try_from(value.len()).context("DNS-01 TXT value is too long")?;
+        response.extend_from_slice(&DNS_COMPRESSED_QUESTION_NAME);
+        response.extend_from_slice(&RecordType::Txt.code().to_be_bytes());
+        response.extend_from_slice(&DNS_CLASS_IN.to_be_bytes());
+        response.extend_from_slice(&DNS01_RECORD_TTL_SECS.to_be_bytes());
+        response.extend_from_slice(&(u16::from(text_len) + 1).to_be_bytes());
+        response.push(text_len);
+        response.extend_from_slice(value.as_bytes());
+    }
+    Ok(Some(response))
+}
+
+fn header_only(id: u16, flags: u16) -> Vec<u8> {
+    let mut response = Vec::with_capacity(DNS_HEADER_LEN);
+    response.extend_from_slice(&id.to_be_bytes());
+    response.extend_from_slice(&flags.to_be_bytes());
+    response.extend_from_slice(&[0, 0, 0, 0, 0, 0, 0, 0]);
+    response
+}
+
+/// Reads the uncompressed question name, returning it normalized along
+/// with the offset of the QTYPE field.
+fn read_question_name(query: &[u8]) -> Result<(String, usize)> {
+    let mut labels = Vec::new();
+    let mut pos = DNS_HEADER_LEN;
+    loop {
+        let len = *query
+            .get(pos)
+            .ok_or_else(|| anyhow::anyhow!("DNS question name runs past the packet"))?;
+        if len & DNS_POINTER_MASK != 0 || usize::from(len) > DNS_LABEL_MAX_LEN {
+            anyhow::bail!("DNS question name is not a plain label sequence");
+        }
+        pos += 1;
+        if len == 0 {
+            break;
+        }
+        let label = query
+            .get(pos..pos + usize::from(len))
+            .ok_or_else(|| anyhow::anyhow!("DNS question label is truncated"))?;
+        labels.push(String::from_utf8_lossy(label).into_owned());
+        pos += usize::from(len);
+    }
+    Ok((normalize_name(&labels.join(".")), pos))
+}
+
+#[cfg(test)]
+mod tests {
+    use std::net::Ipv4Addr;
+
+    use super::*;
+
+    const TEST_IDENTIFIER: &str = "001.edge-proxy.edge-node-01.trusted.domain";
+    const TEST_KEY_AUTH: &str = "token.thumbprint";
+
+    fn build_query(name: &str, qtype: u16) -> Vec<u8> {
+        let mut query = vec![0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0];
+        for label in name.split('.') {
+            query.push(u8::try_from(label.len()).unwrap());
+            query.extend_from_slice(label.as_bytes());
+        }
+        query.push(0);
+        query.extend_from_slice(&qtype.to_be_bytes());
+        query.extend_from_slice(&DNS_CLASS_IN.to_be_bytes());
+        query
+    }
+
+    fn rcode(response: &[u8]) -> u16 {
+        read_u16(response, 2).unwrap() & 0x000f
+    }
+
+    async fn test_server() -> LocalDnsServer {
+        LocalDnsServer::bind((Ipv4Addr::LOCALHOST, 0).into())
+            .await
+            .unwrap()
+    }
+
+    #[test]
+    fn test_challenge_record_name_strips_wildcard_and_case() {
+        assert_eq!(
+            challenge_record_name("*.Internal.Example."),
+            "_acme-challenge.internal.example"
+        );
+    }
+
+    #[test]
+    fn test_challenge_record_value_is_unpadded_sha256() {
+        assert_eq!(
+            challenge_record_value(TEST_KEY_AUTH),
+            "61rBZ_4knHblO0MNoxFsXZ_eTFUHum0B6IVRbhvUn5I"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_present_and_cleanup_manage_records() {
+        let server = test_server().await;
+        let name = challenge_record_name(TEST_IDENTIFIER);
+
+        server.present(TEST_IDENTIFIER, TEST_KEY_AUTH);
+        server.present(TEST_IDENTIFIER, TEST_KEY_AUTH);
+        server.present(&format!("*.{TEST_IDENTIFIER}"), "other.thumbprint");
+        assert_eq!(lookup(&server.records, &name).unwrap().len(), 2);
+
+        server.cleanup(TEST_IDENTIFIER, TEST_KEY_AUTH);
+        assert_eq!(
+            lookup(&server.records, &name).unwrap(),
+            vec![challenge_record_value("other.thumbprint")]
+        );
+        server.cleanup(TEST_IDENTIFIER, "other.thumbprint");
+        assert!(lookup(&server.records, &name).is_none());
+    }
+
+    #[test]
+    fn test_build_response_refuses_other_names() {
+        let records = RecordTable::default();
+        let query = build_query("ca.internal", RecordType::Txt.code());
+
+        let response = build_response(&query, &records).unwrap().unwrap();
+
+        assert_eq!(rcode(&response), DNS_RCODE_REFUSED);
+    }
+
+    #[test]
+    fn test_build_response_returns_nxdomain_for_unknown_challenge() {
+        let records = RecordTable::default();
+        let query = build_query("_acme-challenge.missing.internal", RecordType::Txt.code());
+
+        let response = build_response(&query, &records).unwrap().unwrap();
+
+        assert_eq!(rcode(&response), DNS_RCODE_NXDOMAIN);
+        assert_ne!(read_u16(&response, 2).unwrap() & DNS_FLAG_AUTHORITATIVE, 0);
+    }
+
+    #[test]
+    fn test_build_response_ignores_responses_and_rejects_truncated() {
+        let records = RecordTable::default();
+        let mut query = build_query("_acme-challenge.internal", RecordType::Txt.code());
+        assert!(build_response(query.get(..14).unwrap(), &records).is_err());
+
+        query.splice(2..4, DNS_FLAG_RESPONSE.to_be_bytes());
+        assert!(build_response(&query, &records).unwrap().is_none());
+    }
+
+    #[tokio::test]
+    async fn test_server_answers_txt_queries() {
+        let server = test_server().await;
+        server.present(TEST_IDENTIFIER, TEST_KEY_AUTH);
+        let resolver = DnsResolver::new(server.local_addr());
+
+        let answers = resolver
+            .query(&challenge_record_name(TEST_IDENTIFIER), RecordType::Txt)
+            .await
+            .unwrap();
+
+        let expected = challenge_record_value(TEST_KEY_AUTH);
+        let mut rdata = vec![u8::try_from(expected.len()).unwrap()];
+        rdata.extend_from_slice(expected.as_bytes());
+        assert_eq!(answers, vec![rdata]);
+    }
+
+    #[tokio::test]
+    async fn test_server_omits_records_after_cleanup() {
+        let server = test_server().await;
+        server.present(TEST_IDENTIFIER, TEST_KEY_AUTH);
+        server.cleanup(TEST_IDENTIFIER, TEST_KEY_AUTH);
+        let resolver = DnsResolver::new(server.local_addr());
+
+        let answers = resolver
+            .query(&challenge_record_name(TEST_IDENTIFIER), RecordType::Txt)
+            .await
+            .unwrap();
+
+        assert!(answers.is_empty());
+    }
+
+    #[test]
+    fn test_txt_value_joins_character_strings() {
+        assert_eq!(txt_value(b"\x03abc\x02de"), "abcde");
+        assert_eq!(txt_value(b"\x05ab"), "ab");
+        assert_eq!(txt_value(b""), "");
+    }
+
+    #[tokio::test]
+    async fn test_wait_for_propagation_succeeds_when_record_is_served() {
+        let server = test_server().await;
+        server.present(TEST_IDENTIFIER, TEST_KEY_AUTH);
+
+        wait_for_propagation(
+            &challenge_record_name(TEST_IDENTIFIER),
+            &challenge_record_value(TEST_KEY_AUTH),
+            &[server.local_addr().to_string()],
+            Duration::from_secs(5),
+        )
+        .await
+        .unwrap();
+    }
+
+    #[tokio::test]
+    async fn test_wait_for_propagation_reports_missing_nameservers() {
+        let serving = test_server().await;
+        let lagging = test_server().await;
+        serving.present(TEST_IDENTIFIER, TEST_KEY_AUTH);
+        lagging.present(TEST_IDENTIFIER, "stale.thumbprint");
+
+        let err = wait_for_propagation(
+            &challenge_record_name(TEST_IDENTIFIER),
+            &challenge_record_value(TEST_KEY_AUTH),
+            &[
+                serving.local_addr().to_string(),
+                lagging.local_addr().to_string(),
+            ],
+            Duration::from_millis(100),
+        )
+        .await
+        .unwrap_err()
+        .to_string();
+
+        assert!(err.contains(&lagging.local_addr().to_string()), "{err}");
+        assert!(!err.contains(&serving.local_addr().to_string()), "{err}");
+    }
+}
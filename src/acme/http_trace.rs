@@ -0,0 +1,219 @@
+//! Raw dump of the agent's ACME HTTP exchanges (`--trace-http`).
+//!
+//! Like `curl -v`, every request the ACME client sends is written to
+//! standard error as its request line and headers (`> `), followed by the
+//! response status line and headers (`< `). With `--trace-http-bodies`
+//! the bodies follow as well. A JWS body is shown with its protected
+//! header and payload decoded, and every `signature` member, including
+//! the one of a nested external account binding, is redacted. Neither
+//! the EAB HMAC key nor the account private key is ever sent, so with
+//! the signatures gone nothing in the dump can authenticate as the
+//! account. Credential headers are redacted too.
+
+use std::fmt::Write as _;
+
+use base64::Engine;
+use reqwest::header::HeaderMap;
+use reqwest::{Client, Request, RequestBuilder, Response};
+use serde_json::Value;
+
+use crate::config::HttpTrace;
+
+const REDACTED: &str = "<redacted>";
+/// Headers whose values are never dumped.
+const SENSITIVE_HEADERS: &[&str] = &["authorization", "proxy-authorization", "cookie"];
+
+/// Sends `request` on `client`, dumping the exchange to standard error
+/// unless `trace` is [`HttpTrace::Off`].
+///
+/// When bodies are dumped the response body is read here, and the
+/// response handed back carries it in memory.
+pub(crate) async fn send(
+    client: &Client,
+    request: RequestBuilder,
+    trace: HttpTrace,
+) -> reqwest::Result<Response> {
+    if trace == HttpTrace::Off {
+        return request.send().await;
+    }
+    let bodies = trace == HttpTrace::Bodies;
+    let request = request.build()?;
+    eprint!("{}", format_request(&request, bodies));
+    let response = client.execute(request).await?;
+    let head = format_response_head(&response);
+    if !bodies {
+        eprint!("{head}");
+        return Ok(response);
+    }
+    let status = response.status();
+    let version = response.version();
+    let headers = response.headers().clone();
+    let body = response.bytes().await?;
+    eprint!("{head}{}", format_body('<', &body));
+
+    let mut rebuilt = http::Response::new(body);
+    *rebuilt.status_mut() = status;
+    *rebuilt.version_mut() = version;
+    *rebuilt.headers_mut() = headers;
+    Ok(Response::from(rebuilt))
+}
+
+fn format_request(request: &Request, bodies: bool) -> String {
+    let mut out = format!(
+        "> {} {} {:?}\n",
+        request.method(),
+        request.url(),
+        request.version()
+    );
+    out.push_str(&format_headers('>', request.headers()));
+    if bodies && let Some(body) = request.body().and_then(reqwest::Body::as_bytes) {
+        out.push_str(&format_body('>', body));
+    }
+    out
+}
+
+fn format_response_head(response: &Response) -> String {
+    let mut out = format!("< {:?} {}\n", response.version(), response.status());
+    out.push_str(&format_headers('<', response.headers()));
+    out
+}
+
+fn format_headers(marker: char, headers: &HeaderMap) -> String {
+    let mut out = String::new();
+    for (name, value) in headers {
+        let value = if SENSITIVE_HEADERS.contains(&name.as_str()) {
+            REDACTED
+        } else {
+            value.to_str().unwrap_or("<non-ASCII value>")
+        };
+        let _ = writeln!(out, "{marker} {name}: {value}");
+    }
+    let _ = writeln!(out, "{marker}");
+    out
+}
+
+fn format_body(marker: char, body: &[u8]) -> String {
+    if body.is_empty() {
+        return String::new();
+    }
+    let text = redact_body(body);
+    let mut out = String::new();
+    for line in text.lines() {
+        let _ = writeln!(out, "{marker} {line}");
+    }
+    out
+}
+
+/// Renders a body for the dump: JSON with JWS parts decoded and
+/// signatures redacted, other text as is, and binary data as its size.
+fn redact_body(body: &[u8]) -> String {
+    if let Ok(mut value) = serde_json::from_slice::<Value>(body) {
+        redact_jws(&mut value);
+        return serde_json::to_string_pretty(&value).unwrap_or_default();
+    }
+    match std::str::from_utf8(body) {
+        Ok(text) => text.to_string(),
+        Err(_) => format!("<{} bytes of binary data>", body.len()),
+    }
+}
+
+/// Decodes the `protected` and `payload` members of every JWS in
+/// `value` and redacts every `signature` member.
+fn redact_jws(value: &mut Value) {
+    match value {
+        Value::Object(members) => {
+            for key in ["protected", "payload"] {
+                if let Some(decoded) = members
+                    .get(key)
+                    .and_then(Value::as_str)
+                    .and_then(decode_json_part)
+                {
+                    members.insert(key.to_string(), decoded);
+                }
+            }
+            if let Some(signature) = members.get_mut("signature") {
+                *signature = Value::String(REDACTED.to_string());
+            }
+            members.values_mut().for_each(redact_jws);
+        }
+        Value::Array(items) => items.iter_mut().for_each(redact_jws),
+        _ => {}
+    }
+}
+
+fn decode_json_part(encoded: &str) -> Option<Value> {
+    let bytes = base64::engine::general_purpose::URL_SAFE_NO_PAD
+        .decode(encoded)
+        .ok()?;
+    serde_json::from_slice(&bytes).ok()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn b64(value: &Value) -> String {
+        base64::engine::general_purpose::URL_SAFE_NO_PAD.encode(value.to_string())
+    }
+
+    #[test]
+    fn test_redact_body_decodes_jws_and_hides_every_signature() {
+        let eab = serde_json::json!({
+            "protected": b64(&serde_json::json!({"alg": "HS256", "kid": "kid-1"})),
+            "payload": b64(&serde_json::json!({"kty": "EC", "crv": "P-256"})),
+            "signature": "eab-hmac-signature",
+        });
+        let jws = serde_json::json!({
+            "protected": b64(&serde_json::json!({"alg": "ES256", "nonce": "n-1"})),
+            "payload": b64(&serde_json::json!({
+                "termsOfServiceAgreed": true,
+                "externalAccountBinding": eab,
+            })),
+            "signature": "account-key-signature",
+        });
+
+        let dump = redact_body(jws.to_string().as_bytes());
+
+        assert!(!dump.contains("account-key-signature"), "{dump}");
+        assert!(!dump.contains("eab-hmac-signature"), "{dump}");
+        assert_eq!(dump.matches(REDACTED).count(), 2, "{dump}");
+        assert!(dump.contains("\"nonce\": \"n-1\""), "{dump}");
+        assert!(dump.contains("\"kid\": \"kid-1\""), "{dump}");
+    }
+
+    #[test]
+    fn test_redact_body_keeps_text_and_summarizes_binary() {
+        assert_eq!(
+            redact_body(b"-----BEGIN CERTIFICATE-----"),
+            "-----BEGIN CERTIFICATE-----"
+        );
+        assert_eq!(redact_body(&[0xff, 0xfe]), "<2 bytes of binary data>");
+        let post_as_get = serde_json::json!({"protected": "e30", "payload": "", "signature": "s"});
+        assert!(redact_body(post_as_get.to_string().as_bytes()).contains("\"payload\": \"\""));
+    }
+
+    #[test]
+    fn test_format_request_redacts_credential_headers() {
+        let request = Client::new()
+            .post("https://ca.internal/acme/new-order")
+            .header("authorization", "Bearer secret")
+            .header("content-type", "application/jose+json")
+            .body(r#"{"signature":"sig"}"#)
+            .build()
+            .unwrap();
+
+        let headers_only = format_request(&request, false);
+        assert!(headers_only.starts_with("> POST https://ca.internal/acme/new-order HTTP/1.1\n"));
+        assert!(headers_only.contains("> authorization: <redacted>\n"));
+        assert!(headers_only.contains("> content-type: application/jose+json\n"));
+        assert!(!headers_only.contains("secret"));
+        assert!(!headers_only.contains("signature"));
+
+        let with_body = format_request(&request, true);
+        assert!(
+            with_body.contains("\"signature\": \"<redacted>\""),
+            "{with_body}"
+        );
+        assert!(!with_body.contains("\"sig\""));
+    }
+}
@@ -0,0 +1,703 @@
+//! OCSP revocation checks (RFC 6960) for the daemon's current
+//! certificates.
+//!
+//! With `[profiles.daemon] renew_on_revoked = true` (or
+//! `--renew-on-revoked`) each renewal check also asks the OCSP responder
+//! named in the leaf's Authority Information Access extension whether
+//! the certificate was revoked, and renews at once when it was. step-ca
+//! does not run an OCSP responder, so leaves without an OCSP URL are
+//! skipped. The fetch is usually plain HTTP, so a response counts only
+//! when it is signed by the leaf's issuer or by a responder certificate
+//! the issuer delegated OCSP signing to.
+
+use std::time::Duration;
+
+use anyhow::{Context, Result};
+use ring::digest::{SHA1_FOR_LEGACY_USE_ONLY, digest};
+use ring::signature::{self, UnparsedPublicKey, VerificationAlgorithm};
+use tracing::debug;
+use x509_parser::certificate::X509Certificate;
+use x509_parser::extensions::{GeneralName, ParsedExtension};
+
+use crate::cert_chain;
+use crate::config::Settings;
+use crate::der::{
+    Der, TAG_BIT_STRING, TAG_ENUMERATED, TAG_INTEGER, TAG_OCTET_STRING, TAG_OID, TAG_SEQUENCE, tlv,
+};
+
+const OID_AD_OCSP: &str = "1.3.6.1.5.5.7.48.1";
+/// `id-pkix-ocsp-basic` (1.3.6.1.5.5.7.48.1.1), DER-encoded.
+const OID_OCSP_BASIC_DER: &[u8] = &[0x2b, 0x06, 0x01, 0x05, 0x05, 0x07, 0x30, 0x01, 0x01];
+/// `AlgorithmIdentifier` for SHA-1 with NULL parameters, the hash every
+/// responder accepts in a `CertID`.
+const SHA1_ALGORITHM_DER: &[u8] = &[
+    0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00,
+];
+// Signature and curve OIDs, DER-encoded, that a response may be signed
+// with.
+const OID_SHA256_WITH_RSA: &[u8] = &[0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x01, 0x0b];
+const OID_SHA384_WITH_RSA: &[u8] = &[0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x01, 0x0c];
+const OID_SHA512_WITH_RSA: &[u8] = &[0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x01, 0x0d];
+const OID_ECDSA_WITH_SHA256: &[u8] = &[0x2a, 0x86, 0x48, 0xce, 0x3d, 0x04, 0x03, 0x02];
+const OID_ECDSA_WITH_SHA384: &[u8] = &[0x2a, 0x86, 0x48, 0xce, 0x3d, 0x04, 0x03, 0x03];
+const OID_ED25519: &[u8] = &[0x2b, 0x65, 0x70];
+const OID_CURVE_P256: &[u8] = &[0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07];
+const OID_CURVE_P384: &[u8] = &[0x2b, 0x81, 0x04, 0x00, 0x22];
+const OCSP_REQUEST_CONTENT_TYPE: &str = "application/ocsp-request";
+const OCSP_TIMEOUT: Duration = Duration::from_secs(10);
+const OCSP_SUCCESSFUL: u8 = 0;
+
+const TAG_GOOD: u8 = 0x80;
+const TAG_REVOKED: u8 = 0xa1;
+const TAG_UNKNOWN: u8 = 0x82;
+const TAG_EXPLICIT_0: u8 = 0xa0;
+
+/// Revocation state reported for one certificate.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum OcspStatus {
+    Good,
+    Revoked { reason: Option<RevocationReason> },
+    Unknown,
+}
+
+/// `CRLReason` (RFC 5280, section 5.3.1).
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum RevocationReason {
+    Unspecified,
+    KeyCompromise,
+    CaCompromise,
+    AffiliationChanged,
+    Superseded,
+    CessationOfOperation,
+    CertificateHold,
+    RemoveFromCrl,
+    PrivilegeWithdrawn,
+    AaCompromise,
+}
+
+impl RevocationReason {
+    fn from_code(code: u8) -> Option<Self> {
+        Some(match code {
+            0 => Self::Unspecified,
+            1 => Self::KeyCompromise,
+            2 => Self::CaCompromise,
+            3 => Self::AffiliationChanged,
+            4 => Self::Superseded,
+            5 => Self::CessationOfOperation,
+            6 => Self::CertificateHold,
+            8 => Self::RemoveFromCrl,
+            9 => Self::PrivilegeWithdrawn,
+            10 => Self::AaCompromise,
+            _ => return None,
+        })
+    }
+}
+
+impl std::fmt::Display for RevocationReason {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(match self {
+            Self::Unspecified => "unspecified",
+            Self::KeyCompromise => "keyCompromise",
+            Self::CaCompromise => "cACompromise",
+            Self::AffiliationChanged => "affiliationChanged",
+            Self::Superseded => "superseded",
+            Self::CessationOfOperation => "cessationOfOperation",
+            Self::CertificateHold => "certificateHold",
+            Self::RemoveFromCrl => "removeFromCRL",
+            Self::PrivilegeWithdrawn => "privilegeWithdrawn",
+            Self::AaCompromise => "aACompromise",
+        })
+    }
+}
+
+/// A DER `OCSPResponse` fetched for one leaf, as a TLS server staples it.
+pub(crate) struct OcspResponse {
+    pub(crate) der: Vec<u8>,
+    serial: Vec<u8>,
+    issuer_der: Vec<u8>,
+}
+
+impl OcspResponse {
+    /// Returns the status the response reports for its leaf.
+    ///
+    /// # Errors
+    /// Returns an error if the response is malformed, not `successful`,
+    /// or not signed by the leaf's issuer or a responder it delegated to.
+    pub(crate) fn status(&self) -> Result<OcspStatus> {
+        let (_, issuer) = x509_parser::parse_x509_certificate(&self.issuer_der)
+            .map_err(|e| anyhow::anyhow!("Failed to parse issuer X509: {e}"))?;
+        parse_response(&self.der, &self.serial, &issuer)
+    }
+}
+
+/// Asks the leaf's OCSP responder for the status of the first
+/// certificate in `cert_pem`. The issuer is looked up in `issuer_pem`,
+/// which may hold any mix of intermediates and roots.
+///
+/// Returns `Ok(None)` when the leaf names no OCSP responder.
+///
+/// # Errors
+/// Returns an error if the leaf or its issuer cannot be found or
+/// parsed, the request fails, or the response is malformed, not
+/// `successful`, or not signed by the issuer or a delegated responder.
+pub(crate) async fn check_status(
+    settings: &Settings,
+    cert_pem: &[u8],
+    issuer_pem: &[u8],
+    insecure_mode: bool,
+) -> Result<Option<OcspStatus>> {
+    fetch_response(settings, cert_pem, issuer_pem, insecure_mode)
+        .await?
+        .map(|response| response.status())
+        .transpose()
+}
+
+/// Fetches the raw OCSP response for the first certificate in
+/// `cert_pem` without interpreting it; see [`check_status`].
+///
+/// Returns `Ok(None)` when the leaf names no OCSP responder.
+///
+/// # Errors
+/// Returns an error if the leaf or its issuer cannot be found or
+/// parsed, or the request fails.
+pub(crate) async fn fetch_response(
+    settings: &Settings,
+    cert_pem: &[u8],
+    issuer_pem: &[u8],
+    insecure_mode: bool,
+) -> Result<Option<OcspResponse>> {
+    let (_, pem) = x509_parser::pem::parse_x509_pem(cert_pem)
+        .map_err(|e| anyhow::anyhow!("Failed to parse PEM certificate: {e}"))?;
+    let (_, leaf) = x509_parser::parse_x509_certificate(&pem.contents)
+        .map_err(|e| anyhow::anyhow!("Failed to parse X509 certificate: {e}"))?;
+    let Some(url) = responder_url(&leaf) else {
+        return Ok(None);
+    };
+    let issuer_der = cert_chain::find_issuer(&pem.contents, issuer_pem)?
+        .ok_or_else(|| anyhow::anyhow!("Issuer of the certificate not found for OCSP"))?;
+    let (_, issuer) = x509_parser::parse_x509_certificate(&issuer_der)
+        .map_err(|e| anyhow::anyhow!("Failed to parse issuer X509: {e}"))?;
+
+    let request = encode_request(&leaf, &issuer);
+    let client = crate::tls::build_http_client_with(
+        reqwest::Client::builder().timeout(OCSP_TIMEOUT),
+        &settings.trust,
+        insecure_mode,
+    )?;
+    debug!("Querying OCSP responder {url}");
+    let response = client
+        .post(&url)
+        .header(reqwest::header::CONTENT_TYPE, OCSP_REQUEST_CONTENT_TYPE)
+        .body(request)
+        .send()
+        .await
+        .with_context(|| format!("OCSP request to {url} failed"))?
+        .error_for_status()
+        .with_context(|| format!("OCSP responder {url} returned an error"))?;
+    let body = response
+        .bytes()
+        .await
+        .with_context(|| format!("Failed to read OCSP response from {url}"))?;
+    Ok(Some(OcspResponse {
+        der: body.to_vec(),
+        serial: leaf.tbs_certificate.raw_serial().to_vec(),
+        issuer_der,
+    }))
+}
+
+/// Returns the first OCSP URL in the leaf's Authority Information Access
+/// extension.
+fn responder_url(cert: &X509Certificate<'_>) -> Option<String> {
+    cert.extensions()
+        .iter()
+        .filter_map(|ext| match ext.parsed_extension() {
+            ParsedExtension::AuthorityInfoAccess(aia) => Some(&aia.accessdescs),
+            _ => None,
+        })
+        .flatten()
+        .filter(|desc| desc.access_method.to_id_string() == OID_AD_OCSP)
+        .find_map(|desc| match desc.access_location {
+            GeneralName::URI(uri) => Some(uri.to_string()),
+            _ => None,
+        })
+}
+
+/// Encodes an `OCSPRequest` with a single SHA-1 `CertID` and no nonce.
+fn encode_request(leaf: &X509Certificate<'_>, issuer: &X509Certificate<'_>) -> Vec<u8> {
+    let name_hash = digest(&SHA1_FOR_LEGACY_USE_ONLY, leaf.issuer().as_raw());
+    let key_hash = digest(
+        &SHA1_FOR_LEGACY_USE_ONLY,
+        &issuer.public_key().subject_public_key.data,
+    );
+    let mut cert_id = SHA1_ALGORITHM_DER.to_vec();
+    cert_id.extend(tlv(TAG_OCTET_STRING, name_hash.as_ref()));
+    cert_id.extend(tlv(TAG_OCTET_STRING, key_hash.as_ref()));
+    cert_id.extend(tlv(TAG_INTEGER, leaf.tbs_certificate.raw_serial()));
+
+    let request = tlv(TAG_SEQUENCE, &tlv(TAG_SEQUENCE, &cert_id));
+    let request_list = tlv(TAG_SEQUENCE, &request);
+    let tbs_request = tlv(TAG_SEQUENCE, &request_list);
+    tlv(TAG_SEQUENCE, &tbs_request)
+}
+
+/// Extracts the status of the certificate with `serial` from a DER
+/// `OCSPResponse`, once its signature checks out against `issuer`.
+fn parse_response(der: &[u8], serial: &[u8], issuer: &X509Certificate<'_>) -> Result<OcspStatus> {
+    let mut outer = Der::new(Der::new(der).expect(TAG_SEQUENCE)?);
+    let status = outer.expect(TAG_ENUMERATED)?;
+    if status != [OCSP_SUCCESSFUL] {
+        anyhow::bail!("OCSP responder answered with status {status:?}");
+    }
+    let mut response_bytes =
+        Der::new(Der::new(outer.expect(TAG_EXPLICIT_0)?).expect(TAG_SEQUENCE)?);
+    if response_bytes.expect(TAG_OID)? != OID_OCSP_BASIC_DER {
+        anyhow::bail!("OCSP response is not a basic response");
+    }
+    let basic = response_bytes.expect(TAG_OCTET_STRING)?;
+    let mut basic = Der::new(Der::new(basic).expect(TAG_SEQUENCE)?);
+    let tbs_response_data = basic.read_element()?;
+    verify_signature(tbs_response_data, &mut basic, issuer)?;
+    let mut data = Der::new(Der::new(tbs_response_data).expect(TAG_SEQUENCE)?);
+    if data.peek_tag() == Some(TAG_EXPLICIT_0) {
+        data.read()?;
+    }
+    data.read()?; // responderID
+    data.read()?; // producedAt
+    let mut responses = Der::new(data.expect(TAG_SEQUENCE)?);
+    while !responses.is_empty() {
+        let mut single = Der::new(responses.expect(TAG_SEQUENCE)?);
+        let mut cert_id = Der::new(single.expect(TAG_SEQUENCE)?);
+        cert_id.read()?; // hashAlgorithm
+        cert_id.read()?; // issuerNameHash
+        cert_id.read()?; // issuerKeyHash
+        if cert_id.expect(TAG_INTEGER)? != serial {
+            continue;
+        }
+        let (tag, content) = single.read()?;
+        return match tag {
+            TAG_GOOD => Ok(OcspStatus::Good),
+            TAG_UNKNOWN => Ok(OcspStatus::Unknown),
+            TAG_REVOKED => Ok(OcspStatus::Revoked {
+                reason: revocation_reason(content)?,
+            }),
+            _ => anyhow::bail!("OCSP response has an invalid certStatus tag {tag:#04x}"),
+        };
+    }
+    anyhow::bail!("OCSP response does not cover the certificate")
+}
+
+/// Checks the `signatureAlgorithm`, `signature` and `certs` that follow
+/// `tbs_response_data` in `basic`. The signer must be `issuer` itself or
+/// a certificate from `certs` that `issuer` signed, that is currently
+/// valid, and whose Extended Key Usage includes `id-kp-OCSPSigning`.
+fn verify_signature(
+    tbs_response_data: &[u8],
+    basic: &mut Der<'_>,
+    issuer: &X509Certificate<'_>,
+) -> Result<()> {
+    let algorithm = Der::new(basic.expect(TAG_SEQUENCE)?).expect(TAG_OID)?;
+    let signature = bit_string(basic.expect(TAG_BIT_STRING)?)?;
+    let verify = |spki: &[u8]| verify_signed(spki, algorithm, tbs_response_data, signature);
+    if verify(issuer.public_key().raw).is_ok() {
+        return Ok(());
+    }
+    if basic.peek_tag() == Some(TAG_EXPLICIT_0) {
+        let mut certs = Der::new(Der::new(basic.expect(TAG_EXPLICIT_0)?).expect(TAG_SEQUENCE)?);
+        while !certs.is_empty() {
+            let cert_der = certs.read_element()?;
+            let Ok((_, responder)) = x509_parser::parse_x509_certificate(cert_der) else {
+                continue;
+            };
+            if is_delegated_responder(&responder, issuer)
+                && verify(responder.public_key().raw).is_ok()
+            {
+                return Ok(());
+            }
+        }
+    }
+    anyhow::bail!(
+        "OCSP response is not signed by the certificate's issuer or a responder it delegated to"
+    )
+}
+
+fn is_delegated_responder(responder: &X509Certificate<'_>, issuer: &X509Certificate<'_>) -> bool {
+    responder.issuer() == issuer.subject()
+        && responder.validity().is_valid()
+        && responder
+            .verify_signature(Some(issuer.public_key()))
+            .is_ok()
+        && responder
+            .extended_key_usage()
+            .ok()
+            .flatten()
+            .is_some_and(|eku| eku.value.ocsp_signing)
+}
+
+/// Verifies `signature` over `message` with the DER
+/// `SubjectPublicKeyInfo` `spki`, for the signature algorithm OID
+/// `algorithm`.
+fn verify_signed(spki: &[u8], algorithm: &[u8], message: &[u8], signature: &[u8]) -> Result<()> {
+    let mut spki = Der::new(Der::new(spki).expect(TAG_SEQUENCE)?);
+    let mut key_algorithm = Der::new(spki.expect(TAG_SEQUENCE)?);
+    key_algorithm.expect(TAG_OID)?;
+    let curve = match key_algorithm.peek_tag() {
+        Some(TAG_OID) => Some(key_algorithm.expect(TAG_OID)?),
+        _ => None,
+    };
+    let public_key = bit_string(spki.expect(TAG_BIT_STRING)?)?;
+    let verification: &dyn VerificationAlgorithm = match (algorithm, curve) {
+        (OID_SHA256_WITH_RSA, _) => &signature::RSA_PKCS1_2048_8192_SHA256,
+        (OID_SHA384_WITH_RSA, _) => &signature::RSA_PKCS1_2048_8192_SHA384,
+        (OID_SHA512_WITH_RSA, _) => &signature::RSA_PKCS1_2048_8192_SHA512,
+        (OID_ECDSA_WITH_SHA256, Some(OID_CURVE_P256)) => &signature::ECDSA_P256_SHA256_ASN1,
+        (OID_ECDSA_WITH_SHA384, Some(OID_CURVE_P256)) => &signature::ECDSA_P256_SHA384_ASN1,
+        (OID_ECDSA_WITH_SHA256, Some(OID_CURVE_P384)) => &signature::ECDSA_P384_SHA256_ASN1,
+        (OID_ECDSA_WITH_SHA384, Some(OID_CURVE_P384)) => &signature::ECDSA_P384_SHA384_ASN1,
+        (OID_ED25519, _) => &signature::ED25519,
+        _ => anyhow::bail!("Unsupported OCSP response signature algorithm"),
+    };
+    UnparsedPublicKey::new(verification, public_key)
+        .verify(message, signature)
+        .map_err(|_| anyhow::anyhow!("OCSP response signature is invalid"))
+}
+
+/// Returns the bytes of a DER `BIT STRING` without unused bits.
+fn bit_string(content: &[u8]) -> Result<&[u8]> {
+    match content.split_first() {
+        Some((0, bytes)) => Ok(bytes),
+        _ => anyhow::bail!("Unsupported DER bit string"),
+    }
+}
+
+/// Reads the optional `revocationReason` from a `RevokedInfo`.
+fn revocation_reason(revoked_info: &[u8]) -> Result<Option<RevocationReason>> {
+    let mut info = Der::new(revoked_info);
+    info.read()?; // revocationTime
+    if info.peek_tag() != Some(TAG_EXPLICIT_0) {
+        return Ok(None);
+    }
+    let code = Der::new(info.expect(TAG_EXPLICIT_0)?).expect(TAG_ENUMERATED)?;
+    Ok(match code {
+        [code] => RevocationReason::from_code(*code),
+        _ => None,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use wiremock::matchers::{header, method, path};
+    use wiremock::{Mock, MockServer, ResponseTemplate};
+
+    use super::*;
+
+    const TEST_SERIAL: [u8; 3] = [0x0a, 0x0b, 0x0c];
+    const GENERALIZED_TIME: &[u8] = b"20260101000000Z";
+    const TAG_GENERALIZED_TIME: u8 = 0x18;
+
+    struct TestPki {
+        issuer_pem: String,
+        leaf_pem: String,
+        ca_key_pkcs8: Vec<u8>,
+        ca_issuer: rcgen::Issuer<'static, rcgen::KeyPair>,
+    }
+
+    /// Signs OCSP responses, optionally attaching the signer's
+    /// certificate as a delegated responder does.
+    struct ResponseSigner {
+        key_pkcs8: Vec<u8>,
+        cert_der: Option<Vec<u8>>,
+    }
+
+    impl TestPki {
+        fn ca_signer(&self) -> ResponseSigner {
+            ResponseSigner {
+                key_pkcs8: self.ca_key_pkcs8.clone(),
+                cert_der: None,
+            }
+        }
+
+        /// Issues a responder certificate from the test CA, with the
+        /// `id-kp-OCSPSigning` EKU when `ocsp_signing` is set.
+        fn delegated_signer(&self, ocsp_signing: bool) -> ResponseSigner {
+            let mut params = rcgen::CertificateParams::new(Vec::<String>::new()).unwrap();
+            params
+                .distinguished_name
+                .push(rcgen::DnType::CommonName, "OCSP Test Responder");
+            if ocsp_signing {
+                params.extended_key_usages = vec![rcgen::ExtendedKeyUsagePurpose::OcspSigning];
+            }
+            let key = rcgen::KeyPair::generate().unwrap();
+            let cert = params.signed_by(&key, &self.ca_issuer).unwrap();
+            ResponseSigner {
+                key_pkcs8: key.serialize_der(),
+                cert_der: Some(cert.der().to_vec()),
+            }
+        }
+    }
+
+    /// Issues a leaf whose AIA extension points at `ocsp_url`.
+    fn issue_leaf(ocsp_url: Option<&str>) -> TestPki {
+        let ca_key = rcgen::KeyPair::generate().unwrap();
+        let ca_key_pkcs8 = ca_key.serialize_der();
+        let mut ca_params = rcgen::CertificateParams::new(Vec::<String>::new()).unwrap();
+        ca_params.is_ca = rcgen::IsCa::Ca(rcgen::BasicConstraints::Unconstrained);
+        ca_params
+            .distinguished_name
+            .push(rcgen::DnType::CommonName, "OCSP Test CA");
+        let issuer_pem = ca_params.self_signed(&ca_key).unwrap().pem();
+        let ca_issuer = rcgen::Issuer::new(ca_params, ca_key);
+
+        let mut params =
+            rcgen::CertificateParams::new(vec!["leaf.example.internal".to_string()]).unwrap();
+        params.serial_number = Some(rcgen::SerialNumber::from_slice(&TEST_SERIAL));
+        if let Some(url) = ocsp_url {
+            let access_location = tlv(0x86, url.as_bytes());
+            let mut desc = tlv(TAG_OID, &[0x2b, 0x06, 0x01, 0x05, 0x05, 0x07, 0x30, 0x01]);
+            desc.extend(access_location);
+            let aia = tlv(TAG_SEQUENCE, &tlv(TAG_SEQUENCE, &desc));
+            params
+                .custom_extensions
+                .push(rcgen::CustomExtension::from_oid_content(
+                    &[1, 3, 6, 1, 5, 5, 7, 1, 1],
+                    aia,
+                ));
+        }
+        let leaf_key = rcgen::KeyPair::generate().unwrap();
+        let leaf_pem = params.signed_by(&leaf_key, &ca_issuer).unwrap().pem();
+        TestPki {
+            issuer_pem,
+            leaf_pem,
+            ca_key_pkcs8,
+            ca_issuer,
+        }
+    }
+
+    /// Builds a `successful` basic `OCSPResponse` with one
+    /// `SingleResponse` for `serial`, signed with ECDSA P-256 by `signer`.
+    fn ocsp_response(serial: &[u8], cert_status: &[u8], signer: &ResponseSigner) -> Vec<u8> {
+        let mut cert_id = SHA1_ALGORITHM_DER.to_vec();
+        cert_id.extend(tlv(TAG_OCTET_STRING, &[0; 20]));
+        cert_id.extend(tlv(TAG_OCTET_STRING, &[0; 20]));
+        cert_id.extend(tlv(TAG_INTEGER, serial));
+        let mut single = tlv(TAG_SEQUENCE, &cert_id);
+        single.extend(cert_status);
+        single.extend(tlv(TAG_GENERALIZED_TIME, GENERALIZED_TIME));
+
+        let mut data = tlv(0xa2, &tlv(TAG_OCTET_STRING, &[0; 20]));
+        data.extend(tlv(TAG_GENERALIZED_TIME, GENERALIZED_TIME));
+        data.extend(tlv(TAG_SEQUENCE, &tlv(TAG_SEQUENCE, &single)));
+        let tbs_response_data = tlv(TAG_SEQUENCE, &data);
+        let key_pair = ring::signature::EcdsaKeyPair::from_pkcs8(
+            &ring::signature::ECDSA_P256_SHA256_ASN1_SIGNING,
+            &signer.key_pkcs8,
+            &ring::rand::SystemRandom::new(),
+        )
+        .unwrap();
+        let signature = key_pair
+            .sign(&ring::rand::SystemRandom::new(), &tbs_response_data)
+            .unwrap();
+        let mut basic = tbs_response_data;
+        basic.extend(tlv(TAG_SEQUENCE, &tlv(TAG_OID, OID_ECDSA_WITH_SHA256)));
+        basic.extend(tlv(TAG_BIT_STRING, &[&[0x00], signature.as_ref()].concat()));
+        if let Some(cert_der) = &signer.cert_der {
+            basic.extend(tlv(TAG_EXPLICIT_0, &tlv(TAG_SEQUENCE, cert_der)));
+        }
+
+        let mut response_bytes = tlv(TAG_OID, OID_OCSP_BASIC_DER);
+        response_bytes.extend(tlv(TAG_OCTET_STRING, &tlv(TAG_SEQUENCE, &basic)));
+        let mut response = tlv(TAG_ENUMERATED, &[OCSP_SUCCESSFUL]);
+        response.extend(tlv(TAG_EXPLICIT_0, &tlv(TAG_SEQUENCE, &response_bytes)));
+        tlv(TAG_SEQUENCE, &response)
+    }
+
+    fn revoked_status(reason: Option<u8>) -> Vec<u8> {
+        let mut info = tlv(TAG_GENERALIZED_TIME, GENERALIZED_TIME);
+        if let Some(code) = reason {
+            info.extend(tlv(TAG_EXPLICIT_0, &tlv(TAG_ENUMERATED, &[code])));
+        }
+        tlv(TAG_REVOKED, &info)
+    }
+
+    fn parse_cert(pem: &str) -> Vec<u8> {
+        x509_parser::pem::parse_x509_pem(pem.as_bytes())
+            .unwrap()
+            .1
+            .contents
+    }
+
+    #[test]
+    fn test_encode_request_carries_sha1_cert_id() {
+        let pki = issue_leaf(None);
+        let leaf_der = parse_cert(&pki.leaf_pem);
+        let issuer_der = parse_cert(&pki.issuer_pem);
+        let (_, leaf) = x509_parser::parse_x509_certificate(&leaf_der).unwrap();
+        let (_, issuer) = x509_parser::parse_x509_certificate(&issuer_der).unwrap();
+
+        let request = encode_request(&leaf, &issuer);
+
+        let mut tbs = Der::new(Der::new(&request).expect(TAG_SEQUENCE).unwrap());
+        let mut list = Der::new(tbs.expect(TAG_SEQUENCE).unwrap());
+        let mut req = Der::new(list.expect(TAG_SEQUENCE).unwrap());
+        let mut req = Der::new(req.expect(TAG_SEQUENCE).unwrap());
+        let mut cert_id = Der::new(req.expect(TAG_SEQUENCE).unwrap());
+        let (_, algorithm) = cert_id.read().unwrap();
+        assert_eq!(tlv(TAG_SEQUENCE, algorithm), SHA1_ALGORITHM_DER);
+        assert_eq!(
+            cert_id.expect(TAG_OCTET_STRING).unwrap(),
+            digest(&SHA1_FOR_LEGACY_USE_ONLY, issuer.subject().as_raw()).as_ref()
+        );
+        assert_eq!(cert_id.expect(TAG_OCTET_STRING).unwrap().len(), 20);
+        assert_eq!(cert_id.expect(TAG_INTEGER).unwrap(), TEST_SERIAL);
+    }
+
+    #[test]
+    fn test_parse_response_reads_cert_status() {
+        let pki = issue_leaf(None);
+        let signer = pki.ca_signer();
+        let issuer_der = parse_cert(&pki.issuer_pem);
+        let (_, issuer) = x509_parser::parse_x509_certificate(&issuer_der).unwrap();
+        let status = |cert_status: &[u8]| {
+            parse_response(
+                &ocsp_response(&TEST_SERIAL, cert_status, &signer),
+                &TEST_SERIAL,
+                &issuer,
+            )
+            .unwrap()
+        };
+
+        assert_eq!(status(&tlv(TAG_GOOD, &[])), OcspStatus::Good);
+        assert_eq!(status(&tlv(TAG_UNKNOWN, &[])), OcspStatus::Unknown);
+        assert_eq!(
+            status(&revoked_status(Some(1))),
+            OcspStatus::Revoked {
+                reason: Some(RevocationReason::KeyCompromise)
+            }
+        );
+        assert_eq!(
+            status(&revoked_status(None)),
+            OcspStatus::Revoked { reason: None }
+        );
+    }
+
+    #[test]
+    fn test_parse_response_rejects_other_serial_and_error_status() {
+        let pki = issue_leaf(None);
+        let issuer_der = parse_cert(&pki.issuer_pem);
+        let (_, issuer) = x509_parser::parse_x509_certificate(&issuer_der).unwrap();
+        let other = ocsp_response(&[0x01], &tlv(TAG_GOOD, &[]), &pki.ca_signer());
+        let err = parse_response(&other, &TEST_SERIAL, &issuer).unwrap_err();
+        assert!(err.to_string().contains("does not cover"), "{err:#}");
+
+        // tryLater (3) carries no responseBytes.
+        let try_later = tlv(TAG_SEQUENCE, &tlv(TAG_ENUMERATED, &[3]));
+        let err = parse_response(&try_later, &TEST_SERIAL, &issuer).unwrap_err();
+        assert!(err.to_string().contains("status"), "{err:#}");
+
+        assert!(parse_response(&[0x30, 0x05, 0x0a], &TEST_SERIAL, &issuer).is_err());
+    }
+
+    #[test]
+    fn test_parse_response_accepts_only_issuer_or_delegated_signatures() {
+        let pki = issue_leaf(None);
+        let issuer_der = parse_cert(&pki.issuer_pem);
+        let (_, issuer) = x509_parser::parse_x509_certificate(&issuer_der).unwrap();
+        let revoked = revoked_status(Some(1));
+        let parse = |signer: &ResponseSigner| {
+            parse_response(
+                &ocsp_response(&TEST_SERIAL, &revoked, signer),
+                &TEST_SERIAL,
+                &issuer,
+            )
+        };
+
+        assert!(parse(&pki.delegated_signer(true)).is_ok());
+
+        let err = parse(&pki.delegated_signer(false)).unwrap_err();
+        assert!(err.to_string().contains("not signed by"), "{err:#}");
+
+        let stranger = issue_leaf(None);
+        let err = parse(&stranger.ca_signer()).unwrap_err();
+        assert!(err.to_string().contains("not signed by"), "{err:#}");
+
+        // A responder the stranger delegated to does not speak for this CA.
+        let err = parse(&stranger.delegated_signer(true)).unwrap_err();
+        assert!(err.to_string().contains("not signed by"), "{err:#}");
+    }
+
+    #[tokio::test]
+    async fn test_check_status_posts_to_aia_responder() {
+        let server = MockServer::start().await;
+        let pki = issue_leaf(Some(&format!("{}/ocsp", server.uri())));
+        Mock::given(method("POST"))
+            .and(path("/ocsp"))
+            .and(header("content-type", OCSP_REQUEST_CONTENT_TYPE))
+            .respond_with(ResponseTemplate::new(200).set_body_bytes(ocsp_response(
+                &TEST_SERIAL,
+                &revoked_status(Some(4)),
+                &pki.ca_signer(),
+            )))
+            .expect(1)
+            .mount(&server)
+            .await;
+        let settings = Settings::new(None).expect("settings must load");
+
+        let status = check_status(
+            &settings,
+            pki.leaf_pem.as_bytes(),
+            pki.issuer_pem.as_bytes(),
+            false,
+        )
+        .await
+        .unwrap();
+
+        assert_eq!(
+            status,
+            Some(OcspStatus::Revoked {
+                reason: Some(RevocationReason::Superseded)
+            })
+        );
+    }
+
+    #[tokio::test]
+    async fn test_fetch_response_returns_raw_der_for_stapling() {
+        let server = MockServer::start().await;
+        let pki = issue_leaf(Some(&format!("{}/ocsp", server.uri())));
+        let body = ocsp_response(&TEST_SERIAL, &tlv(TAG_GOOD, &[]), &pki.ca_signer());
+        Mock::given(method("POST"))
+            .and(path("/ocsp"))
+            .respond_with(ResponseTemplate::new(200).set_body_bytes(body.clone()))
+            .mount(&server)
+            .await;
+        let settings = Settings::new(None).expect("settings must load");
+
+        let response = fetch_response(
+            &settings,
+            pki.leaf_pem.as_bytes(),
+            pki.issuer_pem.as_bytes(),
+            false,
+        )
+        .await
+        .unwrap()
+        .expect("leaf names a responder");
+
+        assert_eq!(response.der, body);
+        assert_eq!(response.status().unwrap(), OcspStatus::Good);
+    }
+
+    #[tokio::test]
+    async fn test_check_status_skips_leaf_without_responder() {
+        let pki = issue_leaf(None);
+        let settings = Settings::new(None).expect("settings must load");
+
+        let status = check_status(
+            &settings,
+            pki.leaf_pem.as_bytes(),
+            pki.issuer_pem.as_bytes(),
+            false,
+        )
+        .await
+        .unwrap();
+
+        assert!(status.is_none());
+    }
+}
@@ -0,0 +1,163 @@
+//! Certificate Transparency checks for issued certificates.
+//!
+//! With `[acme] check_sct = true` (or `--check-sct`) the agent inspects the
+//! downloaded leaf for Signed Certificate Timestamps embedded by the CA
+//! (RFC 6962, section 3.3) and logs which CT logs vouched for it. An
+//! internal step-ca does not embed SCTs, so their absence is only a
+//! warning and never fails the issuance. SCT signatures are not verified
+//! against log keys; the check confirms presence, version, and that no
+//! timestamp lies in the future.
+
+use std::time::{Duration, SystemTime};
+
+use anyhow::Result;
+use base64::Engine;
+use tracing::{info, warn};
+use x509_parser::extensions::ParsedExtension;
+
+/// SCT structure version `v1`, the only one defined by RFC 6962.
+const SCT_VERSION_V1: u8 = 0;
+
+/// One SCT embedded in a certificate.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct EmbeddedSct {
+    /// Base64 log ID (SHA-256 of the log's public key), as printed in
+    /// CT log lists.
+    pub(crate) log_id: String,
+    pub(crate) timestamp: SystemTime,
+    pub(crate) version: u8,
+}
+
+/// Returns the SCTs embedded in the first certificate of `cert_pem`.
+///
+/// # Errors
+/// Returns an error if the certificate cannot be parsed.
+pub(crate) fn embedded_scts(cert_pem: &[u8]) -> Result<Vec<EmbeddedSct>> {
+    let (_, pem) = x509_parser::pem::parse_x509_pem(cert_pem)
+        .map_err(|e| anyhow::anyhow!("Failed to parse PEM certificate: {e}"))?;
+    let (_, cert) = x509_parser::parse_x509_certificate(&pem.contents)
+        .map_err(|e| anyhow::anyhow!("Failed to parse X509 certificate: {e}"))?;
+
+    let engine = base64::engine::general_purpose::STANDARD;
+    Ok(cert
+        .extensions()
+        .iter()
+        .filter_map(|ext| match ext.parsed_extension() {
+            ParsedExtension::SCT(scts) => Some(scts),
+            _ => None,
+        })
+        .flatten()
+        .map(|sct| EmbeddedSct {
+            log_id: engine.encode(sct.id.key_id),
+            timestamp: SystemTime::UNIX_EPOCH + Duration::from_millis(sct.timestamp),
+            version: sct.version.0,
+        })
+        .collect())
+}
+
+/// Logs the CT status of the issued `cert_pem` for `domain`. Problems are
+/// warnings only; the certificate is kept either way.
+pub(crate) fn report(domain: &str, cert_pem: &str, now: SystemTime) {
+    let scts = match embedded_scts(cert_pem.as_bytes()) {
+        Ok(scts) => scts,
+        Err(err) => {
+            warn!("SCT check for {domain} skipped: {err:#}");
+            return;
+        }
+    };
+    if scts.is_empty() {
+        warn!(
+            "Certificate for {domain} has no embedded SCTs; it cannot be shown to be in a CT log"
+        );
+        return;
+    }
+    info!(
+        "Certificate for {domain} has {} embedded SCT(s)",
+        scts.len()
+    );
+    for sct in &scts {
+        let timestamp = humantime::format_rfc3339_millis(sct.timestamp);
+        if sct.version != SCT_VERSION_V1 {
+            warn!(
+                "SCT from log {} has unknown version {}",
+                sct.log_id, sct.version
+            );
+        } else if sct.timestamp > now {
+            warn!(
+                "SCT from log {} is timestamped in the future ({timestamp})",
+                sct.log_id
+            );
+        } else {
+            info!("SCT from log {} at {timestamp}", sct.log_id);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const SCT_OID: &[u64] = &[1, 3, 6, 1, 4, 1, 11129, 2, 4, 2];
+    const TEST_LOG_ID: [u8; 32] = [0x5a; 32];
+    const TEST_TIMESTAMP_MS: u64 = 1_700_000_000_123;
+
+    /// Encodes a `SignedCertificateTimestampList` holding one v1 SCT,
+    /// wrapped in the DER OCTET STRING the extension value carries.
+    fn sct_extension_value() -> Vec<u8> {
+        let mut sct = vec![SCT_VERSION_V1];
+        sct.extend_from_slice(&TEST_LOG_ID);
+        sct.extend_from_slice(&TEST_TIMESTAMP_MS.to_be_bytes());
+        sct.extend_from_slice(&[0, 0]); // no extensions
+        sct.extend_from_slice(&[4, 3, 0, 2, 0xab, 0xcd]); // sha256/ecdsa, 2-byte signature
+        let sct_len = u16::try_from(sct.len()).unwrap();
+        let mut list = (sct_len + 2).to_be_bytes().to_vec();
+        list.extend_from_slice(&sct_len.to_be_bytes());
+        list.extend_from_slice(&sct);
+        let mut value = vec![0x04, u8::try_from(list.len()).unwrap()];
+        value.extend_from_slice(&list);
+        value
+    }
+
+    fn leaf_pem(with_sct: bool) -> String {
+        let key = rcgen::KeyPair::generate().unwrap();
+        let mut params =
+            rcgen::CertificateParams::new(vec!["leaf.example.internal".to_string()]).unwrap();
+        if with_sct {
+            params
+                .custom_extensions
+                .push(rcgen::CustomExtension::from_oid_content(
+                    SCT_OID,
+                    sct_extension_value(),
+                ));
+        }
+        params.self_signed(&key).unwrap().pem()
+    }
+
+    #[test]
+    fn test_embedded_scts_reads_log_id_and_timestamp() {
+        let scts = embedded_scts(leaf_pem(true).as_bytes()).unwrap();
+
+        assert_eq!(
+            scts,
+            vec![EmbeddedSct {
+                log_id: base64::engine::general_purpose::STANDARD.encode(TEST_LOG_ID),
+                timestamp: SystemTime::UNIX_EPOCH + Duration::from_millis(TEST_TIMESTAMP_MS),
+                version: SCT_VERSION_V1,
+            }]
+        );
+    }
+
+    #[test]
+    fn test_embedded_scts_empty_without_extension() {
+        assert!(
+            embedded_scts(leaf_pem(false).as_bytes())
+                .unwrap()
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn test_embedded_scts_rejects_invalid_pem() {
+        assert!(embedded_scts(b"not a certificate").is_err());
+    }
+}
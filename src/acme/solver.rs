@@ -0,0 +1,380 @@
+//! Challenge providers: who publishes a challenge response and removes
+//! it again.
+//!
+//! The agent ships two built-in providers, the HTTP-01 responder and the
+//! local DNS-01 server, plus a manual DNS-01 mode (`dns01.manual`) that
+//! prints each TXT record and waits for the operator to publish it.
+//! `[acme] solver_command` (or `--solver-command`)
+//! swaps either for an external program so proprietary DNS or HTTP
+//! infrastructure can be driven without changing the agent. The program
+//! is run as
+//!
+//! ```text
+//! <solver_command> present <domain> <token> <key-authorization>
+//! <solver_command> cleanup <domain> <token> <key-authorization>
+//! ```
+//!
+//! with the same values, plus the challenge type and the record or path
+//! to publish, in `BOOTROOT_CHALLENGE_*` environment variables. `present`
+//! must exit 0 once the response is being served; a failed `cleanup` is
+//! only logged.
+
+use std::io::{BufRead, IsTerminal, Write};
+use std::os::unix::fs::PermissionsExt;
+use std::path::Path;
+use std::process::Stdio;
+use std::time::Duration;
+
+use anyhow::{Context, Result};
+use tokio::process::Command;
+use tokio::sync::Mutex;
+use tracing::{debug, info, warn};
+
+use crate::acme::dns01::{self, LocalDnsServer};
+use crate::acme::responder_client;
+use crate::config::{ChallengeKind, Settings};
+
+const SOLVER_TIMEOUT: Duration = Duration::from_secs(120);
+const HTTP01_PATH_PREFIX: &str = "/.well-known/acme-challenge/";
+const EXECUTABLE_BITS: u32 = 0o111;
+
+/// Held while the operator is prompted, so profiles issued in parallel
+/// ask for one record at a time.
+static MANUAL_PROMPT: Mutex<()> = Mutex::const_new(());
+
+/// One pending challenge as handed to a provider.
+#[derive(Debug, Clone, Copy)]
+pub(crate) struct Challenge<'a> {
+    pub(crate) kind: ChallengeKind,
+    /// ACME identifier (`*.` wildcard prefix kept).
+    pub(crate) domain: &'a str,
+    pub(crate) token: &'a str,
+    pub(crate) key_authorization: &'a str,
+}
+
+/// Publishes and withdraws challenge responses.
+pub(crate) enum ChallengeProvider<'a> {
+    /// Registers HTTP-01 tokens with the responder; they expire there on
+    /// their own.
+    Responder(&'a Settings),
+    /// Serves DNS-01 TXT records from the agent's DNS server.
+    LocalDns(&'static LocalDnsServer),
+    /// Runs `acme.solver_command`.
+    Command(&'a Path),
+    /// Prompts the operator on the terminal (`dns01.manual`).
+    Manual,
+}
+
+impl<'a> ChallengeProvider<'a> {
+    /// Returns the provider configured for `settings.acme.challenge`.
+    ///
+    /// # Errors
+    /// Returns an error if the local DNS server cannot be started.
+    pub(crate) async fn for_settings(settings: &'a Settings) -> Result<Self> {
+        if let Some(command) = &settings.acme.solver_command {
+            return Ok(Self::Command(command));
+        }
+        if settings.dns01.manual {
+            return Ok(Self::Manual);
+        }
+        Ok(match settings.acme.challenge {
+            ChallengeKind::Http01 => Self::Responder(settings),
+            ChallengeKind::Dns01 => {
+                Self::LocalDns(dns01::shared_server(&settings.dns01.listen_addr).await?)
+            }
+        })
+    }
+
+    /// Makes the challenge response available to the CA.
+    ///
+    /// # Errors
+    /// Returns an error if the responder rejects the token, the solver
+    /// command fails, or a manual prompt has no terminal to ask on.
+    pub(crate) async fn present(&self, challenge: &Challenge<'_>) -> Result<()> {
+        match self {
+            Self::Responder(settings) => {
+                responder_client::register_http01_token(
+                    settings,
+                    challenge.token,
+                    challenge.key_authorization,
+                )
+                .await
+            }
+            Self::LocalDns(server) => {
+                server.present(challenge.domain, challenge.key_authorization);
+                info!(
+                    "Serving DNS-01 record {} from {}",
+                    dns01::challenge_record_name(challenge.domain),
+                    server.local_addr()
+                );
+                Ok(())
+            }
+            Self::Command(command) => run_solver(command, "present", challenge).await,
+            Self::Manual => prompt_manual_present(challenge).await,
+        }
+    }
+
+    /// Withdraws the response published by [`Self::present`]. Failures
+    /// are logged; the issuance result stands either way.
+    pub(crate) async fn cleanup(&self, challenge: &Challenge<'_>) {
+        match self {
+            Self::Responder(_) => {}
+            Self::LocalDns(server) => {
+                server.cleanup(challenge.domain, challenge.key_authorization);
+            }
+            Self::Command(command) => {
+                if let Err(err) = run_solver(command, "cleanup", challenge).await {
+                    warn!("Solver cleanup for {} failed: {err:#}", challenge.domain);
+                }
+            }
+            Self::Manual => {
+                eprintln!(
+                    "The TXT record {} can be removed now.",
+                    dns01::challenge_record_name(challenge.domain)
+                );
+            }
+        }
+    }
+}
+
+/// Checks that `path` names an executable regular file.
+///
+/// # Errors
+/// Returns an error if the file is missing, not a regular file, or has
+/// no execute permission bit.
+pub(crate) fn validate_command(path: &Path) -> Result<()> {
+    let metadata = std::fs::metadata(path)
+        .with_context(|| format!("acme.solver_command {} not found", path.display()))?;
+    if !metadata.is_file() {
+        anyhow::bail!("acme.solver_command {} is not a file", path.display());
+    }
+    if metadata.permissions().mode() & EXECUTABLE_BITS == 0 {
+        anyhow::bail!("acme.solver_command {} is not executable", path.display());
+    }
+    Ok(())
+}
+
+/// Shows the TXT record for `challenge` and waits for Enter.
+///
+/// stdin must be a terminal: an unattended run fails straight away
+/// instead of blocking until the order expires.
+async fn prompt_manual_present(challenge: &Challenge<'_>) -> Result<()> {
+    if !std::io::stdin().is_terminal() {
+        anyhow::bail!(
+            "dns01.manual needs an operator at a terminal, but stdin is not interactive. \
+             Use acme.solver_command or the built-in DNS server for unattended runs."
+        );
+    }
+    let _guard = MANUAL_PROMPT.lock().await;
+    let instructions = manual_instructions(challenge);
+    tokio::task::spawn_blocking(move || -> Result<()> {
+        let mut stderr = std::io::stderr().lock();
+        write!(stderr, "{instructions}")?;
+        stderr.flush()?;
+        let mut answer = String::new();
+        if std::io::stdin().lock().read_line(&mut answer)? == 0 {
+            anyhow::bail!("stdin closed before the DNS-01 record was confirmed");
+        }
+        Ok(())
+    })
+    .await
+    .context("Manual DNS-01 prompt failed")?
+}
+
+fn manual_instructions(challenge: &Challenge<'_>) -> String {
+    format!(
+        "Publish this DNS TXT record for {domain}:\n\n  \
+         {name}. IN TXT \"{value}\"\n\n\
+         Press Enter once it is visible to the CA... ",
+        domain = challenge.domain,
+        name = dns01::challenge_record_name(challenge.domain),
+        value = dns01::challenge_record_value(challenge.key_authorization),
+    )
+}
+
+fn solver_envs(challenge: &Challenge<'_>) -> Vec<(&'static str, String)> {
+    let mut envs = vec![
+        (
+            "BOOTROOT_CHALLENGE_TYPE",
+            challenge_type(challenge.kind).to_string(),
+        ),
+        ("BOOTROOT_CHALLENGE_DOMAIN", challenge.domain.to_string()),
+        ("BOOTROOT_CHALLENGE_TOKEN", challenge.token.to_string()),
+        (
+            "BOOTROOT_CHALLENGE_KEY_AUTH",
+            challenge.key_authorization.to_string(),
+        ),
+    ];
+    match challenge.kind {
+        ChallengeKind::Http01 => envs.push((
+            "BOOTROOT_CHALLENGE_PATH",
+            format!("{HTTP01_PATH_PREFIX}{}", challenge.token),
+        )),
+        ChallengeKind::Dns01 => {
+            envs.push((
+                "BOOTROOT_CHALLENGE_TXT_NAME",
+                dns01::challenge_record_name(challenge.domain),
+            ));
+            envs.push((
+                "BOOTROOT_CHALLENGE_TXT_VALUE",
+                dns01::challenge_record_value(challenge.key_authorization),
+            ));
+        }
+    }
+    envs
+}
+
+fn challenge_type(kind: ChallengeKind) -> &'static str {
+    match kind {
+        ChallengeKind::Http01 => "http-01",
+        ChallengeKind::Dns01 => "dns-01",
+    }
+}
+
+async fn run_solver(command: &Path, action: &str, challenge: &Challenge<'_>) -> Result<()> {
+    info!(
+        "Running solver {action} for {} ({})",
+        challenge.domain,
+        challenge_type(challenge.kind)
+    );
+    let child = Command::new(command)
+        .arg(action)
+        .args([
+            challenge.domain,
+            challenge.token,
+            challenge.key_authorization,
+        ])
+        .envs(solver_envs(challenge))
+        .stdin(Stdio::null())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::piped())
+        .kill_on_drop(true)
+        .spawn()
+        .with_context(|| format!("Failed to start solver {}", command.display()))?;
+    let output = tokio::time::timeout(SOLVER_TIMEOUT, child.wait_with_output())
+        .await
+        .map_err(|_| {
+            anyhow::anyhow!(
+                "Solver {action} timed out after {}s",
+                SOLVER_TIMEOUT.as_secs()
+            )
+        })?
+        .with_context(|| format!("Failed to run solver {}", command.display()))?;
+    for (label, stream) in [("stdout", &output.stdout), ("stderr", &output.stderr)] {
+        let text = String::from_utf8_lossy(stream);
+        if !text.trim().is_empty() {
+            debug!("Solver {action} {label}: {}", text.trim());
+        }
+    }
+    if !output.status.success() {
+        anyhow::bail!("Solver {action} exited with {}", output.status);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn write_script(dir: &Path, body: &str) -> std::path::PathBuf {
+        let path = dir.join("solver.sh");
+        std::fs::write(&path, format!("#!/bin/sh\n{body}\n")).unwrap();
+        std::fs::set_permissions(&path, std::fs::Permissions::from_mode(0o755)).unwrap();
+        path
+    }
+
+    fn dns_challenge() -> Challenge<'static> {
+        Challenge {
+            kind: ChallengeKind::Dns01,
+            domain: "001.edge.node.trusted.domain",
+            token: "tok-1",
+            key_authorization: "tok-1.thumb",
+        }
+    }
+
+    #[test]
+    fn test_validate_command_requires_executable_file() {
+        let dir = tempfile::tempdir().unwrap();
+        let script = write_script(dir.path(), "exit 0");
+        assert!(validate_command(&script).is_ok());
+
+        std::fs::set_permissions(&script, std::fs::Permissions::from_mode(0o644)).unwrap();
+        let err = validate_command(&script).unwrap_err();
+        assert!(err.to_string().contains("not executable"), "{err:#}");
+
+        assert!(validate_command(dir.path()).is_err());
+        assert!(validate_command(&dir.path().join("missing")).is_err());
+    }
+
+    #[test]
+    fn test_solver_envs_describe_dns01_record() {
+        let envs = solver_envs(&dns_challenge());
+
+        let get = |key: &str| {
+            envs.iter()
+                .find(|(name, _)| *name == key)
+                .map(|(_, value)| value.clone())
+        };
+        assert_eq!(get("BOOTROOT_CHALLENGE_TYPE").as_deref(), Some("dns-01"));
+        assert_eq!(
+            get("BOOTROOT_CHALLENGE_TXT_NAME").as_deref(),
+            Some("_acme-challenge.001.edge.node.trusted.domain")
+        );
+        assert_eq!(
+            get("BOOTROOT_CHALLENGE_TXT_VALUE"),
+            Some(dns01::challenge_record_value("tok-1.thumb"))
+        );
+        assert!(get("BOOTROOT_CHALLENGE_PATH").is_none());
+    }
+
+    #[test]
+    fn test_manual_instructions_show_exact_record() {
+        let text = manual_instructions(&dns_challenge());
+
+        assert!(
+            text.contains(&format!(
+                "_acme-challenge.001.edge.node.trusted.domain. IN TXT \"{}\"",
+                dns01::challenge_record_value("tok-1.thumb")
+            )),
+            "{text}"
+        );
+        assert!(text.ends_with("Press Enter once it is visible to the CA... "));
+    }
+
+    #[tokio::test]
+    async fn test_command_provider_passes_action_and_details() {
+        let dir = tempfile::tempdir().unwrap();
+        let log = dir.path().join("calls.log");
+        let script = write_script(
+            dir.path(),
+            &format!(
+                "echo \"$1 $2 $3 $4 $BOOTROOT_CHALLENGE_TYPE\" >> {}",
+                log.display()
+            ),
+        );
+        let provider = ChallengeProvider::Command(&script);
+
+        provider.present(&dns_challenge()).await.unwrap();
+        provider.cleanup(&dns_challenge()).await;
+
+        let calls = std::fs::read_to_string(&log).unwrap();
+        assert_eq!(
+            calls,
+            "present 001.edge.node.trusted.domain tok-1 tok-1.thumb dns-01\n\
+             cleanup 001.edge.node.trusted.domain tok-1 tok-1.thumb dns-01\n"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_command_provider_reports_failed_present() {
+        let dir = tempfile::tempdir().unwrap();
+        let script = write_script(dir.path(), "echo boom >&2; exit 3");
+
+        let err = ChallengeProvider::Command(&script)
+            .present(&dns_challenge())
+            .await
+            .unwrap_err();
+
+        assert!(err.to_string().contains("present exited"), "{err:#}");
+    }
+}
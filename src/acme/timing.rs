@@ -0,0 +1,362 @@
+//! Wall-clock timing of the ACME issuance phases.
+//!
+//! `issue_certificate` brackets each protocol step with an
+//! [`Instant`] and accumulates the elapsed time per phase, so a slow CA
+//! (register/finalize/download) can be told apart from slow challenge
+//! validation. The totals are stored in the certificate sidecar and
+//! surfaced on `GET /status`; `[acme] phase_timing = true` also logs
+//! each phase as it completes. When OpenTelemetry export is enabled the
+//! individual phase intervals are kept as well, so they can be shipped
+//! as spans.
+//!
+//! The phase each in-flight issuance is in is also kept in a process-wide
+//! registry, together with the step the run is in outside any issuance
+//! (waiting for the CA, for example), so a run cut short by
+//! `--max-runtime` can say where it stopped.
+
+use std::collections::BTreeMap;
+use std::sync::Mutex as StdMutex;
+use std::time::{Duration, Instant, SystemTime};
+
+use serde::{Deserialize, Serialize};
+
+tokio::task_local! {
+    static ISSUANCE: String;
+}
+
+/// Phase of every in-flight issuance, keyed by its primary domain.
+static IN_PROGRESS: StdMutex<BTreeMap<String, Phase>> = StdMutex::new(BTreeMap::new());
+
+/// Step the run is in outside any issuance; see [`run_step`].
+static RUN_STEP: StdMutex<Option<&'static str>> = StdMutex::new(None);
+
+/// One step of an ACME issuance.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum Phase {
+    /// Directory fetch, initial nonce, and account registration.
+    Register,
+    /// Fetching each authorization of the order.
+    Authorization,
+    /// Publishing the challenge response and waiting for validation.
+    Challenge,
+    /// CSR generation, finalize, and order polling.
+    Finalize,
+    /// Downloading the issued certificate chain.
+    Download,
+}
+
+impl Phase {
+    pub(crate) fn label(self) -> &'static str {
+        match self {
+            Self::Register => "register",
+            Self::Authorization => "authorization",
+            Self::Challenge => "challenge",
+            Self::Finalize => "finalize",
+            Self::Download => "download",
+        }
+    }
+}
+
+/// Wall-clock interval of one completed phase.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct PhaseSpan {
+    pub(crate) phase: Phase,
+    pub(crate) start: SystemTime,
+    pub(crate) end: SystemTime,
+}
+
+/// Accumulated duration of each issuance phase, in milliseconds.
+///
+/// `authorization_ms` and `challenge_ms` sum over every authorization of
+/// the order. `total_ms` spans the whole issuance, including output
+/// writing, so it can exceed the sum of the phases.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub(crate) struct PhaseTimings {
+    pub(crate) register_ms: u64,
+    pub(crate) authorization_ms: u64,
+    pub(crate) challenge_ms: u64,
+    pub(crate) finalize_ms: u64,
+    pub(crate) download_ms: u64,
+    pub(crate) total_ms: u64,
+    /// Individual phase intervals; `None` unless span collection was
+    /// requested with [`PhaseTimings::with_spans`].
+    #[serde(skip)]
+    pub(crate) spans: Option<Vec<PhaseSpan>>,
+}
+
+impl PhaseTimings {
+    /// Returns empty timings that also keep every phase interval.
+    pub(crate) fn with_spans() -> Self {
+        Self {
+            spans: Some(Vec::new()),
+            ..Self::default()
+        }
+    }
+
+    /// Adds the time elapsed since `started` to `phase` and returns the
+    /// elapsed milliseconds.
+    pub(crate) fn record(&mut self, phase: Phase, started: Instant) -> u64 {
+        let elapsed_duration = started.elapsed();
+        if let Some(spans) = &mut self.spans {
+            let end = SystemTime::now();
+            spans.push(PhaseSpan {
+                phase,
+                start: end.checked_sub(elapsed_duration).unwrap_or(end),
+                end,
+            });
+        }
+        let elapsed = duration_ms(elapsed_duration);
+        let slot = match phase {
+            Phase::Register => &mut self.register_ms,
+            Phase::Authorization => &mut self.authorization_ms,
+            Phase::Challenge => &mut self.challenge_ms,
+            Phase::Finalize => &mut self.finalize_ms,
+            Phase::Download => &mut self.download_ms,
+        };
+        *slot = slot.saturating_add(elapsed);
+        elapsed
+    }
+
+    /// Sets `total_ms` to the time elapsed since `started`.
+    pub(crate) fn finish(&mut self, started: Instant) {
+        self.total_ms = duration_ms(started.elapsed());
+    }
+
+    /// Renders the timings as a single log-friendly line.
+    pub(crate) fn summary(&self) -> String {
+        format!(
+            "register={}ms authorization={}ms challenge={}ms finalize={}ms download={}ms total={}ms",
+            self.register_ms,
+            self.authorization_ms,
+            self.challenge_ms,
+            self.finalize_ms,
+            self.download_ms,
+            self.total_ms
+        )
+    }
+}
+
+/// Runs `future`, the issuance for `domain`, so the phases it starts
+/// with [`begin`] are reported by [`phases_in_progress`] until it finishes.
+pub(crate) async fn track<F: Future>(domain: String, future: F) -> F::Output {
+    let output = ISSUANCE.scope(domain.clone(), future).await;
+    in_progress_registry().remove(&domain);
+    output
+}
+
+/// Marks `phase` as started for the current issuance and returns its
+/// start time for [`PhaseTimings::record`].
+pub(crate) fn begin(phase: Phase) -> Instant {
+    let _ = ISSUANCE.try_with(|domain| {
+        in_progress_registry().insert(domain.clone(), phase);
+    });
+    Instant::now()
+}
+
+/// Runs `future`, a step of the run outside any issuance such as
+/// waiting for the CA, so [`phases_in_progress`] reports `step` until it
+/// finishes.
+pub async fn run_step<F: Future>(step: &'static str, future: F) -> F::Output {
+    *run_step_slot() = Some(step);
+    let output = future.await;
+    *run_step_slot() = None;
+    output
+}
+
+/// Returns the current run step, if any, followed by `<domain>: <phase>`
+/// for every issuance that has not finished; empty when nothing is
+/// running.
+#[must_use]
+pub fn phases_in_progress() -> Vec<String> {
+    let step = run_step_slot().map(str::to_string);
+    step.into_iter()
+        .chain(
+            in_progress_registry()
+                .iter()
+                .map(|(domain, phase)| format!("{domain}: {}", phase.label())),
+        )
+        .collect()
+}
+
+/// Wall-clock budget of a run under `--max-runtime`.
+#[derive(Debug, Clone, Copy)]
+pub struct RunBudget {
+    limit: Duration,
+    deadline: tokio::time::Instant,
+}
+
+impl RunBudget {
+    /// Starts a budget of `limit` from now.
+    #[must_use]
+    pub fn start(limit: Duration) -> Self {
+        Self {
+            limit,
+            deadline: tokio::time::Instant::now() + limit,
+        }
+    }
+
+    /// Error for a run that outlived the budget, naming the step and the
+    /// issuance phases it was in. Called right after the run is dropped,
+    /// which leaves them registered.
+    fn exceeded(self) -> anyhow::Error {
+        let phases = phases_in_progress();
+        let progress = if phases.is_empty() {
+            "no issuance was in progress".to_string()
+        } else {
+            format!("in progress: {}", phases.join(", "))
+        };
+        anyhow::anyhow!(
+            "Run exceeded --max-runtime of {}; {progress}",
+            humantime::format_duration(self.limit)
+        )
+    }
+}
+
+/// Runs `future` within `budget`, or without a limit when it is `None`.
+///
+/// # Errors
+/// Returns the error of `future`, or, once the budget runs out, drops
+/// `future` and returns an error naming where the run stopped.
+pub async fn within_budget<T>(
+    budget: Option<RunBudget>,
+    future: impl Future<Output = anyhow::Result<T>>,
+) -> anyhow::Result<T> {
+    let Some(budget) = budget else {
+        return future.await;
+    };
+    tokio::time::timeout_at(budget.deadline, future)
+        .await
+        .unwrap_or_else(|_| Err(budget.exceeded()))
+}
+
+fn run_step_slot() -> std::sync::MutexGuard<'static, Option<&'static str>> {
+    RUN_STEP
+        .lock()
+        .unwrap_or_else(std::sync::PoisonError::into_inner)
+}
+
+fn in_progress_registry() -> std::sync::MutexGuard<'static, BTreeMap<String, Phase>> {
+    IN_PROGRESS
+        .lock()
+        .unwrap_or_else(std::sync::PoisonError::into_inner)
+}
+
+fn duration_ms(duration: Duration) -> u64 {
+    u64::try_from(duration.as_millis()).unwrap_or(u64::MAX)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_record_accumulates_per_phase() {
+        let mut timings = PhaseTimings::default();
+        let started = Instant::now()
+            .checked_sub(Duration::from_millis(50))
+            .unwrap();
+
+        let first = timings.record(Phase::Challenge, started);
+        let second = timings.record(Phase::Challenge, started);
+
+        assert!(first >= 50);
+        assert_eq!(timings.challenge_ms, first + second);
+        assert_eq!(timings.register_ms, 0);
+        assert_eq!(timings.download_ms, 0);
+        assert_eq!(timings.spans, None);
+    }
+
+    #[test]
+    fn test_with_spans_keeps_each_interval() {
+        let mut timings = PhaseTimings::with_spans();
+        let started = Instant::now()
+            .checked_sub(Duration::from_millis(30))
+            .unwrap();
+
+        timings.record(Phase::Register, started);
+        timings.record(Phase::Download, started);
+
+        let spans = timings.spans.unwrap();
+        assert_eq!(spans.len(), 2);
+        assert_eq!(spans[0].phase, Phase::Register);
+        assert_eq!(spans[1].phase, Phase::Download);
+        assert!(spans[0].end.duration_since(spans[0].start).unwrap() >= Duration::from_millis(30));
+    }
+
+    #[test]
+    fn test_finish_sets_total() {
+        let mut timings = PhaseTimings::default();
+        let started = Instant::now()
+            .checked_sub(Duration::from_millis(20))
+            .unwrap();
+
+        timings.finish(started);
+
+        assert!(timings.total_ms >= 20);
+    }
+
+    #[test]
+    fn test_summary_lists_every_phase() {
+        let timings = PhaseTimings {
+            register_ms: 1,
+            authorization_ms: 2,
+            challenge_ms: 3,
+            finalize_ms: 4,
+            download_ms: 5,
+            total_ms: 20,
+            spans: None,
+        };
+
+        assert_eq!(
+            timings.summary(),
+            "register=1ms authorization=2ms challenge=3ms finalize=4ms download=5ms total=20ms"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_track_reports_the_started_phase_until_the_issuance_ends() {
+        let domain = "001.timing-test.edge-node-01.trusted.domain";
+        let reported = track(domain.to_string(), async {
+            begin(Phase::Register);
+            begin(Phase::Challenge);
+            phases_in_progress()
+        })
+        .await;
+
+        assert!(reported.contains(&format!("{domain}: challenge")));
+        assert!(
+            !phases_in_progress()
+                .iter()
+                .any(|entry| entry.starts_with(domain))
+        );
+    }
+
+    #[tokio::test]
+    async fn test_within_budget_reports_the_step_it_stopped_in() {
+        let budget = RunBudget::start(Duration::from_millis(50));
+
+        let err = within_budget(
+            Some(budget),
+            run_step("waiting for CA", async {
+                tokio::time::sleep(Duration::from_secs(5)).await;
+                anyhow::Ok(())
+            }),
+        )
+        .await
+        .unwrap_err()
+        .to_string();
+        *run_step_slot() = None;
+
+        assert!(err.contains("--max-runtime of 50ms"), "{err}");
+        assert!(err.contains("in progress: waiting for CA"), "{err}");
+    }
+
+    #[test]
+    fn test_timings_serialize_with_ms_suffix() {
+        let json = serde_json::to_value(PhaseTimings::default()).unwrap();
+
+        assert_eq!(json["challenge_ms"], serde_json::json!(0));
+        assert_eq!(json["total_ms"], serde_json::json!(0));
+        assert!(json.get("spans").is_none());
+    }
+}
@@ -30,7 +30,7 @@ pub enum ChallengeStatus {
     Invalid,
 }
 
-#[derive(Debug, Deserialize, Clone, PartialEq, Eq)]
+#[derive(Debug, Deserialize, Clone, Copy, PartialEq, Eq)]
 pub enum ChallengeType {
     #[serde(rename = "http-01")]
     Http01,
@@ -40,6 +40,18 @@ pub enum ChallengeType {
     TlsAlpn01,
 }
 
+impl ChallengeType {
+    /// Upper-case challenge name used in log and error messages.
+    #[must_use]
+    pub fn label(self) -> &'static str {
+        match self {
+            Self::Http01 => "HTTP-01",
+            Self::Dns01 => "DNS-01",
+            Self::TlsAlpn01 => "TLS-ALPN-01",
+        }
+    }
+}
+
 #[derive(Debug, Deserialize, Clone)]
 pub struct Order {
     pub status: OrderStatus,
@@ -50,11 +62,19 @@ pub struct Order {
     pub url: Option<String>,
 }
 
+/// ACME identifier (RFC 8555 §7.1.4). For wildcard orders the value
+/// omits the `*.` prefix.
+#[derive(Debug, Deserialize, Clone)]
+pub struct Identifier {
+    #[serde(rename = "type")]
+    pub r#type: String,
+    pub value: String,
+}
+
 #[derive(Debug, Deserialize)]
 pub struct Authorization {
     pub status: AuthorizationStatus,
-    #[serde(rename = "identifier")]
-    _identifier: serde_json::Value,
+    pub identifier: Identifier,
     pub challenges: Vec<Challenge>,
 }
 
@@ -68,6 +88,22 @@ pub struct Challenge {
     pub error: Option<serde_json::Value>,
 }
 
+/// ACME Renewal Information (ARI, RFC 9773) response body.
+#[derive(Debug, Deserialize, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct RenewalInfo {
+    pub suggested_window: SuggestedWindow,
+    #[serde(rename = "explanationURL", default)]
+    pub explanation_url: Option<String>,
+}
+
+/// CA-suggested renewal window, as RFC 3339 timestamps.
+#[derive(Debug, Deserialize, Clone)]
+pub struct SuggestedWindow {
+    pub start: String,
+    pub end: String,
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -96,4 +132,35 @@ mod tests {
         let c_type: ChallengeType = serde_json::from_str(json).unwrap();
         assert_eq!(c_type, ChallengeType::Dns01);
     }
+
+    #[test]
+    fn test_authorization_deserialization_reads_identifier() {
+        let json = r#"{
+            "status": "pending",
+            "identifier": {"type": "dns", "value": "internal.example"},
+            "wildcard": true,
+            "challenges": []
+        }"#;
+        let authz: Authorization = serde_json::from_str(json).unwrap();
+        assert_eq!(authz.identifier.r#type, "dns");
+        assert_eq!(authz.identifier.value, "internal.example");
+    }
+
+    #[test]
+    fn test_renewal_info_deserialization() {
+        let json = r#"{
+            "suggestedWindow": {
+                "start": "2026-01-02T04:00:00Z",
+                "end": "2026-01-03T04:00:00Z"
+            },
+            "explanationURL": "https://ca.example/docs/ari"
+        }"#;
+        let info: RenewalInfo = serde_json::from_str(json).unwrap();
+        assert_eq!(info.suggested_window.start, "2026-01-02T04:00:00Z");
+        assert_eq!(info.suggested_window.end, "2026-01-03T04:00:00Z");
+        assert_eq!(
+            info.explanation_url.as_deref(),
+            Some("https://ca.example/docs/ari")
+        );
+    }
 }
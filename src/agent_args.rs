@@ -1,6 +1,7 @@
 use std::path::PathBuf;
+use std::time::Duration;
 
-use clap::{ArgAction, Parser};
+use clap::{ArgAction, ArgGroup, Parser};
 
 #[derive(Parser, Debug)]
 #[command(
@@ -8,6 +9,12 @@ use clap::{ArgAction, Parser};
     version,
     about = "Daemon that renews service TLS certificates via ACME and reloads their consumers",
     long_about = None,
+    group(ArgGroup::new("root_fetch").args(["trust_root_on_first_use", "fetch_root_from"])),
+    group(
+        ArgGroup::new("single_run")
+            .args(["oneshot", "renew_dir", "import_account", "test_eab"])
+            .multiple(true)
+    ),
 )]
 pub struct Args {
     /// Path to configuration file (default: agent.toml)
@@ -18,6 +25,10 @@ pub struct Args {
     #[arg(long)]
     pub email: Option<String>,
 
+    /// ACME account contact URI, e.g. `mailto:ops@example.com` (repeatable; replaces --email)
+    #[arg(long, value_name = "URI")]
+    pub contact: Vec<String>,
+
     /// ACME Directory URL
     #[arg(long)]
     pub ca_url: Option<String>,
@@ -42,13 +53,459 @@ pub struct Args {
     #[arg(long = "eab-file")]
     pub eab_file: Option<PathBuf>,
 
+    /// Shell command whose stdout is the EAB JSON (optional, replaces --eab-file)
+    #[arg(
+        long = "eab-command",
+        value_name = "CMD",
+        conflicts_with_all = ["eab_file", "eab_kid", "eab_hmac"]
+    )]
+    pub eab_command: Option<String>,
+
+    /// Directory with `kid` and `hmac` files, e.g. a Kubernetes secret mount (replaces --eab-file)
+    #[arg(
+        long = "eab-dir",
+        value_name = "DIR",
+        conflicts_with_all = ["eab_file", "eab_kid", "eab_hmac", "eab_command"]
+    )]
+    pub eab_dir: Option<PathBuf>,
+
     /// Run once and exit (disable daemon loop)
     #[arg(long)]
     pub oneshot: bool,
 
+    /// Renew every agent-managed certificate under this directory, then exit
+    #[arg(long, value_name = "DIR", conflicts_with = "oneshot")]
+    pub renew_dir: Option<PathBuf>,
+
+    /// With --renew-dir, start at most this many renewals per minute
+    #[arg(
+        long,
+        value_name = "PER_MIN",
+        requires = "renew_dir",
+        value_parser = clap::value_parser!(u32).range(1..)
+    )]
+    pub renew_rate: Option<u32>,
+
+    /// Serve the on-demand issuance API (POST /issue) on this loopback address or unix:<PATH> socket instead of renewing profiles
+    #[arg(
+        long,
+        value_name = "ADDR",
+        conflicts_with_all = ["oneshot", "renew_dir"]
+    )]
+    pub serve: Option<String>,
+
+    /// File holding the bearer token every issuance API request must present (default: the BOOTROOT_API_TOKEN environment variable)
+    #[arg(long, value_name = "PATH", requires = "serve")]
+    pub api_token_file: Option<PathBuf>,
+
+    /// After the --oneshot issuance, serve the certificate over TLS on this address with a fresh OCSP response stapled, until Ctrl-C (diagnostic only)
+    #[arg(long, value_name = "ADDR", requires = "oneshot")]
+    pub staple_test: Option<String>,
+
     /// Disable TLS certificate verification for this run only (INSECURE break-glass override)
     #[arg(long, action = ArgAction::SetTrue)]
     pub insecure: bool,
+
+    /// Allow a plaintext http:// ACME directory URL (INSECURE, local test CAs only)
+    #[arg(long, action = ArgAction::SetTrue)]
+    pub insecure_http: bool,
+
+    /// Export issuance traces to this OTLP/HTTP collector (e.g. http://collector:4318)
+    #[arg(long, value_name = "URL")]
+    pub otel_endpoint: Option<String>,
+
+    /// Correlation ID for this run's logs, hooks and metadata instead of a generated UUID; in daemon mode each renewal cycle's ID is `<ID>-<n>`
+    #[arg(long, value_name = "ID", value_parser = parse_run_id)]
+    pub run_id: Option<String>,
+
+    /// Wait until this nameserver serves the DNS-01 TXT record before validation (repeatable)
+    #[arg(long, value_name = "ADDR")]
+    pub dns_resolver_check: Vec<String>,
+
+    /// Seconds to wait for DNS-01 propagation before giving up
+    #[arg(long, value_name = "SECS")]
+    pub dns_propagation_timeout: Option<u64>,
+
+    /// Answer DNS-01 by printing each TXT record and waiting for the operator to publish it (needs a terminal)
+    #[arg(long, action = ArgAction::SetTrue, conflicts_with = "solver_command")]
+    pub dns01_manual: bool,
+
+    /// After each renewal, send --reload-signal to the process whose PID is in this file
+    #[arg(long, value_name = "PATH")]
+    pub reload_pid_file: Option<PathBuf>,
+
+    /// Signal sent to the --reload-pid-file process (default: HUP)
+    #[arg(long, value_name = "SIGNAL", requires = "reload_pid_file")]
+    pub reload_signal: Option<String>,
+
+    /// After each renewal, restart this container so it loads the new certificate
+    #[arg(long, value_name = "NAME")]
+    pub reload_container: Option<String>,
+
+    /// step-ca ACME provisioner to use; replaces the provisioner in the --ca-url directory path
+    #[arg(long, value_name = "NAME")]
+    pub provisioner: Option<String>,
+
+    /// In daemon mode, exit non-zero once a certificate has expired and renewal still fails
+    #[arg(long, action = ArgAction::SetTrue)]
+    pub exit_on_expired: bool,
+
+    /// In daemon mode, also check each certificate's OCSP status and renew at once if it was revoked
+    #[arg(long, action = ArgAction::SetTrue)]
+    pub renew_on_revoked: bool,
+
+    /// In daemon mode, skip a profile's renewal unless its domain resolves to an address bound on this host
+    #[arg(long, action = ArgAction::SetTrue)]
+    pub verify_dns_before_renew: bool,
+
+    /// Also renew once this percentage (1-99) of the certificate's lifetime has elapsed
+    #[arg(long, value_name = "PCT", value_parser = clap::value_parser!(u8).range(1..=99))]
+    pub renew_before_pct: Option<u8>,
+
+    /// After issuance, log the certificate's embedded Certificate Transparency SCTs and warn if none
+    #[arg(long, action = ArgAction::SetTrue)]
+    pub check_sct: bool,
+
+    /// Send the EAB even when the CA directory says external account binding is not required
+    #[arg(long, action = ArgAction::SetTrue)]
+    pub require_eab: bool,
+
+    /// Agree to the CA's Terms of Service only when the directory still advertises this URL; abort when it changed
+    #[arg(long, value_name = "URL")]
+    pub require_tos: Option<String>,
+
+    /// ACME account key file (P-256 or RSA PEM), created on first use so every run reuses one account
+    #[arg(long, value_name = "PATH")]
+    pub account_key: Option<PathBuf>,
+
+    /// With --oneshot, deactivate the ACME account after a successful issuance so throwaway runs leave no live accounts on the CA (cannot be combined with a persistent account key)
+    #[arg(
+        long,
+        action = ArgAction::SetTrue,
+        requires = "oneshot",
+        conflicts_with = "account_key"
+    )]
+    pub purge_account_on_success: bool,
+
+    /// Dump every ACME request and response line with headers to stderr, like curl -v (debugging)
+    #[arg(long)]
+    pub trace_http: bool,
+
+    /// With --trace-http, also dump bodies: JWS headers and payloads decoded, signatures redacted
+    #[arg(long, requires = "trace_http")]
+    pub trace_http_bodies: bool,
+
+    /// Take over the ACME account of this key from another client (PKCS#8, SEC1 EC or PKCS#1 RSA PEM): verify it and write it to the account key file, then exit
+    #[arg(
+        long,
+        value_name = "KEY",
+        requires = "import_account_url",
+        conflicts_with_all = ["oneshot", "renew_dir", "serve"]
+    )]
+    pub import_account: Option<PathBuf>,
+
+    /// Account URL the --import-account key must belong to
+    #[arg(long, value_name = "URL", requires = "import_account")]
+    pub import_account_url: Option<String>,
+
+    /// Only register the acme.account_key_path account with the configured EAB credentials to check them, then exit; no certificate is issued
+    #[arg(
+        long,
+        action = ArgAction::SetTrue,
+        conflicts_with_all = ["oneshot", "renew_dir", "serve", "import_account"]
+    )]
+    pub test_eab: bool,
+
+    /// Have --test-eab register a throwaway account and deactivate it once the check succeeds (spends a single-use EAB key)
+    #[arg(long, action = ArgAction::SetTrue, requires = "test_eab")]
+    pub deactivate_test_account: bool,
+
+    /// Fetch the CA's ACME directory (--ca-url, trusted through [trust] and --root-dir), print it, then exit (non-zero if it is not a valid ACME directory)
+    #[arg(
+        long,
+        action = ArgAction::SetTrue,
+        conflicts_with_all = ["oneshot", "renew_dir", "serve", "import_account", "test_eab"]
+    )]
+    pub print_acme_directory: bool,
+
+    /// Before the first issuance, poll the CA's ACME directory for up to this many seconds until it answers (for a CA started alongside the agent)
+    #[arg(long, value_name = "SECS", value_parser = clap::value_parser!(u64).range(1..))]
+    pub wait_for_ca: Option<u64>,
+
+    /// With --oneshot, print one JSON object describing the outcome (action, domains, serial, validity, files, error) to standard output and send logs to standard error
+    #[arg(long, action = ArgAction::SetTrue, requires = "oneshot")]
+    pub result_json: bool,
+
+    /// With --oneshot, --renew-dir, --import-account, or --test-eab, stop the whole run, including --wait-for-ca and every retry, after this long (for example `10m`) and fail naming the step or issuance phase it stopped in
+    #[arg(
+        long,
+        value_name = "DURATION",
+        value_parser = parse_duration,
+        requires = "single_run",
+        conflicts_with = "staple_test"
+    )]
+    pub max_runtime: Option<Duration>,
+
+    /// Generate a private key at paths.key and a CSR for the single profile, print the CSR (or write it to --csr-out), then exit without contacting the CA
+    #[arg(
+        long,
+        action = ArgAction::SetTrue,
+        conflicts_with_all = [
+            "oneshot",
+            "renew_dir",
+            "serve",
+            "import_account",
+            "test_eab",
+            "print_acme_directory",
+            "key_fd",
+            "key_fifo"
+        ]
+    )]
+    pub gen_csr: bool,
+
+    /// With --gen-csr, write the PEM CSR to this file instead of standard output
+    #[arg(long, value_name = "PATH", requires = "gen_csr")]
+    pub csr_out: Option<PathBuf>,
+
+    /// Executable that presents and cleans up challenges (`present`/`cleanup` protocol) instead of the built-in solvers
+    #[arg(long, value_name = "PATH")]
+    pub solver_command: Option<PathBuf>,
+
+    /// Request ACME URLs returned by the CA that start with FROM at TO instead (`FROM=TO`, repeatable), for CAs that advertise hostnames the agent cannot reach
+    #[arg(long, value_name = "FROM=TO", value_parser = parse_url_rewrite)]
+    pub url_rewrite: Vec<crate::config::UrlRewrite>,
+
+    /// Lowest TLS version for ACME server connections (default: 1.2)
+    #[arg(long, value_enum, value_name = "VERSION")]
+    pub tls_min_version: Option<crate::config::TlsVersion>,
+
+    /// Highest TLS version for ACME server connections (default: newest supported)
+    #[arg(long, value_enum, value_name = "VERSION")]
+    pub tls_max_version: Option<crate::config::TlsVersion>,
+
+    /// Seconds between order status polls after finalize (default: acme.poll_interval_secs)
+    #[arg(long, value_name = "SECS")]
+    pub order_poll_interval: Option<u64>,
+
+    /// Seconds to wait for a finalized order to complete before failing the issuance
+    #[arg(long, value_name = "SECS")]
+    pub order_timeout: Option<u64>,
+
+    /// Authorizations to solve at the same time on a multi-domain order (default: 1)
+    #[arg(long, value_name = "N")]
+    pub max_parallel_challenges: Option<u64>,
+
+    /// If writing a certificate's files fails, remove the ones this run created
+    #[arg(long, action = ArgAction::SetTrue)]
+    pub cleanup_on_failure: bool,
+
+    /// Organization (O) for the CSR subject of every profile
+    #[arg(long, value_name = "ORG")]
+    pub subject_o: Option<String>,
+
+    /// Organizational unit (OU) for the CSR subject of every profile
+    #[arg(long, value_name = "UNIT")]
+    pub subject_ou: Option<String>,
+
+    /// Two-letter country code (C) for the CSR subject of every profile
+    #[arg(long, value_name = "CC")]
+    pub subject_c: Option<String>,
+
+    /// URI SAN (for example a SPIFFE ID) for the CSR of every profile (repeatable)
+    #[arg(long, value_name = "URI")]
+    pub uri_san: Vec<String>,
+
+    /// Email SAN for the CSR of every profile (repeatable)
+    #[arg(long, value_name = "EMAIL")]
+    pub email_san: Vec<String>,
+
+    /// After issuance, fail unless the certificate carries exactly these SANs (repeatable)
+    #[arg(long, value_name = "SAN")]
+    pub expected_san: Vec<String>,
+
+    /// In oneshot mode, serve GET /healthz on this address while issuance runs
+    #[arg(long, value_name = "ADDR")]
+    pub health_addr: Option<String>,
+
+    /// Write the leaf's SPKI pin (base64 SHA-256) to this file after each issuance (single-profile configs)
+    #[arg(long, value_name = "PATH")]
+    pub write_pin: Option<PathBuf>,
+
+    /// File name for every profile's certificate, replacing the last component of paths.cert (for example tls.crt)
+    #[arg(long, value_name = "NAME", value_parser = parse_file_name)]
+    pub cert_name: Option<String>,
+
+    /// File name for every profile's private key, replacing the last component of paths.key (for example tls.key)
+    #[arg(long, value_name = "NAME", value_parser = parse_file_name)]
+    pub key_name: Option<String>,
+
+    /// Also trust every PEM certificate in this directory (for example /etc/ssl/certs) when verifying the ACME server
+    #[arg(long, value_name = "DIR")]
+    pub root_dir: Option<PathBuf>,
+
+    /// Require the ACME server's certificate to carry this public key (hex SHA-256 of its SPKI); repeat for rotation. With --insecure the pin replaces chain verification
+    #[arg(long = "pin-sha256", value_name = "HEX")]
+    pub pin_sha256: Vec<String>,
+
+    /// Encoding of every profile's certificate and key files
+    #[arg(long, value_enum, value_name = "FORMAT")]
+    pub format: Option<crate::config::OutputFormat>,
+
+    /// Order of the certificates in every profile's bundled certificate file
+    #[arg(long, value_enum, value_name = "ORDER")]
+    pub bundle_order: Option<crate::config::BundleOrder>,
+
+    /// With --oneshot, skip each profile whose certificate on disk is not yet due for renewal, before any account registration or other CA request
+    #[arg(long, action = ArgAction::SetTrue, requires = "oneshot")]
+    pub no_register_if_exists: bool,
+
+    /// Write the private key to this inherited file descriptor (a pipe or socket) instead of paths.key, then close it (--oneshot, single profile)
+    #[arg(
+        long,
+        value_name = "FD",
+        value_parser = clap::value_parser!(i32).range(3..),
+        requires = "oneshot",
+        conflicts_with_all = ["key_fifo", "staple_test"]
+    )]
+    pub key_fd: Option<i32>,
+
+    /// Write the private key to this named pipe instead of paths.key on every issuance (single profile)
+    #[arg(long, value_name = "PATH", conflicts_with = "staple_test")]
+    pub key_fifo: Option<PathBuf>,
+
+    /// Also write every profile's certificate, chain, full chain, and key in certbot's live/<domain>/ layout under this directory
+    #[arg(long, value_name = "BASE")]
+    pub certbot_layout: Option<PathBuf>,
+
+    /// Also write every profile's files into a new timestamped directory under BASE/<domain>/ per issuance and atomically repoint BASE/<domain>/current at it
+    #[arg(long, value_name = "BASE")]
+    pub versioned_out: Option<PathBuf>,
+
+    /// Earlier --versioned-out versions to keep for rollback [default: 2]
+    #[arg(long, value_name = "N", requires = "versioned_out")]
+    pub keep_versions: Option<usize>,
+
+    /// Fetch and pin the CA root on first use when no trust.trusted_ca_sha256 pin exists
+    #[arg(long, action = ArgAction::SetTrue)]
+    pub trust_root_on_first_use: bool,
+
+    /// Fetch the root with --expected-fingerprint from this step-ca URL and pin it
+    #[arg(long, value_name = "CA_URL", requires = "expected_fingerprint")]
+    pub fetch_root_from: Option<String>,
+
+    /// SHA-256 fingerprint the fetched CA root must match (skips the interactive prompt)
+    #[arg(long, value_name = "SHA256", requires = "root_fetch")]
+    pub expected_fingerprint: Option<String>,
+
+    /// Print subject, issuer, and validity of every certificate in this file, check that they form a chain, then exit (non-zero if broken)
+    #[arg(
+        long,
+        value_name = "FILE",
+        conflicts_with_all = ["oneshot", "renew_dir", "serve"]
+    )]
+    pub print_chain: Option<PathBuf>,
+
+    /// Check the remaining lifetime of the certificate in this file, print it, then exit 0 (healthy), 1 (below --min-remaining), or 2 (expired or unreadable) without contacting the CA
+    #[arg(
+        long,
+        value_name = "FILE",
+        conflicts_with_all = ["oneshot", "renew_dir", "serve", "print_chain"]
+    )]
+    pub check_expiry: Option<PathBuf>,
+
+    /// With --check-expiry, the lifetime below which the check fails (e.g. `168h`; default 0)
+    #[arg(
+        long,
+        value_name = "DURATION",
+        value_parser = parse_duration,
+        requires = "check_expiry"
+    )]
+    pub min_remaining: Option<Duration>,
+
+    /// Ask step-ca to sign this OpenSSH public key as an SSH certificate, write it next to the key as <name>-cert.pub, then exit
+    #[arg(
+        long,
+        value_name = "PUBKEY",
+        requires_all = ["ssh_principal", "ssh_token_file"],
+        conflicts_with_all = [
+            "oneshot",
+            "renew_dir",
+            "serve",
+            "import_account",
+            "test_eab",
+            "print_acme_directory",
+            "gen_csr",
+            "print_chain",
+            "check_expiry"
+        ]
+    )]
+    pub ssh_sign: Option<PathBuf>,
+
+    /// With --ssh-sign, the kind of certificate to request (default: user)
+    #[arg(long, value_enum, value_name = "TYPE", requires = "ssh_sign")]
+    pub ssh_cert_type: Option<crate::ssh_cert::SshCertType>,
+
+    /// With --ssh-sign, a principal (user name or host name) the certificate is valid for; repeatable
+    #[arg(long, value_name = "NAME", requires = "ssh_sign")]
+    pub ssh_principal: Vec<String>,
+
+    /// With --ssh-sign, file holding the one-time token from an SSH-capable provisioner (e.g. `step ca token --ssh`)
+    #[arg(long, value_name = "PATH", requires = "ssh_sign")]
+    pub ssh_token_file: Option<PathBuf>,
+}
+
+const MAX_RUN_ID_LEN: usize = 128;
+
+/// Accepts `FROM=TO` for `--url-rewrite`, where both sides are absolute
+/// `http(s)` URL prefixes.
+fn parse_url_rewrite(value: &str) -> Result<crate::config::UrlRewrite, String> {
+    let (from, to) = value
+        .split_once('=')
+        .ok_or_else(|| "expected FROM=TO".to_string())?;
+    for prefix in [from, to] {
+        let url = reqwest::Url::parse(prefix).map_err(|err| format!("{prefix}: {err}"))?;
+        if !matches!(url.scheme(), "http" | "https") {
+            return Err(format!(
+                "{prefix}: only http and https URLs can be rewritten"
+            ));
+        }
+    }
+    Ok(crate::config::UrlRewrite {
+        from: from.to_string(),
+        to: to.to_string(),
+    })
+}
+
+fn parse_duration(value: &str) -> Result<Duration, String> {
+    humantime::parse_duration(value.trim()).map_err(|err| err.to_string())
+}
+
+/// Accepts a bare file name for `--cert-name` and `--key-name`: no path
+/// separators, and not `.` or `..`, so the file stays in the directory
+/// of the configured path.
+fn parse_file_name(value: &str) -> Result<String, String> {
+    if value.is_empty() || value == "." || value == ".." {
+        return Err("must be a file name".to_string());
+    }
+    if value.contains(['/', '\\', '\0']) {
+        return Err("must be a file name without path separators".to_string());
+    }
+    Ok(value.to_string())
+}
+
+/// Accepts a `--run-id` of at most 128 ASCII letters, digits, `-`, `_`,
+/// `.` and `:`, so it stays one token in log lines and hook variables.
+fn parse_run_id(value: &str) -> Result<String, String> {
+    if value.is_empty() || value.len() > MAX_RUN_ID_LEN {
+        return Err(format!("must be 1 to {MAX_RUN_ID_LEN} characters"));
+    }
+    if !value
+        .chars()
+        .all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '_' | '.' | ':'))
+    {
+        return Err("may only contain ASCII letters, digits, '-', '_', '.' and ':'".to_string());
+    }
+    Ok(value.to_string())
 }
 
 #[cfg(test)]
@@ -69,4 +526,330 @@ mod tests {
         assert!(help.contains("for this run only"));
         assert!(help.contains("break-glass override"));
     }
+
+    #[test]
+    fn version_flag_prints_package_version() {
+        let err = Args::try_parse_from(["bootroot-agent", "--version"]).unwrap_err();
+
+        assert_eq!(err.kind(), clap::error::ErrorKind::DisplayVersion);
+        assert!(err.to_string().contains(env!("CARGO_PKG_VERSION")));
+    }
+
+    #[test]
+    fn serve_reads_api_token_from_file() {
+        let with = [
+            "bootroot-agent",
+            "--serve",
+            "127.0.0.1:8443",
+            "--api-token-file",
+            "/run/secrets/api-token",
+        ];
+        let conflicting = ["bootroot-agent", "--serve", "127.0.0.1:8443", "--oneshot"];
+        let file_without_serve = [
+            "bootroot-agent",
+            "--api-token-file",
+            "/run/secrets/api-token",
+        ];
+        let token_on_argv = [
+            "bootroot-agent",
+            "--serve",
+            "127.0.0.1:8443",
+            "--api-token",
+            "token",
+        ];
+
+        assert!(Args::try_parse_from(conflicting).is_err());
+        assert!(Args::try_parse_from(file_without_serve).is_err());
+        assert!(Args::try_parse_from(token_on_argv).is_err());
+        let args = Args::try_parse_from(with).expect("parse");
+        assert_eq!(args.serve.as_deref(), Some("127.0.0.1:8443"));
+        assert_eq!(
+            args.api_token_file,
+            Some(PathBuf::from("/run/secrets/api-token"))
+        );
+    }
+
+    #[test]
+    fn expected_fingerprint_requires_trust_on_first_use() {
+        let fingerprint = "a".repeat(64);
+        let without = [
+            "bootroot-agent",
+            "--expected-fingerprint",
+            fingerprint.as_str(),
+        ];
+        let with = [
+            "bootroot-agent",
+            "--trust-root-on-first-use",
+            "--expected-fingerprint",
+            fingerprint.as_str(),
+        ];
+
+        assert!(Args::try_parse_from(without).is_err());
+        let args = Args::try_parse_from(with).expect("parse");
+        assert!(args.trust_root_on_first_use);
+        assert_eq!(
+            args.expected_fingerprint.as_deref(),
+            Some(fingerprint.as_str())
+        );
+    }
+
+    #[test]
+    fn fetch_root_from_requires_expected_fingerprint() {
+        let fingerprint = "a".repeat(64);
+        let without = ["bootroot-agent", "--fetch-root-from", "https://stepca:9000"];
+        let with = [
+            "bootroot-agent",
+            "--fetch-root-from",
+            "https://stepca:9000",
+            "--expected-fingerprint",
+            fingerprint.as_str(),
+        ];
+        let both = [
+            "bootroot-agent",
+            "--fetch-root-from",
+            "https://stepca:9000",
+            "--trust-root-on-first-use",
+            "--expected-fingerprint",
+            fingerprint.as_str(),
+        ];
+
+        assert!(Args::try_parse_from(without).is_err());
+        assert!(Args::try_parse_from(both).is_err());
+        let args = Args::try_parse_from(with).expect("parse");
+        assert_eq!(args.fetch_root_from.as_deref(), Some("https://stepca:9000"));
+    }
+
+    #[test]
+    fn deactivate_test_account_requires_test_eab() {
+        assert!(Args::try_parse_from(["bootroot-agent", "--deactivate-test-account"]).is_err());
+        assert!(Args::try_parse_from(["bootroot-agent", "--test-eab", "--oneshot"]).is_err());
+        let args =
+            Args::try_parse_from(["bootroot-agent", "--test-eab", "--deactivate-test-account"])
+                .expect("parse");
+        assert!(args.test_eab);
+        assert!(args.deactivate_test_account);
+    }
+
+    #[test]
+    fn print_acme_directory_conflicts_with_run_modes() {
+        let args =
+            Args::try_parse_from(["bootroot-agent", "--print-acme-directory"]).expect("parse");
+        assert!(args.print_acme_directory);
+        assert!(
+            Args::try_parse_from(["bootroot-agent", "--print-acme-directory", "--oneshot"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn cert_and_key_names_reject_paths() {
+        let args = Args::try_parse_from([
+            "bootroot-agent",
+            "--cert-name",
+            "tls.crt",
+            "--key-name",
+            "tls.key",
+        ])
+        .expect("parse");
+        assert_eq!(args.cert_name.as_deref(), Some("tls.crt"));
+        assert_eq!(args.key_name.as_deref(), Some("tls.key"));
+        for name in ["", ".", "..", "certs/tls.crt", "..\\tls.crt"] {
+            assert!(
+                Args::try_parse_from(["bootroot-agent", "--cert-name", name]).is_err(),
+                "{name}"
+            );
+        }
+    }
+
+    #[test]
+    fn csr_out_requires_gen_csr() {
+        let args = Args::try_parse_from(["bootroot-agent", "--gen-csr", "--csr-out", "edge.csr"])
+            .expect("parse");
+        assert!(args.gen_csr);
+        assert_eq!(args.csr_out, Some(PathBuf::from("edge.csr")));
+        assert!(Args::try_parse_from(["bootroot-agent", "--csr-out", "edge.csr"]).is_err());
+        assert!(Args::try_parse_from(["bootroot-agent", "--gen-csr", "--oneshot"]).is_err());
+    }
+
+    #[test]
+    fn no_register_if_exists_requires_oneshot() {
+        let args = Args::try_parse_from(["bootroot-agent", "--oneshot", "--no-register-if-exists"])
+            .expect("parse");
+        assert!(args.no_register_if_exists);
+        assert!(Args::try_parse_from(["bootroot-agent", "--no-register-if-exists"]).is_err());
+    }
+
+    #[test]
+    fn purge_account_on_success_excludes_persistent_account_key() {
+        let args =
+            Args::try_parse_from(["bootroot-agent", "--oneshot", "--purge-account-on-success"])
+                .expect("parse");
+        assert!(args.purge_account_on_success);
+        assert!(Args::try_parse_from(["bootroot-agent", "--purge-account-on-success"]).is_err());
+        assert!(
+            Args::try_parse_from([
+                "bootroot-agent",
+                "--oneshot",
+                "--purge-account-on-success",
+                "--account-key",
+                "account.key",
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn result_json_requires_oneshot() {
+        let args =
+            Args::try_parse_from(["bootroot-agent", "--oneshot", "--result-json"]).expect("parse");
+        assert!(args.result_json);
+        assert!(Args::try_parse_from(["bootroot-agent", "--result-json"]).is_err());
+    }
+
+    #[test]
+    fn max_runtime_requires_a_single_run_mode() {
+        let args = Args::try_parse_from(["bootroot-agent", "--oneshot", "--max-runtime", "10m"])
+            .expect("parse");
+        assert_eq!(args.max_runtime, Some(Duration::from_secs(600)));
+        assert!(
+            Args::try_parse_from(["bootroot-agent", "--test-eab", "--max-runtime", "90s"]).is_ok()
+        );
+        assert!(Args::try_parse_from(["bootroot-agent", "--max-runtime", "10m"]).is_err());
+        assert!(
+            Args::try_parse_from(["bootroot-agent", "--oneshot", "--max-runtime", "later"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn run_id_rejects_whitespace_and_empty_values() {
+        let args =
+            Args::try_parse_from(["bootroot-agent", "--run-id", "deploy-42"]).expect("parse");
+        assert_eq!(args.run_id.as_deref(), Some("deploy-42"));
+        assert!(Args::try_parse_from(["bootroot-agent", "--run-id", ""]).is_err());
+        assert!(Args::try_parse_from(["bootroot-agent", "--run-id", "two words"]).is_err());
+    }
+
+    #[test]
+    fn key_fd_requires_oneshot_and_skips_standard_streams() {
+        let args =
+            Args::try_parse_from(["bootroot-agent", "--oneshot", "--key-fd", "3"]).expect("parse");
+        assert_eq!(args.key_fd, Some(3));
+        assert!(Args::try_parse_from(["bootroot-agent", "--key-fd", "3"]).is_err());
+        assert!(Args::try_parse_from(["bootroot-agent", "--oneshot", "--key-fd", "1"]).is_err());
+        assert!(
+            Args::try_parse_from([
+                "bootroot-agent",
+                "--oneshot",
+                "--key-fd",
+                "3",
+                "--key-fifo",
+                "/run/key.fifo",
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn url_rewrite_requires_two_absolute_urls() {
+        let args = Args::try_parse_from([
+            "bootroot-agent",
+            "--url-rewrite",
+            "https://stepca.internal:9000/=https://ca.example.com/",
+            "--url-rewrite",
+            "https://stepca-2.internal:9000/=https://ca-2.example.com/",
+        ])
+        .expect("parse");
+        assert_eq!(args.url_rewrite.len(), 2);
+        assert_eq!(args.url_rewrite[0].from, "https://stepca.internal:9000/");
+        assert_eq!(args.url_rewrite[0].to, "https://ca.example.com/");
+        for value in [
+            "https://stepca.internal:9000/",
+            "stepca.internal=ca.example.com",
+            "ftp://stepca.internal/=https://ca.example.com/",
+        ] {
+            assert!(
+                Args::try_parse_from(["bootroot-agent", "--url-rewrite", value]).is_err(),
+                "{value}"
+            );
+        }
+    }
+
+    #[test]
+    fn min_remaining_requires_check_expiry() {
+        let args = Args::try_parse_from([
+            "bootroot-agent",
+            "--check-expiry",
+            "server.crt",
+            "--min-remaining",
+            "168h",
+        ])
+        .expect("parse");
+        assert_eq!(args.check_expiry, Some(PathBuf::from("server.crt")));
+        assert_eq!(args.min_remaining, Some(Duration::from_secs(168 * 60 * 60)));
+        assert!(Args::try_parse_from(["bootroot-agent", "--min-remaining", "168h"]).is_err());
+        assert!(
+            Args::try_parse_from([
+                "bootroot-agent",
+                "--check-expiry",
+                "server.crt",
+                "--min-remaining",
+                "soon",
+            ])
+            .is_err()
+        );
+    }
+
+    #[test]
+    fn ssh_sign_requires_principals_and_token() {
+        let args = Args::try_parse_from([
+            "bootroot-agent",
+            "--ssh-sign",
+            "/etc/ssh/ssh_host_ecdsa_key.pub",
+            "--ssh-cert-type",
+            "host",
+            "--ssh-principal",
+            "edge-node-01.internal",
+            "--ssh-token-file",
+            "ssh.token",
+        ])
+        .expect("parse");
+        assert_eq!(args.ssh_cert_type, Some(crate::ssh_cert::SshCertType::Host));
+        assert_eq!(args.ssh_principal, ["edge-node-01.internal"]);
+        assert!(
+            Args::try_parse_from([
+                "bootroot-agent",
+                "--ssh-sign",
+                "id_ecdsa.pub",
+                "--ssh-token-file",
+                "ssh.token",
+            ])
+            .is_err()
+        );
+        assert!(Args::try_parse_from(["bootroot-agent", "--ssh-principal", "alice"]).is_err());
+    }
+
+    #[test]
+    fn print_chain_conflicts_with_run_modes() {
+        let args =
+            Args::try_parse_from(["bootroot-agent", "--print-chain", "cert.pem"]).expect("parse");
+        assert_eq!(args.print_chain, Some(PathBuf::from("cert.pem")));
+        assert!(
+            Args::try_parse_from(["bootroot-agent", "--print-chain", "cert.pem", "--oneshot"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn format_accepts_pem_and_der() {
+        let args = Args::try_parse_from(["bootroot-agent", "--format", "der"]).expect("parse");
+        assert_eq!(args.format, Some(crate::config::OutputFormat::Der));
+        assert!(Args::try_parse_from(["bootroot-agent", "--format", "p12"]).is_err());
+        assert!(
+            Args::try_parse_from(["bootroot-agent"])
+                .unwrap()
+                .format
+                .is_none()
+        );
+    }
 }
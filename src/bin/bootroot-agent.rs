@@ -1,45 +1,233 @@
+use std::path::PathBuf;
 use std::sync::Arc;
 
+use anyhow::Context;
+use bootroot::acme::RunBudget;
 use bootroot::config::CliOverrides;
-use bootroot::{Args, config, eab, profile, run_daemon, run_oneshot};
+use bootroot::run_result::RunResult;
+use bootroot::{
+    Args, DaemonControl, config, eab, profile, run_daemon, run_id, run_oneshot,
+    run_oneshot_with_result, run_renew_dir, run_serve, run_staple_test, systemd, trust_tofu,
+};
 use clap::Parser;
 #[cfg(unix)]
 use tokio::signal::unix::{SignalKind, signal};
-use tracing::{error, info};
+use tracing::{error, info, warn};
+
+const DEFAULT_AGENT_CONFIG_PATH: &str = "agent.toml";
 
 #[tokio::main]
 async fn main() -> anyhow::Result<()> {
-    tracing_subscriber::fmt::init();
-
     let args = Args::parse();
+    init_logging(&args);
+
+    if let Some(path) = &args.print_chain {
+        let bytes =
+            std::fs::read(path).with_context(|| format!("Failed to read {}", path.display()))?;
+        let report = bootroot::cert_chain::inspect_chain(&bytes)?;
+        print!("{report}");
+        if !report.is_linked() {
+            std::process::exit(1);
+        }
+        return Ok(());
+    }
+
+    if let Some(path) = &args.check_expiry {
+        let report = bootroot::cert_expiry::check_expiry(
+            path,
+            args.min_remaining.unwrap_or_default(),
+            std::time::SystemTime::now(),
+        );
+        println!("{report}");
+        std::process::exit(report.status.exit_code());
+    }
+
+    if args.print_acme_directory {
+        let (settings, _) = load_settings(&args).await?;
+        match bootroot::acme::fetch_acme_directory(&settings, args.insecure).await {
+            Ok(directory) => println!("{directory}"),
+            Err(err) => {
+                error!("{err:#}");
+                std::process::exit(1);
+            }
+        }
+        return Ok(());
+    }
+
+    if let Some(public_key) = &args.ssh_sign {
+        let (settings, _) = load_settings(&args).await?;
+        let request = bootroot::ssh_cert::SshSignRequest {
+            public_key: public_key.clone(),
+            cert_type: args.ssh_cert_type.unwrap_or_default(),
+            principals: args.ssh_principal.clone(),
+            token_file: args.ssh_token_file.clone().unwrap_or_default(),
+        };
+        if let Err(err) =
+            bootroot::ssh_cert::sign_certificate(&settings, &request, args.insecure).await
+        {
+            error!("Failed to sign SSH certificate: {err:#}");
+            std::process::exit(1);
+        }
+        return Ok(());
+    }
+
+    if args.gen_csr {
+        let (settings, _) = load_settings(&args).await?;
+        let [profile] = settings.profiles.as_slice() else {
+            anyhow::bail!("--gen-csr requires exactly one profile");
+        };
+        let csr = bootroot::acme::generate_csr(&settings, profile).await?;
+        match &args.csr_out {
+            Some(path) => {
+                tokio::fs::write(path, &csr)
+                    .await
+                    .with_context(|| format!("Failed to write CSR to {}", path.display()))?;
+                info!("CSR saved to: {:?}", path);
+            }
+            None => print!("{csr}"),
+        }
+        return Ok(());
+    }
+
     info!("Starting Bootroot Agent (Rust)");
+    let heartbeat = systemd::spawn_watchdog();
 
-    if args.oneshot {
-        let (settings, final_eab) = load_settings(&args).await?;
-        match run_oneshot(
+    if let (Some(key_file), Some(account_url)) = (&args.import_account, &args.import_account_url) {
+        return run_id::scope(
+            invocation_run_id(&args),
+            within_max_runtime(&args, async {
+                let (settings, _) = load_settings_when_ca_ready(&args).await?;
+                let path =
+                    bootroot::acme::import_account(&settings, key_file, account_url, args.insecure)
+                        .await?;
+                info!(
+                    "Account imported. Keep acme.account_key_path = {} so renewals use it.",
+                    path.display()
+                );
+                anyhow::Ok(())
+            }),
+        )
+        .await;
+    }
+
+    if args.test_eab {
+        return run_id::scope(
+            invocation_run_id(&args),
+            within_max_runtime(&args, async {
+                let (settings, final_eab) = load_settings_when_ca_ready(&args).await?;
+                match bootroot::acme::test_eab(
+                    &settings,
+                    final_eab,
+                    args.deactivate_test_account,
+                    args.insecure,
+                )
+                .await
+                {
+                    Ok(account_url) if args.deactivate_test_account => {
+                        info!("EAB credentials accepted; test account {account_url} deactivated.");
+                    }
+                    Ok(account_url) => {
+                        info!("EAB credentials accepted; account {account_url} created.");
+                    }
+                    Err(err) => {
+                        error!("EAB test failed: {err:#}");
+                        std::process::exit(1);
+                    }
+                }
+                anyhow::Ok(())
+            }),
+        )
+        .await;
+    }
+
+    if let Some(root) = &args.renew_dir {
+        return run_id::scope(
+            invocation_run_id(&args),
+            within_max_runtime(&args, async {
+                let (settings, final_eab) = load_settings_when_ca_ready(&args).await?;
+                if let Err(err) = run_renew_dir(
+                    Arc::new(settings),
+                    final_eab,
+                    root,
+                    args.renew_rate,
+                    args.cleanup_on_failure,
+                    args.insecure,
+                )
+                .await
+                {
+                    error!("Failed to renew managed certificates: {err:?}");
+                    std::process::exit(1);
+                }
+                anyhow::Ok(())
+            }),
+        )
+        .await;
+    }
+
+    // Each `POST /issue` request gets its own run ID.
+    if let Some(listen_addr) = &args.serve {
+        let (settings, final_eab) = load_settings_when_ca_ready(&args).await?;
+        log_settings(&settings, final_eab.as_ref());
+        return run_serve(
             Arc::new(settings),
             final_eab,
-            args.config.clone(),
+            listen_addr,
+            args.api_token_file.as_deref(),
             args.insecure,
         )
-        .await
-        {
-            Ok(()) => info!("Successfully issued certificate!"),
-            Err(err) => {
-                error!("Failed to issue certificate: {err:?}");
-                std::process::exit(1);
+        .await;
+    }
+
+    if args.oneshot {
+        return run_id::scope(invocation_run_id(&args), async {
+            let budget = args.max_runtime.map(RunBudget::start);
+            let settings = if args.result_json {
+                let (result, settings) = oneshot_with_result(&args, budget).await;
+                println!("{}", serde_json::to_string(&result)?);
+                match settings {
+                    Some(settings) if result.error.is_none() => settings,
+                    _ => std::process::exit(1),
+                }
+            } else {
+                bootroot::acme::within_budget(budget, async {
+                    let (settings, final_eab) = load_settings_when_ca_ready(&args).await?;
+                    let settings = Arc::new(settings);
+                    match run_oneshot(
+                        Arc::clone(&settings),
+                        final_eab,
+                        args.config.clone(),
+                        args.insecure,
+                    )
+                    .await
+                    {
+                        Ok(()) => info!("Successfully issued certificate!"),
+                        Err(err) => {
+                            error!("Failed to issue certificate: {err:?}");
+                            std::process::exit(1);
+                        }
+                    }
+                    anyhow::Ok(settings)
+                })
+                .await?
+            };
+            if let Some(listen_addr) = &args.staple_test {
+                return run_staple_test(&settings, listen_addr, args.insecure).await;
             }
-        }
-        return Ok(());
+            anyhow::Ok(())
+        })
+        .await;
     }
 
+    // In daemon mode each renewal cycle gets its own run ID.
     let cli_overrides = CliOverrides::from(&args);
     // EAB source precedence is CLI `--eab-kid`/`--eab-hmac` (explicit) →
-    // `--eab-file` (`eab.json`) → agent.toml `[eab]`. Fast-poll EAB refresh is
-    // meaningful only for the `--eab-file` remote-bootstrap artifact: when both
-    // CLI values are set the operator has pinned EAB out of band, so refresh
-    // must be a no-op and never override them. `args` is fixed for the process
-    // lifetime, so this holds across HUP reloads too.
+    // `--eab-file` (`eab.json`) → agent.toml `[eab]`; `--eab-command` and
+    // `--eab-dir` exclude the other CLI sources and are re-read on every
+    // HUP reload. Fast-poll EAB refresh is meaningful only for the
+    // `--eab-file` remote-bootstrap artifact: when both CLI values are set
+    // the operator has pinned EAB out of band, so refresh must be a no-op
+    // and never override them. `args` is fixed for the process lifetime,
+    // so this holds across HUP reloads too.
     let eab_cli_pinned = args.eab_kid.is_some() && args.eab_hmac.is_some();
     let eab_refresh_path = if eab_cli_pinned {
         None
@@ -47,12 +235,14 @@ async fn main() -> anyhow::Result<()> {
         args.eab_file.clone()
     };
     let mut pending = None;
+    let mut control = DaemonControl::new().with_heartbeat(heartbeat);
     #[cfg(unix)]
     let mut hup = signal(SignalKind::hangup())?;
     loop {
         let (settings, final_eab) = match pending.take() {
             Some(value) => value,
-            None => load_settings(&args).await?,
+            // Only the first load: after a reload the CA already answered.
+            None => load_settings_when_ca_ready(&args).await?,
         };
         log_settings(&settings, final_eab.as_ref());
         let settings = Arc::new(settings);
@@ -63,7 +253,9 @@ async fn main() -> anyhow::Result<()> {
             args.config.clone(),
             args.insecure,
             cli_overrides.clone(),
+            control.clone(),
         ));
+        systemd::notify_ready();
         #[cfg(unix)]
         loop {
             tokio::select! {
@@ -71,10 +263,21 @@ async fn main() -> anyhow::Result<()> {
                 _ = hup.recv() => {
                     match load_settings(&args).await {
                         Ok((settings, final_eab)) => {
-                            info!("Reload signal received. Restarting daemon with new config.");
+                            // Stop gracefully rather than aborting so an
+                            // in-flight check finishes and releases its
+                            // profile lock before the reloaded daemon runs
+                            // its signal-triggered check.
+                            info!(
+                                "Reload signal received. Waiting for in-flight checks, \
+                                 then restarting daemon with new config."
+                            );
+                            systemd::notify_reloading();
+                            control.request_stop();
+                            if let Err(err) = handle_daemon_result(task.await) {
+                                error!("Daemon stopped with an error during reload: {err}");
+                            }
                             pending = Some((settings, final_eab));
-                            task.abort();
-                            let _ = task.await;
+                            control = control.for_signal_restart();
                             break;
                         }
                         Err(err) => {
@@ -91,19 +294,200 @@ async fn main() -> anyhow::Result<()> {
     }
 }
 
+/// Sets up logging as `tracing_subscriber::fmt::init` does, writing to
+/// standard error under `--result-json` so standard output carries only
+/// the result.
+fn init_logging(args: &Args) {
+    let builder = tracing_subscriber::fmt()
+        .with_env_filter(tracing_subscriber::EnvFilter::from_default_env());
+    if args.result_json {
+        builder.with_writer(std::io::stderr).init();
+    } else {
+        builder.init();
+    }
+}
+
+/// With `--max-runtime`, runs `run` under that deadline. On timeout the
+/// run is dropped and an error naming the step or issuance phase it
+/// stopped in is returned like any other failure.
+async fn within_max_runtime(
+    args: &Args,
+    run: impl Future<Output = anyhow::Result<()>>,
+) -> anyhow::Result<()> {
+    bootroot::acme::within_budget(args.max_runtime.map(RunBudget::start), run).await
+}
+
+/// Runs the `--oneshot --result-json` issuance within `budget` and
+/// returns its result, with the settings when they loaded. Failures
+/// before the issuance, such as running out of `--max-runtime` while
+/// waiting for the CA, are reported in the result with no profiles.
+async fn oneshot_with_result(
+    args: &Args,
+    budget: Option<RunBudget>,
+) -> (RunResult, Option<Arc<config::Settings>>) {
+    let loaded = bootroot::acme::within_budget(budget, async {
+        let (settings, final_eab) = load_settings_when_ca_ready(args).await?;
+        if settings.profiles.iter().any(|profile| {
+            profile
+                .outputs
+                .as_ref()
+                .is_some_and(|outputs| outputs.contains(&config::OutputSinkSettings::Stdout))
+        }) {
+            anyhow::bail!("--result-json cannot be combined with a stdout output sink");
+        }
+        Ok((settings, final_eab))
+    })
+    .await;
+    let (settings, final_eab) = match loaded {
+        Ok(loaded) => loaded,
+        Err(err) => return (RunResult::failed(&err), None),
+    };
+    let settings = Arc::new(settings);
+    let result = run_oneshot_with_result(
+        Arc::clone(&settings),
+        final_eab,
+        args.config.clone(),
+        budget,
+        args.insecure,
+    )
+    .await;
+    (result, Some(settings))
+}
+
+/// With `--wait-for-ca`, blocks until the CA's ACME directory answers,
+/// logging how long that took; fails once the timeout passes.
+///
+/// This runs before the root is pinned, so with `--trust-root-on-first-use`
+/// or `--fetch-root-from` the probe does not verify the CA's certificate:
+/// it only learns that the CA is up, and the pinning that follows checks
+/// the root against `--expected-fingerprint`.
+async fn wait_for_ca(args: &Args, settings: &config::Settings) -> anyhow::Result<()> {
+    let Some(timeout_secs) = args.wait_for_ca else {
+        return Ok(());
+    };
+    let pins_root = args.trust_root_on_first_use || args.fetch_root_from.is_some();
+    let waited = bootroot::acme::run_step(
+        "waiting for CA",
+        bootroot::acme::wait_for_ca(
+            settings,
+            args.insecure || pins_root,
+            std::time::Duration::from_secs(timeout_secs),
+        ),
+    )
+    .await?;
+    info!("CA is ready after waiting {:.1}s", waited.as_secs_f64());
+    Ok(())
+}
+
+/// Returns the run ID of a single-run invocation: `--run-id`, or a new
+/// UUID.
+fn invocation_run_id(args: &Args) -> String {
+    args.run_id.clone().unwrap_or_else(run_id::generate)
+}
+
 async fn load_settings(
     args: &Args,
 ) -> anyhow::Result<(config::Settings, Option<eab::EabCredentials>)> {
+    let settings = read_settings(args)?;
+    finish_settings(args, settings).await
+}
+
+/// Like [`load_settings`], but runs `--wait-for-ca` once the
+/// configuration is read and before the root is pinned, since pinning
+/// already contacts the CA.
+async fn load_settings_when_ca_ready(
+    args: &Args,
+) -> anyhow::Result<(config::Settings, Option<eab::EabCredentials>)> {
+    let settings = read_settings(args)?;
+    wait_for_ca(args, &settings).await?;
+    finish_settings(args, settings).await
+}
+
+fn read_settings(args: &Args) -> anyhow::Result<config::Settings> {
     let mut settings = config::Settings::new(args.config.clone())?;
     settings.merge_with_args(args);
-    settings.validate()?;
+    Ok(settings)
+}
 
-    let cli_eab = eab::load_credentials(
-        args.eab_kid.clone(),
-        args.eab_hmac.clone(),
-        args.eab_file.clone(),
-    )
-    .await?;
+/// Pins the root when asked to, validates `settings`, and resolves the
+/// EAB credentials.
+async fn finish_settings(
+    args: &Args,
+    mut settings: config::Settings,
+) -> anyhow::Result<(config::Settings, Option<eab::EabCredentials>)> {
+    let config_path = args
+        .config
+        .clone()
+        .unwrap_or_else(|| PathBuf::from(DEFAULT_AGENT_CONFIG_PATH));
+    if args.trust_root_on_first_use {
+        bootroot::acme::run_step(
+            "pinning the CA root",
+            trust_tofu::pin_root_on_first_use(
+                &mut settings,
+                &config_path,
+                args.expected_fingerprint.as_deref(),
+            ),
+        )
+        .await?;
+    }
+    if let Some(ca_url) = &args.fetch_root_from {
+        let fingerprint = args
+            .expected_fingerprint
+            .as_deref()
+            .ok_or_else(|| anyhow::anyhow!("--fetch-root-from requires --expected-fingerprint"))?;
+        bootroot::acme::run_step(
+            "pinning the CA root",
+            trust_tofu::pin_root_from_ca(&mut settings, &config_path, ca_url, fingerprint),
+        )
+        .await?;
+    }
+    if args.renew_dir.is_some()
+        || args.serve.is_some()
+        || args.import_account.is_some()
+        || args.test_eab
+        || args.print_acme_directory
+        || args.ssh_sign.is_some()
+    {
+        settings.validate_allowing_no_profiles()?;
+    } else {
+        settings.validate()?;
+    }
+    if settings.acme.allow_insecure_http
+        && reqwest::Url::parse(settings.server.trim()).is_ok_and(|url| url.scheme() == "http")
+    {
+        warn!(
+            "INSECURE: --insecure-http is set and the ACME directory {} is plaintext http://; \
+             account requests and issued certificates cross the network unencrypted. \
+             Use this only against a local test CA.",
+            settings.server
+        );
+    }
+    if settings.acme.purge_account_on_success {
+        warn!(
+            "--purge-account-on-success is set: the ACME account is deactivated after a \
+             successful issuance and cannot be used again, so the certificate can only be \
+             revoked with its own key."
+        );
+    }
+
+    let cli_eab = if let Some(command) = args.eab_command.as_deref() {
+        Some(
+            bootroot::acme::run_step(
+                "running --eab-command",
+                eab::load_credentials_from_command(command),
+            )
+            .await?,
+        )
+    } else if let Some(dir) = args.eab_dir.as_deref() {
+        Some(eab::load_credentials_from_dir(dir).await?)
+    } else {
+        // A systemd `eab` credential stands in for a missing `--eab-file`.
+        let eab_file = args
+            .eab_file
+            .clone()
+            .or_else(|| systemd::credential(systemd::EAB_CREDENTIAL));
+        eab::load_credentials(args.eab_kid.clone(), args.eab_hmac.clone(), eab_file).await?
+    };
     let final_eab = cli_eab.or_else(|| settings.eab.as_ref().map(profile::to_eab_credentials));
     Ok((settings, final_eab))
 }
@@ -151,22 +535,27 @@ mod tests {
             paths: config::Paths {
                 cert: cert_path,
                 key: PathBuf::from(TEST_KEY_PATH),
+                chain: None,
+                pin: None,
             },
             daemon: config::DaemonRuntimeSettings {
                 check_interval: Duration::from_hours(1),
                 renew_before: Duration::from_hours(16),
+                renew_before_pct: None,
                 check_jitter: Duration::from_secs(0),
+                escalate_before: Duration::from_hours(4),
+                exit_on_expired: false,
+                renew_on_revoked: false,
+                verify_dns_before_renew: false,
             },
-            retry: None,
-            hooks: config::HookSettings::default(),
-            eab: None,
-            cert_group_gid: None,
+            ..config::DaemonProfileSettings::default()
         }
     }
 
     fn build_settings(profiles: Vec<config::DaemonProfileSettings>) -> config::Settings {
         config::Settings {
             email: "test@example.com".to_string(),
+            contacts: Vec::new(),
             server: "https://example.com/acme/directory".to_string(),
             domain: "example.com".to_string(),
             eab: None,
@@ -176,10 +565,27 @@ mod tests {
                 directory_fetch_max_delay_secs: 10,
                 poll_attempts: 15,
                 poll_interval_secs: 2,
+                order_poll_interval_secs: None,
+                order_timeout_secs: None,
+                use_ari: false,
+                dns_resolver: None,
+                challenge: config::ChallengeKind::Http01,
+                provisioner: None,
+                allow_insecure_http: false,
+                url_rewrites: Vec::new(),
+                purge_account_on_success: false,
+                trace_http: config::HttpTrace::Off,
+                phase_timing: false,
+                check_sct: false,
+                require_eab: false,
+                require_tos: None,
+                account_key_path: None,
+                solver_command: None,
                 http_responder_url: "http://localhost:8080".to_string(),
                 http_responder_hmac: "dev-hmac".to_string(),
                 http_responder_timeout_secs: 5,
                 http_responder_token_ttl_secs: 300,
+                max_parallel_challenges: 1,
             },
             retry: config::RetrySettings {
                 backoff_secs: vec![1, 2, 3],
@@ -190,6 +596,10 @@ mod tests {
             },
             profiles,
             openbao: None,
+            status: config::StatusSettings::default(),
+            dns01: config::Dns01Settings::default(),
+            otel: config::OtelSettings::default(),
+            reload: config::ReloadSettings::default(),
         }
     }
 
@@ -198,6 +608,7 @@ mod tests {
         let profile_eab = config::Eab {
             kid: "profile".to_string(),
             hmac: "profile-hmac".to_string(),
+            provisioner: None,
         };
         let profile = config::DaemonProfileSettings {
             eab: Some(profile_eab),
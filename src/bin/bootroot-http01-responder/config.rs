@@ -21,6 +21,9 @@ pub(super) const DEFAULT_MAX_SKEW_SECS: u64 = 60;
 pub(super) const DEFAULT_ADMIN_RATE_LIMIT_REQUESTS: u64 = 300;
 pub(super) const DEFAULT_ADMIN_RATE_LIMIT_WINDOW_SECS: u64 = 60;
 pub(super) const DEFAULT_ADMIN_BODY_LIMIT_BYTES: u64 = 8 * 1024;
+pub(super) const DEFAULT_CHALLENGE_PATH_PREFIX: &str = "/.well-known/acme-challenge";
+/// Segments the CA always requests; a prefix must end with them.
+const ACME_CHALLENGE_SEGMENTS: [&str; 2] = [".well-known", "acme-challenge"];
 
 #[derive(Parser, Debug)]
 #[command(author, version, about = "Bootroot HTTP-01 responder")]
@@ -42,6 +45,25 @@ pub(super) struct ResponderSettings {
     pub(super) admin_rate_limit_requests: u64,
     pub(super) admin_rate_limit_window_secs: u64,
     pub(super) admin_body_limit_bytes: u64,
+    /// Path under which challenge responses are served, for a reverse
+    /// proxy that forwards only the ACME path to an internal port and
+    /// adds a prefix on the way. For example, with
+    /// `challenge_path_prefix = "/bootroot/.well-known/acme-challenge"`
+    /// and the responder on `listen_addr = "127.0.0.1:8000"`, nginx
+    /// forwards just the challenge path:
+    ///
+    /// ```nginx
+    /// server {
+    ///     listen 80;
+    ///     location ^~ /.well-known/acme-challenge/ {
+    ///         proxy_pass http://127.0.0.1:8000/bootroot/.well-known/acme-challenge/;
+    ///     }
+    ///     location / {
+    ///         return 301 https://$host$request_uri;
+    ///     }
+    /// }
+    /// ```
+    pub(super) challenge_path_prefix: String,
     #[serde(default)]
     pub(super) tls_cert_path: Option<String>,
     #[serde(default)]
@@ -69,6 +91,7 @@ impl ResponderSettings {
                 DEFAULT_ADMIN_RATE_LIMIT_WINDOW_SECS,
             )?
             .set_default("admin_body_limit_bytes", DEFAULT_ADMIN_BODY_LIMIT_BYTES)?
+            .set_default("challenge_path_prefix", DEFAULT_CHALLENGE_PATH_PREFIX)?
             .add_source(File::from(path).required(false))
             .add_source(
                 Environment::with_prefix("BOOTROOT_RESPONDER")
@@ -116,6 +139,7 @@ impl ResponderSettings {
         }
         validate_socket_addr(&self.listen_addr, "listen_addr")?;
         validate_socket_addr(&self.admin_addr, "admin_addr")?;
+        validate_challenge_path_prefix(&self.challenge_path_prefix)?;
         match (&self.tls_cert_path, &self.tls_key_path) {
             (Some(cert), Some(key)) => {
                 if cert.trim().is_empty() {
@@ -136,6 +160,15 @@ impl ResponderSettings {
         Ok(())
     }
 
+    /// Returns the route of the challenge endpoint, the prefix followed by
+    /// the `:token` parameter.
+    pub(super) fn challenge_route(&self) -> String {
+        format!(
+            "{}/:token",
+            self.challenge_path_prefix.trim_end_matches('/')
+        )
+    }
+
     pub(super) fn tls_enabled(&self) -> bool {
         self.tls_cert_path.is_some() && self.tls_key_path.is_some()
     }
@@ -156,7 +189,8 @@ pub(super) fn load_settings(config_path: Option<&Path>) -> Result<ResponderSetti
 /// Rejects transport-mode changes (plain HTTP ↔ TLS) because the
 /// listener mode is fixed at startup.  A mode flip requires a process
 /// restart; accepting it silently would leave the running listener out
-/// of sync with the in-memory settings.
+/// of sync with the in-memory settings.  `challenge_path_prefix` is
+/// routed at startup too and is rejected the same way.
 pub(super) async fn reload_settings(
     state: &ResponderState,
     config_path: Option<&Path>,
@@ -172,10 +206,40 @@ pub(super) async fn reload_settings(
             if new_tls { "enabled" } else { "disabled" },
         );
     }
+    let current_route = state.settings().await.challenge_route();
+    if current_route != new_settings.challenge_route() {
+        anyhow::bail!(
+            "challenge_path_prefix change requires a process restart; keeping current settings"
+        );
+    }
     state.update_settings(new_settings).await;
     Ok(())
 }
 
+/// Requires an absolute path, free of route syntax and empty or dot
+/// segments, that ends in `/.well-known/acme-challenge`: the CA always
+/// requests that path, so a proxy can only prepend to it.
+fn validate_challenge_path_prefix(prefix: &str) -> Result<()> {
+    let Some(path) = prefix.strip_prefix('/') else {
+        anyhow::bail!("challenge_path_prefix must start with '/': {prefix}");
+    };
+    let segments: Vec<&str> = path.trim_end_matches('/').split('/').collect();
+    if segments
+        .iter()
+        .any(|segment| segment.is_empty() || matches!(*segment, "." | ".."))
+        || prefix.contains([':', '*', '{', '}', '?', '#'])
+    {
+        anyhow::bail!("challenge_path_prefix is not a plain URL path: {prefix}");
+    }
+    if !segments.ends_with(&ACME_CHALLENGE_SEGMENTS) {
+        anyhow::bail!(
+            "challenge_path_prefix must end with /.well-known/acme-challenge, \
+             the path the CA requests: {prefix}"
+        );
+    }
+    Ok(())
+}
+
 fn validate_socket_addr(value: &str, field_name: &str) -> Result<()> {
     value
         .parse::<SocketAddr>()
@@ -199,6 +263,7 @@ mod tests {
             admin_rate_limit_requests: DEFAULT_ADMIN_RATE_LIMIT_REQUESTS,
             admin_rate_limit_window_secs: DEFAULT_ADMIN_RATE_LIMIT_WINDOW_SECS,
             admin_body_limit_bytes: DEFAULT_ADMIN_BODY_LIMIT_BYTES,
+            challenge_path_prefix: DEFAULT_CHALLENGE_PATH_PREFIX.to_string(),
             tls_cert_path: None,
             tls_key_path: None,
         }
@@ -281,6 +346,61 @@ mod tests {
         assert!(err.to_string().contains("tls_cert_path"));
     }
 
+    #[test]
+    fn test_validate_challenge_path_prefix_needs_acme_challenge_segment() {
+        let mut settings = test_settings();
+        assert_eq!(
+            settings.challenge_route(),
+            "/.well-known/acme-challenge/:token"
+        );
+
+        settings.challenge_path_prefix = "/bootroot/.well-known/acme-challenge/".to_string();
+        settings
+            .validate()
+            .expect("prefixed ACME path must be accepted");
+        assert_eq!(
+            settings.challenge_route(),
+            "/bootroot/.well-known/acme-challenge/:token"
+        );
+
+        for prefix in [
+            "/bootroot",
+            "bootroot/.well-known/acme-challenge",
+            "/.well-known/acme-challenge/extra",
+            "/bootroot//.well-known/acme-challenge",
+            "/:id/.well-known/acme-challenge",
+        ] {
+            settings.challenge_path_prefix = prefix.to_string();
+            let err = settings
+                .validate()
+                .expect_err("invalid challenge path prefix must be rejected");
+            assert!(
+                err.to_string().contains("challenge_path_prefix"),
+                "{prefix}"
+            );
+        }
+    }
+
+    #[tokio::test]
+    async fn test_reload_rejects_challenge_path_prefix_change() {
+        let state = super::super::state::ResponderState::shared(test_settings());
+        let dir = tempfile::tempdir().unwrap();
+        let config_path = dir.path().join("responder.toml");
+        std::fs::write(
+            &config_path,
+            "\
+hmac_secret = \"test-secret\"
+challenge_path_prefix = \"/bootroot/.well-known/acme-challenge\"
+",
+        )
+        .unwrap();
+
+        let err = reload_settings(&state, Some(&config_path))
+            .await
+            .expect_err("prefix change at runtime must be rejected");
+        assert!(err.to_string().contains("challenge_path_prefix"), "{err}");
+    }
+
     #[test]
     fn test_tls_enabled_returns_false_by_default() {
         let settings = test_settings();
@@ -42,11 +42,12 @@ pub(super) async fn run(args: Args) -> Result<()> {
         None
     };
 
+    let challenge_route = settings.challenge_route();
     let state = ResponderState::shared(settings);
 
     tokio::spawn(cleanup_expired_tokens(Arc::clone(&state)));
 
-    info!("Starting HTTP-01 responder on {listen_addr}");
+    info!("Starting HTTP-01 responder on {listen_addr} at {challenge_route}");
     if tls.is_some() {
         info!("Starting HTTP-01 admin API on {admin_addr} (TLS)");
     } else {
@@ -54,7 +55,8 @@ pub(super) async fn run(args: Args) -> Result<()> {
     }
 
     let mut challenge = tokio::spawn(
-        Server::new(TcpListener::bind(listen_addr)).run(challenge_app(Arc::clone(&state))),
+        Server::new(TcpListener::bind(listen_addr))
+            .run(challenge_app(Arc::clone(&state), &challenge_route)),
     );
 
     let cert_resolver = tls.as_ref().map(|(r, _)| Arc::clone(r));
@@ -81,12 +83,9 @@ pub(super) async fn run(args: Args) -> Result<()> {
     .await
 }
 
-fn challenge_app(state: Arc<ResponderState>) -> impl Endpoint {
+fn challenge_app(state: Arc<ResponderState>, route: &str) -> impl Endpoint {
     Route::new()
-        .at(
-            "/.well-known/acme-challenge/:token",
-            poem::get(http01_challenge),
-        )
+        .at(route, poem::get(http01_challenge))
         .data(state)
 }
 
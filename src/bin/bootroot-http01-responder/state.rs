@@ -206,8 +206,9 @@ mod tests {
     use super::*;
     use crate::config::{
         DEFAULT_ADMIN_ADDR, DEFAULT_ADMIN_BODY_LIMIT_BYTES, DEFAULT_ADMIN_RATE_LIMIT_REQUESTS,
-        DEFAULT_ADMIN_RATE_LIMIT_WINDOW_SECS, DEFAULT_CLEANUP_INTERVAL_SECS, DEFAULT_LISTEN_ADDR,
-        DEFAULT_MAX_SKEW_SECS, DEFAULT_MAX_TOKEN_TTL_SECS, DEFAULT_TOKEN_TTL_SECS,
+        DEFAULT_ADMIN_RATE_LIMIT_WINDOW_SECS, DEFAULT_CHALLENGE_PATH_PREFIX,
+        DEFAULT_CLEANUP_INTERVAL_SECS, DEFAULT_LISTEN_ADDR, DEFAULT_MAX_SKEW_SECS,
+        DEFAULT_MAX_TOKEN_TTL_SECS, DEFAULT_TOKEN_TTL_SECS,
     };
 
     fn test_settings() -> ResponderSettings {
@@ -222,6 +223,7 @@ mod tests {
             admin_rate_limit_requests: DEFAULT_ADMIN_RATE_LIMIT_REQUESTS,
             admin_rate_limit_window_secs: DEFAULT_ADMIN_RATE_LIMIT_WINDOW_SECS,
             admin_body_limit_bytes: DEFAULT_ADMIN_BODY_LIMIT_BYTES,
+            challenge_path_prefix: DEFAULT_CHALLENGE_PATH_PREFIX.to_string(),
             tls_cert_path: None,
             tls_key_path: None,
         }
@@ -36,7 +36,9 @@ fn service_name_error(err: ValidationError, lang: Locale) -> anyhow::Error {
         | ValidationError::InvalidDomainName
         | ValidationError::InvalidCidr
         | ValidationError::CidrClearConflict
-        | ValidationError::NonNumeric => anyhow::anyhow!(
+        | ValidationError::NonNumeric
+        | ValidationError::InvalidEmail
+        | ValidationError::InvalidContact => anyhow::anyhow!(
             "{}",
             localized(
                 lang,
@@ -61,7 +63,9 @@ fn profile_hostname_error(err: ValidationError, lang: Locale) -> anyhow::Error {
         | ValidationError::InvalidDomainName
         | ValidationError::InvalidCidr
         | ValidationError::CidrClearConflict
-        | ValidationError::NonNumeric => anyhow::anyhow!(
+        | ValidationError::NonNumeric
+        | ValidationError::InvalidEmail
+        | ValidationError::InvalidContact => anyhow::anyhow!(
             "{}",
             localized(
                 lang,
@@ -86,7 +90,9 @@ fn agent_domain_error(err: ValidationError, lang: Locale) -> anyhow::Error {
         | ValidationError::InvalidDomainName
         | ValidationError::InvalidCidr
         | ValidationError::CidrClearConflict
-        | ValidationError::NonNumeric => anyhow::anyhow!(
+        | ValidationError::NonNumeric
+        | ValidationError::InvalidEmail
+        | ValidationError::InvalidContact => anyhow::anyhow!(
             "{}",
             localized(
                 lang,
@@ -104,7 +110,9 @@ fn profile_instance_id_error(err: ValidationError, lang: Locale) -> anyhow::Erro
         | ValidationError::InvalidDomainName
         | ValidationError::InvalidCidr
         | ValidationError::CidrClearConflict
-        | ValidationError::NonNumeric => anyhow::anyhow!(
+        | ValidationError::NonNumeric
+        | ValidationError::InvalidEmail
+        | ValidationError::InvalidContact => anyhow::anyhow!(
             "{}",
             localized(
                 lang,
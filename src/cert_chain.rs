@@ -16,7 +16,11 @@
 //! candidate CA's public key, instead of by name, is the discriminator
 //! that catches the rotation.
 
+use std::fmt;
+
 use anyhow::{Context, Result};
+use base64::Engine as _;
+use base64::engine::general_purpose::STANDARD;
 use x509_parser::certificate::X509Certificate;
 use x509_parser::pem::Pem;
 
@@ -78,6 +82,217 @@ pub fn leaf_chains_to_bundle(leaf_pem: &[u8], bundle_pem: &[u8]) -> Result<bool>
     Ok(false)
 }
 
+/// Returns the DER of the self-signed certificate in `bundle_pem` that
+/// issued `cert_der`, or `Ok(None)` when the bundle holds no such root.
+///
+/// # Errors
+/// Returns an error if `cert_der` or the bundle cannot be parsed.
+pub fn find_issuing_root(cert_der: &[u8], bundle_pem: &[u8]) -> Result<Option<Vec<u8>>> {
+    let (_, cert) = x509_parser::parse_x509_certificate(cert_der)
+        .map_err(|e| anyhow::anyhow!("Failed to parse X509: {e}"))?;
+    for pem in parse_bundle_pems(bundle_pem)? {
+        let (_, candidate) = x509_parser::parse_x509_certificate(&pem.contents)
+            .map_err(|e| anyhow::anyhow!("Failed to parse CA X509 in bundle: {e}"))?;
+        if is_self_signed(&candidate) && issued_by(&cert, &candidate) {
+            return Ok(Some(pem.contents.clone()));
+        }
+    }
+    Ok(None)
+}
+
+/// Returns the DER of the first CA certificate in `pem` that issued
+/// `cert_der`, root or intermediate, or `Ok(None)` when there is none.
+///
+/// # Errors
+/// Returns an error if `cert_der` or any PEM block cannot be parsed.
+pub fn find_issuer(cert_der: &[u8], pem: &[u8]) -> Result<Option<Vec<u8>>> {
+    let (_, cert) = x509_parser::parse_x509_certificate(cert_der)
+        .map_err(|e| anyhow::anyhow!("Failed to parse X509: {e}"))?;
+    for block in parse_bundle_pems(pem)? {
+        let (_, candidate) = x509_parser::parse_x509_certificate(&block.contents)
+            .map_err(|e| anyhow::anyhow!("Failed to parse CA X509: {e}"))?;
+        if issued_by(&cert, &candidate) {
+            return Ok(Some(block.contents.clone()));
+        }
+    }
+    Ok(None)
+}
+
+/// Returns `Ok(true)` when `chain_pem` is an ordered chain in which
+/// every certificate is issued by the one after it and the last one is
+/// a self-signed root.
+///
+/// # Errors
+/// Returns an error if any PEM block cannot be parsed.
+pub fn chain_ends_in_root(chain_pem: &[u8]) -> Result<bool> {
+    let pems = parse_bundle_pems(chain_pem)?;
+    let mut certs = Vec::with_capacity(pems.len());
+    for pem in &pems {
+        let (_, cert) = x509_parser::parse_x509_certificate(&pem.contents)
+            .map_err(|e| anyhow::anyhow!("Failed to parse X509 in chain: {e}"))?;
+        certs.push(cert);
+    }
+    let Some(last) = certs.last() else {
+        return Ok(false);
+    };
+    if !is_self_signed(last) {
+        return Ok(false);
+    }
+    Ok(certs
+        .iter()
+        .zip(certs.iter().skip(1))
+        .all(|(child, ca)| issued_by(child, ca)))
+}
+
+/// Returns `Ok(true)` when every certificate in `chain_pem` is issued
+/// by the one after it. Unlike [`chain_ends_in_root`] the chain may stop
+/// at an intermediate; a single certificate counts as ordered.
+///
+/// # Errors
+/// Returns an error if any PEM block cannot be parsed.
+pub fn chain_is_ordered(chain_pem: &[u8]) -> Result<bool> {
+    let pems = parse_bundle_pems(chain_pem)?;
+    let mut certs = Vec::with_capacity(pems.len());
+    for pem in &pems {
+        let (_, cert) = x509_parser::parse_x509_certificate(&pem.contents)
+            .map_err(|e| anyhow::anyhow!("Failed to parse X509 in chain: {e}"))?;
+        certs.push(cert);
+    }
+    Ok(certs
+        .iter()
+        .zip(certs.iter().skip(1))
+        .all(|(child, ca)| issued_by(child, ca)))
+}
+
+/// One certificate of a file inspected by [`inspect_chain`].
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ChainEntry {
+    pub subject: String,
+    pub issuer: String,
+    pub not_before: String,
+    pub not_after: String,
+    pub self_signed: bool,
+    /// Whether the certificate on the root side of this one issued it:
+    /// the next one in the file, or the previous one when the file lists
+    /// the leaf last. `None` for the certificate at the root end.
+    pub issued_by_parent: Option<bool>,
+}
+
+/// Per-certificate breakdown of a certificate file, in file order.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ChainReport {
+    pub entries: Vec<ChainEntry>,
+    /// Whether the file lists the chain first and the leaf last, as
+    /// `bundle_order = "chain-leaf"` writes it.
+    pub leaf_last: bool,
+}
+
+impl ChainReport {
+    /// Returns `true` when the file holds at least one certificate and
+    /// each one is issued by its neighbour on the root side.
+    #[must_use]
+    pub fn is_linked(&self) -> bool {
+        !self.entries.is_empty()
+            && self
+                .entries
+                .iter()
+                .all(|entry| entry.issued_by_parent != Some(false))
+    }
+
+    /// Returns `true` when the certificate at the root end is a
+    /// self-signed root.
+    #[must_use]
+    pub fn ends_in_root(&self) -> bool {
+        let root_end = if self.leaf_last {
+            self.entries.first()
+        } else {
+            self.entries.last()
+        };
+        root_end.is_some_and(|entry| entry.self_signed)
+    }
+}
+
+impl fmt::Display for ChainReport {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let yes_no = |value: bool| if value { "yes" } else { "no" };
+        for (index, entry) in self.entries.iter().enumerate() {
+            writeln!(f, "[{index}] subject: {}", entry.subject)?;
+            writeln!(f, "    issuer:  {}", entry.issuer)?;
+            writeln!(
+                f,
+                "    valid:   {} to {}",
+                entry.not_before, entry.not_after
+            )?;
+            if let Some(linked) = entry.issued_by_parent {
+                let parent = if self.leaf_last { index - 1 } else { index + 1 };
+                writeln!(f, "    issued by [{parent}]: {}", yes_no(linked))?;
+            }
+        }
+        let order = if self.leaf_last {
+            "leaf last (chain-leaf)"
+        } else {
+            "leaf first"
+        };
+        writeln!(f, "order: {order}")?;
+        writeln!(f, "chain depth: {}", self.entries.len())?;
+        writeln!(f, "linked: {}", yes_no(self.is_linked()))?;
+        writeln!(
+            f,
+            "terminates in self-signed root: {}",
+            yes_no(self.ends_in_root())
+        )
+    }
+}
+
+/// Describes every certificate in `bytes`, a PEM bundle or a single DER
+/// certificate, in file order, and whether each links to its issuer.
+/// Unlike [`cert_file_pem`] the file order is kept as-is. A file counts
+/// as leaf-last, the `chain-leaf` layout, only when it does not link
+/// leaf first but every certificate is issued by the one before it, so
+/// any other misordered bundle shows up as a broken link.
+///
+/// # Errors
+/// Returns an error if a PEM block or certificate cannot be parsed.
+pub fn inspect_chain(bytes: &[u8]) -> Result<ChainReport> {
+    let ders: Vec<Vec<u8>> = if bytes.trim_ascii_start().starts_with(b"-----BEGIN") {
+        parse_bundle_pems(bytes)?
+            .into_iter()
+            .map(|pem| pem.contents)
+            .collect()
+    } else {
+        vec![bytes.to_vec()]
+    };
+    let mut certs = Vec::with_capacity(ders.len());
+    for der in &ders {
+        let (_, cert) = x509_parser::parse_x509_certificate(der)
+            .map_err(|e| anyhow::anyhow!("Failed to parse X509 in chain: {e}"))?;
+        certs.push(cert);
+    }
+    let pairs = || certs.iter().zip(certs.iter().skip(1));
+    let leaf_last = !pairs().all(|(child, ca)| issued_by(child, ca))
+        && pairs().all(|(ca, child)| issued_by(child, ca));
+    let entries = certs
+        .iter()
+        .enumerate()
+        .map(|(index, cert)| {
+            let parent = if leaf_last {
+                index.checked_sub(1).and_then(|parent| certs.get(parent))
+            } else {
+                certs.get(index + 1)
+            };
+            ChainEntry {
+                subject: cert.subject().to_string(),
+                issuer: cert.issuer().to_string(),
+                not_before: cert.validity().not_before.to_string(),
+                not_after: cert.validity().not_after.to_string(),
+                self_signed: is_self_signed(cert),
+                issued_by_parent: parent.map(|ca| issued_by(cert, ca)),
+            }
+        })
+        .collect();
+    Ok(ChainReport { entries, leaf_last })
+}
+
 fn issued_by(child: &X509Certificate<'_>, ca: &X509Certificate<'_>) -> bool {
     if !is_ca_capable(ca) {
         return false;
@@ -110,6 +325,56 @@ fn is_ca_capable(cert: &X509Certificate<'_>) -> bool {
     }
 }
 
+/// Encodes one DER certificate as a PEM `CERTIFICATE` block.
+pub(crate) fn encode_cert_pem(der: &[u8]) -> String {
+    const LINE_WRAP: usize = 64;
+    let b64 = STANDARD.encode(der);
+    let mut out = String::from("-----BEGIN CERTIFICATE-----\n");
+    let mut index = 0;
+    while index < b64.len() {
+        let end = (index + LINE_WRAP).min(b64.len());
+        out.push_str(&b64[index..end]);
+        out.push('\n');
+        index = end;
+    }
+    out.push_str("-----END CERTIFICATE-----\n");
+    out
+}
+
+/// Returns the contents of a certificate file as PEM with the leaf
+/// first. Files written with `format = "der"` hold a bare DER leaf and
+/// are re-encoded; bundles written with `bundle_order = "chain-leaf"`
+/// are turned back to leaf-first order. Other PEM files are returned
+/// unchanged.
+pub fn cert_file_pem(bytes: Vec<u8>) -> Vec<u8> {
+    if bytes.trim_ascii_start().starts_with(b"-----BEGIN") {
+        leaf_last_reversed(&bytes).unwrap_or(bytes)
+    } else {
+        encode_cert_pem(&bytes).into_bytes()
+    }
+}
+
+/// Returns `pem` reversed when it starts with a CA certificate and ends
+/// with a non-CA one, i.e. holds a leaf-last bundle.
+fn leaf_last_reversed(pem: &[u8]) -> Option<Vec<u8>> {
+    let pems = parse_bundle_pems(pem).ok()?;
+    let (first, last) = match pems.as_slice() {
+        [first, .., last] => (first, last),
+        _ => return None,
+    };
+    let (_, first_cert) = x509_parser::parse_x509_certificate(&first.contents).ok()?;
+    let (_, last_cert) = x509_parser::parse_x509_certificate(&last.contents).ok()?;
+    if !is_ca_capable(&first_cert) || is_ca_capable(&last_cert) {
+        return None;
+    }
+    let reversed: String = pems
+        .iter()
+        .rev()
+        .map(|pem| encode_cert_pem(&pem.contents))
+        .collect();
+    Some(reversed.into_bytes())
+}
+
 fn parse_bundle_pems(bundle_pem: &[u8]) -> Result<Vec<Pem>> {
     let mut pems = Vec::new();
     for pem in Pem::iter_from_buffer(bundle_pem) {
@@ -236,6 +501,88 @@ mod tests {
         assert!(ok);
     }
 
+    #[test]
+    fn find_issuing_root_returns_root_for_intermediate() {
+        let ca = build_ca("gen1");
+
+        let root = find_issuing_root(ca.intermediate_cert.der(), bundle(&ca).as_bytes()).unwrap();
+
+        assert_eq!(root.as_deref(), Some(ca.root_cert.der().as_ref()));
+    }
+
+    #[test]
+    fn find_issuing_root_returns_none_for_foreign_bundle() {
+        let ca = build_ca("gen1");
+        let other = build_ca("gen2");
+
+        let root =
+            find_issuing_root(ca.intermediate_cert.der(), bundle(&other).as_bytes()).unwrap();
+
+        assert!(root.is_none());
+    }
+
+    #[test]
+    fn find_issuer_returns_intermediate_for_leaf() {
+        let ca = build_ca("gen1");
+        let leaf = sign_leaf("svc.example", &ca);
+        let (_, leaf_pem) = x509_parser::pem::parse_x509_pem(leaf.as_bytes()).unwrap();
+
+        let issuer = find_issuer(&leaf_pem.contents, bundle(&ca).as_bytes()).unwrap();
+
+        assert_eq!(issuer.as_deref(), Some(ca.intermediate_cert.der().as_ref()));
+    }
+
+    #[test]
+    fn chain_ends_in_root_accepts_ordered_chain() {
+        let ca = build_ca("gen1");
+        let chain = format!(
+            "{}{}{}",
+            sign_leaf("svc.example", &ca),
+            ca.intermediate_cert.pem(),
+            ca.root_cert.pem()
+        );
+
+        assert!(chain_ends_in_root(chain.as_bytes()).unwrap());
+    }
+
+    #[test]
+    fn chain_ends_in_root_rejects_missing_intermediate() {
+        let ca = build_ca("gen1");
+        let chain = format!("{}{}", sign_leaf("svc.example", &ca), ca.root_cert.pem());
+
+        assert!(!chain_ends_in_root(chain.as_bytes()).unwrap());
+    }
+
+    #[test]
+    fn chain_ends_in_root_rejects_chain_without_root() {
+        let ca = build_ca("gen1");
+        let chain = format!(
+            "{}{}",
+            sign_leaf("svc.example", &ca),
+            ca.intermediate_cert.pem()
+        );
+
+        assert!(!chain_ends_in_root(chain.as_bytes()).unwrap());
+    }
+
+    #[test]
+    fn chain_is_ordered_accepts_chain_without_root() {
+        let ca = build_ca("gen1");
+        let ordered = format!(
+            "{}{}",
+            sign_leaf("svc.example", &ca),
+            ca.intermediate_cert.pem()
+        );
+        let reversed = format!(
+            "{}{}",
+            ca.intermediate_cert.pem(),
+            sign_leaf("svc.example", &ca)
+        );
+
+        assert!(chain_is_ordered(ordered.as_bytes()).unwrap());
+        assert!(!chain_is_ordered(reversed.as_bytes()).unwrap());
+    }
+
     #[test]
     fn invalid_leaf_pem_errors() {
         let ca = build_ca("gen1");
@@ -320,4 +667,111 @@ mod tests {
             "non-CA bundle entry must not be accepted as a trust anchor"
         );
     }
+
+    #[test]
+    fn cert_file_pem_reencodes_der_and_keeps_pem() {
+        let key = KeyPair::generate().unwrap();
+        let cert = CertificateParams::new(vec!["leaf.example".to_string()])
+            .unwrap()
+            .self_signed(&key)
+            .unwrap();
+
+        let from_der = cert_file_pem(cert.der().to_vec());
+        let pem = Pem::iter_from_buffer(&from_der).next().unwrap().unwrap();
+        assert_eq!(pem.contents, cert.der().to_vec());
+        assert_eq!(
+            cert_file_pem(cert.pem().into_bytes()),
+            cert.pem().into_bytes()
+        );
+    }
+
+    #[test]
+    fn cert_file_pem_puts_leaf_of_chain_leaf_bundle_first() {
+        let ca = build_ca("gen1");
+        let leaf = sign_leaf("svc.example", &ca);
+        let leaf_first = format!("{leaf}{}", ca.intermediate_cert.pem());
+        let leaf_last = format!("{}{leaf}", ca.intermediate_cert.pem());
+
+        let normalized = cert_file_pem(leaf_last.into_bytes());
+
+        assert!(chain_is_ordered(&normalized).unwrap());
+        assert_eq!(
+            parse_bundle_pems(&normalized).unwrap()[0].contents,
+            parse_bundle_pems(leaf.as_bytes()).unwrap()[0].contents
+        );
+        assert_eq!(
+            cert_file_pem(leaf_first.clone().into_bytes()),
+            leaf_first.into_bytes()
+        );
+    }
+
+    #[test]
+    fn inspect_chain_reports_linked_chain_to_root() {
+        let ca = build_ca("gen1");
+        let chain = format!(
+            "{}{}{}",
+            sign_leaf("svc.example", &ca),
+            ca.intermediate_cert.pem(),
+            ca.root_cert.pem()
+        );
+
+        let report = inspect_chain(chain.as_bytes()).unwrap();
+
+        assert_eq!(report.entries.len(), 3);
+        assert_eq!(report.entries[0].subject, "CN=svc.example");
+        assert_eq!(report.entries[0].issuer, "CN=gen1-intermediate");
+        assert_eq!(report.entries[1].issued_by_parent, Some(true));
+        assert_eq!(report.entries[2].issued_by_parent, None);
+        assert!(!report.leaf_last);
+        assert!(report.is_linked());
+        assert!(report.ends_in_root());
+        let text = report.to_string();
+        assert!(text.contains("chain depth: 3"), "{text}");
+        assert!(
+            text.contains("terminates in self-signed root: yes"),
+            "{text}"
+        );
+    }
+
+    #[test]
+    fn inspect_chain_accepts_chain_leaf_bundle() {
+        let ca = build_ca("gen1");
+        let chain = format!(
+            "{}{}{}",
+            ca.root_cert.pem(),
+            ca.intermediate_cert.pem(),
+            sign_leaf("svc.example", &ca)
+        );
+
+        let report = inspect_chain(chain.as_bytes()).unwrap();
+
+        assert!(report.leaf_last);
+        assert_eq!(report.entries[0].issued_by_parent, None);
+        assert_eq!(report.entries[2].issued_by_parent, Some(true));
+        assert!(report.is_linked());
+        assert!(report.ends_in_root());
+        let text = report.to_string();
+        assert!(text.contains("[2] subject: CN=svc.example"), "{text}");
+        assert!(text.contains("issued by [1]: yes"), "{text}");
+        assert!(text.contains("order: leaf last"), "{text}");
+    }
+
+    #[test]
+    fn inspect_chain_flags_misordered_bundle() {
+        let ca = build_ca("gen1");
+        let chain = format!(
+            "{}{}{}",
+            ca.intermediate_cert.pem(),
+            sign_leaf("svc.example", &ca),
+            ca.root_cert.pem()
+        );
+
+        let report = inspect_chain(chain.as_bytes()).unwrap();
+
+        assert!(!report.leaf_last);
+        assert_eq!(report.entries[0].issued_by_parent, Some(false));
+        assert!(!report.is_linked());
+        assert!(report.to_string().contains("linked: no"));
+        assert!(inspect_chain(b"").is_err());
+    }
 }
@@ -0,0 +1,152 @@
+//! Standalone certificate expiry check for monitoring.
+//!
+//! `bootroot-agent --check-expiry <FILE>` reads a certificate file,
+//! compares its remaining lifetime against `--min-remaining`, prints one
+//! status line, and exits with the monitoring-plugin convention: `0`
+//! when healthy, `1` when less than the minimum remains, and `2` when the
+//! certificate has expired or cannot be read. It never contacts the CA,
+//! so it works as a Nagios check or behind a Prometheus textfile script.
+
+use std::fmt;
+use std::path::Path;
+use std::time::{Duration, SystemTime};
+
+use crate::cert_chain;
+use crate::daemon::parse_cert_not_after;
+
+/// Outcome of [`check_expiry`].
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ExpiryStatus {
+    Ok,
+    /// Valid, but with less than the minimum lifetime left.
+    BelowThreshold,
+    Expired,
+    /// The file is missing or holds no parsable certificate.
+    Unreadable,
+}
+
+impl ExpiryStatus {
+    /// Returns the process exit code for this status.
+    #[must_use]
+    pub fn exit_code(self) -> i32 {
+        match self {
+            Self::Ok => 0,
+            Self::BelowThreshold => 1,
+            Self::Expired | Self::Unreadable => 2,
+        }
+    }
+}
+
+/// Result of checking one certificate file; displays as the status line.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ExpiryReport {
+    pub status: ExpiryStatus,
+    pub detail: String,
+}
+
+impl fmt::Display for ExpiryReport {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let label = match self.status {
+            ExpiryStatus::Ok => "OK",
+            ExpiryStatus::BelowThreshold => "WARNING",
+            ExpiryStatus::Expired | ExpiryStatus::Unreadable => "CRITICAL",
+        };
+        write!(f, "{label}: {}", self.detail)
+    }
+}
+
+/// Checks the leaf of the certificate file at `path` (PEM or DER) at
+/// `now` against `min_remaining`.
+#[must_use]
+pub fn check_expiry(path: &Path, min_remaining: Duration, now: SystemTime) -> ExpiryReport {
+    let not_after = std::fs::read(path)
+        .map_err(anyhow::Error::from)
+        .and_then(|bytes| parse_cert_not_after(&cert_chain::cert_file_pem(bytes)));
+    let not_after = match not_after {
+        Ok(not_after) => SystemTime::from(not_after),
+        Err(err) => {
+            return ExpiryReport {
+                status: ExpiryStatus::Unreadable,
+                detail: format!("cannot read certificate {}: {err:#}", path.display()),
+            };
+        }
+    };
+    let expires = humantime::format_rfc3339_seconds(not_after);
+    let Ok(remaining) = not_after.duration_since(now) else {
+        return ExpiryReport {
+            status: ExpiryStatus::Expired,
+            detail: format!("{} expired at {expires}", path.display()),
+        };
+    };
+    let remaining = Duration::from_secs(remaining.as_secs());
+    let status = if remaining < min_remaining {
+        ExpiryStatus::BelowThreshold
+    } else {
+        ExpiryStatus::Ok
+    };
+    ExpiryReport {
+        status,
+        detail: format!(
+            "{} expires in {} at {expires}",
+            path.display(),
+            humantime::format_duration(remaining)
+        ),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const DAY: Duration = Duration::from_secs(24 * 60 * 60);
+
+    fn write_cert(dir: &Path) -> std::path::PathBuf {
+        let key = rcgen::KeyPair::generate().unwrap();
+        let mut params = rcgen::CertificateParams::new(vec!["edge.internal".to_string()]).unwrap();
+        params.not_after = rcgen::date_time_ymd(2030, 1, 31);
+        let path = dir.join("server.crt");
+        std::fs::write(&path, params.self_signed(&key).unwrap().pem()).unwrap();
+        path
+    }
+
+    fn at(rfc3339: &str) -> SystemTime {
+        humantime::parse_rfc3339(rfc3339).unwrap()
+    }
+
+    #[test]
+    fn test_check_expiry_compares_remaining_lifetime_to_minimum() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = write_cert(dir.path());
+
+        let report = check_expiry(&path, 7 * DAY, at("2030-01-01T00:00:00Z"));
+        assert_eq!(report.status, ExpiryStatus::Ok);
+        assert!(report.to_string().starts_with("OK: "));
+        assert!(report.detail.contains("expires in 30days"), "{report}");
+
+        let report = check_expiry(&path, 7 * DAY, at("2030-01-28T00:00:00Z"));
+        assert_eq!(report.status, ExpiryStatus::BelowThreshold);
+        assert_eq!(report.status.exit_code(), 1);
+
+        let report = check_expiry(&path, 7 * DAY, at("2030-02-01T00:00:00Z"));
+        assert_eq!(report.status, ExpiryStatus::Expired);
+        assert_eq!(report.status.exit_code(), 2);
+    }
+
+    #[test]
+    fn test_check_expiry_reports_unreadable_files_as_critical() {
+        let dir = tempfile::tempdir().unwrap();
+        let missing = check_expiry(&dir.path().join("missing.crt"), DAY, SystemTime::now());
+        assert_eq!(missing.status, ExpiryStatus::Unreadable);
+
+        let garbage = dir.path().join("garbage.crt");
+        std::fs::write(&garbage, "not a certificate").unwrap();
+        let report = check_expiry(&garbage, DAY, SystemTime::now());
+        assert_eq!(report.status, ExpiryStatus::Unreadable);
+        assert_eq!(report.status.exit_code(), 2);
+        assert!(
+            report
+                .to_string()
+                .starts_with("CRITICAL: cannot read certificate")
+        );
+    }
+}
@@ -362,9 +362,13 @@ fn resolve_group_name(name: &str) -> Option<u32> {
 /// # Errors
 ///
 /// Returns an error if the staging write, chown, chmod, or rename fails.
-pub async fn write_key_file(path: &Path, key_pem: &str, policy: CertGroupPolicy) -> Result<()> {
+pub async fn write_key_file(
+    path: &Path,
+    key: impl AsRef<[u8]>,
+    policy: CertGroupPolicy,
+) -> Result<()> {
     let dest = path.to_path_buf();
-    let key_owned = key_pem.to_string();
+    let key_owned = key.as_ref().to_vec();
     tokio::task::spawn_blocking(move || -> Result<()> {
         let parent = dest
             .parent()
@@ -397,7 +401,7 @@ pub async fn write_key_file(path: &Path, key_pem: &str, policy: CertGroupPolicy)
 fn stage_key_file(
     parent: &Path,
     final_name: &str,
-    key_pem: &str,
+    key: &[u8],
     policy: CertGroupPolicy,
 ) -> Result<PathBuf> {
     let pid = std::process::id();
@@ -409,7 +413,7 @@ fn stage_key_file(
             .mode(KEY_FILE_MODE_DEFAULT);
         match opts.open(&candidate) {
             Ok(mut f) => {
-                if let Err(err) = f.write_all(key_pem.as_bytes()) {
+                if let Err(err) = f.write_all(key) {
                     let _ = std::fs::remove_file(&candidate);
                     return Err(anyhow::Error::new(err)
                         .context(format!("Failed to write {}", candidate.display())));
@@ -463,8 +467,12 @@ fn stage_key_file(
 /// # Errors
 ///
 /// Returns an error if the write, chown, or chmod fails.
-pub async fn write_cert_file(path: &Path, cert_pem: &str, policy: CertGroupPolicy) -> Result<()> {
-    fs::write(path, cert_pem)
+pub async fn write_cert_file(
+    path: &Path,
+    cert: impl AsRef<[u8]>,
+    policy: CertGroupPolicy,
+) -> Result<()> {
+    fs::write(path, cert.as_ref())
         .await
         .with_context(|| format!("Failed to write cert file {}", path.display()))?;
     fs::set_permissions(path, std::fs::Permissions::from_mode(CERT_FILE_MODE))
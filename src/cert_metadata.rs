@@ -0,0 +1,626 @@
+//! Sidecar metadata written next to every issued certificate.
+//!
+//! After each issuance the agent writes `<cert stem>.meta.json` beside
+//! the certificate. The file marks the certificate as agent-managed,
+//! records enough of the issuing profile to renew it later without that
+//! profile being configured (which is what `--renew-dir` relies on), and
+//! captures audit details of the issued leaf. It is written `0600`
+//! because it references the private key path.
+
+use std::fmt::Write as _;
+use std::path::{Path, PathBuf};
+use std::time::SystemTime;
+
+use anyhow::{Context, Result};
+use base64::Engine as _;
+use serde::{Deserialize, Serialize};
+use x509_parser::prelude::X509Certificate;
+use x509_parser::public_key::PublicKey;
+
+use crate::acme::timing::PhaseTimings;
+use crate::{config, fs_util};
+
+const METADATA_EXTENSION: &str = "meta.json";
+const METADATA_FILE_SUFFIX: &str = ".meta.json";
+const METADATA_FILE_MODE: u32 = 0o600;
+const METADATA_VERSION: u32 = 1;
+
+/// Contents of a certificate's sidecar metadata file.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub(crate) struct CertMetadata {
+    pub(crate) version: u32,
+    pub(crate) service_name: String,
+    pub(crate) instance_id: String,
+    pub(crate) hostname: String,
+    pub(crate) domain: String,
+    pub(crate) cert_path: PathBuf,
+    pub(crate) key_path: PathBuf,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub(crate) chain_path: Option<PathBuf>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub(crate) pin_path: Option<PathBuf>,
+    pub(crate) bundle: bool,
+    /// Encoding of the certificate and key files; absent in sidecars
+    /// written before DER output existed.
+    #[serde(default)]
+    pub(crate) format: config::OutputFormat,
+    /// Order of the bundled certificate file; absent in sidecars written
+    /// before the order was configurable.
+    #[serde(default)]
+    pub(crate) bundle_order: config::BundleOrder,
+    /// `cleanup_on_failure` of the issuing profile; absent in sidecars
+    /// written before it was recorded.
+    #[serde(default)]
+    pub(crate) cleanup_on_failure: bool,
+    /// `cert_group_gid` of the issuing profile.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub(crate) cert_group_gid: Option<u32>,
+    /// CSR subject fields and URI/email SANs of the issuing profile.
+    #[serde(default)]
+    pub(crate) subject: config::SubjectSettings,
+    /// Hooks of the issuing profile.
+    #[serde(default)]
+    pub(crate) hooks: config::HookSettings,
+    /// Output sinks of the issuing profile.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub(crate) outputs: Option<Vec<config::OutputSinkSettings>>,
+    /// Whether the key stays in a PKCS#11 token. The token settings
+    /// carry the user PIN, so they are not recorded; such a certificate
+    /// renews only through its configured profile.
+    #[serde(default)]
+    pub(crate) pkcs11: bool,
+    /// `renew_before` of the issuing profile, as a humantime duration.
+    pub(crate) renew_before: String,
+    /// Identifiers the certificate was ordered for.
+    pub(crate) domains: Vec<String>,
+    /// ACME directory the certificate was issued from.
+    pub(crate) directory_url: String,
+    /// ACME account key file (`acme.account_key_path`); `null` when the
+    /// agent registered with a fresh key for this issuance.
+    pub(crate) account_key_path: Option<PathBuf>,
+    /// Leaf key algorithm, e.g. `ecdsa-p256` or `rsa-2048`.
+    pub(crate) key_type: String,
+    /// Leaf serial number as lowercase hex.
+    pub(crate) serial: String,
+    /// Leaf SPKI pin (see [`spki_sha256_pin`]); absent in sidecars
+    /// written before pins were recorded.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub(crate) spki_sha256: Option<String>,
+    /// RFC 3339 timestamps (UTC).
+    pub(crate) issued_at: String,
+    pub(crate) not_after: String,
+    /// Leaf `NotBefore` (RFC 3339, UTC); absent in sidecars written
+    /// before it was recorded.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub(crate) not_before: Option<String>,
+    /// Duration of each ACME phase of the issuance; absent in sidecars
+    /// written before phase timing was recorded.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub(crate) phase_timings: Option<PhaseTimings>,
+    /// Run ID of the agent run that issued the certificate; absent in
+    /// sidecars written before run IDs existed.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub(crate) run_id: Option<String>,
+}
+
+impl CertMetadata {
+    /// Captures the profile that issued `cert_pem` together with details
+    /// of its leaf certificate. Paths are stored absolute so a later scan
+    /// does not depend on the working directory.
+    ///
+    /// # Errors
+    /// Returns an error if a relative path cannot be absolutized, the
+    /// profile's directory URL cannot be derived, or the leaf certificate
+    /// cannot be parsed.
+    pub(crate) fn from_issuance(
+        settings: &config::Settings,
+        profile: &config::DaemonProfileSettings,
+        cert_pem: &str,
+        issued_at: SystemTime,
+    ) -> Result<Self> {
+        let (_, pem) = x509_parser::pem::parse_x509_pem(cert_pem.as_bytes())
+            .map_err(|e| anyhow::anyhow!("Failed to parse issued certificate PEM: {e}"))?;
+        let (_, leaf) = x509_parser::parse_x509_certificate(&pem.contents)
+            .map_err(|e| anyhow::anyhow!("Failed to parse issued certificate: {e}"))?;
+        Ok(Self {
+            version: METADATA_VERSION,
+            service_name: profile.service_name.clone(),
+            instance_id: profile.instance_id.clone(),
+            hostname: profile.hostname.clone(),
+            domain: settings.domain.clone(),
+            cert_path: fs_util::absolute_lexical(&profile.paths.cert)?,
+            key_path: fs_util::absolute_lexical(&profile.paths.key)?,
+            chain_path: profile
+                .paths
+                .chain
+                .as_deref()
+                .map(fs_util::absolute_lexical)
+                .transpose()?,
+            pin_path: profile
+                .paths
+                .pin
+                .as_deref()
+                .map(fs_util::absolute_lexical)
+                .transpose()?,
+            bundle: profile.bundle,
+            format: profile.format,
+            bundle_order: profile.bundle_order,
+            cleanup_on_failure: profile.cleanup_on_failure,
+            cert_group_gid: profile.cert_group_gid,
+            subject: profile.subject.clone(),
+            hooks: profile.hooks.clone(),
+            outputs: profile.outputs.clone(),
+            pkcs11: profile.pkcs11.is_some(),
+            renew_before: humantime::format_duration(profile.daemon.renew_before).to_string(),
+            domains: vec![config::profile_domain(settings, profile)],
+            directory_url: config::profile_directory_url(settings, profile)?,
+            account_key_path: settings
+                .acme
+                .account_key_path
+                .as_deref()
+                .map(fs_util::absolute_lexical)
+                .transpose()?,
+            key_type: key_type(&leaf),
+            serial: leaf.tbs_certificate.raw_serial().iter().fold(
+                String::new(),
+                |mut hex, byte| {
+                    let _ = write!(hex, "{byte:02x}");
+                    hex
+                },
+            ),
+            spki_sha256: Some(leaf_spki_pin(&leaf)),
+            issued_at: humantime::format_rfc3339_seconds(issued_at).to_string(),
+            not_after: humantime::format_rfc3339_seconds(SystemTime::from(
+                leaf.validity().not_after.to_datetime(),
+            ))
+            .to_string(),
+            not_before: Some(
+                humantime::format_rfc3339_seconds(SystemTime::from(
+                    leaf.validity().not_before.to_datetime(),
+                ))
+                .to_string(),
+            ),
+            phase_timings: None,
+            run_id: crate::run_id::current(),
+        })
+    }
+
+    /// Reports whether `profile` is the one this metadata describes.
+    pub(crate) fn matches_profile(&self, profile: &config::DaemonProfileSettings) -> bool {
+        self.service_name == profile.service_name
+            && self.instance_id == profile.instance_id
+            && self.hostname == profile.hostname
+    }
+
+    /// Rebuilds a profile that renews this certificate in place, with the
+    /// group, subject, SANs, hooks, and output sinks of the issuing
+    /// profile. `cleanup_on_failure` (`--cleanup-on-failure`) turns
+    /// cleanup on even if the issuing profile had it off.
+    ///
+    /// # Errors
+    /// Returns an error if `renew_before` is not a valid duration or the
+    /// key stays in a PKCS#11 token, whose settings are not recorded.
+    pub(crate) fn to_profile(
+        &self,
+        cleanup_on_failure: bool,
+    ) -> Result<config::DaemonProfileSettings> {
+        if self.pkcs11 {
+            anyhow::bail!(
+                "{} keeps its key in a PKCS#11 token; configure its profile to renew it",
+                self.cert_path.display()
+            );
+        }
+        let renew_before = humantime::parse_duration(&self.renew_before)
+            .with_context(|| format!("Invalid renew_before '{}'", self.renew_before))?;
+        Ok(config::DaemonProfileSettings {
+            service_name: self.service_name.clone(),
+            instance_id: self.instance_id.clone(),
+            hostname: self.hostname.clone(),
+            paths: config::Paths {
+                cert: self.cert_path.clone(),
+                key: self.key_path.clone(),
+                chain: self.chain_path.clone(),
+                pin: self.pin_path.clone(),
+            },
+            daemon: config::DaemonRuntimeSettings {
+                renew_before,
+                ..config::DaemonRuntimeSettings::default()
+            },
+            hooks: self.hooks.clone(),
+            subject: self.subject.clone(),
+            cert_group_gid: self.cert_group_gid,
+            bundle: self.bundle,
+            format: self.format,
+            bundle_order: self.bundle_order,
+            cleanup_on_failure: self.cleanup_on_failure || cleanup_on_failure,
+            outputs: self.outputs.clone(),
+            ..config::DaemonProfileSettings::default()
+        })
+    }
+}
+
+/// Returns the sidecar path for a certificate (`server.crt` →
+/// `server.meta.json`).
+pub(crate) fn metadata_path(cert_path: &Path) -> PathBuf {
+    cert_path.with_extension(METADATA_EXTENSION)
+}
+
+/// Writes the sidecar for a freshly issued certificate, including the
+/// phase timings of its issuance.
+///
+/// # Errors
+/// Returns an error if the metadata cannot be built or written.
+pub(crate) async fn write_metadata(
+    settings: &config::Settings,
+    profile: &config::DaemonProfileSettings,
+    cert_pem: &str,
+    timings: &PhaseTimings,
+) -> Result<()> {
+    let mut metadata = CertMetadata::from_issuance(settings, profile, cert_pem, SystemTime::now())?;
+    metadata.phase_timings = Some(timings.clone());
+    let contents =
+        serde_json::to_vec_pretty(&metadata).context("Failed to serialize certificate metadata")?;
+    let path = metadata_path(&profile.paths.cert);
+    fs_util::atomic_write(&path, &contents, METADATA_FILE_MODE)
+        .await
+        .with_context(|| format!("Failed to write certificate metadata {}", path.display()))
+}
+
+/// Returns the SPKI pin of the first certificate in `cert_pem`: the
+/// base64 SHA-256 of its DER `SubjectPublicKeyInfo`, as used by HPKP
+/// (RFC 7469) and mobile certificate pinning. It changes whenever the key
+/// does, so only a profile whose key stays in a PKCS#11 token keeps the
+/// same pin across renewals.
+///
+/// # Errors
+/// Returns an error if the certificate cannot be parsed.
+pub(crate) fn spki_sha256_pin(cert_pem: &str) -> Result<String> {
+    let (_, pem) = x509_parser::pem::parse_x509_pem(cert_pem.as_bytes())
+        .map_err(|e| anyhow::anyhow!("Failed to parse issued certificate PEM: {e}"))?;
+    let (_, leaf) = x509_parser::parse_x509_certificate(&pem.contents)
+        .map_err(|e| anyhow::anyhow!("Failed to parse issued certificate: {e}"))?;
+    Ok(leaf_spki_pin(&leaf))
+}
+
+fn leaf_spki_pin(cert: &X509Certificate<'_>) -> String {
+    let digest = ring::digest::digest(&ring::digest::SHA256, cert.public_key().raw);
+    base64::engine::general_purpose::STANDARD.encode(digest.as_ref())
+}
+
+fn key_type(cert: &X509Certificate<'_>) -> String {
+    let spki = cert.public_key();
+    match spki.parsed() {
+        Ok(PublicKey::RSA(rsa)) => format!("rsa-{}", rsa.key_size()),
+        Ok(PublicKey::EC(point)) => format!("ecdsa-p{}", point.key_size()),
+        _ => spki.algorithm.algorithm.to_id_string(),
+    }
+}
+
+/// Reads and parses a sidecar metadata file.
+///
+/// # Errors
+/// Returns an error if the file cannot be read, is not valid metadata,
+/// or has an unsupported version.
+pub(crate) async fn read_metadata(path: &Path) -> Result<CertMetadata> {
+    let contents = tokio::fs::read(path)
+        .await
+        .with_context(|| format!("Failed to read certificate metadata {}", path.display()))?;
+    let metadata: CertMetadata = serde_json::from_slice(&contents)
+        .with_context(|| format!("Invalid certificate metadata {}", path.display()))?;
+    if metadata.version != METADATA_VERSION {
+        anyhow::bail!(
+            "Unsupported certificate metadata version {} in {}",
+            metadata.version,
+            path.display()
+        );
+    }
+    Ok(metadata)
+}
+
+/// Recursively lists sidecar metadata files under `root`, sorted by
+/// path. Directories without a sidecar contribute nothing, and
+/// symlinked directories are not followed.
+///
+/// # Errors
+/// Returns an error if `root` or one of its subdirectories cannot be
+/// read.
+pub(crate) async fn find_metadata_files(root: &Path) -> Result<Vec<PathBuf>> {
+    let root = root.to_path_buf();
+    tokio::task::spawn_blocking(move || -> Result<Vec<PathBuf>> {
+        let mut found = Vec::new();
+        let mut pending = vec![root];
+        while let Some(dir) = pending.pop() {
+            let entries = std::fs::read_dir(&dir)
+                .with_context(|| format!("Failed to read directory {}", dir.display()))?;
+            for entry in entries {
+                let entry =
+                    entry.with_context(|| format!("Failed to read directory {}", dir.display()))?;
+                let file_type = entry
+                    .file_type()
+                    .with_context(|| format!("Failed to stat {}", entry.path().display()))?;
+                let path = entry.path();
+                if file_type.is_dir() {
+                    pending.push(path);
+                } else if file_type.is_file()
+                    && path
+                        .file_name()
+                        .and_then(|name| name.to_str())
+                        .is_some_and(|name| name.ends_with(METADATA_FILE_SUFFIX))
+                {
+                    found.push(path);
+                }
+            }
+        }
+        found.sort();
+        Ok(found)
+    })
+    .await
+    .context("Certificate metadata scan task panicked")?
+}
+
+#[cfg(test)]
+mod tests {
+    use std::os::unix::fs::PermissionsExt;
+    use std::time::Duration;
+
+    use super::*;
+
+    const TEST_SERIAL: [u8; 3] = [0x0a, 0xbc, 0x01];
+
+    fn test_settings() -> config::Settings {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        std::io::Write::write_all(&mut file, b"domain = \"trusted.domain\"\n").unwrap();
+        config::Settings::new(Some(file.path().to_path_buf())).unwrap()
+    }
+
+    fn test_profile(dir: &Path) -> config::DaemonProfileSettings {
+        config::DaemonProfileSettings {
+            service_name: "edge-proxy".to_string(),
+            instance_id: "001".to_string(),
+            hostname: "edge-node-01".to_string(),
+            paths: config::Paths {
+                cert: dir.join("server.crt"),
+                key: dir.join("server.key"),
+                chain: None,
+                pin: None,
+            },
+            ..config::DaemonProfileSettings::default()
+        }
+    }
+
+    fn test_cert_pem() -> String {
+        let key = rcgen::KeyPair::generate().unwrap();
+        let mut params = rcgen::CertificateParams::new(vec![
+            "001.edge-proxy.edge-node-01.trusted.domain".to_string(),
+        ])
+        .unwrap();
+        params.serial_number = Some(rcgen::SerialNumber::from_slice(&TEST_SERIAL));
+        params.not_before = rcgen::date_time_ymd(2029, 10, 4);
+        params.not_after = rcgen::date_time_ymd(2030, 1, 2);
+        params.self_signed(&key).unwrap().pem()
+    }
+
+    /// Self-signed P-256 certificate whose pin was computed with
+    /// `openssl x509 -pubkey | openssl pkey -pubin -outform der |
+    /// openssl dgst -sha256 -binary | base64`.
+    const KNOWN_CERT_PEM: &str = "-----BEGIN CERTIFICATE-----\n\
+MIIBlDCCATugAwIBAgIUQzYikm129jggmZ3JfdguyOtOk3wwCgYIKoZIzj0EAwIw\n\
+HzEdMBsGA1UEAwwUcGluLmV4YW1wbGUuaW50ZXJuYWwwIBcNMjYxMDE0MTg1NTM5\n\
+WhgPMjEyNjA5MjAxODU1MzlaMB8xHTAbBgNVBAMMFHBpbi5leGFtcGxlLmludGVy\n\
+bmFsMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEDdKsWZtzRv5VqRhivOps5IcV\n\
+33ZwXC5u0TkAs3GSr6/YK4kq7dyeTvKWn+vxNEoO127WeJjqWtR2OuBsAfSvGqNT\n\
+MFEwHQYDVR0OBBYEFKrW1ORwORQh7DpKyyDFuWOU4DFOMB8GA1UdIwQYMBaAFKrW\n\
+1ORwORQh7DpKyyDFuWOU4DFOMA8GA1UdEwEB/wQFMAMBAf8wCgYIKoZIzj0EAwID\n\
+RwAwRAIgL6F5wOgGSjuV9C7HMK5KLBT+WuNan/xRsZk0FKeqfgwCIBCpkMJLIdBx\n\
+ul7H8WFeF8ewraFQM9xxnsZLVy304yN/\n\
+-----END CERTIFICATE-----\n";
+    const KNOWN_CERT_PIN: &str = "6EQvQfp2nlz86ZbdYvtWEmdFs3r6kXRh3bIij7esl4Y=";
+
+    #[test]
+    fn test_spki_sha256_pin_matches_openssl() {
+        assert_eq!(spki_sha256_pin(KNOWN_CERT_PEM).unwrap(), KNOWN_CERT_PIN);
+        assert!(spki_sha256_pin("not a certificate").is_err());
+    }
+
+    #[test]
+    fn test_metadata_path_replaces_extension() {
+        assert_eq!(
+            metadata_path(Path::new("/srv/edge/server.crt")),
+            PathBuf::from("/srv/edge/server.meta.json")
+        );
+        assert_eq!(
+            metadata_path(Path::new("certs/edge-proxy-a.pem")),
+            PathBuf::from("certs/edge-proxy-a.meta.json")
+        );
+    }
+
+    #[test]
+    fn test_from_issuance_records_leaf_details() {
+        let dir = tempfile::tempdir().unwrap();
+        let issued_at = SystemTime::UNIX_EPOCH + Duration::from_secs(1_700_000_000);
+
+        let metadata = CertMetadata::from_issuance(
+            &test_settings(),
+            &test_profile(dir.path()),
+            &test_cert_pem(),
+            issued_at,
+        )
+        .unwrap();
+
+        assert_eq!(
+            metadata.domains,
+            vec!["001.edge-proxy.edge-node-01.trusted.domain".to_string()]
+        );
+        assert_eq!(metadata.directory_url, test_settings().server);
+        assert_eq!(metadata.account_key_path, None);
+        assert_eq!(metadata.key_type, "ecdsa-p256");
+        assert_eq!(metadata.serial, "0abc01");
+        assert_eq!(metadata.spki_sha256.as_deref().map(str::len), Some(44));
+        assert_eq!(metadata.issued_at, "2023-11-14T22:13:20Z");
+        assert_eq!(metadata.not_after, "2030-01-02T00:00:00Z");
+        assert_eq!(metadata.not_before.as_deref(), Some("2029-10-04T00:00:00Z"));
+    }
+
+    #[tokio::test]
+    async fn test_write_then_read_round_trips_profile() {
+        let dir = tempfile::tempdir().unwrap();
+        let profile = test_profile(dir.path());
+        let timings = PhaseTimings {
+            challenge_ms: 1_500,
+            total_ms: 2_000,
+            ..PhaseTimings::default()
+        };
+
+        write_metadata(&test_settings(), &profile, &test_cert_pem(), &timings)
+            .await
+            .unwrap();
+        let path = dir.path().join("server.meta.json");
+        let metadata = read_metadata(&path).await.unwrap();
+
+        let mode = std::fs::metadata(&path).unwrap().permissions().mode() & 0o777;
+        assert_eq!(mode, METADATA_FILE_MODE);
+        assert!(metadata.matches_profile(&profile));
+        assert_eq!(metadata.domain, "trusted.domain");
+        let rebuilt = metadata.to_profile(false).unwrap();
+        assert_eq!(rebuilt.paths.cert, profile.paths.cert);
+        assert_eq!(rebuilt.paths.key, profile.paths.key);
+        assert_eq!(rebuilt.daemon.renew_before, Duration::from_hours(16));
+        assert!(!rebuilt.cleanup_on_failure);
+        assert!(metadata.to_profile(true).unwrap().cleanup_on_failure);
+        assert_eq!(metadata.phase_timings, Some(timings));
+    }
+
+    #[tokio::test]
+    async fn test_to_profile_restores_group_subject_hooks_and_outputs() {
+        let dir = tempfile::tempdir().unwrap();
+        let mut profile = test_profile(dir.path());
+        profile.cert_group_gid = Some(1234);
+        profile.subject.organization = Some("Example Org".to_string());
+        profile.subject.uri_sans = vec!["spiffe://trusted.domain/edge".to_string()];
+        profile.subject.email_sans = vec!["ops@trusted.domain".to_string()];
+        profile.hooks.post_renew.success = vec![config::HookCommand {
+            command: "systemctl".to_string(),
+            args: vec!["reload".to_string(), "nginx".to_string()],
+            working_dir: None,
+            timeout_secs: 30,
+            retry_backoff_secs: Vec::new(),
+            max_output_bytes: None,
+            on_failure: config::HookFailurePolicy::Stop,
+        }];
+        profile.outputs = Some(vec![
+            config::OutputSinkSettings::Files,
+            config::OutputSinkSettings::Certbot {
+                base: dir.path().join("live"),
+            },
+        ]);
+
+        write_metadata(
+            &test_settings(),
+            &profile,
+            &test_cert_pem(),
+            &PhaseTimings::default(),
+        )
+        .await
+        .unwrap();
+        let metadata = read_metadata(&dir.path().join("server.meta.json"))
+            .await
+            .unwrap();
+        let rebuilt = metadata.to_profile(false).unwrap();
+
+        assert_eq!(rebuilt.cert_group_gid, Some(1234));
+        assert_eq!(rebuilt.subject, profile.subject);
+        let [hook] = rebuilt.hooks.post_renew.success.as_slice() else {
+            panic!("expected one success hook");
+        };
+        assert_eq!(hook.command, "systemctl");
+        assert_eq!(hook.args, vec!["reload", "nginx"]);
+        assert_eq!(hook.on_failure, config::HookFailurePolicy::Stop);
+        assert_eq!(rebuilt.outputs, profile.outputs);
+    }
+
+    #[test]
+    fn test_to_profile_refuses_pkcs11_keys() {
+        let dir = tempfile::tempdir().unwrap();
+        let mut profile = test_profile(dir.path());
+        profile.pkcs11 = Some(config::Pkcs11Settings {
+            module: PathBuf::from("/usr/lib/softhsm/libsofthsm2.so"),
+            slot: 0,
+            label: "edge".to_string(),
+            pin: Some("token-pin-secret".to_string()),
+        });
+        let metadata = CertMetadata::from_issuance(
+            &test_settings(),
+            &profile,
+            &test_cert_pem(),
+            SystemTime::now(),
+        )
+        .unwrap();
+
+        let json = serde_json::to_string(&metadata).unwrap();
+        assert!(
+            !json.contains("token-pin-secret"),
+            "the PIN is not recorded"
+        );
+        let err = metadata.to_profile(false).unwrap_err();
+        assert!(err.to_string().contains("PKCS#11"), "{err:#}");
+    }
+
+    #[test]
+    fn test_metadata_without_phase_timings_still_parses() {
+        let dir = tempfile::tempdir().unwrap();
+        let metadata = CertMetadata::from_issuance(
+            &test_settings(),
+            &test_profile(dir.path()),
+            &test_cert_pem(),
+            SystemTime::now(),
+        )
+        .unwrap();
+        let json = serde_json::to_value(&metadata).unwrap();
+        assert!(json.get("phase_timings").is_none());
+
+        let parsed: CertMetadata = serde_json::from_value(json).unwrap();
+
+        assert_eq!(parsed.phase_timings, None);
+    }
+
+    #[tokio::test]
+    async fn test_read_metadata_rejects_unknown_version() {
+        let dir = tempfile::tempdir().unwrap();
+        let mut metadata = CertMetadata::from_issuance(
+            &test_settings(),
+            &test_profile(dir.path()),
+            &test_cert_pem(),
+            SystemTime::now(),
+        )
+        .unwrap();
+        metadata.version = METADATA_VERSION + 1;
+        let path = dir.path().join("server.meta.json");
+        std::fs::write(&path, serde_json::to_vec(&metadata).unwrap()).unwrap();
+
+        let err = read_metadata(&path).await.unwrap_err();
+
+        assert!(err.to_string().contains("version"));
+    }
+
+    #[tokio::test]
+    async fn test_find_metadata_files_skips_unmarked_directories() {
+        let dir = tempfile::tempdir().unwrap();
+        for name in ["a", "b", "c/nested"] {
+            std::fs::create_dir_all(dir.path().join(name)).unwrap();
+        }
+        std::fs::write(dir.path().join("a/server.crt"), "cert").unwrap();
+        std::fs::write(dir.path().join("a/server.meta.json"), "{}").unwrap();
+        std::fs::write(dir.path().join("b/server.crt"), "cert").unwrap();
+        std::fs::write(dir.path().join("c/nested/server.meta.json"), "{}").unwrap();
+
+        let found = find_metadata_files(dir.path()).await.unwrap();
+
+        assert_eq!(
+            found,
+            vec![
+                dir.path().join("a/server.meta.json"),
+                dir.path().join("c/nested/server.meta.json"),
+            ]
+        );
+    }
+}
@@ -4,8 +4,9 @@ use clap::{ArgGroup, ValueEnum};
 use clap::{Args, Parser, Subcommand};
 
 use crate::commands::init::{
-    DEFAULT_CERT_DURATION, DEFAULT_COMPOSE_FILE, DEFAULT_KV_MOUNT, DEFAULT_OPENBAO_URL,
-    DEFAULT_SECRETS_DIR, DEFAULT_STEPCA_PROVISIONER, SECRET_ID_TTL,
+    DEFAULT_CA_ADDRESS, DEFAULT_CA_DNS, DEFAULT_CA_NAME, DEFAULT_CERT_DURATION,
+    DEFAULT_COMPOSE_FILE, DEFAULT_KV_MOUNT, DEFAULT_OPENBAO_URL, DEFAULT_SECRETS_DIR,
+    DEFAULT_STEP_CA_IMAGE, DEFAULT_STEPCA_PROVISIONER, DEFAULT_STEPCA_URL, SECRET_ID_TTL,
 };
 use crate::state::{DeliveryMode, HookFailurePolicyEntry};
 
@@ -44,6 +45,27 @@ pub(crate) struct Cli {
     #[arg(long, env = "BOOTROOT_LANG", default_value = "en", global = true)]
     pub(crate) lang: String,
 
+    /// Times to retry a Docker command that fails with a transient error
+    /// (image pull, registry rate limit, daemon socket unavailable)
+    #[arg(
+        long,
+        env = "BOOTROOT_DOCKER_RETRIES",
+        default_value_t = 2,
+        global = true
+    )]
+    pub(crate) docker_retries: u32,
+
+    /// Stop waiting once the command has run this long (for example `10m`):
+    /// Docker retries and readiness polls fail instead of waiting past it
+    #[arg(
+        long,
+        env = "BOOTROOT_MAX_RUNTIME",
+        value_name = "DURATION",
+        value_parser = parse_max_runtime,
+        global = true
+    )]
+    pub(crate) max_runtime: Option<std::time::Duration>,
+
     #[command(subcommand)]
     pub(crate) command: CliCommand,
 }
@@ -131,6 +153,8 @@ pub(crate) enum CliCommand {
     /// so a configuration change takes effect.
     #[command(subcommand)]
     Ca(CaCommand),
+    /// Prints the bootroot version and exits, same as `--version`.
+    Version,
 }
 
 #[derive(Subcommand, Debug)]
@@ -172,6 +196,14 @@ pub(crate) struct CaUpdateArgs {
 pub(crate) struct CaRestartArgs {
     #[command(flatten)]
     pub(crate) compose_file: ComposeFileArgs,
+
+    #[command(flatten)]
+    pub(crate) secrets_dir: SecretsDirArgs,
+
+    /// step-ca base URL probed at `/health` once the container is
+    /// running, verified against `<secrets_dir>/certs/root_ca.crt`
+    #[arg(long, default_value = DEFAULT_STEPCA_URL)]
+    pub(crate) stepca_url: String,
 }
 
 #[derive(Subcommand, Debug)]
@@ -423,6 +455,36 @@ pub(crate) struct DbTimeoutArgs {
     pub(crate) timeout_secs: u64,
 }
 
+#[derive(Args, Debug, Clone)]
+pub(crate) struct StepCaImageArgs {
+    /// Docker image for the `step` helper containers (pin a tag or
+    /// digest, e.g. `smallstep/step-ca@sha256:...`)
+    #[arg(long = "ca-image", default_value = DEFAULT_STEP_CA_IMAGE)]
+    pub(crate) ca_image: String,
+}
+
+/// `step ca init` settings for a CA that `init` creates. Each value
+/// resolves from its flag, then its environment variable, then the
+/// built-in default. An already-initialised CA ignores them.
+#[derive(Args, Debug, Clone)]
+pub(crate) struct StepCaInitArgs {
+    /// CA name used in the generated certificates
+    #[arg(long = "ca-name", env = "BOOTROOT_CA_NAME", default_value = DEFAULT_CA_NAME)]
+    pub(crate) name: String,
+
+    /// Comma-separated DNS names / IPs for the step-ca server certificate
+    #[arg(long = "ca-dns", env = "BOOTROOT_DNS", default_value = DEFAULT_CA_DNS)]
+    pub(crate) dns: String,
+
+    /// step-ca listen address written to `ca.json`
+    #[arg(
+        long = "ca-address",
+        env = "BOOTROOT_ADDRESS",
+        default_value = DEFAULT_CA_ADDRESS
+    )]
+    pub(crate) address: String,
+}
+
 #[derive(Args, Debug)]
 pub(crate) struct RotateArgs {
     #[command(subcommand)]
@@ -444,6 +506,9 @@ pub(crate) struct RotateArgs {
     #[command(flatten)]
     pub(crate) runtime_auth: RuntimeAuthArgs,
 
+    #[command(flatten)]
+    pub(crate) step_ca_image: StepCaImageArgs,
+
     /// Skip confirmation prompts
     #[arg(long, short = 'y', global = true)]
     pub(crate) yes: bool,
@@ -461,7 +526,10 @@ pub(crate) enum RotateCommand {
     /// The new password is staged as `<secrets_dir>/password.txt.new`,
     /// recorded in `OpenBao` KV, and the `OpenBao` Agent re-renders the
     /// final `<secrets_dir>/password.txt` (mode `0600`) before step-ca
-    /// is restarted so the new password takes effect.
+    /// is restarted so the new password takes effect. The previous
+    /// password is kept in `password.txt.bak`, and the JWK `admin`
+    /// provisioner key in `ca.json` is re-encrypted along with the CA
+    /// keys.
     StepcaPassword(RotateStepcaPasswordArgs),
     /// Rotates the `PostgreSQL` password used by step-ca and rewrites
     /// the runtime DSN.
@@ -821,6 +889,12 @@ pub(crate) struct InfraInstallArgs {
     #[command(flatten)]
     pub(crate) compose_file: ComposeFileArgs,
 
+    /// Secrets directory to create and mount into step-ca. A relative
+    /// path is resolved from the compose file's directory; pass the same
+    /// value to `bootroot init`
+    #[arg(long, default_value = DEFAULT_SECRETS_DIR)]
+    pub(crate) secrets_dir: PathBuf,
+
     /// Comma-separated list of services to start
     #[arg(
         long,
@@ -1038,6 +1112,23 @@ pub(crate) struct InitArgs {
     #[command(flatten)]
     pub(crate) compose: ComposeFileArgs,
 
+    #[command(flatten)]
+    pub(crate) step_ca_image: StepCaImageArgs,
+
+    #[command(flatten)]
+    pub(crate) ca_init: StepCaInitArgs,
+
+    /// Air-gapped mode: require `--ca-image` to be loaded locally and
+    /// fail up front instead of letting `docker run` pull it
+    #[arg(long)]
+    pub(crate) offline: bool,
+
+    /// After init, issue one test certificate through the new CA with the
+    /// generated EAB and root to prove the chain works (step-ca and the
+    /// HTTP-01 responder must be running)
+    #[arg(long)]
+    pub(crate) verify: bool,
+
     /// Enable optional features
     #[arg(long, value_enum, value_delimiter = ',')]
     pub(crate) enable: Vec<InitFeature>,
@@ -1050,6 +1141,11 @@ pub(crate) struct InitArgs {
     #[arg(long = "summary-json")]
     pub(crate) summary_json: Option<PathBuf>,
 
+    /// Path to write the agent hand-off JSON (ACME directory URL,
+    /// provisioner, root fingerprint, EAB credentials; mode `0600`)
+    #[arg(long = "bootstrap-result")]
+    pub(crate) bootstrap_result: Option<PathBuf>,
+
     #[command(flatten)]
     pub(crate) root_token: RootTokenArgs,
 
@@ -1081,7 +1177,7 @@ pub(crate) struct InitArgs {
     pub(crate) rotate_bound_cidrs: Vec<String>,
 
     /// step-ca password (password.txt)
-    #[arg(long, env = "STEPCA_PASSWORD")]
+    #[arg(long, env = "STEPCA_PASSWORD", hide_env_values = true)]
     pub(crate) stepca_password: Option<String>,
 
     /// `PostgreSQL` DSN for step-ca
@@ -1096,7 +1192,7 @@ pub(crate) struct InitArgs {
     pub(crate) db_user: Option<String>,
 
     /// `PostgreSQL` password for step-ca
-    #[arg(long, env = "BOOTROOT_DB_PASSWORD")]
+    #[arg(long, env = "BOOTROOT_DB_PASSWORD", hide_env_values = true)]
     pub(crate) db_password: Option<String>,
 
     /// `PostgreSQL` database name for step-ca
@@ -1107,7 +1203,7 @@ pub(crate) struct InitArgs {
     pub(crate) db_timeout: DbTimeoutArgs,
 
     /// HTTP-01 responder HMAC secret
-    #[arg(long, env = "HTTP01_HMAC")]
+    #[arg(long, env = "HTTP01_HMAC", hide_env_values = true)]
     pub(crate) http_hmac: Option<String>,
 
     /// HTTP-01 responder admin URL (optional)
@@ -1119,7 +1215,7 @@ pub(crate) struct InitArgs {
     pub(crate) responder_timeout_secs: u64,
 
     /// step-ca ACME provisioner name
-    #[arg(long, default_value = DEFAULT_STEPCA_PROVISIONER)]
+    #[arg(long, env = "BOOTROOT_PROVISIONER", default_value = DEFAULT_STEPCA_PROVISIONER)]
     pub(crate) stepca_provisioner: String,
 
     /// `defaultTLSCertDuration` embedded in the ACME provisioner of
@@ -1135,7 +1231,7 @@ pub(crate) struct InitArgs {
     pub(crate) eab_kid: Option<String>,
 
     /// ACME EAB HMAC (optional)
-    #[arg(long, env = "EAB_HMAC")]
+    #[arg(long, env = "EAB_HMAC", hide_env_values = true)]
     pub(crate) eab_hmac: Option<String>,
 
     /// Skip the ACME EAB prompt and persist no EAB credentials.
@@ -1161,6 +1257,33 @@ pub(crate) struct InitArgs {
     )]
     pub(crate) no_save_unseal_keys: bool,
 
+    /// Existing root CA certificate (PEM) to import instead of generating
+    /// a new root.  step-ca issues a fresh intermediate signed by it
+    /// unless `--intermediate-cert` is also given
+    #[arg(long, requires = "root_key")]
+    pub(crate) root_cert: Option<PathBuf>,
+
+    /// Private key (PEM) of `--root-cert`
+    #[arg(long, requires = "root_cert")]
+    pub(crate) root_key: Option<PathBuf>,
+
+    /// File holding the password of an encrypted `--root-key`
+    #[arg(long, requires = "root_key")]
+    pub(crate) root_key_password_file: Option<PathBuf>,
+
+    /// Existing intermediate CA certificate (PEM), signed by `--root-cert`,
+    /// to use instead of generating one
+    #[arg(long, requires_all = ["root_cert", "intermediate_key"])]
+    pub(crate) intermediate_cert: Option<PathBuf>,
+
+    /// Private key (PEM) of `--intermediate-cert`
+    #[arg(long, requires = "intermediate_cert")]
+    pub(crate) intermediate_key: Option<PathBuf>,
+
+    /// File holding the password of an encrypted `--intermediate-key`
+    #[arg(long, requires = "intermediate_key")]
+    pub(crate) intermediate_key_password_file: Option<PathBuf>,
+
     /// Internal: invoked from `bootroot reinit`.  Suppresses overwrite
     /// prompts for files that the reinit caller has already decided to
     /// preserve (`ca.json`, `password.txt`, `state.json`) so a
@@ -1565,10 +1688,22 @@ pub(crate) struct VerifyArgs {
     pub(crate) compose_file: ComposeFileArgs,
 }
 
+fn parse_max_runtime(value: &str) -> Result<std::time::Duration, String> {
+    humantime::parse_duration(value.trim()).map_err(|err| err.to_string())
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
 
+    #[test]
+    fn test_cli_parses_max_runtime() {
+        let cli = Cli::parse_from(["bootroot", "--max-runtime", "10m", "version"]);
+        assert_eq!(cli.max_runtime, Some(std::time::Duration::from_secs(600)));
+
+        assert!(Cli::try_parse_from(["bootroot", "--max-runtime", "later", "version"]).is_err());
+    }
+
     #[test]
     fn test_cli_parses_services_list() {
         let cli = Cli::parse_from(["bootroot", "infra", "up", "--services", "openbao,postgres"]);
@@ -1580,6 +1715,15 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_cli_parses_version_subcommand() {
+        let cli = Cli::parse_from(["bootroot", "version"]);
+        assert!(matches!(cli.command, CliCommand::Version));
+
+        let err = Cli::try_parse_from(["bootroot", "--version"]).unwrap_err();
+        assert_eq!(err.kind(), clap::error::ErrorKind::DisplayVersion);
+    }
+
     #[test]
     fn test_cli_parses_rotate_stepca() {
         let cli = Cli::parse_from(["bootroot", "rotate", "stepca-password"]);
@@ -2001,6 +2145,8 @@ mod tests {
                     args.compose_file.compose_file,
                     PathBuf::from("docker-compose.yml")
                 );
+                assert_eq!(args.secrets_dir.secrets_dir, PathBuf::from("secrets"));
+                assert_eq!(args.stepca_url, "https://localhost:9000");
             }
             _ => panic!("expected ca restart"),
         }
@@ -2058,6 +2204,63 @@ mod tests {
         }
     }
 
+    /// `--root-cert` / `--root-key` parse together, and an intermediate
+    /// pair may be layered on top.
+    #[test]
+    fn test_cli_parses_init_existing_ca() {
+        let cli = Cli::parse_from([
+            "bootroot",
+            "init",
+            "--root-cert",
+            "root.crt",
+            "--root-key",
+            "root.key",
+            "--intermediate-cert",
+            "int.crt",
+            "--intermediate-key",
+            "int.key",
+            "--intermediate-key-password-file",
+            "int.pass",
+        ]);
+        match cli.command {
+            CliCommand::Init(args) => {
+                assert_eq!(args.root_cert, Some(PathBuf::from("root.crt")));
+                assert_eq!(args.root_key, Some(PathBuf::from("root.key")));
+                assert_eq!(args.root_key_password_file, None);
+                assert_eq!(args.intermediate_cert, Some(PathBuf::from("int.crt")));
+                assert_eq!(args.intermediate_key, Some(PathBuf::from("int.key")));
+                assert_eq!(
+                    args.intermediate_key_password_file,
+                    Some(PathBuf::from("int.pass"))
+                );
+            }
+            _ => panic!("expected init"),
+        }
+    }
+
+    /// A root certificate without its key, or an intermediate without a
+    /// root, is rejected at parse time.
+    #[test]
+    fn test_cli_rejects_incomplete_existing_ca() {
+        for argv in [
+            vec!["bootroot", "init", "--root-cert", "root.crt"],
+            vec!["bootroot", "init", "--root-key", "root.key"],
+            vec![
+                "bootroot",
+                "init",
+                "--intermediate-cert",
+                "int.crt",
+                "--intermediate-key",
+                "int.key",
+            ],
+        ] {
+            assert!(
+                Cli::try_parse_from(argv.iter().copied()).is_err(),
+                "{argv:?}"
+            );
+        }
+    }
+
     /// Clap must reject `--no-save-unseal-keys` without `--summary-json`
     /// at parse time so the operator does not waste a full init cycle
     /// before discovering the bad combination.
@@ -3017,4 +3220,67 @@ mod tests {
             _ => panic!("expected service add"),
         }
     }
+
+    const CA_NAME_ENV: &str = "BOOTROOT_CA_NAME";
+
+    struct CaNameEnvGuard {
+        _lock: std::sync::MutexGuard<'static, ()>,
+    }
+
+    impl Drop for CaNameEnvGuard {
+        fn drop(&mut self) {
+            // SAFETY: the mutex held in `_lock` serializes env mutation.
+            unsafe { std::env::remove_var(CA_NAME_ENV) };
+        }
+    }
+
+    fn ca_name_env_guard(value: Option<&str>) -> CaNameEnvGuard {
+        use std::sync::{Mutex, OnceLock};
+        static LOCK: OnceLock<Mutex<()>> = OnceLock::new();
+        let lock = LOCK
+            .get_or_init(|| Mutex::new(()))
+            .lock()
+            .unwrap_or_else(std::sync::PoisonError::into_inner);
+        // SAFETY: mutation is serialized by the mutex above.
+        unsafe {
+            match value {
+                Some(value) => std::env::set_var(CA_NAME_ENV, value),
+                None => std::env::remove_var(CA_NAME_ENV),
+            }
+        }
+        CaNameEnvGuard { _lock: lock }
+    }
+
+    fn parsed_ca_name(argv: &[&str]) -> String {
+        match Cli::parse_from(argv).command {
+            CliCommand::Init(args) => args.ca_init.name,
+            _ => panic!("expected init"),
+        }
+    }
+
+    #[test]
+    fn test_cli_init_ca_name_resolution_order() {
+        let guard = ca_name_env_guard(None);
+        assert_eq!(parsed_ca_name(&["bootroot", "init"]), DEFAULT_CA_NAME);
+        drop(guard);
+
+        let _guard = ca_name_env_guard(Some("Env CA"));
+        assert_eq!(parsed_ca_name(&["bootroot", "init"]), "Env CA");
+        assert_eq!(
+            parsed_ca_name(&["bootroot", "init", "--ca-name", "Flag CA"]),
+            "Flag CA"
+        );
+    }
+
+    #[test]
+    fn test_cli_init_hides_secret_env_values() {
+        use clap::CommandFactory;
+
+        let command = Cli::command();
+        let init = command.find_subcommand("init").unwrap();
+        for id in ["stepca_password", "db_password", "http_hmac", "eab_hmac"] {
+            let arg = init.get_arguments().find(|a| a.get_id() == id).unwrap();
+            assert!(arg.is_hide_env_values_set(), "{id} must hide its env value");
+        }
+    }
 }
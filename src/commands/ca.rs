@@ -1,14 +1,19 @@
 use std::fmt::Write as _;
 use std::path::Path;
-use std::thread::sleep;
 use std::time::{Duration, Instant};
 
 use anyhow::{Context, Result};
+use bootroot::utils::jittered_delay;
+use reqwest::Client;
+use serde::Deserialize;
 
 use crate::cli::args::{CaRestartArgs, CaUpdateArgs};
-use crate::commands::infra::{collect_container_failures, collect_readiness, run_docker};
+use crate::commands::infra::{
+    collect_container_failures, collect_readiness, ensure_run_budget, run_docker,
+};
 use crate::commands::init::{
-    RESPONDER_TEMPLATE_DIR, STEPCA_CA_JSON_TEMPLATE_NAME, set_acme_cert_duration,
+    CA_CERTS_DIR, CA_ROOT_CERT_FILENAME, RESPONDER_TEMPLATE_DIR, STEPCA_CA_JSON_TEMPLATE_NAME,
+    set_acme_cert_duration,
 };
 use crate::i18n::Messages;
 
@@ -17,6 +22,17 @@ const CTMPL_PLACEHOLDER_SUFFIX: &str = "__";
 const STEP_CA_SERVICE: &str = "step-ca";
 const READINESS_TIMEOUT: Duration = Duration::from_secs(30);
 const READINESS_POLL_INTERVAL: Duration = Duration::from_millis(500);
+const READINESS_POLL_JITTER: Duration = Duration::from_millis(200);
+const HEALTH_PROBE_TIMEOUT: Duration = Duration::from_secs(5);
+const STEPCA_HEALTH_PATH: &str = "/health";
+const STEPCA_HEALTH_OK: &str = "ok";
+
+/// Body of step-ca's `GET /health` answer, `{"status":"ok"}` when the
+/// CA is serving.
+#[derive(Deserialize)]
+struct StepCaHealth {
+    status: String,
+}
 
 pub(crate) fn run_ca_update(args: &CaUpdateArgs, messages: &Messages) -> Result<()> {
     bootroot::config::validate_cert_duration_vs_default_renew_before(&args.cert_duration)?;
@@ -55,25 +71,50 @@ pub(crate) fn run_ca_update(args: &CaUpdateArgs, messages: &Messages) -> Result<
     Ok(())
 }
 
-pub(crate) fn run_ca_restart(args: &CaRestartArgs, messages: &Messages) -> Result<()> {
+pub(crate) async fn run_ca_restart(args: &CaRestartArgs, messages: &Messages) -> Result<()> {
+    // Build the probe client first so a missing or unreadable root
+    // fails before step-ca is taken down.
+    let client = stepca_health_client(&args.secrets_dir.secrets_dir)?;
+    let health_url = stepca_health_url(&args.stepca_url);
     let compose_str = args.compose_file.compose_file.to_string_lossy();
     let restart_args = ["compose", "-f", &*compose_str, "restart", STEP_CA_SERVICE];
     run_docker(&restart_args, "docker compose restart step-ca", messages)?;
-    wait_for_stepca_ready(&args.compose_file.compose_file, messages)?;
+    wait_for_stepca_ready(
+        &args.compose_file.compose_file,
+        &client,
+        &health_url,
+        messages,
+    )
+    .await?;
     println!("step-ca has been restarted.");
     Ok(())
 }
 
-fn wait_for_stepca_ready(compose_file: &Path, messages: &Messages) -> Result<()> {
+/// Polls until the step-ca container is running and its `/health`
+/// endpoint answers `ok` over HTTPS.
+///
+/// A running container only means the process started; step-ca may
+/// still be loading its keys or waiting for the database, so the HTTPS
+/// probe is what confirms it serves. The poll interval is jittered so
+/// several hosts restarted together do not probe in lockstep.
+async fn wait_for_stepca_ready(
+    compose_file: &Path,
+    client: &Client,
+    health_url: &str,
+    messages: &Messages,
+) -> Result<()> {
     let services = [STEP_CA_SERVICE.to_string()];
     let deadline = Instant::now() + READINESS_TIMEOUT;
     loop {
-        let failures = match collect_readiness(compose_file, None, &services, messages) {
+        let mut failures = match collect_readiness(compose_file, None, &services, messages) {
             Ok(readiness) => collect_container_failures(&readiness),
             Err(err) => vec![err.to_string()],
         };
         if failures.is_empty() {
-            return Ok(());
+            match probe_stepca_health(client, health_url).await {
+                Ok(()) => return Ok(()),
+                Err(err) => failures.push(format!("{err:#}")),
+            }
         }
         if Instant::now() >= deadline {
             anyhow::bail!(
@@ -82,10 +123,66 @@ fn wait_for_stepca_ready(compose_file: &Path, messages: &Messages) -> Result<()>
                 failures.join(", "),
             );
         }
-        sleep(READINESS_POLL_INTERVAL);
+        ensure_run_budget("step-ca", READINESS_POLL_INTERVAL, messages)
+            .map_err(|budget| anyhow::anyhow!("{budget}: {}", failures.join(", ")))?;
+        tokio::time::sleep(jittered_delay(
+            READINESS_POLL_INTERVAL,
+            READINESS_POLL_JITTER,
+        ))
+        .await;
     }
 }
 
+/// Builds the HTTPS client for the step-ca health probe, trusting only
+/// the root written by `init` at `<secrets_dir>/certs/root_ca.crt`.
+///
+/// step-ca serves its leaf together with the intermediate, so the root
+/// alone is a sufficient anchor.
+fn stepca_health_client(secrets_dir: &Path) -> Result<Client> {
+    let root_path = secrets_dir.join(CA_CERTS_DIR).join(CA_ROOT_CERT_FILENAME);
+    let root_pem = std::fs::read_to_string(&root_path).with_context(|| {
+        format!(
+            "failed to read step-ca root certificate at {}",
+            root_path.display()
+        )
+    })?;
+    let config = bootroot::tls::build_client_config_from_pem(&root_pem, &[])?;
+    Client::builder()
+        .use_preconfigured_tls(config)
+        .timeout(HEALTH_PROBE_TIMEOUT)
+        .build()
+        .context("failed to build step-ca health probe client")
+}
+
+fn stepca_health_url(stepca_url: &str) -> String {
+    format!("{}{STEPCA_HEALTH_PATH}", stepca_url.trim_end_matches('/'))
+}
+
+/// Sends one `GET /health` to step-ca and succeeds only on a `200`
+/// whose body reports `"status": "ok"`.
+async fn probe_stepca_health(client: &Client, health_url: &str) -> Result<()> {
+    let response = client
+        .get(health_url)
+        .send()
+        .await
+        .with_context(|| format!("step-ca health probe {health_url} failed"))?;
+    let status = response.status();
+    if !status.is_success() {
+        anyhow::bail!("step-ca health probe {health_url} returned {status}");
+    }
+    let health: StepCaHealth = response
+        .json()
+        .await
+        .with_context(|| format!("step-ca health probe {health_url} returned invalid JSON"))?;
+    if health.status != STEPCA_HEALTH_OK {
+        anyhow::bail!(
+            "step-ca health probe {health_url} reported status {:?}",
+            health.status
+        );
+    }
+    Ok(())
+}
+
 fn patch_ca_json(
     path: &Path,
     cert_duration: &str,
@@ -141,7 +238,7 @@ fn patch_ca_json_ctmpl(
 /// quoted strings, which contain unescaped double quotes and therefore
 /// cannot be parsed directly as JSON. Masking the directives yields
 /// valid JSON that can be parsed, patched, and serialised.
-fn mask_go_template_directives(contents: &str) -> (String, Vec<String>) {
+pub(crate) fn mask_go_template_directives(contents: &str) -> (String, Vec<String>) {
     let mut result = String::with_capacity(contents.len());
     let mut directives: Vec<String> = Vec::new();
     let mut cursor = 0;
@@ -170,7 +267,7 @@ fn mask_go_template_directives(contents: &str) -> (String, Vec<String>) {
     (result, directives)
 }
 
-fn unmask_go_template_directives(contents: &str, directives: &[String]) -> String {
+pub(crate) fn unmask_go_template_directives(contents: &str, directives: &[String]) -> String {
     let mut result = contents.to_string();
     for (idx, directive) in directives.iter().enumerate() {
         let marker = format!("\"{CTMPL_PLACEHOLDER_PREFIX}{idx}{CTMPL_PLACEHOLDER_SUFFIX}\"");
@@ -181,11 +278,181 @@ fn unmask_go_template_directives(contents: &str, directives: &[String]) -> Strin
 
 #[cfg(test)]
 mod tests {
+    use std::sync::Arc;
+
+    use rcgen::{BasicConstraints, CertificateParams, DnType, IsCa, Issuer, KeyPair};
+    use rustls::pki_types::{CertificateDer, PrivateKeyDer, PrivatePkcs8KeyDer};
     use tempfile::tempdir;
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+    use tokio::net::TcpListener;
+    use tokio_rustls::TlsAcceptor;
 
     use super::*;
     use crate::cli::args::SecretsDirArgs;
 
+    const HEALTH_OK_RESPONSE: &str = "HTTP/1.1 200 OK\r\n\
+        Content-Type: application/json\r\n\
+        Content-Length: 15\r\n\
+        Connection: close\r\n\r\n\
+        {\"status\":\"ok\"}";
+    const HEALTH_UNAVAILABLE_RESPONSE: &str = "HTTP/1.1 503 Service Unavailable\r\n\
+        Content-Length: 0\r\n\
+        Connection: close\r\n\r\n";
+    const HEALTH_NOT_OK_RESPONSE: &str = "HTTP/1.1 200 OK\r\n\
+        Content-Type: application/json\r\n\
+        Content-Length: 20\r\n\
+        Connection: close\r\n\r\n\
+        {\"status\":\"loading\"}";
+
+    /// Generates a root CA and a `localhost` server certificate signed
+    /// by it, returning the root PEM and the server cert/key DER.
+    fn generate_root_and_server() -> (String, Vec<u8>, Vec<u8>) {
+        let root_key = KeyPair::generate().expect("generate root key");
+        let mut root_params = CertificateParams::new(Vec::new()).expect("root params");
+        root_params
+            .distinguished_name
+            .push(DnType::CommonName, "Test Root CA");
+        root_params.is_ca = IsCa::Ca(BasicConstraints::Unconstrained);
+        let root_cert = root_params
+            .self_signed(&root_key)
+            .expect("self-signed root");
+        let issuer = Issuer::new(root_params, root_key);
+
+        let server_key = KeyPair::generate().expect("generate server key");
+        let mut server_params =
+            CertificateParams::new(vec!["localhost".to_string()]).expect("server params");
+        server_params
+            .distinguished_name
+            .push(DnType::CommonName, "localhost");
+        let server_cert = server_params
+            .signed_by(&server_key, &issuer)
+            .expect("signed server cert");
+        (
+            root_cert.pem(),
+            server_cert.der().to_vec(),
+            server_key.serialize_der(),
+        )
+    }
+
+    /// Starts an HTTPS server on `127.0.0.1` that answers every request
+    /// with `response` and returns its port.
+    async fn start_health_server(
+        cert_der: Vec<u8>,
+        key_der: Vec<u8>,
+        response: &'static str,
+    ) -> u16 {
+        let _ = rustls::crypto::ring::default_provider().install_default();
+        let config = rustls::ServerConfig::builder()
+            .with_no_client_auth()
+            .with_single_cert(
+                vec![CertificateDer::from(cert_der)],
+                PrivateKeyDer::Pkcs8(PrivatePkcs8KeyDer::from(key_der)),
+            )
+            .expect("server TLS config");
+        let acceptor = TlsAcceptor::from(Arc::new(config));
+        let listener = TcpListener::bind("127.0.0.1:0").await.expect("bind");
+        let port = listener.local_addr().expect("local addr").port();
+
+        tokio::spawn(async move {
+            while let Ok((stream, _)) = listener.accept().await {
+                let acceptor = acceptor.clone();
+                tokio::spawn(async move {
+                    let Ok(mut tls) = acceptor.accept(stream).await else {
+                        return;
+                    };
+                    let mut buf = vec![0u8; 4096];
+                    let _ = tls.read(&mut buf).await;
+                    let _ = tls.write_all(response.as_bytes()).await;
+                    let _ = tls.shutdown().await;
+                });
+            }
+        });
+
+        port
+    }
+
+    fn secrets_dir_with_root(root_pem: &str) -> tempfile::TempDir {
+        let dir = tempdir().unwrap();
+        let certs_dir = dir.path().join(CA_CERTS_DIR);
+        std::fs::create_dir_all(&certs_dir).unwrap();
+        std::fs::write(certs_dir.join(CA_ROOT_CERT_FILENAME), root_pem).unwrap();
+        dir
+    }
+
+    #[test]
+    fn test_stepca_health_url_appends_health_path() {
+        assert_eq!(
+            stepca_health_url("https://localhost:9000"),
+            "https://localhost:9000/health"
+        );
+        assert_eq!(
+            stepca_health_url("https://localhost:9000/"),
+            "https://localhost:9000/health"
+        );
+    }
+
+    #[test]
+    fn test_stepca_health_client_requires_root_cert() {
+        let dir = tempdir().unwrap();
+        let err = stepca_health_client(dir.path()).unwrap_err();
+        assert!(
+            err.to_string().contains("root_ca.crt"),
+            "unexpected error: {err}"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_probe_stepca_health_accepts_ok_over_trusted_https() {
+        let (root_pem, cert_der, key_der) = generate_root_and_server();
+        let port = start_health_server(cert_der, key_der, HEALTH_OK_RESPONSE).await;
+        let secrets_dir = secrets_dir_with_root(&root_pem);
+
+        let client = stepca_health_client(secrets_dir.path()).unwrap();
+        let url = stepca_health_url(&format!("https://localhost:{port}"));
+        probe_stepca_health(&client, &url).await.unwrap();
+    }
+
+    #[tokio::test]
+    async fn test_probe_stepca_health_rejects_untrusted_root() {
+        let (_, cert_der, key_der) = generate_root_and_server();
+        let (other_root_pem, _, _) = generate_root_and_server();
+        let port = start_health_server(cert_der, key_der, HEALTH_OK_RESPONSE).await;
+        let secrets_dir = secrets_dir_with_root(&other_root_pem);
+
+        let client = stepca_health_client(secrets_dir.path()).unwrap();
+        let url = stepca_health_url(&format!("https://localhost:{port}"));
+        probe_stepca_health(&client, &url)
+            .await
+            .expect_err("probe must fail when the server is not signed by root_ca.crt");
+    }
+
+    #[tokio::test]
+    async fn test_probe_stepca_health_rejects_error_status() {
+        let (root_pem, cert_der, key_der) = generate_root_and_server();
+        let port = start_health_server(cert_der, key_der, HEALTH_UNAVAILABLE_RESPONSE).await;
+        let secrets_dir = secrets_dir_with_root(&root_pem);
+
+        let client = stepca_health_client(secrets_dir.path()).unwrap();
+        let url = stepca_health_url(&format!("https://localhost:{port}"));
+        let err = probe_stepca_health(&client, &url).await.unwrap_err();
+        assert!(err.to_string().contains("503"), "unexpected error: {err}");
+    }
+
+    #[tokio::test]
+    async fn test_probe_stepca_health_rejects_status_other_than_ok() {
+        let (root_pem, cert_der, key_der) = generate_root_and_server();
+        let port = start_health_server(cert_der, key_der, HEALTH_NOT_OK_RESPONSE).await;
+        let secrets_dir = secrets_dir_with_root(&root_pem);
+
+        let client = stepca_health_client(secrets_dir.path()).unwrap();
+        let url = stepca_health_url(&format!("https://localhost:{port}"));
+        let err = probe_stepca_health(&client, &url).await.unwrap_err();
+        assert!(
+            err.to_string().contains("loading"),
+            "unexpected error: {err}"
+        );
+    }
+
     fn test_messages() -> Messages {
         crate::i18n::test_messages()
     }
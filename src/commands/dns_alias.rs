@@ -38,6 +38,19 @@ pub(crate) fn register_dns_alias(state: &StateFile, messages: &Messages) -> Resu
     apply_dns_aliases(&aliases, messages)
 }
 
+/// Applies the aliases from `state.json` plus `extra_alias` to the
+/// responder, for a one-off validation such as `init --verify`. Call
+/// [`reconcile_dns_aliases`] afterwards to drop `extra_alias` again.
+pub(crate) fn register_extra_dns_alias(
+    state: &StateFile,
+    extra_alias: &str,
+    messages: &Messages,
+) -> Result<()> {
+    let mut aliases = collect_dns_aliases(state);
+    aliases.push(extra_alias.to_string());
+    apply_dns_aliases(&aliases, messages)
+}
+
 /// Refreshes the responder's HTTP-01 alias set from `state.json`,
 /// reconnecting the `bootroot-http01` container even when the resulting
 /// alias set is empty.
@@ -1018,7 +1018,7 @@ fn validate_tls_key_material(cert_bytes: &[u8], key_bytes: &[u8]) -> Result<()>
 /// Verifies that a private key matches the leaf certificate by signing a
 /// test payload and verifying the signature against the certificate's
 /// public key.
-fn verify_cert_key_match(
+pub(crate) fn verify_cert_key_match(
     leaf_cert: &rustls::pki_types::CertificateDer<'_>,
     signing_key: &dyn rustls::sign::SigningKey,
 ) -> Result<()> {
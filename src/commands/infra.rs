@@ -1,8 +1,11 @@
-use std::io::IsTerminal;
+use std::collections::VecDeque;
+use std::io::{BufRead, BufReader, IsTerminal, Read, Write};
 use std::os::unix::fs::MetadataExt;
 use std::path::{Path, PathBuf};
-use std::process::Command as ProcessCommand;
-use std::time::Duration;
+use std::process::{Command as ProcessCommand, Stdio};
+use std::sync::OnceLock;
+use std::sync::atomic::{AtomicU32, Ordering};
+use std::time::{Duration, Instant};
 
 use anyhow::{Context, Result};
 use bootroot::openbao::OpenBaoClient;
@@ -44,6 +47,10 @@ const UNSEAL_KEYS_PATH: &str = "secrets/openbao/unseal-keys.txt";
 /// user. `infra install` / `infra up` keep it equal to the `secrets/`
 /// owner so the container can read its own key material.
 const STEPCA_USER_ENV_KEY: &str = "BOOTROOT_STEPCA_USER";
+/// `.env` key naming the host directory mounted as step-ca's home. Both
+/// compose files interpolate it as `${BOOTROOT_SECRETS_DIR:-./secrets}`;
+/// `infra install --secrets-dir` writes it.
+const SECRETS_DIR_ENV_KEY: &str = "BOOTROOT_SECRETS_DIR";
 
 /// Total budget for the post-`docker compose up -d` wait that gives the
 /// `OpenBao` listener time to bind before the unseal helpers issue their
@@ -415,8 +422,6 @@ pub(crate) fn run_infra_install(args: &InfraInstallArgs, messages: &Messages) ->
         None
     };
 
-    // --- All input validation is complete; begin side-effects. ---
-
     // Docker Compose resolves relative bind-mount paths (e.g. ./secrets)
     // from the compose file's parent directory, not the process cwd.
     // Create directories there so Docker does not auto-create them as root.
@@ -425,7 +430,13 @@ pub(crate) fn run_infra_install(args: &InfraInstallArgs, messages: &Messages) ->
         .compose_file
         .parent()
         .unwrap_or(Path::new("."));
-    let secrets_dir = compose_dir.join("secrets");
+    let secrets_dir = compose_dir.join(&args.secrets_dir);
+    if secrets_dir.exists() && !secrets_dir.is_dir() {
+        anyhow::bail!(messages.error_secrets_dir_not_directory(&secrets_dir.display().to_string()));
+    }
+
+    // --- All input validation is complete; begin side-effects. ---
+
     let certs_dir = compose_dir.join("certs");
     for dir in [&secrets_dir, &certs_dir] {
         if !dir.exists() {
@@ -490,6 +501,7 @@ pub(crate) fn run_infra_install(args: &InfraInstallArgs, messages: &Messages) ->
     // owned by a non-default uid is readable. `secrets_dir` was just
     // created (or already existed) above, so its owner is the intended one.
     let stepca_user = stepca_user_from_secrets_dir(&secrets_dir, messages)?;
+    let secrets_dir_env = secrets_dir_env_value(&args.secrets_dir);
     if env_path.exists() {
         // Existing deployment: upsert the step-ca uid/gid so a host whose
         // `.env` predates this variable still runs step-ca as the `secrets/`
@@ -500,6 +512,12 @@ pub(crate) fn run_infra_install(args: &InfraInstallArgs, messages: &Messages) ->
             &stepca_user,
             messages,
         )?;
+        crate::commands::dotenv::update_dotenv_key(
+            &env_path,
+            SECRETS_DIR_ENV_KEY,
+            &secrets_dir_env,
+            messages,
+        )?;
         if let Some(port) = args.postgres_host_port {
             crate::commands::dotenv::update_dotenv_key(
                 &env_path,
@@ -517,6 +535,7 @@ pub(crate) fn run_infra_install(args: &InfraInstallArgs, messages: &Messages) ->
             ("POSTGRES_DB", DEFAULT_POSTGRES_DB),
             ("GRAFANA_ADMIN_PASSWORD", DEFAULT_GRAFANA_ADMIN_PASSWORD),
             (STEPCA_USER_ENV_KEY, &stepca_user),
+            (SECRETS_DIR_ENV_KEY, &secrets_dir_env),
         ];
         let host_port_str = args.postgres_host_port.map(|p| p.to_string());
         if let Some(ref s) = host_port_str {
@@ -706,7 +725,7 @@ fn build_ownership_sweep_args<'a>(
         "--user",
         "root",
         // Run `chown` directly instead of through the image's default
-        // entrypoint. The `rotate` flows reuse the `smallstep/step-ca:0.30.2`
+        // entrypoint. The `rotate` flows reuse the `--ca-image` step
         // helper image here, whose entrypoint would otherwise print a
         // spurious "there is no ca.json config file" warning — the sweep
         // deliberately mounts only the secrets subtree, not `/home/step`.
@@ -763,8 +782,8 @@ fn resolve_stepca_image(compose_file: &Path, messages: &Messages) -> Result<Stri
 /// image the flow already has on hand so the sweep introduces no new
 /// dependency: the `infra` flows resolve the compose step-ca server image
 /// (see [`resolve_stepca_image`]) after `up` has made it available, while
-/// the `rotate` flows pass the same `smallstep/step-ca:0.30.2` image their
-/// `step` helpers already run.
+/// the `rotate` flows pass the same `--ca-image` image their `step`
+/// helpers already run.
 pub(crate) fn sweep_secrets_ownership(
     secrets_dir: &Path,
     image: &str,
@@ -783,6 +802,28 @@ pub(crate) fn sweep_secrets_ownership(
     Ok(())
 }
 
+/// Builds the `docker image inspect` argv that succeeds only when `image`
+/// is already in the local image store. `inspect` never contacts a
+/// registry, unlike `docker run`, which pulls a missing image.
+fn build_local_image_check_args(image: &str) -> Vec<&str> {
+    vec!["image", "inspect", "--format", "{{.Id}}", image]
+}
+
+/// Fails unless `image` is present locally. `init --offline` runs this
+/// before any `step` helper container so an air-gapped host reports the
+/// missing image up front instead of a registry timeout mid-init.
+pub(crate) fn ensure_image_present_locally(image: &str, messages: &Messages) -> Result<()> {
+    let args = build_local_image_check_args(image);
+    let output = ProcessCommand::new("docker")
+        .args(&args)
+        .output()
+        .with_context(|| messages.error_command_run_failed("docker image inspect"))?;
+    if !output.status.success() {
+        anyhow::bail!(messages.error_offline_image_missing(image));
+    }
+    Ok(())
+}
+
 /// Resolves the `uid:gid` string step-ca must run as: the owner of the
 /// `secrets/` directory. This matches the value the `OpenBao` Agent sidecars
 /// and every `step` helper container already use, so all writers under
@@ -803,6 +844,17 @@ fn stepca_user_from_secrets_dir(secrets_dir: &Path, messages: &Messages) -> Resu
 /// rewrites the key in place and appends it when absent. A missing `.env`
 /// is a no-op: `infra install` writes the value on first creation, and
 /// `infra up` requires an `.env` for its other required variables anyway.
+/// Returns the `BOOTROOT_SECRETS_DIR` value for `secrets_dir`. A relative
+/// path gets a `./` prefix, since Compose reads a bare name on the left
+/// of a volume entry as a named volume rather than a host path.
+fn secrets_dir_env_value(secrets_dir: &Path) -> String {
+    if secrets_dir.is_absolute() || secrets_dir.starts_with(".") || secrets_dir.starts_with("..") {
+        secrets_dir.display().to_string()
+    } else {
+        Path::new(".").join(secrets_dir).display().to_string()
+    }
+}
+
 fn upsert_stepca_user_env(env_path: &Path, secrets_dir: &Path, messages: &Messages) -> Result<()> {
     if !env_path.exists() {
         return Ok(());
@@ -990,6 +1042,8 @@ async fn wait_for_openbao_api_reachable(client: &OpenBaoClient, messages: &Messa
                 if attempt + 1 == OPENBAO_API_WAIT_ATTEMPTS {
                     return Err(err).with_context(|| messages.error_openbao_seal_status_failed());
                 }
+                ensure_run_budget("OpenBao", OPENBAO_API_WAIT_DELAY, messages)
+                    .map_err(|budget| err.context(budget.to_string()))?;
             }
         }
         tokio::time::sleep(OPENBAO_API_WAIT_DELAY).await;
@@ -1798,30 +1852,328 @@ fn is_image_archive(path: &Path) -> bool {
     name.to_ascii_lowercase().ends_with(".tar.gz")
 }
 
+/// Lines of a failed command's stderr kept for its error message.
+const STDERR_TAIL_LINES: usize = 20;
+
+/// Retries left to a Docker command after a transient failure; set once
+/// from `--docker-retries`.
+static DOCKER_RETRIES: AtomicU32 = AtomicU32::new(2);
+
+/// End of the `--max-runtime` budget and the budget itself; set once at
+/// startup.
+static RUN_DEADLINE: OnceLock<(Instant, Duration)> = OnceLock::new();
+
+/// Wait before the first retry; doubled on each later one.
+const DOCKER_RETRY_BASE_DELAY: Duration = Duration::from_secs(2);
+
+/// Docker/registry error fragments that a later attempt can clear.
+const TRANSIENT_DOCKER_ERRORS: &[&str] = &[
+    "cannot connect to the docker daemon",
+    "error during connect",
+    "toomanyrequests",
+    "rate limit",
+    "tls handshake timeout",
+    "i/o timeout",
+    "connection reset by peer",
+    "unexpected eof",
+    "error pulling image",
+    "failed to resolve reference",
+    "503 service unavailable",
+];
+
+/// Error fragments that fail the same way on every attempt, even when a
+/// transient fragment also appears.
+const DETERMINISTIC_DOCKER_ERRORS: &[&str] = &["already in use", "conflict"];
+
+/// `docker run` options that take no value, for finding the image in a
+/// `docker run` argv.
+const DOCKER_RUN_BOOLEAN_FLAGS: &[&str] = &[
+    "--rm",
+    "-d",
+    "--detach",
+    "-i",
+    "--interactive",
+    "-t",
+    "--tty",
+    "-it",
+    "--init",
+    "--privileged",
+    "--read-only",
+];
+
+/// How a Docker argv may be retried.
+#[derive(Debug, PartialEq, Eq)]
+enum DockerCommand<'a> {
+    /// Runs a command inside a container (`run`, `exec`, `compose run`,
+    /// `compose exec`). It is never re-run: the command may have done
+    /// part of its work before failing, and running `step ca init` or
+    /// `change-pass` again can leave the CA half or doubly initialized.
+    /// Only the image of a `docker run` is prepared, with retries.
+    Container { image: Option<&'a str> },
+    /// Any other Docker command, retried as a whole.
+    Other,
+}
+
+/// Returns the first positional argument of `args`, skipping options and
+/// the values of those not listed in `boolean_flags`.
+fn first_positional<'a>(args: &[&'a str], boolean_flags: &[&str]) -> Option<&'a str> {
+    let mut args = args.iter();
+    while let Some(arg) = args.next() {
+        if !arg.starts_with('-') {
+            return Some(arg);
+        }
+        if !arg.contains('=') && !boolean_flags.contains(arg) {
+            args.next();
+        }
+    }
+    None
+}
+
+fn docker_command<'a>(args: &[&'a str]) -> DockerCommand<'a> {
+    match args.split_first() {
+        Some((&"run", rest)) => DockerCommand::Container {
+            image: first_positional(rest, DOCKER_RUN_BOOLEAN_FLAGS),
+        },
+        Some((&"exec", _)) => DockerCommand::Container { image: None },
+        Some((&"compose", rest)) if matches!(first_positional(rest, &[]), Some("run" | "exec")) => {
+            DockerCommand::Container { image: None }
+        }
+        _ => DockerCommand::Other,
+    }
+}
+
+pub(crate) fn set_docker_retries(retries: u32) {
+    DOCKER_RETRIES.store(retries, Ordering::Relaxed);
+}
+
+pub(crate) fn set_max_runtime(limit: Duration) {
+    let _ = RUN_DEADLINE.set((Instant::now() + limit, limit));
+}
+
+/// Fails when waiting `delay` more for `target` would run past
+/// `--max-runtime`, so a retry or poll loop stops with an error instead.
+pub(crate) fn ensure_run_budget(target: &str, delay: Duration, messages: &Messages) -> Result<()> {
+    match RUN_DEADLINE.get() {
+        Some(&(deadline, limit)) if outlasts(deadline, delay) => anyhow::bail!(
+            messages
+                .error_max_runtime_exceeded(&humantime::format_duration(limit).to_string(), target)
+        ),
+        _ => Ok(()),
+    }
+}
+
+fn outlasts(deadline: Instant, delay: Duration) -> bool {
+    Instant::now()
+        .checked_add(delay)
+        .is_none_or(|end| end > deadline)
+}
+
+fn is_transient_docker_error(message: &str) -> bool {
+    let message = message.to_ascii_lowercase();
+    TRANSIENT_DOCKER_ERRORS
+        .iter()
+        .any(|fragment| message.contains(fragment))
+        && !DETERMINISTIC_DOCKER_ERRORS
+            .iter()
+            .any(|fragment| message.contains(fragment))
+}
+
+/// Runs `attempt` until it succeeds, fails with a non-transient error,
+/// or `--docker-retries` is used up, backing off between attempts.
+fn with_docker_retries<T>(
+    context: &str,
+    messages: &Messages,
+    delay: Duration,
+    mut attempt: impl FnMut() -> Result<T>,
+) -> Result<T> {
+    let retries = DOCKER_RETRIES.load(Ordering::Relaxed);
+    let mut delay = delay;
+    for retry in 1..=retries {
+        match attempt() {
+            Ok(value) => return Ok(value),
+            Err(err) if is_transient_docker_error(&format!("{err:#}")) => {
+                ensure_run_budget(context, delay, messages)
+                    .map_err(|budget| err.context(budget.to_string()))?;
+                eprintln!(
+                    "{}",
+                    messages.infra_docker_retry(context, delay.as_secs(), retry, retries)
+                );
+                std::thread::sleep(delay);
+                delay = delay.saturating_mul(2);
+            }
+            Err(err) => return Err(err),
+        }
+    }
+    attempt()
+}
+
+/// Runs the Docker command `args` through `attempt`. Transient failures
+/// are retried per `--docker-retries`, except for container commands:
+/// those run once, after their image has been made present with retries.
+fn run_docker_retrying<T>(
+    args: &[&str],
+    context: &str,
+    messages: &Messages,
+    mut attempt: impl FnMut() -> Result<T>,
+) -> Result<T> {
+    match docker_command(args) {
+        DockerCommand::Container { image } => {
+            if let Some(image) = image {
+                ensure_docker_image(image, messages)?;
+            }
+            attempt()
+        }
+        DockerCommand::Other => {
+            with_docker_retries(context, messages, DOCKER_RETRY_BASE_DELAY, attempt)
+        }
+    }
+}
+
+/// Makes sure `image` is present locally before a container runs it.
+/// The presence check is retried when the Docker daemon cannot be
+/// reached, and a missing image is pulled with retries, so registry and
+/// daemon hiccups are absorbed here instead of by re-running the
+/// container. A present image is never pulled, which keeps images
+/// loaded with `docker load` usable offline.
+fn ensure_docker_image(image: &str, messages: &Messages) -> Result<()> {
+    let inspect_context = format!("docker image inspect {image}");
+    let present = with_docker_retries(&inspect_context, messages, DOCKER_RETRY_BASE_DELAY, || {
+        let output = ProcessCommand::new("docker")
+            .args(["image", "inspect", "--format", "{{.Id}}", image])
+            .output()
+            .with_context(|| messages.error_command_run_failed(&inspect_context))?;
+        if output.status.success() {
+            return Ok(true);
+        }
+        let stderr = String::from_utf8_lossy(&output.stderr);
+        if is_transient_docker_error(&stderr) {
+            anyhow::bail!(messages.error_command_failed_output(
+                &inspect_context,
+                &output.status.to_string(),
+                stderr.trim_end()
+            ));
+        }
+        Ok(false)
+    })?;
+    if present {
+        return Ok(());
+    }
+    let pull_context = format!("docker pull {image}");
+    with_docker_retries(&pull_context, messages, DOCKER_RETRY_BASE_DELAY, || {
+        run_capturing_stderr(
+            ProcessCommand::new("docker").args(["pull", image]),
+            &pull_context,
+            messages,
+        )
+    })
+}
+
 pub(crate) fn run_docker(args: &[&str], context: &str, messages: &Messages) -> Result<()> {
     run_docker_with_env(args, &[], context, messages)
 }
 
+/// Runs `docker` with stdout inherited and stderr streamed to the
+/// terminal as it arrives. When the command fails, the last
+/// [`STDERR_TAIL_LINES`] lines of stderr are part of the error, so
+/// callers that only see the error (for example `--summary-json`) still
+/// get the reason step-ca or Docker gave. Transient Docker failures are
+/// retried per `--docker-retries`; container commands are never re-run
+/// (see [`run_docker_retrying`]).
 pub(crate) fn run_docker_with_env(
     args: &[&str],
     env: &[(&str, &str)],
     context: &str,
     messages: &Messages,
 ) -> Result<()> {
-    let mut cmd = ProcessCommand::new("docker");
-    cmd.args(args);
-    for (key, value) in env {
-        cmd.env(key, value);
-    }
-    let status = cmd
-        .status()
+    run_docker_retrying(args, context, messages, || {
+        let mut cmd = ProcessCommand::new("docker");
+        cmd.args(args);
+        for (key, value) in env {
+            cmd.env(key, value);
+        }
+        run_capturing_stderr(&mut cmd, context, messages)
+    })
+}
+
+fn run_capturing_stderr(
+    cmd: &mut ProcessCommand,
+    context: &str,
+    messages: &Messages,
+) -> Result<()> {
+    let mut child = cmd
+        .stderr(Stdio::piped())
+        .spawn()
+        .with_context(|| messages.error_command_run_failed(context))?;
+    let stderr_tail = child
+        .stderr
+        .take()
+        .map(|pipe| tee_stderr(pipe, &mut std::io::stderr()))
+        .unwrap_or_default();
+    let status = child
+        .wait()
         .with_context(|| messages.error_command_run_failed(context))?;
     if !status.success() {
-        anyhow::bail!(messages.error_command_failed_status(context, &status.to_string()));
+        if stderr_tail.is_empty() {
+            anyhow::bail!(messages.error_command_failed_status(context, &status.to_string()));
+        }
+        anyhow::bail!(messages.error_command_failed_output(
+            context,
+            &status.to_string(),
+            &stderr_tail
+        ));
     }
     Ok(())
 }
 
+/// Copies `pipe` to `out` line by line until EOF and returns the last
+/// [`STDERR_TAIL_LINES`] non-empty lines.
+fn tee_stderr(pipe: impl Read, out: &mut impl Write) -> String {
+    let mut tail = VecDeque::with_capacity(STDERR_TAIL_LINES);
+    for line in BufReader::new(pipe)
+        .split(b'\n')
+        .map_while(std::io::Result::ok)
+    {
+        let _ = out.write_all(&line);
+        let _ = out.write_all(b"\n");
+        let line = String::from_utf8_lossy(&line).trim_end().to_string();
+        if line.is_empty() {
+            continue;
+        }
+        if tail.len() == STDERR_TAIL_LINES {
+            tail.pop_front();
+        }
+        tail.push_back(line);
+    }
+    Vec::from(tail).join("\n")
+}
+
+/// Runs `docker` like [`run_docker`] but captures stdout followed by
+/// stderr instead of streaming them, for short-lived containers whose
+/// output the caller parses. On failure the captured output is part of
+/// the error.
+pub(crate) fn docker_combined_output(
+    args: &[&str],
+    context: &str,
+    messages: &Messages,
+) -> Result<String> {
+    run_docker_retrying(args, context, messages, || {
+        let output = ProcessCommand::new("docker")
+            .args(args)
+            .output()
+            .with_context(|| messages.error_command_run_failed(context))?;
+        let mut combined = String::from_utf8_lossy(&output.stdout).into_owned();
+        combined.push_str(&String::from_utf8_lossy(&output.stderr));
+        if !output.status.success() {
+            anyhow::bail!(messages.error_command_failed_output(
+                context,
+                &output.status.to_string(),
+                combined.trim_end()
+            ));
+        }
+        Ok(combined)
+    })
+}
+
 pub(crate) fn docker_compose_output(
     compose_file: &Path,
     profile: Option<&str>,
@@ -1932,6 +2284,18 @@ mod tests {
         );
     }
 
+    /// The offline image check must use `image inspect`, which reads only
+    /// the local image store, and name the exact image reference.
+    #[test]
+    fn build_local_image_check_args_inspects_without_pulling() {
+        let image = "smallstep/step-ca@sha256:0123";
+        let args = build_local_image_check_args(image);
+
+        assert_eq!(args[..2], ["image", "inspect"]);
+        assert_eq!(args.last(), Some(&image));
+        assert!(!args.iter().any(|a| *a == "pull" || *a == "run"));
+    }
+
     /// The sweep container must mount ONLY the secrets directory and chown
     /// with `--no-dereference` so it never follows a symlink out of the
     /// mount. It is also the one deliberately-root container.
@@ -4312,6 +4676,7 @@ tls_key_path = \"/app/bootroot-http01/tls/server.key\"
             stepca_advertise_addr: None,
             postgres_host_port: None,
             no_build: false,
+            secrets_dir: PathBuf::from("secrets"),
         };
         let err = run_infra_install(&args, &messages).unwrap_err();
         let msg = err.to_string();
@@ -4321,6 +4686,61 @@ tls_key_path = \"/app/bootroot-http01/tls/server.key\"
         );
     }
 
+    /// A `--secrets-dir` that names an existing file is rejected before
+    /// any directory or `.env` is written.
+    #[test]
+    fn infra_install_rejects_secrets_dir_that_is_a_file() {
+        use crate::cli::args::ComposeFileArgs;
+
+        let messages = crate::i18n::test_messages();
+        let dir = tempfile::tempdir().unwrap();
+        let compose_path = dir.path().join("docker-compose.yml");
+        std::fs::write(&compose_path, "services:\n  openbao:\n    image: openbao\n").unwrap();
+        std::fs::write(dir.path().join("not-a-dir"), "").unwrap();
+
+        let args = InfraInstallArgs {
+            compose_file: ComposeFileArgs {
+                compose_file: compose_path,
+            },
+            services: vec!["openbao".to_string()],
+            image_archive_dir: None,
+            restart_policy: "always".to_string(),
+            openbao_url: "http://localhost:8200".to_string(),
+            openbao_bind: None,
+            openbao_tls_required: false,
+            openbao_bind_wildcard: false,
+            openbao_advertise_addr: None,
+            http01_admin_bind: None,
+            http01_admin_tls_required: false,
+            http01_admin_bind_wildcard: false,
+            http01_admin_advertise_addr: None,
+            stepca_bind: None,
+            stepca_bind_wildcard: false,
+            stepca_advertise_addr: None,
+            postgres_host_port: None,
+            no_build: false,
+            secrets_dir: PathBuf::from("not-a-dir"),
+        };
+        let err = run_infra_install(&args, &messages).unwrap_err();
+        assert!(
+            err.to_string().contains("is not a directory"),
+            "unexpected error: {err}"
+        );
+        assert!(!dir.path().join("certs").exists());
+        assert!(!dir.path().join(".env").exists());
+    }
+
+    #[test]
+    fn secrets_dir_env_value_keeps_relative_paths_host_relative() {
+        assert_eq!(secrets_dir_env_value(Path::new("secrets")), "./secrets");
+        assert_eq!(secrets_dir_env_value(Path::new("./secrets")), "./secrets");
+        assert_eq!(secrets_dir_env_value(Path::new("../shared")), "../shared");
+        assert_eq!(
+            secrets_dir_env_value(Path::new("/var/lib/bootroot")),
+            "/var/lib/bootroot"
+        );
+    }
+
     /// Regression: `resolve_http01_exposed_override` must resolve a
     /// relative `secrets_dir` against `compose_dir`, not the process
     /// cwd, so that `infra up` from a different directory validates
@@ -4378,4 +4798,119 @@ tls_key_path = \"/app/bootroot-http01/tls/server.key\"
             "error must reference compose_dir-relative path, got: {err}"
         );
     }
+
+    #[test]
+    fn tee_stderr_streams_everything_and_keeps_the_tail() {
+        let input: String = (1..=25).map(|n| format!("line {n}\n\n")).collect();
+        let mut streamed = Vec::new();
+
+        let tail = tee_stderr(input.as_bytes(), &mut streamed);
+
+        assert_eq!(String::from_utf8(streamed).unwrap(), input);
+        let kept: Vec<&str> = tail.lines().collect();
+        assert_eq!(kept.len(), STDERR_TAIL_LINES);
+        assert_eq!(kept.first(), Some(&"line 6"));
+        assert_eq!(kept.last(), Some(&"line 25"));
+    }
+
+    #[test]
+    fn run_capturing_stderr_error_includes_stderr() {
+        let mut cmd = ProcessCommand::new("sh");
+        cmd.args([
+            "-c",
+            "echo 'open /home/step/secrets/password: no such file' >&2; exit 1",
+        ]);
+
+        let err = run_capturing_stderr(&mut cmd, "docker step-ca import", &test_messages())
+            .expect_err("command fails");
+
+        let message = err.to_string();
+        assert!(
+            message.contains("docker step-ca import failed"),
+            "{message}"
+        );
+        assert!(message.contains("password: no such file"), "{message}");
+    }
+
+    #[test]
+    fn transient_docker_errors_are_retryable() {
+        assert!(is_transient_docker_error(
+            "docker pull failed: toomanyrequests: You have reached your pull rate limit"
+        ));
+        assert!(is_transient_docker_error(
+            "Cannot connect to the Docker daemon at unix:///var/run/docker.sock"
+        ));
+        assert!(!is_transient_docker_error(
+            "Conflict. The container name \"/bootroot-ca\" is already in use"
+        ));
+        assert!(!is_transient_docker_error("step-ca init: invalid password"));
+    }
+
+    #[test]
+    fn docker_command_finds_container_commands_and_their_image() {
+        let image = "smallstep/step-ca@sha256:0123";
+        assert_eq!(
+            docker_command(&[
+                "run",
+                "--user",
+                "1000:1000",
+                "--rm",
+                "--entrypoint",
+                "chown",
+                "-v",
+                "/srv/secrets:/home/step",
+                image,
+                "step",
+                "ca",
+                "init",
+            ]),
+            DockerCommand::Container { image: Some(image) }
+        );
+        assert_eq!(
+            docker_command(&["exec", "bootroot-ca", "step", "ca", "health"]),
+            DockerCommand::Container { image: None }
+        );
+        assert_eq!(
+            docker_command(&["compose", "-f", "compose.yml", "run", "step-ca"]),
+            DockerCommand::Container { image: None }
+        );
+        assert_eq!(
+            docker_command(&["compose", "-f", "compose.yml", "up", "-d"]),
+            DockerCommand::Other
+        );
+        assert_eq!(docker_command(&["pull", image]), DockerCommand::Other);
+    }
+
+    #[test]
+    fn with_docker_retries_retries_only_transient_failures() {
+        let messages = test_messages();
+        let mut calls = 0;
+        let value = with_docker_retries("docker pull", &messages, Duration::ZERO, || {
+            calls += 1;
+            if calls < 3 {
+                anyhow::bail!("error pulling image: TLS handshake timeout");
+            }
+            Ok(calls)
+        })
+        .expect("third attempt succeeds");
+        assert_eq!(value, 3);
+
+        let mut calls = 0;
+        let err = with_docker_retries("docker run", &messages, Duration::ZERO, || -> Result<()> {
+            calls += 1;
+            anyhow::bail!("name \"/bootroot-ca\" is already in use")
+        })
+        .expect_err("deterministic failure");
+        assert_eq!(calls, 1);
+        assert!(err.to_string().contains("already in use"));
+    }
+
+    #[test]
+    fn outlasts_detects_a_wait_past_the_deadline() {
+        let deadline = Instant::now() + Duration::from_secs(60);
+
+        assert!(!outlasts(deadline, Duration::from_secs(1)));
+        assert!(outlasts(deadline, Duration::from_secs(120)));
+        assert!(outlasts(Instant::now(), Duration::from_secs(1)));
+    }
 }
@@ -10,9 +10,11 @@ pub(crate) use constants::openbao_constants::{
     POLICY_BOOTROOT_INFRA_ROTATE, ROTATE_SELF_MINT_NUM_USES, SECRET_ID_TTL, TOKEN_TTL,
 };
 pub(crate) use constants::{
-    CA_CERTS_DIR, CA_INTERMEDIATE_CERT_FILENAME, CA_ROOT_CERT_FILENAME, DEFAULT_CERT_DURATION,
+    CA_CERTS_DIR, CA_INTERMEDIATE_CERT_FILENAME, CA_ROOT_CERT_FILENAME, DEFAULT_CA_ADDRESS,
+    DEFAULT_CA_DNS, DEFAULT_CA_NAME, DEFAULT_CA_PROVISIONER, DEFAULT_CERT_DURATION,
     DEFAULT_COMPOSE_FILE, DEFAULT_KV_MOUNT, DEFAULT_OPENBAO_URL, DEFAULT_SECRETS_DIR,
-    DEFAULT_STEPCA_PROVISIONER, HTTP01_ADMIN_INFRA_CERT_KEY, HTTP01_ADMIN_TLS_CERT_REL_PATH,
+    DEFAULT_STEP_CA_IMAGE, DEFAULT_STEPCA_PROVISIONER, DEFAULT_STEPCA_URL,
+    HTTP01_ADMIN_INFRA_CERT_KEY, HTTP01_ADMIN_TLS_CERT_REL_PATH,
     HTTP01_ADMIN_TLS_DEFAULT_NOT_AFTER, HTTP01_ADMIN_TLS_DEFAULT_RENEW_BEFORE,
     HTTP01_ADMIN_TLS_KEY_REL_PATH, HTTP01_EXPOSED_COMPOSE_OVERRIDE_NAME, OPENBAO_AGENT_DIR,
     OPENBAO_AGENT_RESPONDER_DIR, OPENBAO_AGENT_ROLE_ID_NAME, OPENBAO_AGENT_SECRET_ID_NAME,
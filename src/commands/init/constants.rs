@@ -3,6 +3,11 @@ pub(crate) const DEFAULT_KV_MOUNT: &str = "secret";
 pub(crate) const DEFAULT_SECRETS_DIR: &str = "secrets";
 pub(crate) const DEFAULT_COMPOSE_FILE: &str = "docker-compose.yml";
 pub(crate) const DEFAULT_STEPCA_PROVISIONER: &str = "acme";
+/// Host-side step-ca base URL published by the compose stack.
+pub(crate) const DEFAULT_STEPCA_URL: &str = "https://localhost:9000";
+/// Image the `step` helper containers run in `init` and `rotate`
+/// (`--ca-image`). Matches the compose step-ca server image.
+pub(crate) const DEFAULT_STEP_CA_IMAGE: &str = "smallstep/step-ca:0.30.2";
 
 /// Default `defaultTLSCertDuration` embedded in the ACME provisioner
 /// of `ca.json` / `ca.json.ctmpl`. Matches step-ca's own default.
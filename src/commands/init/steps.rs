@@ -1,5 +1,7 @@
+mod bootstrap_result;
 mod ca_certs;
 mod database;
+mod existing_ca;
 pub(crate) mod http01_admin_tls;
 mod openbao_setup;
 pub(crate) mod openbao_tls;
@@ -7,6 +9,7 @@ mod orchestrator;
 mod prompts;
 mod responder_setup;
 mod secrets;
+mod smoke_test;
 pub(crate) mod stepca_setup;
 
 use std::path::PathBuf;
@@ -614,9 +617,20 @@ pub(super) mod test_support {
             compose: crate::cli::args::ComposeFileArgs {
                 compose_file: PathBuf::from("docker-compose.yml"),
             },
+            step_ca_image: crate::cli::args::StepCaImageArgs {
+                ca_image: crate::commands::init::DEFAULT_STEP_CA_IMAGE.to_string(),
+            },
+            ca_init: crate::cli::args::StepCaInitArgs {
+                name: super::super::constants::DEFAULT_CA_NAME.to_string(),
+                dns: super::super::constants::DEFAULT_CA_DNS.to_string(),
+                address: super::super::constants::DEFAULT_CA_ADDRESS.to_string(),
+            },
+            offline: false,
+            verify: false,
             enable: Vec::new(),
             skip: Vec::new(),
             summary_json: None,
+            bootstrap_result: None,
             root_token: crate::cli::args::RootTokenArgs { root_token: None },
             unseal_key: Vec::new(),
             openbao_unseal_from_file: None,
@@ -639,6 +653,12 @@ pub(super) mod test_support {
             no_eab: false,
             save_unseal_keys: false,
             no_save_unseal_keys: false,
+            root_cert: None,
+            root_key: None,
+            root_key_password_file: None,
+            intermediate_cert: None,
+            intermediate_key: None,
+            intermediate_key_password_file: None,
             reinit_mode: false,
             root_token_output: None,
         }
@@ -0,0 +1,125 @@
+//! `bootroot init --bootstrap-result`: a versioned JSON hand-off that
+//! carries what a `bootroot-agent` needs to enrol against the new CA.
+//!
+//! `--summary-json` records the whole init run (root token, unseal keys,
+//! `AppRole` outputs); this file holds only the agent-facing subset. Its
+//! `eab` object has the shape the agent's `--eab-file` reads, and
+//! `acmeDirectoryUrl` is the value for the agent's `server` setting.
+//! Bump [`BOOTSTRAP_RESULT_SCHEMA_VERSION`] whenever a field changes
+//! meaning or is removed.
+
+use std::path::Path;
+
+use anyhow::Result;
+use serde::Serialize;
+
+use super::super::constants::{CA_CERTS_DIR, CA_ROOT_CERT_FILENAME};
+use super::super::types::EabCredentials;
+use super::read_ca_cert_fingerprint;
+use crate::i18n::Messages;
+
+pub(super) const BOOTSTRAP_RESULT_SCHEMA_VERSION: u32 = 1;
+/// step-ca address agents use when `state.json` records no
+/// `stepca_advertise_addr` (the loopback compose port).
+const DEFAULT_STEPCA_CLIENT_ADDR: &str = "localhost:9000";
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+pub(super) struct BootstrapResult {
+    pub(super) schema_version: u32,
+    pub(super) acme_directory_url: String,
+    pub(super) provisioner: String,
+    /// SHA-256 of the root CA certificate (DER), lowercase hex.
+    pub(super) root_fingerprint: String,
+    /// `null` when init registered no EAB credentials.
+    pub(super) eab: Option<EabCredentials>,
+}
+
+/// Assembles the hand-off from the CA material init left in
+/// `secrets_dir`.
+///
+/// # Errors
+/// Returns an error if the root certificate is missing or unparsable, or
+/// the step-ca address does not form a valid directory URL.
+pub(super) async fn build_bootstrap_result(
+    secrets_dir: &Path,
+    stepca_advertise_addr: Option<&str>,
+    provisioner: &str,
+    eab: Option<&EabCredentials>,
+    messages: &Messages,
+) -> Result<BootstrapResult> {
+    let root_path = secrets_dir.join(CA_CERTS_DIR).join(CA_ROOT_CERT_FILENAME);
+    Ok(BootstrapResult {
+        schema_version: BOOTSTRAP_RESULT_SCHEMA_VERSION,
+        acme_directory_url: acme_directory_url(stepca_advertise_addr, provisioner)?,
+        provisioner: provisioner.to_string(),
+        root_fingerprint: read_ca_cert_fingerprint(&root_path, messages).await?,
+        eab: eab.cloned(),
+    })
+}
+
+pub(super) fn acme_directory_url(
+    stepca_advertise_addr: Option<&str>,
+    provisioner: &str,
+) -> Result<String> {
+    let addr = stepca_advertise_addr.unwrap_or(DEFAULT_STEPCA_CLIENT_ADDR);
+    bootroot::config::provisioner_directory_url(
+        &format!("https://{addr}/acme/acme/directory"),
+        provisioner,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use std::fs;
+
+    use tempfile::tempdir;
+
+    use super::super::test_support::{test_cert_pem, test_messages};
+    use super::*;
+
+    #[test]
+    fn test_acme_directory_url_uses_advertise_addr_and_provisioner() {
+        assert_eq!(
+            acme_directory_url(None, "acme").unwrap(),
+            "https://localhost:9000/acme/acme/directory"
+        );
+        assert_eq!(
+            acme_directory_url(Some("10.0.0.5:9000"), "edge").unwrap(),
+            "https://10.0.0.5:9000/acme/edge/directory"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_bootstrap_result_serializes_versioned_agent_shape() {
+        let dir = tempdir().unwrap();
+        let certs_dir = dir.path().join(CA_CERTS_DIR);
+        fs::create_dir_all(&certs_dir).unwrap();
+        fs::write(
+            certs_dir.join(CA_ROOT_CERT_FILENAME),
+            test_cert_pem("Bootroot Root CA"),
+        )
+        .unwrap();
+        let eab = EabCredentials {
+            kid: "kid-1".to_string(),
+            hmac: "hmac-1".to_string(),
+        };
+
+        let result = build_bootstrap_result(dir.path(), None, "acme", Some(&eab), &test_messages())
+            .await
+            .unwrap();
+        let value = serde_json::to_value(&result).unwrap();
+
+        assert_eq!(value["schemaVersion"], BOOTSTRAP_RESULT_SCHEMA_VERSION);
+        assert_eq!(
+            value["acmeDirectoryUrl"],
+            "https://localhost:9000/acme/acme/directory"
+        );
+        assert_eq!(value["provisioner"], "acme");
+        assert_eq!(value["rootFingerprint"].as_str().unwrap().len(), 64);
+        let agent_eab: bootroot::eab::EabCredentials =
+            serde_json::from_value(value["eab"].clone()).unwrap();
+        assert_eq!(agent_eab.kid, "kid-1");
+        assert_eq!(agent_eab.hmac, "hmac-1");
+    }
+}
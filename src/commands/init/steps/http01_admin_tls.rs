@@ -25,6 +25,7 @@ use crate::state::{InfraCertEntry, ReloadStrategy, StateFile};
 pub(in crate::commands::init) fn issue_http01_admin_tls_cert(
     secrets_dir: &Path,
     sans: &[&str],
+    image: &str,
     messages: &Messages,
 ) -> Result<()> {
     let cert_path = secrets_dir.join(HTTP01_ADMIN_TLS_CERT_REL_PATH);
@@ -55,7 +56,7 @@ pub(in crate::commands::init) fn issue_http01_admin_tls_cert(
         &secrets_mount,
         "-v",
         &tls_mount,
-        "smallstep/step-ca:0.30.2",
+        image,
         "step",
         "certificate",
         "create",
@@ -193,6 +194,7 @@ fn set_key_permissions_sync(path: &Path) -> Result<()> {
 pub(crate) fn reissue_http01_admin_tls_cert(
     secrets_dir: &Path,
     entry: &InfraCertEntry,
+    image: &str,
     messages: &Messages,
 ) -> Result<()> {
     let san_refs: Vec<&str> = entry.sans.iter().map(String::as_str).collect();
@@ -201,7 +203,7 @@ pub(crate) fn reissue_http01_admin_tls_cert(
     } else {
         san_refs
     };
-    issue_http01_admin_tls_cert(secrets_dir, &sans, messages)
+    issue_http01_admin_tls_cert(secrets_dir, &sans, image, messages)
 }
 
 /// Strips `tls_cert_path` and `tls_key_path` lines from the responder
@@ -25,6 +25,7 @@ pub(in crate::commands::init) fn issue_openbao_tls_cert(
     compose_dir: &Path,
     secrets_dir: &Path,
     sans: &[&str],
+    image: &str,
     messages: &Messages,
 ) -> Result<()> {
     let cert_path = compose_dir.join(OPENBAO_TLS_CERT_PATH);
@@ -55,7 +56,7 @@ pub(in crate::commands::init) fn issue_openbao_tls_cert(
         &secrets_mount,
         "-v",
         &tls_mount,
-        "smallstep/step-ca:0.30.2",
+        image,
         "step",
         "certificate",
         "create",
@@ -337,6 +338,7 @@ pub(crate) fn reissue_openbao_tls_cert(
     compose_dir: &Path,
     secrets_dir: &Path,
     entry: &InfraCertEntry,
+    image: &str,
     messages: &Messages,
 ) -> Result<()> {
     let san_refs: Vec<&str> = entry.sans.iter().map(String::as_str).collect();
@@ -345,7 +347,7 @@ pub(crate) fn reissue_openbao_tls_cert(
     } else {
         san_refs
     };
-    issue_openbao_tls_cert(compose_dir, secrets_dir, &sans, messages)
+    issue_openbao_tls_cert(compose_dir, secrets_dir, &sans, image, messages)
 }
 
 #[cfg(test)]
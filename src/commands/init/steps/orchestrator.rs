@@ -12,7 +12,9 @@ use super::super::types::{
 };
 use super::InitRollback;
 use super::RollbackFile;
+use super::bootstrap_result::build_bootstrap_result;
 use super::database::{check_db_connectivity, resolve_db_dsn_for_init};
+use super::existing_ca::ExistingCa;
 use super::http01_admin_tls::{
     build_http01_admin_tls_sans, issue_http01_admin_tls_cert, record_http01_admin_infra_cert,
 };
@@ -31,6 +33,7 @@ use super::responder_setup::{
     write_responder_files,
 };
 use super::secrets::{maybe_register_eab, resolve_init_secrets};
+use super::smoke_test::run_init_smoke_test;
 use super::stepca_setup::{
     ensure_step_ca_initialized, update_ca_json_with_backup, write_password_file_with_backup,
     write_stepca_templates,
@@ -44,8 +47,8 @@ use crate::commands::guardrails::{
     validate_openbao_override_binding, validate_openbao_override_scope, validate_openbao_tls,
 };
 use crate::commands::infra::{
-    ensure_init_prereqs_ready, has_http01_admin_bind_intent, has_openbao_bind_intent,
-    resolve_stepca_exposed_override, run_docker,
+    ensure_image_present_locally, ensure_init_prereqs_ready, has_http01_admin_bind_intent,
+    has_openbao_bind_intent, resolve_stepca_exposed_override, run_docker,
 };
 use crate::commands::init::{
     HTTP01_ADMIN_TLS_CERT_REL_PATH, HTTP01_ADMIN_TLS_KEY_REL_PATH,
@@ -77,6 +80,9 @@ pub(crate) async fn run_init(args: &InitArgs, messages: &Messages) -> Result<()>
     if let Some(out) = args.summary_json.as_deref() {
         crate::commands::reinit::validate_summary_json_output_path(out, messages)?;
     }
+    if let Some(out) = args.bootstrap_result.as_deref() {
+        crate::commands::reinit::validate_summary_json_output_path(out, messages)?;
+    }
     if let Some(out) = args.root_token_output.as_deref() {
         crate::commands::reinit::validate_root_token_output_path(out, messages)?;
     }
@@ -91,6 +97,9 @@ pub(crate) async fn run_init(args: &InitArgs, messages: &Messages) -> Result<()>
 
     // Only check openbao + postgres; step-ca may not be bootstrapped yet.
     ensure_init_prereqs_ready(&args.compose.compose_file, messages)?;
+    if args.offline {
+        ensure_image_present_locally(&args.step_ca_image.ca_image, messages)?;
+    }
 
     let mut client =
         OpenBaoClient::with_local_trust(&args.openbao.openbao_url, &args.secrets_dir.secrets_dir)
@@ -116,6 +125,20 @@ pub(crate) async fn run_init(args: &InitArgs, messages: &Messages) -> Result<()>
             if let Some(summary_json) = args.summary_json.as_deref() {
                 write_init_summary_json(summary_json, &summary).await?;
             }
+            if let Some(bootstrap_result_path) = args.bootstrap_result.as_deref() {
+                let stepca_advertise_addr = StateFile::load(&state_path)
+                    .ok()
+                    .and_then(|state| state.stepca_advertise_addr);
+                let result = build_bootstrap_result(
+                    &args.secrets_dir.secrets_dir,
+                    stepca_advertise_addr.as_deref(),
+                    &args.stepca_provisioner,
+                    summary.eab.as_ref(),
+                    messages,
+                )
+                .await?;
+                write_secret_json_file(bootstrap_result_path, &result).await?;
+            }
             // Print the summary *before* attempting the optional
             // root-token file write so a write failure does not hide the
             // freshly issued root token from the operator's terminal —
@@ -165,6 +188,20 @@ pub(crate) async fn run_init(args: &InitArgs, messages: &Messages) -> Result<()>
                 .await?;
             }
 
+            // Runs last so every secret above is already captured when
+            // the test issuance fails.
+            if args.verify {
+                let state = StateFile::load(&state_path)?;
+                run_init_smoke_test(
+                    &args.secrets_dir.secrets_dir,
+                    &args.stepca_provisioner,
+                    &summary,
+                    &state,
+                    messages,
+                )
+                .await?;
+            }
+
             Ok(())
         }
         Err(err) => {
@@ -227,12 +264,19 @@ async fn diagnose_partial_init(
 /// path is deliberately defensive — `--summary-json` may be invoked
 /// from the `init` flow (not just `reinit`) where no preflight runs.
 async fn write_init_summary_json(path: &Path, summary: &InitSummary) -> Result<()> {
+    write_secret_json_file(path, summary).await
+}
+
+/// Writes `value` as pretty JSON to `path` with the same atomic `0600`
+/// discipline as [`write_init_summary_json`]. The bootstrap result
+/// carries EAB credentials, so it needs the same protection.
+async fn write_secret_json_file<T: serde::Serialize>(path: &Path, value: &T) -> Result<()> {
     if let Some(parent) = path.parent()
         && !parent.as_os_str().is_empty()
     {
         tokio::fs::create_dir_all(parent).await?;
     }
-    let payload = serde_json::to_string_pretty(summary)?;
+    let payload = serde_json::to_string_pretty(value)?;
     let path_buf = path.to_path_buf();
     tokio::task::spawn_blocking(move || -> std::io::Result<()> {
         use std::io::Write;
@@ -429,7 +473,14 @@ async fn run_init_inner(
         let stop_args = ["compose", "-f", &*compose_str, "stop", "step-ca"];
         let _ = run_docker(&stop_args, "docker compose stop step-ca", messages);
     }
-    let step_ca_result = ensure_step_ca_initialized(&secrets_dir, messages)?;
+    let existing_ca = ExistingCa::from_args(args);
+    let step_ca_result = ensure_step_ca_initialized(
+        &secrets_dir,
+        existing_ca.as_ref(),
+        &args.ca_init,
+        &args.step_ca_image.ca_image,
+        messages,
+    )?;
     if step_ca_result == super::super::types::StepCaInitResult::Initialized {
         // Fix ownership: step-ca init may create files with different
         // ownership.  Re-apply correct perms before anything reads them.
@@ -562,7 +613,12 @@ async fn run_init_inner(
         let sans =
             build_http01_admin_tls_sans(bind_addr, state.http01_admin_advertise_addr.as_deref());
         let san_refs: Vec<&str> = sans.iter().map(String::as_str).collect();
-        issue_http01_admin_tls_cert(&secrets_dir, &san_refs, messages)?;
+        issue_http01_admin_tls_cert(
+            &secrets_dir,
+            &san_refs,
+            &args.step_ca_image.ca_image,
+            messages,
+        )?;
         // Track TLS artifacts for rollback cleanup.
         rollback
             .tls_artifacts
@@ -705,6 +761,7 @@ async fn run_init_inner(
             compose_dir,
             &args.secrets_dir.secrets_dir,
             &san_refs,
+            &args.step_ca_image.ca_image,
             messages,
         )?;
 
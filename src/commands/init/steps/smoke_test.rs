@@ -0,0 +1,139 @@
+//! `bootroot init --verify`: one end-to-end issuance against the CA that
+//! init just bootstrapped.
+//!
+//! The check runs the agent's ACME flow ([`bootroot::acme::obtain_certificate`])
+//! from the host with the generated EAB credentials, trusting only the new
+//! root, and answers HTTP-01 through the responder init configured. step-ca
+//! resolves the test domain through a temporary alias on the responder
+//! container, which is dropped again afterwards. The issued certificate is
+//! discarded. A failure never rolls init back: the CA, `OpenBao` state and
+//! written secrets stay in place so the operator can fix the cause.
+
+use std::path::Path;
+
+use anyhow::{Context, Result};
+use bootroot::config::{DaemonProfileSettings, Settings};
+
+use super::super::constants::{CA_CERTS_DIR, CA_ROOT_CERT_FILENAME};
+use super::super::types::InitSummary;
+use super::bootstrap_result::acme_directory_url;
+use crate::commands::dns_alias::{reconcile_dns_aliases, register_extra_dns_alias};
+use crate::i18n::Messages;
+use crate::state::StateFile;
+
+const SMOKE_TEST_SERVICE_NAME: &str = "init-verify";
+const SMOKE_TEST_INSTANCE_ID: &str = "0";
+const SMOKE_TEST_HOSTNAME: &str = "bootroot";
+
+/// Issues one throwaway certificate through the new CA.
+///
+/// # Errors
+/// Returns an error if no responder admin URL is known, the test alias
+/// cannot be applied, or the issuance fails.
+pub(super) async fn run_init_smoke_test(
+    secrets_dir: &Path,
+    provisioner: &str,
+    summary: &InitSummary,
+    state: &StateFile,
+    messages: &Messages,
+) -> Result<()> {
+    let responder_url = summary
+        .responder_url
+        .as_deref()
+        .ok_or_else(|| anyhow::anyhow!(messages.error_init_verify_responder_missing()))?;
+    let settings = smoke_test_settings(
+        secrets_dir,
+        state.stepca_advertise_addr.as_deref(),
+        provisioner,
+        responder_url,
+        &summary.http_hmac,
+    )?;
+    let profile = smoke_test_profile();
+    let domain = bootroot::config::profile_domain(&settings, &profile);
+    println!("{}", messages.init_verify_running(&domain));
+
+    register_extra_dns_alias(state, &domain, messages)?;
+    let result =
+        bootroot::acme::obtain_certificate(&settings, &profile, summary.eab.clone(), false).await;
+    reconcile_dns_aliases(state, messages)?;
+
+    result
+        .map_err(|err| anyhow::anyhow!(messages.error_init_verify_failed(&format!("{err:#}"))))?;
+    println!("{}", messages.init_verify_passed(&domain));
+    Ok(())
+}
+
+/// Agent settings with built-in defaults, pointed at the new CA. No
+/// `agent.toml` is read so a stray file in the working directory cannot
+/// change what is being verified.
+fn smoke_test_settings(
+    secrets_dir: &Path,
+    stepca_advertise_addr: Option<&str>,
+    provisioner: &str,
+    responder_url: &str,
+    responder_hmac: &str,
+) -> Result<Settings> {
+    let config_dir = tempfile::tempdir().context("Failed to create temp dir")?;
+    let mut settings = Settings::new(Some(config_dir.path().join("agent.toml")))?;
+    settings.server = acme_directory_url(stepca_advertise_addr, provisioner)?;
+    settings.trust.ca_bundle_path =
+        Some(secrets_dir.join(CA_CERTS_DIR).join(CA_ROOT_CERT_FILENAME));
+    settings.acme.http_responder_url = responder_url.to_string();
+    settings.acme.http_responder_hmac = responder_hmac.to_string();
+    Ok(settings)
+}
+
+/// Transient profile for the test order. Output paths stay empty because
+/// the certificate is never written.
+fn smoke_test_profile() -> DaemonProfileSettings {
+    DaemonProfileSettings {
+        service_name: SMOKE_TEST_SERVICE_NAME.to_string(),
+        instance_id: SMOKE_TEST_INSTANCE_ID.to_string(),
+        hostname: SMOKE_TEST_HOSTNAME.to_string(),
+        ..DaemonProfileSettings::default()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_smoke_test_settings_target_new_ca() {
+        let settings = smoke_test_settings(
+            Path::new("/srv/secrets"),
+            Some("10.0.0.5:9000"),
+            "acme",
+            "http://localhost:8080",
+            "hmac-1",
+        )
+        .unwrap();
+
+        assert_eq!(settings.server, "https://10.0.0.5:9000/acme/acme/directory");
+        assert_eq!(
+            settings.trust.ca_bundle_path.as_deref(),
+            Some(Path::new("/srv/secrets/certs/root_ca.crt"))
+        );
+        assert_eq!(settings.acme.http_responder_url, "http://localhost:8080");
+        assert_eq!(settings.acme.http_responder_hmac, "hmac-1");
+    }
+
+    #[test]
+    fn test_smoke_test_profile_domain() {
+        let settings = smoke_test_settings(
+            Path::new("secrets"),
+            None,
+            "acme",
+            "http://localhost:8080",
+            "hmac-1",
+        )
+        .unwrap();
+
+        let domain = bootroot::config::profile_domain(&settings, &smoke_test_profile());
+
+        assert_eq!(
+            domain,
+            format!("0.init-verify.bootroot.{}", settings.domain)
+        );
+    }
+}
@@ -7,15 +7,21 @@ use bootroot::fs_util;
 
 use super::super::constants::openbao_constants::{PATH_STEPCA_DB, PATH_STEPCA_PASSWORD};
 use super::super::constants::{
-    DEFAULT_CA_ADDRESS, DEFAULT_CA_DNS, DEFAULT_CA_NAME, DEFAULT_CA_PROVISIONER,
-    RESPONDER_TEMPLATE_DIR, STEPCA_CA_JSON_TEMPLATE_NAME, STEPCA_PASSWORD_TEMPLATE_NAME,
+    CA_CERTS_DIR, CA_ROOT_CERT_FILENAME, DEFAULT_CA_ADDRESS, DEFAULT_CA_DNS, DEFAULT_CA_NAME,
+    DEFAULT_CA_PROVISIONER, RESPONDER_TEMPLATE_DIR, STEPCA_CA_JSON_TEMPLATE_NAME,
+    STEPCA_PASSWORD_TEMPLATE_NAME,
 };
 use super::super::paths::StepCaTemplatePaths;
 use super::super::types::StepCaInitResult;
 use super::RollbackFile;
-use crate::commands::infra::run_docker;
+use super::ca_certs::sha256_hex;
+use super::existing_ca::{self, ExistingCa, validate_existing_ca};
+use crate::cli::args::StepCaInitArgs;
+use crate::commands::infra::{docker_combined_output, run_docker};
 use crate::i18n::Messages;
 
+const ROOT_FINGERPRINT_LABEL: &str = "Root fingerprint:";
+
 pub(super) async fn write_stepca_templates(
     secrets_dir: &Path,
     kv_mount: &str,
@@ -232,14 +238,34 @@ pub(super) async fn update_ca_json_with_backup(
     })
 }
 
+/// Runs `step ca init` unless the CA material already exists.
+///
+/// With `existing_ca` set, the supplied root (and optional
+/// intermediate) is validated and imported instead of generating a new
+/// hierarchy. `settings` supplies the name, DNS names and address passed
+/// to `step ca init`. Every helper container runs `image` (`--ca-image`).
+///
+/// # Errors
+/// Returns an error if the CA already exists and `existing_ca` or a
+/// non-default `settings` value was given, since neither can change it.
 pub(super) fn ensure_step_ca_initialized(
     secrets_dir: &Path,
+    existing_ca: Option<&ExistingCa>,
+    settings: &StepCaInitArgs,
+    image: &str,
     messages: &Messages,
 ) -> Result<StepCaInitResult> {
     let config_path = secrets_dir.join("config").join("ca.json");
     let ca_key = secrets_dir.join("secrets").join("root_ca_key");
     let intermediate_key = secrets_dir.join("secrets").join("intermediate_ca_key");
     if config_path.exists() && ca_key.exists() && intermediate_key.exists() {
+        let flags = new_ca_only_flags(existing_ca, settings);
+        if !flags.is_empty() {
+            anyhow::bail!(messages.error_stepca_flags_need_new_ca(
+                &secrets_dir.display().to_string(),
+                &flags.join(", ")
+            ));
+        }
         return Ok(StepCaInitResult::Skipped);
     }
 
@@ -255,44 +281,136 @@ pub(super) fn ensure_step_ca_initialized(
     let meta = std::fs::metadata(secrets_dir)
         .with_context(|| messages.error_resolve_path_failed(&secrets_dir.display().to_string()))?;
     let user_arg = format!("{}:{}", meta.uid(), meta.gid());
-    let args = vec![
-        "run",
-        "--user",
-        &user_arg,
-        "--rm",
-        "-v",
-        &*mount,
-        "smallstep/step-ca:0.30.2",
-        "step",
-        "ca",
-        "init",
-        "--name",
-        DEFAULT_CA_NAME,
-        "--provisioner",
-        DEFAULT_CA_PROVISIONER,
-        "--dns",
-        DEFAULT_CA_DNS,
-        "--address",
-        DEFAULT_CA_ADDRESS,
-        "--password-file",
-        "/home/step/password.txt",
-        "--provisioner-password-file",
-        "/home/step/password.txt",
-        "--acme",
-    ];
-    run_docker(&args, "docker step-ca init", messages)?;
+    let existing_ca = existing_ca
+        .map(|ca| ca.canonicalize(messages))
+        .transpose()?;
+    if let Some(ca) = &existing_ca {
+        validate_existing_ca(ca, image, &user_arg, messages)?;
+    }
+
+    let mut args: Vec<String> = match &existing_ca {
+        Some(ca) => existing_ca::docker_run_prefix(ca, image, &mount, &user_arg, None),
+        None => ["run", "--user", &user_arg, "--rm", "-v", &*mount, image]
+            .into_iter()
+            .map(str::to_string)
+            .collect(),
+    };
+    args.extend(
+        [
+            "step",
+            "ca",
+            "init",
+            "--name",
+            &settings.name,
+            "--provisioner",
+            DEFAULT_CA_PROVISIONER,
+            "--dns",
+            &settings.dns,
+            "--address",
+            &settings.address,
+            "--password-file",
+            "/home/step/password.txt",
+            "--provisioner-password-file",
+            "/home/step/password.txt",
+            "--acme",
+        ]
+        .into_iter()
+        .map(str::to_string),
+    );
+    if let Some(ca) = &existing_ca {
+        args.extend(existing_ca::step_ca_init_root_flags(ca));
+    }
+    let args: Vec<&str> = args.iter().map(String::as_str).collect();
+    let output = docker_combined_output(&args, "docker step-ca init", messages)?;
+    print!("{output}");
+    if let Some(reported) = parse_root_fingerprint(&output) {
+        verify_root_fingerprint(secrets_dir, &reported, messages)?;
+    }
+
+    if let Some(ca) = &existing_ca {
+        for import in existing_ca::post_init_docker_args(ca, image, &mount, &user_arg) {
+            let import: Vec<&str> = import.iter().map(String::as_str).collect();
+            run_docker(&import, "docker step-ca import", messages)?;
+        }
+    }
     Ok(StepCaInitResult::Initialized)
 }
 
+/// Returns the flags that only shape a CA `step ca init` creates and so
+/// have no effect once one exists.
+fn new_ca_only_flags(
+    existing_ca: Option<&ExistingCa>,
+    settings: &StepCaInitArgs,
+) -> Vec<&'static str> {
+    let mut flags = Vec::new();
+    if let Some(ca) = existing_ca {
+        flags.push("--root-cert/--root-key");
+        if ca.intermediate.is_some() {
+            flags.push("--intermediate-cert/--intermediate-key");
+        }
+    }
+    if settings.name != DEFAULT_CA_NAME {
+        flags.push("--ca-name");
+    }
+    if settings.dns != DEFAULT_CA_DNS {
+        flags.push("--ca-dns");
+    }
+    if settings.address != DEFAULT_CA_ADDRESS {
+        flags.push("--ca-address");
+    }
+    flags
+}
+
+/// Returns the hex fingerprint from the `Root fingerprint: <hex>` line
+/// that `step ca init` prints, or `None` when the line is absent.
+fn parse_root_fingerprint(output: &str) -> Option<String> {
+    output.lines().find_map(|line| {
+        let (_, value) = line.split_once(ROOT_FINGERPRINT_LABEL)?;
+        let value = value.trim();
+        (value.len() == 64 && value.bytes().all(|b| b.is_ascii_hexdigit()))
+            .then(|| value.to_ascii_lowercase())
+    })
+}
+
+/// Checks that the root certificate `step ca init` wrote is the one it
+/// reported, so a stale or foreign `root_ca.crt` never reaches `OpenBao`
+/// as the trust anchor.
+fn verify_root_fingerprint(secrets_dir: &Path, reported: &str, messages: &Messages) -> Result<()> {
+    let path = secrets_dir.join(CA_CERTS_DIR).join(CA_ROOT_CERT_FILENAME);
+    let contents = std::fs::read(&path)
+        .with_context(|| messages.error_read_file_failed(&path.display().to_string()))?;
+    let (_, pem) = x509_parser::pem::parse_x509_pem(&contents).map_err(|_| {
+        anyhow::anyhow!(messages.error_ca_cert_parse_failed(&path.display().to_string()))
+    })?;
+    let actual = sha256_hex(&pem.contents);
+    if actual != reported {
+        anyhow::bail!(messages.error_stepca_root_fingerprint_mismatch(
+            reported,
+            &path.display().to_string(),
+            &actual
+        ));
+    }
+    Ok(())
+}
+
 #[cfg(test)]
 mod tests {
     use std::fs;
 
     use tempfile::tempdir;
 
-    use super::super::test_support::test_messages;
+    use super::super::super::constants::DEFAULT_STEP_CA_IMAGE;
+    use super::super::test_support::{test_cert_pem, test_messages};
     use super::*;
 
+    fn default_ca_settings() -> StepCaInitArgs {
+        StepCaInitArgs {
+            name: DEFAULT_CA_NAME.to_string(),
+            dns: DEFAULT_CA_DNS.to_string(),
+            address: DEFAULT_CA_ADDRESS.to_string(),
+        }
+    }
+
     #[tokio::test]
     async fn test_write_stepca_templates_writes_templates() {
         let temp_dir = tempdir().unwrap();
@@ -390,17 +508,100 @@ mod tests {
         fs::write(secrets_dir.join("secrets").join("root_ca_key"), "").unwrap();
         fs::write(secrets_dir.join("secrets").join("intermediate_ca_key"), "").unwrap();
 
-        let result = ensure_step_ca_initialized(&secrets_dir, &test_messages()).unwrap();
+        let result = ensure_step_ca_initialized(
+            &secrets_dir,
+            None,
+            &default_ca_settings(),
+            DEFAULT_STEP_CA_IMAGE,
+            &test_messages(),
+        )
+        .unwrap();
         assert_eq!(result, StepCaInitResult::Skipped);
     }
 
+    #[test]
+    fn test_step_ca_init_rejects_new_ca_flags_when_files_present() {
+        let temp_dir = tempdir().unwrap();
+        let secrets_dir = temp_dir.path().join("secrets");
+        fs::create_dir_all(secrets_dir.join("config")).unwrap();
+        fs::create_dir_all(secrets_dir.join("secrets")).unwrap();
+        fs::write(secrets_dir.join("config").join("ca.json"), "{}").unwrap();
+        fs::write(secrets_dir.join("secrets").join("root_ca_key"), "").unwrap();
+        fs::write(secrets_dir.join("secrets").join("intermediate_ca_key"), "").unwrap();
+        let existing_ca = ExistingCa {
+            root: existing_ca::ExistingKeyPair {
+                cert: "root.crt".into(),
+                key: "root.key".into(),
+                key_password_file: None,
+            },
+            intermediate: None,
+        };
+        let mut settings = default_ca_settings();
+        settings.dns = "ca.example.internal".to_string();
+
+        let err = ensure_step_ca_initialized(
+            &secrets_dir,
+            Some(&existing_ca),
+            &settings,
+            DEFAULT_STEP_CA_IMAGE,
+            &test_messages(),
+        )
+        .unwrap_err();
+
+        let message = err.to_string();
+        assert!(message.contains("--root-cert/--root-key, --ca-dns"));
+        assert!(!message.contains("--intermediate-cert"));
+        assert!(!message.contains("--ca-name"));
+    }
+
     #[test]
     fn test_step_ca_init_requires_password_when_missing_files() {
         let temp_dir = tempdir().unwrap();
         let secrets_dir = temp_dir.path().join("secrets");
         fs::create_dir_all(&secrets_dir).unwrap();
 
-        let err = ensure_step_ca_initialized(&secrets_dir, &test_messages()).unwrap_err();
+        let err = ensure_step_ca_initialized(
+            &secrets_dir,
+            None,
+            &default_ca_settings(),
+            DEFAULT_STEP_CA_IMAGE,
+            &test_messages(),
+        )
+        .unwrap_err();
         assert!(err.to_string().contains("step-ca password file not found"));
     }
+
+    #[test]
+    fn test_parse_root_fingerprint_reads_step_output() {
+        let fingerprint = "702a094e239c9eec6f0dcd0a5f65e595bf7ed6614012825c5fe3d1ae1b2fd6ee";
+        let output = format!(
+            "✔ Root certificate: /home/step/certs/root_ca.crt\n\
+             ✔ Root fingerprint: {}\n\
+             ✔ Intermediate certificate: /home/step/certs/intermediate_ca.crt\n",
+            fingerprint.to_ascii_uppercase()
+        );
+
+        assert_eq!(
+            parse_root_fingerprint(&output).as_deref(),
+            Some(fingerprint)
+        );
+        assert_eq!(parse_root_fingerprint("✔ Root fingerprint: abc\n"), None);
+        assert_eq!(parse_root_fingerprint(""), None);
+    }
+
+    #[test]
+    fn test_verify_root_fingerprint_detects_mismatch() {
+        let temp_dir = tempdir().unwrap();
+        let certs_dir = temp_dir.path().join(CA_CERTS_DIR);
+        fs::create_dir_all(&certs_dir).unwrap();
+        let cert_pem = test_cert_pem("Bootroot Root CA");
+        fs::write(certs_dir.join(CA_ROOT_CERT_FILENAME), &cert_pem).unwrap();
+        let (_, pem) = x509_parser::pem::parse_x509_pem(cert_pem.as_bytes()).unwrap();
+        let actual = sha256_hex(&pem.contents);
+
+        verify_root_fingerprint(temp_dir.path(), &actual, &test_messages()).unwrap();
+        let err = verify_root_fingerprint(temp_dir.path(), &"0".repeat(64), &test_messages())
+            .unwrap_err();
+        assert!(err.to_string().contains(&actual), "{err:#}");
+    }
 }
@@ -7,7 +7,7 @@ use anyhow::{Context, Result};
 
 use crate::cli::args::{
     ComposeFileArgs, DbAdminDsnArgs, DbTimeoutArgs, InfraUpArgs, InitArgs, OpenBaoArgs, ReinitArgs,
-    RootTokenArgs, SecretsDirArgs,
+    RootTokenArgs, SecretsDirArgs, StepCaImageArgs, StepCaInitArgs,
 };
 use crate::commands::clean::{
     COMPOSE_PROJECT_LABEL, COMPOSE_SERVICE_LABEL, container_exists_via_docker,
@@ -949,9 +949,20 @@ fn init_args_for_reinit(
             secrets_dir: effective_secrets_dir.to_path_buf(),
         },
         compose: args.compose.clone(),
+        step_ca_image: StepCaImageArgs {
+            ca_image: crate::commands::init::DEFAULT_STEP_CA_IMAGE.to_string(),
+        },
+        ca_init: StepCaInitArgs {
+            name: crate::commands::init::DEFAULT_CA_NAME.to_string(),
+            dns: crate::commands::init::DEFAULT_CA_DNS.to_string(),
+            address: crate::commands::init::DEFAULT_CA_ADDRESS.to_string(),
+        },
+        offline: false,
+        verify: false,
         enable: args.enable.clone(),
         skip: args.skip.clone(),
         summary_json: args.summary_json.clone(),
+        bootstrap_result: None,
         root_token: RootTokenArgs { root_token: None },
         unseal_key: Vec::new(),
         openbao_unseal_from_file: None,
@@ -977,6 +988,14 @@ fn init_args_for_reinit(
         no_eab: args.no_eab,
         save_unseal_keys: false,
         no_save_unseal_keys: false,
+        // Reinit preserves the existing step-ca hierarchy, so there is
+        // nothing to import.
+        root_cert: None,
+        root_key: None,
+        root_key_password_file: None,
+        intermediate_cert: None,
+        intermediate_key: None,
+        intermediate_key_password_file: None,
         reinit_mode: true,
         root_token_output: args.root_token_output.clone(),
     })
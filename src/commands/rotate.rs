@@ -15,17 +15,15 @@ use anyhow::{Context, Result};
 use bootroot::openbao::OpenBaoClient;
 
 use crate::cli::args::{RotateArgs, RotateCommand};
-use crate::commands::init::{CA_CERTS_DIR, CA_INTERMEDIATE_CERT_FILENAME, CA_ROOT_CERT_FILENAME};
+use crate::commands::init::{
+    CA_CERTS_DIR, CA_INTERMEDIATE_CERT_FILENAME, CA_ROOT_CERT_FILENAME, RESPONDER_TEMPLATE_DIR,
+    STEPCA_CA_JSON_TEMPLATE_NAME,
+};
 use crate::commands::openbao_auth::{authenticate_openbao_client, resolve_runtime_auth};
 use crate::i18n::Messages;
 use crate::state::StateFile;
 
 pub(super) const ROLE_ID_FILENAME: &str = "role_id";
-/// Image the `step` helper containers run in the `rotate` flows. The
-/// ownership sweep reuses it so it adds no dependency the flow did not
-/// already have (unlike the compose step-ca *server* image, which is not
-/// present on the air-gapped rotate host).
-pub(super) const STEP_CA_HELPER_IMAGE: &str = "smallstep/step-ca:0.30.2";
 pub(super) const OPENBAO_AGENT_STEPCA_CONTAINER: &str = "bootroot-openbao-agent-stepca";
 pub(super) const OPENBAO_AGENT_RESPONDER_CONTAINER: &str = "bootroot-openbao-agent-responder";
 pub(super) const ROOT_CA_COMMON_NAME: &str = "Bootroot Root CA";
@@ -69,6 +67,14 @@ impl StatePaths {
         self.secrets_dir.join("password.txt.new")
     }
 
+    pub(super) fn stepca_password_bak(&self) -> PathBuf {
+        self.secrets_dir.join("password.txt.bak")
+    }
+
+    pub(super) fn stepca_provisioner_key(&self) -> PathBuf {
+        self.secrets_dir.join("secrets").join("provisioner_key.jwe")
+    }
+
     pub(super) fn stepca_root_key(&self) -> PathBuf {
         self.secrets_dir.join("secrets").join("root_ca_key")
     }
@@ -85,6 +91,12 @@ impl StatePaths {
         self.secrets_dir.join("config").join("ca.json")
     }
 
+    pub(super) fn ca_json_template(&self) -> PathBuf {
+        self.secrets_dir
+            .join(RESPONDER_TEMPLATE_DIR)
+            .join(STEPCA_CA_JSON_TEMPLATE_NAME)
+    }
+
     pub(super) fn ca_certs_dir(&self) -> PathBuf {
         self.secrets_dir.join(CA_CERTS_DIR)
     }
@@ -127,6 +139,11 @@ pub(super) struct RotateContext {
     pub(super) paths: StatePaths,
     pub(super) state_dir: PathBuf,
     pub(super) state_file: PathBuf,
+    /// Image the `step` helper containers run (`--ca-image`). The
+    /// ownership sweep reuses it so it adds no dependency the flow did
+    /// not already have (unlike the compose step-ca *server* image, which
+    /// is not present on the air-gapped rotate host).
+    pub(super) step_ca_image: String,
 }
 
 #[allow(clippy::too_many_lines)]
@@ -168,6 +185,7 @@ pub(crate) async fn run_rotate(args: &RotateArgs, messages: &Messages) -> Result
         paths,
         state_dir,
         state_file: state_path,
+        step_ca_image: args.step_ca_image.ca_image.clone(),
     };
 
     // InfraCert operates on local files and Docker only — it must not
@@ -819,6 +819,7 @@ mod tests {
             paths: super::super::StatePaths::new(dir.join("secrets")),
             state_dir: dir.to_path_buf(),
             state_file: dir.join("state.json"),
+            step_ca_image: crate::commands::init::DEFAULT_STEP_CA_IMAGE.to_string(),
         }
     }
 
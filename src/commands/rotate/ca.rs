@@ -11,7 +11,7 @@ use super::helpers::{
 };
 use super::{
     INTERMEDIATE_CA_COMMON_NAME, OPENBAO_AGENT_RESPONDER_CONTAINER, OPENBAO_AGENT_STEPCA_CONTAINER,
-    ROOT_CA_COMMON_NAME, RotateContext, RotateOutcome, STEP_CA_HELPER_IMAGE,
+    ROOT_CA_COMMON_NAME, RotateContext, RotateOutcome,
 };
 use crate::cli::args::{RotateCaKeyArgs, RotateForceReissueArgs, RotateSkipPhase};
 use crate::commands::infra::run_docker;
@@ -115,12 +115,12 @@ pub(super) async fn rotate_ca_key(
     // cannot even read, which would fail the host-side Phase 1 backup
     // below and, on resume, the later key reads. The sweep repairs that in
     // place and is a no-op when ownership is already correct. It reuses the
-    // `smallstep/step-ca:0.30.2` image the `step` helpers already run, so it
-    // adds no new dependency. Runs unconditionally (not gated on `start_phase`)
-    // so a resumed rotation converges too.
+    // `--ca-image` image the `step` helpers already run, so it adds no new
+    // dependency. Runs unconditionally (not gated on `start_phase`) so a
+    // resumed rotation converges too.
     crate::commands::infra::sweep_secrets_ownership(
         ctx.paths.secrets_dir(),
-        STEP_CA_HELPER_IMAGE,
+        &ctx.step_ca_image,
         messages,
     )?;
 
@@ -428,7 +428,7 @@ fn owner_user_arg(secrets_dir: &Path, messages: &Messages) -> Result<String> {
 /// Builds the `docker run` argv that regenerates the root CA as the
 /// secrets-directory owner. Kept pure so tests can assert it carries
 /// `--user <uid>:<gid>` rather than `--user root`.
-fn generate_root_docker_args(mount: &str, user_arg: &str) -> Vec<String> {
+fn generate_root_docker_args(mount: &str, user_arg: &str, image: &str) -> Vec<String> {
     [
         "run",
         "--user",
@@ -436,7 +436,7 @@ fn generate_root_docker_args(mount: &str, user_arg: &str) -> Vec<String> {
         "--rm",
         "-v",
         mount,
-        "smallstep/step-ca:0.30.2",
+        image,
         "step",
         "certificate",
         "create",
@@ -457,7 +457,7 @@ fn generate_root_docker_args(mount: &str, user_arg: &str) -> Vec<String> {
 /// Builds the `docker run` argv that regenerates the intermediate CA as
 /// the secrets-directory owner. Kept pure so tests can assert it carries
 /// `--user <uid>:<gid>` rather than `--user root`.
-fn generate_intermediate_docker_args(mount: &str, user_arg: &str) -> Vec<String> {
+fn generate_intermediate_docker_args(mount: &str, user_arg: &str, image: &str) -> Vec<String> {
     [
         "run",
         "--user",
@@ -465,7 +465,7 @@ fn generate_intermediate_docker_args(mount: &str, user_arg: &str) -> Vec<String>
         "--rm",
         "-v",
         mount,
-        "smallstep/step-ca:0.30.2",
+        image,
         "step",
         "certificate",
         "create",
@@ -495,7 +495,7 @@ fn generate_new_root(ctx: &RotateContext, messages: &Messages) -> Result<()> {
         .with_context(|| messages.error_resolve_path_failed(&secrets_dir.display().to_string()))?;
     let mount = format!("{}:/home/step", mount_root.display());
     let user_arg = owner_user_arg(secrets_dir, messages)?;
-    let args = generate_root_docker_args(&mount, &user_arg);
+    let args = generate_root_docker_args(&mount, &user_arg, &ctx.step_ca_image);
     let arg_refs: Vec<&str> = args.iter().map(String::as_str).collect();
     run_docker(&arg_refs, "docker step certificate create (root)", messages)?;
     Ok(())
@@ -507,7 +507,7 @@ fn generate_new_intermediate(ctx: &RotateContext, messages: &Messages) -> Result
         .with_context(|| messages.error_resolve_path_failed(&secrets_dir.display().to_string()))?;
     let mount = format!("{}:/home/step", mount_root.display());
     let user_arg = owner_user_arg(secrets_dir, messages)?;
-    let args = generate_intermediate_docker_args(&mount, &user_arg);
+    let args = generate_intermediate_docker_args(&mount, &user_arg, &ctx.step_ca_image);
     let arg_refs: Vec<&str> = args.iter().map(String::as_str).collect();
     run_docker(&arg_refs, "docker step certificate create", messages)?;
     Ok(())
@@ -1435,7 +1435,11 @@ mod tests {
     /// `root` — otherwise the regenerated key would land root-owned.
     #[test]
     fn generate_root_docker_args_run_as_owner_not_root() {
-        let args = generate_root_docker_args("/host/secrets:/home/step", "1000:1000");
+        let args = generate_root_docker_args(
+            "/host/secrets:/home/step",
+            "1000:1000",
+            "smallstep/step-ca@sha256:0123",
+        );
         let user_pos = args
             .iter()
             .position(|a| a == "--user")
@@ -1445,14 +1449,18 @@ mod tests {
             Some("1000:1000")
         );
         assert!(!args.iter().any(|a| a == "root"));
-        assert!(args.iter().any(|a| a == "smallstep/step-ca:0.30.2"));
+        assert!(args.iter().any(|a| a == "smallstep/step-ca@sha256:0123"));
     }
 
     /// The intermediate-CA regeneration container must likewise run as the
     /// secrets-directory owner rather than `root`.
     #[test]
     fn generate_intermediate_docker_args_run_as_owner_not_root() {
-        let args = generate_intermediate_docker_args("/host/secrets:/home/step", "1000:1000");
+        let args = generate_intermediate_docker_args(
+            "/host/secrets:/home/step",
+            "1000:1000",
+            "smallstep/step-ca@sha256:0123",
+        );
         let user_pos = args
             .iter()
             .position(|a| a == "--user")
@@ -1462,7 +1470,7 @@ mod tests {
             Some("1000:1000")
         );
         assert!(!args.iter().any(|a| a == "root"));
-        assert!(args.iter().any(|a| a == "smallstep/step-ca:0.30.2"));
+        assert!(args.iter().any(|a| a == "smallstep/step-ca@sha256:0123"));
     }
 
     /// `owner_user_arg` resolves the `uid:gid` from the secrets directory
@@ -42,8 +42,15 @@ pub(super) fn rotate_infra_certs(
         .collect();
 
     for (name, entry) in &entries {
-        dispatch_reissue(name, &compose_dir, ctx.paths.secrets_dir(), entry, messages)
-            .with_context(|| messages.error_infra_tls_renew_failed(name))?;
+        dispatch_reissue(
+            name,
+            &compose_dir,
+            ctx.paths.secrets_dir(),
+            entry,
+            &ctx.step_ca_image,
+            messages,
+        )
+        .with_context(|| messages.error_infra_tls_renew_failed(name))?;
 
         if let Some(state_entry) = ctx.state.infra_certs.get_mut(name) {
             state_entry.issued_at = Some(
@@ -77,13 +84,16 @@ fn dispatch_reissue(
     compose_dir: &Path,
     secrets_dir: &Path,
     entry: &InfraCertEntry,
+    image: &str,
     messages: &Messages,
 ) -> Result<()> {
     match name {
         OPENBAO_INFRA_CERT_KEY => {
-            reissue_openbao_tls_cert(compose_dir, secrets_dir, entry, messages)
+            reissue_openbao_tls_cert(compose_dir, secrets_dir, entry, image, messages)
+        }
+        HTTP01_ADMIN_INFRA_CERT_KEY => {
+            reissue_http01_admin_tls_cert(secrets_dir, entry, image, messages)
         }
-        HTTP01_ADMIN_INFRA_CERT_KEY => reissue_http01_admin_tls_cert(secrets_dir, entry, messages),
         _ => bail!("Unknown infra cert key: {name}"),
     }
 }
@@ -131,11 +141,11 @@ mod tests {
     use super::*;
     use crate::cli::args::{
         AuthMode, ComposeFileArgs, OpenBaoOverrideArgs, RotateArgs, RotateCommand,
-        RotateInfraCertArgs, RuntimeAuthArgs, SecretsDirOverrideArgs,
+        RotateInfraCertArgs, RuntimeAuthArgs, SecretsDirOverrideArgs, StepCaImageArgs,
     };
     use crate::commands::constants::RESPONDER_SERVICE_NAME;
     use crate::commands::init::{
-        HTTP01_ADMIN_INFRA_CERT_KEY, HTTP01_ADMIN_TLS_CERT_REL_PATH,
+        DEFAULT_STEP_CA_IMAGE, HTTP01_ADMIN_INFRA_CERT_KEY, HTTP01_ADMIN_TLS_CERT_REL_PATH,
         HTTP01_ADMIN_TLS_DEFAULT_RENEW_BEFORE, HTTP01_ADMIN_TLS_KEY_REL_PATH,
         OPENBAO_CONTAINER_NAME, OPENBAO_INFRA_CERT_KEY, OPENBAO_TLS_CERT_PATH,
         OPENBAO_TLS_DEFAULT_RENEW_BEFORE, OPENBAO_TLS_KEY_PATH,
@@ -247,6 +257,9 @@ mod tests {
                 approle_role_id_file: None,
                 approle_secret_id_file: None,
             },
+            step_ca_image: StepCaImageArgs {
+                ca_image: DEFAULT_STEP_CA_IMAGE.to_string(),
+            },
             yes: true,
             show_secrets: false,
         };
@@ -374,6 +387,9 @@ mod tests {
                 approle_role_id_file: None,
                 approle_secret_id_file: None,
             },
+            step_ca_image: StepCaImageArgs {
+                ca_image: DEFAULT_STEP_CA_IMAGE.to_string(),
+            },
             yes: true,
             show_secrets: false,
         };
@@ -1,21 +1,24 @@
 use std::fs;
-use std::os::unix::fs::MetadataExt;
+use std::io::Write as _;
+use std::os::unix::fs::{MetadataExt, OpenOptionsExt};
 use std::path::Path;
 
 use anyhow::{Context, Result};
 use bootroot::fs_util;
 use bootroot::openbao::OpenBaoClient;
+use serde_json::Value;
 
 use super::helpers::{
     confirm_action, ensure_file_exists, restart_compose_service, restart_container,
     wait_for_rendered_file, write_secret_file,
 };
-use super::{
-    OPENBAO_AGENT_STEPCA_CONTAINER, RENDERED_FILE_TIMEOUT, RotateContext, STEP_CA_HELPER_IMAGE,
-};
+use super::{OPENBAO_AGENT_STEPCA_CONTAINER, RENDERED_FILE_TIMEOUT, RotateContext, StatePaths};
 use crate::cli::args::RotateStepcaPasswordArgs;
+use crate::commands::ca::{mask_go_template_directives, unmask_go_template_directives};
 use crate::commands::infra::run_docker;
-use crate::commands::init::{PATH_STEPCA_PASSWORD, SECRET_BYTES, to_container_path};
+use crate::commands::init::{
+    DEFAULT_CA_PROVISIONER, PATH_STEPCA_PASSWORD, SECRET_BYTES, to_container_path,
+};
 use crate::i18n::Messages;
 
 pub(super) async fn rotate_stepca_password(
@@ -57,15 +60,21 @@ pub(super) async fn rotate_stepca_password(
     // rotation would otherwise become unreadable to it. The sweep repairs
     // that first, keeping this flow working exactly as it does today, and
     // is a no-op when ownership is already correct. It reuses the
-    // `smallstep/step-ca:0.30.2` image the `step` helpers already run, so it
-    // adds no new dependency.
+    // `--ca-image` image the `step` helpers already run, so it adds no new
+    // dependency.
     crate::commands::infra::sweep_secrets_ownership(
         ctx.paths.secrets_dir(),
-        STEP_CA_HELPER_IMAGE,
+        &ctx.step_ca_image,
         messages,
     )?;
 
     fs_util::ensure_secrets_dir(secrets_dir).await?;
+    // Keep the current password: a rotation that stops between the two
+    // `change-pass` runs leaves keys that only it can still decrypt.
+    let backup_path = ctx.paths.stepca_password_bak();
+    let current_password = fs::read_to_string(&password_path)
+        .with_context(|| messages.error_read_file_failed(&password_path.display().to_string()))?;
+    write_secret_file(&backup_path, &current_password, messages).await?;
     write_secret_file(&new_password_path, &new_password, messages).await?;
 
     change_stepca_passphrase(
@@ -73,6 +82,7 @@ pub(super) async fn rotate_stepca_password(
         &password_path,
         &new_password_path,
         &root_key,
+        &ctx.step_ca_image,
         messages,
     )?;
     change_stepca_passphrase(
@@ -80,6 +90,14 @@ pub(super) async fn rotate_stepca_password(
         &password_path,
         &new_password_path,
         &intermediate_key,
+        &ctx.step_ca_image,
+        messages,
+    )?;
+    let provisioner_reencrypted = reencrypt_provisioner_key(
+        &ctx.paths,
+        &password_path,
+        &new_password_path,
+        &ctx.step_ca_image,
         messages,
     )?;
 
@@ -109,15 +127,148 @@ pub(super) async fn rotate_stepca_password(
         "{}",
         messages.rotate_summary_stepca_password(&password_path.display().to_string())
     );
+    println!(
+        "{}",
+        messages.rotate_summary_stepca_password_backup(&backup_path.display().to_string())
+    );
+    if provisioner_reencrypted {
+        println!(
+            "{}",
+            messages.rotate_summary_stepca_provisioner_key(DEFAULT_CA_PROVISIONER)
+        );
+    }
     println!("{}", messages.rotate_summary_restart_stepca());
     Ok(())
 }
 
+/// Re-encrypts the JWK admin provisioner key in `ca.json` (and its
+/// `OpenBao` Agent template) with the new password.
+///
+/// `step ca init` encrypts that key with the same `password.txt` as the
+/// CA keys, so rotating only the CA keys would leave the old password
+/// able to unlock the provisioner. Returns `Ok(false)` when `ca.json`
+/// has no encrypted admin provisioner key.
+fn reencrypt_provisioner_key(
+    paths: &StatePaths,
+    current_password: &Path,
+    new_password: &Path,
+    image: &str,
+    messages: &Messages,
+) -> Result<bool> {
+    let ca_json_path = paths.ca_json();
+    let contents = fs::read_to_string(&ca_json_path)
+        .with_context(|| messages.error_read_file_failed(&ca_json_path.display().to_string()))?;
+    let mut ca_json: Value =
+        serde_json::from_str(&contents).context(messages.error_parse_ca_json_failed())?;
+    let Some(encrypted_key) = admin_provisioner(&mut ca_json)
+        .and_then(|provisioner| provisioner.get("encryptedKey"))
+        .and_then(Value::as_str)
+        .map(str::to_string)
+    else {
+        return Ok(false);
+    };
+
+    let key_path = paths.stepca_provisioner_key();
+    fs::OpenOptions::new()
+        .write(true)
+        .create(true)
+        .truncate(true)
+        .mode(0o600)
+        .open(&key_path)
+        .and_then(|mut file| file.write_all(encrypted_key.as_bytes()))
+        .with_context(|| messages.error_write_file_failed(&key_path.display().to_string()))?;
+    let reencrypted = change_stepca_passphrase(
+        paths.secrets_dir(),
+        current_password,
+        new_password,
+        &key_path,
+        image,
+        messages,
+    )
+    .and_then(|()| {
+        fs::read_to_string(&key_path)
+            .with_context(|| messages.error_read_file_failed(&key_path.display().to_string()))
+    })
+    .and_then(|serialized| compact_jwe(&serialized));
+    let _ = fs::remove_file(&key_path);
+    let reencrypted = reencrypted?;
+
+    set_admin_provisioner_key(&mut ca_json, &reencrypted);
+    let serialized = serde_json::to_string_pretty(&ca_json)
+        .context(messages.error_serialize_ca_json_failed())?;
+    fs::write(&ca_json_path, serialized)
+        .with_context(|| messages.error_write_file_failed(&ca_json_path.display().to_string()))?;
+
+    let template_path = paths.ca_json_template();
+    if template_path.exists() {
+        let template = fs::read_to_string(&template_path).with_context(|| {
+            messages.error_read_file_failed(&template_path.display().to_string())
+        })?;
+        let (masked, directives) = mask_go_template_directives(&template);
+        let mut value: Value =
+            serde_json::from_str(&masked).context(messages.error_parse_ca_json_failed())?;
+        set_admin_provisioner_key(&mut value, &reencrypted);
+        let serialized = serde_json::to_string_pretty(&value)
+            .context(messages.error_serialize_ca_json_failed())?;
+        fs::write(
+            &template_path,
+            unmask_go_template_directives(&serialized, &directives),
+        )
+        .with_context(|| messages.error_write_file_failed(&template_path.display().to_string()))?;
+    }
+    Ok(true)
+}
+
+fn admin_provisioner(ca_json: &mut Value) -> Option<&mut Value> {
+    ca_json
+        .get_mut("authority")?
+        .get_mut("provisioners")?
+        .as_array_mut()?
+        .iter_mut()
+        .find(|provisioner| {
+            provisioner.get("type").and_then(Value::as_str) == Some("JWK")
+                && provisioner.get("name").and_then(Value::as_str) == Some(DEFAULT_CA_PROVISIONER)
+        })
+}
+
+fn set_admin_provisioner_key(ca_json: &mut Value, encrypted_key: &str) {
+    if let Some(provisioner) = admin_provisioner(ca_json) {
+        provisioner["encryptedKey"] = Value::String(encrypted_key.to_string());
+    }
+}
+
+/// Returns the JWE compact serialization `ca.json` stores. `step crypto
+/// change-pass` writes a re-encrypted JWK in the JSON serialization.
+fn compact_jwe(serialized: &str) -> Result<String> {
+    let serialized = serialized.trim();
+    if !serialized.starts_with('{') {
+        return Ok(serialized.to_string());
+    }
+    let value: Value = serde_json::from_str(serialized)
+        .context("Failed to parse the re-encrypted provisioner key")?;
+    if ["header", "unprotected", "aad", "recipients"]
+        .iter()
+        .any(|field| value.get(field).is_some())
+    {
+        anyhow::bail!("Re-encrypted provisioner key has no compact serialization");
+    }
+    let mut parts = Vec::new();
+    for field in ["protected", "encrypted_key", "iv", "ciphertext", "tag"] {
+        let part = value
+            .get(field)
+            .and_then(Value::as_str)
+            .ok_or_else(|| anyhow::anyhow!("Re-encrypted provisioner key is missing {field}"))?;
+        parts.push(part);
+    }
+    Ok(parts.join("."))
+}
+
 pub(super) fn change_stepca_passphrase(
     secrets_dir: &Path,
     current_password: &Path,
     new_password: &Path,
     key_path: &Path,
+    image: &str,
     messages: &Messages,
 ) -> Result<()> {
     let mount_root = fs::canonicalize(secrets_dir)
@@ -140,7 +291,7 @@ pub(super) fn change_stepca_passphrase(
         "--rm",
         "-v",
         &*mount,
-        "smallstep/step-ca:0.30.2",
+        image,
         "step",
         "crypto",
         "change-pass",
@@ -164,6 +315,8 @@ mod tests {
     use super::super::test_support::*;
     use super::*;
 
+    const TEST_IMAGE: &str = "registry.internal/step-ca@sha256:0123";
+
     #[test]
     fn change_stepca_passphrase_invokes_docker_with_force_and_expected_paths() {
         let _lock = env_lock();
@@ -192,6 +345,7 @@ mod tests {
             &current_password,
             &new_password,
             &key_path,
+            TEST_IMAGE,
             &test_messages(),
         )
         .expect("change passphrase should succeed");
@@ -211,7 +365,7 @@ mod tests {
             "--rm",
             "-v",
             expected_mount.as_str(),
-            "smallstep/step-ca:0.30.2",
+            TEST_IMAGE,
             "step",
             "crypto",
             "change-pass",
@@ -242,6 +396,7 @@ mod tests {
             &current_password,
             &new_password,
             &external_key,
+            TEST_IMAGE,
             &test_messages(),
         )
         .expect_err("key outside secrets dir must fail");
@@ -276,10 +431,92 @@ mod tests {
             &current_password,
             &new_password,
             &key_path,
+            TEST_IMAGE,
             &test_messages(),
         )
         .expect_err("docker failure should bubble up");
         let message = err.to_string();
         assert!(message.contains("docker step-ca change-pass"));
     }
+
+    #[test]
+    fn compact_jwe_joins_json_serialization() {
+        let json = r#"{"protected":"aGVhZA","encrypted_key":"a2V5","iv":"aXY","ciphertext":"Y3Q","tag":"dGFn"}"#;
+
+        assert_eq!(
+            compact_jwe(&format!("{json}\n")).unwrap(),
+            "aGVhZA.a2V5.aXY.Y3Q.dGFn"
+        );
+        assert_eq!(compact_jwe("a.b.c.d.e\n").unwrap(), "a.b.c.d.e");
+        assert!(compact_jwe(r#"{"protected":"aGVhZA","recipients":[]}"#).is_err());
+    }
+
+    #[test]
+    fn reencrypt_provisioner_key_updates_ca_json_and_template() {
+        let _lock = env_lock();
+        let temp = tempdir().expect("tempdir");
+        let bin_dir = temp.path().join("bin");
+        fs::create_dir_all(&bin_dir).expect("bin dir");
+        write_fake_docker_script(&bin_dir.join("docker"));
+        let args_log_path = temp.path().join("docker-args.log");
+        let _path_guard = ScopedEnvVar::set("PATH", path_with_prepend(&bin_dir));
+        let _args_guard = ScopedEnvVar::set(TEST_DOCKER_ARGS_ENV, args_log_path.as_os_str());
+        let _exit_guard = ScopedEnvVar::set(TEST_DOCKER_EXIT_ENV, "0");
+
+        let paths = StatePaths::new(temp.path().join("secrets"));
+        fs::create_dir_all(paths.secrets_dir().join("secrets")).expect("create key dir");
+        fs::create_dir_all(paths.ca_json().parent().unwrap()).expect("create config dir");
+        fs::create_dir_all(paths.ca_json_template().parent().unwrap()).expect("create tpl dir");
+        fs::write(paths.stepca_password(), "old").expect("write password");
+        fs::write(paths.stepca_password_new(), "new").expect("write new password");
+        let ca_json = r#"{"authority":{"provisioners":[{"type":"JWK","name":"admin","encryptedKey":"p.k.i.c.t"},{"type":"ACME","name":"acme"}]}}"#;
+        fs::write(paths.ca_json(), ca_json).expect("write ca.json");
+        let template = r#"{"authority":{"provisioners":[{"type":"JWK","name":"admin","encryptedKey":"p.k.i.c.t"}]},"db":{"dataSource":"{{ with secret "db" }}{{ .Data.data.value }}{{ end }}"}}"#;
+        fs::write(paths.ca_json_template(), template).expect("write template");
+
+        let reencrypted = reencrypt_provisioner_key(
+            &paths,
+            &paths.stepca_password(),
+            &paths.stepca_password_new(),
+            TEST_IMAGE,
+            &test_messages(),
+        )
+        .expect("re-encrypt provisioner key");
+
+        assert!(reencrypted);
+        let logged_args = fs::read_to_string(&args_log_path).expect("read logged args");
+        assert!(logged_args.contains("/home/step/secrets/provisioner_key.jwe"));
+        assert!(!paths.stepca_provisioner_key().exists());
+        let updated: Value =
+            serde_json::from_str(&fs::read_to_string(paths.ca_json()).unwrap()).unwrap();
+        assert_eq!(
+            updated["authority"]["provisioners"][0]["encryptedKey"],
+            "p.k.i.c.t"
+        );
+        let template = fs::read_to_string(paths.ca_json_template()).unwrap();
+        assert!(template.contains(r#""{{ with secret "db" }}{{ .Data.data.value }}{{ end }}""#));
+    }
+
+    #[test]
+    fn reencrypt_provisioner_key_skips_ca_json_without_jwk_provisioner() {
+        let temp = tempdir().expect("tempdir");
+        let paths = StatePaths::new(temp.path().to_path_buf());
+        fs::create_dir_all(paths.ca_json().parent().unwrap()).expect("create config dir");
+        fs::write(
+            paths.ca_json(),
+            r#"{"authority":{"provisioners":[{"type":"ACME","name":"acme"}]}}"#,
+        )
+        .expect("write ca.json");
+
+        let reencrypted = reencrypt_provisioner_key(
+            &paths,
+            &paths.stepca_password(),
+            &paths.stepca_password_new(),
+            TEST_IMAGE,
+            &test_messages(),
+        )
+        .expect("skip without provisioner");
+
+        assert!(!reencrypted);
+    }
 }
@@ -366,7 +366,9 @@ fn service_name_error(err: ValidationError, messages: &Messages) -> anyhow::Erro
         | ValidationError::InvalidDomainName
         | ValidationError::InvalidCidr
         | ValidationError::CidrClearConflict
-        | ValidationError::NonNumeric => anyhow::anyhow!(messages.error_service_name_invalid()),
+        | ValidationError::NonNumeric
+        | ValidationError::InvalidEmail
+        | ValidationError::InvalidContact => anyhow::anyhow!(messages.error_service_name_invalid()),
     }
 }
 
@@ -377,7 +379,9 @@ fn hostname_error(err: ValidationError, messages: &Messages) -> anyhow::Error {
         | ValidationError::InvalidDomainName
         | ValidationError::InvalidCidr
         | ValidationError::CidrClearConflict
-        | ValidationError::NonNumeric => anyhow::anyhow!(messages.error_hostname_invalid()),
+        | ValidationError::NonNumeric
+        | ValidationError::InvalidEmail
+        | ValidationError::InvalidContact => anyhow::anyhow!(messages.error_hostname_invalid()),
     }
 }
 
@@ -388,7 +392,9 @@ fn domain_error(err: ValidationError, messages: &Messages) -> anyhow::Error {
         | ValidationError::InvalidDomainName
         | ValidationError::InvalidCidr
         | ValidationError::CidrClearConflict
-        | ValidationError::NonNumeric => anyhow::anyhow!(messages.error_domain_invalid()),
+        | ValidationError::NonNumeric
+        | ValidationError::InvalidEmail
+        | ValidationError::InvalidContact => anyhow::anyhow!(messages.error_domain_invalid()),
     }
 }
 
@@ -399,7 +405,9 @@ fn instance_id_error(err: ValidationError, messages: &Messages) -> anyhow::Error
         | ValidationError::InvalidDomainName
         | ValidationError::InvalidCidr
         | ValidationError::CidrClearConflict
-        | ValidationError::NonNumeric => anyhow::anyhow!(messages.error_instance_id_invalid()),
+        | ValidationError::NonNumeric
+        | ValidationError::InvalidEmail
+        | ValidationError::InvalidContact => anyhow::anyhow!(messages.error_instance_id_invalid()),
     }
 }
 
@@ -243,6 +243,7 @@ fn verify_cert_san(entry: &ServiceEntry, messages: &Messages) -> Result<()> {
     let expected = expected_dns_name(entry, messages)?;
     let contents = std::fs::read(&entry.cert_path)
         .with_context(|| messages.error_read_file_failed(&entry.cert_path.display().to_string()))?;
+    let contents = bootroot::cert_chain::cert_file_pem(contents);
     let (_, pem) = x509_parser::pem::parse_x509_pem(&contents)
         .map_err(|_| anyhow::anyhow!(messages.verify_cert_parse_failed()))?;
     let (_, cert) = x509_parser::parse_x509_certificate(&pem.contents)
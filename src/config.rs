@@ -1,13 +1,19 @@
 use std::path::PathBuf;
 use std::time::Duration;
 
-use anyhow::Result;
+use anyhow::{Context, Result};
 use config::{Config, ConfigError, Environment, File};
-use serde::Deserialize;
+use reqwest::Url;
+use serde::{Deserialize, Serialize};
+
+use crate::key_delivery::KeyDelivery;
 
 mod defaults;
 mod validation;
 
+const STEP_CA_ACME_SEGMENT: &str = "acme";
+const STEP_CA_DIRECTORY_SEGMENT: &str = "directory";
+
 pub use validation::{
     openbao_url_is_https, openbao_url_is_non_loopback_plaintext, parse_cert_duration,
     validate_cert_duration_vs_default_renew_before,
@@ -21,18 +27,125 @@ pub use validation::{
 #[derive(Clone, Debug, Default)]
 pub struct CliOverrides {
     pub email: Option<String>,
+    pub contacts: Vec<String>,
     pub ca_url: Option<String>,
     pub http_responder_url: Option<String>,
     pub http_responder_hmac: Option<String>,
+    pub insecure_http: bool,
+    pub otel_endpoint: Option<String>,
+    /// `--run-id`: not a setting, but kept here so the daemon numbers its
+    /// renewal cycles under it across reloads.
+    pub run_id: Option<String>,
+    pub dns_propagation_nameservers: Vec<String>,
+    pub dns_propagation_timeout_secs: Option<u64>,
+    pub dns01_manual: bool,
+    pub output_format: Option<OutputFormat>,
+    pub bundle_order: Option<BundleOrder>,
+    pub reload_pid_file: Option<PathBuf>,
+    pub reload_signal: Option<String>,
+    pub reload_container: Option<String>,
+    pub provisioner: Option<String>,
+    pub ca_dir: Option<PathBuf>,
+    pub server_spki_sha256: Vec<String>,
+    pub exit_on_expired: bool,
+    pub renew_on_revoked: bool,
+    pub verify_dns_before_renew: bool,
+    pub renew_before_pct: Option<u8>,
+    pub check_sct: bool,
+    pub require_eab: bool,
+    pub require_tos: Option<String>,
+    pub account_key_path: Option<PathBuf>,
+    pub solver_command: Option<PathBuf>,
+    pub tls_min_version: Option<TlsVersion>,
+    pub tls_max_version: Option<TlsVersion>,
+    pub order_poll_interval_secs: Option<u64>,
+    pub order_timeout_secs: Option<u64>,
+    pub max_parallel_challenges: Option<u64>,
+    pub cleanup_on_failure: bool,
+    pub subject_organization: Option<String>,
+    pub subject_organizational_unit: Option<String>,
+    pub subject_country: Option<String>,
+    pub uri_sans: Vec<String>,
+    pub email_sans: Vec<String>,
+    pub expected_sans: Vec<String>,
+    pub health_addr: Option<String>,
+    pub pin_path: Option<PathBuf>,
+    pub cert_name: Option<String>,
+    pub key_name: Option<String>,
+    pub key_delivery: Option<KeyDelivery>,
+    pub skip_if_valid: bool,
+    pub certbot_layout: Option<PathBuf>,
+    pub versioned_out: Option<PathBuf>,
+    pub keep_versions: Option<usize>,
+    pub url_rewrites: Vec<UrlRewrite>,
+    pub purge_account_on_success: bool,
+    pub trace_http: HttpTrace,
 }
 
 impl From<&crate::Args> for CliOverrides {
     fn from(args: &crate::Args) -> Self {
         Self {
             email: args.email.clone(),
+            contacts: args.contact.clone(),
             ca_url: args.ca_url.clone(),
             http_responder_url: args.http_responder_url.clone(),
             http_responder_hmac: args.http_responder_hmac.clone(),
+            insecure_http: args.insecure_http,
+            otel_endpoint: args.otel_endpoint.clone(),
+            run_id: args.run_id.clone(),
+            dns_propagation_nameservers: args.dns_resolver_check.clone(),
+            dns_propagation_timeout_secs: args.dns_propagation_timeout,
+            dns01_manual: args.dns01_manual,
+            output_format: args.format,
+            bundle_order: args.bundle_order,
+            reload_pid_file: args.reload_pid_file.clone(),
+            reload_signal: args.reload_signal.clone(),
+            reload_container: args.reload_container.clone(),
+            provisioner: args.provisioner.clone(),
+            ca_dir: args.root_dir.clone(),
+            server_spki_sha256: args.pin_sha256.clone(),
+            exit_on_expired: args.exit_on_expired,
+            renew_on_revoked: args.renew_on_revoked,
+            verify_dns_before_renew: args.verify_dns_before_renew,
+            renew_before_pct: args.renew_before_pct,
+            check_sct: args.check_sct,
+            require_eab: args.require_eab,
+            require_tos: args.require_tos.clone(),
+            account_key_path: args.account_key.clone(),
+            solver_command: args.solver_command.clone(),
+            tls_min_version: args.tls_min_version,
+            tls_max_version: args.tls_max_version,
+            order_poll_interval_secs: args.order_poll_interval,
+            order_timeout_secs: args.order_timeout,
+            max_parallel_challenges: args.max_parallel_challenges,
+            cleanup_on_failure: args.cleanup_on_failure,
+            subject_organization: args.subject_o.clone(),
+            subject_organizational_unit: args.subject_ou.clone(),
+            subject_country: args.subject_c.clone(),
+            uri_sans: args.uri_san.clone(),
+            email_sans: args.email_san.clone(),
+            expected_sans: args.expected_san.clone(),
+            health_addr: args.health_addr.clone(),
+            pin_path: args.write_pin.clone(),
+            cert_name: args.cert_name.clone(),
+            key_name: args.key_name.clone(),
+            key_delivery: args
+                .key_fd
+                .map(KeyDelivery::Fd)
+                .or_else(|| args.key_fifo.clone().map(KeyDelivery::Fifo)),
+            skip_if_valid: args.no_register_if_exists,
+            certbot_layout: args.certbot_layout.clone(),
+            versioned_out: args.versioned_out.clone(),
+            keep_versions: args.keep_versions,
+            url_rewrites: args.url_rewrite.clone(),
+            purge_account_on_success: args.purge_account_on_success,
+            trace_http: if args.trace_http_bodies {
+                HttpTrace::Bodies
+            } else if args.trace_http {
+                HttpTrace::Headers
+            } else {
+                HttpTrace::Off
+            },
         }
     }
 }
@@ -40,6 +153,11 @@ impl From<&crate::Args> for CliOverrides {
 #[derive(Debug, Deserialize, Clone)]
 pub struct Settings {
     pub email: String,
+    /// ACME account contact URIs (`mailto:`, `tel:`, ...). When non-empty
+    /// they are registered instead of the `mailto:` contacts derived from
+    /// `email`.
+    #[serde(default)]
+    pub contacts: Vec<String>,
     pub server: String,
     pub domain: String,
     pub eab: Option<Eab>,
@@ -56,6 +174,14 @@ pub struct Settings {
     /// requests on the KV v2 `reissue` path for each registered service.
     #[serde(default)]
     pub openbao: Option<OpenBaoSettings>,
+    #[serde(default)]
+    pub status: StatusSettings,
+    #[serde(default)]
+    pub dns01: Dns01Settings,
+    #[serde(default)]
+    pub otel: OtelSettings,
+    #[serde(default)]
+    pub reload: ReloadSettings,
 }
 
 /// `OpenBao` connection settings for the remote-agent fast-poll loop.
@@ -99,24 +225,126 @@ pub struct OpenBaoSettings {
     pub state_path: PathBuf,
 }
 
+/// Returns the profile's certificate domain in ASCII form, with any
+/// internationalized labels of `hostname` or `domain` converted to IDNA
+/// A-labels. This is the name sent to the CA.
 #[must_use]
 pub fn profile_domain(settings: &Settings, profile: &DaemonProfileSettings) -> String {
+    let domain = profile_domain_as_configured(settings, profile);
+    crate::input_validation::domain_to_ascii(&domain).unwrap_or(domain)
+}
+
+/// Returns the profile's certificate domain exactly as configured, which
+/// may contain Unicode labels. Used only for display next to
+/// [`profile_domain`].
+#[must_use]
+pub fn profile_domain_as_configured(
+    settings: &Settings,
+    profile: &DaemonProfileSettings,
+) -> String {
     format!(
         "{}.{}.{}.{}",
         profile.instance_id, profile.service_name, profile.hostname, settings.domain
     )
 }
 
-#[derive(Debug, Deserialize, Clone)]
+/// Returns the step-ca provisioner `profile` is issued through: the
+/// provisioner of the profile's own EAB key, else `acme.provisioner`.
+/// `None` means the `server` directory is used as configured.
+#[must_use]
+pub fn profile_provisioner<'a>(
+    settings: &'a Settings,
+    profile: &'a DaemonProfileSettings,
+) -> Option<&'a str> {
+    profile
+        .eab
+        .as_ref()
+        .and_then(|eab| eab.provisioner.as_deref())
+        .or(settings.acme.provisioner.as_deref())
+}
+
+/// Returns the ACME directory URL `profile` is issued through.
+///
+/// # Errors
+/// Returns an error if a provisioner is selected but `server` is not a
+/// step-ca directory URL.
+pub fn profile_directory_url(
+    settings: &Settings,
+    profile: &DaemonProfileSettings,
+) -> Result<String> {
+    match profile_provisioner(settings, profile) {
+        Some(provisioner) => provisioner_directory_url(&settings.server, provisioner),
+        None => Ok(settings.server.clone()),
+    }
+}
+
+/// Rewrites a step-ca directory URL (`.../acme/<name>/directory`) to the
+/// directory of `provisioner`.
+///
+/// # Errors
+/// Returns an error if `server` is not a URL of that shape.
+pub fn provisioner_directory_url(server: &str, provisioner: &str) -> Result<String> {
+    let mut url = Url::parse(server.trim())
+        .with_context(|| format!("server is not a valid URL: {server}"))?;
+    if directory_provisioner(&url).is_none() {
+        anyhow::bail!(
+            "server must be a step-ca directory URL ending in /acme/<provisioner>/directory \
+             to select provisioner {provisioner}, got {server}"
+        );
+    }
+    url.path_segments_mut()
+        .map_err(|()| anyhow::anyhow!("server URL cannot have a path: {server}"))?
+        .pop()
+        .pop()
+        .push(provisioner)
+        .push(STEP_CA_DIRECTORY_SEGMENT);
+    Ok(url.to_string())
+}
+
+/// Returns the provisioner named by a step-ca directory URL, if `server`
+/// has that shape.
+#[must_use]
+pub fn server_provisioner(server: &str) -> Option<String> {
+    Url::parse(server.trim())
+        .ok()
+        .and_then(|url| directory_provisioner(&url))
+}
+
+fn directory_provisioner(url: &Url) -> Option<String> {
+    let segments: Vec<&str> = url.path_segments()?.collect();
+    match segments.as_slice() {
+        [
+            ..,
+            STEP_CA_ACME_SEGMENT,
+            provisioner,
+            STEP_CA_DIRECTORY_SEGMENT,
+        ] if !provisioner.is_empty() => Some((*provisioner).to_string()),
+        _ => None,
+    }
+}
+
+#[derive(Debug, Deserialize, Clone, Default)]
 pub struct Paths {
     pub cert: PathBuf,
     pub key: PathBuf,
+    /// Optional path that receives the intermediate chain (every
+    /// certificate after the leaf) as PEM.
+    #[serde(default)]
+    pub chain: Option<PathBuf>,
+    /// Optional path that receives the leaf's SPKI pin (base64 SHA-256
+    /// of its `SubjectPublicKeyInfo`) on one line.
+    #[serde(default)]
+    pub pin: Option<PathBuf>,
 }
 
 #[derive(Debug, Deserialize, Clone)]
 pub struct Eab {
     pub kid: String,
     pub hmac: String,
+    /// step-ca ACME provisioner the key was created for. On a profile's
+    /// `eab` it also selects that provisioner's directory.
+    #[serde(default)]
+    pub provisioner: Option<String>,
 }
 
 #[derive(Debug, Deserialize, Clone)]
@@ -131,6 +359,9 @@ pub struct DaemonProfileSettings {
     pub retry: Option<RetrySettings>,
     #[serde(default)]
     pub hooks: HookSettings,
+    /// Extra subject attributes for the agent-generated CSR.
+    #[serde(default)]
+    pub subject: SubjectSettings,
     pub eab: Option<Eab>,
     /// Numeric gid that owns the issued cert/key files and their
     /// parent directories under the `--cert-group` policy.
@@ -138,6 +369,92 @@ pub struct DaemonProfileSettings {
     /// and operator-only ownership. See issue #593.
     #[serde(default)]
     pub cert_group_gid: Option<u32>,
+    /// Optional PKCS#11 token that holds the certificate private key.
+    /// When set, the CSR is signed inside the token and `paths.key` is
+    /// never written.
+    #[serde(default)]
+    pub pkcs11: Option<Pkcs11Settings>,
+    /// Writes the full chain to `paths.cert` when `true` (the default).
+    /// `false` writes only the leaf; pair it with `paths.chain` to keep
+    /// the intermediates in a separate file.
+    #[serde(default = "defaults::default_bundle")]
+    pub bundle: bool,
+    /// Encoding of `paths.cert` and `paths.key`. `der` writes the leaf
+    /// certificate and a PKCS#8 key in binary DER for devices that cannot
+    /// read PEM.
+    #[serde(default)]
+    pub format: OutputFormat,
+    /// Order of the certificates in a multi-certificate `paths.cert`.
+    #[serde(default)]
+    pub bundle_order: BundleOrder,
+    /// Removes the output files an issuance created when writing them
+    /// fails, so a first issuance is all-or-nothing.
+    #[serde(default)]
+    pub cleanup_on_failure: bool,
+    /// Sinks each issuance is written to. `None` (the default) writes
+    /// only the `paths.*` files.
+    #[serde(default)]
+    pub outputs: Option<Vec<OutputSinkSettings>>,
+    /// Descriptor or named pipe the private key is written to instead of
+    /// `paths.key`. Set only from `--key-fd` / `--key-fifo`.
+    #[serde(skip)]
+    pub key_delivery: Option<KeyDelivery>,
+    /// Skips a oneshot issuance while the certificate on disk is not due
+    /// for renewal, without contacting the CA. Set only from
+    /// `--no-register-if-exists`.
+    #[serde(skip)]
+    pub skip_if_valid: bool,
+}
+
+/// One destination of an issued certificate, tagged by `type`.
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq, Eq)]
+#[serde(tag = "type", rename_all = "kebab-case")]
+pub enum OutputSinkSettings {
+    /// The `paths.*` files. Required, since renewal reads `paths.cert`.
+    Files,
+    /// A PKCS#12 archive holding the key, the leaf, and the chain.
+    Pkcs12 {
+        path: PathBuf,
+        /// File whose first line is the password for the archive's
+        /// integrity MAC. Omitted means an empty password.
+        #[serde(default)]
+        password_file: Option<PathBuf>,
+    },
+    /// A `kubernetes.io/tls` Secret manifest for `kubectl apply -f`.
+    KubernetesSecret {
+        path: PathBuf,
+        name: String,
+        #[serde(default)]
+        namespace: Option<String>,
+    },
+    /// The certificate chain printed to standard output; never the key.
+    Stdout,
+    /// certbot's `live/<domain>/` layout under `base`: `cert.pem`,
+    /// `chain.pem`, `fullchain.pem`, and `privkey.pem`.
+    Certbot { base: PathBuf },
+    /// The certbot files in a new `<base>/<domain>/<UTC timestamp>/`
+    /// directory per issuance, with the `current` symlink beside it
+    /// swapped atomically to the newest one.
+    Versioned {
+        base: PathBuf,
+        /// Earlier versions kept for rollback; older ones are removed.
+        #[serde(default = "defaults::default_keep_versions")]
+        keep_versions: usize,
+    },
+}
+
+/// PKCS#11 (HSM) key location for a profile.
+#[derive(Debug, Deserialize, Clone)]
+pub struct Pkcs11Settings {
+    /// Path to the vendor's PKCS#11 shared library.
+    pub module: PathBuf,
+    /// Slot id that holds the token.
+    pub slot: u64,
+    /// `CKA_LABEL` shared by the private and public key objects.
+    pub label: String,
+    /// User PIN for `C_Login`. Omit for tokens that need no login.
+    #[serde(default)]
+    pub pin: Option<String>,
 }
 
 #[derive(Debug, Deserialize, Clone)]
@@ -146,8 +463,30 @@ pub struct DaemonRuntimeSettings {
     pub check_interval: Duration,
     #[serde(default = "defaults::default_renew_before", with = "duration_serde")]
     pub renew_before: Duration,
+    /// Also renews once this percentage of the certificate's validity
+    /// period (`NotBefore` to `NotAfter`) has elapsed, whichever of this
+    /// and `renew_before` comes first.
+    #[serde(default)]
+    pub renew_before_pct: Option<u8>,
     #[serde(default = "defaults::default_check_jitter", with = "duration_serde")]
     pub check_jitter: Duration,
+    /// Renewal failures within this long of `NotAfter` are logged as
+    /// errors and reported to failure hooks as `critical`; earlier ones
+    /// are warnings.
+    #[serde(default = "defaults::default_escalate_before", with = "duration_serde")]
+    pub escalate_before: Duration,
+    /// Stops the daemon with an error once the certificate has expired
+    /// and renewal still fails, so a supervisor can restart or alert.
+    #[serde(default)]
+    pub exit_on_expired: bool,
+    /// Asks the certificate's OCSP responder on every check and renews
+    /// at once when the certificate was revoked.
+    #[serde(default)]
+    pub renew_on_revoked: bool,
+    /// Before renewing, resolves the profile's domain and skips the
+    /// renewal unless one of its addresses is bound on this host.
+    #[serde(default)]
+    pub verify_dns_before_renew: bool,
 }
 
 #[derive(Debug, Deserialize, Clone)]
@@ -161,6 +500,169 @@ pub struct AcmeSettings {
     pub directory_fetch_max_delay_secs: u64,
     pub poll_attempts: u64,
     pub poll_interval_secs: u64,
+    /// Seconds between order polls after finalize; defaults to
+    /// `poll_interval_secs`.
+    #[serde(default)]
+    pub order_poll_interval_secs: Option<u64>,
+    /// Seconds to wait for a finalized order to leave `processing`;
+    /// defaults to `poll_attempts * poll_interval_secs`.
+    #[serde(default)]
+    pub order_timeout_secs: Option<u64>,
+    /// Authorizations whose challenges are presented and validated at
+    /// the same time. The default of 1 solves them one after another.
+    pub max_parallel_challenges: u64,
+    /// Drives daemon renewal from the CA's ARI suggested window (RFC
+    /// 9773) in addition to `renew_before`.
+    pub use_ari: bool,
+    /// DNS server (`ip` or `ip:port`) used to resolve ACME hosts instead
+    /// of the system resolver.
+    #[serde(default)]
+    pub dns_resolver: Option<String>,
+    /// Challenge type answered for every authorization.
+    #[serde(default)]
+    pub challenge: ChallengeKind,
+    /// Logs the duration of every issuance phase at `info` level.
+    #[serde(default)]
+    pub phase_timing: bool,
+    /// Logs the Certificate Transparency SCTs embedded in each issued
+    /// leaf and warns when there are none.
+    #[serde(default)]
+    pub check_sct: bool,
+    /// Sends the EAB even when the directory's `meta` says the CA does
+    /// not require external account binding.
+    #[serde(default)]
+    pub require_eab: bool,
+    /// Terms of Service URL the directory's `meta.termsOfService` must
+    /// match before an account registration agrees to it. Unset agrees to
+    /// whatever the CA serves.
+    #[serde(default)]
+    pub require_tos: Option<String>,
+    /// PEM file holding the ACME account key (P-256 or RSA); a P-256 key
+    /// is created on first use. Unset registers with a fresh key on every issuance.
+    #[serde(default)]
+    pub account_key_path: Option<PathBuf>,
+    /// Executable that presents and cleans up every challenge instead of
+    /// the built-in HTTP-01 responder or DNS-01 server.
+    #[serde(default)]
+    pub solver_command: Option<PathBuf>,
+    /// step-ca ACME provisioner whose directory replaces the one in
+    /// `server` (`.../acme/<provisioner>/directory`).
+    #[serde(default)]
+    pub provisioner: Option<String>,
+    /// Allows a plaintext `http://` ACME directory URL.
+    ///
+    /// Never read from the config file: only the `--insecure-http` CLI
+    /// flag sets it, so a local test CA has to be opted into per run.
+    #[serde(skip)]
+    pub allow_insecure_http: bool,
+    /// Prefix rewrites applied to URLs the CA returns (nonce, account,
+    /// order, authorization, finalize, certificate) before they are
+    /// requested; the first matching rule wins.
+    ///
+    /// Never read from the config file: only `--url-rewrite` sets it.
+    #[serde(skip)]
+    pub url_rewrites: Vec<UrlRewrite>,
+    /// Deactivates the ACME account once an issuance has succeeded, so
+    /// throwaway CI runs leave no live accounts on a test CA.
+    ///
+    /// Never read from the config file: only `--purge-account-on-success`
+    /// sets it.
+    #[serde(skip)]
+    pub purge_account_on_success: bool,
+    /// Dumps every ACME request and response to standard error.
+    ///
+    /// Never read from the config file: only `--trace-http` and
+    /// `--trace-http-bodies` set it.
+    #[serde(skip)]
+    pub trace_http: HttpTrace,
+}
+
+/// How much of each ACME HTTP exchange `--trace-http` dumps.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum HttpTrace {
+    #[default]
+    Off,
+    /// Request and status lines with their headers.
+    Headers,
+    /// Headers plus bodies, with JWS signatures redacted.
+    Bodies,
+}
+
+/// One `--url-rewrite <FROM>=<TO>` rule: a URL starting with `from` is
+/// requested at `to` followed by the rest of the URL.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct UrlRewrite {
+    pub from: String,
+    pub to: String,
+}
+
+impl UrlRewrite {
+    /// Returns `url` with the `from` prefix replaced by `to`, or `None`
+    /// when the rule does not match.
+    #[must_use]
+    pub fn apply(&self, url: &str) -> Option<String> {
+        url.strip_prefix(&self.from)
+            .map(|rest| format!("{}{rest}", self.to))
+    }
+}
+
+/// ACME challenge type the agent answers.
+#[derive(Debug, Deserialize, Clone, Copy, PartialEq, Eq, Default)]
+pub enum ChallengeKind {
+    /// Tokens are published through the HTTP-01 responder.
+    #[default]
+    #[serde(rename = "http-01")]
+    Http01,
+    /// TXT records are served by the agent's built-in DNS server.
+    #[serde(rename = "dns-01")]
+    Dns01,
+}
+
+/// File encoding of an issued certificate and key.
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, PartialEq, Eq, Default, clap::ValueEnum)]
+#[serde(rename_all = "lowercase")]
+pub enum OutputFormat {
+    /// PEM text; `paths.cert` may hold the full chain.
+    #[default]
+    Pem,
+    /// Binary DER; `paths.cert` holds only the leaf and `paths.key` a
+    /// PKCS#8 key.
+    Der,
+}
+
+/// Order of the certificate blocks in a bundled `paths.cert`.
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, PartialEq, Eq, Default, clap::ValueEnum)]
+#[serde(rename_all = "kebab-case")]
+pub enum BundleOrder {
+    /// Leaf first, then each issuer, as the CA returns it.
+    #[default]
+    LeafChain,
+    /// Topmost issuer first, leaf last.
+    ChainLeaf,
+}
+
+/// TLS protocol version bound for the ACME client.
+#[derive(
+    Debug,
+    Serialize,
+    Deserialize,
+    Clone,
+    Copy,
+    PartialEq,
+    Eq,
+    PartialOrd,
+    Ord,
+    Default,
+    clap::ValueEnum,
+)]
+pub enum TlsVersion {
+    #[default]
+    #[serde(rename = "1.2")]
+    #[value(name = "1.2")]
+    Tls12,
+    #[serde(rename = "1.3")]
+    #[value(name = "1.3")]
+    Tls13,
 }
 
 #[derive(Debug, Deserialize, Clone)]
@@ -173,8 +675,30 @@ pub struct RetrySettings {
 pub struct TrustSettings {
     #[serde(default)]
     pub ca_bundle_path: Option<PathBuf>,
+    /// Directory of PEM trust anchors (`c_rehash` layout, for example
+    /// `/etc/ssl/certs`) added to the roots used to verify the ACME
+    /// server. Read only; the agent never writes here.
+    #[serde(default)]
+    pub ca_dir: Option<PathBuf>,
     #[serde(default)]
     pub trusted_ca_sha256: Vec<String>,
+    /// Public-key pins for the ACME server (lowercase hex SHA-256 of the
+    /// leaf's DER `SubjectPublicKeyInfo`). The leaf must match one of them
+    /// on top of chain verification; several allow a key rotation.
+    #[serde(default)]
+    pub server_spki_sha256: Vec<String>,
+    /// Appends the trusted root from `ca_bundle_path` to the written
+    /// certificate so the served chain ends in the root. Non-standard;
+    /// only for appliances that insist on receiving the root.
+    #[serde(default)]
+    pub include_root: bool,
+    /// Lowest TLS version the ACME client negotiates.
+    #[serde(default)]
+    pub tls_min_version: TlsVersion,
+    /// Highest TLS version the ACME client negotiates; unset allows the
+    /// newest one supported.
+    #[serde(default)]
+    pub tls_max_version: Option<TlsVersion>,
 }
 
 #[derive(Debug, Deserialize, Clone, Default)]
@@ -183,13 +707,110 @@ pub struct SchedulerSettings {
     pub max_concurrent_issuances: u64,
 }
 
+/// Daemon status endpoint settings.
+///
+/// When `listen_addr` is set, `--daemon` mode serves the per-profile
+/// last success, last error, certificate `NotAfter`, and next check time
+/// as JSON on `GET /status`. Unset disables the endpoint.
+#[derive(Debug, Deserialize, Clone, Default)]
+pub struct StatusSettings {
+    #[serde(default)]
+    pub listen_addr: Option<String>,
+    /// Address of the `GET /healthz` liveness endpoint served while a
+    /// oneshot run is issuing. Unset disables it.
+    #[serde(default)]
+    pub health_addr: Option<String>,
+}
+
+/// Built-in DNS-01 server settings, used when `acme.challenge` is
+/// `"dns-01"`.
+///
+/// The agent answers `_acme-challenge` TXT queries on `listen_addr`
+/// (UDP) and refuses every other name. When `propagation_nameservers` is
+/// set, each published record must be visible on every listed server
+/// before the CA is asked to validate.
+#[derive(Debug, Deserialize, Clone, Default)]
+pub struct Dns01Settings {
+    pub listen_addr: String,
+    #[serde(default)]
+    pub propagation_nameservers: Vec<String>,
+    pub propagation_timeout_secs: u64,
+    /// Prompt the operator to publish each TXT record instead of serving
+    /// it from `listen_addr`.
+    #[serde(default)]
+    pub manual: bool,
+}
+
+/// OpenTelemetry export settings.
+///
+/// When `endpoint` is set, every issuance is exported as a trace to this
+/// OTLP/HTTP collector. Unset disables tracing entirely.
+#[derive(Debug, Deserialize, Clone, Default)]
+pub struct OtelSettings {
+    #[serde(default)]
+    pub endpoint: Option<String>,
+}
+
+/// Consumer reload after a renewal.
+///
+/// When `pid_file` is set, the agent reads the PID from it after every
+/// successful issuance and sends `signal` (default `HUP`) to that
+/// process, e.g. to make nginx reopen its certificate without a hook.
+/// When `container` is set, the agent restarts that container with
+/// `container_runtime` (default `docker`).
 #[derive(Debug, Deserialize, Clone, Default)]
+pub struct ReloadSettings {
+    #[serde(default)]
+    pub pid_file: Option<PathBuf>,
+    #[serde(default)]
+    pub signal: Option<String>,
+    #[serde(default)]
+    pub container: Option<String>,
+    #[serde(default)]
+    pub container_runtime: Option<String>,
+}
+
+/// Subject attributes added to the CSR next to the `CommonName`, and
+/// identity SANs added next to the DNS SAN.
+///
+/// The CA decides whether they reach the certificate: step-ca's default
+/// ACME template copies only the SANs, so these appear only with a
+/// custom template that reads the CSR subject. URI and email SANs are
+/// not ACME identifiers, so they too need a template that reads the CSR.
+#[derive(Debug, Serialize, Deserialize, Clone, Default, PartialEq, Eq)]
+#[serde(deny_unknown_fields)]
+pub struct SubjectSettings {
+    /// `O` (organization).
+    #[serde(default)]
+    pub organization: Option<String>,
+    /// `OU` (organizational unit).
+    #[serde(default)]
+    pub organizational_unit: Option<String>,
+    /// `C` (ISO 3166 two-letter country code).
+    #[serde(default)]
+    pub country: Option<String>,
+    /// URI SANs, for example a SPIFFE ID.
+    #[serde(default)]
+    pub uri_sans: Vec<String>,
+    /// Email (`rfc822Name`) SANs.
+    #[serde(default)]
+    pub email_sans: Vec<String>,
+    /// SANs the issued certificate must carry, no more and no fewer.
+    /// Empty (the default) skips the check.
+    #[serde(default)]
+    pub expected_sans: Vec<String>,
+}
+
+#[derive(Debug, Serialize, Deserialize, Clone, Default)]
 pub struct HookSettings {
+    /// Run before each issuance; a failing hook aborts that issuance.
+    #[serde(default)]
+    pub pre_renew: Vec<HookCommand>,
     #[serde(default)]
     pub post_renew: PostRenewHooks,
 }
 
-#[derive(Debug, Deserialize, Clone, Default)]
+#[derive(Debug, Serialize, Deserialize, Clone, Default)]
 pub struct PostRenewHooks {
     #[serde(default)]
     pub success: Vec<HookCommand>,
@@ -197,7 +818,7 @@ pub struct PostRenewHooks {
     pub failure: Vec<HookCommand>,
 }
 
-#[derive(Debug, Deserialize, Clone)]
+#[derive(Debug, Serialize, Deserialize, Clone)]
 pub struct HookCommand {
     pub command: String,
     #[serde(default)]
@@ -214,7 +835,7 @@ pub struct HookCommand {
     pub on_failure: HookFailurePolicy,
 }
 
-#[derive(Debug, Deserialize, Clone, Copy, PartialEq, Eq, Default)]
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, PartialEq, Eq, Default)]
 #[serde(rename_all = "snake_case")]
 pub enum HookFailurePolicy {
     #[default]
@@ -222,12 +843,44 @@ pub enum HookFailurePolicy {
     Stop,
 }
 
+/// An empty profile with every optional setting at its config default,
+/// for building profiles in code with struct update syntax.
+impl Default for DaemonProfileSettings {
+    fn default() -> Self {
+        Self {
+            service_name: String::new(),
+            instance_id: String::new(),
+            hostname: String::new(),
+            paths: Paths::default(),
+            daemon: DaemonRuntimeSettings::default(),
+            retry: None,
+            hooks: HookSettings::default(),
+            subject: SubjectSettings::default(),
+            eab: None,
+            cert_group_gid: None,
+            pkcs11: None,
+            bundle: defaults::default_bundle(),
+            format: OutputFormat::default(),
+            bundle_order: BundleOrder::default(),
+            cleanup_on_failure: false,
+            outputs: None,
+            key_delivery: None,
+            skip_if_valid: false,
+        }
+    }
+}
+
 impl Default for DaemonRuntimeSettings {
     fn default() -> Self {
         Self {
             check_interval: defaults::default_check_interval(),
             renew_before: defaults::default_renew_before(),
+            renew_before_pct: None,
             check_jitter: defaults::default_check_jitter(),
+            escalate_before: defaults::default_escalate_before(),
+            exit_on_expired: false,
+            renew_on_revoked: false,
+            verify_dns_before_renew: false,
         }
     }
 }
@@ -272,8 +925,11 @@ impl Settings {
                 .try_parsing(true)
                 .ignore_empty(true)
                 .list_separator(",")
+                .with_list_parse_key("contacts")
                 .with_list_parse_key("retry.backoff_secs")
-                .with_list_parse_key("trust.trusted_ca_sha256"),
+                .with_list_parse_key("trust.trusted_ca_sha256")
+                .with_list_parse_key("trust.server_spki_sha256")
+                .with_list_parse_key("dns01.propagation_nameservers"),
         );
 
         // 4. Build
@@ -290,6 +946,9 @@ impl Settings {
         if let Some(email) = &overrides.email {
             email.clone_into(&mut self.email);
         }
+        if !overrides.contacts.is_empty() {
+            self.contacts.clone_from(&overrides.contacts);
+        }
         if let Some(ca_url) = &overrides.ca_url {
             ca_url.clone_into(&mut self.server);
         }
@@ -299,6 +958,174 @@ impl Settings {
         if let Some(responder_hmac) = &overrides.http_responder_hmac {
             responder_hmac.clone_into(&mut self.acme.http_responder_hmac);
         }
+        if overrides.insecure_http {
+            self.acme.allow_insecure_http = true;
+        }
+        if !overrides.url_rewrites.is_empty() {
+            self.acme.url_rewrites.clone_from(&overrides.url_rewrites);
+        }
+        if overrides.purge_account_on_success {
+            self.acme.purge_account_on_success = true;
+        }
+        if overrides.trace_http != HttpTrace::Off {
+            self.acme.trace_http = overrides.trace_http;
+        }
+        if let Some(endpoint) = &overrides.otel_endpoint {
+            self.otel.endpoint = Some(endpoint.clone());
+        }
+        if !overrides.dns_propagation_nameservers.is_empty() {
+            self.dns01
+                .propagation_nameservers
+                .clone_from(&overrides.dns_propagation_nameservers);
+        }
+        if let Some(timeout_secs) = overrides.dns_propagation_timeout_secs {
+            self.dns01.propagation_timeout_secs = timeout_secs;
+        }
+        if overrides.dns01_manual {
+            self.acme.challenge = ChallengeKind::Dns01;
+            self.dns01.manual = true;
+        }
+        if let Some(format) = overrides.output_format {
+            for profile in &mut self.profiles {
+                profile.format = format;
+            }
+        }
+        if let Some(order) = overrides.bundle_order {
+            for profile in &mut self.profiles {
+                profile.bundle_order = order;
+            }
+        }
+        if let Some(pid_file) = &overrides.reload_pid_file {
+            self.reload.pid_file = Some(pid_file.clone());
+        }
+        if let Some(signal) = &overrides.reload_signal {
+            self.reload.signal = Some(signal.clone());
+        }
+        if let Some(container) = &overrides.reload_container {
+            self.reload.container = Some(container.clone());
+        }
+        if let Some(provisioner) = &overrides.provisioner {
+            self.acme.provisioner = Some(provisioner.clone());
+        }
+        if let Some(dir) = &overrides.ca_dir {
+            self.trust.ca_dir = Some(dir.clone());
+        }
+        if !overrides.server_spki_sha256.is_empty() {
+            self.trust
+                .server_spki_sha256
+                .clone_from(&overrides.server_spki_sha256);
+        }
+        if overrides.exit_on_expired {
+            for profile in &mut self.profiles {
+                profile.daemon.exit_on_expired = true;
+            }
+        }
+        if overrides.renew_on_revoked {
+            for profile in &mut self.profiles {
+                profile.daemon.renew_on_revoked = true;
+            }
+        }
+        if overrides.verify_dns_before_renew {
+            for profile in &mut self.profiles {
+                profile.daemon.verify_dns_before_renew = true;
+            }
+        }
+        if let Some(pct) = overrides.renew_before_pct {
+            for profile in &mut self.profiles {
+                profile.daemon.renew_before_pct = Some(pct);
+            }
+        }
+        if overrides.check_sct {
+            self.acme.check_sct = true;
+        }
+        if overrides.require_eab {
+            self.acme.require_eab = true;
+        }
+        if let Some(url) = &overrides.require_tos {
+            self.acme.require_tos = Some(url.clone());
+        }
+        if let Some(path) = &overrides.account_key_path {
+            self.acme.account_key_path = Some(path.clone());
+        }
+        if let Some(command) = &overrides.solver_command {
+            self.acme.solver_command = Some(command.clone());
+        }
+        if let Some(version) = overrides.tls_min_version {
+            self.trust.tls_min_version = version;
+        }
+        if let Some(version) = overrides.tls_max_version {
+            self.trust.tls_max_version = Some(version);
+        }
+        if let Some(interval_secs) = overrides.order_poll_interval_secs {
+            self.acme.order_poll_interval_secs = Some(interval_secs);
+        }
+        if let Some(timeout_secs) = overrides.order_timeout_secs {
+            self.acme.order_timeout_secs = Some(timeout_secs);
+        }
+        if let Some(limit) = overrides.max_parallel_challenges {
+            self.acme.max_parallel_challenges = limit;
+        }
+        if let Some(addr) = &overrides.health_addr {
+            self.status.health_addr = Some(addr.clone());
+        }
+        for profile in &mut self.profiles {
+            if overrides.cleanup_on_failure {
+                profile.cleanup_on_failure = true;
+            }
+            if let Some(pin) = &overrides.pin_path {
+                profile.paths.pin = Some(pin.clone());
+            }
+            if let Some(name) = &overrides.cert_name {
+                profile.paths.cert.set_file_name(name);
+            }
+            if let Some(name) = &overrides.key_name {
+                profile.paths.key.set_file_name(name);
+            }
+            if let Some(organization) = &overrides.subject_organization {
+                profile.subject.organization = Some(organization.clone());
+            }
+            if let Some(unit) = &overrides.subject_organizational_unit {
+                profile.subject.organizational_unit = Some(unit.clone());
+            }
+            if let Some(country) = &overrides.subject_country {
+                profile.subject.country = Some(country.clone());
+            }
+            if !overrides.uri_sans.is_empty() {
+                profile.subject.uri_sans.clone_from(&overrides.uri_sans);
+            }
+            if !overrides.email_sans.is_empty() {
+                profile.subject.email_sans.clone_from(&overrides.email_sans);
+            }
+            if !overrides.expected_sans.is_empty() {
+                profile
+                    .subject
+                    .expected_sans
+                    .clone_from(&overrides.expected_sans);
+            }
+            if let Some(delivery) = &overrides.key_delivery {
+                profile.key_delivery = Some(delivery.clone());
+            }
+            if overrides.skip_if_valid {
+                profile.skip_if_valid = true;
+            }
+            if let Some(base) = &overrides.certbot_layout {
+                profile
+                    .outputs
+                    .get_or_insert_with(|| vec![OutputSinkSettings::Files])
+                    .push(OutputSinkSettings::Certbot { base: base.clone() });
+            }
+            if let Some(base) = &overrides.versioned_out {
+                profile
+                    .outputs
+                    .get_or_insert_with(|| vec![OutputSinkSettings::Files])
+                    .push(OutputSinkSettings::Versioned {
+                        base: base.clone(),
+                        keep_versions: overrides
+                            .keep_versions
+                            .unwrap_or_else(defaults::default_keep_versions),
+                    });
+            }
+        }
     }
 
     /// Validates configuration values for correctness.
@@ -308,6 +1135,17 @@ impl Settings {
     pub fn validate(&self) -> Result<()> {
         validation::validate_settings(self)
     }
+
+    /// Validates settings without requiring any `[[profiles]]`.
+    ///
+    /// Used by `--renew-dir`, which renews certificates described by
+    /// their sidecar metadata rather than by configured profiles.
+    ///
+    /// # Errors
+    /// Returns an error if any configured value is invalid.
+    pub fn validate_allowing_no_profiles(&self) -> Result<()> {
+        validation::validate_settings_allowing_no_profiles(self)
+    }
 }
 
 #[cfg(test)]
@@ -360,7 +1198,14 @@ mod tests {
         assert_eq!(settings.acme.directory_fetch_base_delay_secs, 1);
         assert_eq!(settings.acme.directory_fetch_max_delay_secs, 10);
         assert_eq!(settings.acme.poll_attempts, 15);
+        assert_eq!(settings.acme.max_parallel_challenges, 1);
         assert_eq!(settings.acme.poll_interval_secs, 2);
+        assert!(!settings.acme.use_ari);
+        assert!(settings.acme.dns_resolver.is_none());
+        assert_eq!(settings.acme.challenge, ChallengeKind::Http01);
+        assert_eq!(settings.dns01.listen_addr, "0.0.0.0:53");
+        assert!(settings.dns01.propagation_nameservers.is_empty());
+        assert_eq!(settings.dns01.propagation_timeout_secs, 120);
         assert_eq!(settings.retry.backoff_secs, vec![5, 10, 30, 60]);
         assert_eq!(settings.scheduler.max_concurrent_issuances, 3);
         assert!(settings.trust.ca_bundle_path.is_none());
@@ -370,8 +1215,40 @@ mod tests {
         assert_eq!(profile.daemon.check_interval, Duration::from_hours(1));
         assert_eq!(profile.daemon.renew_before, Duration::from_hours(16));
         assert_eq!(profile.daemon.check_jitter, Duration::from_secs(0));
+        assert_eq!(profile.daemon.escalate_before, Duration::from_hours(4));
+        assert!(!profile.daemon.exit_on_expired);
+        assert!(!profile.daemon.renew_on_revoked);
+        assert_eq!(profile.daemon.renew_before_pct, None);
         assert!(profile.hooks.post_renew.success.is_empty());
         assert!(profile.hooks.post_renew.failure.is_empty());
+        assert!(profile.bundle);
+        assert!(profile.paths.chain.is_none());
+    }
+
+    #[test]
+    fn test_load_settings_reads_acme_opt_ins() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        writeln!(
+            file,
+            r#"
+            [acme]
+            http_responder_hmac = "dev-hmac"
+            use_ari = true
+            dns_resolver = "10.0.0.53:53"
+            challenge = "dns-01"
+
+            [dns01]
+            listen_addr = "10.0.0.10:5353"
+        "#
+        )
+        .unwrap();
+        file.flush().unwrap();
+
+        let settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        assert!(settings.acme.use_ari);
+        assert_eq!(settings.acme.dns_resolver.as_deref(), Some("10.0.0.53:53"));
+        assert_eq!(settings.acme.challenge, ChallengeKind::Dns01);
+        assert_eq!(settings.dns01.listen_addr, "10.0.0.10:5353");
     }
 
     #[test]
@@ -463,14 +1340,91 @@ mod tests {
         let args = crate::Args {
             config: None,
             email: Some("cli@example.com".to_string()),
+            contact: Vec::new(),
             ca_url: None, // Keep default/config
             http_responder_url: None,
             http_responder_hmac: None,
             eab_kid: None,
             eab_hmac: None,
             eab_file: None,
+            eab_command: None,
+            eab_dir: None,
             oneshot: false,
+            renew_dir: None,
+            renew_rate: None,
+            serve: None,
+            api_token_file: None,
+            staple_test: None,
             insecure: false,
+            insecure_http: false,
+            otel_endpoint: None,
+            run_id: None,
+            dns_resolver_check: Vec::new(),
+            dns_propagation_timeout: None,
+            dns01_manual: false,
+            trust_root_on_first_use: false,
+            fetch_root_from: None,
+            expected_fingerprint: None,
+            format: None,
+            bundle_order: None,
+            key_fd: None,
+            key_fifo: None,
+            no_register_if_exists: false,
+            certbot_layout: None,
+            versioned_out: None,
+            keep_versions: None,
+            url_rewrite: Vec::new(),
+            purge_account_on_success: false,
+            trace_http: false,
+            trace_http_bodies: false,
+            reload_pid_file: None,
+            reload_signal: None,
+            reload_container: None,
+            provisioner: None,
+            root_dir: None,
+            pin_sha256: Vec::new(),
+            exit_on_expired: false,
+            renew_on_revoked: false,
+            verify_dns_before_renew: false,
+            renew_before_pct: None,
+            check_sct: false,
+            require_eab: false,
+            require_tos: None,
+            account_key: None,
+            import_account: None,
+            import_account_url: None,
+            test_eab: false,
+            deactivate_test_account: false,
+            print_acme_directory: false,
+            wait_for_ca: None,
+            result_json: false,
+            max_runtime: None,
+            gen_csr: false,
+            csr_out: None,
+            solver_command: None,
+            tls_min_version: None,
+            tls_max_version: None,
+            order_poll_interval: None,
+            order_timeout: None,
+            max_parallel_challenges: None,
+            cleanup_on_failure: false,
+            subject_o: None,
+            subject_ou: None,
+            subject_c: None,
+            uri_san: Vec::new(),
+            email_san: Vec::new(),
+            expected_san: Vec::new(),
+            health_addr: None,
+            write_pin: None,
+            cert_name: None,
+            key_name: None,
+            print_chain: None,
+            check_expiry: None,
+            min_remaining: None,
+            ssh_sign: None,
+            ssh_cert_type: None,
+            ssh_principal: Vec::new(),
+            ssh_token_file: None,
         };
 
         settings.merge_with_args(&args);
@@ -492,20 +1446,173 @@ mod tests {
 
         let overrides = CliOverrides {
             email: Some("override@example.com".to_string()),
+            contacts: vec!["tel:+82-2-555-0100".to_string()],
             ca_url: Some("https://override-ca".to_string()),
             http_responder_url: Some("http://override-responder".to_string()),
             http_responder_hmac: Some("override-hmac".to_string()),
+            insecure_http: true,
+            otel_endpoint: Some("http://collector:4318".to_string()),
+            run_id: None,
+            dns_propagation_nameservers: vec!["10.0.0.2:53".to_string()],
+            dns_propagation_timeout_secs: Some(30),
+            dns01_manual: true,
+            output_format: Some(OutputFormat::Der),
+            bundle_order: Some(BundleOrder::ChainLeaf),
+            reload_pid_file: Some(PathBuf::from("/run/nginx.pid")),
+            reload_signal: Some("USR1".to_string()),
+            reload_container: Some("edge-proxy".to_string()),
+            provisioner: Some("acme-staging".to_string()),
+            ca_dir: Some(PathBuf::from("/etc/ssl/certs")),
+            server_spki_sha256: vec!["b".repeat(64)],
+            exit_on_expired: true,
+            renew_on_revoked: true,
+            verify_dns_before_renew: true,
+            renew_before_pct: Some(33),
+            check_sct: true,
+            require_eab: true,
+            require_tos: Some("https://ca.internal/tos/v2".to_string()),
+            account_key_path: Some(PathBuf::from("/var/lib/bootroot/account.key")),
+            solver_command: Some(PathBuf::from("/usr/local/bin/dns-solver")),
+            tls_min_version: Some(TlsVersion::Tls13),
+            tls_max_version: Some(TlsVersion::Tls13),
+            order_poll_interval_secs: Some(5),
+            order_timeout_secs: Some(300),
+            max_parallel_challenges: Some(4),
+            cleanup_on_failure: true,
+            subject_organization: Some("Example Corp".to_string()),
+            subject_organizational_unit: Some("Edge".to_string()),
+            subject_country: Some("KR".to_string()),
+            uri_sans: vec!["spiffe://trusted.domain/edge".to_string()],
+            email_sans: vec!["edge@example.com".to_string()],
+            expected_sans: vec![
+                "001.edge-proxy.edge-node-01.trusted.domain".to_string(),
+                "spiffe://trusted.domain/edge".to_string(),
+            ],
+            health_addr: Some("0.0.0.0:8081".to_string()),
+            pin_path: Some(PathBuf::from("/srv/edge/spki.pin")),
+            cert_name: Some("tls.crt".to_string()),
+            key_name: Some("tls.key".to_string()),
+            key_delivery: Some(KeyDelivery::Fifo(PathBuf::from("/run/edge/key.fifo"))),
+            skip_if_valid: true,
+            certbot_layout: Some(PathBuf::from("/etc/letsencrypt")),
+            versioned_out: Some(PathBuf::from("/srv/tls")),
+            keep_versions: Some(5),
+            url_rewrites: vec![UrlRewrite {
+                from: "https://stepca.internal:9000/".to_string(),
+                to: "https://ca.example.com/".to_string(),
+            }],
+            purge_account_on_success: true,
+            trace_http: HttpTrace::Bodies,
         };
 
         settings.apply_overrides(&overrides);
 
         assert_eq!(settings.email, "override@example.com");
+        assert_eq!(settings.contacts, vec!["tel:+82-2-555-0100".to_string()]);
         assert_eq!(settings.server, "https://override-ca");
         assert_eq!(
             settings.acme.http_responder_url,
             "http://override-responder"
         );
         assert_eq!(settings.acme.http_responder_hmac, "override-hmac");
+        assert!(settings.acme.allow_insecure_http);
+        assert!(settings.acme.purge_account_on_success);
+        assert_eq!(settings.acme.trace_http, HttpTrace::Bodies);
+        assert_eq!(
+            settings.acme.url_rewrites,
+            [UrlRewrite {
+                from: "https://stepca.internal:9000/".to_string(),
+                to: "https://ca.example.com/".to_string(),
+            }]
+        );
+        assert_eq!(
+            settings.otel.endpoint.as_deref(),
+            Some("http://collector:4318")
+        );
+        assert_eq!(settings.dns01.propagation_nameservers, ["10.0.0.2:53"]);
+        assert_eq!(settings.dns01.propagation_timeout_secs, 30);
+        assert_eq!(settings.acme.challenge, ChallengeKind::Dns01);
+        assert!(settings.dns01.manual);
+        assert_eq!(settings.profiles[0].format, OutputFormat::Der);
+        assert_eq!(settings.profiles[0].bundle_order, BundleOrder::ChainLeaf);
+        assert_eq!(
+            settings.reload.pid_file,
+            Some(PathBuf::from("/run/nginx.pid"))
+        );
+        assert_eq!(settings.reload.signal.as_deref(), Some("USR1"));
+        assert_eq!(settings.reload.container.as_deref(), Some("edge-proxy"));
+        assert_eq!(settings.acme.provisioner.as_deref(), Some("acme-staging"));
+        assert_eq!(settings.trust.ca_dir, Some(PathBuf::from("/etc/ssl/certs")));
+        assert_eq!(settings.trust.server_spki_sha256, ["b".repeat(64)]);
+        assert!(settings.profiles[0].daemon.exit_on_expired);
+        assert!(settings.profiles[0].daemon.renew_on_revoked);
+        assert!(settings.profiles[0].daemon.verify_dns_before_renew);
+        assert_eq!(settings.profiles[0].daemon.renew_before_pct, Some(33));
+        assert!(settings.acme.check_sct);
+        assert!(settings.acme.require_eab);
+        assert_eq!(
+            settings.acme.require_tos.as_deref(),
+            Some("https://ca.internal/tos/v2")
+        );
+        assert_eq!(
+            settings.acme.account_key_path,
+            Some(PathBuf::from("/var/lib/bootroot/account.key"))
+        );
+        assert_eq!(
+            settings.acme.solver_command,
+            Some(PathBuf::from("/usr/local/bin/dns-solver"))
+        );
+        assert_eq!(settings.trust.tls_min_version, TlsVersion::Tls13);
+        assert_eq!(settings.trust.tls_max_version, Some(TlsVersion::Tls13));
+        assert_eq!(settings.acme.order_poll_interval_secs, Some(5));
+        assert_eq!(settings.acme.order_timeout_secs, Some(300));
+        assert_eq!(settings.acme.max_parallel_challenges, 4);
+        assert!(settings.profiles[0].cleanup_on_failure);
+        assert_eq!(settings.status.health_addr.as_deref(), Some("0.0.0.0:8081"));
+        assert_eq!(
+            settings.profiles[0].paths.pin,
+            Some(PathBuf::from("/srv/edge/spki.pin"))
+        );
+        assert_eq!(
+            settings.profiles[0].paths.cert,
+            PathBuf::from("certs/tls.crt")
+        );
+        assert_eq!(
+            settings.profiles[0].paths.key,
+            PathBuf::from("certs/tls.key")
+        );
+        assert_eq!(
+            settings.profiles[0].key_delivery,
+            Some(KeyDelivery::Fifo(PathBuf::from("/run/edge/key.fifo")))
+        );
+        assert!(settings.profiles[0].skip_if_valid);
+        assert_eq!(
+            settings.profiles[0].outputs,
+            Some(vec![
+                OutputSinkSettings::Files,
+                OutputSinkSettings::Certbot {
+                    base: PathBuf::from("/etc/letsencrypt")
+                },
+                OutputSinkSettings::Versioned {
+                    base: PathBuf::from("/srv/tls"),
+                    keep_versions: 5,
+                },
+            ])
+        );
+        assert_eq!(
+            settings.profiles[0].subject,
+            SubjectSettings {
+                organization: Some("Example Corp".to_string()),
+                organizational_unit: Some("Edge".to_string()),
+                country: Some("KR".to_string()),
+                uri_sans: vec!["spiffe://trusted.domain/edge".to_string()],
+                email_sans: vec!["edge@example.com".to_string()],
+                expected_sans: vec![
+                    "001.edge-proxy.edge-node-01.trusted.domain".to_string(),
+                    "spiffe://trusted.domain/edge".to_string(),
+                ],
+            }
+        );
     }
 
     #[test]
@@ -554,9 +1661,57 @@ mod tests {
 
         let overrides = CliOverrides {
             email: None,
+            contacts: Vec::new(),
             ca_url: Some("https://cli-ca".to_string()),
             http_responder_url: None,
             http_responder_hmac: Some("cli-hmac-secret".to_string()),
+            insecure_http: false,
+            otel_endpoint: None,
+            run_id: None,
+            dns_propagation_nameservers: Vec::new(),
+            dns_propagation_timeout_secs: None,
+            dns01_manual: false,
+            output_format: None,
+            bundle_order: None,
+            reload_pid_file: None,
+            reload_signal: None,
+            reload_container: None,
+            provisioner: None,
+            ca_dir: None,
+            server_spki_sha256: Vec::new(),
+            exit_on_expired: false,
+            renew_on_revoked: false,
+            verify_dns_before_renew: false,
+            renew_before_pct: None,
+            check_sct: false,
+            require_eab: false,
+            require_tos: None,
+            account_key_path: None,
+            solver_command: None,
+            tls_min_version: None,
+            tls_max_version: None,
+            order_poll_interval_secs: None,
+            order_timeout_secs: None,
+            max_parallel_challenges: None,
+            cleanup_on_failure: false,
+            subject_organization: None,
+            subject_organizational_unit: None,
+            subject_country: None,
+            uri_sans: Vec::new(),
+            email_sans: Vec::new(),
+            expected_sans: Vec::new(),
+            health_addr: None,
+            pin_path: None,
+            cert_name: None,
+            key_name: None,
+            key_delivery: None,
+            skip_if_valid: false,
+            certbot_layout: None,
+            versioned_out: None,
+            keep_versions: None,
+            url_rewrites: Vec::new(),
+            purge_account_on_success: false,
+            trace_http: HttpTrace::Off,
         };
 
         // Simulate the daemon retry path: reload from disk, then apply overrides.
@@ -581,6 +1736,515 @@ mod tests {
         assert!(err.to_string().contains("directory_fetch_attempts"));
     }
 
+    #[test]
+    fn test_validate_rejects_purging_a_persistent_account() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.acme.purge_account_on_success = true;
+        assert!(settings.validate().is_ok());
+
+        settings.acme.account_key_path = Some(PathBuf::from("/var/lib/bootroot/account.key"));
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("acme.account_key_path"), "{err:#}");
+    }
+
+    #[test]
+    fn test_validate_rejects_invalid_dns_resolver() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.acme.dns_resolver = Some("dns.example".to_string());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("acme.dns_resolver"));
+
+        settings.acme.dns_resolver = Some("10.0.0.53".to_string());
+        assert!(settings.validate().is_ok());
+    }
+
+    #[test]
+    fn test_validate_rejects_relative_require_tos() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.acme.require_tos = Some("tos/v2".to_string());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("acme.require_tos"));
+
+        settings.acme.require_tos = Some("https://ca.internal/tos/v2".to_string());
+        assert!(settings.validate().is_ok());
+    }
+
+    #[test]
+    fn test_validate_dns01_checks_listen_addr_instead_of_responder() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.acme.challenge = ChallengeKind::Dns01;
+        settings.acme.http_responder_hmac = String::new();
+        assert!(settings.validate().is_ok());
+
+        settings.dns01.listen_addr = "ns.internal".to_string();
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("dns01.listen_addr"));
+    }
+
+    #[test]
+    fn test_validate_dns01_manual_needs_dns01_and_no_listener() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.dns01.manual = true;
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("dns01.manual requires"));
+
+        settings.acme.challenge = ChallengeKind::Dns01;
+        settings.dns01.listen_addr = String::new();
+        assert!(settings.validate().is_ok());
+
+        settings.acme.solver_command = Some(PathBuf::from("/usr/local/bin/dns-solver"));
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("acme.solver_command"));
+    }
+
+    #[test]
+    fn test_validate_dns01_propagation_nameservers() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.acme.challenge = ChallengeKind::Dns01;
+        settings.dns01.propagation_nameservers = vec!["ns1.internal".to_string()];
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("dns01.propagation_nameservers"));
+
+        settings.dns01.propagation_nameservers = vec!["10.0.0.2".to_string()];
+        assert!(settings.validate().is_ok());
+
+        settings.dns01.propagation_timeout_secs = 0;
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("dns01.propagation_timeout_secs"));
+    }
+
+    #[test]
+    fn test_validate_solver_command_replaces_builtin_solver_checks() {
+        use std::os::unix::fs::PermissionsExt;
+
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        let dir = tempfile::tempdir().unwrap();
+        let solver = dir.path().join("solver");
+        std::fs::write(&solver, "#!/bin/sh\n").unwrap();
+        settings.acme.solver_command = Some(solver.clone());
+        settings.acme.http_responder_hmac = String::new();
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("not executable"));
+
+        std::fs::set_permissions(&solver, std::fs::Permissions::from_mode(0o755)).unwrap();
+        assert!(settings.validate().is_ok());
+        settings.acme.challenge = ChallengeKind::Dns01;
+        settings.dns01.listen_addr = "ns.internal".to_string();
+        assert!(settings.validate().is_ok());
+    }
+
+    #[test]
+    fn test_validate_allowing_no_profiles_accepts_empty_profiles() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.profiles.clear();
+
+        assert!(settings.validate().is_err());
+        assert!(settings.validate_allowing_no_profiles().is_ok());
+    }
+
+    #[test]
+    fn test_validate_rejects_invalid_status_listen_addr() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        assert!(settings.status.listen_addr.is_none());
+
+        settings.status.listen_addr = Some("localhost".to_string());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("status.listen_addr"));
+
+        settings.status.listen_addr = Some("127.0.0.1:9465".to_string());
+        assert!(settings.validate().is_ok());
+
+        settings.status.health_addr = Some("8081".to_string());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("status.health_addr"));
+    }
+
+    #[test]
+    fn test_load_settings_reads_profile_pkcs11() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        writeln!(
+            file,
+            r#"
+            [profiles.pkcs11]
+            module = "/usr/lib/softhsm/libsofthsm2.so"
+            slot = 7
+            label = "edge-proxy"
+        "#
+        )
+        .unwrap();
+        file.flush().unwrap();
+
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        let pkcs11 = settings.profiles[0].pkcs11.clone().unwrap();
+        assert_eq!(pkcs11.slot, 7);
+        assert_eq!(pkcs11.label, "edge-proxy");
+        assert!(pkcs11.pin.is_none());
+        assert!(settings.validate().is_ok());
+
+        if let Some(pkcs11) = settings.profiles[0].pkcs11.as_mut() {
+            pkcs11.module = PathBuf::from("libsofthsm2.so");
+        }
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("profiles.pkcs11.module"));
+    }
+
+    #[test]
+    fn test_load_settings_reads_profile_outputs() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        writeln!(
+            file,
+            r#"
+            [[profiles.outputs]]
+            type = "files"
+
+            [[profiles.outputs]]
+            type = "pkcs12"
+            path = "certs/edge-proxy-a.p12"
+
+            [[profiles.outputs]]
+            type = "kubernetes-secret"
+            path = "manifests/edge-proxy-tls.yaml"
+            name = "edge-proxy-tls"
+            namespace = "edge"
+
+            [[profiles.outputs]]
+            type = "stdout"
+
+            [[profiles.outputs]]
+            type = "versioned"
+            base = "/srv/tls"
+        "#
+        )
+        .unwrap();
+        file.flush().unwrap();
+
+        let settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        let outputs = settings.profiles[0].outputs.clone().unwrap();
+        assert_eq!(outputs.len(), 5);
+        assert_eq!(outputs[0], OutputSinkSettings::Files);
+        assert_eq!(
+            outputs[1],
+            OutputSinkSettings::Pkcs12 {
+                path: PathBuf::from("certs/edge-proxy-a.p12"),
+                password_file: None,
+            }
+        );
+        assert_eq!(outputs[3], OutputSinkSettings::Stdout);
+        assert_eq!(
+            outputs[4],
+            OutputSinkSettings::Versioned {
+                base: PathBuf::from("/srv/tls"),
+                keep_versions: 2,
+            }
+        );
+        assert!(settings.validate().is_ok());
+    }
+
+    #[test]
+    fn test_validate_checks_profile_outputs() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        let secret = |name: &str| OutputSinkSettings::KubernetesSecret {
+            path: PathBuf::from("manifests/edge-proxy-tls.yaml"),
+            name: name.to_string(),
+            namespace: None,
+        };
+
+        settings.profiles[0].outputs = Some(Vec::new());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("at least one sink"), "{err:#}");
+
+        settings.profiles[0].outputs = Some(vec![OutputSinkSettings::Stdout]);
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("files sink"), "{err:#}");
+
+        for name in ["Edge-Proxy", "-edge", "edge..proxy", "edge_proxy"] {
+            settings.profiles[0].outputs = Some(vec![OutputSinkSettings::Files, secret(name)]);
+            let err = settings.validate().unwrap_err();
+            assert!(err.to_string().contains("DNS subdomain"), "{name}: {err:#}");
+        }
+        settings.profiles[0].outputs =
+            Some(vec![OutputSinkSettings::Files, secret("edge-proxy.tls")]);
+        assert!(settings.validate().is_ok());
+
+        settings.profiles[0].outputs = Some(vec![
+            OutputSinkSettings::Files,
+            OutputSinkSettings::Pkcs12 {
+                path: PathBuf::from("certs/edge-proxy-a.key"),
+                password_file: None,
+            },
+        ]);
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("profiles.outputs.path"), "{err:#}");
+
+        settings.profiles[0].outputs = Some(vec![OutputSinkSettings::Files, secret("edge")]);
+        settings.profiles[0].pkcs11 = Some(Pkcs11Settings {
+            module: PathBuf::from("/usr/lib/softhsm/libsofthsm2.so"),
+            slot: 0,
+            label: "edge-proxy".to_string(),
+            pin: None,
+        });
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("PKCS#11"), "{err:#}");
+        settings.profiles[0].outputs = Some(vec![
+            OutputSinkSettings::Files,
+            OutputSinkSettings::Certbot {
+                base: PathBuf::from("/etc/letsencrypt"),
+            },
+        ]);
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("certbot sink"), "{err:#}");
+    }
+
+    #[test]
+    fn test_validate_rejects_no_bundle_with_include_root() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.trust.ca_bundle_path = Some(PathBuf::from("certs/ca-bundle.pem"));
+        settings.trust.trusted_ca_sha256 = vec!["a".repeat(64)];
+        settings.trust.include_root = true;
+        settings.profiles[0].bundle = false;
+
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("profiles.bundle"));
+    }
+
+    #[test]
+    fn test_validate_checks_reload_signal() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+
+        settings.reload.signal = Some("HUP".to_string());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("reload.pid_file"));
+
+        settings.reload.pid_file = Some(PathBuf::from("/run/nginx.pid"));
+        settings.reload.signal = Some("RELOAD".to_string());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("reload.signal"));
+
+        settings.reload.signal = Some("SIGUSR2".to_string());
+        assert!(settings.validate().is_ok());
+    }
+
+    #[test]
+    fn test_provisioner_directory_url_replaces_step_ca_provisioner() {
+        assert_eq!(
+            provisioner_directory_url("https://ca:9000/acme/acme/directory", "partners").unwrap(),
+            "https://ca:9000/acme/partners/directory"
+        );
+        assert_eq!(
+            server_provisioner("https://ca:9000/acme/partners/directory").as_deref(),
+            Some("partners")
+        );
+        assert!(server_provisioner("https://acme.example/directory").is_none());
+        let err =
+            provisioner_directory_url("https://acme.example/directory", "partners").unwrap_err();
+        assert!(err.to_string().contains("/acme/<provisioner>/directory"));
+    }
+
+    #[test]
+    fn test_profile_directory_url_prefers_profile_eab_provisioner() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.server = "https://ca:9000/acme/acme/directory".to_string();
+        let profile = settings.profiles[0].clone();
+
+        assert_eq!(
+            profile_directory_url(&settings, &profile).unwrap(),
+            settings.server
+        );
+
+        settings.acme.provisioner = Some("staging".to_string());
+        assert_eq!(
+            profile_directory_url(&settings, &profile).unwrap(),
+            "https://ca:9000/acme/staging/directory"
+        );
+
+        let profile = DaemonProfileSettings {
+            eab: Some(Eab {
+                kid: "kid".to_string(),
+                hmac: "hmac".to_string(),
+                provisioner: Some("partners".to_string()),
+            }),
+            ..profile
+        };
+        assert_eq!(
+            profile_directory_url(&settings, &profile).unwrap(),
+            "https://ca:9000/acme/partners/directory"
+        );
+    }
+
+    #[test]
+    fn test_validate_rejects_eab_for_other_provisioner() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.server = "https://ca:9000/acme/acme/directory".to_string();
+        settings.eab = Some(Eab {
+            kid: "kid".to_string(),
+            hmac: "hmac".to_string(),
+            provisioner: Some("partners".to_string()),
+        });
+
+        let err = settings.validate().unwrap_err();
+        assert!(
+            err.to_string()
+                .contains("EAB does not belong to provisioner acme")
+        );
+
+        settings.acme.provisioner = Some("partners".to_string());
+        assert!(settings.validate().is_ok());
+    }
+
+    #[test]
+    fn test_validate_checks_reload_container() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+
+        settings.reload.container = Some("--rm".to_string());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("reload.container"));
+
+        settings.reload.container = Some("edge-proxy".to_string());
+        settings.reload.container_runtime = Some("podman".to_string());
+        assert!(settings.validate().is_ok());
+    }
+
+    #[test]
+    fn test_validate_rejects_shared_output_paths() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        let mut second = settings.profiles[0].clone();
+        second.instance_id = "002".to_string();
+        second.paths.cert = PathBuf::from("certs/edge-proxy-b.pem");
+        second.paths.key = PathBuf::from("./certs/edge-proxy-a.key");
+        settings.profiles.push(second);
+
+        let err = settings.validate().unwrap_err();
+        assert!(
+            err.to_string().contains(
+                "profiles.paths.key ./certs/edge-proxy-a.key of \
+                 002.edge-proxy.edge-node-01.trusted.domain is already used as \
+                 profiles.paths.key of 001.edge-proxy.edge-node-01.trusted.domain"
+            ),
+            "{err:#}"
+        );
+
+        settings.profiles[1].paths.key = PathBuf::from("certs/edge-proxy-b.key");
+        settings.profiles[1].paths.chain = Some(PathBuf::from("certs/edge-proxy-b.pem"));
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("profiles.paths.chain"), "{err:#}");
+
+        settings.profiles[1].paths.chain = Some(PathBuf::from("certs/edge-proxy-b.chain.pem"));
+        assert!(settings.validate().is_ok());
+
+        settings.trust.ca_bundle_path = Some(PathBuf::from("certs/edge-proxy-b.chain.pem"));
+        settings.trust.trusted_ca_sha256 = vec!["a".repeat(64)];
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("trust.ca_bundle_path"), "{err:#}");
+    }
+
+    #[test]
+    fn test_validate_rejects_der_format_with_include_root() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.trust.ca_bundle_path = Some(PathBuf::from("certs/ca-bundle.pem"));
+        settings.trust.trusted_ca_sha256 = vec!["a".repeat(64)];
+        settings.trust.include_root = true;
+        settings.profiles[0].format = OutputFormat::Der;
+
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("profiles.format"));
+    }
+
+    #[test]
+    fn test_validate_rejects_key_delivery_that_writes_the_key_to_a_file() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        let regular = tempfile::NamedTempFile::new().unwrap();
+        settings.profiles[0].key_delivery = Some(KeyDelivery::Fifo(regular.path().to_path_buf()));
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("not a named pipe"), "{err:#}");
+
+        settings.profiles[0].outputs = Some(vec![
+            OutputSinkSettings::Files,
+            OutputSinkSettings::Pkcs12 {
+                path: PathBuf::from("certs/edge.p12"),
+                password_file: None,
+            },
+        ]);
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("outputs"), "{err:#}");
+
+        settings.profiles.push(settings.profiles[0].clone());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("exactly one profile"), "{err:#}");
+    }
+
+    #[test]
+    fn test_validate_checks_email_contacts() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+
+        settings.email = "ops@example.com,admin".to_string();
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("email must be empty"));
+
+        settings.email = "ops@example.com, security@example.com".to_string();
+        assert!(settings.validate().is_ok());
+
+        settings.email = String::new();
+        assert!(settings.validate().is_ok());
+    }
+
+    #[test]
+    fn test_validate_checks_contact_uris() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        assert!(settings.contacts.is_empty());
+
+        settings.contacts = vec![
+            "mailto:ops@example.com".to_string(),
+            "tel:+82-2-555-0100".to_string(),
+        ];
+        assert!(settings.validate().is_ok());
+
+        settings.contacts.push("ops@example.com".to_string());
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("contacts entry"), "{err:#}");
+    }
+
     #[test]
     fn test_validate_rejects_empty_domain() {
         let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
@@ -592,13 +2256,40 @@ mod tests {
     }
 
     #[test]
-    fn test_validate_rejects_non_ascii_domain() {
+    fn test_validate_accepts_idn_domain_and_rejects_invalid_names() {
         let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
         write_minimal_profile_config(&mut file);
         let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
         settings.domain = "예시.local".to_string();
+        assert!(settings.validate().is_ok());
+
+        settings.domain = "예시.local/path".to_string();
         let err = settings.validate().unwrap_err();
-        assert!(err.to_string().contains("domain must be ASCII"));
+        assert!(err.to_string().contains("domain must be a valid DNS name"));
+
+        settings.domain = "trusted.domain".to_string();
+        settings.profiles[0].hostname = "knoten münchen".to_string();
+        let err = settings.validate().unwrap_err();
+        assert!(err.to_string().contains("profiles.hostname"));
+    }
+
+    #[test]
+    fn test_profile_domain_converts_unicode_labels() {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        write_minimal_profile_config(&mut file);
+        let mut settings = Settings::new(Some(file.path().to_path_buf())).unwrap();
+        settings.domain = "münchen.de".to_string();
+        settings.profiles[0].hostname = "Bücher".to_string();
+        let profile = &settings.profiles[0];
+
+        assert_eq!(
+            profile_domain(&settings, profile),
+            "001.edge-proxy.xn--bcher-kva.xn--mnchen-3ya.de"
+        );
+        assert_eq!(
+            profile_domain_as_configured(&settings, profile),
+            "001.edge-proxy.Bücher.münchen.de"
+        );
     }
 
     #[test]
@@ -9,6 +9,7 @@ const DEFAULT_DOMAIN: &str = "trusted.domain";
 const DEFAULT_CHECK_INTERVAL_SECS: u64 = 60 * 60;
 const DEFAULT_RENEW_BEFORE_SECS: u64 = 16 * 60 * 60;
 const DEFAULT_CHECK_JITTER_SECS: u64 = 0;
+const DEFAULT_ESCALATE_BEFORE_SECS: u64 = 4 * 60 * 60;
 const DEFAULT_HTTP_RESPONDER_URL: &str = "http://localhost:8080";
 const DEFAULT_HTTP_RESPONDER_HMAC: &str = "";
 const DEFAULT_HTTP_RESPONDER_TIMEOUT_SECS: u64 = 5;
@@ -17,10 +18,16 @@ const DEFAULT_DIRECTORY_FETCH_ATTEMPTS: u64 = 10;
 const DEFAULT_DIRECTORY_FETCH_BASE_DELAY_SECS: u64 = 1;
 const DEFAULT_DIRECTORY_FETCH_MAX_DELAY_SECS: u64 = 10;
 const DEFAULT_POLL_ATTEMPTS: u64 = 15;
+const DEFAULT_MAX_PARALLEL_CHALLENGES: u64 = 1;
 const DEFAULT_POLL_INTERVAL_SECS: u64 = 2;
+const DEFAULT_USE_ARI: bool = false;
+const DEFAULT_BUNDLE: bool = true;
 const DEFAULT_RETRY_BACKOFF_SECS: [u64; 4] = [5, 10, 30, 60];
 const DEFAULT_HOOK_TIMEOUT_SECS: u64 = 30;
+const DEFAULT_KEEP_VERSIONS: usize = 2;
 const DEFAULT_MAX_CONCURRENT_ISSUANCES: u64 = 3;
+const DEFAULT_DNS01_LISTEN_ADDR: &str = "0.0.0.0:53";
+const DEFAULT_DNS01_PROPAGATION_TIMEOUT_SECS: u64 = 120;
 const DEFAULT_FAST_POLL_INTERVAL_SECS: u64 = 30;
 const DEFAULT_KV_MOUNT: &str = "secret";
 const DEFAULT_FAST_POLL_STATE_PATH: &str = "bootroot-agent-state.json";
@@ -56,10 +63,20 @@ pub(crate) fn apply_defaults(
         )?
         .set_default("acme.poll_attempts", DEFAULT_POLL_ATTEMPTS)?
         .set_default("acme.poll_interval_secs", DEFAULT_POLL_INTERVAL_SECS)?
+        .set_default(
+            "acme.max_parallel_challenges",
+            DEFAULT_MAX_PARALLEL_CHALLENGES,
+        )?
+        .set_default("acme.use_ari", DEFAULT_USE_ARI)?
         .set_default("retry.backoff_secs", DEFAULT_RETRY_BACKOFF_SECS.to_vec())?
         .set_default(
             "scheduler.max_concurrent_issuances",
             DEFAULT_MAX_CONCURRENT_ISSUANCES,
+        )?
+        .set_default("dns01.listen_addr", DEFAULT_DNS01_LISTEN_ADDR)?
+        .set_default(
+            "dns01.propagation_timeout_secs",
+            DEFAULT_DNS01_PROPAGATION_TIMEOUT_SECS,
         )
 }
 
@@ -67,6 +84,10 @@ pub(crate) fn default_hook_timeout_secs() -> u64 {
     DEFAULT_HOOK_TIMEOUT_SECS
 }
 
+pub(crate) fn default_keep_versions() -> usize {
+    DEFAULT_KEEP_VERSIONS
+}
+
 pub(crate) fn default_check_interval() -> Duration {
     Duration::from_secs(DEFAULT_CHECK_INTERVAL_SECS)
 }
@@ -79,6 +100,14 @@ pub(crate) fn default_check_jitter() -> Duration {
     Duration::from_secs(DEFAULT_CHECK_JITTER_SECS)
 }
 
+pub(crate) fn default_escalate_before() -> Duration {
+    Duration::from_secs(DEFAULT_ESCALATE_BEFORE_SECS)
+}
+
+pub(crate) fn default_bundle() -> bool {
+    DEFAULT_BUNDLE
+}
+
 pub(crate) fn default_max_concurrent_issuances() -> u64 {
     DEFAULT_MAX_CONCURRENT_ISSUANCES
 }
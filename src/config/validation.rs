@@ -1,11 +1,17 @@
+use std::collections::HashMap;
 use std::net::IpAddr;
+use std::path::{Component, Path, PathBuf};
 use std::time::Duration;
 
 use anyhow::{Context, Result};
 use reqwest::Url;
 
 use super::defaults::default_renew_before;
-use super::{DaemonProfileSettings, HookCommand, OpenBaoSettings, Settings, TrustSettings};
+use super::{
+    ChallengeKind, DaemonProfileSettings, HookCommand, OpenBaoSettings, OutputFormat,
+    OutputSinkSettings, Settings, SubjectSettings, TrustSettings,
+};
+use crate::key_delivery::KeyDelivery;
 
 /// Validates that `cert_duration` is strictly greater than the default
 /// daemon `renew_before` interval.
@@ -43,20 +49,75 @@ pub fn parse_cert_duration(value: &str) -> Result<Duration> {
 }
 
 pub(crate) fn validate_settings(settings: &Settings) -> Result<()> {
+    validate_settings_inner(settings, true)
+}
+
+/// Validates settings like [`validate_settings`] but accepts an empty
+/// `profiles` list, for `--renew-dir` runs that take their profiles from
+/// certificate metadata.
+pub(crate) fn validate_settings_allowing_no_profiles(settings: &Settings) -> Result<()> {
+    validate_settings_inner(settings, false)
+}
+
+fn validate_settings_inner(settings: &Settings, require_profiles: bool) -> Result<()> {
     if settings.domain.trim().is_empty() {
         anyhow::bail!("domain must not be empty");
     }
-    if !settings.domain.is_ascii() {
-        anyhow::bail!("domain must be ASCII");
+    if crate::input_validation::domain_to_ascii(&settings.domain).is_err() {
+        anyhow::bail!("domain must be a valid DNS name (Unicode labels must pass IDNA conversion)");
     }
+    if crate::input_validation::parse_email_list(&settings.email).is_err() {
+        anyhow::bail!(
+            "email must be empty or a comma-separated list of valid addresses, got '{}'",
+            settings.email
+        );
+    }
+    for contact in &settings.contacts {
+        if crate::input_validation::validate_acme_contact(contact).is_err() {
+            anyhow::bail!("contacts entry must be a mailto:, tel: or https: URI, got '{contact}'");
+        }
+    }
+    validate_acme_directory_url(&settings.server, settings.acme.allow_insecure_http)?;
     if settings.acme.directory_fetch_attempts == 0 {
         anyhow::bail!("acme.directory_fetch_attempts must be greater than 0");
     }
-    if settings.acme.http_responder_url.trim().is_empty() {
-        anyhow::bail!("acme.http_responder_url must not be empty");
-    }
-    if settings.acme.http_responder_hmac.trim().is_empty() {
-        anyhow::bail!("acme.http_responder_hmac must not be empty");
+    match settings.acme.challenge {
+        ChallengeKind::Http01 if settings.dns01.manual => {
+            anyhow::bail!("dns01.manual requires acme.challenge = \"dns-01\"");
+        }
+        ChallengeKind::Http01 if settings.acme.solver_command.is_none() => {
+            if settings.acme.http_responder_url.trim().is_empty() {
+                anyhow::bail!("acme.http_responder_url must not be empty");
+            }
+            if settings.acme.http_responder_hmac.trim().is_empty() {
+                anyhow::bail!("acme.http_responder_hmac must not be empty");
+            }
+        }
+        ChallengeKind::Http01 => {}
+        ChallengeKind::Dns01 => {
+            if settings.dns01.manual && settings.acme.solver_command.is_some() {
+                anyhow::bail!("dns01.manual cannot be combined with acme.solver_command");
+            }
+            if settings.acme.solver_command.is_none()
+                && !settings.dns01.manual
+                && settings
+                    .dns01
+                    .listen_addr
+                    .parse::<std::net::SocketAddr>()
+                    .is_err()
+            {
+                anyhow::bail!("dns01.listen_addr must be a socket address (host:port)");
+            }
+            for nameserver in &settings.dns01.propagation_nameservers {
+                crate::dns::parse_resolver_addr(nameserver)
+                    .context("dns01.propagation_nameservers is invalid")?;
+            }
+            if !settings.dns01.propagation_nameservers.is_empty()
+                && settings.dns01.propagation_timeout_secs == 0
+            {
+                anyhow::bail!("dns01.propagation_timeout_secs must be greater than 0");
+            }
+        }
     }
     if settings.acme.http_responder_timeout_secs == 0 {
         anyhow::bail!("acme.http_responder_timeout_secs must be greater than 0");
@@ -70,12 +131,41 @@ pub(crate) fn validate_settings(settings: &Settings) -> Result<()> {
     if settings.acme.poll_interval_secs == 0 {
         anyhow::bail!("acme.poll_interval_secs must be greater than 0");
     }
+    if settings.acme.max_parallel_challenges == 0 {
+        anyhow::bail!("acme.max_parallel_challenges must be greater than 0");
+    }
     if settings.acme.directory_fetch_base_delay_secs == 0 {
         anyhow::bail!("acme.directory_fetch_base_delay_secs must be greater than 0");
     }
     if settings.acme.directory_fetch_max_delay_secs == 0 {
         anyhow::bail!("acme.directory_fetch_max_delay_secs must be greater than 0");
     }
+    if settings.acme.order_poll_interval_secs == Some(0) {
+        anyhow::bail!("acme.order_poll_interval_secs must be greater than 0");
+    }
+    if settings.acme.order_timeout_secs == Some(0) {
+        anyhow::bail!("acme.order_timeout_secs must be greater than 0");
+    }
+    if let Some(path) = &settings.acme.account_key_path
+        && path.as_os_str().is_empty()
+    {
+        anyhow::bail!("acme.account_key_path must not be empty");
+    }
+    if settings.acme.purge_account_on_success && settings.acme.account_key_path.is_some() {
+        anyhow::bail!(
+            "--purge-account-on-success cannot be combined with acme.account_key_path: \
+             it would deactivate the persistent account every later run signs with"
+        );
+    }
+    if let Some(command) = &settings.acme.solver_command {
+        crate::acme::solver::validate_command(command)?;
+    }
+    if let Some(resolver) = settings.acme.dns_resolver.as_deref() {
+        crate::dns::parse_resolver_addr(resolver).context("acme.dns_resolver is invalid")?;
+    }
+    if let Some(url) = settings.acme.require_tos.as_deref() {
+        Url::parse(url.trim()).context("acme.require_tos must be an absolute URL")?;
+    }
     if settings.acme.directory_fetch_base_delay_secs > settings.acme.directory_fetch_max_delay_secs
     {
         anyhow::bail!(
@@ -90,18 +180,188 @@ pub(crate) fn validate_settings(settings: &Settings) -> Result<()> {
     if settings.scheduler.max_concurrent_issuances == 0 {
         anyhow::bail!("scheduler.max_concurrent_issuances must be greater than 0");
     }
-    if settings.profiles.is_empty() {
+    if let Some(listen_addr) = settings.status.listen_addr.as_deref()
+        && listen_addr.parse::<std::net::SocketAddr>().is_err()
+    {
+        anyhow::bail!("status.listen_addr must be a socket address (host:port)");
+    }
+    if let Some(health_addr) = settings.status.health_addr.as_deref()
+        && health_addr.parse::<std::net::SocketAddr>().is_err()
+    {
+        anyhow::bail!("status.health_addr must be a socket address (host:port)");
+    }
+    if let Some(endpoint) = settings.otel.endpoint.as_deref() {
+        crate::otel::traces_url(endpoint)?;
+    }
+    if let Some(signal) = settings.reload.signal.as_deref() {
+        if settings.reload.pid_file.is_none() {
+            anyhow::bail!("reload.signal requires reload.pid_file");
+        }
+        if crate::reload::signal_number(signal).is_none() {
+            anyhow::bail!("reload.signal must be a signal name such as HUP, got {signal}");
+        }
+    }
+    if let Some(container) = settings.reload.container.as_deref()
+        && (container.is_empty() || container.starts_with('-'))
+    {
+        anyhow::bail!("reload.container must be a container name or ID");
+    }
+    if settings
+        .reload
+        .container_runtime
+        .as_deref()
+        .is_some_and(|runtime| runtime.trim().is_empty())
+    {
+        anyhow::bail!("reload.container_runtime must not be empty");
+    }
+    validate_provisioners(settings)?;
+    if require_profiles && settings.profiles.is_empty() {
         anyhow::bail!("profiles must not be empty");
     }
     for profile in &settings.profiles {
         validate_profile(profile)?;
+        if settings.trust.include_root && !profile.bundle {
+            anyhow::bail!("profiles.bundle = false conflicts with trust.include_root");
+        }
+        if settings.trust.include_root && profile.format == OutputFormat::Der {
+            anyhow::bail!("profiles.format = \"der\" conflicts with trust.include_root");
+        }
+        if let Some(delivery) = &profile.key_delivery {
+            validate_key_delivery(settings, profile, delivery)?;
+        }
     }
+    validate_output_paths(settings)?;
     if let Some(openbao) = &settings.openbao {
         validate_openbao_settings(openbao)?;
     }
     Ok(())
 }
 
+/// `--key-fd` / `--key-fifo` carry a single key and exist to keep it off
+/// disk, so they need exactly one profile whose key is not written to
+/// any file.
+fn validate_key_delivery(
+    settings: &Settings,
+    profile: &DaemonProfileSettings,
+    delivery: &KeyDelivery,
+) -> Result<()> {
+    if settings.profiles.len() != 1 {
+        anyhow::bail!("{delivery} requires exactly one profile");
+    }
+    if profile.pkcs11.is_some() {
+        anyhow::bail!(
+            "{delivery} conflicts with profiles.pkcs11, which keeps the key in the token"
+        );
+    }
+    if profile.outputs.iter().flatten().any(|sink| {
+        matches!(
+            sink,
+            OutputSinkSettings::Pkcs12 { .. }
+                | OutputSinkSettings::KubernetesSecret { .. }
+                | OutputSinkSettings::Certbot { .. }
+                | OutputSinkSettings::Versioned { .. }
+        )
+    }) {
+        anyhow::bail!("{delivery} conflicts with outputs that write the key to a file");
+    }
+    delivery.check()
+}
+
+/// Rejects output files claimed by more than one profile, or twice by
+/// the same profile.
+///
+/// There are no default file names: every profile names its own
+/// `paths.*`, so two profiles pointed at the same directory only collide
+/// when they name the same file. Each write replaces the file whole, so
+/// a shared path would leave one profile's key next to another profile's
+/// certificate. Paths are compared after dropping `.` components; the
+/// filesystem is not consulted, so symlinked aliases are not detected.
+fn validate_output_paths(settings: &Settings) -> Result<()> {
+    let mut owners: HashMap<PathBuf, (String, &'static str)> = HashMap::new();
+    for profile in &settings.profiles {
+        let domain = super::profile_domain(settings, profile);
+        for (field, path) in profile_output_paths(profile) {
+            let normalized = normalize_output_path(path);
+            if let Some((owner, owner_field)) = owners.get(&normalized) {
+                anyhow::bail!(
+                    "profiles.{field} {} of {domain} is already used as \
+                     profiles.{owner_field} of {owner}; give every output its own file",
+                    path.display()
+                );
+            }
+            owners.insert(normalized, (domain.clone(), field));
+        }
+    }
+    if let Some(bundle) = &settings.trust.ca_bundle_path
+        && let Some((owner, owner_field)) = owners.get(&normalize_output_path(bundle))
+    {
+        anyhow::bail!(
+            "trust.ca_bundle_path {} is also profiles.{owner_field} of {owner}",
+            bundle.display()
+        );
+    }
+    Ok(())
+}
+
+/// Files the agent writes for `profile`. The key path is skipped for
+/// PKCS#11 profiles, whose key never leaves the token.
+fn profile_output_paths(profile: &DaemonProfileSettings) -> Vec<(&'static str, &Path)> {
+    let mut paths = vec![("paths.cert", profile.paths.cert.as_path())];
+    if profile.pkcs11.is_none() {
+        paths.push(("paths.key", profile.paths.key.as_path()));
+    }
+    if let Some(chain) = &profile.paths.chain {
+        paths.push(("paths.chain", chain.as_path()));
+    }
+    if let Some(pin) = &profile.paths.pin {
+        paths.push(("paths.pin", pin.as_path()));
+    }
+    for sink in profile.outputs.iter().flatten() {
+        match sink {
+            OutputSinkSettings::Pkcs12 { path, .. }
+            | OutputSinkSettings::KubernetesSecret { path, .. } => {
+                paths.push(("outputs.path", path.as_path()));
+            }
+            // certbot and versioned files sit in a directory named after
+            // the profile's own domain, so they cannot collide across
+            // profiles.
+            OutputSinkSettings::Files
+            | OutputSinkSettings::Stdout
+            | OutputSinkSettings::Certbot { .. }
+            | OutputSinkSettings::Versioned { .. } => {}
+        }
+    }
+    paths
+}
+
+fn normalize_output_path(path: &Path) -> PathBuf {
+    path.components()
+        .filter(|component| !matches!(component, Component::CurDir))
+        .collect()
+}
+
+/// Validates the ACME directory URL (`server` / `--ca-url`).
+///
+/// Only `https://` is accepted by default. A plaintext `http://` URL is
+/// allowed solely when `allow_insecure_http` is set by `--insecure-http`,
+/// because the account JWS, order, and issued certificate would otherwise
+/// cross the network unauthenticated. Any other scheme is rejected.
+fn validate_acme_directory_url(server: &str, allow_insecure_http: bool) -> Result<()> {
+    let parsed = Url::parse(server.trim())
+        .with_context(|| format!("server must be a valid ACME directory URL, got '{server}'"))?;
+    match parsed.scheme() {
+        "https" => Ok(()),
+        "http" if allow_insecure_http => Ok(()),
+        "http" => anyhow::bail!(
+            "server ({server}) is a plaintext http:// ACME directory URL; use https:// or \
+             pass --insecure-http to opt in explicitly for a local test CA"
+        ),
+        scheme => anyhow::bail!(
+            "server must be an https:// ACME directory URL, got scheme '{scheme}' in {server}"
+        ),
+    }
+}
+
 /// Reports whether an `openbao.url` uses the `https://` scheme.
 ///
 /// URL schemes are case-insensitive (RFC 3986 §3.1), so `HTTPS://host`
@@ -223,18 +483,83 @@ fn validate_trust_settings(trust: &TrustSettings) -> Result<()> {
     {
         anyhow::bail!("trust.ca_bundle_path must not be empty");
     }
+    if let Some(dir) = &trust.ca_dir
+        && dir.as_os_str().is_empty()
+    {
+        anyhow::bail!("trust.ca_dir must not be empty");
+    }
+    if trust.include_root && trust.ca_bundle_path.is_none() {
+        anyhow::bail!("trust.include_root requires trust.ca_bundle_path");
+    }
+    if trust
+        .tls_max_version
+        .is_some_and(|max| max < trust.tls_min_version)
+    {
+        anyhow::bail!("trust.tls_max_version must not be lower than trust.tls_min_version");
+    }
     for fingerprint in &trust.trusted_ca_sha256 {
-        validate_sha256_fingerprint(fingerprint)?;
+        validate_sha256_fingerprint("trust.trusted_ca_sha256", fingerprint)?;
+    }
+    for pin in &trust.server_spki_sha256 {
+        validate_sha256_fingerprint("trust.server_spki_sha256", pin)?;
     }
     Ok(())
 }
 
-fn validate_sha256_fingerprint(value: &str) -> Result<()> {
+fn validate_sha256_fingerprint(field: &str, value: &str) -> Result<()> {
     if value.len() != 64 {
-        anyhow::bail!("trust.trusted_ca_sha256 must be 64 hex chars");
+        anyhow::bail!("{field} must be 64 hex chars");
     }
     if !value.chars().all(|ch| ch.is_ascii_hexdigit()) {
-        anyhow::bail!("trust.trusted_ca_sha256 must be hex");
+        anyhow::bail!("{field} must be hex");
+    }
+    Ok(())
+}
+
+/// Checks provisioner names and that an EAB key tied to a provisioner is
+/// only sent to that provisioner's directory, so a mismatch fails here
+/// instead of as an opaque account-registration error.
+fn validate_provisioners(settings: &Settings) -> Result<()> {
+    if let Some(provisioner) = settings.acme.provisioner.as_deref() {
+        validate_provisioner_name("acme.provisioner", provisioner)?;
+        super::provisioner_directory_url(&settings.server, provisioner)?;
+    }
+    if let Some(eab_provisioner) = settings
+        .eab
+        .as_ref()
+        .and_then(|eab| eab.provisioner.as_deref())
+    {
+        validate_provisioner_name("eab.provisioner", eab_provisioner)?;
+        let directory_provisioner = settings
+            .acme
+            .provisioner
+            .clone()
+            .or_else(|| super::server_provisioner(&settings.server));
+        if let Some(directory_provisioner) = directory_provisioner
+            && directory_provisioner != eab_provisioner
+        {
+            anyhow::bail!(
+                "EAB does not belong to provisioner {directory_provisioner}: \
+                 eab.provisioner is {eab_provisioner}"
+            );
+        }
+    }
+    for profile in &settings.profiles {
+        if let Some(provisioner) = profile
+            .eab
+            .as_ref()
+            .and_then(|eab| eab.provisioner.as_deref())
+        {
+            validate_provisioner_name("profiles.eab.provisioner", provisioner)?;
+            super::profile_directory_url(settings, profile)?;
+        }
+    }
+    Ok(())
+}
+
+fn validate_provisioner_name(key: &str, provisioner: &str) -> Result<()> {
+    if provisioner.trim().is_empty() || provisioner.contains('/') {
+        anyhow::bail!("{key} must be a provisioner name without '/'");
     }
     Ok(())
 }
@@ -249,8 +574,10 @@ fn validate_profile(profile: &DaemonProfileSettings) -> Result<()> {
     if !profile.service_name.is_ascii() {
         anyhow::bail!("profiles.service_name must be ASCII");
     }
-    if !profile.hostname.is_ascii() {
-        anyhow::bail!("profiles.hostname must be ASCII");
+    if crate::input_validation::domain_to_ascii(&profile.hostname).is_err() {
+        anyhow::bail!(
+            "profiles.hostname must be a valid DNS name (Unicode labels must pass IDNA conversion)"
+        );
     }
     if profile.instance_id.trim().is_empty() {
         anyhow::bail!("profiles.instance_id must not be empty");
@@ -264,6 +591,22 @@ fn validate_profile(profile: &DaemonProfileSettings) -> Result<()> {
     if profile.paths.key.as_os_str().is_empty() {
         anyhow::bail!("profiles.paths.key must not be empty");
     }
+    if profile
+        .paths
+        .chain
+        .as_ref()
+        .is_some_and(|chain| chain.as_os_str().is_empty())
+    {
+        anyhow::bail!("profiles.paths.chain must not be empty");
+    }
+    if profile
+        .paths
+        .pin
+        .as_ref()
+        .is_some_and(|pin| pin.as_os_str().is_empty())
+    {
+        anyhow::bail!("profiles.paths.pin must not be empty");
+    }
     if let Some(gid) = profile.cert_group_gid {
         // gid 0 is `root`. The default agent identity already has
         // root or operator-only access; granting "the root group"
@@ -277,9 +620,27 @@ fn validate_profile(profile: &DaemonProfileSettings) -> Result<()> {
         crate::cert_group::validate_cert_writing_host_gid(gid)
             .map_err(|err| anyhow::anyhow!("profiles.cert_group_gid: {err}"))?;
     }
+    if let Some(pct) = profile.daemon.renew_before_pct
+        && !(1..=99).contains(&pct)
+    {
+        anyhow::bail!("profiles.daemon.renew_before_pct must be between 1 and 99, got {pct}");
+    }
     if let Some(retry) = &profile.retry {
         validate_retry_settings(&retry.backoff_secs, "profiles.retry.backoff_secs")?;
     }
+    if let Some(pkcs11) = &profile.pkcs11 {
+        if !pkcs11.module.is_absolute() {
+            anyhow::bail!("profiles.pkcs11.module must be an absolute path");
+        }
+        if pkcs11.label.trim().is_empty() {
+            anyhow::bail!("profiles.pkcs11.label must not be empty");
+        }
+    }
+    if let Some(outputs) = &profile.outputs {
+        validate_output_sinks(outputs, profile.pkcs11.is_some())?;
+    }
+    validate_subject(&profile.subject)?;
+    validate_hook_commands(&profile.hooks.pre_renew, "profiles.hooks.pre_renew")?;
     validate_hook_commands(
         &profile.hooks.post_renew.success,
         "profiles.hooks.post_renew.success",
@@ -291,6 +652,147 @@ fn validate_profile(profile: &DaemonProfileSettings) -> Result<()> {
     Ok(())
 }
 
+/// Checks `profiles.outputs`. The `files` sink is required because
+/// renewal and `--renew-dir` read `paths.cert` back; the PKCS#12,
+/// Kubernetes, certbot, and versioned sinks need the private key, which a
+/// PKCS#11 token keeps.
+fn validate_output_sinks(outputs: &[OutputSinkSettings], pkcs11: bool) -> Result<()> {
+    if outputs.is_empty() {
+        anyhow::bail!("profiles.outputs must configure at least one sink");
+    }
+    if !outputs.contains(&OutputSinkSettings::Files) {
+        anyhow::bail!("profiles.outputs must include a files sink; renewal reads paths.cert");
+    }
+    for sink in outputs {
+        match sink {
+            OutputSinkSettings::Files | OutputSinkSettings::Stdout => {}
+            OutputSinkSettings::Pkcs12 {
+                path,
+                password_file,
+            } => {
+                if pkcs11 {
+                    anyhow::bail!("profiles.outputs pkcs12 sink needs the key outside PKCS#11");
+                }
+                if path.as_os_str().is_empty() {
+                    anyhow::bail!("profiles.outputs pkcs12 path must not be empty");
+                }
+                if password_file
+                    .as_ref()
+                    .is_some_and(|file| file.as_os_str().is_empty())
+                {
+                    anyhow::bail!("profiles.outputs pkcs12 password_file must not be empty");
+                }
+            }
+            OutputSinkSettings::KubernetesSecret {
+                path,
+                name,
+                namespace,
+            } => {
+                if pkcs11 {
+                    anyhow::bail!(
+                        "profiles.outputs kubernetes-secret sink needs the key outside PKCS#11"
+                    );
+                }
+                if path.as_os_str().is_empty() {
+                    anyhow::bail!("profiles.outputs kubernetes-secret path must not be empty");
+                }
+                if !is_dns1123_name(name, 253, true) {
+                    anyhow::bail!(
+                        "profiles.outputs kubernetes-secret name must be a lowercase DNS \
+                         subdomain, got '{name}'"
+                    );
+                }
+                if let Some(namespace) = namespace
+                    && !is_dns1123_name(namespace, 63, false)
+                {
+                    anyhow::bail!(
+                        "profiles.outputs kubernetes-secret namespace must be a lowercase DNS \
+                         label, got '{namespace}'"
+                    );
+                }
+            }
+            OutputSinkSettings::Certbot { base } => {
+                if pkcs11 {
+                    anyhow::bail!("profiles.outputs certbot sink needs the key outside PKCS#11");
+                }
+                if base.as_os_str().is_empty() {
+                    anyhow::bail!("profiles.outputs certbot base must not be empty");
+                }
+            }
+            OutputSinkSettings::Versioned { base, .. } => {
+                if pkcs11 {
+                    anyhow::bail!("profiles.outputs versioned sink needs the key outside PKCS#11");
+                }
+                if base.as_os_str().is_empty() {
+                    anyhow::bail!("profiles.outputs versioned base must not be empty");
+                }
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Kubernetes object name rules (RFC 1123): lowercase alphanumerics and
+/// `-`, starting and ending alphanumeric; `.` separates labels in a
+/// subdomain.
+fn is_dns1123_name(value: &str, max_len: usize, allow_dots: bool) -> bool {
+    if value.is_empty() || value.len() > max_len || (!allow_dots && value.contains('.')) {
+        return false;
+    }
+    let alnum = |byte: u8| byte.is_ascii_lowercase() || byte.is_ascii_digit();
+    value.split('.').all(|label| {
+        let bytes = label.as_bytes();
+        bytes.len() <= 63
+            && bytes.first().copied().is_some_and(alnum)
+            && bytes.last().copied().is_some_and(alnum)
+            && bytes.iter().all(|byte| alnum(*byte) || *byte == b'-')
+    })
+}
+
+fn validate_subject(subject: &SubjectSettings) -> Result<()> {
+    for (key, value) in [
+        ("profiles.subject.organization", &subject.organization),
+        (
+            "profiles.subject.organizational_unit",
+            &subject.organizational_unit,
+        ),
+    ] {
+        if value
+            .as_deref()
+            .is_some_and(|value| value.trim().is_empty())
+        {
+            anyhow::bail!("{key} must not be empty");
+        }
+    }
+    if let Some(country) = subject.country.as_deref()
+        && !(country.len() == 2 && country.bytes().all(|byte| byte.is_ascii_uppercase()))
+    {
+        anyhow::bail!(
+            "profiles.subject.country must be a two-letter upper-case country code, got '{country}'"
+        );
+    }
+    for uri in &subject.uri_sans {
+        if !uri.is_ascii() || Url::parse(uri).is_err() {
+            anyhow::bail!("profiles.subject.uri_sans entry must be an absolute URI, got '{uri}'");
+        }
+    }
+    for email in &subject.email_sans {
+        if email.starts_with("mailto:") || crate::input_validation::validate_email(email).is_err() {
+            anyhow::bail!(
+                "profiles.subject.email_sans entry must be a bare email address, got '{email}'"
+            );
+        }
+    }
+    if subject
+        .expected_sans
+        .iter()
+        .any(|san| san.trim().is_empty())
+    {
+        anyhow::bail!("profiles.subject.expected_sans entry must not be empty");
+    }
+    Ok(())
+}
+
 fn validate_hook_commands(hooks: &[HookCommand], label: &str) -> Result<()> {
     for hook in hooks {
         if hook.command.trim().is_empty() {
@@ -347,6 +849,38 @@ mod tests {
         assert!(validate_cert_duration_vs_default_renew_before("").is_err());
     }
 
+    #[test]
+    fn acme_directory_url_validation_table() {
+        let cases = [
+            ("https://localhost:9000/acme/acme/directory", false, true),
+            ("HTTPS://ca.internal/directory", false, true),
+            ("https://ca.internal/directory", true, true),
+            ("http://localhost:9000/acme/acme/directory", false, false),
+            ("HTTP://ca.internal/directory", false, false),
+            ("http://localhost:9000/acme/acme/directory", true, true),
+            ("ftp://ca.internal/directory", false, false),
+            ("ftp://ca.internal/directory", true, false),
+            ("file:///etc/bootroot/directory", true, false),
+            ("localhost:9000/directory", false, false),
+            ("not a url", true, false),
+            ("", false, false),
+        ];
+        for (url, allow_insecure_http, expected_ok) in cases {
+            let result = validate_acme_directory_url(url, allow_insecure_http);
+            assert_eq!(
+                result.is_ok(),
+                expected_ok,
+                "url={url:?} allow_insecure_http={allow_insecure_http}: {result:?}"
+            );
+        }
+    }
+
+    #[test]
+    fn acme_directory_url_error_names_insecure_http_flag() {
+        let err = validate_acme_directory_url("http://ca.internal/directory", false).unwrap_err();
+        assert!(err.to_string().contains("--insecure-http"), "{err}");
+    }
+
     fn openbao_settings(url: &str, allow_plaintext_http: bool) -> OpenBaoSettings {
         OpenBaoSettings {
             url: url.to_string(),
@@ -466,4 +1000,126 @@ mod tests {
             "error should require the CA bundle: {err}"
         );
     }
+
+    #[test]
+    fn trust_include_root_requires_ca_bundle_path() {
+        let trust = TrustSettings {
+            include_root: true,
+            ..TrustSettings::default()
+        };
+        let err = validate_trust_settings(&trust).expect_err("include_root needs a bundle");
+        assert!(err.to_string().contains("trust.include_root"));
+    }
+
+    #[test]
+    fn trust_include_root_accepts_configured_bundle() {
+        let trust = TrustSettings {
+            ca_bundle_path: Some(std::path::PathBuf::from("/etc/bootroot/ca-bundle.pem")),
+            trusted_ca_sha256: vec!["a".repeat(64)],
+            include_root: true,
+            ..TrustSettings::default()
+        };
+        assert!(validate_trust_settings(&trust).is_ok());
+    }
+
+    #[test]
+    fn trust_ca_dir_does_not_require_pins() {
+        let trust = TrustSettings {
+            ca_dir: Some(std::path::PathBuf::from("/etc/ssl/certs")),
+            ..TrustSettings::default()
+        };
+        assert!(validate_trust_settings(&trust).is_ok());
+
+        let empty = TrustSettings {
+            ca_dir: Some(std::path::PathBuf::new()),
+            ..TrustSettings::default()
+        };
+        let err = validate_trust_settings(&empty).expect_err("empty ca_dir");
+        assert!(err.to_string().contains("trust.ca_dir"));
+    }
+
+    #[test]
+    fn trust_server_spki_pins_must_be_sha256_hex() {
+        let trust = TrustSettings {
+            server_spki_sha256: vec!["a".repeat(64), "B".repeat(64)],
+            ..TrustSettings::default()
+        };
+        assert!(validate_trust_settings(&trust).is_ok());
+
+        let trust = TrustSettings {
+            server_spki_sha256: vec!["z".repeat(64)],
+            ..TrustSettings::default()
+        };
+        let err = validate_trust_settings(&trust).expect_err("non-hex pin");
+        assert!(
+            err.to_string()
+                .contains("trust.server_spki_sha256 must be hex")
+        );
+    }
+
+    #[test]
+    fn trust_tls_max_version_must_not_undercut_min() {
+        use crate::config::TlsVersion;
+
+        let trust = TrustSettings {
+            tls_min_version: TlsVersion::Tls13,
+            tls_max_version: Some(TlsVersion::Tls12),
+            ..TrustSettings::default()
+        };
+        let err = validate_trust_settings(&trust).expect_err("max below min");
+        assert!(err.to_string().contains("trust.tls_max_version"));
+
+        let trust = TrustSettings {
+            tls_max_version: Some(TlsVersion::Tls12),
+            ..TrustSettings::default()
+        };
+        assert!(validate_trust_settings(&trust).is_ok());
+    }
+
+    #[test]
+    fn subject_country_must_be_two_upper_case_letters() {
+        let subject = |country: &str| SubjectSettings {
+            country: Some(country.to_string()),
+            ..SubjectSettings::default()
+        };
+        assert!(validate_subject(&subject("KR")).is_ok());
+        for bad in ["kr", "KOR", "K", ""] {
+            let err = validate_subject(&subject(bad)).expect_err(bad);
+            assert!(err.to_string().contains("profiles.subject.country"));
+        }
+
+        let blank_org = SubjectSettings {
+            organization: Some("  ".to_string()),
+            ..SubjectSettings::default()
+        };
+        let err = validate_subject(&blank_org).expect_err("blank organization");
+        assert!(err.to_string().contains("profiles.subject.organization"));
+    }
+
+    #[test]
+    fn subject_sans_must_parse() {
+        let valid = SubjectSettings {
+            uri_sans: vec!["spiffe://trusted.domain/ns/edge/sa/proxy".to_string()],
+            email_sans: vec!["ops@example.com".to_string()],
+            ..SubjectSettings::default()
+        };
+        assert!(validate_subject(&valid).is_ok());
+
+        for bad in ["edge-proxy", "spiffe://trusted.domain/ünicode"] {
+            let subject = SubjectSettings {
+                uri_sans: vec![bad.to_string()],
+                ..SubjectSettings::default()
+            };
+            let err = validate_subject(&subject).expect_err(bad);
+            assert!(err.to_string().contains("profiles.subject.uri_sans"));
+        }
+        for bad in ["ops", "mailto:ops@example.com", "ops@"] {
+            let subject = SubjectSettings {
+                email_sans: vec![bad.to_string()],
+                ..SubjectSettings::default()
+            };
+            let err = validate_subject(&subject).expect_err(bad);
+            assert!(err.to_string().contains("profiles.subject.email_sans"));
+        }
+    }
 }
@@ -2,20 +2,67 @@ use std::collections::BTreeMap;
 use std::future::Future;
 use std::path::{Path, PathBuf};
 use std::sync::{Arc, Mutex as StdMutex};
-use std::time::Duration;
+use std::time::{Duration, Instant, SystemTime};
 
-use tokio::sync::{Mutex as TokioMutex, Semaphore, watch};
+use tokio::sync::{Mutex as TokioMutex, Notify, Semaphore, watch};
 use tracing::{error, info, warn};
 
-use crate::{acme, cert_chain, config, eab, fast_poll, hooks, profile, utils};
+use crate::{
+    acme, cert_chain, cert_metadata, config, dns, eab, fast_poll, hooks, profile, reload, run_id,
+    run_result, status, systemd, utils,
+};
 
 const DEFAULT_AGENT_CONFIG_PATH: &str = "agent.toml";
+/// How often a rate-limited renewal is retried before it counts as
+/// failed.
+const RATE_LIMIT_RETRIES: u32 = 3;
+/// Pause after a rate limit whose response had no usable `Retry-After`.
+const DEFAULT_RATE_LIMIT_PAUSE: Duration = Duration::from_secs(60);
+/// Longest pause honoured from `Retry-After`, so one response cannot
+/// stall the batch for hours.
+const MAX_RATE_LIMIT_PAUSE: Duration = Duration::from_secs(15 * 60);
+/// Shortest gap between two renewals of one profile triggered by an
+/// OCSP `revoked` answer.
+const OCSP_RENEW_MIN_INTERVAL: Duration = Duration::from_secs(60 * 60);
 
 #[derive(Clone)]
 struct IssuanceRuntime {
     config_path: PathBuf,
     insecure_mode: bool,
     cli_overrides: config::CliOverrides,
+    status: Arc<status::StatusRegistry>,
+    signal_triggered: bool,
+    stop: Arc<Notify>,
+    heartbeat: systemd::Heartbeat,
+    ocsp_renewals: Arc<OcspRenewals>,
+}
+
+/// When each profile last renewed because OCSP reported its certificate
+/// revoked, so a responder that keeps answering `revoked` cannot force a
+/// reissue on every check.
+#[derive(Default)]
+pub(crate) struct OcspRenewals {
+    last: StdMutex<BTreeMap<String, Instant>>,
+}
+
+impl OcspRenewals {
+    /// Records an OCSP-triggered renewal of `profile_label` at `now` and
+    /// returns `true`, or returns `false` when the previous one was less
+    /// than [`OCSP_RENEW_MIN_INTERVAL`] ago.
+    fn try_record(&self, profile_label: &str, now: Instant) -> bool {
+        let mut last = self
+            .last
+            .lock()
+            .expect("OcspRenewals registry mutex poisoned");
+        if last
+            .get(profile_label)
+            .is_some_and(|at| now.saturating_duration_since(*at) < OCSP_RENEW_MIN_INTERVAL)
+        {
+            return false;
+        }
+        last.insert(profile_label.to_string(), now);
+        true
+    }
 }
 
 /// Per-profile single-flight registry.
@@ -61,6 +108,76 @@ impl Default for ProfileLocks {
     }
 }
 
+/// Handle shared between the agent binary and successive daemon runs.
+///
+/// A SIGHUP reload stops the running daemon through [`Self::request_stop`]
+/// instead of aborting it, so an in-flight check finishes (and releases its
+/// profile lock) before the reloaded daemon starts. The profile locks and
+/// status registry are carried over via [`Self::for_signal_restart`], so a
+/// signal-triggered check in the new run still serialises with any
+/// issuance that holds the same profile's lock. The systemd watchdog
+/// heartbeat set with [`Self::with_heartbeat`] is carried over too.
+#[derive(Clone)]
+pub struct DaemonControl {
+    stop: Arc<Notify>,
+    profile_locks: Arc<ProfileLocks>,
+    status: Arc<status::StatusRegistry>,
+    signal_triggered: bool,
+    heartbeat: systemd::Heartbeat,
+    ocsp_renewals: Arc<OcspRenewals>,
+}
+
+impl DaemonControl {
+    /// Creates the control for the first daemon run.
+    #[must_use]
+    pub fn new() -> Self {
+        Self {
+            stop: Arc::new(Notify::new()),
+            profile_locks: Arc::new(ProfileLocks::new()),
+            status: Arc::new(status::StatusRegistry::new()),
+            signal_triggered: false,
+            heartbeat: systemd::Heartbeat::default(),
+            ocsp_renewals: Arc::new(OcspRenewals::default()),
+        }
+    }
+
+    /// Gates the systemd watchdog on the profile check loops, which beat
+    /// `heartbeat` as they wait and after each check.
+    #[must_use]
+    pub fn with_heartbeat(mut self, heartbeat: systemd::Heartbeat) -> Self {
+        self.heartbeat = heartbeat;
+        self
+    }
+
+    /// Asks the running daemon to finish in-flight checks and exit.
+    pub fn request_stop(&self) {
+        self.stop.notify_one();
+    }
+
+    /// Returns the control for the run that follows a SIGHUP reload.
+    ///
+    /// The new run checks every profile immediately, logs that the check
+    /// was signal-triggered, and reuses this run's profile locks and
+    /// status registry.
+    #[must_use]
+    pub fn for_signal_restart(&self) -> Self {
+        Self {
+            stop: Arc::new(Notify::new()),
+            profile_locks: Arc::clone(&self.profile_locks),
+            status: Arc::clone(&self.status),
+            signal_triggered: true,
+            heartbeat: self.heartbeat.clone(),
+            ocsp_renewals: Arc::clone(&self.ocsp_renewals),
+        }
+    }
+}
+
+impl Default for DaemonControl {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
 /// Runs the agent daemon loop for all profiles.
 ///
 /// # Errors
@@ -72,15 +189,26 @@ pub(crate) async fn run_daemon(
     config_path: Option<PathBuf>,
     insecure_mode: bool,
     cli_overrides: config::CliOverrides,
+    control: DaemonControl,
 ) -> anyhow::Result<()> {
+    reload::warn_if_container_missing(&settings.reload).await;
+    // The CA may still be starting; the check loop keeps retrying.
+    if let Err(err) = check_acme_directories(&settings, &settings.profiles, insecure_mode).await {
+        error!("{err:#}");
+    }
     let max_concurrent = profile::max_concurrent_issuances(&settings)?;
     let semaphore = Arc::new(Semaphore::new(max_concurrent));
-    let profile_locks = Arc::new(ProfileLocks::new());
+    let profile_locks = Arc::clone(&control.profile_locks);
     let (shutdown_tx, shutdown_rx) = watch::channel(false);
     let runtime = IssuanceRuntime {
         config_path: resolve_config_path(config_path.as_deref()),
         insecure_mode,
         cli_overrides,
+        status: Arc::clone(&control.status),
+        signal_triggered: control.signal_triggered,
+        stop: Arc::clone(&control.stop),
+        heartbeat: control.heartbeat.clone(),
+        ocsp_renewals: Arc::clone(&control.ocsp_renewals),
     };
 
     // `default_eab` becomes shared, live-readable state: both the periodic
@@ -92,14 +220,33 @@ pub(crate) async fn run_daemon(
     let (eab_tx, eab_rx) = watch::channel(default_eab);
     let shared_eab = eab::SharedEab::from_receiver(eab_rx);
 
+    let stop = Arc::clone(&control.stop);
     let shutdown_handle = tokio::spawn(async move {
-        if let Err(err) = wait_for_shutdown().await {
-            error!("Shutdown signal handler error: {err}");
+        tokio::select! {
+            result = wait_for_shutdown() => {
+                if let Err(err) = result {
+                    error!("Shutdown signal handler error: {err}");
+                }
+            }
+            () = stop.notified() => {
+                info!("Daemon stop requested. Finishing in-flight checks.");
+            }
         }
         let _ = shutdown_tx.send(true);
     });
 
     let mut handles = Vec::new();
+    if let Some(listen_addr) = settings.status.listen_addr.clone() {
+        let registry = Arc::clone(&runtime.status);
+        let shutdown_rx = shutdown_rx.clone();
+        handles.push(tokio::spawn(async move {
+            let result = status::serve(&listen_addr, registry, shutdown_rx).await;
+            if let Err(err) = &result {
+                error!("Status endpoint stopped: {err}");
+            }
+            result
+        }));
+    }
     for profile in settings.profiles.clone() {
         let settings = Arc::clone(&settings);
         let semaphore = Arc::clone(&semaphore);
@@ -144,13 +291,17 @@ pub(crate) async fn run_daemon(
                 let runtime = runtime_for_renew.clone();
                 let shared_eab = shared_eab_for_renew.clone();
                 Box::pin(async move {
-                    force_renew_profile(
-                        &settings,
-                        &profile,
-                        shared_eab.current(),
-                        semaphore,
-                        &profile_locks,
-                        &runtime,
+                    let cycle_id = run_id::cycle_id(runtime.cli_overrides.run_id.as_deref());
+                    run_id::scope(
+                        cycle_id,
+                        force_renew_profile(
+                            &settings,
+                            &profile,
+                            shared_eab.current(),
+                            semaphore,
+                            &profile_locks,
+                            &runtime,
+                        ),
                     )
                     .await
                 })
@@ -190,6 +341,7 @@ async fn run_profile_daemon(
         profile_label, check_interval, renew_before, check_jitter
     );
 
+    let heartbeat = runtime.heartbeat.register();
     let mut first_tick = true;
     loop {
         if *shutdown.borrow() {
@@ -202,27 +354,55 @@ async fn run_profile_daemon(
 
         let delay = if first_tick {
             first_tick = false;
+            if runtime.signal_triggered {
+                info!(
+                    "Profile '{}' renewal check triggered by SIGHUP.",
+                    profile_label
+                );
+            }
             Duration::from_secs(0)
         } else {
             utils::jittered_delay(check_interval, check_jitter)
         };
+        runtime
+            .status
+            .record_next_check(&profile_label, SystemTime::now() + delay);
 
         tokio::select! {
             _ = shutdown.changed() => {
                 info!("Shutdown signal received. Exiting profile '{}'.", profile_label);
                 break;
             }
-            () = tokio::time::sleep(delay) => {
-                check_and_renew_profile(
-                    &settings,
-                    &profile,
-                    shared_eab.current(),
-                    Arc::clone(&semaphore),
-                    &profile_locks,
-                    renew_before,
-                    &runtime,
+            () = heartbeat.sleep(delay) => {
+                let cycle_id = run_id::cycle_id(runtime.cli_overrides.run_id.as_deref());
+                let checked = run_id::scope(
+                    cycle_id,
+                    check_and_renew_profile(
+                        &settings,
+                        &profile,
+                        shared_eab.current(),
+                        Arc::clone(&semaphore),
+                        &profile_locks,
+                        renew_before,
+                        &runtime,
+                    ),
                 )
-                .await?;
+                .await;
+                if let Err(err) = checked {
+                    // Take the whole daemon down so the process exits
+                    // instead of leaving the other profiles running.
+                    runtime.stop.notify_one();
+                    return Err(err);
+                }
+                runtime
+                    .status
+                    .refresh_cert_not_after(&profile_label, &profile.paths.cert)
+                    .await;
+                runtime
+                    .status
+                    .refresh_issuance_timings(&profile_label, &profile.paths.cert)
+                    .await;
+                heartbeat.beat();
             }
         }
     }
@@ -230,7 +410,8 @@ async fn run_profile_daemon(
     Ok(())
 }
 
-/// Runs a single issuance pass for all profiles.
+/// Runs a single issuance pass for all profiles, recording the outcome
+/// of each profile in `results` when given.
 ///
 /// # Errors
 /// Returns an error if any profile issuance fails.
@@ -239,30 +420,147 @@ pub(crate) async fn run_oneshot(
     default_eab: Option<eab::EabCredentials>,
     config_path: Option<PathBuf>,
     insecure_mode: bool,
+    results: Option<Arc<run_result::Recorder>>,
+) -> anyhow::Result<()> {
+    let (health_shutdown, health_handle) = start_oneshot_health(&settings);
+    let result =
+        run_oneshot_profiles(settings, default_eab, config_path, insecure_mode, results).await;
+    if let Some(handle) = health_handle {
+        let _ = health_shutdown.send(true);
+        let _ = handle.await;
+    }
+    result
+}
+
+/// Starts `GET /healthz` for the length of a oneshot run when
+/// `status.health_addr` is set. A listener failure is logged and never
+/// fails the run.
+fn start_oneshot_health(
+    settings: &config::Settings,
+) -> (watch::Sender<bool>, Option<tokio::task::JoinHandle<()>>) {
+    let (shutdown_tx, shutdown_rx) = watch::channel(false);
+    let handle = settings.status.health_addr.clone().map(|addr| {
+        tokio::spawn(async move {
+            if let Err(err) = status::serve_health(&addr, shutdown_rx).await {
+                error!("Health endpoint stopped: {err:#}");
+            }
+        })
+    });
+    (shutdown_tx, handle)
+}
+
+async fn run_oneshot_profiles(
+    settings: Arc<config::Settings>,
+    default_eab: Option<eab::EabCredentials>,
+    config_path: Option<PathBuf>,
+    insecure_mode: bool,
+    results: Option<Arc<run_result::Recorder>>,
 ) -> anyhow::Result<()> {
+    reload::warn_if_container_missing(&settings.reload).await;
+    let profiles = oneshot_profiles(&settings).await;
+    if profiles.is_empty() {
+        info!("Every certificate is still valid; nothing to issue.");
+        return Ok(());
+    }
+    check_acme_directories(&settings, &profiles, insecure_mode).await?;
     let max_concurrent = profile::max_concurrent_issuances(&settings)?;
     let semaphore = Arc::new(Semaphore::new(max_concurrent));
     let runtime = IssuanceRuntime {
         config_path: resolve_config_path(config_path.as_deref()),
         insecure_mode,
         cli_overrides: config::CliOverrides::default(),
+        status: Arc::new(status::StatusRegistry::new()),
+        signal_triggered: false,
+        stop: Arc::new(Notify::new()),
+        heartbeat: systemd::Heartbeat::default(),
+        ocsp_renewals: Arc::new(OcspRenewals::default()),
     };
     let mut handles = Vec::new();
 
-    for profile in settings.profiles.clone() {
+    for profile in profiles {
         let settings = Arc::clone(&settings);
         let semaphore = Arc::clone(&semaphore);
         let default_eab = default_eab.clone();
         let runtime = runtime.clone();
+        let results = results.clone();
 
-        handles.push(tokio::spawn(async move {
-            run_profile_oneshot(settings, profile, default_eab, semaphore, runtime).await
-        }));
+        handles.push(tokio::spawn(run_id::inherit(async move {
+            let Some(results) = results else {
+                return run_profile_oneshot(settings, profile, default_eab, semaphore, runtime)
+                    .await;
+            };
+            let before = run_result::Before::capture(&profile).await;
+            let result = run_profile_oneshot(
+                Arc::clone(&settings),
+                profile.clone(),
+                default_eab,
+                semaphore,
+                runtime,
+            )
+            .await;
+            results.record(run_result::describe(&settings, &profile, &before, &result).await);
+            result
+        })));
     }
 
     collect_task_results(handles, "oneshot").await
 }
 
+/// Returns the profiles a oneshot run issues for: every profile except
+/// those with `skip_if_valid` whose certificate is not due for renewal.
+/// The check reads only local files, so when nothing is due the run
+/// never contacts the CA. A certificate that cannot be checked is
+/// reissued.
+async fn oneshot_profiles(settings: &config::Settings) -> Vec<config::DaemonProfileSettings> {
+    let mut profiles = Vec::new();
+    for profile in &settings.profiles {
+        if profile.skip_if_valid {
+            let profile_label = config::profile_domain(settings, profile);
+            match should_renew(profile, &settings.trust, profile.daemon.renew_before).await {
+                Ok(false) => {
+                    info!("Profile '{profile_label}' certificate still valid; skipping issuance.");
+                    continue;
+                }
+                Ok(true) => {}
+                Err(err) => {
+                    warn!("Profile '{profile_label}' renewal check failed ({err}); reissuing.");
+                }
+            }
+        }
+        profiles.push(profile.clone());
+    }
+    profiles
+}
+
+/// Fetches the ACME directory of every profile once before any key is
+/// generated, so a wrong URL or trust setting is reported up front.
+///
+/// # Errors
+/// Returns `cannot reach ACME server at <url>: <reason>` for the first
+/// directory that cannot be fetched.
+async fn check_acme_directories(
+    settings: &config::Settings,
+    profiles: &[config::DaemonProfileSettings],
+    insecure_mode: bool,
+) -> anyhow::Result<()> {
+    let mut checked = Vec::new();
+    for profile in profiles {
+        let directory_url = config::profile_directory_url(settings, profile)?;
+        if checked.contains(&directory_url) {
+            continue;
+        }
+        acme::client::AcmeClient::check_directory(
+            &directory_url,
+            &settings.acme,
+            &settings.trust,
+            insecure_mode,
+        )
+        .await?;
+        checked.push(directory_url);
+    }
+    Ok(())
+}
+
 /// Collects results from spawned task handles, logging errors and
 /// returning the first observed failure.
 async fn collect_task_results(
@@ -301,19 +599,237 @@ async fn run_profile_oneshot(
     let profile_eab = profile::resolve_profile_eab(&profile, default_eab);
     let profile_label = config::profile_domain(&settings, &profile);
 
-    let result =
-        acme::issue_certificate(&settings, &profile, profile_eab, runtime.insecure_mode).await;
-    handle_issuance_result(&result, &settings, &profile, &profile_label).await?;
+    let result = match hooks::run_pre_renew_hooks(&settings, &profile).await {
+        Ok(()) => {
+            acme::issue_certificate(&settings, &profile, profile_eab, runtime.insecure_mode).await
+        }
+        Err(err) => Err(err),
+    };
+    handle_issuance_result(&result, &settings, &profile, &profile_label).await;
     result
 }
 
-/// Dispatches post-issuance hooks based on the issuance outcome.
+/// Renews every agent-managed certificate found under `root`.
+///
+/// Certificates are discovered through the sidecar metadata written at
+/// issuance, and each is renewed against the ACME directory recorded
+/// there. A configured profile with the same identity is used when
+/// present so its hooks and key settings apply; otherwise the profile is
+/// rebuilt from the sidecar. Certificates are checked one at a time and
+/// a summary is logged at the end.
+///
+/// `cleanup_on_failure` (`--cleanup-on-failure`) applies to profiles
+/// rebuilt from a sidecar as well as to configured ones.
+///
+/// With `renew_rate` (certificates per minute), renewals are spaced so
+/// no more than that many start per minute; certificates that are still
+/// valid are not delayed. A renewal the CA refuses with a rate limit
+/// pauses the batch for the `Retry-After` and is then retried.
+///
+/// # Errors
+/// Returns an error if `root` cannot be scanned or any managed
+/// certificate fails its check or renewal.
+pub(crate) async fn run_renew_dir(
+    settings: Arc<config::Settings>,
+    default_eab: Option<eab::EabCredentials>,
+    root: &Path,
+    renew_rate: Option<u32>,
+    cleanup_on_failure: bool,
+    insecure_mode: bool,
+) -> anyhow::Result<()> {
+    reload::warn_if_container_missing(&settings.reload).await;
+    let started = tokio::time::Instant::now();
+    let metadata_files = cert_metadata::find_metadata_files(root).await?;
+    if metadata_files.is_empty() {
+        warn!("No managed certificates found under {}.", root.display());
+    }
+
+    let mut pacer = RenewPacer::new(renew_rate);
+    let mut renewed = 0usize;
+    let mut up_to_date = 0usize;
+    let mut failed = Vec::new();
+    for metadata_path in &metadata_files {
+        match renew_managed_cert(
+            &settings,
+            default_eab.clone(),
+            metadata_path,
+            cleanup_on_failure,
+            insecure_mode,
+            &mut pacer,
+        )
+        .await
+        {
+            Ok(true) => renewed += 1,
+            Ok(false) => up_to_date += 1,
+            Err(err) => {
+                error!(
+                    "Managed certificate {} failed: {err:#}",
+                    metadata_path.display()
+                );
+                failed.push(metadata_path.clone());
+            }
+        }
+    }
+
+    info!(
+        "renew-dir summary for {}: {} managed, {renewed} renewed, {up_to_date} up to date, \
+         {} failed, {} deferred by CA rate limits, took {}s.",
+        root.display(),
+        metadata_files.len(),
+        failed.len(),
+        pacer.deferred,
+        started.elapsed().as_secs()
+    );
+    if !failed.is_empty() {
+        anyhow::bail!(
+            "{} of {} managed certificates failed to renew",
+            failed.len(),
+            metadata_files.len()
+        );
+    }
+    Ok(())
+}
+
+/// Checks one managed certificate and renews it when due. Returns
+/// whether a renewal was performed.
+async fn renew_managed_cert(
+    settings: &config::Settings,
+    default_eab: Option<eab::EabCredentials>,
+    metadata_path: &Path,
+    cleanup_on_failure: bool,
+    insecure_mode: bool,
+    pacer: &mut RenewPacer,
+) -> anyhow::Result<bool> {
+    let metadata = cert_metadata::read_metadata(metadata_path).await?;
+    let mut settings = settings.clone();
+    metadata.domain.clone_into(&mut settings.domain);
+    metadata.directory_url.clone_into(&mut settings.server);
+    // The recorded URL already points at the issuing provisioner.
+    settings.acme.provisioner = None;
+    let profile = match settings
+        .profiles
+        .iter()
+        .find(|profile| metadata.matches_profile(profile))
+    {
+        Some(profile) => profile.clone(),
+        None => metadata.to_profile(cleanup_on_failure)?,
+    };
+    let profile_label = config::profile_domain(&settings, &profile);
+
+    if !should_renew(&profile, &settings.trust, profile.daemon.renew_before).await? {
+        tracing::debug!("Managed certificate '{}' still valid.", profile_label);
+        return Ok(false);
+    }
+
+    info!(
+        "Managed certificate '{}' renewal required. Starting ACME issuance...",
+        profile_label
+    );
+    let profile_eab = profile::resolve_profile_eab(&profile, default_eab);
+    let result = match hooks::run_pre_renew_hooks(&settings, &profile).await {
+        Ok(()) => {
+            issue_paced(
+                &settings,
+                &profile,
+                profile_eab,
+                insecure_mode,
+                &profile_label,
+                pacer,
+            )
+            .await
+        }
+        Err(err) => Err(err),
+    };
+    handle_issuance_result(&result, &settings, &profile, &profile_label).await;
+    result.map(|()| true)
+}
+
+/// Issues under `pacer`: waits for the next renewal slot, and after a CA
+/// rate limit waits out the pause and tries again, up to
+/// [`RATE_LIMIT_RETRIES`] times.
+async fn issue_paced(
+    settings: &config::Settings,
+    profile: &config::DaemonProfileSettings,
+    profile_eab: Option<eab::EabCredentials>,
+    insecure_mode: bool,
+    profile_label: &str,
+    pacer: &mut RenewPacer,
+) -> anyhow::Result<()> {
+    let mut pauses = 0;
+    loop {
+        pacer.wait_for_slot().await;
+        let result =
+            acme::issue_certificate(settings, profile, profile_eab.clone(), insecure_mode).await;
+        let Err(err) = &result else {
+            return result;
+        };
+        let Some(limited) = acme::client::rate_limited(err) else {
+            return result;
+        };
+        if pauses == RATE_LIMIT_RETRIES {
+            return result;
+        }
+        if pauses == 0 {
+            pacer.deferred += 1;
+        }
+        pauses += 1;
+        let pause = RenewPacer::rate_limit_pause(limited.retry_after);
+        warn!(
+            "CA rate limit hit renewing '{profile_label}'; pausing the batch for {}s \
+             (retry {pauses} of {RATE_LIMIT_RETRIES}).",
+            pause.as_secs()
+        );
+        tokio::time::sleep(pause).await;
+    }
+}
+
+/// Spaces `--renew-dir` renewals at `--renew-rate` and counts those
+/// deferred by CA rate limits.
+struct RenewPacer {
+    interval: Option<Duration>,
+    next_slot: Option<tokio::time::Instant>,
+    deferred: usize,
+}
+
+impl RenewPacer {
+    fn new(per_minute: Option<u32>) -> Self {
+        Self {
+            interval: per_minute
+                .filter(|rate| *rate > 0)
+                .map(|rate| Duration::from_secs(60) / rate),
+            next_slot: None,
+            deferred: 0,
+        }
+    }
+
+    /// Sleeps until the next renewal may start and reserves that slot.
+    async fn wait_for_slot(&mut self) {
+        let Some(interval) = self.interval else {
+            return;
+        };
+        if let Some(next_slot) = self.next_slot {
+            tokio::time::sleep_until(next_slot).await;
+        }
+        self.next_slot = Some(tokio::time::Instant::now() + interval);
+    }
+
+    fn rate_limit_pause(retry_after: Option<Duration>) -> Duration {
+        retry_after
+            .unwrap_or(DEFAULT_RATE_LIMIT_PAUSE)
+            .min(MAX_RATE_LIMIT_PAUSE)
+    }
+}
+
+/// Dispatches post-issuance hooks based on the issuance outcome, and
+/// signals the `[reload]` process after a successful issuance. A failure
+/// is escalated by the time left on the current certificate; its
+/// severity is returned.
 async fn handle_issuance_result(
     result: &anyhow::Result<()>,
     settings: &config::Settings,
     profile: &config::DaemonProfileSettings,
     profile_label: &str,
-) -> anyhow::Result<()> {
+) -> Option<hooks::FailureSeverity> {
     match result {
         Ok(()) => {
             if let Err(err) =
@@ -325,12 +841,21 @@ async fn handle_issuance_result(
                     profile_label
                 );
             }
+            reload::reload_after_renewal(&settings.reload).await;
+            None
         }
         Err(err) => {
+            let not_after = read_cert_not_after(&profile.paths.cert).await;
+            let severity = failure_severity(
+                not_after,
+                time::OffsetDateTime::now_utc(),
+                profile.daemon.escalate_before,
+            );
+            log_escalation(profile_label, severity, not_after);
             if let Err(hook_err) = hooks::run_post_renew_hooks(
                 settings,
                 profile,
-                hooks::HookStatus::Failure,
+                hooks::HookStatus::Failure(severity),
                 Some(err.to_string()),
             )
             .await
@@ -340,9 +865,58 @@ async fn handle_issuance_result(
                     profile_label
                 );
             }
+            Some(severity)
         }
     }
-    Ok(())
+}
+
+/// Classifies a renewal failure by the `NotAfter` of the certificate
+/// still on disk. Without a readable certificate the service has nothing
+/// to fall back on, so the failure is critical.
+fn failure_severity(
+    not_after: Option<time::OffsetDateTime>,
+    now: time::OffsetDateTime,
+    escalate_before: Duration,
+) -> hooks::FailureSeverity {
+    let Some(not_after) = not_after else {
+        return hooks::FailureSeverity::Critical;
+    };
+    if not_after <= now {
+        return hooks::FailureSeverity::Expired;
+    }
+    let escalate_before = time::Duration::try_from(escalate_before).unwrap_or(time::Duration::MAX);
+    if not_after - now <= escalate_before {
+        hooks::FailureSeverity::Critical
+    } else {
+        hooks::FailureSeverity::Warning
+    }
+}
+
+fn log_escalation(
+    profile_label: &str,
+    severity: hooks::FailureSeverity,
+    not_after: Option<time::OffsetDateTime>,
+) {
+    let not_after = not_after.map_or_else(|| "unknown".to_string(), |value| value.to_string());
+    match severity {
+        hooks::FailureSeverity::Warning => warn!(
+            "Profile '{profile_label}' renewal is failing; current certificate is valid until {not_after}."
+        ),
+        hooks::FailureSeverity::Critical => error!(
+            "Profile '{profile_label}' renewal is failing and the certificate expires soon \
+             (NotAfter {not_after})."
+        ),
+        hooks::FailureSeverity::Expired => error!(
+            "Profile '{profile_label}' certificate expired at {not_after} and renewal is still failing."
+        ),
+    }
+}
+
+/// Reads the `NotAfter` of the certificate at `cert_path`, or `None`
+/// when it is missing or unparsable.
+async fn read_cert_not_after(cert_path: &Path) -> Option<time::OffsetDateTime> {
+    let bytes = tokio::fs::read(cert_path).await.ok()?;
+    parse_cert_not_after(&cert_chain::cert_file_pem(bytes)).ok()
 }
 
 async fn issue_with_retry(
@@ -351,6 +925,8 @@ async fn issue_with_retry(
     eab: Option<eab::EabCredentials>,
     runtime: &IssuanceRuntime,
 ) -> anyhow::Result<()> {
+    // Pre-renew hooks run once per issuance, not once per retry attempt.
+    hooks::run_pre_renew_hooks(settings, profile).await?;
     let backoff = select_retry_backoff(settings, profile);
     let profile_domain = config::profile_domain(settings, profile);
     let config_path_owned = runtime.config_path.clone();
@@ -458,7 +1034,7 @@ where
         &mut issue_fn,
         &mut sleep_fn,
         |attempt, err| {
-            error!("Certificate issuance failed (attempt {}): {err}", attempt);
+            warn!("Certificate issuance failed (attempt {}): {err}", attempt);
         },
         delays,
     )
@@ -497,7 +1073,7 @@ pub(crate) async fn should_renew(
     renew_before: Duration,
 ) -> anyhow::Result<bool> {
     let cert_bytes = match tokio::fs::read(&profile.paths.cert).await {
-        Ok(bytes) => bytes,
+        Ok(bytes) => cert_chain::cert_file_pem(bytes),
         Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
             info!("Certificate file not found. Issuing a new certificate.");
             return Ok(true);
@@ -510,14 +1086,19 @@ pub(crate) async fn should_renew(
         }
     };
 
-    let not_after = parse_cert_not_after(&cert_bytes)?;
+    let (not_before, not_after) = parse_cert_validity(&cert_bytes)?;
 
     let renew_before = time::Duration::try_from(renew_before)
         .map_err(|_| anyhow::anyhow!("renew_before duration is too large"))?;
     let now = time::OffsetDateTime::now_utc();
-    let renew_at = now + renew_before;
 
-    if not_after <= renew_at {
+    if renewal_due(
+        not_before,
+        not_after,
+        now,
+        renew_before,
+        profile.daemon.renew_before_pct,
+    ) {
         return Ok(true);
     }
 
@@ -568,12 +1149,52 @@ pub(crate) async fn should_renew(
 /// # Errors
 /// Returns an error if the certificate cannot be parsed.
 pub(crate) fn parse_cert_not_after(cert_bytes: &[u8]) -> anyhow::Result<time::OffsetDateTime> {
+    parse_cert_validity(cert_bytes).map(|(_, not_after)| not_after)
+}
+
+/// Returns the `NotBefore` and `NotAfter` of the first certificate in
+/// `cert_bytes`.
+fn parse_cert_validity(
+    cert_bytes: &[u8],
+) -> anyhow::Result<(time::OffsetDateTime, time::OffsetDateTime)> {
     let pem = x509_parser::pem::parse_x509_pem(cert_bytes)
         .map_err(|e| anyhow::anyhow!("Failed to parse PEM certificate: {e}"))?
         .1;
     let (_, cert) = x509_parser::parse_x509_certificate(&pem.contents)
         .map_err(|e| anyhow::anyhow!("Failed to parse X509 certificate: {e}"))?;
-    Ok(cert.validity().not_after.to_datetime())
+    let validity = cert.validity();
+    Ok((
+        validity.not_before.to_datetime(),
+        validity.not_after.to_datetime(),
+    ))
+}
+
+/// Returns whether a certificate valid from `not_before` to `not_after`
+/// is due for renewal at `now`: once it is within `renew_before` of
+/// `NotAfter`, or, with `renew_before_pct`, once at least that
+/// percentage of its validity period has elapsed.
+///
+/// A certificate whose `NotAfter` is not after its `NotBefore` has no
+/// usable lifetime and is always due when a percentage is set.
+fn renewal_due(
+    not_before: time::OffsetDateTime,
+    not_after: time::OffsetDateTime,
+    now: time::OffsetDateTime,
+    renew_before: time::Duration,
+    renew_before_pct: Option<u8>,
+) -> bool {
+    if not_after <= now + renew_before {
+        return true;
+    }
+    let Some(pct) = renew_before_pct else {
+        return false;
+    };
+    let lifetime = i128::from((not_after - not_before).whole_seconds());
+    if lifetime <= 0 {
+        return true;
+    }
+    let elapsed = i128::from((now - not_before).whole_seconds());
+    elapsed * 100 >= lifetime * i128::from(pct)
 }
 
 /// Renews a profile unconditionally, bypassing the `should_renew` expiry
@@ -609,7 +1230,8 @@ async fn force_renew_profile(
             profile_label
         );
     }
-    handle_issuance_result(&result, settings, profile, &profile_label).await?;
+    record_issuance_outcome(&runtime.status, &profile_label, &result);
+    handle_issuance_result(&result, settings, profile, &profile_label).await;
     result
 }
 
@@ -637,14 +1259,38 @@ async fn check_and_renew_profile(
         Ok(val) => val,
         Err(err) => {
             error!("Profile '{}' renewal check failed: {err}", profile_label);
+            runtime.status.record_failure(
+                &profile_label,
+                &format!("renewal check failed: {err}"),
+                SystemTime::now(),
+            );
             return Ok(());
         }
     };
+    let needs_renewal = needs_renewal
+        || (settings.acme.use_ari
+            && ari_window_open(settings, profile, &profile_label, runtime.insecure_mode).await)
+        || (profile.daemon.renew_on_revoked
+            && ocsp_revoked(
+                settings,
+                profile,
+                &profile_label,
+                runtime.insecure_mode,
+                &runtime.ocsp_renewals,
+            )
+            .await);
 
     if !needs_renewal {
         tracing::debug!("Profile '{}' certificate still valid.", profile_label);
         return Ok(());
     }
+    // Only renewals are gated: a first issuance has nothing to keep.
+    if profile.daemon.verify_dns_before_renew
+        && profile.paths.cert.exists()
+        && !dns_points_here(settings, &profile_label).await
+    {
+        return Ok(());
+    }
 
     info!(
         "Profile '{}' renewal required. Starting ACME issuance...",
@@ -654,15 +1300,186 @@ async fn check_and_renew_profile(
     let profile_eab = profile::resolve_profile_eab(profile, default_eab);
     let result = issue_with_retry(settings, profile, profile_eab, runtime).await;
     if let Err(err) = &result {
-        error!(
+        warn!(
             "Profile '{}' renewal failed after retries: {err}",
             profile_label
         );
     }
-    handle_issuance_result(&result, settings, profile, &profile_label).await?;
+    record_issuance_outcome(&runtime.status, &profile_label, &result);
+    let severity = handle_issuance_result(&result, settings, profile, &profile_label).await;
+    if severity == Some(hooks::FailureSeverity::Expired) && profile.daemon.exit_on_expired {
+        anyhow::bail!(
+            "Profile '{profile_label}' certificate has expired and renewal keeps failing; \
+             exiting because exit_on_expired is set"
+        );
+    }
     Ok(())
 }
 
+/// Checks that the profile's domain still resolves to an address bound
+/// on this host, for `verify_dns_before_renew`.
+///
+/// A domain that moved elsewhere would fail validation anyway, so the
+/// renewal is skipped with a warning instead of being attempted; a
+/// lookup failure is treated the same way.
+async fn dns_points_here(settings: &config::Settings, profile_label: &str) -> bool {
+    let resolved =
+        match dns::resolve_host(profile_label, settings.acme.dns_resolver.as_deref()).await {
+            Ok(addrs) => addrs,
+            Err(err) => {
+                warn!("Profile '{profile_label}' renewal skipped: DNS lookup failed: {err:#}");
+                return false;
+            }
+        };
+    let local = match dns::local_addresses() {
+        Ok(addrs) => addrs,
+        Err(err) => {
+            warn!("Profile '{profile_label}' renewal skipped: cannot list local addresses: {err}");
+            return false;
+        }
+    };
+    if resolved.iter().any(|addr| local.contains(addr)) {
+        return true;
+    }
+    warn!(
+        "Profile '{profile_label}' renewal skipped: DNS resolves to {resolved:?}, none of \
+         which is bound on this host"
+    );
+    false
+}
+
+/// Records an issuance outcome in the daemon status registry.
+fn record_issuance_outcome(
+    registry: &status::StatusRegistry,
+    profile_label: &str,
+    result: &anyhow::Result<()>,
+) {
+    match result {
+        Ok(()) => registry.record_success(profile_label, SystemTime::now()),
+        Err(err) => registry.record_failure(profile_label, &err.to_string(), SystemTime::now()),
+    }
+}
+
+/// Asks the CA whether its ARI suggested renewal window has opened for
+/// the profile's current certificate.
+///
+/// Any failure (missing cert, CA without ARI, request error) is logged
+/// and reported as `false`, leaving the `renew_before` threshold in
+/// `should_renew` as the deciding check.
+async fn ari_window_open(
+    settings: &config::Settings,
+    profile: &config::DaemonProfileSettings,
+    profile_label: &str,
+    insecure_mode: bool,
+) -> bool {
+    let cert_bytes = match tokio::fs::read(&profile.paths.cert).await {
+        Ok(bytes) => cert_chain::cert_file_pem(bytes),
+        Err(err) => {
+            warn!("Profile '{profile_label}' ARI check skipped: cannot read certificate: {err}");
+            return false;
+        }
+    };
+    let directory_url = match config::profile_directory_url(settings, profile) {
+        Ok(url) => url,
+        Err(err) => {
+            warn!("Profile '{profile_label}' ARI check skipped: {err:#}");
+            return false;
+        }
+    };
+    let now = time::OffsetDateTime::now_utc();
+    match acme::ari::renewal_window_open(settings, &directory_url, &cert_bytes, insecure_mode, now)
+        .await
+    {
+        Ok(Some(open)) => {
+            if open {
+                info!("Profile '{profile_label}' entered the CA-suggested ARI renewal window.");
+            }
+            open
+        }
+        Ok(None) => {
+            tracing::debug!(
+                "Profile '{profile_label}' CA does not advertise ARI; using renew_before only."
+            );
+            false
+        }
+        Err(err) => {
+            warn!("Profile '{profile_label}' ARI check failed ({err}); using renew_before only.");
+            false
+        }
+    }
+}
+
+/// Asks the OCSP responder named in the profile's current certificate
+/// whether it was revoked.
+///
+/// The issuer is looked up in the certificate file, the chain file, and
+/// the CA bundle. Any failure (missing cert, no OCSP URL, request error,
+/// bad signature) is logged and reported as `false`, leaving expiry as
+/// the deciding check. A `revoked` answer within
+/// [`OCSP_RENEW_MIN_INTERVAL`] of the last one that triggered a renewal
+/// is logged and reported as `false` too.
+async fn ocsp_revoked(
+    settings: &config::Settings,
+    profile: &config::DaemonProfileSettings,
+    profile_label: &str,
+    insecure_mode: bool,
+    renewals: &OcspRenewals,
+) -> bool {
+    let cert_bytes = match tokio::fs::read(&profile.paths.cert).await {
+        Ok(bytes) => cert_chain::cert_file_pem(bytes),
+        Err(err) => {
+            warn!("Profile '{profile_label}' OCSP check skipped: cannot read certificate: {err}");
+            return false;
+        }
+    };
+    let mut issuer_pem = cert_bytes.clone();
+    for path in [
+        profile.paths.chain.as_ref(),
+        settings.trust.ca_bundle_path.as_ref(),
+    ]
+    .into_iter()
+    .flatten()
+    {
+        if let Ok(bytes) = tokio::fs::read(path).await {
+            issuer_pem.extend(bytes);
+        }
+    }
+    match acme::ocsp::check_status(settings, &cert_bytes, &issuer_pem, insecure_mode).await {
+        Ok(Some(acme::ocsp::OcspStatus::Revoked { reason })) => {
+            let reason = reason.map_or_else(|| "not given".to_string(), |r| r.to_string());
+            if !renewals.try_record(profile_label, Instant::now()) {
+                warn!(
+                    "Profile '{profile_label}' certificate is reported revoked (reason: {reason}) \
+                     within {} of the last OCSP-triggered renewal; not renewing again yet.",
+                    humantime::format_duration(OCSP_RENEW_MIN_INTERVAL)
+                );
+                return false;
+            }
+            warn!(
+                "Profile '{profile_label}' certificate was revoked (reason: {reason}); renewing."
+            );
+            true
+        }
+        Ok(Some(acme::ocsp::OcspStatus::Good)) => false,
+        Ok(Some(acme::ocsp::OcspStatus::Unknown)) => {
+            tracing::debug!(
+                "Profile '{profile_label}' OCSP responder does not know the certificate."
+            );
+            false
+        }
+        Ok(None) => {
+            tracing::debug!(
+                "Profile '{profile_label}' certificate names no OCSP responder; skipping revocation check."
+            );
+            false
+        }
+        Err(err) => {
+            warn!("Profile '{profile_label}' OCSP check failed ({err:#}); relying on expiry only.");
+            false
+        }
+    }
+}
+
 fn resolve_config_path(config_path: Option<&Path>) -> PathBuf {
     config_path.map_or_else(
         || PathBuf::from(DEFAULT_AGENT_CONFIG_PATH),
@@ -722,22 +1539,27 @@ mod tests {
             paths: Paths {
                 cert: cert_path,
                 key: PathBuf::from("unused.key"),
+                chain: None,
+                pin: None,
             },
             daemon: DaemonRuntimeSettings {
                 check_interval: Duration::from_hours(1),
                 renew_before: Duration::from_hours(16),
+                renew_before_pct: None,
                 check_jitter: Duration::from_secs(0),
+                escalate_before: Duration::from_hours(4),
+                exit_on_expired: false,
+                renew_on_revoked: false,
+                verify_dns_before_renew: false,
             },
-            retry: None,
-            hooks: config::HookSettings::default(),
-            eab: None,
-            cert_group_gid: None,
+            ..config::DaemonProfileSettings::default()
         }
     }
 
     fn build_settings(backoff: Vec<u64>) -> config::Settings {
         config::Settings {
             email: "test@example.com".to_string(),
+            contacts: Vec::new(),
             server: "https://example.com/acme/directory".to_string(),
             domain: "trusted.domain".to_string(),
             eab: None,
@@ -747,10 +1569,27 @@ mod tests {
                 directory_fetch_max_delay_secs: 10,
                 poll_attempts: 15,
                 poll_interval_secs: 2,
+                order_poll_interval_secs: None,
+                order_timeout_secs: None,
+                use_ari: false,
+                dns_resolver: None,
+                challenge: crate::config::ChallengeKind::Http01,
+                provisioner: None,
+                allow_insecure_http: false,
+                url_rewrites: Vec::new(),
+                purge_account_on_success: false,
+                trace_http: crate::config::HttpTrace::Off,
+                phase_timing: false,
+                check_sct: false,
+                require_eab: false,
+                require_tos: None,
+                account_key_path: None,
+                solver_command: None,
                 http_responder_url: "http://localhost:8080".to_string(),
                 http_responder_hmac: "dev-hmac".to_string(),
                 http_responder_timeout_secs: 5,
                 http_responder_token_ttl_secs: 300,
+                max_parallel_challenges: 1,
             },
             retry: RetrySettings {
                 backoff_secs: backoff,
@@ -761,6 +1600,10 @@ mod tests {
             },
             profiles: Vec::new(),
             openbao: None,
+            status: crate::config::StatusSettings::default(),
+            dns01: crate::config::Dns01Settings::default(),
+            otel: crate::config::OtelSettings::default(),
+            reload: crate::config::ReloadSettings::default(),
         }
     }
 
@@ -908,6 +1751,310 @@ mod tests {
         assert!(delay <= max);
     }
 
+    #[test]
+    fn test_daemon_control_signal_restart_shares_locks_and_status() {
+        let control = DaemonControl::new();
+        control
+            .status
+            .record_next_check(TEST_DOMAIN, SystemTime::now());
+
+        let restarted = control.for_signal_restart();
+
+        assert!(!control.signal_triggered);
+        assert!(restarted.signal_triggered);
+        assert!(Arc::ptr_eq(
+            &control.profile_locks,
+            &restarted.profile_locks
+        ));
+        assert!(Arc::ptr_eq(&control.status, &restarted.status));
+        assert!(!Arc::ptr_eq(&control.stop, &restarted.stop));
+        assert!(restarted.status.report().profiles.contains_key(TEST_DOMAIN));
+    }
+
+    #[tokio::test]
+    async fn test_daemon_control_stop_request_is_not_lost() {
+        let control = DaemonControl::new();
+        control.request_stop();
+
+        tokio::time::timeout(Duration::from_secs(1), control.stop.notified())
+            .await
+            .expect("stop request issued before waiting must still be observed");
+    }
+
+    #[tokio::test]
+    async fn test_signal_restart_serialises_with_in_flight_check() {
+        let control = DaemonControl::new();
+        let held = control.profile_locks.for_profile(TEST_DOMAIN);
+        let guard = held.lock().await;
+
+        let restarted = control.for_signal_restart();
+        let lock = restarted.profile_locks.for_profile(TEST_DOMAIN);
+        assert!(lock.try_lock().is_err());
+
+        drop(guard);
+        assert!(lock.try_lock().is_ok());
+    }
+
+    #[test]
+    fn test_failure_severity_escalates_toward_expiry() {
+        let now = time::OffsetDateTime::now_utc();
+        let escalate_before = Duration::from_hours(4);
+
+        assert_eq!(
+            failure_severity(Some(now + time::Duration::hours(12)), now, escalate_before),
+            hooks::FailureSeverity::Warning
+        );
+        assert_eq!(
+            failure_severity(Some(now + time::Duration::hours(2)), now, escalate_before),
+            hooks::FailureSeverity::Critical
+        );
+        assert_eq!(
+            failure_severity(Some(now - time::Duration::minutes(1)), now, escalate_before),
+            hooks::FailureSeverity::Expired
+        );
+        assert_eq!(
+            failure_severity(None, now, escalate_before),
+            hooks::FailureSeverity::Critical
+        );
+    }
+
+    #[tokio::test]
+    async fn test_check_and_renew_exits_on_expired_certificate() {
+        let dir = tempfile::tempdir().unwrap();
+        let cert_path = dir.path().join("cert.pem");
+        write_cert(
+            &cert_path,
+            time::OffsetDateTime::now_utc() - time::Duration::hours(1),
+        );
+        let mut profile = build_profile(cert_path);
+        profile.daemon.exit_on_expired = true;
+        let mut settings = build_settings(Vec::new());
+        settings.server = "http://127.0.0.1:9/acme/acme/directory".to_string();
+        settings.acme.directory_fetch_attempts = 1;
+        settings.profiles = vec![profile.clone()];
+        let runtime = IssuanceRuntime {
+            config_path: dir.path().join("missing.toml"),
+            insecure_mode: false,
+            cli_overrides: config::CliOverrides::default(),
+            status: Arc::new(status::StatusRegistry::new()),
+            signal_triggered: false,
+            stop: Arc::new(Notify::new()),
+            heartbeat: systemd::Heartbeat::default(),
+            ocsp_renewals: Arc::new(OcspRenewals::default()),
+        };
+
+        let err = check_and_renew_profile(
+            &settings,
+            &profile,
+            None,
+            Arc::new(Semaphore::new(1)),
+            &ProfileLocks::new(),
+            Duration::from_hours(16),
+            &runtime,
+        )
+        .await
+        .unwrap_err();
+
+        assert!(err.to_string().contains("exit_on_expired"));
+    }
+
+    #[tokio::test]
+    async fn test_run_oneshot_fails_fast_when_directory_unreachable() {
+        let server = wiremock::MockServer::start().await;
+        wiremock::Mock::given(wiremock::matchers::method("GET"))
+            .respond_with(wiremock::ResponseTemplate::new(503))
+            .mount(&server)
+            .await;
+        let dir = tempfile::tempdir().unwrap();
+        let mut settings = build_settings(Vec::new());
+        settings.server = format!("{}/acme/acme/directory", server.uri());
+        settings.acme.directory_fetch_attempts = 1;
+        settings.profiles = vec![build_profile(dir.path().join("cert.pem"))];
+
+        let err = run_oneshot(Arc::new(settings), None, None, false, None)
+            .await
+            .unwrap_err();
+
+        assert!(
+            format!("{err:#}").starts_with("cannot reach ACME server at "),
+            "unexpected error: {err:#}"
+        );
+        assert!(!dir.path().join("cert.pem").exists());
+    }
+
+    #[tokio::test]
+    async fn test_run_oneshot_skip_if_valid_never_contacts_the_ca() {
+        let server = wiremock::MockServer::start().await;
+        wiremock::Mock::given(wiremock::matchers::any())
+            .respond_with(wiremock::ResponseTemplate::new(503))
+            .mount(&server)
+            .await;
+        let dir = tempfile::tempdir().unwrap();
+        let cert_path = dir.path().join("cert.pem");
+        write_cert(
+            &cert_path,
+            time::OffsetDateTime::now_utc() + time::Duration::days(30),
+        );
+        let mut settings = build_settings(Vec::new());
+        settings.server = format!("{}/acme/acme/directory", server.uri());
+        settings.acme.directory_fetch_attempts = 1;
+        let mut profile = build_profile(cert_path.clone());
+        profile.skip_if_valid = true;
+        settings.profiles = vec![profile];
+        let before = fs::read(&cert_path).unwrap();
+
+        run_oneshot(Arc::new(settings.clone()), None, None, false, None)
+            .await
+            .unwrap();
+        assert_eq!(fs::read(&cert_path).unwrap(), before);
+        assert!(server.received_requests().await.unwrap().is_empty());
+
+        // Once the certificate is due the guard no longer applies.
+        write_cert(
+            &cert_path,
+            time::OffsetDateTime::now_utc() + time::Duration::hours(1),
+        );
+        let err = run_oneshot(Arc::new(settings), None, None, false, None)
+            .await
+            .unwrap_err();
+        assert!(format!("{err:#}").starts_with("cannot reach ACME server at "));
+    }
+
+    #[tokio::test]
+    async fn test_run_oneshot_records_unreached_profiles_as_skipped() {
+        let server = wiremock::MockServer::start().await;
+        wiremock::Mock::given(wiremock::matchers::method("GET"))
+            .respond_with(wiremock::ResponseTemplate::new(503))
+            .mount(&server)
+            .await;
+        let dir = tempfile::tempdir().unwrap();
+        let mut settings = build_settings(Vec::new());
+        settings.server = format!("{}/acme/acme/directory", server.uri());
+        settings.acme.directory_fetch_attempts = 1;
+        settings.profiles = vec![build_profile(dir.path().join("cert.pem"))];
+        let settings = Arc::new(settings);
+        let recorder = Arc::new(run_result::Recorder::new());
+
+        let outcome = run_oneshot(
+            Arc::clone(&settings),
+            None,
+            None,
+            false,
+            Some(Arc::clone(&recorder)),
+        )
+        .await;
+        let result = recorder.finish(&settings, &outcome);
+
+        assert!(
+            result
+                .error
+                .as_deref()
+                .is_some_and(|err| err.starts_with("cannot reach ACME server at "))
+        );
+        let [profile] = result.profiles.as_slice() else {
+            panic!("expected one profile, got {:?}", result.profiles);
+        };
+        assert_eq!(profile.action, run_result::Action::Skipped);
+        assert_eq!(profile.domains, vec![profile.profile.clone()]);
+        assert!(profile.serial.is_none() && profile.paths.is_empty());
+        let json = serde_json::to_value(&result).unwrap();
+        assert_eq!(json["profiles"][0]["action"], "skipped");
+    }
+
+    #[test]
+    fn test_record_issuance_outcome_tracks_success_and_error() {
+        let registry = status::StatusRegistry::new();
+
+        record_issuance_outcome(&registry, TEST_DOMAIN, &Ok(()));
+        record_issuance_outcome(
+            &registry,
+            TEST_DOMAIN,
+            &Err(anyhow::anyhow!("finalize rejected")),
+        );
+
+        let report = registry.report();
+        let entry = report.profiles.get(TEST_DOMAIN).unwrap();
+        assert!(entry.last_success_at.is_some());
+        assert_eq!(entry.last_error.as_deref(), Some("finalize rejected"));
+        assert!(entry.last_error_at.is_some());
+    }
+
+    #[tokio::test]
+    async fn test_ari_window_open_falls_back_when_cert_missing() {
+        let dir = tempfile::tempdir().unwrap();
+        let profile = build_profile(dir.path().join("missing.pem"));
+        let mut settings = build_settings(vec![1]);
+        settings.acme.use_ari = true;
+
+        let open = ari_window_open(&settings, &profile, "edge-proxy", false).await;
+
+        assert!(!open);
+    }
+
+    #[tokio::test]
+    async fn test_ari_window_open_falls_back_when_cert_lacks_aki() {
+        let dir = tempfile::tempdir().unwrap();
+        let cert_path = dir.path().join("cert.pem");
+        write_cert(
+            &cert_path,
+            time::OffsetDateTime::now_utc() + time::Duration::days(30),
+        );
+        let profile = build_profile(cert_path);
+        let mut settings = build_settings(vec![1]);
+        settings.acme.use_ari = true;
+
+        let open = ari_window_open(&settings, &profile, "edge-proxy", false).await;
+
+        assert!(!open);
+    }
+
+    #[test]
+    fn test_ocsp_renewals_limit_each_profile_to_one_per_interval() {
+        let renewals = OcspRenewals::default();
+        let start = Instant::now();
+
+        assert!(renewals.try_record("edge-proxy", start));
+        assert!(!renewals.try_record("edge-proxy", start + Duration::from_secs(60)));
+        assert!(renewals.try_record("api", start + Duration::from_secs(60)));
+        assert!(renewals.try_record("edge-proxy", start + OCSP_RENEW_MIN_INTERVAL));
+    }
+
+    #[tokio::test]
+    async fn test_ocsp_revoked_false_without_responder() {
+        let dir = tempfile::tempdir().unwrap();
+        let cert_path = dir.path().join("cert.pem");
+        write_cert(
+            &cert_path,
+            time::OffsetDateTime::now_utc() + time::Duration::days(30),
+        );
+        let mut profile = build_profile(cert_path);
+        profile.daemon.renew_on_revoked = true;
+        let settings = build_settings(vec![1]);
+
+        let renewals = OcspRenewals::default();
+
+        assert!(!ocsp_revoked(&settings, &profile, "edge-proxy", false, &renewals).await);
+        assert!(
+            !ocsp_revoked(
+                &settings,
+                &build_profile(dir.path().join("missing.pem")),
+                "edge-proxy",
+                false,
+                &renewals
+            )
+            .await
+        );
+    }
+
+    #[tokio::test]
+    async fn test_dns_points_here_matches_local_addresses() {
+        let settings = build_settings(vec![1]);
+
+        assert!(dns_points_here(&settings, "localhost").await);
+        assert!(!dns_points_here(&settings, "192.0.2.1").await);
+        assert!(!dns_points_here(&settings, "missing.invalid").await);
+    }
+
     #[tokio::test]
     async fn test_should_renew_when_missing_cert() {
         let dir = tempfile::tempdir().unwrap();
@@ -945,6 +2092,84 @@ mod tests {
         assert!(!renew);
     }
 
+    #[tokio::test]
+    async fn test_run_renew_dir_leaves_valid_managed_cert() {
+        let dir = tempfile::tempdir().unwrap();
+        let cert_dir = dir.path().join("edge");
+        fs::create_dir_all(&cert_dir).unwrap();
+        fs::create_dir_all(dir.path().join("unmanaged")).unwrap();
+        let settings = build_settings(vec![1]);
+        let cert_path = cert_dir.join("server.crt");
+        write_cert(
+            &cert_path,
+            time::OffsetDateTime::now_utc() + time::Duration::days(90),
+        );
+        cert_metadata::write_metadata(
+            &settings,
+            &build_profile(cert_path.clone()),
+            &fs::read_to_string(&cert_path).unwrap(),
+            &crate::acme::timing::PhaseTimings::default(),
+        )
+        .await
+        .unwrap();
+        let before = fs::read(&cert_path).unwrap();
+
+        run_renew_dir(Arc::new(settings), None, dir.path(), None, false, false)
+            .await
+            .unwrap();
+
+        assert_eq!(fs::read(&cert_path).unwrap(), before);
+    }
+
+    #[tokio::test(start_paused = true)]
+    async fn test_renew_pacer_spaces_slots_at_rate() {
+        let mut pacer = RenewPacer::new(Some(4));
+        let started = tokio::time::Instant::now();
+
+        pacer.wait_for_slot().await;
+        assert_eq!(started.elapsed(), Duration::ZERO);
+        pacer.wait_for_slot().await;
+        pacer.wait_for_slot().await;
+        assert_eq!(started.elapsed(), Duration::from_secs(30));
+
+        let mut unpaced = RenewPacer::new(None);
+        unpaced.wait_for_slot().await;
+        unpaced.wait_for_slot().await;
+        assert_eq!(started.elapsed(), Duration::from_secs(30));
+    }
+
+    #[test]
+    fn test_rate_limit_pause_defaults_and_caps_retry_after() {
+        assert_eq!(RenewPacer::rate_limit_pause(None), DEFAULT_RATE_LIMIT_PAUSE);
+        assert_eq!(
+            RenewPacer::rate_limit_pause(Some(Duration::from_secs(5))),
+            Duration::from_secs(5)
+        );
+        assert_eq!(
+            RenewPacer::rate_limit_pause(Some(Duration::from_secs(86_400))),
+            MAX_RATE_LIMIT_PAUSE
+        );
+    }
+
+    #[tokio::test]
+    async fn test_run_renew_dir_reports_invalid_metadata() {
+        let dir = tempfile::tempdir().unwrap();
+        fs::write(dir.path().join("server.meta.json"), "not json").unwrap();
+
+        let err = run_renew_dir(
+            Arc::new(build_settings(vec![1])),
+            None,
+            dir.path(),
+            None,
+            false,
+            false,
+        )
+        .await
+        .unwrap_err();
+
+        assert!(err.to_string().contains("1 of 1"));
+    }
+
     #[tokio::test]
     async fn test_should_renew_when_near_expiry() {
         let dir = tempfile::tempdir().unwrap();
@@ -965,6 +2190,147 @@ mod tests {
         assert!(renew);
     }
 
+    #[tokio::test]
+    async fn test_should_renew_when_lifetime_percentage_reached() {
+        let dir = tempfile::tempdir().unwrap();
+        let cert_path = dir.path().join("short-lived.pem");
+        let mut profile = build_profile(cert_path.clone());
+
+        // `write_cert` backdates NotBefore by a day, so a third of a
+        // three-day lifetime has elapsed.
+        let not_after = time::OffsetDateTime::now_utc() + time::Duration::days(2);
+        write_cert(&cert_path, not_after);
+
+        profile.daemon.renew_before_pct = Some(50);
+        let renew = should_renew(
+            &profile,
+            &config::TrustSettings::default(),
+            Duration::from_hours(1),
+        )
+        .await
+        .unwrap();
+        assert!(!renew);
+
+        profile.daemon.renew_before_pct = Some(30);
+        let renew = should_renew(
+            &profile,
+            &config::TrustSettings::default(),
+            Duration::from_hours(1),
+        )
+        .await
+        .unwrap();
+        assert!(renew);
+    }
+
+    #[test]
+    fn test_renewal_due_percentage_of_lifetime() {
+        let not_before = time::OffsetDateTime::UNIX_EPOCH;
+        let not_after = not_before + time::Duration::hours(24);
+        let renew_before = time::Duration::ZERO;
+
+        // 67% of a 24h lifetime is 16h04m48s, so renewal starts then.
+        let before = not_before + time::Duration::hours(16);
+        let at = not_before + time::Duration::seconds(16 * 3600 + 4 * 60 + 48);
+        assert!(!renewal_due(
+            not_before,
+            not_after,
+            before,
+            renew_before,
+            Some(67)
+        ));
+        assert!(renewal_due(
+            not_before,
+            not_after,
+            at,
+            renew_before,
+            Some(67)
+        ));
+
+        // The same percentage scales with the lifetime: a 90-day
+        // certificate is not due after 60 days but is after 61.
+        let not_after = not_before + time::Duration::days(90);
+        let day_60 = not_before + time::Duration::days(60);
+        let day_61 = not_before + time::Duration::days(61);
+        assert!(!renewal_due(
+            not_before,
+            not_after,
+            day_60,
+            renew_before,
+            Some(67)
+        ));
+        assert!(renewal_due(
+            not_before,
+            not_after,
+            day_61,
+            renew_before,
+            Some(67)
+        ));
+    }
+
+    #[test]
+    fn test_renewal_due_whichever_triggers_first() {
+        let not_before = time::OffsetDateTime::UNIX_EPOCH;
+        let not_after = not_before + time::Duration::days(90);
+        let day_10 = not_before + time::Duration::days(10);
+
+        // The duration alone triggers with 80 of 90 days left.
+        assert!(renewal_due(
+            not_before,
+            not_after,
+            day_10,
+            time::Duration::days(85),
+            Some(90),
+        ));
+        // The percentage alone triggers when the duration has not: 10 of
+        // 90 days is 11% elapsed.
+        assert!(renewal_due(
+            not_before,
+            not_after,
+            day_10,
+            time::Duration::hours(16),
+            Some(10),
+        ));
+        // Neither triggers.
+        assert!(!renewal_due(
+            not_before,
+            not_after,
+            day_10,
+            time::Duration::hours(16),
+            Some(50),
+        ));
+        // Without a percentage only the duration counts.
+        assert!(!renewal_due(
+            not_before,
+            not_after,
+            day_10,
+            time::Duration::hours(16),
+            None,
+        ));
+    }
+
+    #[test]
+    fn test_renewal_due_without_lifetime() {
+        let not_before = time::OffsetDateTime::UNIX_EPOCH + time::Duration::days(1);
+        let not_after = time::OffsetDateTime::UNIX_EPOCH + time::Duration::days(30);
+        let now = time::OffsetDateTime::UNIX_EPOCH;
+
+        assert!(renewal_due(
+            not_after,
+            not_after,
+            now,
+            time::Duration::ZERO,
+            Some(1),
+        ));
+        // Not yet valid: none of the lifetime has elapsed.
+        assert!(!renewal_due(
+            not_before,
+            not_after,
+            now,
+            time::Duration::ZERO,
+            Some(1),
+        ));
+    }
+
     #[tokio::test]
     async fn test_should_renew_invalid_pem_errors() {
         let dir = tempfile::tempdir().unwrap();
@@ -1015,6 +2381,9 @@ mod tests {
         let trust = config::TrustSettings {
             ca_bundle_path: Some(bundle_path),
             trusted_ca_sha256: Vec::new(),
+            include_root: false,
+            ca_dir: None,
+            ..config::TrustSettings::default()
         };
 
         let renew = should_renew(&profile, &trust, Duration::from_secs(THIRTY_DAYS_SECS))
@@ -1044,6 +2413,9 @@ mod tests {
         let trust = config::TrustSettings {
             ca_bundle_path: Some(bundle_path),
             trusted_ca_sha256: Vec::new(),
+            include_root: false,
+            ca_dir: None,
+            ..config::TrustSettings::default()
         };
 
         let renew = should_renew(&profile, &trust, Duration::from_secs(THIRTY_DAYS_SECS))
@@ -1069,6 +2441,9 @@ mod tests {
         let trust = config::TrustSettings {
             ca_bundle_path: Some(bundle_path),
             trusted_ca_sha256: Vec::new(),
+            include_root: false,
+            ca_dir: None,
+            ..config::TrustSettings::default()
         };
 
         let renew = should_renew(&profile, &trust, Duration::from_secs(THIRTY_DAYS_SECS))
@@ -0,0 +1,169 @@
+//! Minimal DER (X.690) encoding and reading.
+//!
+//! The agent builds and reads a handful of ASN.1 structures by hand:
+//! OCSP requests and responses, PKCS#8 and PKCS#12 containers, and the
+//! signatures and public keys a PKCS#11 token returns. They only need
+//! single-byte tags and definite lengths, which is all this module
+//! supports.
+
+use anyhow::Result;
+
+pub(crate) const TAG_INTEGER: u8 = 0x02;
+pub(crate) const TAG_BIT_STRING: u8 = 0x03;
+pub(crate) const TAG_OCTET_STRING: u8 = 0x04;
+pub(crate) const TAG_NULL: u8 = 0x05;
+pub(crate) const TAG_OID: u8 = 0x06;
+pub(crate) const TAG_ENUMERATED: u8 = 0x0a;
+pub(crate) const TAG_SEQUENCE: u8 = 0x30;
+pub(crate) const TAG_SET: u8 = 0x31;
+
+/// Encodes one DER TLV with a single-byte tag and a definite length.
+pub(crate) fn tlv(tag: u8, content: &[u8]) -> Vec<u8> {
+    let mut out = vec![tag];
+    let len = content.len();
+    if len < 0x80 {
+        out.push(u8::try_from(len).unwrap_or_default());
+    } else {
+        let len_bytes: Vec<u8> = len
+            .to_be_bytes()
+            .into_iter()
+            .skip_while(|byte| *byte == 0)
+            .collect();
+        out.push(0x80 | u8::try_from(len_bytes.len()).unwrap_or_default());
+        out.extend(len_bytes);
+    }
+    out.extend_from_slice(content);
+    out
+}
+
+/// Encodes the unsigned big-endian `bytes` as a DER `INTEGER`, trimming
+/// leading zeros and adding a sign byte where the high bit is set.
+pub(crate) fn integer(bytes: &[u8]) -> Vec<u8> {
+    let start = bytes
+        .iter()
+        .position(|byte| *byte != 0)
+        .unwrap_or(bytes.len().saturating_sub(1));
+    let trimmed = bytes.get(start..).unwrap_or_default();
+    let mut content = Vec::with_capacity(trimmed.len() + 1);
+    if trimmed.first().is_none_or(|byte| byte & 0x80 != 0) {
+        content.push(0);
+    }
+    content.extend_from_slice(trimmed);
+    tlv(TAG_INTEGER, &content)
+}
+
+/// Reader over a sequence of DER TLVs with single-byte tags.
+pub(crate) struct Der<'a> {
+    input: &'a [u8],
+}
+
+impl<'a> Der<'a> {
+    pub(crate) fn new(input: &'a [u8]) -> Self {
+        Self { input }
+    }
+
+    pub(crate) fn is_empty(&self) -> bool {
+        self.input.is_empty()
+    }
+
+    pub(crate) fn peek_tag(&self) -> Option<u8> {
+        self.input.first().copied()
+    }
+
+    /// Reads the next TLV and returns its tag and content.
+    ///
+    /// # Errors
+    /// Returns an error if the input is truncated or uses a multi-byte
+    /// tag.
+    pub(crate) fn read(&mut self) -> Result<(u8, &'a [u8])> {
+        let truncated = || anyhow::anyhow!("Truncated DER");
+        let (&tag, rest) = self.input.split_first().ok_or_else(truncated)?;
+        if tag & 0x1f == 0x1f {
+            anyhow::bail!("Unsupported multi-byte DER tag");
+        }
+        let (&first, mut rest) = rest.split_first().ok_or_else(truncated)?;
+        let len = if first < 0x80 {
+            usize::from(first)
+        } else {
+            let count = usize::from(first & 0x7f);
+            if count == 0 || count > std::mem::size_of::<usize>() || rest.len() < count {
+                return Err(truncated());
+            }
+            let (len_bytes, tail) = rest.split_at(count);
+            rest = tail;
+            len_bytes
+                .iter()
+                .fold(0usize, |acc, b| (acc << 8) | usize::from(*b))
+        };
+        if rest.len() < len {
+            return Err(truncated());
+        }
+        let (content, tail) = rest.split_at(len);
+        self.input = tail;
+        Ok((tag, content))
+    }
+
+    /// Reads the next TLV and returns its whole encoding, tag and length
+    /// included, as a signature covers it.
+    ///
+    /// # Errors
+    /// Returns an error if the TLV cannot be read.
+    pub(crate) fn read_element(&mut self) -> Result<&'a [u8]> {
+        let start = self.input;
+        self.read()?;
+        let (element, _) = start.split_at(start.len() - self.input.len());
+        Ok(element)
+    }
+
+    /// Reads the next TLV and returns its content if it has `tag`.
+    ///
+    /// # Errors
+    /// Returns an error if the TLV cannot be read or has another tag.
+    pub(crate) fn expect(&mut self, tag: u8) -> Result<&'a [u8]> {
+        let (found, content) = self.read()?;
+        if found != tag {
+            anyhow::bail!("Unexpected DER tag {found:#04x}, wanted {tag:#04x}");
+        }
+        Ok(content)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_integer_adds_sign_byte_and_trims_leading_zeros() {
+        assert_eq!(integer(&[0x00, 0x00, 0x7f]), vec![0x02, 0x01, 0x7f]);
+        assert_eq!(integer(&[0x80]), vec![0x02, 0x02, 0x00, 0x80]);
+        assert_eq!(integer(&[0x00]), vec![0x02, 0x01, 0x00]);
+    }
+
+    #[test]
+    fn test_tlv_uses_long_form_length() {
+        let content = vec![0u8; 300];
+
+        let out = tlv(TAG_SEQUENCE, &content);
+
+        assert_eq!(out.get(..4).unwrap(), &[0x30, 0x82, 0x01, 0x2c]);
+        assert_eq!(out.len(), 304);
+    }
+
+    #[test]
+    fn test_der_reads_back_what_tlv_encodes() {
+        let mut encoded = tlv(TAG_OCTET_STRING, &[0xab; 200]);
+        encoded.extend(integer(&[0x01, 0x00]));
+
+        let mut der = Der::new(&encoded);
+        assert_eq!(der.peek_tag(), Some(TAG_OCTET_STRING));
+        assert_eq!(
+            Der::new(&encoded).read_element().unwrap(),
+            encoded.get(..203).unwrap()
+        );
+        assert_eq!(der.expect(TAG_OCTET_STRING).unwrap(), &[0xab; 200]);
+        assert!(der.expect(TAG_SEQUENCE).is_err());
+        assert!(der.is_empty());
+
+        assert!(Der::new(&[0x30, 0x05, 0x0a]).read().is_err());
+    }
+}
@@ -0,0 +1,506 @@
+//! Minimal DNS-over-UDP stub resolver.
+//!
+//! Split-horizon deployments sometimes need the agent to resolve the
+//! ACME server through a specific resolver rather than the host's
+//! system configuration. This module speaks just enough of RFC 1035 to
+//! send a recursive query to one configured server and read back the
+//! answer records; it plugs into `reqwest` through [`Resolve`] so the
+//! ACME client's dialer uses it transparently.
+
+use std::net::{IpAddr, Ipv4Addr, Ipv6Addr, SocketAddr};
+use std::sync::Arc;
+use std::time::Duration;
+
+use anyhow::{Context, Result};
+use reqwest::dns::{Addrs, Name, Resolve, Resolving};
+use ring::rand::{SecureRandom, SystemRandom};
+use tokio::net::UdpSocket;
+
+const DNS_PORT: u16 = 53;
+pub(crate) const DNS_HEADER_LEN: usize = 12;
+pub(crate) const DNS_MAX_UDP_PAYLOAD: usize = 4096;
+pub(crate) const DNS_LABEL_MAX_LEN: usize = 63;
+pub(crate) const DNS_CLASS_IN: u16 = 1;
+pub(crate) const DNS_FLAG_RECURSION_DESIRED: u16 = 0x0100;
+pub(crate) const DNS_FLAG_RESPONSE: u16 = 0x8000;
+const DNS_FLAG_TRUNCATED: u16 = 0x0200;
+const DNS_RCODE_MASK: u16 = 0x000f;
+pub(crate) const DNS_RCODE_NXDOMAIN: u16 = 3;
+pub(crate) const DNS_POINTER_MASK: u8 = 0xc0;
+const DNS_QUERY_TIMEOUT: Duration = Duration::from_secs(5);
+const DNS_QUERY_ATTEMPTS: u32 = 2;
+
+/// DNS record types the agent queries.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum RecordType {
+    A,
+    Aaaa,
+    Txt,
+}
+
+impl RecordType {
+    pub(crate) fn code(self) -> u16 {
+        match self {
+            Self::A => 1,
+            Self::Aaaa => 28,
+            Self::Txt => 16,
+        }
+    }
+}
+
+/// Stub resolver that sends every query to a single DNS server.
+#[derive(Debug, Clone)]
+pub(crate) struct DnsResolver {
+    server: SocketAddr,
+    timeout: Duration,
+}
+
+impl DnsResolver {
+    pub(crate) fn new(server: SocketAddr) -> Self {
+        Self {
+            server,
+            timeout: DNS_QUERY_TIMEOUT,
+        }
+    }
+
+    /// Builds a resolver from an `ip` or `ip:port` address string.
+    ///
+    /// # Errors
+    /// Returns an error if `value` is not a valid resolver address.
+    pub(crate) fn from_addr(value: &str) -> Result<Self> {
+        parse_resolver_addr(value).map(Self::new)
+    }
+
+    /// Resolves `name` to its IPv4 and IPv6 addresses.
+    ///
+    /// # Errors
+    /// Returns an error if the server cannot be reached, answers with an
+    /// error, or returns no address records for `name`.
+    pub(crate) async fn lookup_ip(&self, name: &str) -> Result<Vec<IpAddr>> {
+        let mut addrs = Vec::new();
+        for rdata in self.query(name, RecordType::A).await? {
+            let octets: [u8; 4] = rdata
+                .as_slice()
+                .try_into()
+                .map_err(|_| anyhow::anyhow!("Malformed A record for {name}"))?;
+            addrs.push(IpAddr::V4(Ipv4Addr::from(octets)));
+        }
+        for rdata in self.query(name, RecordType::Aaaa).await? {
+            let octets: [u8; 16] = rdata
+                .as_slice()
+                .try_into()
+                .map_err(|_| anyhow::anyhow!("Malformed AAAA record for {name}"))?;
+            addrs.push(IpAddr::V6(Ipv6Addr::from(octets)));
+        }
+        if addrs.is_empty() {
+            anyhow::bail!(
+                "DNS server {} returned no addresses for {name}",
+                self.server
+            );
+        }
+        Ok(addrs)
+    }
+
+    /// Sends one query and returns the RDATA of matching answers.
+    ///
+    /// # Errors
+    /// Returns an error if every attempt times out or the response is
+    /// malformed or carries an error RCODE other than NXDOMAIN.
+    pub(crate) async fn query(&self, name: &str, record_type: RecordType) -> Result<Vec<Vec<u8>>> {
+        let mut last_err = None;
+        for _ in 0..DNS_QUERY_ATTEMPTS {
+            match self.query_once(name, record_type).await {
+                Ok(answers) => return Ok(answers),
+                Err(err) => last_err = Some(err),
+            }
+        }
+        Err(last_err.unwrap_or_else(|| anyhow::anyhow!("DNS query for {name} failed")))
+    }
+
+    async fn query_once(&self, name: &str, record_type: RecordType) -> Result<Vec<Vec<u8>>> {
+        let id = random_query_id()?;
+        let query = build_query(id, name, record_type)?;
+        let bind_addr: SocketAddr = if self.server.is_ipv4() {
+            (Ipv4Addr::UNSPECIFIED, 0).into()
+        } else {
+            (Ipv6Addr::UNSPECIFIED, 0).into()
+        };
+        let socket = UdpSocket::bind(bind_addr)
+            .await
+            .context("Failed to bind DNS client socket")?;
+        socket
+            .connect(self.server)
+            .await
+            .with_context(|| format!("Failed to connect to DNS server {}", self.server))?;
+        socket
+            .send(&query)
+            .await
+            .context("Failed to send DNS query")?;
+
+        let mut buf = vec![0u8; DNS_MAX_UDP_PAYLOAD];
+        let len = tokio::time::timeout(self.timeout, socket.recv(&mut buf))
+            .await
+            .map_err(|_| anyhow::anyhow!("DNS query to {} timed out", self.server))?
+            .context("Failed to receive DNS response")?;
+        let response = buf
+            .get(..len)
+            .ok_or_else(|| anyhow::anyhow!("DNS response length out of range"))?;
+        parse_answers(response, id, record_type)
+    }
+}
+
+impl Resolve for DnsResolver {
+    fn resolve(&self, name: Name) -> Resolving {
+        let resolver = self.clone();
+        Box::pin(async move {
+            let addrs = resolver.lookup_ip(name.as_str()).await?;
+            // reqwest replaces the port with the one from the request URL.
+            let addrs: Addrs = Box::new(addrs.into_iter().map(|ip| SocketAddr::new(ip, 0)));
+            Ok(addrs)
+        })
+    }
+}
+
+/// Returns a shared resolver for `reqwest::ClientBuilder::dns_resolver`,
+/// or `None` to keep the system resolver.
+///
+/// # Errors
+/// Returns an error if `value` is set but not a valid resolver address.
+pub(crate) fn shared_resolver(value: Option<&str>) -> Result<Option<Arc<DnsResolver>>> {
+    value
+        .map(|addr| DnsResolver::from_addr(addr).map(Arc::new))
+        .transpose()
+}
+
+/// Parses a resolver address given as `ip`, `ip:port`, or `[ipv6]:port`.
+///
+/// The port defaults to 53. Host names are rejected: the resolver itself
+/// cannot depend on name resolution.
+///
+/// # Errors
+/// Returns an error if `value` is not an IP address with optional port.
+pub(crate) fn parse_resolver_addr(value: &str) -> Result<SocketAddr> {
+    let trimmed = value.trim();
+    if let Ok(addr) = trimmed.parse::<SocketAddr>() {
+        if addr.port() == 0 {
+            anyhow::bail!("DNS resolver port must not be 0: {value}");
+        }
+        return Ok(addr);
+    }
+    let host = trimmed
+        .strip_prefix('[')
+        .and_then(|rest| rest.strip_suffix(']'))
+        .unwrap_or(trimmed);
+    host.parse::<IpAddr>()
+        .map(|ip| SocketAddr::new(ip, DNS_PORT))
+        .map_err(|_| {
+            anyhow::anyhow!("DNS resolver must be an IP address with optional port: {value}")
+        })
+}
+
+/// Resolves `name` through the configured `acme.dns_resolver`, or the
+/// system resolver when none is set.
+///
+/// # Errors
+/// Returns an error if the resolver address is invalid or the lookup
+/// fails or returns no addresses.
+pub(crate) async fn resolve_host(name: &str, resolver: Option<&str>) -> Result<Vec<IpAddr>> {
+    if let Some(resolver) = resolver {
+        return DnsResolver::from_addr(resolver)?.lookup_ip(name).await;
+    }
+    let addrs: Vec<IpAddr> = tokio::net::lookup_host((name, 0))
+        .await
+        .with_context(|| format!("Failed to resolve {name}"))?
+        .map(|addr| addr.ip())
+        .collect();
+    if addrs.is_empty() {
+        anyhow::bail!("No addresses found for {name}");
+    }
+    Ok(addrs)
+}
+
+/// Returns the IPv4 and IPv6 addresses bound to this host's interfaces.
+///
+/// # Errors
+/// Returns an error if the interface list cannot be read.
+pub(crate) fn local_addresses() -> std::io::Result<Vec<IpAddr>> {
+    let mut head: *mut libc::ifaddrs = std::ptr::null_mut();
+    // SAFETY: `head` is a valid out-pointer; on success it owns a list
+    // released by `freeifaddrs` below.
+    if unsafe { libc::getifaddrs(&raw mut head) } != 0 {
+        return Err(std::io::Error::last_os_error());
+    }
+    let mut addrs = Vec::new();
+    let mut cursor = head;
+    while !cursor.is_null() {
+        // SAFETY: `cursor` is a non-null node of the list from `getifaddrs`.
+        let entry = unsafe { &*cursor };
+        cursor = entry.ifa_next;
+        if entry.ifa_addr.is_null() {
+            continue;
+        }
+        // SAFETY: `ifa_addr` is non-null and its family tells which
+        // `sockaddr` variant it points to.
+        match i32::from(unsafe { (*entry.ifa_addr).sa_family }) {
+            libc::AF_INET => {
+                // SAFETY: AF_INET addresses are `sockaddr_in`.
+                let sin = unsafe { &*entry.ifa_addr.cast::<libc::sockaddr_in>() };
+                addrs.push(IpAddr::V4(Ipv4Addr::from(u32::from_be(
+                    sin.sin_addr.s_addr,
+                ))));
+            }
+            libc::AF_INET6 => {
+                // SAFETY: AF_INET6 addresses are `sockaddr_in6`.
+                let sin6 = unsafe { &*entry.ifa_addr.cast::<libc::sockaddr_in6>() };
+                addrs.push(IpAddr::V6(Ipv6Addr::from(sin6.sin6_addr.s6_addr)));
+            }
+            _ => {}
+        }
+    }
+    // SAFETY: `head` came from a successful `getifaddrs` and is freed once.
+    unsafe { libc::freeifaddrs(head) };
+    Ok(addrs)
+}
+
+fn random_query_id() -> Result<u16> {
+    let mut bytes = [0u8; 2];
+    SystemRandom::new()
+        .fill(&mut bytes)
+        .map_err(|_| anyhow::anyhow!("Failed to generate DNS query id"))?;
+    Ok(u16::from_be_bytes(bytes))
+}
+
+fn build_query(id: u16, name: &str, record_type: RecordType) -> Result<Vec<u8>> {
+    let mut query = Vec::with_capacity(DNS_HEADER_LEN + name.len() + 6);
+    query.extend_from_slice(&id.to_be_bytes());
+    query.extend_from_slice(&DNS_FLAG_RECURSION_DESIRED.to_be_bytes());
+    query.extend_from_slice(&1u16.to_be_bytes());
+    query.extend_from_slice(&[0, 0, 0, 0, 0, 0]);
+    for label in name.trim_end_matches('.').split('.') {
+        let len = u8::try_from(label.len())
+            .ok()
+            .filter(|len| (1..=DNS_LABEL_MAX_LEN).contains(&usize::from(*len)))
+            .ok_or_else(|| anyhow::anyhow!("Invalid DNS name: {name}"))?;
+        query.push(len);
+        query.extend_from_slice(label.as_bytes());
+    }
+    query.push(0);
+    query.extend_from_slice(&record_type.code().to_be_bytes());
+    query.extend_from_slice(&DNS_CLASS_IN.to_be_bytes());
+    Ok(query)
+}
+
+fn parse_answers(response: &[u8], id: u16, record_type: RecordType) -> Result<Vec<Vec<u8>>> {
+    if read_u16(response, 0)? != id {
+        anyhow::bail!("DNS response id does not match the query");
+    }
+    let flags = read_u16(response, 2)?;
+    if flags & DNS_FLAG_RESPONSE == 0 {
+        anyhow::bail!("DNS packet is not a response");
+    }
+    if flags & DNS_FLAG_TRUNCATED != 0 {
+        anyhow::bail!("DNS response was truncated");
+    }
+    match flags & DNS_RCODE_MASK {
+        0 => {}
+        DNS_RCODE_NXDOMAIN => return Ok(Vec::new()),
+        rcode => anyhow::bail!("DNS server returned RCODE {rcode}"),
+    }
+
+    let questions = read_u16(response, 4)?;
+    let answers = read_u16(response, 6)?;
+    let mut pos = DNS_HEADER_LEN;
+    for _ in 0..questions {
+        pos = skip_name(response, pos)? + 4;
+    }
+
+    let mut records = Vec::new();
+    for _ in 0..answers {
+        pos = skip_name(response, pos)?;
+        let rtype = read_u16(response, pos)?;
+        let rdlen = usize::from(read_u16(response, pos + 8)?);
+        let start = pos + 10;
+        let rdata = response
+            .get(start..start + rdlen)
+            .ok_or_else(|| anyhow::anyhow!("DNS answer record is truncated"))?;
+        if rtype == record_type.code() {
+            records.push(rdata.to_vec());
+        }
+        pos = start + rdlen;
+    }
+    Ok(records)
+}
+
+fn skip_name(packet: &[u8], mut pos: usize) -> Result<usize> {
+    loop {
+        let len = *packet
+            .get(pos)
+            .ok_or_else(|| anyhow::anyhow!("DNS name runs past the packet"))?;
+        if len & DNS_POINTER_MASK == DNS_POINTER_MASK {
+            return Ok(pos + 2);
+        }
+        if len == 0 {
+            return Ok(pos + 1);
+        }
+        pos += 1 + usize::from(len);
+    }
+}
+
+pub(crate) fn read_u16(packet: &[u8], pos: usize) -> Result<u16> {
+    packet
+        .get(pos..pos + 2)
+        .and_then(|bytes| bytes.try_into().ok())
+        .map(u16::from_be_bytes)
+        .ok_or_else(|| anyhow::anyhow!("DNS packet is truncated"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Builds a response to `query` carrying the given answers, using a
+    /// compression pointer back to the question name for each record.
+    fn build_response(query: &[u8], rcode: u16, answers: &[(RecordType, Vec<u8>)]) -> Vec<u8> {
+        let mut response = query.to_vec();
+        let flags = DNS_FLAG_RESPONSE | DNS_FLAG_RECURSION_DESIRED | rcode;
+        response.splice(2..4, flags.to_be_bytes());
+        let count = u16::try_from(answers.len()).unwrap();
+        response.splice(6..8, count.to_be_bytes());
+        for (record_type, rdata) in answers {
+            response.extend_from_slice(&[0xc0, 0x0c]);
+            response.extend_from_slice(&record_type.code().to_be_bytes());
+            response.extend_from_slice(&DNS_CLASS_IN.to_be_bytes());
+            response.extend_from_slice(&60u32.to_be_bytes());
+            let len = u16::try_from(rdata.len()).unwrap();
+            response.extend_from_slice(&len.to_be_bytes());
+            response.extend_from_slice(rdata);
+        }
+        response
+    }
+
+    async fn spawn_dns_server(addr_v4: [u8; 4]) -> SocketAddr {
+        let socket = UdpSocket::bind("127.0.0.1:0").await.unwrap();
+        let addr = socket.local_addr().unwrap();
+        tokio::spawn(async move {
+            let mut buf = vec![0u8; DNS_MAX_UDP_PAYLOAD];
+            loop {
+                let Ok((len, peer)) = socket.recv_from(&mut buf).await else {
+                    return;
+                };
+                let query = buf.get(..len).unwrap().to_vec();
+                let qtype_pos = len - 4;
+                let qtype = read_u16(&query, qtype_pos).unwrap();
+                let answers = if qtype == RecordType::A.code() {
+                    vec![(RecordType::A, addr_v4.to_vec())]
+                } else {
+                    Vec::new()
+                };
+                let response = build_response(&query, 0, &answers);
+                let _ = socket.send_to(&response, peer).await;
+            }
+        });
+        addr
+    }
+
+    #[test]
+    fn parse_resolver_addr_defaults_port() {
+        assert_eq!(
+            parse_resolver_addr("10.0.0.53").unwrap(),
+            "10.0.0.53:53".parse::<SocketAddr>().unwrap()
+        );
+        assert_eq!(
+            parse_resolver_addr("[2001:db8::53]").unwrap(),
+            "[2001:db8::53]:53".parse::<SocketAddr>().unwrap()
+        );
+        assert_eq!(
+            parse_resolver_addr("2001:db8::53").unwrap(),
+            "[2001:db8::53]:53".parse::<SocketAddr>().unwrap()
+        );
+    }
+
+    #[test]
+    fn parse_resolver_addr_keeps_explicit_port() {
+        assert_eq!(
+            parse_resolver_addr("10.0.0.53:5353").unwrap(),
+            "10.0.0.53:5353".parse::<SocketAddr>().unwrap()
+        );
+    }
+
+    #[test]
+    fn parse_resolver_addr_rejects_invalid_values() {
+        for value in ["", "dns.example", "10.0.0.53:0", "10.0.0.53:abc"] {
+            assert!(parse_resolver_addr(value).is_err(), "accepted {value:?}");
+        }
+    }
+
+    #[test]
+    fn build_query_encodes_labels() {
+        let query = build_query(0x1234, "ca.example.", RecordType::A).unwrap();
+        assert_eq!(query.get(..2), Some(&[0x12, 0x34][..]));
+        assert_eq!(
+            query.get(DNS_HEADER_LEN..),
+            Some(&b"\x02ca\x07example\x00\x00\x01\x00\x01"[..])
+        );
+    }
+
+    #[test]
+    fn build_query_rejects_empty_label() {
+        assert!(build_query(1, "ca..example", RecordType::A).is_err());
+    }
+
+    #[test]
+    fn parse_answers_reads_matching_records() {
+        let query = build_query(7, "ca.example", RecordType::A).unwrap();
+        let response = build_response(&query, 0, &[(RecordType::A, vec![192, 0, 2, 10])]);
+
+        let answers = parse_answers(&response, 7, RecordType::A).unwrap();
+
+        assert_eq!(answers, vec![vec![192, 0, 2, 10]]);
+    }
+
+    #[test]
+    fn parse_answers_treats_nxdomain_as_empty() {
+        let query = build_query(7, "missing.example", RecordType::A).unwrap();
+        let response = build_response(&query, DNS_RCODE_NXDOMAIN, &[]);
+
+        assert!(
+            parse_answers(&response, 7, RecordType::A)
+                .unwrap()
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn parse_answers_rejects_mismatched_id_and_errors() {
+        let query = build_query(7, "ca.example", RecordType::A).unwrap();
+        let response = build_response(&query, 0, &[]);
+        assert!(parse_answers(&response, 8, RecordType::A).is_err());
+
+        let servfail = build_response(&query, 2, &[]);
+        assert!(parse_answers(&servfail, 7, RecordType::A).is_err());
+
+        assert!(parse_answers(response.get(..20).unwrap(), 7, RecordType::A).is_err());
+    }
+
+    #[tokio::test]
+    async fn lookup_ip_queries_configured_server() {
+        let server = spawn_dns_server([192, 0, 2, 44]).await;
+        let resolver = DnsResolver::new(server);
+
+        let addrs = resolver.lookup_ip("ca.internal").await.unwrap();
+
+        assert_eq!(addrs, vec![IpAddr::V4(Ipv4Addr::new(192, 0, 2, 44))]);
+    }
+
+    #[test]
+    fn test_local_addresses_include_loopback() {
+        let addrs = local_addresses().unwrap();
+        assert!(addrs.iter().any(IpAddr::is_loopback));
+    }
+
+    #[tokio::test]
+    async fn test_resolve_host_uses_system_resolver_without_override() {
+        let addrs = resolve_host("localhost", None).await.unwrap();
+        assert!(addrs.iter().any(IpAddr::is_loopback));
+    }
+}
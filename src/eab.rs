@@ -1,13 +1,21 @@
 use std::path::{Path, PathBuf};
+use std::process::Stdio;
+use std::time::Duration;
 
 use anyhow::Context;
 use serde::{Deserialize, Serialize};
 use tokio::fs;
+use tokio::process::Command;
 use tokio::sync::watch;
-use tracing::warn;
+use tracing::{info, warn};
 
 use crate::fs_util;
 
+const EAB_COMMAND_SHELL: &str = "sh";
+const EAB_DIR_KID_FILE: &str = "kid";
+const EAB_DIR_HMAC_FILE: &str = "hmac";
+const EAB_COMMAND_TIMEOUT: Duration = Duration::from_secs(30);
+
 #[derive(Debug, Clone, Deserialize, Serialize)]
 pub struct EabCredentials {
     pub kid: String,
@@ -186,6 +194,99 @@ pub async fn load_credentials(
 
     Ok(None)
 }
+
+/// Loads EAB credentials from the stdout of `command`, run through
+/// `sh -c`, for `--eab-command` (e.g. a secrets-manager CLI). The output
+/// must be the same `{ "kid", "hmac" }` JSON as `--eab-file`, so the
+/// secret never has to be written to disk.
+///
+/// Error messages never include the command's output, since it holds the
+/// HMAC key.
+///
+/// # Errors
+///
+/// Returns an error if the command cannot be started, times out, exits
+/// unsuccessfully, or prints anything other than EAB JSON with a non-empty
+/// `kid` and `hmac`.
+pub async fn load_credentials_from_command(command: &str) -> anyhow::Result<EabCredentials> {
+    let child = Command::new(EAB_COMMAND_SHELL)
+        .arg("-c")
+        .arg(command)
+        .stdin(Stdio::null())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::inherit())
+        .kill_on_drop(true)
+        .spawn()
+        .context("Failed to start --eab-command")?;
+    let output = tokio::time::timeout(EAB_COMMAND_TIMEOUT, child.wait_with_output())
+        .await
+        .map_err(|_| {
+            anyhow::anyhow!(
+                "--eab-command timed out after {}s",
+                EAB_COMMAND_TIMEOUT.as_secs()
+            )
+        })?
+        .context("Failed to run --eab-command")?;
+    if !output.status.success() {
+        anyhow::bail!("--eab-command failed with {}", output.status);
+    }
+    let creds = parse_command_output(&output.stdout)?;
+    info!("Loaded EAB credentials from --eab-command");
+    Ok(creds)
+}
+
+/// Loads EAB credentials from a directory holding one file per field,
+/// `kid` and `hmac`, for `--eab-dir`. This is the layout a Kubernetes
+/// secret mount produces, so no JSON file has to be assembled. Trailing
+/// newlines are trimmed.
+///
+/// # Errors
+///
+/// Returns an error naming the file if either one is missing, unreadable,
+/// or empty.
+pub async fn load_credentials_from_dir(dir: &Path) -> anyhow::Result<EabCredentials> {
+    let creds = EabCredentials {
+        kid: read_eab_dir_field(dir, EAB_DIR_KID_FILE).await?,
+        hmac: read_eab_dir_field(dir, EAB_DIR_HMAC_FILE).await?,
+    };
+    info!("Loaded EAB credentials from {}", dir.display());
+    Ok(creds)
+}
+
+async fn read_eab_dir_field(dir: &Path, name: &str) -> anyhow::Result<String> {
+    let path = dir.join(name);
+    let content = match fs::read_to_string(&path).await {
+        Ok(content) => content,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
+            anyhow::bail!("--eab-dir is missing the {name} file: {}", path.display());
+        }
+        Err(err) => {
+            return Err(err).with_context(|| format!("Failed to read {}", path.display()));
+        }
+    };
+    let value = content.trim_end_matches(['\n', '\r']);
+    if value.is_empty() {
+        anyhow::bail!("--eab-dir {name} file is empty: {}", path.display());
+    }
+    Ok(value.to_string())
+}
+
+fn parse_command_output(stdout: &[u8]) -> anyhow::Result<EabCredentials> {
+    // serde_json echoes offending values in some messages; report only the
+    // position so the HMAC key cannot leak into logs.
+    let creds: EabCredentials = serde_json::from_slice(stdout).map_err(|err| {
+        anyhow::anyhow!(
+            "--eab-command output is not EAB JSON (line {}, column {})",
+            err.line(),
+            err.column()
+        )
+    })?;
+    if creds.kid.is_empty() || creds.hmac.is_empty() {
+        anyhow::bail!("--eab-command output has an empty kid or hmac");
+    }
+    Ok(creds)
+}
+
 #[cfg(test)]
 mod tests {
     use std::io::Write;
@@ -263,6 +364,31 @@ mod tests {
         let after_clear = load_credentials(None, None, Some(path)).await.unwrap();
         assert!(after_clear.is_none());
     }
+    #[tokio::test]
+    async fn test_load_credentials_from_dir_trims_trailing_newlines() {
+        let dir = tempfile::tempdir().unwrap();
+        std::fs::write(dir.path().join("kid"), "dir-kid\n").unwrap();
+        std::fs::write(dir.path().join("hmac"), "dir-hmac\r\n").unwrap();
+
+        let creds = load_credentials_from_dir(dir.path()).await.unwrap();
+
+        assert_eq!(creds.kid, "dir-kid");
+        assert_eq!(creds.hmac, "dir-hmac");
+    }
+
+    #[tokio::test]
+    async fn test_load_credentials_from_dir_names_missing_or_empty_file() {
+        let dir = tempfile::tempdir().unwrap();
+        std::fs::write(dir.path().join("kid"), "dir-kid").unwrap();
+
+        let err = load_credentials_from_dir(dir.path()).await.unwrap_err();
+        assert!(err.to_string().contains("missing the hmac file"), "{err:#}");
+
+        std::fs::write(dir.path().join("hmac"), "\n").unwrap();
+        let err = load_credentials_from_dir(dir.path()).await.unwrap_err();
+        assert!(err.to_string().contains("hmac file is empty"), "{err:#}");
+    }
+
     #[tokio::test]
     async fn test_load_credentials_none() {
         let result = load_credentials(None, None, None).await;
@@ -322,4 +448,40 @@ mod tests {
         tx.send_replace(None);
         assert!(shared.current().is_none());
     }
+
+    #[tokio::test]
+    async fn load_credentials_from_command_parses_stdout() {
+        let creds =
+            load_credentials_from_command(r#"printf '{"kid":"cmd-kid","hmac":"cmd-hmac"}'"#)
+                .await
+                .unwrap();
+
+        assert_eq!(creds.kid, "cmd-kid");
+        assert_eq!(creds.hmac, "cmd-hmac");
+    }
+
+    #[tokio::test]
+    async fn load_credentials_from_command_reports_failed_command() {
+        let err = load_credentials_from_command("exit 3").await.unwrap_err();
+
+        assert!(err.to_string().contains("--eab-command failed"));
+    }
+
+    #[tokio::test]
+    async fn load_credentials_from_command_redacts_unparseable_output() {
+        let err = load_credentials_from_command(r#"printf '{"kid":"k","hmac":42}'"#)
+            .await
+            .unwrap_err();
+
+        assert!(err.to_string().contains("not EAB JSON"));
+        assert!(!err.to_string().contains("42"));
+    }
+
+    #[test]
+    fn parse_command_output_rejects_empty_fields() {
+        let err = parse_command_output(br#"{"kid":"","hmac":"secret"}"#).unwrap_err();
+
+        assert!(err.to_string().contains("empty kid or hmac"));
+        assert!(!err.to_string().contains("secret"));
+    }
 }
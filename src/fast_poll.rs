@@ -3281,16 +3281,20 @@ mod tests {
             paths: config::Paths {
                 cert: PathBuf::from("cert.pem"),
                 key: PathBuf::from("key.pem"),
+                chain: None,
+                pin: None,
             },
             daemon: config::DaemonRuntimeSettings {
                 check_interval: Duration::from_hours(1),
                 renew_before: Duration::from_hours(1),
+                renew_before_pct: None,
                 check_jitter: Duration::from_secs(0),
+                escalate_before: Duration::from_hours(4),
+                exit_on_expired: false,
+                renew_on_revoked: false,
+                verify_dns_before_renew: false,
             },
-            retry: None,
-            hooks: config::HookSettings::default(),
-            eab: None,
-            cert_group_gid: None,
+            ..config::DaemonProfileSettings::default()
         }
     }
 
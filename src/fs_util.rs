@@ -132,7 +132,9 @@ pub async fn atomic_rewrite_owned_no_symlink(
         }
         let (uid, gid) = (meta.uid(), meta.gid());
 
-        let mut tmp = tempfile::NamedTempFile::new_in(&parent)
+        let mut tmp = tempfile::Builder::new()
+            .prefix(&staging_prefix(&dest))
+            .tempfile_in(&parent)
             .with_context(|| format!("Failed to create temp file in {}", parent.display()))?;
         tmp.as_file_mut()
             .write_all(&payload)
@@ -204,7 +206,9 @@ async fn write_owned_impl(path: &Path, contents: &[u8], mode: u32, replace: bool
         }
         let (uid, gid) = (parent_meta.uid(), parent_meta.gid());
 
-        let mut tmp = tempfile::NamedTempFile::new_in(&parent)
+        let mut tmp = tempfile::Builder::new()
+            .prefix(&staging_prefix(&dest))
+            .tempfile_in(&parent)
             .with_context(|| format!("Failed to create temp file in {}", parent.display()))?;
         tmp.as_file_mut()
             .write_all(&payload)
@@ -252,6 +256,16 @@ async fn write_owned_impl(path: &Path, contents: &[u8], mode: u32, replace: bool
     .context("Owned credential write task panicked")?
 }
 
+/// Returns the prefix of the staging file for an atomic write of `dest`:
+/// `.<file name>.tmp.`, as [`cert_group::write_key_file`] names its
+/// staged files, so a leftover shows which file it was meant to replace.
+pub(crate) fn staging_prefix(dest: &Path) -> String {
+    let name = dest
+        .file_name()
+        .map_or_else(|| "bootroot".into(), |name| name.to_string_lossy());
+    format!(".{name}.tmp.")
+}
+
 /// Writes `contents` to `path` atomically by staging it in a sibling
 /// temp file and `rename(2)`ing into place.
 ///
@@ -292,7 +306,9 @@ pub async fn atomic_write(path: &Path, contents: &[u8], mode: u32) -> Result<()>
         // fresh create keeps process default ownership.
         let existing_owner = std::fs::metadata(&dest).ok().map(|m| (m.uid(), m.gid()));
 
-        let mut tmp = tempfile::NamedTempFile::new_in(&parent)
+        let mut tmp = tempfile::Builder::new()
+            .prefix(&staging_prefix(&dest))
+            .tempfile_in(&parent)
             .with_context(|| format!("Failed to create temp file in {}", parent.display()))?;
         tmp.as_file_mut()
             .write_all(&payload)
@@ -394,8 +410,8 @@ pub async fn set_key_permissions(path: &Path) -> Result<()> {
 pub async fn write_cert_and_key(
     cert_path: &Path,
     key_path: &Path,
-    cert_pem: &str,
-    key_pem: &str,
+    cert: impl AsRef<[u8]>,
+    key: impl AsRef<[u8]>,
     policy: CertGroupPolicy,
 ) -> Result<()> {
     let cert_dir = cert_path
@@ -408,12 +424,34 @@ pub async fn write_cert_and_key(
     cert_group::ensure_key_parent_dir(key_dir, policy).await?;
     cert_group::ensure_cert_parent_dir(cert_dir, key_dir, policy).await?;
 
-    cert_group::write_cert_file(cert_path, cert_pem, policy).await?;
-    cert_group::write_key_file(key_path, key_pem, policy).await?;
+    cert_group::write_cert_file(cert_path, cert, policy).await?;
+    cert_group::write_key_file(key_path, key, policy).await?;
 
     Ok(())
 }
 
+/// Writes a public certificate file with no accompanying key, such as
+/// the leaf of a PKCS#11-backed profile or a separate chain file.
+///
+/// The parent directory is treated as if it also held the key, so it
+/// gets the same mode [`write_cert_and_key`] would give a shared
+/// cert/key directory.
+///
+/// # Errors
+/// Returns an error if the directory cannot be created or the
+/// certificate cannot be written.
+pub async fn write_cert(
+    cert_path: &Path,
+    cert: impl AsRef<[u8]>,
+    policy: CertGroupPolicy,
+) -> Result<()> {
+    let cert_dir = cert_path
+        .parent()
+        .ok_or_else(|| anyhow::anyhow!("Cert path has no parent directory"))?;
+    cert_group::ensure_cert_parent_dir(cert_dir, cert_dir, policy).await?;
+    cert_group::write_cert_file(cert_path, cert, policy).await
+}
+
 /// Writes a CA bundle to disk, creating parent directories as needed.
 ///
 /// Always sets the mode to [`CA_BUNDLE_FILE_MODE`] (`0o644`),
@@ -777,6 +815,16 @@ mod tests {
         assert_eq!(entries[0], "agent.toml");
     }
 
+    #[test]
+    fn staging_prefix_is_derived_from_the_target_file_name() {
+        assert_eq!(
+            staging_prefix(Path::new("/etc/bootroot/tls.key")),
+            ".tls.key.tmp."
+        );
+        assert_eq!(staging_prefix(Path::new("agent.toml")), ".agent.toml.tmp.");
+        assert_eq!(staging_prefix(Path::new("/")), ".bootroot.tmp.");
+    }
+
     #[test]
     fn path_is_within_matches_component_boundaries() {
         assert!(path_is_within(Path::new("/a/b/c"), Path::new("/a/b")).unwrap());
@@ -1,6 +1,7 @@
 use std::process::Stdio;
 use std::time::Duration;
 
+use anyhow::Context as _;
 use tokio::io::AsyncReadExt;
 use tokio::process::Command;
 use tracing::{debug, error, info};
@@ -8,7 +9,8 @@ use tracing::{debug, error, info};
 use crate::config::{DaemonProfileSettings, HookCommand, HookFailurePolicy, Settings};
 use crate::utils;
 
-const DEFAULT_RETRY_LOG_LABEL: &str = "post_renew";
+const POST_RENEW_LABEL: &str = "post_renew";
+const PRE_RENEW_LABEL: &str = "pre_renew";
 const ENV_CERT_PATH: &str = "CERT_PATH";
 const ENV_KEY_PATH: &str = "KEY_PATH";
 const ENV_DOMAINS: &str = "DOMAINS";
@@ -16,19 +18,46 @@ const ENV_PRIMARY_DOMAIN: &str = "PRIMARY_DOMAIN";
 const ENV_RENEWED_AT: &str = "RENEWED_AT";
 const ENV_RENEW_STATUS: &str = "RENEW_STATUS";
 const ENV_RENEW_ERROR: &str = "RENEW_ERROR";
+const ENV_RENEW_SEVERITY: &str = "RENEW_SEVERITY";
 const ENV_SERVER_URL: &str = "ACME_SERVER_URL";
+const ENV_PHASE: &str = "BOOTROOT_PHASE";
+const ENV_RUN_ID: &str = "BOOTROOT_RUN_ID";
+const PHASE_PRE: &str = "pre";
+const PHASE_POST: &str = "post";
 
 #[derive(Debug, Clone, Copy)]
 pub(crate) enum HookStatus {
     Success,
-    Failure,
+    Failure(FailureSeverity),
 }
 
 impl HookStatus {
     fn as_str(self) -> &'static str {
         match self {
             HookStatus::Success => "success",
-            HookStatus::Failure => "failure",
+            HookStatus::Failure(_) => "failure",
+        }
+    }
+}
+
+/// How close to expiry a failed renewal leaves the certificate on disk.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum FailureSeverity {
+    /// More than `daemon.escalate_before` of validity is left.
+    Warning,
+    /// Within `daemon.escalate_before` of `NotAfter`, or no readable
+    /// certificate.
+    Critical,
+    /// The certificate has already expired.
+    Expired,
+}
+
+impl FailureSeverity {
+    pub(crate) fn as_str(self) -> &'static str {
+        match self {
+            FailureSeverity::Warning => "warning",
+            FailureSeverity::Critical => "critical",
+            FailureSeverity::Expired => "expired",
         }
     }
 }
@@ -45,7 +74,7 @@ pub(crate) async fn run_post_renew_hooks(
 ) -> anyhow::Result<()> {
     let hooks = match status {
         HookStatus::Success => &profile.hooks.post_renew.success,
-        HookStatus::Failure => &profile.hooks.post_renew.failure,
+        HookStatus::Failure(_) => &profile.hooks.post_renew.failure,
     };
 
     if hooks.is_empty() {
@@ -58,9 +87,10 @@ pub(crate) async fn run_post_renew_hooks(
         error_message,
         renewed_at,
     };
+    let envs = context.envs(settings, profile);
 
     for hook in hooks {
-        match run_hook_with_retry(hook, &context, settings, profile).await {
+        match run_hook_with_retry(hook, &envs, POST_RENEW_LABEL).await {
             Ok(()) => {}
             Err(err) => {
                 error!("Post-renew hook failed (command='{}'): {err}", hook.command);
@@ -74,6 +104,31 @@ pub(crate) async fn run_post_renew_hooks(
     Ok(())
 }
 
+/// Runs the profile's pre-renew hooks in order, right before an
+/// issuance is attempted.
+///
+/// # Errors
+/// Returns an error as soon as a hook fails, and the caller must skip
+/// the issuance. `on_failure` does not apply to pre-renew hooks.
+pub(crate) async fn run_pre_renew_hooks(
+    settings: &Settings,
+    profile: &DaemonProfileSettings,
+) -> anyhow::Result<()> {
+    let hooks = &profile.hooks.pre_renew;
+    if hooks.is_empty() {
+        return Ok(());
+    }
+
+    let mut envs = base_envs(settings, profile);
+    envs.push((ENV_PHASE, PHASE_PRE.to_string()));
+    for hook in hooks {
+        run_hook_with_retry(hook, &envs, PRE_RENEW_LABEL)
+            .await
+            .with_context(|| format!("Pre-renew hook failed (command='{}')", hook.command))?;
+    }
+    Ok(())
+}
+
 struct HookContext {
     status: HookStatus,
     error_message: Option<String>,
@@ -92,6 +147,10 @@ impl HookContext {
     }
 
     fn context_envs(&self) -> Vec<(&'static str, String)> {
+        let severity = match self.status {
+            HookStatus::Success => "",
+            HookStatus::Failure(severity) => severity.as_str(),
+        };
         vec![
             (
                 ENV_RENEWED_AT,
@@ -104,29 +163,34 @@ impl HookContext {
                 ENV_RENEW_ERROR,
                 self.error_message.clone().unwrap_or_default(),
             ),
+            (ENV_RENEW_SEVERITY, severity.to_string()),
+            (ENV_PHASE, PHASE_POST.to_string()),
         ]
     }
 }
 
 fn base_envs(settings: &Settings, profile: &DaemonProfileSettings) -> Vec<(&'static str, String)> {
     let primary_domain = crate::config::profile_domain(settings, profile);
-    vec![
+    let mut envs = vec![
         (ENV_CERT_PATH, profile.paths.cert.display().to_string()),
         (ENV_KEY_PATH, profile.paths.key.display().to_string()),
         (ENV_DOMAINS, primary_domain.clone()),
         (ENV_PRIMARY_DOMAIN, primary_domain),
         (ENV_SERVER_URL, settings.server.clone()),
-    ]
+    ];
+    if let Some(run_id) = crate::run_id::current() {
+        envs.push((ENV_RUN_ID, run_id));
+    }
+    envs
 }
 
 async fn run_hook_with_retry(
     hook: &HookCommand,
-    context: &HookContext,
-    settings: &Settings,
-    profile: &DaemonProfileSettings,
+    envs: &[(&'static str, String)],
+    label: &str,
 ) -> anyhow::Result<()> {
     utils::retry_with_backoff(&hook.retry_backoff_secs, |attempt, remaining| async move {
-        let result = run_hook_command(hook, context, settings, profile).await;
+        let result = run_hook_command(hook, envs, label).await;
         match result {
             Ok(()) => Ok(()),
             Err(err) => {
@@ -143,19 +207,15 @@ async fn run_hook_with_retry(
 
 async fn run_hook_command(
     hook: &HookCommand,
-    context: &HookContext,
-    settings: &Settings,
-    profile: &DaemonProfileSettings,
+    envs: &[(&'static str, String)],
+    label: &str,
 ) -> anyhow::Result<()> {
-    info!(
-        "Running post-renew hook ({}): {} {:?}",
-        DEFAULT_RETRY_LOG_LABEL, hook.command, hook.args
-    );
+    info!("Running {label} hook: {} {:?}", hook.command, hook.args);
 
     let mut command = Command::new(&hook.command);
     command
         .args(&hook.args)
-        .envs(context.envs(settings, profile))
+        .envs(envs.iter().map(|(key, value)| (*key, value)))
         .stdin(Stdio::null())
         .stdout(Stdio::piped())
         .stderr(Stdio::piped());
@@ -307,20 +367,26 @@ mod tests {
             paths: Paths {
                 cert: cert_path,
                 key: PathBuf::from(TEST_KEY_PATH),
+                chain: None,
+                pin: None,
             },
             daemon: DaemonRuntimeSettings {
                 check_interval: Duration::from_hours(1),
                 renew_before: Duration::from_hours(16),
+                renew_before_pct: None,
                 check_jitter: Duration::from_secs(0),
+                escalate_before: Duration::from_hours(4),
+                exit_on_expired: false,
+                renew_on_revoked: false,
+                verify_dns_before_renew: false,
             },
-            retry: None,
             hooks,
-            eab: None,
-            cert_group_gid: None,
+            ..DaemonProfileSettings::default()
         };
 
         let settings = Settings {
             email: "test@example.com".to_string(),
+            contacts: Vec::new(),
             server: TEST_SERVER_URL.to_string(),
             domain: TEST_DOMAIN.to_string(),
             eab: None,
@@ -330,10 +396,27 @@ mod tests {
                 directory_fetch_max_delay_secs: 10,
                 poll_attempts: 15,
                 poll_interval_secs: 2,
+                order_poll_interval_secs: None,
+                order_timeout_secs: None,
+                use_ari: false,
+                dns_resolver: None,
+                challenge: crate::config::ChallengeKind::Http01,
+                provisioner: None,
+                allow_insecure_http: false,
+                url_rewrites: Vec::new(),
+                purge_account_on_success: false,
+                trace_http: crate::config::HttpTrace::Off,
+                phase_timing: false,
+                check_sct: false,
+                require_eab: false,
+                require_tos: None,
+                account_key_path: None,
+                solver_command: None,
                 http_responder_url: "http://localhost:8080".to_string(),
                 http_responder_hmac: "dev-hmac".to_string(),
                 http_responder_timeout_secs: 5,
                 http_responder_token_ttl_secs: 300,
+                max_parallel_challenges: 1,
             },
             retry: RetrySettings {
                 backoff_secs: vec![1, 2, 3],
@@ -344,6 +427,10 @@ mod tests {
             },
             profiles: vec![profile.clone()],
             openbao: None,
+            status: crate::config::StatusSettings::default(),
+            dns01: crate::config::Dns01Settings::default(),
+            otel: crate::config::OtelSettings::default(),
+            reload: crate::config::ReloadSettings::default(),
         };
 
         (settings, profile)
@@ -370,6 +457,21 @@ mod tests {
 
         assert_eq!(domains, EXPECTED_DOMAIN);
         assert_eq!(primary_domain, EXPECTED_DOMAIN);
+        assert!(!envs.iter().any(|(key, _)| *key == ENV_RUN_ID));
+    }
+
+    #[tokio::test]
+    async fn test_hook_envs_carry_current_run_id() {
+        let dir = tempdir().unwrap();
+        let (settings, profile) =
+            build_settings(dir.path().join("cert.pem"), HookSettings::default());
+
+        let envs = crate::run_id::scope("run-7".to_string(), async {
+            super::base_envs(&settings, &profile)
+        })
+        .await;
+
+        assert!(envs.contains(&(ENV_RUN_ID, "run-7".to_string())));
     }
 
     #[tokio::test]
@@ -395,6 +497,7 @@ mod tests {
         };
 
         let hooks = HookSettings {
+            pre_renew: Vec::new(),
             post_renew: PostRenewHooks {
                 success: vec![hook],
                 failure: Vec::new(),
@@ -410,6 +513,64 @@ mod tests {
         assert_eq!(contents, "success");
     }
 
+    #[tokio::test]
+    async fn test_pre_renew_hook_sees_pre_phase() {
+        let dir = tempdir().unwrap();
+        let output_path = dir.path().join("hook.txt");
+        let cert_path = dir.path().join("cert.pem");
+
+        let hook = HookCommand {
+            command: "sh".to_string(),
+            args: vec![
+                "-c".to_string(),
+                format!(
+                    "printf \"%s %s\" \"$BOOTROOT_PHASE\" \"$PRIMARY_DOMAIN\" > \"{}\"",
+                    output_path.display()
+                ),
+            ],
+            working_dir: None,
+            timeout_secs: 5,
+            retry_backoff_secs: Vec::new(),
+            max_output_bytes: None,
+            on_failure: HookFailurePolicy::Continue,
+        };
+        let hooks = HookSettings {
+            pre_renew: vec![hook],
+            post_renew: PostRenewHooks::default(),
+        };
+
+        let (settings, profile) = build_settings(cert_path, hooks);
+        run_pre_renew_hooks(&settings, &profile).await.unwrap();
+
+        let contents = fs::read_to_string(output_path).unwrap();
+        assert_eq!(contents, format!("pre {EXPECTED_DOMAIN}"));
+    }
+
+    #[tokio::test]
+    async fn test_pre_renew_hook_failure_aborts_despite_continue_policy() {
+        let dir = tempdir().unwrap();
+        let cert_path = dir.path().join("cert.pem");
+
+        let hook = HookCommand {
+            command: "false".to_string(),
+            args: Vec::new(),
+            working_dir: None,
+            timeout_secs: 5,
+            retry_backoff_secs: Vec::new(),
+            max_output_bytes: None,
+            on_failure: HookFailurePolicy::Continue,
+        };
+        let hooks = HookSettings {
+            pre_renew: vec![hook],
+            post_renew: PostRenewHooks::default(),
+        };
+
+        let (settings, profile) = build_settings(cert_path, hooks);
+        let err = run_pre_renew_hooks(&settings, &profile).await.unwrap_err();
+
+        assert!(format!("{err:#}").contains("Pre-renew hook failed"));
+    }
+
     #[tokio::test]
     async fn test_post_renew_failure_hook_stop_propagates_error() {
         let dir = tempdir().unwrap();
@@ -426,6 +587,7 @@ mod tests {
         };
 
         let hooks = HookSettings {
+            pre_renew: Vec::new(),
             post_renew: PostRenewHooks {
                 success: Vec::new(),
                 failure: vec![hook],
@@ -436,7 +598,7 @@ mod tests {
         let err = run_post_renew_hooks(
             &settings,
             &profile,
-            HookStatus::Failure,
+            HookStatus::Failure(FailureSeverity::Warning),
             Some("boom".to_string()),
         )
         .await
@@ -461,6 +623,7 @@ mod tests {
         };
 
         let hooks = HookSettings {
+            pre_renew: Vec::new(),
             post_renew: PostRenewHooks {
                 success: Vec::new(),
                 failure: vec![hook],
@@ -471,7 +634,7 @@ mod tests {
         run_post_renew_hooks(
             &settings,
             &profile,
-            HookStatus::Failure,
+            HookStatus::Failure(FailureSeverity::Warning),
             Some("boom".to_string()),
         )
         .await
@@ -494,6 +657,7 @@ mod tests {
         };
 
         let hooks = HookSettings {
+            pre_renew: Vec::new(),
             post_renew: PostRenewHooks {
                 success: vec![hook],
                 failure: Vec::new(),
@@ -527,6 +691,7 @@ mod tests {
         };
 
         let hooks = HookSettings {
+            pre_renew: Vec::new(),
             post_renew: PostRenewHooks {
                 success: vec![hook],
                 failure: Vec::new(),
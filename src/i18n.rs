@@ -26,6 +26,8 @@ pub(crate) struct Strings {
     pub(crate) readiness_entry_with_health: &'static str,
     pub(crate) readiness_entry_without_health: &'static str,
     pub(crate) infra_unhealthy: &'static str,
+    pub(crate) infra_docker_retry: &'static str,
+    pub(crate) error_max_runtime_exceeded: &'static str,
     pub(crate) monitoring_up_completed: &'static str,
     pub(crate) monitoring_readiness_summary: &'static str,
     pub(crate) monitoring_unhealthy: &'static str,
@@ -55,6 +57,13 @@ pub(crate) struct Strings {
     pub(crate) warning_secret_id_ttl_exceeds_recommended: &'static str,
     pub(crate) error_secret_id_ttl_exceeds_max: &'static str,
     pub(crate) error_secret_id_ttl_invalid: &'static str,
+    pub(crate) error_existing_ca_invalid: &'static str,
+    pub(crate) error_offline_image_missing: &'static str,
+    pub(crate) error_stepca_root_fingerprint_mismatch: &'static str,
+    pub(crate) init_verify_running: &'static str,
+    pub(crate) init_verify_passed: &'static str,
+    pub(crate) error_init_verify_failed: &'static str,
+    pub(crate) error_init_verify_responder_missing: &'static str,
     pub(crate) error_rn_cidrs_invalid: &'static str,
     pub(crate) error_rn_cidrs_clear_conflict: &'static str,
     pub(crate) error_rn_cidrs_clear_on_add: &'static str,
@@ -136,6 +145,7 @@ pub(crate) struct Strings {
     pub(crate) error_db_auth_task_failed: &'static str,
     pub(crate) error_db_provision_task_failed: &'static str,
     pub(crate) error_stepca_password_missing: &'static str,
+    pub(crate) error_stepca_flags_need_new_ca: &'static str,
     pub(crate) error_openbao_client_create_failed: &'static str,
     pub(crate) error_openbao_health_check_failed: &'static str,
     pub(crate) error_openbao_init_status_failed: &'static str,
@@ -161,6 +171,7 @@ pub(crate) struct Strings {
     pub(crate) error_parse_container_mounts_failed: &'static str,
     pub(crate) error_command_run_failed: &'static str,
     pub(crate) error_command_failed_status: &'static str,
+    pub(crate) error_command_failed_output: &'static str,
     pub(crate) error_docker_compose_failed: &'static str,
     pub(crate) error_docker_command_failed: &'static str,
     pub(crate) error_bootroot_agent_run_failed: &'static str,
@@ -302,6 +313,8 @@ pub(crate) struct Strings {
     pub(crate) summary_eab_missing: &'static str,
     pub(crate) rotate_summary_title: &'static str,
     pub(crate) rotate_summary_stepca_password: &'static str,
+    pub(crate) rotate_summary_stepca_password_backup: &'static str,
+    pub(crate) rotate_summary_stepca_provisioner_key: &'static str,
     pub(crate) rotate_summary_restart_stepca: &'static str,
     pub(crate) rotate_summary_db_dsn: &'static str,
     pub(crate) rotate_summary_responder_config: &'static str,
@@ -488,6 +501,7 @@ pub(crate) struct Strings {
     pub(crate) error_http01_admin_override_binding_mismatch: &'static str,
     pub(crate) error_http01_admin_bind_tls_missing: &'static str,
     pub(crate) error_stepca_bind_requires_stepca: &'static str,
+    pub(crate) error_secrets_dir_not_directory: &'static str,
     pub(crate) error_stepca_bind_invalid_format: &'static str,
     pub(crate) error_stepca_bind_wildcard_required: &'static str,
     pub(crate) error_stepca_bind_ipv6_requires_brackets: &'static str,
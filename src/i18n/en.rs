@@ -6,6 +6,8 @@ pub(super) static STRINGS: Strings = Strings {
     readiness_entry_with_health: "- {service}: {status} (health: {health})",
     readiness_entry_without_health: "- {service}: {status}",
     infra_unhealthy: "Infrastructure not healthy: {failures}",
+    infra_docker_retry: "{context} hit a transient Docker error; retrying in {seconds}s (retry {attempt}/{retries})",
+    error_max_runtime_exceeded: "--max-runtime of {limit} ran out while waiting for {target}",
     monitoring_up_completed: "bootroot monitoring up: completed",
     monitoring_readiness_summary: "bootroot monitoring up: readiness summary",
     monitoring_unhealthy: "Monitoring not healthy: {failures}",
@@ -35,6 +37,13 @@ pub(super) static STRINGS: Strings = Strings {
     warning_secret_id_ttl_exceeds_recommended: "WARNING: --secret-id-ttl ({value}) exceeds the recommended threshold ({threshold}). Consider a shorter TTL for tighter credential rotation.",
     error_secret_id_ttl_exceeds_max: "--secret-id-ttl ({value}) exceeds the maximum allowed value ({max})",
     error_secret_id_ttl_invalid: "Invalid --secret-id-ttl value: {value}. Use a duration like \"24h\", \"30m\", or \"3600s\".",
+    error_existing_ca_invalid: "Existing CA material is invalid: {reason}",
+    error_offline_image_missing: "--offline: image {image} is not present locally. Load it first (`docker load -i <archive>`, or `docker pull {image}` on a connected host and transfer it), or pass --ca-image with a local image.",
+    error_stepca_root_fingerprint_mismatch: "step ca init reported root fingerprint {reported}, but {path} has fingerprint {actual}",
+    init_verify_running: "bootroot init --verify: issuing a test certificate for {domain}",
+    init_verify_passed: "bootroot init --verify: the CA issued a certificate for {domain}",
+    error_init_verify_failed: "bootroot init --verify failed: {reason}. Init itself completed; the CA, OpenBao state and written secrets were left in place.",
+    error_init_verify_responder_missing: "bootroot init --verify needs the HTTP-01 responder admin URL; pass --responder-url or add the responder to the compose file. Init itself completed.",
     error_rn_cidrs_invalid: "Invalid --rn-cidrs value: {value}. Use CIDR notation (e.g. \"10.0.0.0/24\", \"fd00::/64\").",
     error_rn_cidrs_clear_conflict: "\"clear\" cannot be combined with other --rn-cidrs values",
     error_rn_cidrs_clear_on_add: "\"clear\" is only valid for service update; omit --rn-cidrs to leave CIDR binding unset",
@@ -116,6 +125,7 @@ pub(super) static STRINGS: Strings = Strings {
     error_db_auth_task_failed: "DB auth check task failed",
     error_db_provision_task_failed: "DB provisioning task failed",
     error_stepca_password_missing: "step-ca password file not found at {value}",
+    error_stepca_flags_need_new_ca: "step-ca is already initialized in {secrets_dir}; {flags} only apply when a new CA is created. Drop them, or use `bootroot reinit` to start over",
     error_openbao_client_create_failed: "Failed to create OpenBao client",
     error_openbao_health_check_failed: "OpenBao health check failed",
     error_openbao_init_status_failed: "OpenBao init status check failed",
@@ -141,6 +151,7 @@ pub(super) static STRINGS: Strings = Strings {
     error_parse_container_mounts_failed: "Failed to parse container mounts",
     error_command_run_failed: "Failed to run {value}",
     error_command_failed_status: "{value} failed with status: {status}",
+    error_command_failed_output: "{value} failed with status: {status}\n{output}",
     error_docker_compose_failed: "docker compose failed: {value}",
     error_docker_command_failed: "docker command failed: {value}",
     error_bootroot_agent_run_failed: "Failed to run bootroot-agent",
@@ -291,6 +302,8 @@ pub(super) static STRINGS: Strings = Strings {
     summary_eab_missing: "- eab: not configured",
     rotate_summary_title: "bootroot rotate: summary",
     rotate_summary_stepca_password: "- step-ca password updated: {value}",
+    rotate_summary_stepca_password_backup: "- previous step-ca password saved: {value}",
+    rotate_summary_stepca_provisioner_key: "- JWK provisioner key re-encrypted: {value}",
     rotate_summary_restart_stepca: "- step-ca: restarted",
     rotate_summary_db_dsn: "- ca.json updated: {value}",
     rotate_summary_responder_config: "- responder config updated: {value}",
@@ -477,6 +490,7 @@ pub(super) static STRINGS: Strings = Strings {
     error_http01_admin_override_binding_mismatch: "HTTP-01 admin compose override port mapping does not match stored bind intent: expected {expected}, found {actual}; re-run infra install --http01-admin-bind to regenerate",
     error_http01_admin_bind_tls_missing: "HTTP-01 admin API requires TLS for non-loopback binding but TLS prerequisites are not met: {details}",
     error_stepca_bind_requires_stepca: "--stepca-bind requires the step-ca service in the compose file",
+    error_secrets_dir_not_directory: "--secrets-dir {value} exists and is not a directory",
     error_stepca_bind_invalid_format: "--stepca-bind must be a valid <IP>:<port> address",
     error_stepca_bind_wildcard_required: "--stepca-bind-wildcard is required when binding to 0.0.0.0 or [::]",
     error_stepca_bind_ipv6_requires_brackets: "--stepca-bind IPv6 addresses must be bracketed, e.g. [::1]:9000",
@@ -32,6 +32,31 @@ impl Messages {
         format_template(self.strings().infra_unhealthy, &[("failures", failures)])
     }
 
+    pub(crate) fn infra_docker_retry(
+        &self,
+        context: &str,
+        seconds: u64,
+        attempt: u32,
+        retries: u32,
+    ) -> String {
+        format_template(
+            self.strings().infra_docker_retry,
+            &[
+                ("context", context),
+                ("seconds", &seconds.to_string()),
+                ("attempt", &attempt.to_string()),
+                ("retries", &retries.to_string()),
+            ],
+        )
+    }
+
+    pub(crate) fn error_max_runtime_exceeded(&self, limit: &str, target: &str) -> String {
+        format_template(
+            self.strings().error_max_runtime_exceeded,
+            &[("limit", limit), ("target", target)],
+        )
+    }
+
     pub(crate) fn monitoring_up_completed(&self) -> &'static str {
         self.strings().monitoring_up_completed
     }
@@ -61,6 +61,51 @@ impl Messages {
         )
     }
 
+    pub(crate) fn error_offline_image_missing(&self, image: &str) -> String {
+        format_template(
+            self.strings().error_offline_image_missing,
+            &[("image", image)],
+        )
+    }
+
+    pub(crate) fn error_stepca_root_fingerprint_mismatch(
+        &self,
+        reported: &str,
+        path: &str,
+        actual: &str,
+    ) -> String {
+        format_template(
+            self.strings().error_stepca_root_fingerprint_mismatch,
+            &[("reported", reported), ("path", path), ("actual", actual)],
+        )
+    }
+
+    pub(crate) fn init_verify_running(&self, domain: &str) -> String {
+        format_template(self.strings().init_verify_running, &[("domain", domain)])
+    }
+
+    pub(crate) fn init_verify_passed(&self, domain: &str) -> String {
+        format_template(self.strings().init_verify_passed, &[("domain", domain)])
+    }
+
+    pub(crate) fn error_init_verify_failed(&self, reason: &str) -> String {
+        format_template(
+            self.strings().error_init_verify_failed,
+            &[("reason", reason)],
+        )
+    }
+
+    pub(crate) fn error_init_verify_responder_missing(&self) -> &'static str {
+        self.strings().error_init_verify_responder_missing
+    }
+
+    pub(crate) fn error_existing_ca_invalid(&self, reason: &str) -> String {
+        format_template(
+            self.strings().error_existing_ca_invalid,
+            &[("reason", reason)],
+        )
+    }
+
     pub(crate) fn error_rn_cidrs_invalid(&self, value: &str) -> String {
         format_template(self.strings().error_rn_cidrs_invalid, &[("value", value)])
     }
@@ -372,6 +417,13 @@ impl Messages {
         self.strings().error_stepca_bind_requires_stepca
     }
 
+    pub(crate) fn error_secrets_dir_not_directory(&self, value: &str) -> String {
+        format_template(
+            self.strings().error_secrets_dir_not_directory,
+            &[("value", value)],
+        )
+    }
+
     pub(crate) fn error_stepca_bind_invalid_format(&self) -> &'static str {
         self.strings().error_stepca_bind_invalid_format
     }
@@ -6,6 +6,8 @@ pub(super) static STRINGS: Strings = Strings {
     readiness_entry_with_health: "- {service}: {status} (health: {health})",
     readiness_entry_without_health: "- {service}: {status}",
     infra_unhealthy: "인프라가 정상 상태가 아님: {failures}",
+    infra_docker_retry: "{context} 실행 중 일시적인 Docker 오류 발생, {seconds}초 후 재시도 ({attempt}/{retries})",
+    error_max_runtime_exceeded: "{target}을(를) 기다리는 중 --max-runtime({limit})이 지났습니다",
     monitoring_up_completed: "bootroot 모니터링 기동: 완료",
     monitoring_readiness_summary: "bootroot 모니터링 기동: 준비 상태 요약",
     monitoring_unhealthy: "모니터링이 정상 상태가 아님: {failures}",
@@ -35,6 +37,13 @@ pub(super) static STRINGS: Strings = Strings {
     warning_secret_id_ttl_exceeds_recommended: "경고: --secret-id-ttl ({value})이(가) 권장 임계치({threshold})를 초과합니다. 더 짧은 TTL을 사용하면 자격 증명 회전이 더 촘촘해집니다.",
     error_secret_id_ttl_exceeds_max: "--secret-id-ttl ({value})이(가) 최대 허용 값({max})을 초과합니다",
     error_secret_id_ttl_invalid: "잘못된 --secret-id-ttl 값: {value}. \"24h\", \"30m\", \"3600s\" 등의 형식을 사용하세요.",
+    error_existing_ca_invalid: "기존 CA 자료가 올바르지 않습니다: {reason}",
+    error_offline_image_missing: "--offline: 이미지 {image}이(가) 로컬에 없습니다. 먼저 적재하거나(`docker load -i <archive>`, 또는 연결된 호스트에서 `docker pull {image}` 후 전송) 로컬 이미지를 --ca-image로 지정하세요.",
+    error_stepca_root_fingerprint_mismatch: "step ca init이 보고한 루트 지문은 {reported}이지만 {path}의 지문은 {actual}입니다",
+    init_verify_running: "bootroot init --verify: {domain}에 대한 테스트 인증서 발급 중",
+    init_verify_passed: "bootroot init --verify: CA가 {domain}에 대한 인증서를 발급했습니다",
+    error_init_verify_failed: "bootroot init --verify 실패: {reason}. init 자체는 완료되었으며 CA, OpenBao 상태, 저장된 시크릿은 그대로 유지됩니다.",
+    error_init_verify_responder_missing: "bootroot init --verify에는 HTTP-01 응답기 관리자 URL이 필요합니다. --responder-url을 지정하거나 compose 파일에 응답기를 추가하세요. init 자체는 완료되었습니다.",
     error_rn_cidrs_invalid: "잘못된 --rn-cidrs 값: {value}. CIDR 표기법을 사용하세요 (예: \"10.0.0.0/24\", \"fd00::/64\").",
     error_rn_cidrs_clear_conflict: "\"clear\"는 다른 --rn-cidrs 값과 함께 사용할 수 없습니다",
     error_rn_cidrs_clear_on_add: "\"clear\"는 서비스 업데이트에서만 유효합니다; CIDR 바인딩을 설정하지 않으려면 --rn-cidrs를 생략하세요",
@@ -116,6 +125,7 @@ pub(super) static STRINGS: Strings = Strings {
     error_db_auth_task_failed: "DB 인증 점검 작업 실패",
     error_db_provision_task_failed: "DB 프로비저닝 작업 실패",
     error_stepca_password_missing: "step-ca 비밀번호 파일을 찾을 수 없습니다: {value}",
+    error_stepca_flags_need_new_ca: "step-ca가 이미 {secrets_dir}에 초기화되어 있습니다. {flags}는 새 CA를 만들 때만 적용됩니다. 해당 옵션을 빼거나 `bootroot reinit`으로 처음부터 다시 시작하세요",
     error_openbao_client_create_failed: "OpenBao 클라이언트 생성 실패",
     error_openbao_health_check_failed: "OpenBao 헬스 체크 실패",
     error_openbao_init_status_failed: "OpenBao 초기화 상태 조회 실패",
@@ -141,6 +151,7 @@ pub(super) static STRINGS: Strings = Strings {
     error_parse_container_mounts_failed: "컨테이너 마운트 파싱 실패",
     error_command_run_failed: "{value} 실행 실패",
     error_command_failed_status: "{value} 실행 실패: {status}",
+    error_command_failed_output: "{value} 실행 실패: {status}\n{output}",
     error_docker_compose_failed: "docker compose 실패: {value}",
     error_docker_command_failed: "docker 명령 실패: {value}",
     error_bootroot_agent_run_failed: "bootroot-agent 실행 실패",
@@ -291,6 +302,8 @@ pub(super) static STRINGS: Strings = Strings {
     summary_eab_missing: "- EAB: 미설정",
     rotate_summary_title: "bootroot rotate: 요약",
     rotate_summary_stepca_password: "- step-ca 암호 갱신: {value}",
+    rotate_summary_stepca_password_backup: "- 이전 step-ca 암호 보관: {value}",
+    rotate_summary_stepca_provisioner_key: "- JWK 프로비저너 키 재암호화: {value}",
     rotate_summary_restart_stepca: "- step-ca: 재시작",
     rotate_summary_db_dsn: "- ca.json 갱신: {value}",
     rotate_summary_responder_config: "- responder 설정 갱신: {value}",
@@ -477,6 +490,7 @@ pub(super) static STRINGS: Strings = Strings {
     error_http01_admin_override_binding_mismatch: "HTTP-01 관리자 compose 오버라이드 포트 매핑이 저장된 바인딩 의도와 일치하지 않습니다: 예상 {expected}, 발견 {actual}; infra install --http01-admin-bind를 다시 실행하세요",
     error_http01_admin_bind_tls_missing: "비루프백 바인딩에는 HTTP-01 관리자 API에 TLS가 필요하지만 TLS 전제 조건이 충족되지 않았습니다: {details}",
     error_stepca_bind_requires_stepca: "--stepca-bind는 compose 파일에 step-ca 서비스가 필요합니다",
+    error_secrets_dir_not_directory: "--secrets-dir {value}이(가) 이미 있으며 디렉터리가 아닙니다",
     error_stepca_bind_invalid_format: "--stepca-bind는 유효한 <IP>:<port> 주소여야 합니다",
     error_stepca_bind_wildcard_required: "0.0.0.0 또는 [::]에 바인딩할 때 --stepca-bind-wildcard가 필요합니다",
     error_stepca_bind_ipv6_requires_brackets: "--stepca-bind IPv6 주소는 대괄호로 묶어야 합니다, 예: [::1]:9000",
@@ -12,6 +12,20 @@ impl Messages {
         )
     }
 
+    pub(crate) fn rotate_summary_stepca_password_backup(&self, value: &str) -> String {
+        format_template(
+            self.strings().rotate_summary_stepca_password_backup,
+            &[("value", value)],
+        )
+    }
+
+    pub(crate) fn rotate_summary_stepca_provisioner_key(&self, value: &str) -> String {
+        format_template(
+            self.strings().rotate_summary_stepca_provisioner_key,
+            &[("value", value)],
+        )
+    }
+
     pub(crate) fn rotate_summary_restart_stepca(&self) -> &'static str {
         self.strings().rotate_summary_restart_stepca
     }
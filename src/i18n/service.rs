@@ -236,6 +236,13 @@ impl Messages {
         )
     }
 
+    pub(crate) fn error_stepca_flags_need_new_ca(&self, secrets_dir: &str, flags: &str) -> String {
+        format_template(
+            self.strings().error_stepca_flags_need_new_ca,
+            &[("secrets_dir", secrets_dir), ("flags", flags)],
+        )
+    }
+
     pub(crate) fn error_openbao_client_create_failed(&self) -> &'static str {
         self.strings().error_openbao_client_create_failed
     }
@@ -345,6 +352,18 @@ impl Messages {
         )
     }
 
+    pub(crate) fn error_command_failed_output(
+        &self,
+        command: &str,
+        status: &str,
+        output: &str,
+    ) -> String {
+        format_template(
+            self.strings().error_command_failed_output,
+            &[("value", command), ("status", status), ("output", output)],
+        )
+    }
+
     pub(crate) fn error_docker_compose_failed(&self, stderr: &str) -> String {
         format_template(
             self.strings().error_docker_compose_failed,
@@ -1,8 +1,19 @@
 use std::net::IpAddr;
 
 const DNS_LABEL_MAX_LEN: usize = 63;
+const EMAIL_LOCAL_PART_MAX_LEN: usize = 64;
+const EMAIL_ATEXT_SPECIALS: &str = "!#$%&'*+/=?^_`{|}~-";
+const MAILTO_PREFIX: &str = "mailto:";
+const TEL_PREFIX: &str = "tel:";
+const HTTPS_PREFIX: &str = "https://";
+/// Visual separators RFC 3966 allows between the digits of a global
+/// `tel:` number.
+const TEL_SEPARATORS: &str = "-.()";
 const IPV4_MAX_PREFIX: u8 = 32;
 const IPV6_MAX_PREFIX: u8 = 128;
+/// Characters that would end the host part when a name is parsed as a
+/// URL authority for IDNA processing.
+const URL_HOST_DELIMITERS: &str = "/\\?#@:[]%";
 
 #[derive(Debug, Clone, Copy, PartialEq, Eq)]
 pub enum ValidationError {
@@ -12,6 +23,8 @@ pub enum ValidationError {
     InvalidCidr,
     CidrClearConflict,
     NonNumeric,
+    InvalidEmail,
+    InvalidContact,
 }
 
 /// Validates a DNS label used for service names and hostnames.
@@ -45,6 +58,40 @@ pub fn validate_domain_name(value: &str) -> Result<(), ValidationError> {
     Ok(())
 }
 
+/// Converts a domain name to ASCII, encoding Unicode labels as IDNA
+/// A-labels (UTS #46 processing, as browsers do).
+///
+/// ASCII input is returned unchanged. `münchen.de` becomes
+/// `xn--mnchen-3ya.de`.
+///
+/// # Errors
+/// Returns an error when the name is empty, fails IDNA processing, or
+/// does not convert to a valid DNS name.
+pub fn domain_to_ascii(value: &str) -> Result<String, ValidationError> {
+    if value.is_empty() {
+        return Err(ValidationError::Empty);
+    }
+    if value.is_ascii() {
+        return Ok(value.to_string());
+    }
+    if value
+        .chars()
+        .any(|ch| ch.is_whitespace() || URL_HOST_DELIMITERS.contains(ch))
+    {
+        return Err(ValidationError::InvalidDomainName);
+    }
+    // The URL host parser applies the same IDNA mapping and validation
+    // as `url::Url`, without another direct dependency.
+    let url = reqwest::Url::parse(&format!("http://{value}/"))
+        .map_err(|_| ValidationError::InvalidDomainName)?;
+    let ascii = url
+        .domain()
+        .ok_or(ValidationError::InvalidDomainName)?
+        .to_string();
+    validate_domain_name(&ascii)?;
+    Ok(ascii)
+}
+
 /// Validates a numeric instance identifier.
 ///
 /// # Errors
@@ -59,6 +106,92 @@ pub fn validate_numeric_instance_id(value: &str) -> Result<(), ValidationError>
     Ok(())
 }
 
+/// Validates an ACME account contact email address.
+///
+/// Accepts an optional `mailto:` prefix. The local part must be a
+/// dot-atom (RFC 5322 without quoting) and the domain a valid DNS name.
+///
+/// # Errors
+/// Returns an error when the value is empty or not a syntactically valid
+/// address.
+pub fn validate_email(value: &str) -> Result<(), ValidationError> {
+    let address = value.strip_prefix(MAILTO_PREFIX).unwrap_or(value);
+    if address.is_empty() {
+        return Err(ValidationError::Empty);
+    }
+    let Some((local, domain)) = address.rsplit_once('@') else {
+        return Err(ValidationError::InvalidEmail);
+    };
+    if !is_dot_atom(local) || local.len() > EMAIL_LOCAL_PART_MAX_LEN {
+        return Err(ValidationError::InvalidEmail);
+    }
+    validate_domain_name(domain).map_err(|_| ValidationError::InvalidEmail)
+}
+
+/// Validates an ACME account contact URI.
+///
+/// RFC 8555 only requires CAs to support `mailto:`, so the accepted
+/// schemes are kept to those CAs commonly take: `mailto:` with a single
+/// address and no header fields (RFC 8555 §7.3), a global `tel:` number,
+/// and an `https://` URL.
+///
+/// # Errors
+/// Returns an error when the value is empty, uses another scheme, or is
+/// malformed for its scheme.
+pub fn validate_acme_contact(value: &str) -> Result<(), ValidationError> {
+    if value.is_empty() {
+        return Err(ValidationError::Empty);
+    }
+    if let Some(address) = value.strip_prefix(MAILTO_PREFIX) {
+        if address.contains(['?', ',']) {
+            return Err(ValidationError::InvalidContact);
+        }
+        return validate_email(address).map_err(|_| ValidationError::InvalidContact);
+    }
+    if let Some(number) = value.strip_prefix(TEL_PREFIX) {
+        let Some(digits) = number.strip_prefix('+') else {
+            return Err(ValidationError::InvalidContact);
+        };
+        if !digits.chars().any(|ch| ch.is_ascii_digit())
+            || !digits
+                .chars()
+                .all(|ch| ch.is_ascii_digit() || TEL_SEPARATORS.contains(ch))
+        {
+            return Err(ValidationError::InvalidContact);
+        }
+        return Ok(());
+    }
+    if value.starts_with(HTTPS_PREFIX) {
+        let url = reqwest::Url::parse(value).map_err(|_| ValidationError::InvalidContact)?;
+        if url.host_str().is_none_or(str::is_empty) {
+            return Err(ValidationError::InvalidContact);
+        }
+        return Ok(());
+    }
+    Err(ValidationError::InvalidContact)
+}
+
+/// Splits a comma-separated contact list into validated addresses.
+///
+/// A blank value yields an empty list, for CAs that accept accounts
+/// without a contact.
+///
+/// # Errors
+/// Returns an error when any entry is blank or not a valid address.
+pub fn parse_email_list(value: &str) -> Result<Vec<String>, ValidationError> {
+    if value.trim().is_empty() {
+        return Ok(Vec::new());
+    }
+    value
+        .split(',')
+        .map(|entry| {
+            let entry = entry.trim();
+            validate_email(entry)?;
+            Ok(entry.to_string())
+        })
+        .collect()
+}
+
 /// Validates a single CIDR notation string (e.g. `10.0.0.0/24`, `fd00::/64`).
 ///
 /// # Errors
@@ -103,6 +236,16 @@ pub fn validate_cidr_list(values: &[String]) -> Result<(), ValidationError> {
     Ok(())
 }
 
+fn is_dot_atom(value: &str) -> bool {
+    !value.is_empty()
+        && value.split('.').all(|atom| {
+            !atom.is_empty()
+                && atom
+                    .chars()
+                    .all(|ch| ch.is_ascii_alphanumeric() || EMAIL_ATEXT_SPECIALS.contains(ch))
+        })
+}
+
 fn is_dns_label(value: &str) -> bool {
     if !value.is_ascii() || value.len() > DNS_LABEL_MAX_LEN {
         return false;
@@ -125,6 +268,44 @@ fn is_dns_label(value: &str) -> bool {
 mod tests {
     use super::*;
 
+    #[test]
+    fn domain_to_ascii_converts_unicode_labels() {
+        assert_eq!(
+            domain_to_ascii("münchen.de").as_deref(),
+            Ok("xn--mnchen-3ya.de")
+        );
+        assert_eq!(
+            domain_to_ascii("edge.Bücher.example").as_deref(),
+            Ok("edge.xn--bcher-kva.example")
+        );
+    }
+
+    #[test]
+    fn domain_to_ascii_keeps_ascii_names() {
+        for value in ["trusted.domain", "Edge-Node-01", "xn--mnchen-3ya.de"] {
+            assert_eq!(domain_to_ascii(value).as_deref(), Ok(value));
+        }
+    }
+
+    #[test]
+    fn domain_to_ascii_rejects_invalid_names() {
+        assert_eq!(domain_to_ascii(""), Err(ValidationError::Empty));
+        for value in [
+            "münchen.de/path",
+            "mün chen.de",
+            "user@münchen.de",
+            // Full-width digits map to an IPv4 address, not a domain.
+            "1.2.3.\u{ff14}",
+            "münchen_de.example",
+        ] {
+            assert_eq!(
+                domain_to_ascii(value),
+                Err(ValidationError::InvalidDomainName),
+                "{value}"
+            );
+        }
+    }
+
     #[test]
     fn validate_dns_label_accepts_ascii_label() {
         assert_eq!(validate_dns_label("edge-proxy"), Ok(()));
@@ -196,6 +377,106 @@ mod tests {
         );
     }
 
+    #[test]
+    fn validate_email_accepts_common_addresses() {
+        for value in [
+            "admin@example.com",
+            "ops+certs@trusted.domain",
+            "first.last@EXAMPLE.internal",
+            "mailto:admin@example.com",
+        ] {
+            assert_eq!(validate_email(value), Ok(()), "{value}");
+        }
+    }
+
+    #[test]
+    fn validate_email_rejects_malformed_addresses() {
+        assert_eq!(validate_email(""), Err(ValidationError::Empty));
+        assert_eq!(validate_email("mailto:"), Err(ValidationError::Empty));
+        for value in [
+            "admin",
+            "@example.com",
+            "admin@",
+            "admin@@example.com",
+            "ad min@example.com",
+            ".admin@example.com",
+            "ad..min@example.com",
+            "admin@exa_mple.com",
+            "admin@example..com",
+            "<admin@example.com>",
+        ] {
+            assert_eq!(
+                validate_email(value),
+                Err(ValidationError::InvalidEmail),
+                "{value}"
+            );
+        }
+    }
+
+    #[test]
+    fn parse_email_list_splits_and_trims_entries() {
+        assert_eq!(
+            parse_email_list("ops@example.com, security@example.com"),
+            Ok(vec![
+                "ops@example.com".to_string(),
+                "security@example.com".to_string()
+            ])
+        );
+    }
+
+    #[test]
+    fn parse_email_list_allows_blank_value() {
+        assert_eq!(parse_email_list(""), Ok(Vec::new()));
+        assert_eq!(parse_email_list("  "), Ok(Vec::new()));
+    }
+
+    #[test]
+    fn parse_email_list_rejects_blank_or_invalid_entry() {
+        assert_eq!(
+            parse_email_list("ops@example.com,,security@example.com"),
+            Err(ValidationError::Empty)
+        );
+        assert_eq!(
+            parse_email_list("ops@example.com, not-an-email"),
+            Err(ValidationError::InvalidEmail)
+        );
+    }
+
+    #[test]
+    fn validate_acme_contact_accepts_supported_schemes() {
+        for contact in [
+            "mailto:ops@example.com",
+            "tel:+82-2-555-0100",
+            "tel:+1(555)0100",
+            "https://alerts.example.com/acme",
+        ] {
+            assert_eq!(validate_acme_contact(contact), Ok(()), "{contact}");
+        }
+    }
+
+    #[test]
+    fn validate_acme_contact_rejects_malformed_or_unsupported() {
+        assert_eq!(validate_acme_contact(""), Err(ValidationError::Empty));
+        for contact in [
+            "ops@example.com",
+            "mailto:not-an-email",
+            "mailto:ops@example.com?subject=acme",
+            "mailto:ops@example.com,security@example.com",
+            "tel:555-0100",
+            "tel:+",
+            "tel:+82 2 555 0100",
+            "http://alerts.example.com/acme",
+            "https://",
+            "xmpp:ops@example.com",
+        ] {
+            assert_eq!(
+                validate_acme_contact(contact),
+                Err(ValidationError::InvalidContact),
+                "{contact}"
+            );
+        }
+    }
+
     #[test]
     fn validate_cidr_accepts_valid_ipv4() {
         assert_eq!(validate_cidr("10.0.0.0/24"), Ok(()));
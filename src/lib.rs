@@ -4,6 +4,7 @@ use std::sync::Arc;
 pub mod acme;
 pub mod agent_args;
 pub mod cert_chain;
+pub mod cert_expiry;
 pub mod cert_group;
 pub mod config;
 pub mod db;
@@ -11,22 +12,41 @@ pub mod eab;
 pub mod fs_util;
 pub mod hooks;
 pub mod input_validation;
+pub mod key_delivery;
 pub mod kv_payload;
 pub mod locale;
 pub mod openbao;
 pub mod profile;
+pub mod run_id;
+pub mod run_result;
+pub mod ssh_cert;
+pub mod systemd;
 pub mod tls;
 pub mod toml_util;
 pub mod trust_bootstrap;
+pub mod trust_tofu;
 pub mod utils;
 
+mod cert_metadata;
 mod daemon;
+mod der;
+mod dns;
 mod fast_poll;
+mod otel;
+mod pkcs11;
+mod reload;
+mod serve;
+mod staple_test;
+mod status;
 
 pub use agent_args::Args;
+pub use daemon::DaemonControl;
 
 /// Runs the agent daemon loop for all profiles.
 ///
+/// `control` lets the caller stop the daemon gracefully, e.g. to reload
+/// configuration on SIGHUP.
+///
 /// # Errors
 /// Returns an error if issuance or shutdown handling fails.
 pub async fn run_daemon(
@@ -36,6 +56,7 @@ pub async fn run_daemon(
     config_path: Option<PathBuf>,
     insecure_mode: bool,
     cli_overrides: config::CliOverrides,
+    control: DaemonControl,
 ) -> anyhow::Result<()> {
     daemon::run_daemon(
         settings,
@@ -44,6 +65,7 @@ pub async fn run_daemon(
         config_path,
         insecure_mode,
         cli_overrides,
+        control,
     )
     .await
 }
@@ -58,5 +80,94 @@ pub async fn run_oneshot(
     config_path: Option<PathBuf>,
     insecure_mode: bool,
 ) -> anyhow::Result<()> {
-    daemon::run_oneshot(settings, default_eab, config_path, insecure_mode).await
+    daemon::run_oneshot(settings, default_eab, config_path, insecure_mode, None).await
+}
+
+/// Runs a single issuance pass for all profiles like [`run_oneshot`] and
+/// reports what happened to each profile. A failed run, including one
+/// that runs out of `budget` (`--max-runtime`), is reported in the
+/// result rather than returned.
+pub async fn run_oneshot_with_result(
+    settings: Arc<config::Settings>,
+    default_eab: Option<eab::EabCredentials>,
+    config_path: Option<PathBuf>,
+    budget: Option<acme::RunBudget>,
+    insecure_mode: bool,
+) -> run_result::RunResult {
+    let recorder = Arc::new(run_result::Recorder::new());
+    let outcome = acme::within_budget(
+        budget,
+        daemon::run_oneshot(
+            Arc::clone(&settings),
+            default_eab,
+            config_path,
+            insecure_mode,
+            Some(Arc::clone(&recorder)),
+        ),
+    )
+    .await;
+    recorder.finish(&settings, &outcome)
+}
+
+/// Renews every agent-managed certificate found under `root` and exits,
+/// starting at most `renew_rate` renewals per minute when set. With
+/// `cleanup_on_failure` (`--cleanup-on-failure`), every renewal removes
+/// the files it created when writing them fails.
+///
+/// # Errors
+/// Returns an error if the directory cannot be scanned or any managed
+/// certificate fails to renew.
+pub async fn run_renew_dir(
+    settings: Arc<config::Settings>,
+    default_eab: Option<eab::EabCredentials>,
+    root: &std::path::Path,
+    renew_rate: Option<u32>,
+    cleanup_on_failure: bool,
+    insecure_mode: bool,
+) -> anyhow::Result<()> {
+    daemon::run_renew_dir(
+        settings,
+        default_eab,
+        root,
+        renew_rate,
+        cleanup_on_failure,
+        insecure_mode,
+    )
+    .await
+}
+
+/// Serves the on-demand `POST /issue` API on `listen_addr` until Ctrl-C.
+///
+/// # Errors
+/// Returns an error if the address or token is invalid or the listener
+/// fails.
+pub async fn run_serve(
+    settings: Arc<config::Settings>,
+    default_eab: Option<eab::EabCredentials>,
+    listen_addr: &str,
+    api_token_file: Option<&std::path::Path>,
+    insecure_mode: bool,
+) -> anyhow::Result<()> {
+    serve::run_serve(
+        settings,
+        default_eab,
+        listen_addr,
+        api_token_file,
+        insecure_mode,
+    )
+    .await
+}
+
+/// Serves the first profile's certificate over TLS on `listen_addr`
+/// with a freshly fetched OCSP response stapled, until Ctrl-C.
+///
+/// # Errors
+/// Returns an error if the certificate cannot be loaded, no OCSP
+/// response can be fetched, or the listener fails.
+pub async fn run_staple_test(
+    settings: &config::Settings,
+    listen_addr: &str,
+    insecure_mode: bool,
+) -> anyhow::Result<()> {
+    staple_test::run_staple_test(settings, listen_addr, insecure_mode).await
 }
@@ -30,6 +30,10 @@ fn main() -> ExitCode {
             return ExitCode::from(1);
         }
     };
+    commands::infra::set_docker_retries(cli.docker_retries);
+    if let Some(max_runtime) = cli.max_runtime {
+        commands::infra::set_max_runtime(max_runtime);
+    }
     match run(cli, &messages) {
         Ok(code) => code,
         Err(err) => {
@@ -151,9 +155,12 @@ fn run(cli: Cli, messages: &Messages) -> Result<ExitCode> {
                 .with_context(|| "ca update failed".to_string())?;
         }
         CliCommand::Ca(CaCommand::Restart(args)) => {
-            commands::ca::run_ca_restart(&args, messages)
-                .with_context(|| "ca restart failed".to_string())?;
+            with_runtime("ca restart", messages, |rt| {
+                rt.block_on(commands::ca::run_ca_restart(&args, messages))
+            })?
+            .with_context(|| "ca restart failed".to_string())?;
         }
+        CliCommand::Version => println!("bootroot {}", env!("CARGO_PKG_VERSION")),
     }
     Ok(ExitCode::SUCCESS)
 }
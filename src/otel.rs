@@ -0,0 +1,323 @@
+//! OpenTelemetry trace export for certificate issuance.
+//!
+//! When `otel.endpoint` (or `--otel-endpoint`) is set, every issuance
+//! becomes one trace: a root `acme.issue_certificate` span carrying the
+//! domain and profile attributes, with one child span per ACME phase
+//! recorded by [`crate::acme::timing`]. The trace is posted to the
+//! collector as OTLP/HTTP JSON once the issuance finishes, and the ACME
+//! client sends a W3C `traceparent` header so CA-side traces can be
+//! correlated. With no endpoint configured nothing here runs.
+
+use std::fmt::Write as _;
+use std::time::{Duration, SystemTime};
+
+use anyhow::{Context, Result};
+use reqwest::{Client, Url};
+use ring::rand::{SecureRandom, SystemRandom};
+use serde_json::{Value, json};
+use tracing::{debug, warn};
+
+use crate::acme::timing::PhaseTimings;
+use crate::config::{self, TrustSettings};
+
+const TRACES_PATH: &str = "/v1/traces";
+const EXPORT_TIMEOUT_SECS: u64 = 5;
+const SERVICE_NAME: &str = "bootroot-agent";
+const SCOPE_NAME: &str = "bootroot";
+const ROOT_SPAN_NAME: &str = "acme.issue_certificate";
+const SPAN_NAME_PREFIX: &str = "acme.";
+/// OTLP `SpanKind` values (`SPAN_KIND_INTERNAL`).
+const SPAN_KIND_INTERNAL: u8 = 1;
+/// OTLP `StatusCode` values (`STATUS_CODE_OK`, `STATUS_CODE_ERROR`).
+const STATUS_CODE_OK: u8 = 1;
+const STATUS_CODE_ERROR: u8 = 2;
+const TRACE_ID_LEN: usize = 16;
+const SPAN_ID_LEN: usize = 8;
+/// W3C trace-context version and "sampled" flag.
+const TRACEPARENT_VERSION: &str = "00";
+const TRACEPARENT_SAMPLED: &str = "01";
+
+/// One issuance trace, started before the ACME flow and exported after.
+pub(crate) struct IssuanceTrace {
+    traces_url: Url,
+    trace_id: [u8; TRACE_ID_LEN],
+    root_span_id: [u8; SPAN_ID_LEN],
+    start: SystemTime,
+    attributes: Vec<(&'static str, String)>,
+}
+
+impl IssuanceTrace {
+    /// Starts a trace for one issuance of `profile`, or returns `None`
+    /// when no OTLP endpoint is configured.
+    ///
+    /// # Errors
+    /// Returns an error if the endpoint is not a valid URL, the profile's
+    /// directory URL cannot be derived, or random trace IDs cannot be
+    /// generated.
+    pub(crate) fn start(
+        settings: &config::Settings,
+        profile: &config::DaemonProfileSettings,
+    ) -> Result<Option<Self>> {
+        let Some(endpoint) = settings.otel.endpoint.as_deref() else {
+            return Ok(None);
+        };
+        let rng = SystemRandom::new();
+        let mut attributes = vec![
+            ("bootroot.domain", config::profile_domain(settings, profile)),
+            ("bootroot.service_name", profile.service_name.clone()),
+            ("bootroot.instance_id", profile.instance_id.clone()),
+            ("bootroot.hostname", profile.hostname.clone()),
+            (
+                "acme.directory_url",
+                config::profile_directory_url(settings, profile)?,
+            ),
+        ];
+        if let Some(run_id) = crate::run_id::current() {
+            attributes.push(("bootroot.run_id", run_id));
+        }
+        Ok(Some(Self {
+            traces_url: traces_url(endpoint)?,
+            trace_id: random_id(&rng)?,
+            root_span_id: random_id(&rng)?,
+            start: SystemTime::now(),
+            attributes,
+        }))
+    }
+
+    /// Returns the W3C `traceparent` header value for requests made
+    /// inside this trace.
+    pub(crate) fn traceparent(&self) -> String {
+        format!(
+            "{TRACEPARENT_VERSION}-{}-{}-{TRACEPARENT_SAMPLED}",
+            hex(&self.trace_id),
+            hex(&self.root_span_id)
+        )
+    }
+
+    /// Posts the finished trace to the collector. Export problems are
+    /// logged and never fail the issuance.
+    pub(crate) async fn export<T>(self, timings: &PhaseTimings, result: &Result<T>) {
+        let body = match self.build_request(timings, result, SystemTime::now()) {
+            Ok(body) => body,
+            Err(err) => {
+                warn!("OpenTelemetry trace not exported: {err:#}");
+                return;
+            }
+        };
+        match send(&self.traces_url, &body).await {
+            Ok(()) => debug!("Exported issuance trace to {}", self.traces_url),
+            Err(err) => warn!(
+                "OpenTelemetry trace export to {} failed: {err:#}",
+                self.traces_url
+            ),
+        }
+    }
+
+    fn build_request<T>(
+        &self,
+        timings: &PhaseTimings,
+        result: &Result<T>,
+        end: SystemTime,
+    ) -> Result<Value> {
+        let rng = SystemRandom::new();
+        let trace_id = hex(&self.trace_id);
+        let root_span_id = hex(&self.root_span_id);
+        let attributes = self
+            .attributes
+            .iter()
+            .map(|(key, value)| string_attribute(key, value))
+            .collect::<Vec<_>>();
+        let status = match result {
+            Ok(_) => json!({ "code": STATUS_CODE_OK }),
+            Err(err) => json!({ "code": STATUS_CODE_ERROR, "message": format!("{err:#}") }),
+        };
+
+        let mut spans = vec![json!({
+            "traceId": trace_id,
+            "spanId": root_span_id,
+            "name": ROOT_SPAN_NAME,
+            "kind": SPAN_KIND_INTERNAL,
+            "startTimeUnixNano": unix_nanos(self.start),
+            "endTimeUnixNano": unix_nanos(end),
+            "attributes": attributes.clone(),
+            "status": status,
+        })];
+        for span in timings.spans.iter().flatten() {
+            spans.push(json!({
+                "traceId": trace_id,
+                "spanId": hex(&random_id::<SPAN_ID_LEN>(&rng)?),
+                "parentSpanId": root_span_id,
+                "name": format!("{SPAN_NAME_PREFIX}{}", span.phase.label()),
+                "kind": SPAN_KIND_INTERNAL,
+                "startTimeUnixNano": unix_nanos(span.start),
+                "endTimeUnixNano": unix_nanos(span.end),
+                "attributes": attributes.clone(),
+                "status": { "code": STATUS_CODE_OK },
+            }));
+        }
+
+        Ok(json!({
+            "resourceSpans": [{
+                "resource": {
+                    "attributes": [string_attribute("service.name", SERVICE_NAME)],
+                },
+                "scopeSpans": [{
+                    "scope": { "name": SCOPE_NAME, "version": env!("CARGO_PKG_VERSION") },
+                    "spans": spans,
+                }],
+            }],
+        }))
+    }
+}
+
+/// Resolves the OTLP/HTTP traces URL for `endpoint`. A collector base
+/// URL such as `http://collector:4318` gets `/v1/traces` appended; a URL
+/// that already ends in `/v1/traces` is used as is.
+///
+/// # Errors
+/// Returns an error if `endpoint` is not an `http://` or `https://` URL.
+pub(crate) fn traces_url(endpoint: &str) -> Result<Url> {
+    let mut url = Url::parse(endpoint.trim())
+        .with_context(|| format!("otel.endpoint is not a valid URL: {endpoint}"))?;
+    if !matches!(url.scheme(), "http" | "https") {
+        anyhow::bail!("otel.endpoint must be an http:// or https:// URL, got {endpoint}");
+    }
+    let base = url.path().trim_end_matches('/').to_string();
+    if !base.ends_with(TRACES_PATH) {
+        url.set_path(&format!("{base}{TRACES_PATH}"));
+    }
+    Ok(url)
+}
+
+async fn send(url: &Url, body: &Value) -> Result<()> {
+    let builder = Client::builder().timeout(Duration::from_secs(EXPORT_TIMEOUT_SECS));
+    let client = crate::tls::build_http_client_with(builder, &TrustSettings::default(), false)?;
+    let response = client.post(url.clone()).json(body).send().await?;
+    if !response.status().is_success() {
+        anyhow::bail!("collector returned {}", response.status());
+    }
+    Ok(())
+}
+
+fn random_id<const N: usize>(rng: &SystemRandom) -> Result<[u8; N]> {
+    let mut id = [0u8; N];
+    rng.fill(&mut id)
+        .map_err(|_| anyhow::anyhow!("Failed to generate trace ID"))?;
+    Ok(id)
+}
+
+fn string_attribute(key: &str, value: &str) -> Value {
+    json!({ "key": key, "value": { "stringValue": value } })
+}
+
+/// OTLP JSON encodes 64-bit nanosecond timestamps as strings.
+fn unix_nanos(at: SystemTime) -> String {
+    at.duration_since(SystemTime::UNIX_EPOCH)
+        .map_or(0, |since| since.as_nanos())
+        .to_string()
+}
+
+fn hex(bytes: &[u8]) -> String {
+    bytes.iter().fold(String::new(), |mut hex, byte| {
+        let _ = write!(hex, "{byte:02x}");
+        hex
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use std::time::Instant;
+
+    use wiremock::matchers::{method, path};
+    use wiremock::{Mock, MockServer, ResponseTemplate};
+
+    use super::*;
+    use crate::acme::timing::Phase;
+
+    fn test_trace(traces_url: Url) -> IssuanceTrace {
+        IssuanceTrace {
+            traces_url,
+            trace_id: [0x11; TRACE_ID_LEN],
+            root_span_id: [0x22; SPAN_ID_LEN],
+            start: SystemTime::UNIX_EPOCH + Duration::from_secs(1_700_000_000),
+            attributes: vec![("bootroot.domain", "001.edge.trusted.domain".to_string())],
+        }
+    }
+
+    #[test]
+    fn test_traces_url_appends_otlp_path() {
+        assert_eq!(
+            traces_url("http://collector:4318").unwrap().as_str(),
+            "http://collector:4318/v1/traces"
+        );
+        assert_eq!(
+            traces_url("https://collector/otlp/").unwrap().as_str(),
+            "https://collector/otlp/v1/traces"
+        );
+        assert_eq!(
+            traces_url("http://collector:4318/v1/traces")
+                .unwrap()
+                .as_str(),
+            "http://collector:4318/v1/traces"
+        );
+    }
+
+    #[test]
+    fn test_traces_url_rejects_non_http_scheme() {
+        assert!(traces_url("grpc://collector:4317").is_err());
+        assert!(traces_url("collector:4318").is_err());
+    }
+
+    #[test]
+    fn test_traceparent_uses_w3c_format() {
+        let trace = test_trace(traces_url("http://collector:4318").unwrap());
+
+        assert_eq!(
+            trace.traceparent(),
+            "00-11111111111111111111111111111111-2222222222222222-01"
+        );
+    }
+
+    #[test]
+    fn test_build_request_nests_phase_spans_under_root() {
+        let trace = test_trace(traces_url("http://collector:4318").unwrap());
+        let mut timings = PhaseTimings::with_spans();
+        timings.record(Phase::Register, Instant::now());
+        timings.record(Phase::Challenge, Instant::now());
+
+        let body = trace
+            .build_request(
+                &timings,
+                &Err::<(), _>(anyhow::anyhow!("boom")),
+                SystemTime::now(),
+            )
+            .unwrap();
+
+        let spans = body["resourceSpans"][0]["scopeSpans"][0]["spans"]
+            .as_array()
+            .unwrap();
+        assert_eq!(spans.len(), 3);
+        assert_eq!(spans[0]["name"], json!(ROOT_SPAN_NAME));
+        assert_eq!(spans[0]["startTimeUnixNano"], json!("1700000000000000000"));
+        assert_eq!(spans[0]["status"]["code"], json!(STATUS_CODE_ERROR));
+        assert_eq!(spans[0]["attributes"][0]["key"], json!("bootroot.domain"));
+        assert_eq!(spans[1]["name"], json!("acme.register"));
+        assert_eq!(spans[2]["name"], json!("acme.challenge"));
+        assert_eq!(spans[2]["parentSpanId"], json!("2222222222222222"));
+        assert_eq!(spans[2]["traceId"], spans[0]["traceId"]);
+    }
+
+    #[tokio::test]
+    async fn test_export_posts_to_collector() {
+        let server = MockServer::start().await;
+        Mock::given(method("POST"))
+            .and(path("/v1/traces"))
+            .respond_with(ResponseTemplate::new(200))
+            .expect(1)
+            .mount(&server)
+            .await;
+        let trace = test_trace(traces_url(&server.uri()).unwrap());
+
+        trace.export(&PhaseTimings::with_spans(), &Ok(())).await;
+    }
+}
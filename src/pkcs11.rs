@@ -0,0 +1,682 @@
+//! Signs certificate requests with a private key held in a PKCS#11 token.
+//!
+//! When a profile sets `[profiles.pkcs11]`, the agent `dlopen`s the
+//! configured module, logs in to the slot, and builds the CSR with the
+//! private key object matching `label`. The key never leaves the token,
+//! so only the certificate is written to disk. ECDSA P-256 and RSA keys
+//! are supported.
+//!
+//! Only the handful of Cryptoki entry points needed for signing are
+//! bound. The module is initialised with `CKF_OS_LOCKING_OK` and is never
+//! finalised or unloaded, so concurrent profiles that share a module do
+//! not tear it down under one another.
+
+use std::ffi::{CString, c_void};
+use std::os::unix::ffi::OsStrExt;
+use std::path::Path;
+
+use anyhow::{Context, Result};
+use tracing::{error, info};
+
+use crate::config::Pkcs11Settings;
+use crate::der;
+
+type CkUlong = libc::c_ulong;
+type CkRv = CkUlong;
+type CkSessionHandle = CkUlong;
+type CkObjectHandle = CkUlong;
+type Unused = Option<unsafe extern "C" fn()>;
+
+const CKR_OK: CkRv = 0x0;
+const CKR_USER_ALREADY_LOGGED_IN: CkRv = 0x100;
+const CKR_CRYPTOKI_ALREADY_INITIALIZED: CkRv = 0x191;
+const CKF_OS_LOCKING_OK: CkUlong = 0x2;
+const CKF_SERIAL_SESSION: CkUlong = 0x4;
+const CKU_USER: CkUlong = 1;
+const CKA_CLASS: CkUlong = 0x0;
+const CKA_LABEL: CkUlong = 0x3;
+const CKA_KEY_TYPE: CkUlong = 0x100;
+const CKA_MODULUS: CkUlong = 0x120;
+const CKA_PUBLIC_EXPONENT: CkUlong = 0x122;
+const CKA_EC_PARAMS: CkUlong = 0x180;
+const CKA_EC_POINT: CkUlong = 0x181;
+const CKO_PUBLIC_KEY: CkUlong = 2;
+const CKO_PRIVATE_KEY: CkUlong = 3;
+const CKK_RSA: CkUlong = 0x0;
+const CKK_EC: CkUlong = 0x3;
+const CKM_SHA256_RSA_PKCS: CkUlong = 0x40;
+const CKM_ECDSA: CkUlong = 0x1041;
+const FUNCTION_LIST_SYMBOL: &[u8] = b"C_GetFunctionList\0";
+const P256_OID_DER: [u8; 10] = [0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07];
+const P256_POINT_LEN: usize = 65;
+const P256_SCALAR_LEN: usize = 32;
+
+// Only a placeholder that keeps `CK_FUNCTION_LIST` at its C layout; the
+// agent never reads the module's version.
+#[allow(dead_code)]
+#[repr(C)]
+struct CkVersion {
+    major: u8,
+    minor: u8,
+}
+
+// `kind` and `value` are read by the module through the template pointer,
+// never by the agent; only `value_len` is read back.
+#[allow(dead_code)]
+#[repr(C)]
+struct CkAttribute {
+    kind: CkUlong,
+    value: *mut c_void,
+    value_len: CkUlong,
+}
+
+// Filled in for `C_SignInit` and read only by the module.
+#[allow(dead_code)]
+#[repr(C)]
+struct CkMechanism {
+    mechanism: CkUlong,
+    parameter: *mut c_void,
+    parameter_len: CkUlong,
+}
+
+// Filled in for `C_Initialize` and read only by the module.
+#[allow(dead_code)]
+#[repr(C)]
+struct CkInitializeArgs {
+    create_mutex: *mut c_void,
+    destroy_mutex: *mut c_void,
+    lock_mutex: *mut c_void,
+    unlock_mutex: *mut c_void,
+    flags: CkUlong,
+    reserved: *mut c_void,
+}
+
+/// Leading part of `CK_FUNCTION_LIST`, up to and including `C_Sign`.
+///
+/// The table is only ever read through the pointer the module returns,
+/// so the trailing entries this agent never calls can be left out.
+// `version` and the `Unused` slots are never read; they only keep the
+// entries the agent calls at their C offsets.
+#[allow(dead_code)]
+#[repr(C)]
+struct CkFunctionList {
+    version: CkVersion,
+    initialize: Option<unsafe extern "C" fn(*mut c_void) -> CkRv>,
+    finalize: Unused,
+    get_info: Unused,
+    get_function_list: Unused,
+    get_slot_list: Unused,
+    get_slot_info: Unused,
+    get_token_info: Unused,
+    get_mechanism_list: Unused,
+    get_mechanism_info: Unused,
+    init_token: Unused,
+    init_pin: Unused,
+    set_pin: Unused,
+    open_session: Option<
+        unsafe extern "C" fn(
+            CkUlong,
+            CkUlong,
+            *mut c_void,
+            *mut c_void,
+            *mut CkSessionHandle,
+        ) -> CkRv,
+    >,
+    close_session: Option<unsafe extern "C" fn(CkSessionHandle) -> CkRv>,
+    close_all_sessions: Unused,
+    get_session_info: Unused,
+    get_operation_state: Unused,
+    set_operation_state: Unused,
+    login: Option<unsafe extern "C" fn(CkSessionHandle, CkUlong, *const u8, CkUlong) -> CkRv>,
+    logout: Unused,
+    create_object: Unused,
+    copy_object: Unused,
+    destroy_object: Unused,
+    get_object_size: Unused,
+    get_attribute_value: Option<
+        unsafe extern "C" fn(CkSessionHandle, CkObjectHandle, *mut CkAttribute, CkUlong) -> CkRv,
+    >,
+    set_attribute_value: Unused,
+    find_objects_init:
+        Option<unsafe extern "C" fn(CkSessionHandle, *mut CkAttribute, CkUlong) -> CkRv>,
+    find_objects: Option<
+        unsafe extern "C" fn(CkSessionHandle, *mut CkObjectHandle, CkUlong, *mut CkUlong) -> CkRv,
+    >,
+    find_objects_final: Option<unsafe extern "C" fn(CkSessionHandle) -> CkRv>,
+    encrypt_init: Unused,
+    encrypt: Unused,
+    encrypt_update: Unused,
+    encrypt_final: Unused,
+    decrypt_init: Unused,
+    decrypt: Unused,
+    decrypt_update: Unused,
+    decrypt_final: Unused,
+    digest_init: Unused,
+    digest: Unused,
+    digest_update: Unused,
+    digest_key: Unused,
+    digest_final: Unused,
+    sign_init:
+        Option<unsafe extern "C" fn(CkSessionHandle, *mut CkMechanism, CkObjectHandle) -> CkRv>,
+    sign: Option<
+        unsafe extern "C" fn(CkSessionHandle, *const u8, CkUlong, *mut u8, *mut CkUlong) -> CkRv,
+    >,
+}
+
+type GetFunctionList = unsafe extern "C" fn(*mut *const CkFunctionList) -> CkRv;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum KeyKind {
+    EcdsaP256,
+    Rsa,
+}
+
+/// Builds a DER-encoded CSR for `params`, signed by the token key
+/// described by `settings`.
+///
+/// Runs on the blocking pool because every Cryptoki call is synchronous
+/// and an HSM round-trip can take noticeably long.
+///
+/// # Errors
+/// Returns an error if the module cannot be loaded, the login or key
+/// lookup fails, the key type is unsupported, or signing fails.
+pub(crate) async fn build_csr(
+    settings: Pkcs11Settings,
+    params: rcgen::CertificateParams,
+) -> Result<Vec<u8>> {
+    tokio::task::spawn_blocking(move || {
+        let key = TokenKey::open(&settings)?;
+        let csr = params
+            .serialize_request(&key)
+            .context("Failed to sign CSR with PKCS#11 key")?;
+        Ok(csr.der().to_vec())
+    })
+    .await
+    .context("PKCS#11 signing task failed")?
+}
+
+struct Session {
+    functions: &'static CkFunctionList,
+    handle: CkSessionHandle,
+}
+
+impl Drop for Session {
+    fn drop(&mut self) {
+        if let Some(close) = self.functions.close_session {
+            // SAFETY: `handle` came from `C_OpenSession` on this module
+            // and is closed exactly once.
+            let _ = unsafe { close(self.handle) };
+        }
+    }
+}
+
+struct TokenKey {
+    session: Session,
+    private_key: CkObjectHandle,
+    kind: KeyKind,
+    public_key: Vec<u8>,
+}
+
+impl TokenKey {
+    fn open(settings: &Pkcs11Settings) -> Result<Self> {
+        let functions = load_module(&settings.module)?;
+        initialize(functions)?;
+        let session = open_session(functions, settings.slot)?;
+        if let Some(pin) = settings.pin.as_deref() {
+            login(&session, pin)?;
+        }
+
+        let label = settings.label.as_bytes();
+        let private_key = find_object(&session, CKO_PRIVATE_KEY, label)?.ok_or_else(|| {
+            anyhow::anyhow!(
+                "No PKCS#11 private key labelled '{}' in slot {}",
+                settings.label,
+                settings.slot
+            )
+        })?;
+        let public_object = find_object(&session, CKO_PUBLIC_KEY, label)?.ok_or_else(|| {
+            anyhow::anyhow!(
+                "No PKCS#11 public key labelled '{}' in slot {}",
+                settings.label,
+                settings.slot
+            )
+        })?;
+
+        let key_type = read_ulong_attribute(&session, public_object, CKA_KEY_TYPE)?;
+        let (kind, public_key) = match key_type {
+            CKK_EC => {
+                let params = read_attribute(&session, public_object, CKA_EC_PARAMS)?;
+                if params != P256_OID_DER {
+                    anyhow::bail!("PKCS#11 EC key '{}' is not on P-256", settings.label);
+                }
+                let point = read_attribute(&session, public_object, CKA_EC_POINT)?;
+                (KeyKind::EcdsaP256, decode_ec_point(&point)?)
+            }
+            CKK_RSA => {
+                let modulus = read_attribute(&session, public_object, CKA_MODULUS)?;
+                let exponent = read_attribute(&session, public_object, CKA_PUBLIC_EXPONENT)?;
+                (KeyKind::Rsa, encode_rsa_public_key(&modulus, &exponent))
+            }
+            other => anyhow::bail!(
+                "PKCS#11 key '{}' has unsupported key type {other:#x}",
+                settings.label
+            ),
+        };
+        info!(
+            "Using PKCS#11 key '{}' from slot {} ({kind:?})",
+            settings.label, settings.slot
+        );
+
+        Ok(Self {
+            session,
+            private_key,
+            kind,
+            public_key,
+        })
+    }
+
+    fn sign_with(&self, mechanism: CkUlong, data: &[u8]) -> Result<Vec<u8>> {
+        let functions = self.session.functions;
+        let sign_init = functions
+            .sign_init
+            .ok_or_else(|| anyhow::anyhow!("PKCS#11 module lacks C_SignInit"))?;
+        let sign = functions
+            .sign
+            .ok_or_else(|| anyhow::anyhow!("PKCS#11 module lacks C_Sign"))?;
+        let mut mechanism = CkMechanism {
+            mechanism,
+            parameter: std::ptr::null_mut(),
+            parameter_len: 0,
+        };
+        let data_len = to_ulong(data.len())?;
+
+        // SAFETY: `mechanism` outlives the call and the session/key
+        // handles belong to this module.
+        check(
+            unsafe { sign_init(self.session.handle, &raw mut mechanism, self.private_key) },
+            "C_SignInit",
+        )?;
+        let mut signature_len: CkUlong = 0;
+        // SAFETY: a null output buffer asks the module for the
+        // signature length without ending the operation.
+        check(
+            unsafe {
+                sign(
+                    self.session.handle,
+                    data.as_ptr(),
+                    data_len,
+                    std::ptr::null_mut(),
+                    &raw mut signature_len,
+                )
+            },
+            "C_Sign",
+        )?;
+        let mut signature = vec![0u8; usize::try_from(signature_len)?];
+        // SAFETY: `signature` holds `signature_len` writable bytes and
+        // `data` stays borrowed for the duration of the call.
+        check(
+            unsafe {
+                sign(
+                    self.session.handle,
+                    data.as_ptr(),
+                    data_len,
+                    signature.as_mut_ptr(),
+                    &raw mut signature_len,
+                )
+            },
+            "C_Sign",
+        )?;
+        signature.truncate(usize::try_from(signature_len)?);
+        Ok(signature)
+    }
+}
+
+impl rcgen::PublicKeyData for TokenKey {
+    fn der_bytes(&self) -> &[u8] {
+        &self.public_key
+    }
+
+    fn algorithm(&self) -> &'static rcgen::SignatureAlgorithm {
+        match self.kind {
+            KeyKind::EcdsaP256 => &rcgen::PKCS_ECDSA_P256_SHA256,
+            KeyKind::Rsa => &rcgen::PKCS_RSA_SHA256,
+        }
+    }
+}
+
+impl rcgen::SigningKey for TokenKey {
+    fn sign(&self, msg: &[u8]) -> std::result::Result<Vec<u8>, rcgen::Error> {
+        let result = match self.kind {
+            KeyKind::EcdsaP256 => {
+                let digest = ring::digest::digest(&ring::digest::SHA256, msg);
+                self.sign_with(CKM_ECDSA, digest.as_ref())
+                    .and_then(|raw| encode_ecdsa_signature(&raw))
+            }
+            KeyKind::Rsa => self.sign_with(CKM_SHA256_RSA_PKCS, msg),
+        };
+        result.map_err(|err| {
+            error!("PKCS#11 signing failed: {err}");
+            rcgen::Error::RemoteKeyError
+        })
+    }
+}
+
+fn load_module(path: &Path) -> Result<&'static CkFunctionList> {
+    let c_path = CString::new(path.as_os_str().as_bytes())
+        .with_context(|| format!("Invalid PKCS#11 module path {}", path.display()))?;
+    // SAFETY: `c_path` is a valid NUL-terminated string. The handle is
+    // intentionally never passed to `dlclose`.
+    let library = unsafe { libc::dlopen(c_path.as_ptr(), libc::RTLD_NOW | libc::RTLD_LOCAL) };
+    if library.is_null() {
+        anyhow::bail!(
+            "Failed to load PKCS#11 module {}: {}",
+            path.display(),
+            last_dl_error()
+        );
+    }
+    // SAFETY: `library` is a live handle and the symbol name is
+    // NUL-terminated.
+    let symbol = unsafe { libc::dlsym(library, FUNCTION_LIST_SYMBOL.as_ptr().cast()) };
+    if symbol.is_null() {
+        anyhow::bail!(
+            "PKCS#11 module {} does not export C_GetFunctionList",
+            path.display()
+        );
+    }
+    // SAFETY: `symbol` is non-null and names `C_GetFunctionList`, which
+    // has this signature in every Cryptoki version; a data pointer and a
+    // function pointer have the same size on every supported platform.
+    let get_function_list: GetFunctionList = unsafe { std::mem::transmute(symbol) };
+    let mut functions: *const CkFunctionList = std::ptr::null();
+    // SAFETY: `get_function_list` was resolved from the module above and
+    // `functions` is a valid out-pointer for one table pointer.
+    check(
+        unsafe { get_function_list(&raw mut functions) },
+        "C_GetFunctionList",
+    )?;
+    // SAFETY: the module owns the table for as long as it stays loaded,
+    // which is the rest of the process lifetime.
+    unsafe { functions.as_ref() }
+        .ok_or_else(|| anyhow::anyhow!("PKCS#11 module returned no function list"))
+}
+
+fn initialize(functions: &CkFunctionList) -> Result<()> {
+    let initialize = functions
+        .initialize
+        .ok_or_else(|| anyhow::anyhow!("PKCS#11 module lacks C_Initialize"))?;
+    let mut args = CkInitializeArgs {
+        create_mutex: std::ptr::null_mut(),
+        destroy_mutex: std::ptr::null_mut(),
+        lock_mutex: std::ptr::null_mut(),
+        unlock_mutex: std::ptr::null_mut(),
+        flags: CKF_OS_LOCKING_OK,
+        reserved: std::ptr::null_mut(),
+    };
+    // SAFETY: `args` is a `CK_C_INITIALIZE_ARGS` that outlives the call,
+    // and no mutex callbacks are passed.
+    let rv = unsafe { initialize((&raw mut args).cast()) };
+    if rv == CKR_CRYPTOKI_ALREADY_INITIALIZED {
+        return Ok(());
+    }
+    check(rv, "C_Initialize")
+}
+
+fn open_session(functions: &'static CkFunctionList, slot: u64) -> Result<Session> {
+    let open = functions
+        .open_session
+        .ok_or_else(|| anyhow::anyhow!("PKCS#11 module lacks C_OpenSession"))?;
+    let slot = CkUlong::try_from(slot).context("PKCS#11 slot id is out of range")?;
+    let mut handle: CkSessionHandle = 0;
+    // SAFETY: `handle` is a valid out-pointer; no notify callback is
+    // registered.
+    check(
+        unsafe {
+            open(
+                slot,
+                CKF_SERIAL_SESSION,
+                std::ptr::null_mut(),
+                std::ptr::null_mut(),
+                &raw mut handle,
+            )
+        },
+        "C_OpenSession",
+    )?;
+    Ok(Session { functions, handle })
+}
+
+fn login(session: &Session, pin: &str) -> Result<()> {
+    let login = session
+        .functions
+        .login
+        .ok_or_else(|| anyhow::anyhow!("PKCS#11 module lacks C_Login"))?;
+    // SAFETY: `pin` stays borrowed for the duration of the call.
+    let rv = unsafe { login(session.handle, CKU_USER, pin.as_ptr(), to_ulong(pin.len())?) };
+    if rv == CKR_USER_ALREADY_LOGGED_IN {
+        return Ok(());
+    }
+    check(rv, "C_Login")
+}
+
+fn find_object(session: &Session, class: CkUlong, label: &[u8]) -> Result<Option<CkObjectHandle>> {
+    let functions = session.functions;
+    let (Some(init), Some(find), Some(finish)) = (
+        functions.find_objects_init,
+        functions.find_objects,
+        functions.find_objects_final,
+    ) else {
+        anyhow::bail!("PKCS#11 module lacks C_FindObjects");
+    };
+    let mut class = class;
+    let mut label = label.to_vec();
+    let mut template = [
+        CkAttribute {
+            kind: CKA_CLASS,
+            value: (&raw mut class).cast(),
+            value_len: to_ulong(std::mem::size_of::<CkUlong>())?,
+        },
+        CkAttribute {
+            kind: CKA_LABEL,
+            value: label.as_mut_ptr().cast(),
+            value_len: to_ulong(label.len())?,
+        },
+    ];
+    // SAFETY: the template and the values it points at outlive the
+    // search, which is always closed with `C_FindObjectsFinal`.
+    check(
+        unsafe {
+            init(
+                session.handle,
+                template.as_mut_ptr(),
+                to_ulong(template.len())?,
+            )
+        },
+        "C_FindObjectsInit",
+    )?;
+    let mut object: CkObjectHandle = 0;
+    let mut found: CkUlong = 0;
+    // SAFETY: `object` and `found` are valid out-pointers for one handle.
+    let rv = unsafe { find(session.handle, &raw mut object, 1, &raw mut found) };
+    // SAFETY: the search on this session was opened by the successful
+    // `C_FindObjectsInit` above and is closed exactly once.
+    let _ = unsafe { finish(session.handle) };
+    check(rv, "C_FindObjects")?;
+    Ok((found > 0).then_some(object))
+}
+
+fn read_attribute(session: &Session, object: CkObjectHandle, kind: CkUlong) -> Result<Vec<u8>> {
+    let get = session
+        .functions
+        .get_attribute_value
+        .ok_or_else(|| anyhow::anyhow!("PKCS#11 module lacks C_GetAttributeValue"))?;
+    let mut attribute = CkAttribute {
+        kind,
+        value: std::ptr::null_mut(),
+        value_len: 0,
+    };
+    // SAFETY: a null value pointer asks for the attribute length only.
+    check(
+        unsafe { get(session.handle, object, &raw mut attribute, 1) },
+        "C_GetAttributeValue",
+    )?;
+    let mut value = vec![0u8; usize::try_from(attribute.value_len)?];
+    attribute.value = value.as_mut_ptr().cast();
+    // SAFETY: `value` holds `value_len` writable bytes.
+    check(
+        unsafe { get(session.handle, object, &raw mut attribute, 1) },
+        "C_GetAttributeValue",
+    )?;
+    value.truncate(usize::try_from(attribute.value_len)?);
+    Ok(value)
+}
+
+fn read_ulong_attribute(
+    session: &Session,
+    object: CkObjectHandle,
+    kind: CkUlong,
+) -> Result<CkUlong> {
+    let bytes = read_attribute(session, object, kind)?;
+    let array = <[u8; std::mem::size_of::<CkUlong>()]>::try_from(bytes.as_slice())
+        .map_err(|_| anyhow::anyhow!("PKCS#11 attribute {kind:#x} has unexpected size"))?;
+    Ok(CkUlong::from_ne_bytes(array))
+}
+
+fn check(rv: CkRv, call: &str) -> Result<()> {
+    if rv == CKR_OK {
+        Ok(())
+    } else {
+        anyhow::bail!("PKCS#11 {call} failed with CKR {rv:#x}")
+    }
+}
+
+fn to_ulong(len: usize) -> Result<CkUlong> {
+    CkUlong::try_from(len).context("PKCS#11 buffer length is out of range")
+}
+
+fn last_dl_error() -> String {
+    // SAFETY: `dlerror` returns either null or a NUL-terminated string
+    // owned by the loader, which is copied out immediately.
+    let message = unsafe { libc::dlerror() };
+    if message.is_null() {
+        return "unknown error".to_string();
+    }
+    // SAFETY: `message` is non-null, so it points at a NUL-terminated
+    // string that stays valid until the next `dl*` call on this thread.
+    unsafe { std::ffi::CStr::from_ptr(message) }
+        .to_string_lossy()
+        .into_owned()
+}
+
+/// Extracts the uncompressed P-256 point from `CKA_EC_POINT`.
+///
+/// The attribute is specified as a DER `OCTET STRING`, but some modules
+/// return the bare point, so both forms are accepted.
+fn decode_ec_point(value: &[u8]) -> Result<Vec<u8>> {
+    let point = match value {
+        [der::TAG_OCTET_STRING, len, rest @ ..] if usize::from(*len) == rest.len() => rest,
+        other => other,
+    };
+    if point.len() != P256_POINT_LEN || point.first() != Some(&0x04) {
+        anyhow::bail!("PKCS#11 EC point is not an uncompressed P-256 point");
+    }
+    Ok(point.to_vec())
+}
+
+/// Converts a raw `r || s` ECDSA signature into the DER form X.509 uses.
+fn encode_ecdsa_signature(raw: &[u8]) -> Result<Vec<u8>> {
+    if raw.len() != 2 * P256_SCALAR_LEN {
+        anyhow::bail!(
+            "PKCS#11 ECDSA signature has unexpected length {}",
+            raw.len()
+        );
+    }
+    let (r, s) = raw.split_at(P256_SCALAR_LEN);
+    let mut body = der::integer(r);
+    body.extend(der::integer(s));
+    Ok(der::tlv(der::TAG_SEQUENCE, &body))
+}
+
+/// Encodes a PKCS#1 `RSAPublicKey` from its modulus and exponent.
+fn encode_rsa_public_key(modulus: &[u8], exponent: &[u8]) -> Vec<u8> {
+    let mut body = der::integer(modulus);
+    body.extend(der::integer(exponent));
+    der::tlv(der::TAG_SEQUENCE, &body)
+}
+
+#[cfg(test)]
+mod tests {
+    use std::path::PathBuf;
+
+    use super::*;
+
+    #[test]
+    fn test_decode_ec_point_accepts_wrapped_and_bare_points() {
+        let mut point = vec![0x04];
+        point.extend([0xab; 64]);
+        let mut wrapped = vec![der::TAG_OCTET_STRING, 65];
+        wrapped.extend(&point);
+
+        assert_eq!(decode_ec_point(&wrapped).unwrap(), point);
+        assert_eq!(decode_ec_point(&point).unwrap(), point);
+    }
+
+    #[test]
+    fn test_decode_ec_point_rejects_compressed_point() {
+        let mut point = vec![0x02];
+        point.extend([0xab; 32]);
+
+        assert!(decode_ec_point(&point).is_err());
+    }
+
+    #[test]
+    fn test_encode_ecdsa_signature_matches_ring_verifier() {
+        let rng = ring::rand::SystemRandom::new();
+        let pkcs8 = ring::signature::EcdsaKeyPair::generate_pkcs8(
+            &ring::signature::ECDSA_P256_SHA256_FIXED_SIGNING,
+            &rng,
+        )
+        .unwrap();
+        let key = ring::signature::EcdsaKeyPair::from_pkcs8(
+            &ring::signature::ECDSA_P256_SHA256_FIXED_SIGNING,
+            pkcs8.as_ref(),
+            &rng,
+        )
+        .unwrap();
+        let message = b"bootroot csr";
+        let raw = key.sign(&rng, message).unwrap();
+
+        let der = encode_ecdsa_signature(raw.as_ref()).unwrap();
+
+        let public_key = ring::signature::UnparsedPublicKey::new(
+            &ring::signature::ECDSA_P256_SHA256_ASN1,
+            ring::signature::KeyPair::public_key(&key).as_ref(),
+        );
+        assert!(public_key.verify(message, &der).is_ok());
+    }
+
+    #[test]
+    fn test_encode_rsa_public_key_is_sequence_of_integers() {
+        let der = encode_rsa_public_key(&[0xc1, 0x02], &[0x01, 0x00, 0x01]);
+
+        assert_eq!(
+            der,
+            vec![
+                0x30, 0x0a, 0x02, 0x03, 0x00, 0xc1, 0x02, 0x02, 0x03, 0x01, 0x00, 0x01
+            ]
+        );
+    }
+
+    #[tokio::test]
+    async fn test_build_csr_reports_unloadable_module() {
+        let settings = Pkcs11Settings {
+            module: PathBuf::from("/nonexistent/libbootroot-missing-pkcs11.so"),
+            slot: 0,
+            label: "edge-proxy".to_string(),
+            pin: None,
+        };
+        let params = rcgen::CertificateParams::new(vec!["edge.example".to_string()]).unwrap();
+
+        let err = build_csr(settings, params).await.unwrap_err();
+
+        assert!(err.to_string().contains("Failed to load PKCS#11 module"));
+    }
+}
@@ -0,0 +1,264 @@
+//! Reload of a consuming service after renewal.
+//!
+//! `[reload].pid_file` (or `--reload-pid-file`) names a pidfile such as
+//! nginx's; after each successful issuance the agent sends
+//! `[reload].signal` (default `HUP`) to that PID directly instead of
+//! spawning a reload command. `[reload].container` (or
+//! `--reload-container`) restarts a container with the configured
+//! runtime instead. Failures are logged and never fail the renewal.
+
+use std::path::Path;
+use std::process::Stdio;
+use std::time::Duration;
+
+use anyhow::{Context, Result};
+use tokio::process::Command;
+use tracing::{error, info, warn};
+
+use crate::config::ReloadSettings;
+
+const DEFAULT_RELOAD_SIGNAL: &str = "HUP";
+const DEFAULT_CONTAINER_RUNTIME: &str = "docker";
+const CONTAINER_COMMAND_TIMEOUT: Duration = Duration::from_secs(120);
+const SIGNAL_PREFIX: &str = "SIG";
+const SIGNALS: [(&str, libc::c_int); 7] = [
+    ("HUP", libc::SIGHUP),
+    ("INT", libc::SIGINT),
+    ("QUIT", libc::SIGQUIT),
+    ("TERM", libc::SIGTERM),
+    ("USR1", libc::SIGUSR1),
+    ("USR2", libc::SIGUSR2),
+    ("WINCH", libc::SIGWINCH),
+];
+
+/// Outcome of one reload attempt.
+#[derive(Debug, PartialEq, Eq)]
+enum ReloadOutcome {
+    Signalled,
+    ProcessNotFound,
+}
+
+/// Resolves a signal name (`HUP`, `SIGHUP`, `usr1`, ...) to its number.
+pub(crate) fn signal_number(name: &str) -> Option<libc::c_int> {
+    let name = name.trim().to_ascii_uppercase();
+    let name = name.strip_prefix(SIGNAL_PREFIX).unwrap_or(&name);
+    SIGNALS
+        .iter()
+        .find(|(candidate, _)| *candidate == name)
+        .map(|(_, number)| *number)
+}
+
+/// Runs the configured `[reload]` actions after a successful issuance.
+pub(crate) async fn reload_after_renewal(settings: &ReloadSettings) {
+    signal_reload(settings);
+    restart_container(settings).await;
+}
+
+/// Warns at startup when `reload.container` names a container the
+/// runtime does not know, so a typo surfaces before the first renewal.
+pub(crate) async fn warn_if_container_missing(settings: &ReloadSettings) {
+    let Some(container) = settings.container.as_deref() else {
+        return;
+    };
+    let runtime = container_runtime(settings);
+    match run_container_command(runtime, &["container", "inspect", container]).await {
+        Ok(()) => info!("Reload container '{container}' found via {runtime}"),
+        Err(err) => warn!(
+            "Reload container '{container}' is not available via {runtime} ({err:#}); \
+             renewals will still try to restart it"
+        ),
+    }
+}
+
+fn container_runtime(settings: &ReloadSettings) -> &str {
+    settings
+        .container_runtime
+        .as_deref()
+        .unwrap_or(DEFAULT_CONTAINER_RUNTIME)
+}
+
+async fn restart_container(settings: &ReloadSettings) {
+    let Some(container) = settings.container.as_deref() else {
+        return;
+    };
+    let runtime = container_runtime(settings);
+    match run_container_command(runtime, &["restart", container]).await {
+        Ok(()) => info!("Restarted container '{container}' via {runtime}"),
+        Err(err) => error!(
+            "Restart of container '{container}' via {runtime} failed; it is still serving \
+             the previous certificate: {err:#}"
+        ),
+    }
+}
+
+async fn run_container_command(runtime: &str, args: &[&str]) -> Result<()> {
+    let output = Command::new(runtime)
+        .args(args)
+        .stdin(Stdio::null())
+        .stdout(Stdio::null())
+        .stderr(Stdio::piped())
+        .kill_on_drop(true)
+        .output();
+    let output = tokio::time::timeout(CONTAINER_COMMAND_TIMEOUT, output)
+        .await
+        .map_err(|_| {
+            anyhow::anyhow!(
+                "{runtime} {} timed out after {}s",
+                args.join(" "),
+                CONTAINER_COMMAND_TIMEOUT.as_secs()
+            )
+        })?
+        .with_context(|| format!("Failed to run {runtime}"))?;
+    if !output.status.success() {
+        anyhow::bail!(
+            "{runtime} {} exited with {}: {}",
+            args.join(" "),
+            output.status,
+            String::from_utf8_lossy(&output.stderr).trim()
+        );
+    }
+    Ok(())
+}
+
+/// Sends the configured reload signal, when `reload.pid_file` is set. A
+/// missing process is logged as a warning rather than an error, since
+/// the consumer may simply not be running.
+fn signal_reload(settings: &ReloadSettings) {
+    let Some(pid_file) = settings.pid_file.as_deref() else {
+        return;
+    };
+    let signal = settings.signal.as_deref().unwrap_or(DEFAULT_RELOAD_SIGNAL);
+    match send_signal(pid_file, signal) {
+        Ok(ReloadOutcome::Signalled) => {
+            info!("Sent {signal} to the process in {}", pid_file.display());
+        }
+        Ok(ReloadOutcome::ProcessNotFound) => warn!(
+            "Reload skipped: no process with the PID in {} is running",
+            pid_file.display()
+        ),
+        Err(err) => warn!("Reload via {} failed: {err:#}", pid_file.display()),
+    }
+}
+
+fn send_signal(pid_file: &Path, signal: &str) -> Result<ReloadOutcome> {
+    let signal =
+        signal_number(signal).ok_or_else(|| anyhow::anyhow!("Unknown reload signal: {signal}"))?;
+    let contents = std::fs::read_to_string(pid_file)
+        .with_context(|| format!("Failed to read PID file {}", pid_file.display()))?;
+    let pid: libc::pid_t = contents
+        .trim()
+        .parse()
+        .ok()
+        .filter(|pid| *pid > 0)
+        .ok_or_else(|| anyhow::anyhow!("PID file {} has no valid PID", pid_file.display()))?;
+    // SAFETY: `kill` has no memory-safety preconditions; `pid` is positive
+    // so it targets one process, never a process group.
+    if unsafe { libc::kill(pid, signal) } == 0 {
+        return Ok(ReloadOutcome::Signalled);
+    }
+    let err = std::io::Error::last_os_error();
+    if err.raw_os_error() == Some(libc::ESRCH) {
+        return Ok(ReloadOutcome::ProcessNotFound);
+    }
+    Err(anyhow::Error::new(err).context(format!("Failed to signal PID {pid}")))
+}
+
+#[cfg(test)]
+mod tests {
+    use std::os::unix::process::ExitStatusExt;
+    use std::process::Command;
+
+    use super::*;
+
+    #[test]
+    fn test_signal_number_accepts_common_spellings() {
+        assert_eq!(signal_number("HUP"), Some(libc::SIGHUP));
+        assert_eq!(signal_number("SIGHUP"), Some(libc::SIGHUP));
+        assert_eq!(signal_number(" usr1 "), Some(libc::SIGUSR1));
+        assert_eq!(signal_number("KILL"), None);
+        assert_eq!(signal_number(""), None);
+    }
+
+    #[test]
+    fn test_send_signal_reaches_pid_file_process() {
+        let dir = tempfile::tempdir().unwrap();
+        let pid_file = dir.path().join("consumer.pid");
+        let mut child = Command::new("sleep").arg("30").spawn().unwrap();
+        std::fs::write(&pid_file, format!("{}\n", child.id())).unwrap();
+
+        let outcome = send_signal(&pid_file, "TERM").unwrap();
+
+        assert_eq!(outcome, ReloadOutcome::Signalled);
+        assert_eq!(child.wait().unwrap().signal(), Some(libc::SIGTERM));
+    }
+
+    #[test]
+    fn test_send_signal_reports_exited_process() {
+        let dir = tempfile::tempdir().unwrap();
+        let pid_file = dir.path().join("consumer.pid");
+        let mut child = Command::new("true").spawn().unwrap();
+        let pid = child.id();
+        child.wait().unwrap();
+        std::fs::write(&pid_file, pid.to_string()).unwrap();
+
+        assert_eq!(
+            send_signal(&pid_file, "HUP").unwrap(),
+            ReloadOutcome::ProcessNotFound
+        );
+    }
+
+    #[test]
+    fn test_send_signal_rejects_bad_pid_file() {
+        let dir = tempfile::tempdir().unwrap();
+        let pid_file = dir.path().join("consumer.pid");
+
+        assert!(send_signal(&pid_file, "HUP").is_err());
+        std::fs::write(&pid_file, "-1").unwrap();
+        let err = send_signal(&pid_file, "HUP").unwrap_err();
+        assert!(err.to_string().contains("no valid PID"));
+    }
+
+    fn write_fake_runtime(dir: &Path, exit_code: u8) -> String {
+        use std::os::unix::fs::PermissionsExt;
+
+        let script = dir.join("fake-runtime");
+        let log = dir.join("runtime.log");
+        std::fs::write(
+            &script,
+            format!(
+                "#!/bin/sh\necho \"$@\" >> '{}'\necho 'no such container' >&2\nexit {exit_code}\n",
+                log.display()
+            ),
+        )
+        .unwrap();
+        std::fs::set_permissions(&script, std::fs::Permissions::from_mode(0o755)).unwrap();
+        script.display().to_string()
+    }
+
+    #[tokio::test]
+    async fn test_reload_after_renewal_restarts_container() {
+        let dir = tempfile::tempdir().unwrap();
+        let settings = ReloadSettings {
+            container: Some("edge-proxy".to_string()),
+            container_runtime: Some(write_fake_runtime(dir.path(), 0)),
+            ..ReloadSettings::default()
+        };
+
+        reload_after_renewal(&settings).await;
+
+        let log = std::fs::read_to_string(dir.path().join("runtime.log")).unwrap();
+        assert_eq!(log, "restart edge-proxy\n");
+    }
+
+    #[tokio::test]
+    async fn test_run_container_command_reports_failure() {
+        let dir = tempfile::tempdir().unwrap();
+        let runtime = write_fake_runtime(dir.path(), 1);
+
+        let err = run_container_command(&runtime, &["container", "inspect", "missing"])
+            .await
+            .unwrap_err();
+
+        assert!(err.to_string().contains("no such container"));
+    }
+}
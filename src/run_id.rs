@@ -0,0 +1,124 @@
+//! Correlation IDs for agent runs.
+//!
+//! Every invocation of the agent runs under a run ID: a random UUID, or
+//! the value of `--run-id`. In daemon mode each renewal cycle gets its
+//! own ID instead. The ID is attached to every log line of the run as
+//! a `run{run_id=...}` span, passed to hooks as `BOOTROOT_RUN_ID`, and
+//! recorded in the sidecar metadata, the status report, and the
+//! issuance API response, so one run's events can be found across
+//! aggregated logs.
+
+use std::fmt::Write as _;
+use std::future::Future;
+use std::sync::atomic::{AtomicU64, Ordering};
+
+use ring::rand::{SecureRandom, SystemRandom};
+use tracing::Instrument as _;
+
+const UUID_LEN: usize = 16;
+
+tokio::task_local! {
+    static RUN_ID: String;
+}
+
+/// Sequence of daemon cycles started under a `--run-id` base.
+static CYCLE_SEQ: AtomicU64 = AtomicU64::new(0);
+
+/// Returns a new random (version 4) UUID in its hyphenated form.
+///
+/// # Panics
+/// Panics if the system random number generator fails.
+#[must_use]
+pub fn generate() -> String {
+    let mut bytes = [0u8; UUID_LEN];
+    SystemRandom::new()
+        .fill(&mut bytes)
+        .expect("system random number generator failed");
+    bytes[6] = (bytes[6] & 0x0f) | 0x40;
+    bytes[8] = (bytes[8] & 0x3f) | 0x80;
+    let mut id = String::with_capacity(36);
+    for (index, byte) in bytes.iter().enumerate() {
+        if matches!(index, 4 | 6 | 8 | 10) {
+            id.push('-');
+        }
+        let _ = write!(id, "{byte:02x}");
+    }
+    id
+}
+
+/// Runs `future` with `id` as the current run ID.
+pub async fn scope<F: Future>(id: String, future: F) -> F::Output {
+    let span = tracing::info_span!("run", run_id = %id);
+    RUN_ID.scope(id, future.instrument(span)).await
+}
+
+/// Wraps `future` to run under the run ID of the calling task, if any.
+/// Used for tasks spawned within a run, which do not inherit it
+/// otherwise; the ID is read here, not when the task is first polled.
+pub(crate) fn inherit<F: Future>(future: F) -> impl Future<Output = F::Output> {
+    let id = current();
+    async move {
+        match id {
+            Some(id) => scope(id, future).await,
+            None => future.await,
+        }
+    }
+}
+
+/// Returns the ID of a new daemon renewal cycle: a fresh UUID, or
+/// `<base>-<n>` when the operator set `--run-id <base>`.
+pub(crate) fn cycle_id(base: Option<&str>) -> String {
+    match base {
+        Some(base) => format!("{base}-{}", CYCLE_SEQ.fetch_add(1, Ordering::Relaxed) + 1),
+        None => generate(),
+    }
+}
+
+/// Returns the current run ID, or `None` outside any run.
+pub(crate) fn current() -> Option<String> {
+    RUN_ID.try_with(Clone::clone).ok()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_generate_returns_v4_uuid() {
+        let id = generate();
+        let groups: Vec<&str> = id.split('-').collect();
+        assert_eq!(
+            groups.iter().map(|group| group.len()).collect::<Vec<_>>(),
+            [8, 4, 4, 4, 12]
+        );
+        assert!(id.chars().all(|c| c == '-' || c.is_ascii_hexdigit()));
+        assert!(groups[2].starts_with('4'));
+        assert!(matches!(
+            groups[3].chars().next(),
+            Some('8' | '9' | 'a' | 'b')
+        ));
+        assert_ne!(id, generate());
+    }
+
+    #[tokio::test]
+    async fn test_scope_sets_current_and_inherit_carries_it_into_tasks() {
+        assert_eq!(current(), None);
+        let (inside, spawned) = scope("run-1".to_string(), async {
+            let spawned = tokio::spawn(inherit(async { current() })).await.unwrap();
+            (current(), spawned)
+        })
+        .await;
+        assert_eq!(inside.as_deref(), Some("run-1"));
+        assert_eq!(spawned.as_deref(), Some("run-1"));
+        assert_eq!(current(), None);
+    }
+
+    #[test]
+    fn test_cycle_id_numbers_cycles_under_a_base() {
+        let first = cycle_id(Some("deploy-42"));
+        let second = cycle_id(Some("deploy-42"));
+        assert!(first.starts_with("deploy-42-"));
+        assert_ne!(first, second);
+        assert_eq!(cycle_id(None).len(), 36);
+    }
+}
@@ -0,0 +1,191 @@
+//! Machine-readable outcome of a oneshot run.
+//!
+//! With `--result-json` the agent prints one JSON object on standard
+//! output when a oneshot run ends, and sends its logs to standard error
+//! instead, so a wrapper can read the outcome without parsing log lines.
+//! The object carries the run ID, the error that failed the run, and one
+//! entry per profile, in configuration order, with the action taken, the
+//! ordered identifiers, the serial and validity of the new leaf, and the
+//! files written.
+
+use std::path::PathBuf;
+use std::sync::Mutex as StdMutex;
+
+use serde::Serialize;
+
+use crate::acme::flow::output_paths;
+use crate::acme::sink::OutputSink;
+use crate::{cert_metadata, config};
+
+/// What a oneshot run did for one profile.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Action {
+    /// A certificate was issued where `paths.cert` did not exist.
+    Issued,
+    /// A new certificate replaced the one at `paths.cert`.
+    Renewed,
+    /// Nothing was written: the certificate was still valid under
+    /// `--no-register-if-exists`, the run stopped before the profile was
+    /// tried, or the CA finalized the order without a certificate.
+    Skipped,
+    /// The issuance failed; `error` says why.
+    Failed,
+}
+
+/// Outcome of one profile.
+///
+/// Timestamps are RFC 3339 strings in UTC. `serial`, `not_before`,
+/// `not_after`, and `paths` are set only for `issued` and `renewed`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ProfileResult {
+    pub profile: String,
+    pub action: Action,
+    pub domains: Vec<String>,
+    pub serial: Option<String>,
+    pub not_before: Option<String>,
+    pub not_after: Option<String>,
+    pub paths: Vec<PathBuf>,
+    pub error: Option<String>,
+}
+
+/// JSON object printed by `--result-json`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct RunResult {
+    pub run_id: Option<String>,
+    pub profiles: Vec<ProfileResult>,
+    /// Error that failed the run, `null` when it succeeded.
+    pub error: Option<String>,
+}
+
+impl RunResult {
+    /// Result of a run that failed before any profile was tried, for
+    /// example because the configuration is invalid or `--max-runtime`
+    /// ran out while waiting for the CA.
+    #[must_use]
+    pub fn failed(error: &anyhow::Error) -> Self {
+        Self {
+            run_id: crate::run_id::current(),
+            profiles: Vec::new(),
+            error: Some(format!("{error:#}")),
+        }
+    }
+}
+
+/// Collects profile results as their issuances finish.
+pub(crate) struct Recorder {
+    results: StdMutex<Vec<ProfileResult>>,
+}
+
+impl Recorder {
+    pub(crate) fn new() -> Self {
+        Self {
+            results: StdMutex::new(Vec::new()),
+        }
+    }
+
+    pub(crate) fn record(&self, result: ProfileResult) {
+        self.results
+            .lock()
+            .expect("run result mutex poisoned")
+            .push(result);
+    }
+
+    /// Builds the result of a run that ended with `outcome`. Profiles
+    /// that never reached issuance are reported as skipped.
+    pub(crate) fn finish(
+        &self,
+        settings: &config::Settings,
+        outcome: &anyhow::Result<()>,
+    ) -> RunResult {
+        let mut recorded =
+            std::mem::take(&mut *self.results.lock().expect("run result mutex poisoned"));
+        let profiles = settings
+            .profiles
+            .iter()
+            .map(|profile| {
+                let label = config::profile_domain(settings, profile);
+                match recorded.iter().position(|result| result.profile == label) {
+                    Some(index) => recorded.swap_remove(index),
+                    None => base_result(label, Action::Skipped),
+                }
+            })
+            .collect();
+        RunResult {
+            run_id: crate::run_id::current(),
+            profiles,
+            error: outcome.as_ref().err().map(|err| format!("{err:#}")),
+        }
+    }
+}
+
+/// State of a profile's certificate before its issuance, which tells
+/// a renewal from a first issuance and a new leaf from an unchanged one.
+pub(crate) struct Before {
+    had_cert: bool,
+    serial: Option<String>,
+}
+
+impl Before {
+    pub(crate) async fn capture(profile: &config::DaemonProfileSettings) -> Self {
+        let had_cert = matches!(tokio::fs::try_exists(&profile.paths.cert).await, Ok(true));
+        let serial =
+            cert_metadata::read_metadata(&cert_metadata::metadata_path(&profile.paths.cert))
+                .await
+                .ok()
+                .map(|metadata| metadata.serial);
+        Self { had_cert, serial }
+    }
+}
+
+/// Describes the issuance of `profile` that ended with `result`. The
+/// new leaf is read from the sidecar metadata the issuance wrote.
+pub(crate) async fn describe(
+    settings: &config::Settings,
+    profile: &config::DaemonProfileSettings,
+    before: &Before,
+    result: &anyhow::Result<()>,
+) -> ProfileResult {
+    let label = config::profile_domain(settings, profile);
+    if let Err(err) = result {
+        return ProfileResult {
+            error: Some(format!("{err:#}")),
+            ..base_result(label, Action::Failed)
+        };
+    }
+    let metadata = cert_metadata::read_metadata(&cert_metadata::metadata_path(&profile.paths.cert))
+        .await
+        .ok()
+        .filter(|metadata| before.serial.as_ref() != Some(&metadata.serial));
+    let Some(metadata) = metadata else {
+        return base_result(label, Action::Skipped);
+    };
+    let action = if before.had_cert {
+        Action::Renewed
+    } else {
+        Action::Issued
+    };
+    let sinks = OutputSink::for_profile(settings, profile);
+    let writes_key = profile.pkcs11.is_none() && profile.key_delivery.is_none();
+    ProfileResult {
+        domains: metadata.domains,
+        serial: Some(metadata.serial),
+        not_before: metadata.not_before,
+        not_after: Some(metadata.not_after),
+        paths: output_paths(settings, profile, &sinks, writes_key),
+        ..base_result(label, action)
+    }
+}
+
+fn base_result(profile: String, action: Action) -> ProfileResult {
+    ProfileResult {
+        domains: vec![profile.clone()],
+        profile,
+        action,
+        serial: None,
+        not_before: None,
+        not_after: None,
+        paths: Vec::new(),
+        error: None,
+    }
+}
@@ -0,0 +1,464 @@
+//! On-demand issuance API for `bootroot-agent --serve`.
+//!
+//! Instead of renewing the profiles in `agent.toml`, the agent listens on
+//! the `--serve` address and issues one certificate per `POST /issue`
+//! request. The JSON body names the service identity (`service_name`,
+//! `instance_id`, `hostname`); the agent runs the daemon's ACME flow
+//! through [`crate::acme::obtain_certificate`] and returns the chain and
+//! private key in the response instead of writing files. Every request
+//! must carry `Authorization: Bearer <token>`, with the token read from
+//! `--api-token-file` or `BOOTROOT_API_TOKEN` so it never shows up in the
+//! process list.
+//!
+//! The API is plain HTTP and its responses carry private keys, so it only
+//! listens on a loopback address or on a `unix:<PATH>` socket that only
+//! the agent's user can open.
+
+use std::net::SocketAddr;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+
+use anyhow::{Context, Result};
+use poem::http::StatusCode;
+use poem::listener::{Listener, TcpListener};
+use poem::middleware::SizeLimit;
+use poem::web::{Data, Json};
+use poem::{Endpoint, EndpointExt, IntoResponse, Request, Response, Route, Server, handler};
+use ring::hmac;
+use ring::rand::SystemRandom;
+use serde::{Deserialize, Serialize};
+use serde_json::json;
+use tokio::sync::Semaphore;
+use tracing::{error, info};
+
+use crate::{acme, cert_metadata, config, eab, input_validation, profile, run_id};
+
+const ISSUE_PATH: &str = "/issue";
+const UNIX_PREFIX: &str = "unix:";
+const API_TOKEN_ENV: &str = "BOOTROOT_API_TOKEN";
+const BEARER_PREFIX: &str = "Bearer ";
+const MAX_BODY_BYTES: usize = 16 * 1024;
+
+/// JSON body of `POST /issue`.
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+struct IssueRequest {
+    service_name: String,
+    instance_id: String,
+    hostname: String,
+}
+
+/// JSON body returned by a successful `POST /issue`.
+#[derive(Debug, Serialize)]
+struct IssueResponse {
+    domain: String,
+    /// Leaf certificate followed by the intermediates.
+    cert_pem: String,
+    key_pem: String,
+    /// SPKI pin of the leaf (base64 SHA-256).
+    spki_sha256: String,
+    /// Run ID the request's log lines carry.
+    run_id: String,
+}
+
+/// API token kept as an HMAC tag so requests are compared in constant
+/// time without holding the token itself.
+struct ApiToken {
+    key: hmac::Key,
+    tag: hmac::Tag,
+}
+
+impl ApiToken {
+    fn new(token: &str) -> Result<Self> {
+        if token.trim().is_empty() {
+            anyhow::bail!("issuance API token must not be empty");
+        }
+        let key = hmac::Key::generate(hmac::HMAC_SHA256, &SystemRandom::new())
+            .map_err(|_| anyhow::anyhow!("Failed to generate API token key"))?;
+        let tag = hmac::sign(&key, token.as_bytes());
+        Ok(Self { key, tag })
+    }
+
+    fn matches(&self, presented: &str) -> bool {
+        hmac::verify(&self.key, presented.as_bytes(), self.tag.as_ref()).is_ok()
+    }
+}
+
+struct ServeState {
+    settings: Arc<config::Settings>,
+    default_eab: Option<eab::EabCredentials>,
+    insecure_mode: bool,
+    token: ApiToken,
+    semaphore: Semaphore,
+}
+
+/// Where the issuance API listens.
+#[derive(Debug, PartialEq, Eq)]
+enum ServeAddr {
+    /// A loopback TCP address.
+    Tcp(SocketAddr),
+    /// A unix socket, created with mode `0600`.
+    Unix(PathBuf),
+}
+
+/// Parses `--serve`: `unix:<PATH>` or a loopback `ip:port`.
+///
+/// # Errors
+/// Returns an error for anything else, including non-loopback addresses,
+/// since the API is plain HTTP and returns private keys.
+fn parse_serve_addr(listen_addr: &str) -> Result<ServeAddr> {
+    if let Some(path) = listen_addr.strip_prefix(UNIX_PREFIX) {
+        if path.is_empty() {
+            anyhow::bail!("--serve {listen_addr} needs a socket path");
+        }
+        return Ok(ServeAddr::Unix(PathBuf::from(path)));
+    }
+    let addr: SocketAddr = listen_addr
+        .parse()
+        .with_context(|| format!("Invalid --serve address: {listen_addr}"))?;
+    if !addr.ip().is_loopback() {
+        anyhow::bail!(
+            "--serve {listen_addr} is not a loopback address: the issuance API is plain HTTP \
+             and returns private keys, so bind it to 127.0.0.1, [::1], or a unix:<PATH> socket"
+        );
+    }
+    Ok(ServeAddr::Tcp(addr))
+}
+
+/// Reads the API token from `token_file`, or from `BOOTROOT_API_TOKEN`
+/// when no file is given.
+///
+/// # Errors
+/// Returns an error if neither is set or the file cannot be read.
+async fn load_api_token(token_file: Option<&Path>) -> Result<String> {
+    let token = match token_file {
+        Some(path) => {
+            let contents = tokio::fs::read_to_string(path)
+                .await
+                .with_context(|| format!("Failed to read API token {}", path.display()))?;
+            contents
+                .lines()
+                .next()
+                .unwrap_or_default()
+                .trim()
+                .to_string()
+        }
+        None => std::env::var(API_TOKEN_ENV)
+            .map_err(|_| anyhow::anyhow!("--serve needs --api-token-file or {API_TOKEN_ENV}"))?,
+    };
+    Ok(token)
+}
+
+/// Serves `POST /issue` on `listen_addr` until Ctrl-C.
+///
+/// # Errors
+/// Returns an error if the address or token is invalid or the listener
+/// fails.
+pub(crate) async fn run_serve(
+    settings: Arc<config::Settings>,
+    default_eab: Option<eab::EabCredentials>,
+    listen_addr: &str,
+    api_token_file: Option<&Path>,
+    insecure_mode: bool,
+) -> Result<()> {
+    let addr = parse_serve_addr(listen_addr)?;
+    let state = Arc::new(ServeState {
+        semaphore: Semaphore::new(profile::max_concurrent_issuances(&settings)?),
+        settings,
+        default_eab,
+        insecure_mode,
+        token: ApiToken::new(&load_api_token(api_token_file).await?)?,
+    });
+    match addr {
+        ServeAddr::Tcp(addr) => serve_on(TcpListener::bind(addr), state, listen_addr).await,
+        #[cfg(unix)]
+        ServeAddr::Unix(path) => {
+            use std::os::unix::fs::{FileTypeExt, PermissionsExt};
+
+            // A socket left behind by an earlier run would fail the bind.
+            if std::fs::symlink_metadata(&path).is_ok_and(|meta| meta.file_type().is_socket()) {
+                std::fs::remove_file(&path)
+                    .with_context(|| format!("Failed to remove stale socket {}", path.display()))?;
+            }
+            let listener = poem::listener::UnixListener::bind(&path)
+                .with_permission(std::fs::Permissions::from_mode(0o600));
+            serve_on(listener, state, listen_addr).await
+        }
+        #[cfg(not(unix))]
+        ServeAddr::Unix(_) => anyhow::bail!("--serve unix:<PATH> needs a unix platform"),
+    }
+}
+
+async fn serve_on(
+    listener: impl Listener + 'static,
+    state: Arc<ServeState>,
+    label: &str,
+) -> Result<()> {
+    info!("Starting issuance API on {label}");
+    Server::new(listener)
+        .run_with_graceful_shutdown(
+            serve_app(state),
+            async {
+                let _ = tokio::signal::ctrl_c().await;
+            },
+            None,
+        )
+        .await
+        .with_context(|| format!("Issuance API on {label} failed"))
+}
+
+fn serve_app(state: Arc<ServeState>) -> impl Endpoint {
+    Route::new()
+        .at(ISSUE_PATH, poem::post(issue))
+        .with(SizeLimit::new(MAX_BODY_BYTES))
+        .data(state)
+}
+
+#[handler]
+async fn issue(
+    req: &Request,
+    body: poem::Result<Json<IssueRequest>>,
+    Data(state): Data<&Arc<ServeState>>,
+) -> Response {
+    let authorized = req
+        .header(poem::http::header::AUTHORIZATION)
+        .and_then(|value| value.strip_prefix(BEARER_PREFIX))
+        .is_some_and(|token| state.token.matches(token));
+    if !authorized {
+        return error_response(StatusCode::UNAUTHORIZED, "missing or invalid API token");
+    }
+    let request = match body {
+        Ok(Json(request)) => request,
+        Err(err) => return error_response(StatusCode::BAD_REQUEST, &err.to_string()),
+    };
+    let profile = match request_profile(&request) {
+        Ok(profile) => profile,
+        Err(err) => return error_response(StatusCode::BAD_REQUEST, &err.to_string()),
+    };
+
+    let Ok(_permit) = state.semaphore.acquire().await else {
+        return error_response(StatusCode::SERVICE_UNAVAILABLE, "issuance API is stopping");
+    };
+    let domain = config::profile_domain(&state.settings, &profile);
+    let profile_eab = profile::resolve_profile_eab(&profile, state.default_eab.clone());
+    let run_id = run_id::generate();
+    let issued = run_id::scope(run_id.clone(), async {
+        info!("Issuance API request for {domain}");
+        let issued =
+            acme::obtain_certificate(&state.settings, &profile, profile_eab, state.insecure_mode)
+                .await;
+        if let Err(err) = &issued {
+            error!("Issuance API request for {domain} failed: {err:#}");
+        }
+        issued
+    })
+    .await;
+    match issued {
+        Ok(acme::IssuedCertificate {
+            cert_pem,
+            key_pem: Some(key_pem),
+        }) => match cert_metadata::spki_sha256_pin(&cert_pem) {
+            Ok(spki_sha256) => Json(IssueResponse {
+                domain,
+                cert_pem,
+                key_pem,
+                spki_sha256,
+                run_id,
+            })
+            .into_response(),
+            Err(err) => error_response(StatusCode::INTERNAL_SERVER_ERROR, &format!("{err:#}")),
+        },
+        Ok(acme::IssuedCertificate { key_pem: None, .. }) => error_response(
+            StatusCode::INTERNAL_SERVER_ERROR,
+            "issued certificate has no private key",
+        ),
+        Err(err) => (
+            StatusCode::BAD_GATEWAY,
+            Json(json!({ "error": format!("{err:#}"), "run_id": run_id })),
+        )
+            .into_response(),
+    }
+}
+
+/// Builds the transient profile for one request. Output paths stay empty
+/// because the API never writes files.
+fn request_profile(request: &IssueRequest) -> Result<config::DaemonProfileSettings> {
+    if input_validation::validate_dns_label(&request.service_name).is_err() {
+        anyhow::bail!("service_name must be a DNS label");
+    }
+    if input_validation::validate_numeric_instance_id(&request.instance_id).is_err() {
+        anyhow::bail!("instance_id must be numeric");
+    }
+    if input_validation::domain_to_ascii(&request.hostname).is_err() {
+        anyhow::bail!("hostname must be a valid DNS name");
+    }
+    Ok(config::DaemonProfileSettings {
+        service_name: request.service_name.clone(),
+        instance_id: request.instance_id.clone(),
+        hostname: request.hostname.clone(),
+        ..config::DaemonProfileSettings::default()
+    })
+}
+
+fn error_response(status: StatusCode, message: &str) -> Response {
+    (status, Json(json!({ "error": message }))).into_response()
+}
+
+#[cfg(test)]
+mod tests {
+    use poem::http::{Method, Uri};
+    use serde_json::Value;
+
+    use super::*;
+
+    const TEST_TOKEN: &str = "s3cr3t-token";
+
+    fn test_state() -> Arc<ServeState> {
+        let mut file = tempfile::Builder::new().suffix(".toml").tempfile().unwrap();
+        std::io::Write::write_all(&mut file, b"domain = \"trusted.domain\"\n").unwrap();
+        let settings = config::Settings::new(Some(file.path().to_path_buf())).unwrap();
+        Arc::new(ServeState {
+            settings: Arc::new(settings),
+            default_eab: None,
+            insecure_mode: false,
+            token: ApiToken::new(TEST_TOKEN).unwrap(),
+            semaphore: Semaphore::new(1),
+        })
+    }
+
+    fn issue_request(token: Option<&str>, body: &str) -> Request {
+        let mut builder = Request::builder()
+            .method(Method::POST)
+            .uri(Uri::from_static(ISSUE_PATH))
+            .content_type("application/json");
+        if let Some(token) = token {
+            builder = builder.header(
+                poem::http::header::AUTHORIZATION,
+                format!("{BEARER_PREFIX}{token}"),
+            );
+        }
+        builder.body(body.to_string())
+    }
+
+    async fn error_of(response: poem::Response) -> String {
+        let body: Value =
+            serde_json::from_str(&response.into_body().into_string().await.unwrap()).unwrap();
+        body["error"].as_str().unwrap().to_string()
+    }
+
+    #[test]
+    fn test_api_token_matches_only_configured_token() {
+        let token = ApiToken::new(TEST_TOKEN).unwrap();
+
+        assert!(token.matches(TEST_TOKEN));
+        assert!(!token.matches("other"));
+        assert!(!token.matches(""));
+        assert!(ApiToken::new("  ").is_err());
+    }
+
+    #[test]
+    fn test_parse_serve_addr_accepts_only_loopback_and_unix_sockets() {
+        assert_eq!(
+            parse_serve_addr("127.0.0.1:8443").unwrap(),
+            ServeAddr::Tcp("127.0.0.1:8443".parse().unwrap())
+        );
+        assert!(parse_serve_addr("[::1]:8443").is_ok());
+        assert_eq!(
+            parse_serve_addr("unix:/run/bootroot/issue.sock").unwrap(),
+            ServeAddr::Unix(PathBuf::from("/run/bootroot/issue.sock"))
+        );
+
+        let err = parse_serve_addr("0.0.0.0:8443").unwrap_err();
+        assert!(
+            err.to_string().contains("not a loopback address"),
+            "{err:#}"
+        );
+        assert!(parse_serve_addr("10.0.0.5:8443").is_err());
+        assert!(parse_serve_addr("unix:").is_err());
+    }
+
+    #[tokio::test]
+    async fn test_load_api_token_reads_first_line_of_file() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("api-token");
+        std::fs::write(&path, "s3cr3t-token\n").unwrap();
+
+        assert_eq!(load_api_token(Some(&path)).await.unwrap(), "s3cr3t-token");
+        assert!(
+            load_api_token(Some(&dir.path().join("missing")))
+                .await
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_request_profile_validates_identity() {
+        let valid = IssueRequest {
+            service_name: "edge-proxy".to_string(),
+            instance_id: "001".to_string(),
+            hostname: "edge-node-01".to_string(),
+        };
+        let profile = request_profile(&valid).unwrap();
+        assert_eq!(profile.service_name, "edge-proxy");
+        assert!(profile.pkcs11.is_none());
+
+        let bad_instance = IssueRequest {
+            instance_id: "abc".to_string(),
+            ..valid
+        };
+        let err = request_profile(&bad_instance).unwrap_err();
+        assert!(err.to_string().contains("instance_id"));
+    }
+
+    #[tokio::test]
+    async fn test_issue_rejects_missing_token() {
+        let app = serve_app(test_state());
+
+        let response = app
+            .call(issue_request(None, "{}"))
+            .await
+            .unwrap_or_else(poem::Error::into_response);
+
+        assert_eq!(response.status(), StatusCode::UNAUTHORIZED);
+    }
+
+    #[tokio::test]
+    async fn test_issue_rejects_wrong_token() {
+        let app = serve_app(test_state());
+
+        let response = app
+            .call(issue_request(Some("wrong"), "{}"))
+            .await
+            .unwrap_or_else(poem::Error::into_response);
+
+        assert_eq!(response.status(), StatusCode::UNAUTHORIZED);
+        assert!(error_of(response).await.contains("API token"));
+    }
+
+    #[tokio::test]
+    async fn test_issue_rejects_invalid_identity() {
+        let app = serve_app(test_state());
+        let body = r#"{"service_name":"edge proxy","instance_id":"001","hostname":"node"}"#;
+
+        let response = app
+            .call(issue_request(Some(TEST_TOKEN), body))
+            .await
+            .unwrap_or_else(poem::Error::into_response);
+
+        assert_eq!(response.status(), StatusCode::BAD_REQUEST);
+        assert!(error_of(response).await.contains("service_name"));
+    }
+
+    #[tokio::test]
+    async fn test_issue_rejects_unknown_fields() {
+        let app = serve_app(test_state());
+        let body = r#"{"service_name":"edge","instance_id":"001","hostname":"node","ttl":1}"#;
+
+        let response = app
+            .call(issue_request(Some(TEST_TOKEN), body))
+            .await
+            .unwrap_or_else(poem::Error::into_response);
+
+        assert_eq!(response.status(), StatusCode::BAD_REQUEST);
+    }
+}
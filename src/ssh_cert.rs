@@ -0,0 +1,381 @@
+//! SSH certificates from step-ca (`bootroot-agent --ssh-sign`).
+//!
+//! step-ca signs SSH certificates through its `/ssh/sign` API rather than
+//! ACME, so ACME provisioners cannot authorize them. The request carries
+//! a one-time token from an SSH-capable provisioner of the same CA (JWK
+//! or OIDC, for example `step ca token --ssh --host <name>`). Before
+//! signing, the agent asks `/ssh/roots` whether the CA has SSH enabled
+//! and holds a CA key for the requested certificate type, and stops with
+//! a clear error when it does not. The certificate is written next to
+//! the public key as `<name>-cert.pub`, where OpenSSH looks for it.
+
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+use base64::Engine;
+use reqwest::{StatusCode, Url};
+use serde::{Deserialize, Serialize};
+use tracing::info;
+
+use crate::config::Settings;
+use crate::{fs_util, tls};
+
+const SSH_ROOTS_PATH: &str = "/ssh/roots";
+const SSH_SIGN_PATH: &str = "/ssh/sign";
+const PUBLIC_KEY_SUFFIX: &str = ".pub";
+const CERT_SUFFIX: &str = "-cert.pub";
+const CERT_FILE_MODE: u32 = 0o644;
+
+/// Kind of SSH certificate to request.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Serialize, clap::ValueEnum)]
+#[serde(rename_all = "lowercase")]
+pub enum SshCertType {
+    /// Authenticates a user to hosts that trust the user CA.
+    #[default]
+    User,
+    /// Authenticates a host to clients that trust the host CA.
+    Host,
+}
+
+impl SshCertType {
+    fn label(self) -> &'static str {
+        match self {
+            Self::User => "user",
+            Self::Host => "host",
+        }
+    }
+}
+
+/// What `--ssh-sign` asks the CA for.
+#[derive(Debug, Clone)]
+pub struct SshSignRequest {
+    /// OpenSSH public key to certify (`<type> <base64> [comment]`).
+    pub public_key: PathBuf,
+    pub cert_type: SshCertType,
+    pub principals: Vec<String>,
+    /// File whose first line is the provisioner's one-time token.
+    pub token_file: PathBuf,
+}
+
+/// Body of step-ca's `GET /ssh/roots` response.
+#[derive(Debug, Deserialize)]
+struct SshRoots {
+    #[serde(default, rename = "userKey")]
+    user_key: Vec<String>,
+    #[serde(default, rename = "hostKey")]
+    host_key: Vec<String>,
+}
+
+#[derive(Debug, Serialize)]
+struct SignBody<'a> {
+    #[serde(rename = "publicKey")]
+    public_key: &'a str,
+    ott: &'a str,
+    #[serde(rename = "certType")]
+    cert_type: SshCertType,
+    principals: &'a [String],
+}
+
+/// Body of step-ca's `POST /ssh/sign` response; `crt` is the
+/// base64-encoded certificate blob.
+#[derive(Debug, Deserialize)]
+struct SignResponse {
+    crt: String,
+}
+
+/// Asks the CA behind `server` to sign `request.public_key` and writes
+/// the certificate in OpenSSH format. Returns the certificate path.
+///
+/// # Errors
+/// Returns an error if the public key or token cannot be read, the CA
+/// has no SSH CA key for the requested type, the CA rejects the token or
+/// principals, or the certificate cannot be written.
+pub async fn sign_certificate(
+    settings: &Settings,
+    request: &SshSignRequest,
+    insecure_mode: bool,
+) -> Result<PathBuf> {
+    let public_key = read_public_key(&request.public_key).await?;
+    let token = read_token(&request.token_file).await?;
+    let origin = ca_origin(&settings.server, settings.acme.allow_insecure_http)?;
+    let client = tls::build_http_client(&settings.trust, insecure_mode)?;
+
+    check_ssh_capability(&client, &origin, request.cert_type).await?;
+
+    let url = origin.join(SSH_SIGN_PATH)?;
+    let response = client
+        .post(url.clone())
+        .json(&SignBody {
+            public_key: &public_key,
+            ott: &token,
+            cert_type: request.cert_type,
+            principals: &request.principals,
+        })
+        .send()
+        .await
+        .with_context(|| format!("Failed to reach {url}"))?;
+    let status = response.status();
+    if !status.is_success() {
+        let body = response.text().await.unwrap_or_default();
+        anyhow::bail!("{url} refused to sign the SSH certificate ({status}): {body}");
+    }
+    let signed: SignResponse = response
+        .json()
+        .await
+        .with_context(|| format!("{url} did not return a {{\"crt\": ...}} body"))?;
+
+    let cert_line = openssh_cert_line(&signed.crt)?;
+    let path = cert_path(&request.public_key);
+    fs_util::atomic_write(&path, cert_line.as_bytes(), CERT_FILE_MODE).await?;
+    info!(
+        "SSH {} certificate for {} saved to: {:?}",
+        request.cert_type.label(),
+        request.principals.join(", "),
+        path
+    );
+    Ok(path)
+}
+
+/// Fails unless the CA serves `/ssh/roots` with a CA key for
+/// `cert_type`; a CA without SSH enabled answers `404`.
+async fn check_ssh_capability(
+    client: &reqwest::Client,
+    origin: &Url,
+    cert_type: SshCertType,
+) -> Result<()> {
+    let url = origin.join(SSH_ROOTS_PATH)?;
+    let response = client
+        .get(url.clone())
+        .send()
+        .await
+        .with_context(|| format!("Failed to reach {url}"))?;
+    if response.status() == StatusCode::NOT_FOUND {
+        anyhow::bail!(
+            "CA at {origin} does not have SSH enabled ({url} returned 404); \
+             configure step-ca's ssh hostKey and userKey first"
+        );
+    }
+    if !response.status().is_success() {
+        anyhow::bail!("{url} returned {}", response.status());
+    }
+    let roots: SshRoots = response
+        .json()
+        .await
+        .with_context(|| format!("{url} did not return SSH CA keys"))?;
+    let keys = match cert_type {
+        SshCertType::User => &roots.user_key,
+        SshCertType::Host => &roots.host_key,
+    };
+    if keys.is_empty() {
+        anyhow::bail!(
+            "CA at {origin} has no SSH {} CA key; it cannot sign {} certificates",
+            cert_type.label(),
+            cert_type.label()
+        );
+    }
+    Ok(())
+}
+
+/// Returns the base64 key blob of an OpenSSH public key file.
+async fn read_public_key(path: &Path) -> Result<String> {
+    let contents = tokio::fs::read_to_string(path)
+        .await
+        .with_context(|| format!("Failed to read SSH public key {}", path.display()))?;
+    let mut fields = contents.split_whitespace();
+    let (Some(_key_type), Some(blob)) = (fields.next(), fields.next()) else {
+        anyhow::bail!("{} is not an OpenSSH public key", path.display());
+    };
+    base64::engine::general_purpose::STANDARD
+        .decode(blob)
+        .with_context(|| format!("{} is not an OpenSSH public key", path.display()))?;
+    Ok(blob.to_string())
+}
+
+async fn read_token(path: &Path) -> Result<String> {
+    let contents = tokio::fs::read_to_string(path)
+        .await
+        .with_context(|| format!("Failed to read SSH token {}", path.display()))?;
+    let token = contents.lines().next().unwrap_or_default().trim();
+    if token.is_empty() {
+        anyhow::bail!("SSH token file {} is empty", path.display());
+    }
+    Ok(token.to_string())
+}
+
+/// Returns the origin of the ACME directory URL, where step-ca serves
+/// its SSH API.
+fn ca_origin(server: &str, allow_insecure_http: bool) -> Result<Url> {
+    let mut url = Url::parse(server.trim())
+        .with_context(|| format!("server is not a valid URL: {server}"))?;
+    if url.scheme() != "https" && !(url.scheme() == "http" && allow_insecure_http) {
+        anyhow::bail!("--ssh-sign requires an https:// server URL, got {server}");
+    }
+    url.set_path("/");
+    url.set_query(None);
+    url.set_fragment(None);
+    Ok(url)
+}
+
+/// Formats the certificate blob as an OpenSSH `*-cert.pub` line, taking
+/// the key type from the blob's leading string.
+fn openssh_cert_line(crt: &str) -> Result<String> {
+    let blob = base64::engine::general_purpose::STANDARD
+        .decode(crt.trim())
+        .context("CA returned an SSH certificate that is not base64")?;
+    let key_type = blob
+        .get(..4)
+        .and_then(|len| {
+            let len = u32::from_be_bytes(len.try_into().ok()?);
+            blob.get(4..4 + usize::try_from(len).ok()?)
+        })
+        .and_then(|name| std::str::from_utf8(name).ok())
+        .filter(|name| name.ends_with("-cert-v01@openssh.com"))
+        .ok_or_else(|| anyhow::anyhow!("CA returned a blob that is not an SSH certificate"))?;
+    Ok(format!("{key_type} {}\n", crt.trim()))
+}
+
+/// `id_ecdsa.pub` becomes `id_ecdsa-cert.pub`; a name without `.pub`
+/// gets `-cert.pub` appended.
+fn cert_path(public_key: &Path) -> PathBuf {
+    let name = public_key
+        .file_name()
+        .map(|name| name.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    let stem = name.strip_suffix(PUBLIC_KEY_SUFFIX).unwrap_or(&name);
+    public_key.with_file_name(format!("{stem}{CERT_SUFFIX}"))
+}
+
+#[cfg(test)]
+mod tests {
+    use wiremock::matchers::{body_partial_json, method, path};
+    use wiremock::{Mock, MockServer, ResponseTemplate};
+
+    use super::*;
+
+    const CERT_TYPE: &str = "ecdsa-sha2-nistp256-cert-v01@openssh.com";
+
+    fn cert_blob() -> String {
+        let mut blob = u32::try_from(CERT_TYPE.len())
+            .unwrap()
+            .to_be_bytes()
+            .to_vec();
+        blob.extend_from_slice(CERT_TYPE.as_bytes());
+        blob.extend_from_slice(b"rest-of-certificate");
+        base64::engine::general_purpose::STANDARD.encode(blob)
+    }
+
+    fn request(dir: &Path, cert_type: SshCertType) -> SshSignRequest {
+        let public_key = dir.join("ssh_host_ecdsa_key.pub");
+        std::fs::write(
+            &public_key,
+            "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTY= root@edge-node-01\n",
+        )
+        .unwrap();
+        let token_file = dir.join("ssh.token");
+        std::fs::write(&token_file, "eyJhbGciOiJFUzI1NiJ9.token\n").unwrap();
+        SshSignRequest {
+            public_key,
+            cert_type,
+            principals: vec!["edge-node-01.internal".to_string()],
+            token_file,
+        }
+    }
+
+    fn settings_for(server: &MockServer) -> Settings {
+        let mut settings = Settings::new(None).expect("settings must load");
+        settings.server = format!("{}/acme/acme/directory", server.uri());
+        settings.acme.allow_insecure_http = true;
+        settings
+    }
+
+    #[tokio::test]
+    async fn test_sign_certificate_writes_openssh_cert_next_to_public_key() {
+        let server = MockServer::start().await;
+        Mock::given(method("GET"))
+            .and(path("/ssh/roots"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "userKey": ["ecdsa-sha2-nistp256 AAAAuser"],
+                "hostKey": ["ecdsa-sha2-nistp256 AAAAhost"],
+            })))
+            .mount(&server)
+            .await;
+        Mock::given(method("POST"))
+            .and(path("/ssh/sign"))
+            .and(body_partial_json(serde_json::json!({
+                "publicKey": "AAAAE2VjZHNhLXNoYTItbmlzdHAyNTY=",
+                "ott": "eyJhbGciOiJFUzI1NiJ9.token",
+                "certType": "host",
+                "principals": ["edge-node-01.internal"],
+            })))
+            .respond_with(
+                ResponseTemplate::new(201).set_body_json(serde_json::json!({ "crt": cert_blob() })),
+            )
+            .expect(1)
+            .mount(&server)
+            .await;
+        let dir = tempfile::tempdir().unwrap();
+
+        let path = sign_certificate(
+            &settings_for(&server),
+            &request(dir.path(), SshCertType::Host),
+            false,
+        )
+        .await
+        .unwrap();
+
+        assert_eq!(path, dir.path().join("ssh_host_ecdsa_key-cert.pub"));
+        assert_eq!(
+            std::fs::read_to_string(&path).unwrap(),
+            format!("{CERT_TYPE} {}\n", cert_blob())
+        );
+    }
+
+    #[tokio::test]
+    async fn test_sign_certificate_requires_ssh_enabled_for_the_type() {
+        let server = MockServer::start().await;
+        Mock::given(method("GET"))
+            .and(path("/ssh/roots"))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "userKey": ["ecdsa-sha2-nistp256 AAAAuser"],
+            })))
+            .mount(&server)
+            .await;
+        let dir = tempfile::tempdir().unwrap();
+
+        let err = sign_certificate(
+            &settings_for(&server),
+            &request(dir.path(), SshCertType::Host),
+            false,
+        )
+        .await
+        .unwrap_err();
+
+        assert!(err.to_string().contains("no SSH host CA key"), "{err:#}");
+        assert_eq!(server.received_requests().await.unwrap().len(), 1);
+
+        let disabled = MockServer::start().await;
+        let err = sign_certificate(
+            &settings_for(&disabled),
+            &request(dir.path(), SshCertType::User),
+            false,
+        )
+        .await
+        .unwrap_err();
+        assert!(
+            err.to_string().contains("does not have SSH enabled"),
+            "{err:#}"
+        );
+    }
+
+    #[test]
+    fn test_cert_path_follows_openssh_naming() {
+        assert_eq!(
+            cert_path(Path::new("/etc/ssh/ssh_host_ecdsa_key.pub")),
+            PathBuf::from("/etc/ssh/ssh_host_ecdsa_key-cert.pub")
+        );
+        assert_eq!(
+            cert_path(Path::new("id_ed25519")),
+            PathBuf::from("id_ed25519-cert.pub")
+        );
+    }
+}
@@ -0,0 +1,187 @@
+//! OCSP stapling test harness for `bootroot-agent --oneshot --staple-test`.
+//!
+//! After the oneshot issuance, the agent fetches a fresh OCSP response
+//! for the first profile's certificate and serves that certificate over
+//! TLS on the `--staple-test` address with the response stapled, so an
+//! operator can check a Must-Staple setup with
+//! `openssl s_client -connect <addr> -status` or a browser. Every
+//! request gets a fixed plain-text reply. This is a diagnostic, not a
+//! production server: it runs until Ctrl-C and reuses rustls defaults.
+
+use std::io::BufReader;
+use std::net::SocketAddr;
+use std::sync::Arc;
+
+use anyhow::{Context, Result};
+use rustls::pki_types::{CertificateDer, PrivateKeyDer, PrivatePkcs8KeyDer};
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
+use tokio::net::TcpListener;
+use tokio_rustls::TlsAcceptor;
+use tracing::{info, warn};
+
+use crate::acme::ocsp;
+use crate::{cert_chain, config};
+
+const RESPONSE_BODY: &str =
+    "bootroot staple test: the OCSP response is stapled to this handshake\n";
+const MAX_REQUEST_BYTES: usize = 8 * 1024;
+
+/// Serves the first profile's certificate with a stapled OCSP response
+/// on `listen_addr` until Ctrl-C.
+///
+/// # Errors
+/// Returns an error if the address is invalid, the certificate or key
+/// cannot be read, the certificate names no OCSP responder, the OCSP
+/// request fails, or the listener cannot be bound.
+pub(crate) async fn run_staple_test(
+    settings: &config::Settings,
+    listen_addr: &str,
+    insecure_mode: bool,
+) -> Result<()> {
+    let addr: SocketAddr = listen_addr
+        .parse()
+        .with_context(|| format!("Invalid --staple-test address: {listen_addr}"))?;
+    let profile = settings
+        .profiles
+        .first()
+        .ok_or_else(|| anyhow::anyhow!("--staple-test needs at least one profile"))?;
+    if profile.pkcs11.is_some() {
+        anyhow::bail!("--staple-test needs the private key file; a PKCS#11 key cannot be served");
+    }
+    let cert_pem = cert_chain::cert_file_pem(
+        tokio::fs::read(&profile.paths.cert)
+            .await
+            .with_context(|| format!("Failed to read {}", profile.paths.cert.display()))?,
+    );
+    let key_bytes = tokio::fs::read(&profile.paths.key)
+        .await
+        .with_context(|| format!("Failed to read {}", profile.paths.key.display()))?;
+
+    let mut issuer_pem = cert_pem.clone();
+    for path in [
+        profile.paths.chain.as_ref(),
+        settings.trust.ca_bundle_path.as_ref(),
+    ]
+    .into_iter()
+    .flatten()
+    {
+        if let Ok(bytes) = tokio::fs::read(path).await {
+            issuer_pem.extend(bytes);
+        }
+    }
+    let response = ocsp::fetch_response(settings, &cert_pem, &issuer_pem, insecure_mode)
+        .await?
+        .ok_or_else(|| {
+            anyhow::anyhow!("The certificate names no OCSP responder; nothing to staple")
+        })?;
+    match response.status() {
+        Ok(ocsp::OcspStatus::Good) => info!("OCSP responder reports the certificate as good."),
+        Ok(status) => warn!("OCSP responder reports {status:?}; stapling it anyway."),
+        Err(err) => warn!("OCSP response is not usable ({err:#}); stapling it anyway."),
+    }
+
+    let config = server_config(&cert_pem, &key_bytes, response.der)?;
+    let acceptor = TlsAcceptor::from(Arc::new(config));
+    let listener = TcpListener::bind(addr)
+        .await
+        .with_context(|| format!("Failed to bind --staple-test address {addr}"))?;
+    info!("Staple test server on {addr}; try: openssl s_client -connect {addr} -status");
+    loop {
+        tokio::select! {
+            _ = tokio::signal::ctrl_c() => {
+                info!("Staple test server stopped.");
+                return Ok(());
+            }
+            accepted = listener.accept() => {
+                let (stream, peer) = match accepted {
+                    Ok(value) => value,
+                    Err(err) => {
+                        warn!("Staple test accept failed: {err}");
+                        continue;
+                    }
+                };
+                let acceptor = acceptor.clone();
+                tokio::spawn(async move {
+                    if let Err(err) = serve_connection(acceptor, stream).await {
+                        warn!("Staple test connection from {peer} failed: {err:#}");
+                    }
+                });
+            }
+        }
+    }
+}
+
+/// Builds the TLS config that presents `cert_pem` with `ocsp_der`
+/// stapled. `key_bytes` is a PEM private key or, for `format = "der"`
+/// profiles, a PKCS#8 DER key.
+fn server_config(
+    cert_pem: &[u8],
+    key_bytes: &[u8],
+    ocsp_der: Vec<u8>,
+) -> Result<rustls::ServerConfig> {
+    let certs: Vec<CertificateDer<'static>> = rustls_pemfile::certs(&mut BufReader::new(cert_pem))
+        .collect::<std::result::Result<_, _>>()
+        .context("Failed to parse the certificate file")?;
+    if certs.is_empty() {
+        anyhow::bail!("The certificate file holds no certificate");
+    }
+    let key = if key_bytes.trim_ascii_start().starts_with(b"-----BEGIN") {
+        rustls_pemfile::private_key(&mut BufReader::new(key_bytes))
+            .context("Failed to parse the private key file")?
+            .ok_or_else(|| anyhow::anyhow!("The private key file holds no private key"))?
+    } else {
+        PrivateKeyDer::from(PrivatePkcs8KeyDer::from(key_bytes.to_vec()))
+    };
+    let _ = rustls::crypto::ring::default_provider().install_default();
+    rustls::ServerConfig::builder()
+        .with_no_client_auth()
+        .with_single_cert_with_ocsp(certs, key, ocsp_der)
+        .context("Failed to build the staple test TLS config")
+}
+
+async fn serve_connection(acceptor: TlsAcceptor, stream: tokio::net::TcpStream) -> Result<()> {
+    let mut tls = acceptor.accept(stream).await.context("TLS handshake")?;
+    // Read whatever the client sends first (typically one HTTP request)
+    // so a browser gets its reply; the content is ignored.
+    let mut request = vec![0; MAX_REQUEST_BYTES];
+    let _ = tls.read(&mut request).await;
+    let response = format!(
+        "HTTP/1.1 200 OK\r\ncontent-type: text/plain\r\ncontent-length: {}\r\nconnection: close\r\n\r\n{RESPONSE_BODY}",
+        RESPONSE_BODY.len()
+    );
+    tls.write_all(response.as_bytes()).await?;
+    tls.shutdown().await?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_server_config_accepts_pem_and_der_keys() {
+        let rcgen::CertifiedKey { cert, signing_key } =
+            rcgen::generate_simple_self_signed(vec!["localhost".to_string()]).unwrap();
+        let ocsp_der = vec![0x30, 0x03, 0x0a, 0x01, 0x00];
+
+        assert!(
+            server_config(
+                cert.pem().as_bytes(),
+                signing_key.serialize_pem().as_bytes(),
+                ocsp_der.clone()
+            )
+            .is_ok()
+        );
+        assert!(
+            server_config(
+                cert.pem().as_bytes(),
+                &signing_key.serialize_der(),
+                ocsp_der.clone()
+            )
+            .is_ok()
+        );
+        let err = server_config(b"", signing_key.serialize_pem().as_bytes(), ocsp_der)
+            .expect_err("no certificate");
+        assert!(err.to_string().contains("no certificate"));
+    }
+}
@@ -0,0 +1,438 @@
+//! Tracks per-profile renewal outcomes and serves them over HTTP.
+//!
+//! In daemon mode the agent records the last success, the last error,
+//! the current certificate's `NotAfter`, the next scheduled check, and
+//! the phase timings of the last issuance for every profile. When `[status] listen_addr` is set, the daemon
+//! exposes that snapshot as JSON on `GET /status` so orchestrators can
+//! probe the agent without scraping logs. `[status] health_addr` serves a
+//! bare `GET /healthz` liveness answer for the duration of a oneshot run.
+
+use std::collections::BTreeMap;
+use std::net::SocketAddr;
+use std::path::Path;
+use std::sync::{Arc, Mutex as StdMutex};
+use std::time::SystemTime;
+
+use anyhow::{Context, Result};
+use poem::listener::TcpListener;
+use poem::web::{Data, Json};
+use poem::{Endpoint, EndpointExt, Route, Server, handler};
+use serde::Serialize;
+use tokio::sync::watch;
+use tracing::{debug, info};
+
+use crate::acme::timing::PhaseTimings;
+use crate::daemon::parse_cert_not_after;
+use crate::{cert_chain, cert_metadata, run_id};
+
+const STATUS_PATH: &str = "/status";
+const HEALTH_PATH: &str = "/healthz";
+
+/// Snapshot of a single profile's renewal state.
+///
+/// Timestamps are RFC 3339 strings in UTC; fields stay `None` until the
+/// corresponding event has been observed.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub(crate) struct ProfileStatus {
+    pub(crate) last_success_at: Option<String>,
+    pub(crate) last_error: Option<String>,
+    pub(crate) last_error_at: Option<String>,
+    pub(crate) cert_not_after: Option<String>,
+    pub(crate) next_check_at: Option<String>,
+    /// Phase timings of the issuance that produced the current
+    /// certificate, read from its sidecar metadata.
+    pub(crate) last_issuance_timings: Option<PhaseTimings>,
+    /// Run ID of the last renewal cycle that succeeded or failed.
+    pub(crate) last_run_id: Option<String>,
+}
+
+/// JSON body returned by `GET /status`.
+#[derive(Debug, Clone, Serialize)]
+pub(crate) struct StatusReport {
+    pub(crate) profiles: BTreeMap<String, ProfileStatus>,
+}
+
+/// Shared in-memory registry of per-profile status, keyed by profile
+/// label.
+pub(crate) struct StatusRegistry {
+    profiles: StdMutex<BTreeMap<String, ProfileStatus>>,
+}
+
+impl StatusRegistry {
+    pub(crate) fn new() -> Self {
+        Self {
+            profiles: StdMutex::new(BTreeMap::new()),
+        }
+    }
+
+    /// Records a successful issuance. The last error is kept so the
+    /// report still explains the most recent failure.
+    pub(crate) fn record_success(&self, profile_label: &str, at: SystemTime) {
+        self.update(profile_label, |status| {
+            status.last_success_at = Some(format_timestamp(at));
+            status.last_run_id = run_id::current();
+        });
+    }
+
+    /// Records a failed renewal check or issuance.
+    pub(crate) fn record_failure(&self, profile_label: &str, error: &str, at: SystemTime) {
+        self.update(profile_label, |status| {
+            status.last_error = Some(error.to_string());
+            status.last_error_at = Some(format_timestamp(at));
+            status.last_run_id = run_id::current();
+        });
+    }
+
+    /// Records the time the next periodic check is scheduled for.
+    pub(crate) fn record_next_check(&self, profile_label: &str, at: SystemTime) {
+        self.update(profile_label, |status| {
+            status.next_check_at = Some(format_timestamp(at));
+        });
+    }
+
+    /// Re-reads the certificate at `cert_path` and records its
+    /// `NotAfter`, clearing the value when the file is missing or
+    /// cannot be parsed.
+    pub(crate) async fn refresh_cert_not_after(&self, profile_label: &str, cert_path: &Path) {
+        let not_after = match tokio::fs::read(cert_path).await {
+            Ok(bytes) => match parse_cert_not_after(&cert_chain::cert_file_pem(bytes)) {
+                Ok(not_after) => Some(format_timestamp(SystemTime::from(not_after))),
+                Err(err) => {
+                    debug!("Profile '{profile_label}' status: cannot parse certificate: {err}");
+                    None
+                }
+            },
+            Err(err) => {
+                debug!("Profile '{profile_label}' status: cannot read certificate: {err}");
+                None
+            }
+        };
+        self.update(profile_label, |status| status.cert_not_after = not_after);
+    }
+
+    /// Re-reads the sidecar metadata of the certificate at `cert_path`
+    /// and records its issuance phase timings, clearing the value when
+    /// the sidecar is missing, unreadable, or predates phase timing.
+    pub(crate) async fn refresh_issuance_timings(&self, profile_label: &str, cert_path: &Path) {
+        let timings =
+            match cert_metadata::read_metadata(&cert_metadata::metadata_path(cert_path)).await {
+                Ok(metadata) => metadata.phase_timings,
+                Err(err) => {
+                    debug!("Profile '{profile_label}' status: cannot read metadata: {err:#}");
+                    None
+                }
+            };
+        self.update(profile_label, |status| {
+            status.last_issuance_timings = timings;
+        });
+    }
+
+    /// Returns a copy of the current status of every profile.
+    pub(crate) fn report(&self) -> StatusReport {
+        let guard = self.profiles.lock().expect("StatusRegistry mutex poisoned");
+        StatusReport {
+            profiles: guard.clone(),
+        }
+    }
+
+    fn update(&self, profile_label: &str, apply: impl FnOnce(&mut ProfileStatus)) {
+        let mut guard = self.profiles.lock().expect("StatusRegistry mutex poisoned");
+        apply(guard.entry(profile_label.to_string()).or_default());
+    }
+}
+
+impl Default for StatusRegistry {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+/// Serves `GET /status` on `listen_addr` until `shutdown` flips.
+///
+/// # Errors
+/// Returns an error if the address is invalid or the listener fails.
+pub(crate) async fn serve(
+    listen_addr: &str,
+    registry: Arc<StatusRegistry>,
+    mut shutdown: watch::Receiver<bool>,
+) -> Result<()> {
+    let addr: SocketAddr = listen_addr
+        .parse()
+        .with_context(|| format!("Invalid status.listen_addr: {listen_addr}"))?;
+    info!("Starting status endpoint on {addr}");
+    Server::new(TcpListener::bind(addr))
+        .run_with_graceful_shutdown(
+            status_app(registry),
+            async move {
+                let _ = shutdown.changed().await;
+            },
+            None,
+        )
+        .await
+        .with_context(|| format!("Status endpoint on {addr} failed"))
+}
+
+/// Serves `GET /healthz` on `listen_addr` until `shutdown` flips. A
+/// oneshot run keeps it up only while it issues, so any answer means the
+/// agent is alive and still working.
+///
+/// # Errors
+/// Returns an error if the address is invalid or the listener fails.
+pub(crate) async fn serve_health(
+    listen_addr: &str,
+    mut shutdown: watch::Receiver<bool>,
+) -> Result<()> {
+    let addr: SocketAddr = listen_addr
+        .parse()
+        .with_context(|| format!("Invalid status.health_addr: {listen_addr}"))?;
+    info!("Starting health endpoint on {addr}");
+    Server::new(TcpListener::bind(addr))
+        .run_with_graceful_shutdown(
+            health_app(),
+            async move {
+                let _ = shutdown.changed().await;
+            },
+            None,
+        )
+        .await
+        .with_context(|| format!("Health endpoint on {addr} failed"))
+}
+
+fn health_app() -> impl Endpoint {
+    Route::new().at(HEALTH_PATH, poem::get(healthz))
+}
+
+#[handler]
+fn healthz() -> &'static str {
+    "ok"
+}
+
+fn status_app(registry: Arc<StatusRegistry>) -> impl Endpoint {
+    Route::new()
+        .at(STATUS_PATH, poem::get(status))
+        .data(registry)
+}
+
+#[handler]
+fn status(Data(registry): Data<&Arc<StatusRegistry>>) -> Json<StatusReport> {
+    Json(registry.report())
+}
+
+fn format_timestamp(at: SystemTime) -> String {
+    humantime::format_rfc3339_seconds(at).to_string()
+}
+
+#[cfg(test)]
+mod tests {
+    use std::time::Duration;
+
+    use poem::http::{StatusCode, Uri};
+    use poem::{Endpoint, Request};
+
+    use super::*;
+
+    const TEST_LABEL: &str = "edge-proxy";
+    const TEST_EPOCH_SECS: u64 = 1_700_000_000;
+
+    fn test_time() -> SystemTime {
+        SystemTime::UNIX_EPOCH + Duration::from_secs(TEST_EPOCH_SECS)
+    }
+
+    #[test]
+    fn test_report_is_empty_before_any_event() {
+        let registry = StatusRegistry::new();
+
+        assert!(registry.report().profiles.is_empty());
+    }
+
+    #[test]
+    fn test_record_failure_keeps_last_success() {
+        let registry = StatusRegistry::new();
+        registry.record_success(TEST_LABEL, test_time());
+        registry.record_failure(TEST_LABEL, "order rejected", test_time());
+
+        let report = registry.report();
+        let status = report.profiles.get(TEST_LABEL).unwrap();
+        assert_eq!(
+            status.last_success_at.as_deref(),
+            Some("2023-11-14T22:13:20Z")
+        );
+        assert_eq!(status.last_error.as_deref(), Some("order rejected"));
+        assert_eq!(
+            status.last_error_at.as_deref(),
+            Some("2023-11-14T22:13:20Z")
+        );
+    }
+
+    #[test]
+    fn test_record_next_check_sets_timestamp() {
+        let registry = StatusRegistry::new();
+        registry.record_next_check(TEST_LABEL, test_time() + Duration::from_secs(60));
+
+        let report = registry.report();
+        assert_eq!(
+            report
+                .profiles
+                .get(TEST_LABEL)
+                .unwrap()
+                .next_check_at
+                .as_deref(),
+            Some("2023-11-14T22:14:20Z")
+        );
+    }
+
+    #[tokio::test]
+    async fn test_record_outcome_keeps_run_id_of_the_cycle() {
+        let registry = StatusRegistry::new();
+        crate::run_id::scope("cycle-1".to_string(), async {
+            registry.record_success(TEST_LABEL, test_time());
+        })
+        .await;
+        crate::run_id::scope("cycle-2".to_string(), async {
+            registry.record_failure(TEST_LABEL, "dns timeout", test_time());
+        })
+        .await;
+
+        let report = registry.report();
+        assert_eq!(
+            report
+                .profiles
+                .get(TEST_LABEL)
+                .unwrap()
+                .last_run_id
+                .as_deref(),
+            Some("cycle-2")
+        );
+    }
+
+    #[tokio::test]
+    async fn test_refresh_cert_not_after_reads_certificate() {
+        let dir = tempfile::tempdir().unwrap();
+        let cert_path = dir.path().join("cert.pem");
+        let key = rcgen::KeyPair::generate().unwrap();
+        let mut params = rcgen::CertificateParams::new(vec!["status.example".to_string()]).unwrap();
+        params.not_after = rcgen::date_time_ymd(2030, 1, 2);
+        std::fs::write(&cert_path, params.self_signed(&key).unwrap().pem()).unwrap();
+
+        let registry = StatusRegistry::new();
+        registry
+            .refresh_cert_not_after(TEST_LABEL, &cert_path)
+            .await;
+
+        let report = registry.report();
+        assert_eq!(
+            report
+                .profiles
+                .get(TEST_LABEL)
+                .unwrap()
+                .cert_not_after
+                .as_deref(),
+            Some("2030-01-02T00:00:00Z")
+        );
+    }
+
+    #[tokio::test]
+    async fn test_refresh_cert_not_after_clears_missing_certificate() {
+        let dir = tempfile::tempdir().unwrap();
+        let registry = StatusRegistry::new();
+        registry.update(TEST_LABEL, |status| {
+            status.cert_not_after = Some("stale".to_string());
+        });
+
+        registry
+            .refresh_cert_not_after(TEST_LABEL, &dir.path().join("missing.pem"))
+            .await;
+
+        let report = registry.report();
+        assert_eq!(
+            report.profiles.get(TEST_LABEL).unwrap().cert_not_after,
+            None
+        );
+    }
+
+    #[tokio::test]
+    async fn test_refresh_issuance_timings_clears_missing_metadata() {
+        let dir = tempfile::tempdir().unwrap();
+        let registry = StatusRegistry::new();
+        registry.update(TEST_LABEL, |status| {
+            status.last_issuance_timings = Some(PhaseTimings::default());
+        });
+
+        registry
+            .refresh_issuance_timings(TEST_LABEL, &dir.path().join("cert.pem"))
+            .await;
+
+        let report = registry.report();
+        assert_eq!(
+            report
+                .profiles
+                .get(TEST_LABEL)
+                .unwrap()
+                .last_issuance_timings,
+            None
+        );
+    }
+
+    #[tokio::test]
+    async fn test_status_endpoint_returns_json_report() {
+        let registry = Arc::new(StatusRegistry::new());
+        registry.record_failure(TEST_LABEL, "dns timeout", test_time());
+        let app = status_app(Arc::clone(&registry));
+
+        let response = app
+            .call(
+                Request::builder()
+                    .uri(Uri::from_static(STATUS_PATH))
+                    .finish(),
+            )
+            .await
+            .unwrap();
+        assert_eq!(response.status(), StatusCode::OK);
+        let body: serde_json::Value =
+            serde_json::from_str(&response.into_body().into_string().await.unwrap()).unwrap();
+
+        assert_eq!(
+            body["profiles"][TEST_LABEL]["last_error"],
+            serde_json::json!("dns timeout")
+        );
+        assert_eq!(
+            body["profiles"][TEST_LABEL]["last_success_at"],
+            serde_json::Value::Null
+        );
+    }
+
+    #[tokio::test]
+    async fn test_health_endpoint_returns_ok() {
+        let response = health_app()
+            .call(
+                Request::builder()
+                    .uri(Uri::from_static(HEALTH_PATH))
+                    .finish(),
+            )
+            .await
+            .unwrap();
+
+        assert_eq!(response.status(), StatusCode::OK);
+        assert_eq!(response.into_body().into_string().await.unwrap(), "ok");
+    }
+
+    #[tokio::test]
+    async fn test_serve_health_rejects_invalid_listen_addr() {
+        let (_tx, rx) = watch::channel(false);
+
+        let err = serve_health("not-an-addr", rx).await.unwrap_err();
+
+        assert!(err.to_string().contains("status.health_addr"));
+    }
+
+    #[tokio::test]
+    async fn test_serve_rejects_invalid_listen_addr() {
+        let (_tx, rx) = watch::channel(false);
+
+        let err = serve("not-an-addr", Arc::new(StatusRegistry::new()), rx)
+            .await
+            .unwrap_err();
+
+        assert!(err.to_string().contains("status.listen_addr"));
+    }
+}
@@ -0,0 +1,297 @@
+//! Optional systemd integration for the agent.
+//!
+//! Under a `Type=notify` (or `notify-reload`) unit, systemd sets
+//! `NOTIFY_SOCKET` and the agent reports `READY=1` once the daemon is
+//! running, `RELOADING=1` while a SIGHUP reload is in progress, and, with
+//! `WatchdogSec=`, pings the watchdog at half the configured interval for
+//! as long as every daemon scheduling loop keeps beating its [`Heartbeat`].
+//! Credentials passed with `LoadCredential=` are read from
+//! `CREDENTIALS_DIRECTORY`. Without these variables every function here
+//! is a no-op.
+
+use std::collections::HashMap;
+use std::ffi::OsStr;
+use std::os::unix::net::UnixDatagram;
+use std::path::PathBuf;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::{Duration, Instant};
+
+use tracing::{debug, warn};
+
+const ENV_NOTIFY_SOCKET: &str = "NOTIFY_SOCKET";
+const ENV_WATCHDOG_USEC: &str = "WATCHDOG_USEC";
+const ENV_WATCHDOG_PID: &str = "WATCHDOG_PID";
+const ENV_CREDENTIALS_DIRECTORY: &str = "CREDENTIALS_DIRECTORY";
+
+/// Credential holding EAB JSON, used like `--eab-file` when no other EAB
+/// source is given on the command line.
+pub const EAB_CREDENTIAL: &str = "eab";
+/// Credential whose first line is the password of `pkcs12` sinks that
+/// set no `password_file`.
+pub const PKCS12_PASSWORD_CREDENTIAL: &str = "pkcs12-password";
+
+/// Tells systemd the daemon finished starting up.
+pub fn notify_ready() {
+    notify("READY=1");
+}
+
+/// Tells systemd a reload started; [`notify_ready`] ends it.
+pub fn notify_reloading() {
+    notify(&format!("RELOADING=1\nMONOTONIC_USEC={}", monotonic_usec()));
+}
+
+/// Liveness reported by the daemon's scheduling loops.
+///
+/// Each loop holds a [`HeartbeatGuard`] and beats it while it waits for
+/// its next check and after every check. The watchdog is pinged only
+/// while every registered loop has beaten within the watchdog timeout, so
+/// a loop stuck in a check stops the pings and systemd restarts the
+/// agent. With no loop registered, as in one-shot mode, the pings follow
+/// the runtime alone.
+#[derive(Clone, Default)]
+pub struct Heartbeat {
+    interval: Option<Duration>,
+    beats: Arc<Mutex<HashMap<u64, Instant>>>,
+    next_id: Arc<AtomicU64>,
+}
+
+impl Heartbeat {
+    /// Registers a scheduling loop, which counts as having just beaten.
+    #[must_use]
+    pub fn register(&self) -> HeartbeatGuard {
+        let id = self.next_id.fetch_add(1, Ordering::Relaxed);
+        let guard = HeartbeatGuard {
+            heartbeat: self.clone(),
+            id,
+        };
+        guard.beat();
+        guard
+    }
+
+    fn healthy(&self, now: Instant, timeout: Duration) -> bool {
+        self.beats
+            .lock()
+            .expect("heartbeat registry mutex poisoned")
+            .values()
+            .all(|beat| now.saturating_duration_since(*beat) < timeout)
+    }
+}
+
+/// One scheduling loop's registration with a [`Heartbeat`]; dropping it
+/// unregisters the loop.
+pub struct HeartbeatGuard {
+    heartbeat: Heartbeat,
+    id: u64,
+}
+
+impl HeartbeatGuard {
+    /// Records that the loop is making progress.
+    pub fn beat(&self) {
+        self.heartbeat
+            .beats
+            .lock()
+            .expect("heartbeat registry mutex poisoned")
+            .insert(self.id, Instant::now());
+    }
+
+    /// Sleeps for `duration`, beating at least once per watchdog interval
+    /// so a long wait between checks does not look like a stall.
+    pub async fn sleep(&self, duration: Duration) {
+        let Some(interval) = self.heartbeat.interval else {
+            tokio::time::sleep(duration).await;
+            return;
+        };
+        let deadline = tokio::time::Instant::now() + duration;
+        loop {
+            self.beat();
+            let now = tokio::time::Instant::now();
+            if now >= deadline {
+                return;
+            }
+            tokio::time::sleep_until(deadline.min(now + interval)).await;
+        }
+    }
+}
+
+impl Drop for HeartbeatGuard {
+    fn drop(&mut self) {
+        if let Ok(mut beats) = self.heartbeat.beats.lock() {
+            beats.remove(&self.id);
+        }
+    }
+}
+
+/// Starts pinging the watchdog when the unit sets `WatchdogSec=` for this
+/// process, and returns the [`Heartbeat`] that gates the pings.
+#[must_use]
+pub fn spawn_watchdog() -> Heartbeat {
+    let interval = watchdog_interval(
+        std::env::var(ENV_WATCHDOG_USEC).ok().as_deref(),
+        std::env::var(ENV_WATCHDOG_PID).ok().as_deref(),
+        std::process::id(),
+    );
+    let heartbeat = Heartbeat {
+        interval,
+        ..Heartbeat::default()
+    };
+    let Some(interval) = interval else {
+        return heartbeat;
+    };
+    debug!("systemd watchdog enabled; pinging every {interval:?}");
+    let watched = heartbeat.clone();
+    tokio::spawn(async move {
+        let timeout = interval * 2;
+        let mut ticker = tokio::time::interval(interval);
+        loop {
+            ticker.tick().await;
+            if watched.healthy(Instant::now(), timeout) {
+                notify("WATCHDOG=1");
+            } else {
+                warn!("A daemon scheduling loop has stalled; withholding the watchdog ping");
+            }
+        }
+    });
+    heartbeat
+}
+
+/// Returns the path of the systemd credential `name` when the unit
+/// passed it with `LoadCredential=` or `SetCredential=`.
+#[must_use]
+pub fn credential(name: &str) -> Option<PathBuf> {
+    credential_in(std::env::var_os(ENV_CREDENTIALS_DIRECTORY).as_deref(), name)
+}
+
+fn notify(state: &str) {
+    let Ok(socket) = std::env::var(ENV_NOTIFY_SOCKET) else {
+        return;
+    };
+    if let Err(err) = send(&socket, state) {
+        warn!("Failed to notify systemd at {socket}: {err}");
+    }
+}
+
+/// Sends one `sd_notify` datagram to `socket`, a path or an abstract
+/// socket name starting with `@`.
+fn send(socket: &str, state: &str) -> std::io::Result<()> {
+    let sender = UnixDatagram::unbound()?;
+    match socket.strip_prefix('@') {
+        Some(name) => send_abstract(&sender, name, state),
+        None => sender.send_to(state.as_bytes(), socket).map(drop),
+    }
+}
+
+#[cfg(target_os = "linux")]
+fn send_abstract(sender: &UnixDatagram, name: &str, state: &str) -> std::io::Result<()> {
+    use std::os::linux::net::SocketAddrExt as _;
+    let addr = std::os::unix::net::SocketAddr::from_abstract_name(name)?;
+    sender.send_to_addr(state.as_bytes(), &addr).map(drop)
+}
+
+#[cfg(not(target_os = "linux"))]
+fn send_abstract(_sender: &UnixDatagram, _name: &str, _state: &str) -> std::io::Result<()> {
+    Err(std::io::Error::new(
+        std::io::ErrorKind::Unsupported,
+        "abstract notify sockets are Linux-only",
+    ))
+}
+
+/// Returns half the watchdog timeout from `WATCHDOG_USEC`, or `None` when
+/// it is unset, invalid, or meant for another process (`WATCHDOG_PID`).
+fn watchdog_interval(usec: Option<&str>, pid: Option<&str>, own_pid: u32) -> Option<Duration> {
+    let usec = usec?.trim().parse::<u64>().ok().filter(|usec| *usec > 0)?;
+    if let Some(pid) = pid
+        && pid.trim().parse::<u32>().ok() != Some(own_pid)
+    {
+        return None;
+    }
+    Some(Duration::from_micros(usec) / 2)
+}
+
+fn credential_in(dir: Option<&OsStr>, name: &str) -> Option<PathBuf> {
+    let path = PathBuf::from(dir?).join(name);
+    path.is_file().then_some(path)
+}
+
+fn monotonic_usec() -> u64 {
+    // SAFETY: `timespec` is plain data that `clock_gettime` fills in.
+    let mut now: libc::timespec = unsafe { std::mem::zeroed() };
+    // SAFETY: `now` is a valid buffer and CLOCK_MONOTONIC always exists.
+    unsafe { libc::clock_gettime(libc::CLOCK_MONOTONIC, &raw mut now) };
+    u64::try_from(now.tv_sec).unwrap_or_default() * 1_000_000
+        + u64::try_from(now.tv_nsec).unwrap_or_default() / 1_000
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_send_delivers_state_to_notify_socket() {
+        let temp = tempfile::tempdir().unwrap();
+        let path = temp.path().join("notify.sock");
+        let receiver = UnixDatagram::bind(&path).unwrap();
+
+        send(path.to_str().unwrap(), "READY=1").unwrap();
+
+        let mut buf = [0u8; 64];
+        let len = receiver.recv(&mut buf).unwrap();
+        assert_eq!(&buf[..len], b"READY=1");
+    }
+
+    #[test]
+    fn test_watchdog_interval_is_half_the_timeout_for_this_process() {
+        assert_eq!(
+            watchdog_interval(Some("30000000"), None, 42),
+            Some(Duration::from_secs(15))
+        );
+        assert_eq!(
+            watchdog_interval(Some("30000000"), Some("42"), 42),
+            Some(Duration::from_secs(15))
+        );
+        assert_eq!(watchdog_interval(Some("30000000"), Some("7"), 42), None);
+        assert_eq!(watchdog_interval(Some("0"), None, 42), None);
+        assert_eq!(watchdog_interval(None, None, 42), None);
+    }
+
+    #[test]
+    fn test_heartbeat_is_unhealthy_once_a_registered_loop_stops_beating() {
+        let heartbeat = Heartbeat::default();
+        let timeout = Duration::from_secs(10);
+        assert!(heartbeat.healthy(Instant::now(), timeout));
+
+        let first = heartbeat.register();
+        let second = heartbeat.register();
+        let later = Instant::now() + Duration::from_secs(11);
+        assert!(heartbeat.healthy(Instant::now(), timeout));
+        assert!(!heartbeat.healthy(later, timeout));
+
+        drop(second);
+        first
+            .heartbeat
+            .beats
+            .lock()
+            .unwrap()
+            .insert(first.id, later);
+        assert!(heartbeat.healthy(later, timeout));
+
+        drop(first);
+        assert!(heartbeat.healthy(later + timeout, timeout));
+    }
+
+    #[test]
+    fn test_credential_in_returns_only_existing_files() {
+        let temp = tempfile::tempdir().unwrap();
+        std::fs::write(temp.path().join(EAB_CREDENTIAL), "{}").unwrap();
+
+        assert_eq!(
+            credential_in(Some(temp.path().as_os_str()), EAB_CREDENTIAL),
+            Some(temp.path().join(EAB_CREDENTIAL))
+        );
+        assert_eq!(
+            credential_in(Some(temp.path().as_os_str()), PKCS12_PASSWORD_CREDENTIAL),
+            None
+        );
+        assert_eq!(credential_in(None, EAB_CREDENTIAL), None);
+    }
+}
@@ -1,20 +1,22 @@
 use std::collections::HashSet;
+use std::path::Path;
 use std::sync::Arc;
 use std::time::Duration;
 
 use anyhow::{Context, Result};
-use reqwest::Client;
+use reqwest::{Client, ClientBuilder};
 use rustls::ClientConfig;
 use rustls::client::WebPkiServerVerifier;
 use rustls::client::danger::{HandshakeSignatureValid, ServerCertVerified, ServerCertVerifier};
 use rustls::crypto::{WebPkiSupportedAlgorithms, verify_tls12_signature, verify_tls13_signature};
 use rustls::pki_types::{CertificateDer, ServerName, UnixTime};
+use tracing::{debug, info, warn};
 use x509_parser::certificate::X509Certificate;
 use x509_parser::pem::parse_x509_pem;
 use x509_parser::prelude::ASN1Time;
 use x509_parser::prelude::FromDer;
 
-use crate::config::TrustSettings;
+use crate::config::{TlsVersion, TrustSettings};
 
 /// Connect timeout for `OpenBao` HTTP clients.
 ///
@@ -34,11 +36,21 @@ pub(crate) const OPENBAO_REQUEST_TIMEOUT: Duration = Duration::from_secs(30);
 /// Builds a [`reqwest::Client`] configured according to the given
 /// [`TrustSettings`] and runtime TLS override.
 ///
+/// `trust.tls_min_version` and `trust.tls_max_version` bound the
+/// negotiated protocol in every mode.
+///
 /// Three modes:
 /// - **Insecure override** (`--insecure`): accepts any certificate.
 /// - **System roots** (no `ca_bundle_path`): default webpki verification.
 /// - **Custom CA bundle** (with optional SHA-256 pinning): loads the bundle
-///   and optionally enforces certificate pins.
+///   plus any `ca_dir` certificates and optionally enforces certificate
+///   pins.
+///
+/// `trust.server_spki_sha256` pins the server's public key on top of any
+/// mode: the leaf must carry a pinned key after the chain verifies, or
+/// instead of chain verification under `--insecure`. With system roots
+/// the chain is still verified by the platform verifier reqwest uses,
+/// so a CA trusted only through the OS store keeps working once pinned.
 ///
 /// # Errors
 ///
@@ -46,46 +58,154 @@ pub(crate) const OPENBAO_REQUEST_TIMEOUT: Duration = Duration::from_secs(30);
 /// certificate pins are specified without a CA bundle path, or if the
 /// HTTP client fails to build.
 pub fn build_http_client(trust: &TrustSettings, insecure_mode: bool) -> Result<Client> {
+    build_http_client_with(Client::builder(), trust, insecure_mode)
+}
+
+/// Same as [`build_http_client`], but starts from a caller-supplied
+/// [`reqwest::ClientBuilder`] so non-TLS options (for example a custom
+/// DNS resolver) carry through every trust mode.
+///
+/// # Errors
+///
+/// Returns an error under the same conditions as [`build_http_client`].
+pub fn build_http_client_with(
+    builder: ClientBuilder,
+    trust: &TrustSettings,
+    insecure_mode: bool,
+) -> Result<Client> {
     install_crypto_provider();
+    let versions = protocol_versions(trust)?;
+    let mut builder = builder.min_tls_version(reqwest_tls_version(trust.tls_min_version));
+    if let Some(max) = trust.tls_max_version {
+        builder = builder.max_tls_version(reqwest_tls_version(max));
+    }
     if insecure_mode {
+        if !trust.server_spki_sha256.is_empty() {
+            // Pin-only: the chain is not verified, but the server must
+            // still present one of the pinned public keys.
+            let verifier = SpkiPinVerifier::new(None, &trust.server_spki_sha256);
+            return build_verified_client(builder, &versions, Arc::new(verifier));
+        }
         // CodeQL flags `danger_accept_invalid_certs(true)` as
         // rust/disabled-certificate-check.  This is intentional: during
         // break-glass recovery or explicit diagnostics the caller may opt in
         // to an insecure ACME TLS client via `--insecure`. Dismiss the alert
         // as a false positive because the override is explicit and temporary.
-        return Client::builder()
+        return builder
             .danger_accept_invalid_certs(true)
             .build()
             .context("Failed to build insecure HTTP client");
     }
 
-    let Some(bundle_path) = trust.ca_bundle_path.as_ref() else {
-        if !trust.trusted_ca_sha256.is_empty() {
-            anyhow::bail!("trust.ca_bundle_path must be set when trust is configured");
+    if trust.ca_bundle_path.is_none() && !trust.trusted_ca_sha256.is_empty() {
+        anyhow::bail!("trust.ca_bundle_path must be set when trust is configured");
+    }
+    if trust.ca_bundle_path.is_none() && trust.ca_dir.is_none() {
+        if trust.server_spki_sha256.is_empty() {
+            return builder.build().context("Failed to build HTTP client");
         }
-        return Client::builder()
-            .build()
-            .context("Failed to build HTTP client");
-    };
-
-    let (certs, pins) = load_ca_bundle(bundle_path, &trust.trusted_ca_sha256)?;
-    let root_store = certs_to_root_store(&certs)?;
-    let mut config = ClientConfig::builder()
-        .with_root_certificates(root_store)
-        .with_no_client_auth();
+        let verifier = with_spki_pins(platform_verifier()?, &trust.server_spki_sha256);
+        return build_verified_client(builder, &versions, verifier);
+    }
 
-    if !pins.is_empty() {
-        config
-            .dangerous()
-            .set_certificate_verifier(build_pinned_verifier(&certs, &pins)?);
+    let (mut certs, pins) = match trust.ca_bundle_path.as_ref() {
+        Some(bundle_path) => load_ca_bundle(bundle_path, &trust.trusted_ca_sha256)?,
+        None => (Vec::new(), HashSet::new()),
+    };
+    if let Some(dir) = trust.ca_dir.as_ref() {
+        push_unique(&mut certs, load_ca_dir(dir)?);
     }
+    let verifier = if pins.is_empty() {
+        webpki_verifier(certs_to_root_store(&certs)?)?
+    } else {
+        build_pinned_verifier(&certs, &pins)?
+    };
+    let verifier = with_spki_pins(verifier, &trust.server_spki_sha256);
+    build_verified_client(builder, &versions, verifier)
+}
 
-    Client::builder()
+/// Builds the client with a preconfigured rustls config that checks the
+/// server certificate with `verifier`.
+fn build_verified_client(
+    builder: ClientBuilder,
+    versions: &[&'static rustls::SupportedProtocolVersion],
+    verifier: Arc<dyn ServerCertVerifier>,
+) -> Result<Client> {
+    // A preconfigured rustls config ignores the builder's version bounds,
+    // so they are applied to the config itself.
+    let config = ClientConfig::builder_with_protocol_versions(versions)
+        .dangerous()
+        .with_custom_certificate_verifier(verifier)
+        .with_no_client_auth();
+    builder
         .use_preconfigured_tls(config)
         .build()
         .context("Failed to build trusted HTTP client")
 }
 
+/// Returns the OS-backed verifier reqwest itself uses when no CA bundle
+/// is configured.
+fn platform_verifier() -> Result<Arc<dyn ServerCertVerifier>> {
+    let provider = Arc::new(rustls::crypto::ring::default_provider());
+    let verifier = rustls_platform_verifier::Verifier::new(provider)
+        .context("Failed to build the platform TLS verifier")?;
+    Ok(Arc::new(verifier))
+}
+
+fn webpki_verifier(root_store: rustls::RootCertStore) -> Result<Arc<dyn ServerCertVerifier>> {
+    let verifier: Arc<dyn ServerCertVerifier> = WebPkiServerVerifier::builder(Arc::new(root_store))
+        .build()
+        .context("Failed to build TLS verifier")?;
+    Ok(verifier)
+}
+
+/// Wraps `verifier` so the server must also present one of the pinned
+/// public keys; returns it unchanged when there are no pins.
+fn with_spki_pins(
+    verifier: Arc<dyn ServerCertVerifier>,
+    pins: &[String],
+) -> Arc<dyn ServerCertVerifier> {
+    if pins.is_empty() {
+        return verifier;
+    }
+    Arc::new(SpkiPinVerifier::new(Some(verifier), pins))
+}
+
+/// Returns the rustls protocol versions allowed by the trust settings.
+fn protocol_versions(
+    trust: &TrustSettings,
+) -> Result<Vec<&'static rustls::SupportedProtocolVersion>> {
+    let versions: Vec<_> = rustls::ALL_VERSIONS
+        .iter()
+        .copied()
+        .filter(|supported| {
+            rustls_tls_version(supported.version).is_some_and(|version| {
+                version >= trust.tls_min_version
+                    && trust.tls_max_version.is_none_or(|max| version <= max)
+            })
+        })
+        .collect();
+    if versions.is_empty() {
+        anyhow::bail!("No TLS version satisfies trust.tls_min_version and trust.tls_max_version");
+    }
+    Ok(versions)
+}
+
+fn rustls_tls_version(version: rustls::ProtocolVersion) -> Option<TlsVersion> {
+    match version {
+        rustls::ProtocolVersion::TLSv1_2 => Some(TlsVersion::Tls12),
+        rustls::ProtocolVersion::TLSv1_3 => Some(TlsVersion::Tls13),
+        _ => None,
+    }
+}
+
+fn reqwest_tls_version(version: TlsVersion) -> reqwest::tls::Version {
+    match version {
+        TlsVersion::Tls12 => reqwest::tls::Version::TLS_1_2,
+        TlsVersion::Tls13 => reqwest::tls::Version::TLS_1_3,
+    }
+}
+
 /// Builds a [`reqwest::Client`] whose trust root is the given PEM-encoded
 /// CA bundle (in-memory, no file I/O), with optional SHA-256 certificate
 /// pinning.
@@ -251,6 +371,61 @@ fn load_ca_bundle(
     Ok((certs, pins))
 }
 
+/// Loads every PEM certificate file in `dir`, the `c_rehash` layout used
+/// by `/etc/ssl/certs`. Subdirectories and files that are not PEM
+/// certificates are skipped, and hash links that resolve to an already
+/// loaded certificate are counted once.
+fn load_ca_dir(dir: &Path) -> Result<Vec<CertificateDer<'static>>> {
+    let mut paths = std::fs::read_dir(dir)
+        .and_then(|entries| {
+            entries
+                .map(|entry| entry.map(|entry| entry.path()))
+                .collect::<std::io::Result<Vec<_>>>()
+        })
+        .with_context(|| format!("Failed to read CA directory at {}", dir.display()))?;
+    paths.sort();
+
+    let mut certs = Vec::new();
+    let mut skipped = 0usize;
+    for path in paths.iter().filter(|path| path.is_file()) {
+        let contents = match std::fs::read(path) {
+            Ok(contents) => contents,
+            Err(err) => {
+                warn!("Skipping unreadable CA file {}: {err}", path.display());
+                skipped += 1;
+                continue;
+            }
+        };
+        match parse_pem_to_cert_list(&contents) {
+            Ok(found) => push_unique(&mut certs, found),
+            Err(_) => {
+                debug!("Skipping {}: not a PEM certificate file", path.display());
+                skipped += 1;
+            }
+        }
+    }
+    if certs.is_empty() {
+        anyhow::bail!(
+            "CA directory at {} contained no certificates",
+            dir.display()
+        );
+    }
+    info!(
+        "Loaded {} CA certificates from {} ({skipped} files skipped)",
+        certs.len(),
+        dir.display()
+    );
+    Ok(certs)
+}
+
+fn push_unique(certs: &mut Vec<CertificateDer<'static>>, more: Vec<CertificateDer<'static>>) {
+    for cert in more {
+        if !certs.contains(&cert) {
+            certs.push(cert);
+        }
+    }
+}
+
 /// Builds a [`rustls::RootCertStore`] from an already-parsed certificate list.
 fn certs_to_root_store(certs: &[CertificateDer<'static>]) -> Result<rustls::RootCertStore> {
     let mut root_store = rustls::RootCertStore::empty();
@@ -386,6 +561,83 @@ impl ServerCertVerifier for PinnedCertVerifier {
     }
 }
 
+/// Requires the server's leaf certificate to carry a pinned public key:
+/// the lowercase hex SHA-256 of its DER `SubjectPublicKeyInfo` must be in
+/// `trust.server_spki_sha256`. Pinning the key rather than the certificate
+/// lets a renewed certificate that keeps its key pass, and listing the
+/// next key ahead of time covers a key rotation.
+#[derive(Debug)]
+struct SpkiPinVerifier {
+    /// Chain verification that runs first, or `None` under `--insecure`,
+    /// where the pin is the only check.
+    inner: Option<Arc<dyn ServerCertVerifier>>,
+    allowed: HashSet<String>,
+    supported_algs: WebPkiSupportedAlgorithms,
+}
+
+impl SpkiPinVerifier {
+    fn new(inner: Option<Arc<dyn ServerCertVerifier>>, pins: &[String]) -> Self {
+        Self {
+            inner,
+            allowed: pins.iter().map(|pin| pin.to_ascii_lowercase()).collect(),
+            supported_algs: rustls::crypto::ring::default_provider()
+                .signature_verification_algorithms,
+        }
+    }
+
+    fn check_pin(&self, end_entity: &CertificateDer<'_>) -> Result<(), rustls::Error> {
+        let cert = parse_certificate(end_entity)?;
+        let presented = sha256_hex(cert.public_key().raw);
+        if self.allowed.contains(&presented) {
+            return Ok(());
+        }
+        Err(rustls::Error::General(format!(
+            "server public key pin mismatch: presented SPKI sha256 {presented} matches none of \
+             the {} pinned key(s) in trust.server_spki_sha256",
+            self.allowed.len()
+        )))
+    }
+}
+
+impl ServerCertVerifier for SpkiPinVerifier {
+    fn verify_server_cert(
+        &self,
+        end_entity: &CertificateDer<'_>,
+        intermediates: &[CertificateDer<'_>],
+        server_name: &ServerName<'_>,
+        ocsp_response: &[u8],
+        now: UnixTime,
+    ) -> Result<ServerCertVerified, rustls::Error> {
+        if let Some(inner) = &self.inner {
+            inner.verify_server_cert(end_entity, intermediates, server_name, ocsp_response, now)?;
+        }
+        self.check_pin(end_entity)?;
+        Ok(ServerCertVerified::assertion())
+    }
+
+    fn verify_tls12_signature(
+        &self,
+        message: &[u8],
+        cert: &CertificateDer<'_>,
+        dss: &rustls::DigitallySignedStruct,
+    ) -> Result<HandshakeSignatureValid, rustls::Error> {
+        verify_tls12_signature(message, cert, dss, &self.supported_algs)
+    }
+
+    fn verify_tls13_signature(
+        &self,
+        message: &[u8],
+        cert: &CertificateDer<'_>,
+        dss: &rustls::DigitallySignedStruct,
+    ) -> Result<HandshakeSignatureValid, rustls::Error> {
+        verify_tls13_signature(message, cert, dss, &self.supported_algs)
+    }
+
+    fn supported_verify_schemes(&self) -> Vec<rustls::SignatureScheme> {
+        self.supported_algs.supported_schemes()
+    }
+}
+
 /// Computes the `trusted_ca_sha256` fingerprints (lowercase hex SHA-256 of
 /// each certificate's DER) for every certificate in a PEM bundle.
 ///
@@ -645,6 +897,58 @@ mod tests {
         assert!(verifier.is_some());
     }
 
+    #[test]
+    fn spki_pin_verifier_accepts_any_listed_key() {
+        let certificate = generate_leaf_certificate();
+        let pin = spki_sha256(&certificate);
+        let verifier = SpkiPinVerifier::new(None, &["00".repeat(32), pin.to_ascii_uppercase()]);
+
+        assert!(verify_with(&verifier, &certificate).is_ok());
+    }
+
+    #[test]
+    fn spki_pin_verifier_reports_pin_mismatch() {
+        let certificate = generate_leaf_certificate();
+        let verifier = SpkiPinVerifier::new(None, &["00".repeat(32)]);
+
+        let err = verify_with(&verifier, &certificate).expect_err("unpinned key");
+        let message = err.to_string();
+        assert!(message.contains("pin mismatch"), "{message}");
+        assert!(message.contains(&spki_sha256(&certificate)), "{message}");
+    }
+
+    #[test]
+    fn spki_pin_verifier_still_requires_the_chain() {
+        let certificate = generate_leaf_certificate();
+        let verifier = SpkiPinVerifier::new(
+            Some(Arc::new(RejectingVerifier)),
+            &[spki_sha256(&certificate)],
+        );
+
+        assert_eq!(
+            verify_with(&verifier, &certificate).expect_err("chain rejected"),
+            invalid_certificate(rustls::CertificateError::ApplicationVerificationFailure),
+        );
+    }
+
+    fn spki_sha256(certificate: &CertificateDer<'_>) -> String {
+        let (_, cert) = X509Certificate::from_der(certificate.as_ref()).expect("parse cert");
+        sha256_hex(cert.public_key().raw)
+    }
+
+    fn verify_with(
+        verifier: &dyn ServerCertVerifier,
+        certificate: &CertificateDer<'_>,
+    ) -> Result<ServerCertVerified, rustls::Error> {
+        verifier.verify_server_cert(
+            certificate,
+            &[],
+            &ServerName::try_from("localhost").expect("valid server name"),
+            &[],
+            direct_pin_test_time(),
+        )
+    }
+
     fn direct_pin_test_time() -> UnixTime {
         UnixTime::since_unix_epoch(Duration::from_secs(DIRECT_PIN_TEST_NOW_SECS))
     }
@@ -787,6 +1091,15 @@ mod tests {
         assert!(client.is_ok());
     }
 
+    #[test]
+    fn build_http_client_pins_on_top_of_the_platform_verifier() {
+        let trust = TrustSettings {
+            server_spki_sha256: vec!["aa".repeat(32)],
+            ..TrustSettings::default()
+        };
+        assert!(build_http_client(&trust, false).is_ok());
+    }
+
     /// Proves the local-plus-webpki root store keeps every Mozilla
     /// webpki trust anchor in place and adds the supplied local PEM on
     /// top.  The regression we are guarding against: the original
@@ -817,6 +1130,87 @@ mod tests {
         );
     }
 
+    #[test]
+    fn load_ca_dir_skips_non_pem_files_and_duplicates() {
+        let dir = tempfile::tempdir().expect("tempdir");
+        let first = generate_ca_pem();
+        let second = generate_ca_pem();
+        std::fs::write(dir.path().join("first.pem"), &first).expect("write first");
+        std::fs::write(dir.path().join("second.crt"), &second).expect("write second");
+        std::fs::write(dir.path().join("1a2b3c4d.0"), &first).expect("write hash link");
+        std::fs::write(dir.path().join("README"), "not a certificate").expect("write README");
+        std::fs::create_dir(dir.path().join("java")).expect("create subdir");
+
+        let certs = load_ca_dir(dir.path()).expect("load dir");
+
+        assert_eq!(certs.len(), 2);
+    }
+
+    #[test]
+    fn load_ca_dir_rejects_directory_without_certificates() {
+        let dir = tempfile::tempdir().expect("tempdir");
+        std::fs::write(dir.path().join("README"), "not a certificate").expect("write README");
+
+        let err = load_ca_dir(dir.path()).expect_err("no certificates");
+        assert!(
+            err.to_string().contains("no certificates"),
+            "unexpected error: {err}"
+        );
+        assert!(load_ca_dir(&dir.path().join("missing")).is_err());
+    }
+
+    #[test]
+    fn build_http_client_combines_bundle_and_ca_dir() {
+        let dir = tempfile::tempdir().expect("tempdir");
+        let bundle_path = dir.path().join("ca-bundle.pem");
+        let roots = dir.path().join("roots");
+        std::fs::create_dir(&roots).expect("create roots dir");
+        std::fs::write(&bundle_path, generate_ca_pem()).expect("write bundle");
+        std::fs::write(roots.join("extra.pem"), generate_ca_pem()).expect("write root");
+
+        let trust = TrustSettings {
+            ca_bundle_path: Some(bundle_path),
+            ca_dir: Some(roots.clone()),
+            ..TrustSettings::default()
+        };
+        assert!(build_http_client(&trust, false).is_ok());
+
+        let dir_only = TrustSettings {
+            ca_dir: Some(roots),
+            ..TrustSettings::default()
+        };
+        assert!(build_http_client(&dir_only, false).is_ok());
+    }
+
+    #[test]
+    fn protocol_versions_follow_trust_bounds() {
+        let default = protocol_versions(&TrustSettings::default()).expect("default versions");
+        assert!(
+            default
+                .iter()
+                .any(|v| v.version == rustls::ProtocolVersion::TLSv1_3)
+        );
+
+        let tls13_only = TrustSettings {
+            tls_min_version: TlsVersion::Tls13,
+            ..TrustSettings::default()
+        };
+        let versions = protocol_versions(&tls13_only).expect("TLS 1.3 versions");
+        assert!(
+            versions
+                .iter()
+                .all(|v| v.version == rustls::ProtocolVersion::TLSv1_3)
+        );
+        assert!(build_http_client(&tls13_only, false).is_ok());
+
+        let impossible = TrustSettings {
+            tls_min_version: TlsVersion::Tls13,
+            tls_max_version: Some(TlsVersion::Tls12),
+            ..TrustSettings::default()
+        };
+        assert!(protocol_versions(&impossible).is_err());
+    }
+
     #[test]
     fn build_http_client_with_local_and_webpki_roots_succeeds_with_valid_pem() {
         let pem = generate_ca_pem();
@@ -0,0 +1,543 @@
+//! Trust-on-first-use pinning of the CA root for `bootroot-agent`.
+//!
+//! With `--trust-root-on-first-use` and no `trust.trusted_ca_sha256` pin
+//! yet, the agent fetches the CA's roots from step-ca's `/roots.pem` over
+//! an unverified connection, shows their SHA-256 fingerprints, and pins
+//! them only after the operator confirms on a terminal or one of them
+//! matches `--expected-fingerprint`. Before anything is written, the CA's
+//! TLS endpoint must verify against the fetched roots. The roots are then
+//! saved to `trust.ca_bundle_path` and the pin is written to the
+//! `[trust]` section of `agent.toml`, so later runs use the normal pinned
+//! trust path and this module becomes a no-op. Nothing is ever pinned
+//! without confirmation or a matching fingerprint.
+//!
+//! `--fetch-root-from <CA_URL>` is the non-interactive variant, modeled on
+//! `step ca bootstrap`: it asks step-ca's `/root/<fingerprint>` endpoint
+//! for exactly the root named by the mandatory `--expected-fingerprint`
+//! and pins it the same way.
+
+use std::io::{BufRead, IsTerminal, Write};
+use std::path::Path;
+use std::time::Duration;
+
+use anyhow::{Context, Result};
+use reqwest::{Client, Url};
+use tracing::{debug, info, warn};
+use x509_parser::prelude::{FromDer, X509Certificate};
+
+use crate::cert_group::CertGroupPolicy;
+use crate::config::{Settings, TrustSettings};
+use crate::{fs_util, tls, toml_util, trust_bootstrap};
+
+const ROOTS_PATH: &str = "/roots.pem";
+const ROOT_PATH_PREFIX: &str = "/root/";
+const FETCH_TIMEOUT_SECS: u64 = 15;
+const TRUST_SECTION: &str = "trust";
+const SHA256_HEX_LEN: usize = 64;
+
+/// Body of step-ca's `GET /root/<fingerprint>` response.
+#[derive(Debug, serde::Deserialize)]
+struct RootResponse {
+    ca: String,
+}
+
+/// One certificate served by the CA's roots endpoint.
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct FetchedRoot {
+    subject: String,
+    fingerprint: String,
+}
+
+/// Pins the CA root on first use when no `trust.trusted_ca_sha256` pin is
+/// configured yet, updating `settings.trust` in place.
+///
+/// `expected_fingerprint` is a SHA-256 hex fingerprint (colons allowed)
+/// that one fetched root must match. Without it the operator must
+/// confirm the fingerprints interactively; a non-interactive stdin is
+/// refused.
+///
+/// # Errors
+/// Returns an error if `trust.ca_bundle_path` is unset, the CA URL is not
+/// `https://`, the roots cannot be fetched or parsed, no root is
+/// confirmed, the CA's TLS endpoint does not verify against the fetched
+/// roots, or the bundle or `agent.toml` cannot be written.
+pub async fn pin_root_on_first_use(
+    settings: &mut Settings,
+    config_path: &Path,
+    expected_fingerprint: Option<&str>,
+) -> Result<()> {
+    if !settings.trust.trusted_ca_sha256.is_empty() {
+        debug!("CA root already pinned; skipping trust-on-first-use.");
+        return Ok(());
+    }
+    let bundle_path = settings.trust.ca_bundle_path.clone().ok_or_else(|| {
+        anyhow::anyhow!("--trust-root-on-first-use requires trust.ca_bundle_path")
+    })?;
+    let expected = expected_fingerprint
+        .map(normalize_fingerprint)
+        .transpose()?;
+
+    let url = roots_url(&settings.server)?;
+    warn!("No CA root is pinned yet; fetching {url} without TLS verification.");
+    let insecure = Client::builder().timeout(Duration::from_secs(FETCH_TIMEOUT_SECS));
+    let client = tls::build_http_client_with(insecure, &TrustSettings::default(), true)?;
+    let pem = fetch_roots(&client, &url).await?;
+    let roots = describe_roots(&pem)?;
+
+    let pins = match expected.as_deref() {
+        Some(expected) => pins_matching(&roots, expected)?,
+        None => pins_confirmed(&roots, &url, confirm_on_terminal)?,
+    };
+    verify_server_against_roots(&settings.server, &pem, &pins).await?;
+    install_pins(settings, config_path, &bundle_path, &pem, pins).await
+}
+
+/// Fetches the root whose SHA-256 fingerprint is `expected_fingerprint`
+/// from the step-ca at `ca_url` and pins it, updating `settings.trust` in
+/// place. Runs where that root is already pinned skip the fetch.
+///
+/// The root is fetched without TLS verification; only the fingerprint
+/// match makes it trusted, and the ACME server must then verify against
+/// it.
+///
+/// # Errors
+/// Returns an error if the fingerprint is malformed,
+/// `trust.ca_bundle_path` is unset, `ca_url` is not `https://`, the root
+/// cannot be fetched or does not match the fingerprint, the ACME server
+/// does not verify against it, or the bundle or `agent.toml` cannot be
+/// written.
+pub async fn pin_root_from_ca(
+    settings: &mut Settings,
+    config_path: &Path,
+    ca_url: &str,
+    expected_fingerprint: &str,
+) -> Result<()> {
+    let expected = normalize_fingerprint(expected_fingerprint)?;
+    if settings.trust.trusted_ca_sha256.contains(&expected) {
+        debug!("CA root sha256:{expected} already pinned; skipping --fetch-root-from.");
+        return Ok(());
+    }
+    let bundle_path = settings
+        .trust
+        .ca_bundle_path
+        .clone()
+        .ok_or_else(|| anyhow::anyhow!("--fetch-root-from requires trust.ca_bundle_path"))?;
+
+    let url = root_url(ca_url, &expected)?;
+    info!("Fetching CA root from {url}; it is trusted only if its fingerprint matches.");
+    let insecure = Client::builder().timeout(Duration::from_secs(FETCH_TIMEOUT_SECS));
+    let client = tls::build_http_client_with(insecure, &TrustSettings::default(), true)?;
+    let pem = fetch_root(&client, &url).await?;
+    let roots = describe_roots(&pem)?;
+    if roots.len() != 1 {
+        anyhow::bail!(
+            "CA root endpoint {url} returned {} certificates, expected one",
+            roots.len()
+        );
+    }
+    let pins = pins_matching(&roots, &expected)?;
+    verify_server_against_roots(&settings.server, &pem, &pins).await?;
+    install_pins(settings, config_path, &bundle_path, &pem, pins).await
+}
+
+/// Saves `pem` as the CA bundle, records `pins` in `agent.toml`, and
+/// makes them the trust anchor for the rest of the run.
+async fn install_pins(
+    settings: &mut Settings,
+    config_path: &Path,
+    bundle_path: &Path,
+    pem: &str,
+    pins: Vec<String>,
+) -> Result<()> {
+    fs_util::write_ca_bundle(bundle_path, pem, CertGroupPolicy::none())
+        .await
+        .with_context(|| format!("Failed to write CA bundle to {}", bundle_path.display()))?;
+    persist_pins(config_path, bundle_path, &pins).await?;
+    for pin in &pins {
+        info!(
+            "Pinned CA root sha256:{pin} (saved to {})",
+            bundle_path.display()
+        );
+    }
+    settings.trust.trusted_ca_sha256 = pins;
+    Ok(())
+}
+
+/// Resolves the step-ca `/roots.pem` URL on the ACME directory's origin.
+fn roots_url(server: &str) -> Result<Url> {
+    let mut url = Url::parse(server.trim())
+        .with_context(|| format!("server is not a valid URL: {server}"))?;
+    if url.scheme() != "https" {
+        anyhow::bail!("--trust-root-on-first-use requires an https:// server URL, got {server}");
+    }
+    url.set_path(ROOTS_PATH);
+    url.set_query(None);
+    url.set_fragment(None);
+    Ok(url)
+}
+
+/// Resolves step-ca's `/root/<fingerprint>` URL on the origin of `ca_url`.
+fn root_url(ca_url: &str, fingerprint: &str) -> Result<Url> {
+    let mut url = Url::parse(ca_url.trim())
+        .with_context(|| format!("--fetch-root-from is not a valid URL: {ca_url}"))?;
+    if url.scheme() != "https" {
+        anyhow::bail!("--fetch-root-from requires an https:// URL, got {ca_url}");
+    }
+    url.set_path(&format!("{ROOT_PATH_PREFIX}{fingerprint}"));
+    url.set_query(None);
+    url.set_fragment(None);
+    Ok(url)
+}
+
+/// Reads the PEM root from step-ca's `{"ca": "<pem>"}` response.
+async fn fetch_root(client: &Client, url: &Url) -> Result<String> {
+    let response = client
+        .get(url.clone())
+        .send()
+        .await
+        .with_context(|| format!("Failed to fetch CA root from {url}"))?;
+    if !response.status().is_success() {
+        anyhow::bail!("CA root endpoint {url} returned {}", response.status());
+    }
+    let body: RootResponse = response
+        .json()
+        .await
+        .with_context(|| format!("CA root endpoint {url} did not return a {{\"ca\": ...}} body"))?;
+    Ok(body.ca)
+}
+
+async fn fetch_roots(client: &Client, url: &Url) -> Result<String> {
+    let response = client
+        .get(url.clone())
+        .send()
+        .await
+        .with_context(|| format!("Failed to fetch CA roots from {url}"))?;
+    if !response.status().is_success() {
+        anyhow::bail!("CA roots endpoint {url} returned {}", response.status());
+    }
+    response
+        .text()
+        .await
+        .with_context(|| format!("Failed to read CA roots from {url}"))
+}
+
+fn describe_roots(pem: &str) -> Result<Vec<FetchedRoot>> {
+    let certs = tls::parse_pem_to_cert_list(pem.as_bytes())
+        .context("CA roots endpoint did not return PEM certificates")?;
+    certs
+        .iter()
+        .map(|der| {
+            let (_, cert) = X509Certificate::from_der(der.as_ref())
+                .map_err(|err| anyhow::anyhow!("Failed to parse CA root: {err}"))?;
+            Ok(FetchedRoot {
+                subject: cert.subject().to_string(),
+                fingerprint: tls::sha256_hex(der.as_ref()),
+            })
+        })
+        .collect()
+}
+
+/// Lowercases a SHA-256 hex fingerprint and drops `:` separators.
+fn normalize_fingerprint(value: &str) -> Result<String> {
+    let normalized = value.trim().replace(':', "").to_ascii_lowercase();
+    if normalized.len() != SHA256_HEX_LEN || !normalized.chars().all(|ch| ch.is_ascii_hexdigit()) {
+        anyhow::bail!("--expected-fingerprint must be a SHA-256 hex fingerprint, got {value}");
+    }
+    Ok(normalized)
+}
+
+fn pins_matching(roots: &[FetchedRoot], expected: &str) -> Result<Vec<String>> {
+    if roots.iter().any(|root| root.fingerprint == expected) {
+        return Ok(vec![expected.to_string()]);
+    }
+    let served = roots
+        .iter()
+        .map(|root| root.fingerprint.as_str())
+        .collect::<Vec<_>>()
+        .join(", ");
+    anyhow::bail!(
+        "No CA root matches --expected-fingerprint {expected}; the CA served: {served}. \
+         Refusing to pin."
+    )
+}
+
+fn pins_confirmed(
+    roots: &[FetchedRoot],
+    url: &Url,
+    confirm: impl FnOnce(&[FetchedRoot], &Url) -> Result<bool>,
+) -> Result<Vec<String>> {
+    if !confirm(roots, url)? {
+        anyhow::bail!("CA root was not confirmed; refusing to pin.");
+    }
+    Ok(roots.iter().map(|root| root.fingerprint.clone()).collect())
+}
+
+fn confirm_on_terminal(roots: &[FetchedRoot], url: &Url) -> Result<bool> {
+    if !std::io::stdin().is_terminal() {
+        anyhow::bail!(
+            "Refusing to trust the CA root on first use without confirmation: stdin is not \
+             interactive. Pass --expected-fingerprint with the root's SHA-256 fingerprint."
+        );
+    }
+    let mut stderr = std::io::stderr().lock();
+    writeln!(stderr, "The CA at {url} presented these root certificates:")?;
+    for root in roots {
+        writeln!(
+            stderr,
+            "  {}\n    sha256:{}",
+            root.subject, root.fingerprint
+        )?;
+    }
+    write!(
+        stderr,
+        "Verify the fingerprints out of band. Pin and trust them? [y/N]: "
+    )?;
+    stderr.flush()?;
+    let mut answer = String::new();
+    std::io::stdin().lock().read_line(&mut answer)?;
+    Ok(matches!(
+        answer.trim().to_ascii_lowercase().as_str(),
+        "y" | "yes"
+    ))
+}
+
+/// Confirms the ACME server's TLS certificate chains to the fetched roots,
+/// so a root served by something other than the CA is never pinned.
+async fn verify_server_against_roots(server: &str, pem: &str, pins: &[String]) -> Result<()> {
+    let client = tls::build_http_client_from_pem(pem, pins)?;
+    client.get(server.trim()).send().await.with_context(|| {
+        format!("CA server {server} does not verify against the fetched root; refusing to pin")
+    })?;
+    Ok(())
+}
+
+async fn persist_pins(config_path: &Path, bundle_path: &Path, pins: &[String]) -> Result<()> {
+    let current = tokio::fs::read_to_string(config_path)
+        .await
+        .with_context(|| format!("Failed to read agent config at {}", config_path.display()))?;
+    let updates = trust_bootstrap::build_trust_updates(pins, bundle_path);
+    let updated = toml_util::upsert_section_keys(&current, TRUST_SECTION, &updates)
+        .context("Failed to upsert [trust] section into agent config")?;
+    fs_util::atomic_write(config_path, updated.as_bytes(), fs_util::KEY_FILE_MODE)
+        .await
+        .with_context(|| format!("Failed to write agent config to {}", config_path.display()))?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use rcgen::{BasicConstraints, CertificateParams, DnType, IsCa, KeyPair};
+    use wiremock::matchers::{method, path};
+    use wiremock::{Mock, MockServer, ResponseTemplate};
+
+    use super::*;
+
+    fn generate_root_pem(common_name: &str) -> String {
+        let key = KeyPair::generate().expect("generate key");
+        let mut params = CertificateParams::new(Vec::new()).expect("certificate params");
+        params
+            .distinguished_name
+            .push(DnType::CommonName, common_name);
+        params.is_ca = IsCa::Ca(BasicConstraints::Unconstrained);
+        params.self_signed(&key).expect("self-signed cert").pem()
+    }
+
+    fn roots(fingerprints: &[&str]) -> Vec<FetchedRoot> {
+        fingerprints
+            .iter()
+            .map(|fingerprint| FetchedRoot {
+                subject: "CN=Test Root".to_string(),
+                fingerprint: (*fingerprint).to_string(),
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_roots_url_uses_directory_origin() {
+        let url = roots_url("https://stepca:9000/acme/acme/directory?x=1").unwrap();
+        assert_eq!(url.as_str(), "https://stepca:9000/roots.pem");
+    }
+
+    #[test]
+    fn test_roots_url_rejects_plaintext_server() {
+        let err = roots_url("http://stepca:9000/acme/acme/directory").unwrap_err();
+        assert!(err.to_string().contains("https://"));
+    }
+
+    #[test]
+    fn test_normalize_fingerprint_accepts_colon_separated_upper_hex() {
+        let colon = ["AB"; 32].join(":");
+        assert_eq!(normalize_fingerprint(&colon).unwrap(), "ab".repeat(32));
+        assert!(normalize_fingerprint("abcd").is_err());
+        assert!(normalize_fingerprint(&"zz".repeat(32)).is_err());
+    }
+
+    #[test]
+    fn test_describe_roots_fingerprints_each_certificate() {
+        let pem = format!(
+            "{}{}",
+            generate_root_pem("Root A"),
+            generate_root_pem("Root B")
+        );
+
+        let described = describe_roots(&pem).unwrap();
+
+        assert_eq!(described.len(), 2);
+        assert!(described[0].subject.contains("Root A"));
+        assert_eq!(
+            described
+                .iter()
+                .map(|root| root.fingerprint.clone())
+                .collect::<Vec<_>>(),
+            tls::ca_bundle_fingerprints(&pem).unwrap()
+        );
+    }
+
+    #[test]
+    fn test_pins_matching_pins_only_the_expected_root() {
+        let a = "a".repeat(64);
+        let b = "b".repeat(64);
+
+        let pins = pins_matching(&roots(&[&a, &b]), &b).unwrap();
+
+        assert_eq!(pins, vec![b]);
+    }
+
+    #[test]
+    fn test_pins_matching_rejects_unknown_fingerprint() {
+        let a = "a".repeat(64);
+
+        let err = pins_matching(&roots(&[&a]), &"c".repeat(64)).unwrap_err();
+
+        assert!(err.to_string().contains("Refusing to pin"));
+        assert!(err.to_string().contains(&a));
+    }
+
+    #[test]
+    fn test_pins_confirmed_requires_operator_approval() {
+        let a = "a".repeat(64);
+        let url = Url::parse("https://stepca:9000/roots.pem").unwrap();
+
+        let declined = pins_confirmed(&roots(&[&a]), &url, |_, _| Ok(false));
+        let accepted = pins_confirmed(&roots(&[&a]), &url, |_, _| Ok(true)).unwrap();
+
+        assert!(declined.is_err());
+        assert_eq!(accepted, vec![a]);
+    }
+
+    #[tokio::test]
+    async fn test_fetch_roots_reads_pem_body() {
+        let server = MockServer::start().await;
+        let pem = generate_root_pem("Root A");
+        Mock::given(method("GET"))
+            .and(path(ROOTS_PATH))
+            .respond_with(ResponseTemplate::new(200).set_body_string(pem.clone()))
+            .mount(&server)
+            .await;
+        let url = Url::parse(&format!("{}{ROOTS_PATH}", server.uri())).unwrap();
+
+        let fetched = fetch_roots(&Client::new(), &url).await.unwrap();
+
+        assert_eq!(fetched, pem);
+    }
+
+    #[tokio::test]
+    async fn test_fetch_roots_rejects_error_status() {
+        let server = MockServer::start().await;
+        Mock::given(method("GET"))
+            .and(path(ROOTS_PATH))
+            .respond_with(ResponseTemplate::new(404))
+            .mount(&server)
+            .await;
+        let url = Url::parse(&format!("{}{ROOTS_PATH}", server.uri())).unwrap();
+
+        assert!(fetch_roots(&Client::new(), &url).await.is_err());
+    }
+
+    #[test]
+    fn test_root_url_names_the_fingerprint() {
+        let fingerprint = "a".repeat(64);
+        let url = root_url("https://stepca:9000/acme/acme/directory", &fingerprint).unwrap();
+        assert_eq!(
+            url.as_str(),
+            format!("https://stepca:9000/root/{fingerprint}")
+        );
+
+        let err = root_url("http://stepca:9000", &fingerprint).unwrap_err();
+        assert!(err.to_string().contains("https://"), "{err:#}");
+    }
+
+    #[tokio::test]
+    async fn test_fetch_root_reads_ca_field() {
+        let server = MockServer::start().await;
+        let pem = generate_root_pem("Root A");
+        let fingerprint = tls::ca_bundle_fingerprints(&pem).unwrap().remove(0);
+        Mock::given(method("GET"))
+            .and(path(format!("{ROOT_PATH_PREFIX}{fingerprint}")))
+            .respond_with(ResponseTemplate::new(200).set_body_json(serde_json::json!({
+                "ca": pem,
+            })))
+            .mount(&server)
+            .await;
+        let url = Url::parse(&format!("{}{ROOT_PATH_PREFIX}{fingerprint}", server.uri())).unwrap();
+
+        let fetched = fetch_root(&Client::new(), &url).await.unwrap();
+
+        assert_eq!(fetched, pem);
+        let pins = pins_matching(&describe_roots(&fetched).unwrap(), &fingerprint).unwrap();
+        assert_eq!(pins, vec![fingerprint]);
+    }
+
+    #[tokio::test]
+    async fn test_fetch_root_rejects_unexpected_body() {
+        let server = MockServer::start().await;
+        Mock::given(method("GET"))
+            .respond_with(ResponseTemplate::new(200).set_body_string("not json"))
+            .mount(&server)
+            .await;
+        let url = Url::parse(&format!("{}{ROOT_PATH_PREFIX}abc", server.uri())).unwrap();
+
+        let err = fetch_root(&Client::new(), &url).await.unwrap_err();
+
+        assert!(err.to_string().contains("\"ca\""), "{err:#}");
+    }
+
+    #[tokio::test]
+    async fn test_pin_root_from_ca_skips_when_already_pinned() {
+        let fingerprint = "a".repeat(64);
+        let mut settings = crate::config::Settings::new(None).unwrap();
+        settings.trust.trusted_ca_sha256 = vec![fingerprint.clone()];
+
+        // An unreachable URL proves nothing is fetched.
+        pin_root_from_ca(
+            &mut settings,
+            Path::new("missing-agent.toml"),
+            "https://127.0.0.1:1",
+            &fingerprint.to_ascii_uppercase(),
+        )
+        .await
+        .unwrap();
+
+        assert_eq!(settings.trust.trusted_ca_sha256, vec![fingerprint]);
+    }
+
+    #[tokio::test]
+    async fn test_persist_pins_writes_trust_section() {
+        let dir = tempfile::tempdir().unwrap();
+        let config_path = dir.path().join("agent.toml");
+        tokio::fs::write(&config_path, "email = \"admin@example.com\"\n")
+            .await
+            .unwrap();
+        let bundle_path = dir.path().join("ca-bundle.pem");
+
+        persist_pins(&config_path, &bundle_path, &["a".repeat(64)])
+            .await
+            .unwrap();
+
+        let written = tokio::fs::read_to_string(&config_path).await.unwrap();
+        assert!(written.contains("email = \"admin@example.com\""));
+        assert!(written.contains("[trust]"));
+        assert!(written.contains(&"a".repeat(64)));
+        assert!(written.contains("ca-bundle.pem"));
+    }
+}
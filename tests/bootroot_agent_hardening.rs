@@ -431,7 +431,9 @@ async fn oneshot_normal_run_without_trust_fails() -> Result<()> {
         String::from_utf8_lossy(&output.stderr)
     );
     assert!(
-        merged.contains("certificate") || merged.contains("Failed to issue certificate"),
+        merged.contains("certificate")
+            || merged.contains("Failed to issue certificate")
+            || merged.contains("cannot reach ACME server"),
         "{merged}"
     );
 